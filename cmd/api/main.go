@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/signal"
 	"time"
@@ -13,11 +14,20 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/nil-nil/ticket/internal/infrastructure/ristrettocache"
+	"github.com/nil-nil/ticket/internal/infrastructure/sqlrepository"
+	"github.com/nil-nil/ticket/internal/infrastructure/ticketeventbus"
 	"github.com/nil-nil/ticket/internal/infrastructure/ticketjwt"
 	"github.com/nil-nil/ticket/internal/services/api"
 	"github.com/nil-nil/ticket/internal/services/config"
+	"github.com/nil-nil/ticket/internal/services/email"
 )
 
+// domainVerificationInterval is how often pending domains are checked for their verification records
+const domainVerificationInterval = 5 * time.Minute
+
+const quarantineExpiryInterval = time.Hour
+
 func main() {
 	configFilePath := flag.String("config", "config.yaml", "Configuration file")
 	flag.Parse()
@@ -27,11 +37,76 @@ func main() {
 		log.Fatal(err)
 	}
 
-	apiServer := api.NewApi()
+	db, err := sqlrepository.Open(context.Background(), config.Database.Driver, config.Database.DSN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Migrate(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	users := sqlrepository.NewUserRepository(db)
+
+	cache, err := ristrettocache.NewCache(nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	bus, err := ticketeventbus.NewBus(":")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tickets := domain.NewTicketService(sqlrepository.NewTicketRepository(db), bus, cache)
+	if tickets.Workflow, err = config.TicketWorkflow(); err != nil {
+		log.Fatal(err)
+	}
+	if tickets.CustomFields, err = config.TicketCustomFields(); err != nil {
+		log.Fatal(err)
+	}
+	if err := sqlrepository.NewTicketIndexer(db).Subscribe(bus, func(ticketID uint64, err error) {
+		log.Printf("indexing ticket %d: %v", ticketID, err)
+	}); err != nil {
+		log.Fatal(err)
+	}
+	outboundQueue, err := domain.NewOutboundQueue(sqlrepository.NewOutboundRepository(db), bus, domain.DefaultRetryPolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	replies, err := email.NewReplyService(sqlrepository.NewMailServerRepository(db), tickets, outboundQueue, cache, bus)
+	if err != nil {
+		log.Fatal(err)
+	}
+	replies.OnNotifyError = func(ticketID uint64, err error) {
+		log.Printf("notifying the requester ticket %d was closed: %v", ticketID, err)
+	}
+
+	domains, err := domain.NewDNSDomainService(sqlrepository.NewDNSDomainRepository(db), bus, cache)
+	if err != nil {
+		log.Fatal(err)
+	}
+	domains.Resolver = net.DefaultResolver
+	domains.MXHosts = config.Domains.MXHosts
+
+	// Agents marking tickets as spam train the classifier the smtp binary scores inbound mail with
+	spam, err := email.NewSpamService(sqlrepository.NewMailServerRepository(db), tickets, email.NewBayesFilter(sqlrepository.NewSpamRepository(db)), cache, bus)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	aliases := domain.NewAliasService(sqlrepository.NewAliasRepository(db), bus)
+
+	quarantine, err := email.NewQuarantineService(sqlrepository.NewMailServerRepository(db), tickets, cache, bus)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if config.Quarantine.Retention > 0 {
+		quarantine.Retention = config.Quarantine.Retention
+	}
+
+	apiServer := api.NewApi(tickets, tickets.Workflow, tickets.CustomFields, replies, domains, spam, aliases, quarantine)
 	authProvider, err := ticketjwt.NewJwtAuthProvider(
-		func(ctx context.Context, userID uint64) (user domain.User, err error) {
-			return domain.User{ID: 999}, nil
-		},
+		users.Find,
 		[]byte(config.Auth.JWT.PublicKey),
 		[]byte(config.Auth.JWT.PrivateKey),
 		ticketjwt.GetJWTProtocol(config.Auth.JWT.SigningMethod),
@@ -56,6 +131,16 @@ func main() {
 	nctx, stop := signal.NotifyContext(ctx, os.Interrupt, os.Kill)
 	defer stop()
 
+	// Verify pending domains as their records are published, until shutdown
+	go domains.RunVerification(nctx, domainVerificationInterval, func(err error) {
+		log.Printf("verifying pending domains: %v", err)
+	})
+
+	// Delete unreviewed quarantined email once it expires, until shutdown
+	go quarantine.RunExpiry(nctx, quarantineExpiryInterval, func(err error) {
+		log.Printf("expiring quarantined email: %v", err)
+	})
+
 	go func() {
 		<-nctx.Done()
 		log.Println("shutdown initiated")
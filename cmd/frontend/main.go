@@ -8,8 +8,13 @@ import (
 	"os/signal"
 	"time"
 
+	"github.com/nil-nil/ticket/internal/domain"
 	"github.com/nil-nil/ticket/internal/frontend"
+	"github.com/nil-nil/ticket/internal/infrastructure/ristrettocache"
+	"github.com/nil-nil/ticket/internal/infrastructure/sqlrepository"
+	"github.com/nil-nil/ticket/internal/infrastructure/ticketeventbus"
 	"github.com/nil-nil/ticket/internal/services/config"
+	"github.com/nil-nil/ticket/internal/services/email"
 )
 
 func main() {
@@ -21,7 +26,46 @@ func main() {
 		log.Fatal(err)
 	}
 
-	server := frontend.NewServer(config)
+	db, err := sqlrepository.Open(context.Background(), config.Database.Driver, config.Database.DSN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Migrate(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+
+	cache, err := ristrettocache.NewCache(nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	bus, err := ticketeventbus.NewBus(":")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tickets := domain.NewTicketService(sqlrepository.NewTicketRepository(db), bus, cache)
+	if tickets.Workflow, err = config.TicketWorkflow(); err != nil {
+		log.Fatal(err)
+	}
+	if tickets.CustomFields, err = config.TicketCustomFields(); err != nil {
+		log.Fatal(err)
+	}
+	if err := sqlrepository.NewTicketIndexer(db).Subscribe(bus, func(ticketID uint64, err error) {
+		log.Printf("indexing ticket %d: %v", ticketID, err)
+	}); err != nil {
+		log.Fatal(err)
+	}
+	quarantine, err := email.NewQuarantineService(sqlrepository.NewMailServerRepository(db), tickets, cache, bus)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if config.Quarantine.Retention > 0 {
+		quarantine.Retention = config.Quarantine.Retention
+	}
+
+	server := frontend.NewServer(config, tickets, tickets.Workflow, quarantine)
 
 	// Shutdown the app on signal
 	ctx := context.Background()
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/nil-nil/ticket/internal/infrastructure/sqlrepository"
+	"github.com/nil-nil/ticket/internal/services/config"
+)
+
+// reindex rebuilds the full-text index of every ticket, catching up on any change the other binaries failed to index.
+func main() {
+	configFilePath := flag.String("config", "config.yaml", "Configuration file")
+	flag.Parse()
+
+	config, err := config.ReadAndParseConfigFile(*configFilePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	db, err := sqlrepository.Open(ctx, config.Database.Driver, config.Database.DSN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Migrate(ctx); err != nil {
+		log.Fatal(err)
+	}
+
+	indexed, err := sqlrepository.NewTicketIndexer(db).Rebuild(ctx)
+	if err != nil {
+		log.Fatalf("reindexed %d tickets before failing: %v", indexed, err)
+	}
+	log.Printf("reindexed %d tickets", indexed)
+}
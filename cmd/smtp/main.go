@@ -2,24 +2,56 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"expvar"
+	"flag"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/emersion/go-smtp"
 	"github.com/nil-nil/ticket/internal/domain"
 	"github.com/nil-nil/ticket/internal/infrastructure/gosmtpmail"
 	"github.com/nil-nil/ticket/internal/infrastructure/ristrettocache"
+	"github.com/nil-nil/ticket/internal/infrastructure/sqlrepository"
 	"github.com/nil-nil/ticket/internal/infrastructure/ticketeventbus"
+	"github.com/nil-nil/ticket/internal/infrastructure/ticketjwt"
+	"github.com/nil-nil/ticket/internal/services/config"
+	"github.com/nil-nil/ticket/internal/services/email"
+)
+
+var (
+	errInvalidCredentials = errors.New("invalid credentials")
+	errNoListeners        = errors.New("no smtp listen addresses configured")
+)
+
+const (
+	outboundQueueInterval  = 30 * time.Second
+	defaultShutdownTimeout = 10 * time.Second
 )
 
 func main() {
-	// configFilePath := flag.String("config", "config.yaml", "Configuration file")
-	// flag.Parse()
-	// config, err := config.ReadAndParseConfigFile(*configFilePath)
-	// if err != nil {
-	// 	log.Fatal(err)
-	// }
+	configFilePath := flag.String("config", "config.yaml", "Configuration file")
+	flag.Parse()
+	config, err := config.ReadAndParseConfigFile(*configFilePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := sqlrepository.Open(context.Background(), config.Database.Driver, config.Database.DSN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Migrate(context.Background()); err != nil {
+		log.Fatal(err)
+	}
 
 	cache, err := ristrettocache.NewCache(nil)
 	if err != nil {
@@ -31,7 +63,64 @@ func main() {
 		log.Fatal(err)
 	}
 
-	server := gosmtpmail.NewServer(nil, cache, bus, func(username, password string) (domain.User, error) { return domain.User{}, nil })
+	tickets := domain.NewTicketService(sqlrepository.NewTicketRepository(db), bus, cache)
+	if tickets.Workflow, err = config.TicketWorkflow(); err != nil {
+		log.Fatal(err)
+	}
+	if tickets.CustomFields, err = config.TicketCustomFields(); err != nil {
+		log.Fatal(err)
+	}
+	if err := sqlrepository.NewTicketIndexer(db).Subscribe(bus, func(ticketID uint64, err error) {
+		log.Printf("indexing ticket %d: %v", ticketID, err)
+	}); err != nil {
+		log.Fatal(err)
+	}
+
+	sender, err := gosmtpmail.NewSender(gosmtpmail.SenderOptions{
+		Address:  config.Outbound.Address,
+		Hostname: config.Outbound.Hostname,
+		Username: config.Outbound.Username,
+		Password: config.Outbound.Password,
+		TLS:      gosmtpmail.TLSMode(config.Outbound.TLS),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Outbound mail is signed with its From domain's DKIM key as it's delivered
+	domains, err := domain.NewDNSDomainService(sqlrepository.NewDNSDomainRepository(db), bus, cache)
+	if err != nil {
+		log.Fatal(err)
+	}
+	signer := email.NewDKIMSender(domains, sender)
+	outboundQueue, err := domain.NewOutboundQueue(sqlrepository.NewOutboundRepository(db), bus, domain.DefaultRetryPolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Users authenticate with their user ID and an API token, without which nobody can relay mail
+	var authFunc email.AuthFunc
+	if config.Auth.JWT != nil {
+		authProvider, err := ticketjwt.NewJwtAuthProvider(
+			sqlrepository.NewUserRepository(db).Find,
+			[]byte(config.Auth.JWT.PublicKey),
+			[]byte(config.Auth.JWT.PrivateKey),
+			ticketjwt.GetJWTProtocol(config.Auth.JWT.SigningMethod),
+			config.Auth.JWT.TokenLifetime,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		authFunc = func(username, password string) (domain.User, error) {
+			user, err := authProvider.GetUser(context.Background(), password)
+			if err != nil {
+				return domain.User{}, err
+			}
+			if username != strconv.FormatUint(user.ID, 10) {
+				return domain.User{}, errInvalidCredentials
+			}
+			return user, nil
+		}
+	}
 
 	// Shutdown the app on signal
 	ctx := context.Background()
@@ -39,14 +128,201 @@ func main() {
 	nctx, stop := signal.NotifyContext(ctx, os.Interrupt, os.Kill)
 	defer stop()
 
+	var tlsConfig *tls.Config
+	if config.SMTP.TLS.CertFile != "" {
+		cert, err := gosmtpmail.LoadCertificate(config.SMTP.TLS.CertFile, config.SMTP.TLS.KeyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tlsConfig = cert.TLSConfig()
+		if config.SMTP.TLS.ReloadInterval > 0 {
+			go cert.Watch(nctx, config.SMTP.TLS.ReloadInterval, func(err error) {
+				log.Printf("reloading tls certificate: %v", err)
+			})
+		}
+	}
+
+	type listener struct {
+		server *smtp.Server
+		net.Listener
+	}
+	var (
+		mailServerRepo = sqlrepository.NewMailServerRepository(db)
+		servers        []*smtp.Server
+		listeners      []listener
+	)
+	listen := func(server *smtp.Server, addr string, implicitTLS bool) {
+		l, err := gosmtpmail.Listen(server, addr, implicitTLS, config.SMTP.Listen.SocketGroup)
+		if err != nil {
+			log.Fatal(err)
+		}
+		listeners = append(listeners, listener{server: server, Listener: l})
+	}
+
+	authPolicy := email.DefaultAuthPolicy
+	for _, action := range []struct {
+		configured string
+		action     *email.AuthAction
+	}{
+		{config.SMTP.AuthPolicy.SPF, &authPolicy.SPF},
+		{config.SMTP.AuthPolicy.DKIM, &authPolicy.DKIM},
+		{config.SMTP.AuthPolicy.DMARC, &authPolicy.DMARC},
+	} {
+		if action.configured != "" {
+			*action.action = email.AuthAction(action.configured)
+		}
+	}
+	if err := authPolicy.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Mail arriving on the MX listeners is scored for spam, learning from the tickets agents mark as spam
+	var spamFilters []email.SpamFilter
+	spamPolicy := email.DefaultSpamPolicy
+	if !config.SMTP.Spam.Disabled {
+		for _, threshold := range []struct {
+			configured *float64
+			threshold  *float64
+		}{
+			{config.SMTP.Spam.Tag, &spamPolicy.Tag},
+			{config.SMTP.Spam.Quarantine, &spamPolicy.Quarantine},
+			{config.SMTP.Spam.Reject, &spamPolicy.Reject},
+		} {
+			if threshold.configured != nil {
+				*threshold.threshold = *threshold.configured
+			}
+		}
+		if err := spamPolicy.Validate(); err != nil {
+			log.Fatal(err)
+		}
+
+		zones := make([]email.DNSBLZone, 0, len(config.SMTP.Spam.DNSBL))
+		for _, zone := range config.SMTP.Spam.DNSBL {
+			zones = append(zones, email.DNSBLZone(zone))
+		}
+		bayes := email.NewBayesFilter(sqlrepository.NewSpamRepository(db))
+		if config.SMTP.Spam.Bayes.Weight != 0 {
+			bayes.Weight = config.SMTP.Spam.Bayes.Weight
+		}
+		if config.SMTP.Spam.Bayes.MinTraining != 0 {
+			bayes.MinTraining = config.SMTP.Spam.Bayes.MinTraining
+		}
+		spamFilters = []email.SpamFilter{email.HeuristicsFilter{}, email.NewDNSBLFilter(net.DefaultResolver, zones), bayes}
+	}
+
+	limiter := gosmtpmail.NewLimiter(gosmtpmail.Limits{
+		ConnectionsPerIP: config.SMTP.RateLimits.ConnectionsPerIP,
+		IPConnections:    gosmtpmail.RateLimit(config.SMTP.RateLimits.IPConnections),
+		IPMessages:       gosmtpmail.RateLimit(config.SMTP.RateLimits.IPMessages),
+		IPRecipients:     gosmtpmail.RateLimit(config.SMTP.RateLimits.IPRecipients),
+		SenderMessages:   gosmtpmail.RateLimit(config.SMTP.RateLimits.SenderMessages),
+		SenderRecipients: gosmtpmail.RateLimit(config.SMTP.RateLimits.SenderRecipients),
+	})
+
+	serverOptions := gosmtpmail.ServerOptions{
+		Hostname:          config.SMTP.Hostname,
+		ReadTimeout:       config.SMTP.Timeouts.Read,
+		WriteTimeout:      config.SMTP.Timeouts.Write,
+		MaxMessageBytes:   config.SMTP.Limits.MaxMessageBytes,
+		MaxRecipients:     config.SMTP.Limits.MaxRecipients,
+		TLSConfig:         tlsConfig,
+		AllowInsecureAuth: config.SMTP.TLS.AllowInsecureAuth,
+		Limiter:           limiter,
+	}
+
+	mxOptions := serverOptions
+	mxOptions.Resolver = net.DefaultResolver
+	mxOptions.AuthPolicy = authPolicy
+	mxOptions.SpamFilters = spamFilters
+	mxOptions.SpamPolicy = spamPolicy
+	mx := gosmtpmail.NewServer(mailServerRepo, tickets, outboundQueue, cache, bus, authFunc, mxOptions)
+	servers = append(servers, mx)
+	for _, addr := range addresses(config.SMTP.Listen.MX, ":25") {
+		listen(mx, addr, false)
+	}
+
+	// Agents submit mail with STARTTLS or implicit TLS, which needs both a certificate and a way to authenticate
+	if tlsConfig != nil && authFunc != nil {
+		submissionOptions := serverOptions
+		submissionOptions.RequireAuth = true
+		submission := gosmtpmail.NewServer(mailServerRepo, tickets, outboundQueue, cache, bus, authFunc, submissionOptions)
+		servers = append(servers, submission)
+		for _, addr := range addresses(config.SMTP.Listen.Submission, ":587") {
+			listen(submission, addr, false)
+		}
+		for _, addr := range addresses(config.SMTP.Listen.SubmissionTLS, ":465") {
+			listen(submission, addr, true)
+		}
+	}
+	// An MTA in front of us hands over mail it has already accepted with LMTP. Its own checks replace SPF, DKIM and DMARC, which would only see the MTA's address
+	if len(config.SMTP.Listen.LMTP) > 0 {
+		lmtpOptions := serverOptions
+		lmtpOptions.TLSConfig = nil
+		lmtpOptions.LMTP = true
+		lmtpOptions.Limiter = nil
+		lmtp := gosmtpmail.NewServer(mailServerRepo, tickets, outboundQueue, cache, bus, nil, lmtpOptions)
+		servers = append(servers, lmtp)
+		for _, addr := range config.SMTP.Listen.LMTP {
+			listen(lmtp, addr, false)
+		}
+	}
+	if len(listeners) == 0 {
+		log.Fatal(errNoListeners)
+	}
+
+	// Serve the counters published with expvar, such as connections and messages refused by the rate limits
+	var metricsServer *http.Server
+	if config.SMTP.MetricsAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/debug/vars", expvar.Handler())
+		metricsServer = &http.Server{Addr: config.SMTP.MetricsAddress, Handler: mux}
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("metrics server stopped: %v", err)
+			}
+		}()
+	}
+
+	// Deliver queued outbound mail until shutdown
+	go outboundQueue.Run(nctx, signer, outboundQueueInterval, func(err error) {
+		log.Printf("processing outbound queue: %v", err)
+	})
+
 	go func() {
 		<-nctx.Done()
 		log.Println("shutdown initiated")
-		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		shutdownTimeout := config.SMTP.Timeouts.Shutdown
+		if shutdownTimeout == 0 {
+			shutdownTimeout = defaultShutdownTimeout
+		}
+		ctx, cancel := context.WithTimeout(ctx, shutdownTimeout)
 		defer cancel()
-		server.Shutdown(ctx)
+		for _, server := range servers {
+			server.Shutdown(ctx)
+		}
+		if metricsServer != nil {
+			metricsServer.Shutdown(ctx)
+		}
 		log.Println("shutdown")
 	}()
 
-	server.ListenAndServe()
+	var wg sync.WaitGroup
+	for _, l := range listeners {
+		wg.Add(1)
+		go func(l listener) {
+			defer wg.Done()
+			if err := l.server.Serve(l); err != nil && !errors.Is(err, smtp.ErrServerClosed) {
+				log.Printf("smtp server on %s stopped: %v", l.Addr(), err)
+			}
+		}(l)
+	}
+	wg.Wait()
+}
+
+// addresses returns the configured listen addresses, or the standard one if the list was omitted. An empty list disables the listener.
+func addresses(configured []string, standard string) []string {
+	if configured == nil {
+		return []string{standard}
+	}
+	return configured
 }
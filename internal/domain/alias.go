@@ -3,6 +3,7 @@ package domain
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -10,6 +11,8 @@ type AliasRepository interface {
 	Find(context.Context, FindAliasParameters) (Alias, error)
 	Create(ctx context.Context, user string, domain string) (Alias, error)
 	Delete(ctx context.Context, ID uint64) (Alias, error)
+	SetOwner(ctx context.Context, ID uint64, OwnerID *uint64) (Alias, error)
+	SetRouting(ctx context.Context, ID uint64, routing AliasRouting) (Alias, error)
 }
 
 type FindAliasParameters struct {
@@ -18,38 +21,87 @@ type FindAliasParameters struct {
 	User   *string
 }
 
+// CatchAllUser is the user of a domain's catch-all alias, receiving mail for addresses with no alias of their own.
+const CatchAllUser = "*"
+
 type Alias struct {
 	ID        uint64
 	User      string
 	Domain    string
 	DeletedAt *time.Time
+	// OwnerID is the user allowed to send mail as the alias
+	OwnerID *uint64
+	// Routing is where tickets opened by mail to the alias land
+	Routing AliasRouting
+}
+
+// AliasRouting sets up tickets opened by mail to an alias, so mail to sales@ and support@ reaches the right people.
+type AliasRouting struct {
+	// Queue is the team queue tickets are filed in, empty for none
+	Queue string
+	// DefaultOwnerID is the user tickets are assigned to, nil leaving them unassigned
+	DefaultOwnerID *uint64
+	// Priority is the priority tickets start with, TicketPriorityUnknown leaving it unset
+	Priority TicketPriority
+	// Tags are added to tickets
+	Tags []string
+	// Private only lets senders we've dealt with before open tickets, holding mail from anyone else in quarantine
+	Private bool
+}
+
+// TicketParameters returns the ticket update applying the routing to a new ticket.
+func (r AliasRouting) TicketParameters() TicketUpdateParameters {
+	params := TicketUpdateParameters{
+		OwnerID:  r.DefaultOwnerID,
+		Priority: r.Priority,
+		AddTags:  r.Tags,
+	}
+	if r.Queue != "" {
+		params.Queue = &r.Queue
+	}
+	return params
 }
 
 func (a *Alias) GetEmail() string {
 	return fmt.Sprintf("%s@%s", a.User, a.Domain)
 }
 
-func NewAliasService(repo AliasRepository) *AliasService {
+// IsCatchAll checks whether the alias is its domain's catch-all.
+func (a *Alias) IsCatchAll() bool {
+	return a.User == CatchAllUser
+}
+
+// IsOwnedBy checks whether the user may send mail as the alias.
+func (a *Alias) IsOwnedBy(userID uint64) bool {
+	return a.OwnerID != nil && *a.OwnerID == userID
+}
+
+func NewAliasService(repo AliasRepository, eventBusDriver EventBusDriver) *AliasService {
+	eventBus, _ := NewEventBus[Alias]("aliases", eventBusDriver)
 	return &AliasService{
-		repo: repo,
+		repo:     repo,
+		eventBus: eventBus,
 	}
 }
 
+// AliasService manages aliases, publishing every change on the aliases event bus so the mail server's alias cache stays fresh.
 type AliasService struct {
-	repo AliasRepository
+	repo     AliasRepository
+	eventBus *EventBus[Alias]
 }
 
 func (s *AliasService) Find(ctx context.Context, params FindAliasParameters) (Alias, error) {
 	return s.repo.Find(ctx, params)
 }
 
+// Create adds an alias. Addresses are matched regardless of case, so the user and domain are stored in lower case.
 func (s *AliasService) Create(ctx context.Context, user string, domain string) (Alias, error) {
-	alias, err := s.repo.Create(ctx, user, domain)
+	alias, err := s.repo.Create(ctx, strings.ToLower(user), strings.ToLower(domain))
 	if err != nil {
 		return Alias{}, err
 	}
 
-	return alias, nil
+	return s.publish(alias, CreateEvent)
 }
 
 func (s *AliasService) Delete(ctx context.Context, ID uint64) (Alias, error) {
@@ -58,5 +110,33 @@ func (s *AliasService) Delete(ctx context.Context, ID uint64) (Alias, error) {
 		return Alias{}, err
 	}
 
+	return s.publish(alias, DeleteEvent)
+}
+
+// SetOwner changes which user may send mail as the alias. A nil OwnerID leaves nobody able to.
+func (s *AliasService) SetOwner(ctx context.Context, ID uint64, OwnerID *uint64) (Alias, error) {
+	alias, err := s.repo.SetOwner(ctx, ID, OwnerID)
+	if err != nil {
+		return Alias{}, err
+	}
+
+	return s.publish(alias, UpdateEvent)
+}
+
+// SetRouting changes where tickets opened by mail to the alias land. Tickets already opened are left as they are.
+func (s *AliasService) SetRouting(ctx context.Context, ID uint64, routing AliasRouting) (Alias, error) {
+	routing.Tags = NormalizeTags(routing.Tags)
+	alias, err := s.repo.SetRouting(ctx, ID, routing)
+	if err != nil {
+		return Alias{}, err
+	}
+
+	return s.publish(alias, UpdateEvent)
+}
+
+func (s *AliasService) publish(alias Alias, eventType EventType) (Alias, error) {
+	if err := s.eventBus.Publish(fmt.Sprint(alias.ID), eventType, alias); err != nil {
+		return Alias{}, err
+	}
 	return alias, nil
 }
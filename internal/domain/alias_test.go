@@ -31,6 +31,11 @@ func TestAliasEmail(t *testing.T) {
 	}
 }
 
+func TestAliasIsCatchAll(t *testing.T) {
+	assert.True(t, (&domain.Alias{User: domain.CatchAllUser, Domain: "test.com"}).IsCatchAll())
+	assert.False(t, (&domain.Alias{User: "bob", Domain: "test.com"}).IsCatchAll())
+}
+
 func TestGetAlias(t *testing.T) {
 	var repo = mockAliasRepo{
 		aliases: map[string]domain.Alias{
@@ -39,7 +44,7 @@ func TestGetAlias(t *testing.T) {
 		},
 	}
 
-	svc := domain.NewAliasService(&repo)
+	svc := domain.NewAliasService(&repo, &mockEventBusDriver{})
 
 	alias, err := svc.Find(context.Background(), domain.FindAliasParameters{User: ptr.To("bob"), Domain: ptr.To("sample.com")})
 	assert.Equal(t, domain.Alias{}, alias, "alias should be empty")
@@ -58,11 +63,17 @@ func TestCreateAlias(t *testing.T) {
 		},
 	}
 
-	svc := domain.NewAliasService(&repo)
+	eventDrv := mockEventBusDriver{}
+	svc := domain.NewAliasService(&repo, &eventDrv)
 
 	alias, err := svc.Create(context.Background(), "bob", "sample.com")
 	assert.Equal(t, domain.Alias{ID: 3, User: "bob", Domain: "sample.com"}, alias, "alias should not be empty")
 	assert.NoError(t, err, "error should be nil")
+
+	alias, err = svc.Create(context.Background(), "Alice", "Sample.COM")
+	assert.NoError(t, err, "error should be nil")
+	assert.Equal(t, domain.Alias{ID: 4, User: "alice", Domain: "sample.com"}, alias, "alias should be lower case")
+	assert.Equal(t, "aliases:4:create", *eventDrv.EventSubject, "new aliases should be published")
 }
 
 func TestDeleteAlias(t *testing.T) {
@@ -73,7 +84,7 @@ func TestDeleteAlias(t *testing.T) {
 		},
 	}
 
-	svc := domain.NewAliasService(&repo)
+	svc := domain.NewAliasService(&repo, &mockEventBusDriver{})
 
 	alias, err := svc.Delete(context.Background(), 2)
 	assert.Equal(t, repo.aliases["sample@example.com"], alias, "alias should not be empty")
@@ -81,6 +92,55 @@ func TestDeleteAlias(t *testing.T) {
 	assert.NoError(t, err, "error should be nil")
 }
 
+func TestSetAliasOwner(t *testing.T) {
+	var repo = mockAliasRepo{
+		aliases: map[string]domain.Alias{
+			"test@test.com": {ID: 1, User: "test", Domain: "test.com"},
+		},
+	}
+
+	svc := domain.NewAliasService(&repo, &mockEventBusDriver{})
+
+	alias, err := svc.SetOwner(context.Background(), 1, ptr.To(uint64(7)))
+	assert.NoError(t, err, "error should be nil")
+	assert.True(t, alias.IsOwnedBy(7), "alias should be owned by the new owner")
+	assert.False(t, alias.IsOwnedBy(8), "alias shouldn't be owned by anyone else")
+
+	alias, err = svc.SetOwner(context.Background(), 1, nil)
+	assert.NoError(t, err, "error should be nil")
+	assert.False(t, alias.IsOwnedBy(7), "alias without an owner shouldn't be owned by anyone")
+
+	_, err = svc.SetOwner(context.Background(), 99, ptr.To(uint64(7)))
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+func TestSetAliasRouting(t *testing.T) {
+	var repo = mockAliasRepo{
+		aliases: map[string]domain.Alias{
+			"sales@test.com": {ID: 1, User: "sales", Domain: "test.com"},
+		},
+	}
+	eventDrv := mockEventBusDriver{}
+	svc := domain.NewAliasService(&repo, &eventDrv)
+
+	routing := domain.AliasRouting{Queue: "Sales", DefaultOwnerID: ptr.To(uint64(7)), Priority: domain.TicketPriorityHigh, Tags: []string{"Lead", "lead"}}
+	alias, err := svc.SetRouting(context.Background(), 1, routing)
+	assert.NoError(t, err, "error should be nil")
+	assert.Equal(t, domain.AliasRouting{Queue: "Sales", DefaultOwnerID: ptr.To(uint64(7)), Priority: domain.TicketPriorityHigh, Tags: []string{"lead"}}, alias.Routing, "tags should be normalized")
+	assert.Equal(t, "aliases:1:update", *eventDrv.EventSubject, "routing changes should be published")
+	assert.Equal(t, alias, eventDrv.EventData)
+
+	_, err = svc.SetRouting(context.Background(), 99, routing)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+func TestAliasRoutingTicketParameters(t *testing.T) {
+	params := domain.AliasRouting{Queue: "sales", DefaultOwnerID: ptr.To(uint64(7)), Priority: domain.TicketPriorityHigh, Tags: []string{"lead"}}.TicketParameters()
+	assert.Equal(t, domain.TicketUpdateParameters{Queue: ptr.To("sales"), OwnerID: ptr.To(uint64(7)), Priority: domain.TicketPriorityHigh, AddTags: []string{"lead"}}, params)
+
+	assert.Equal(t, domain.TicketUpdateParameters{}, domain.AliasRouting{}.TicketParameters(), "no routing should leave the ticket as it is")
+}
+
 type mockAliasRepo struct {
 	aliases map[string]domain.Alias
 }
@@ -115,12 +175,34 @@ func (m *mockAliasRepo) Delete(ctx context.Context, ID uint64) (domain.Alias, er
 			m.aliases[k] = alias
 		}
 	}
-	if alias == (domain.Alias{}) {
+	if alias.ID == 0 {
 		return alias, domain.ErrNotFound
 	}
 	return alias, nil
 }
 
+func (m *mockAliasRepo) SetOwner(ctx context.Context, ID uint64, OwnerID *uint64) (domain.Alias, error) {
+	for k, alias := range m.aliases {
+		if alias.ID == ID {
+			alias.OwnerID = OwnerID
+			m.aliases[k] = alias
+			return alias, nil
+		}
+	}
+	return domain.Alias{}, domain.ErrNotFound
+}
+
+func (m *mockAliasRepo) SetRouting(ctx context.Context, ID uint64, routing domain.AliasRouting) (domain.Alias, error) {
+	for k, alias := range m.aliases {
+		if alias.ID == ID {
+			alias.Routing = routing
+			m.aliases[k] = alias
+			return alias, nil
+		}
+	}
+	return domain.Alias{}, domain.ErrNotFound
+}
+
 func (m *mockAliasRepo) getNextId() uint64 {
 	if len(m.aliases) == 0 {
 		return 1
@@ -0,0 +1,35 @@
+package domain
+
+// AuthResult is the outcome of an SPF, DKIM or DMARC check, named as in Authentication-Results headers (RFC 8601).
+type AuthResult string
+
+const (
+	AuthResultNone      AuthResult = "none"
+	AuthResultPass      AuthResult = "pass"
+	AuthResultFail      AuthResult = "fail"
+	AuthResultSoftFail  AuthResult = "softfail"
+	AuthResultNeutral   AuthResult = "neutral"
+	AuthResultTempError AuthResult = "temperror"
+	AuthResultPermError AuthResult = "permerror"
+)
+
+// AuthCheck is the result of one authentication method.
+type AuthCheck struct {
+	Result AuthResult
+	// Domain is the domain that was authenticated, e.g. the envelope sender's domain for SPF
+	Domain string
+}
+
+// EmailAuthentication records whether inbound email really came from the domains it claims to.
+type EmailAuthentication struct {
+	// SPF checks the client was allowed to send mail for the envelope sender's domain
+	SPF AuthCheck
+	// DKIM is the best of the message's signatures, preferring one from the From domain
+	DKIM AuthCheck
+	// DMARC checks SPF or DKIM passed for a domain aligned with the From header
+	DMARC AuthCheck
+	// DMARCPolicy is what the From domain asks receivers to do with mail failing DMARC: none, quarantine or reject
+	DMARCPolicy string
+	// Flagged is set when a failed check was accepted but marked as suspicious by policy
+	Flagged bool
+}
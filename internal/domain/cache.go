@@ -1,6 +1,9 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
 	ErrNotFoundInCache    = errors.New("key not found in cache")
@@ -9,6 +12,21 @@ var (
 	ErrCacheKeyInvalid    = errors.New("not a valid cache key")
 )
 
+// CacheTTL is how long services use what they cached before reloading it. Events keep caches fresh, but only reach
+// the process publishing them, so a change made by another binary is seen within this long.
+const CacheTTL = time.Minute
+
+// Cached is a cached value along with when it was loaded.
+type Cached[T any] struct {
+	Value    T
+	LoadedAt time.Time
+}
+
+// Fresh checks whether the value was loaded less than ttl ago.
+func (c Cached[T]) Fresh(ttl time.Duration) bool {
+	return time.Since(c.LoadedAt) < ttl
+}
+
 type CacheDriver interface {
 	Set(key string, value interface{}) error
 	Forget(key string) error
@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidComment = errors.New("invalid comment")
+
+// CommentVisibility is who can see a comment on a ticket.
+type CommentVisibility int
+
+const (
+	CommentVisibilityUnknown CommentVisibility = iota
+	// CommentVisibilityPublic is a reply the customer can see
+	CommentVisibilityPublic
+	// CommentVisibilityInternal is a note only agents can see
+	CommentVisibilityInternal
+)
+
+func (v CommentVisibility) String() string {
+	switch v {
+	case CommentVisibilityPublic:
+		return "Public"
+	case CommentVisibilityInternal:
+		return "Internal"
+	}
+	return "Unset"
+}
+
+// ParseCommentVisibility parses a visibility's name regardless of case, returning CommentVisibilityUnknown for anything else.
+func ParseCommentVisibility(s string) CommentVisibility {
+	for v := CommentVisibilityPublic; v <= CommentVisibilityInternal; v++ {
+		if strings.EqualFold(s, v.String()) {
+			return v
+		}
+	}
+	return CommentVisibilityUnknown
+}
+
+// TicketComment is a public reply or internal note on a ticket's timeline, written by a user.
+type TicketComment struct {
+	ID         uint64
+	AuthorID   uint64
+	Body       string
+	Visibility CommentVisibility
+	// Attachments are listed without their content, which is fetched one at a time
+	Attachments []Attachment
+}
+
+// IsInternal checks whether only agents can see the comment.
+func (c TicketComment) IsInternal() bool {
+	return c.Visibility == CommentVisibilityInternal
+}
+
+// Validate checks the comment has an author, a visibility and something to say, be it a body or attachments.
+func (c TicketComment) Validate() error {
+	if c.AuthorID == 0 {
+		return fmt.Errorf("%w: comment has no author", ErrInvalidComment)
+	}
+	if c.Visibility != CommentVisibilityPublic && c.Visibility != CommentVisibilityInternal {
+		return fmt.Errorf("%w: comment visibility must be public or internal", ErrInvalidComment)
+	}
+	if strings.TrimSpace(c.Body) == "" && len(c.Attachments) == 0 {
+		return fmt.Errorf("%w: comment is empty", ErrInvalidComment)
+	}
+	for _, a := range c.Attachments {
+		if strings.TrimSpace(a.Filename) == "" {
+			return fmt.Errorf("%w: attachment has no filename", ErrInvalidComment)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCustomField = errors.New("invalid custom field")
+	ErrUnknownCustomField = errors.New("unknown custom field")
+	ErrInvalidFieldValue  = errors.New("invalid field value")
+)
+
+// CustomFieldType is the kind of value a custom field holds.
+type CustomFieldType string
+
+const (
+	CustomFieldText        CustomFieldType = "text"
+	CustomFieldNumber      CustomFieldType = "number"
+	CustomFieldDate        CustomFieldType = "date"
+	CustomFieldSelect      CustomFieldType = "select"
+	CustomFieldMultiSelect CustomFieldType = "multiselect"
+)
+
+// CustomFieldDateLayout is how date field values are written.
+const CustomFieldDateLayout = "2006-01-02"
+
+var customFieldKeyRegex = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// CustomFieldDefinition is a field admins add to tickets, such as the product area a ticket is about.
+type CustomFieldDefinition struct {
+	// Key identifies the field on tickets, so it must never be reused for another field
+	Key  string
+	Name string
+	Type CustomFieldType
+	// Options are the values select and multiselect fields can take
+	Options []string
+}
+
+// CustomFields are the fields defined for tickets, and validate the values tickets are given for them.
+//
+// Every value is held as a list of strings: a single element for text, number, date and select fields,
+// any number of options for multiselect ones. An empty list clears the field.
+type CustomFields struct {
+	definitions []CustomFieldDefinition
+}
+
+// NewCustomFields checks the definitions have unique keys, and that select fields have options to pick from.
+func NewCustomFields(definitions []CustomFieldDefinition) (*CustomFields, error) {
+	f := &CustomFields{}
+	for _, d := range definitions {
+		d.Key = strings.TrimSpace(d.Key)
+		d.Name = strings.TrimSpace(d.Name)
+		if !customFieldKeyRegex.MatchString(d.Key) {
+			return nil, fmt.Errorf("%w: key %q must be lower case letters, digits and underscores", ErrInvalidCustomField, d.Key)
+		}
+		if _, ok := f.Definition(d.Key); ok {
+			return nil, fmt.Errorf("%w: key %q is defined twice", ErrInvalidCustomField, d.Key)
+		}
+		if d.Name == "" {
+			d.Name = d.Key
+		}
+
+		switch d.Type {
+		case CustomFieldText, CustomFieldNumber, CustomFieldDate:
+			if len(d.Options) > 0 {
+				return nil, fmt.Errorf("%w: %s field %q can't have options", ErrInvalidCustomField, d.Type, d.Key)
+			}
+		case CustomFieldSelect, CustomFieldMultiSelect:
+			options := make([]string, 0, len(d.Options))
+			for _, option := range d.Options {
+				option = strings.TrimSpace(option)
+				if option == "" || slices.ContainsFunc(options, func(o string) bool { return strings.EqualFold(o, option) }) {
+					return nil, fmt.Errorf("%w: %s field %q has an empty or duplicate option", ErrInvalidCustomField, d.Type, d.Key)
+				}
+				options = append(options, option)
+			}
+			if len(options) == 0 {
+				return nil, fmt.Errorf("%w: %s field %q has no options", ErrInvalidCustomField, d.Type, d.Key)
+			}
+			d.Options = options
+		default:
+			return nil, fmt.Errorf("%w: field %q has unknown type %q", ErrInvalidCustomField, d.Key, d.Type)
+		}
+
+		f.definitions = append(f.definitions, d)
+	}
+	return f, nil
+}
+
+// Definitions returns the fields in the order they were defined.
+func (f *CustomFields) Definitions() []CustomFieldDefinition {
+	return slices.Clone(f.definitions)
+}
+
+func (f *CustomFields) Definition(key string) (CustomFieldDefinition, bool) {
+	for _, d := range f.definitions {
+		if d.Key == key {
+			return d, true
+		}
+	}
+	return CustomFieldDefinition{}, false
+}
+
+// Normalize validates values by field key, returning them written the same way whatever way they were given:
+// numbers in their shortest form, dates as CustomFieldDateLayout and options as they were defined.
+//
+// Errors wrap ErrUnknownCustomField or ErrInvalidFieldValue.
+func (f *CustomFields) Normalize(values map[string][]string) (map[string][]string, error) {
+	normalized := make(map[string][]string, len(values))
+	for key, value := range values {
+		d, ok := f.Definition(key)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownCustomField, key)
+		}
+		v, err := d.normalize(value)
+		if err != nil {
+			return nil, err
+		}
+		normalized[key] = v
+	}
+	return normalized, nil
+}
+
+func (d CustomFieldDefinition) normalize(value []string) ([]string, error) {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s %s", ErrInvalidFieldValue, d.Key, fmt.Sprintf(format, args...))
+	}
+
+	trimmed := make([]string, 0, len(value))
+	for _, v := range value {
+		if v = strings.TrimSpace(v); v != "" {
+			trimmed = append(trimmed, v)
+		}
+	}
+	if len(trimmed) == 0 {
+		return []string{}, nil
+	}
+	if d.Type != CustomFieldMultiSelect && len(trimmed) > 1 {
+		return nil, invalid("takes a single value")
+	}
+
+	normalized := make([]string, 0, len(trimmed))
+	for _, v := range trimmed {
+		switch d.Type {
+		case CustomFieldNumber:
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, invalid("must be a number")
+			}
+			v = strconv.FormatFloat(n, 'f', -1, 64)
+		case CustomFieldDate:
+			date, err := time.Parse(CustomFieldDateLayout, v)
+			if err != nil {
+				return nil, invalid("must be a date written as %s", CustomFieldDateLayout)
+			}
+			v = date.Format(CustomFieldDateLayout)
+		case CustomFieldSelect, CustomFieldMultiSelect:
+			i := slices.IndexFunc(d.Options, func(o string) bool { return strings.EqualFold(o, v) })
+			if i < 0 {
+				return nil, invalid("must be one of %s", strings.Join(d.Options, ", "))
+			}
+			v = d.Options[i]
+		}
+		if !slices.Contains(normalized, v) {
+			normalized = append(normalized, v)
+		}
+	}
+	return normalized, nil
+}
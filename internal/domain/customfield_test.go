@@ -0,0 +1,105 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testCustomFields(t *testing.T) *domain.CustomFields {
+	fields, err := domain.NewCustomFields([]domain.CustomFieldDefinition{
+		{Key: "product_area", Name: "Product area", Type: domain.CustomFieldSelect, Options: []string{"Billing", "API", " Mobile app "}},
+		{Key: "platforms", Type: domain.CustomFieldMultiSelect, Options: []string{"iOS", "Android"}},
+		{Key: "seats", Name: "Seats", Type: domain.CustomFieldNumber},
+		{Key: "renewal", Name: "Renewal date", Type: domain.CustomFieldDate},
+		{Key: "account", Name: "Account", Type: domain.CustomFieldText},
+	})
+	require.NoError(t, err)
+	return fields
+}
+
+func TestNewCustomFields(t *testing.T) {
+	fields := testCustomFields(t)
+	assert.Len(t, fields.Definitions(), 5)
+
+	platforms, ok := fields.Definition("platforms")
+	assert.True(t, ok)
+	assert.Equal(t, "platforms", platforms.Name, "fields without a name should be named by their key")
+	area, _ := fields.Definition("product_area")
+	assert.Equal(t, []string{"Billing", "API", "Mobile app"}, area.Options, "options should be trimmed")
+	_, ok = fields.Definition("missing")
+	assert.False(t, ok)
+
+	table := []struct {
+		name       string
+		definition domain.CustomFieldDefinition
+	}{
+		{name: "BadKey", definition: domain.CustomFieldDefinition{Key: "Product Area", Type: domain.CustomFieldText}},
+		{name: "DuplicateKey", definition: domain.CustomFieldDefinition{Key: "seats", Type: domain.CustomFieldText}},
+		{name: "UnknownType", definition: domain.CustomFieldDefinition{Key: "colour", Type: "colour"}},
+		{name: "TextWithOptions", definition: domain.CustomFieldDefinition{Key: "notes", Type: domain.CustomFieldText, Options: []string{"a"}}},
+		{name: "SelectWithoutOptions", definition: domain.CustomFieldDefinition{Key: "tier", Type: domain.CustomFieldSelect}},
+		{name: "DuplicateOption", definition: domain.CustomFieldDefinition{Key: "tier", Type: domain.CustomFieldSelect, Options: []string{"Gold", "gold"}}},
+	}
+	for _, tc := range table {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := domain.NewCustomFields([]domain.CustomFieldDefinition{{Key: "seats", Type: domain.CustomFieldNumber}, tc.definition})
+			assert.ErrorIs(t, err, domain.ErrInvalidCustomField)
+		})
+	}
+}
+
+func TestNormalizeCustomFields(t *testing.T) {
+	fields := testCustomFields(t)
+
+	table := []struct {
+		name   string
+		values map[string][]string
+		expect map[string][]string
+		err    error
+	}{
+		{
+			name:   "Select",
+			values: map[string][]string{"product_area": {"mobile APP"}},
+			expect: map[string][]string{"product_area": {"Mobile app"}},
+		},
+		{
+			name:   "MultiSelect",
+			values: map[string][]string{"platforms": {"android", "ios", "Android"}},
+			expect: map[string][]string{"platforms": {"Android", "iOS"}},
+		},
+		{
+			name:   "Number",
+			values: map[string][]string{"seats": {" 25.0 "}},
+			expect: map[string][]string{"seats": {"25"}},
+		},
+		{
+			name:   "Date",
+			values: map[string][]string{"renewal": {"2025-03-01"}},
+			expect: map[string][]string{"renewal": {"2025-03-01"}},
+		},
+		{
+			name:   "Clear",
+			values: map[string][]string{"account": {" "}, "platforms": nil},
+			expect: map[string][]string{"account": {}, "platforms": {}},
+		},
+		{name: "UnknownField", values: map[string][]string{"colour": {"red"}}, err: domain.ErrUnknownCustomField},
+		{name: "UnknownOption", values: map[string][]string{"product_area": {"Hardware"}}, err: domain.ErrInvalidFieldValue},
+		{name: "NotANumber", values: map[string][]string{"seats": {"lots"}}, err: domain.ErrInvalidFieldValue},
+		{name: "NotADate", values: map[string][]string{"renewal": {"01/03/2025"}}, err: domain.ErrInvalidFieldValue},
+		{name: "SeveralValues", values: map[string][]string{"account": {"Acme", "Initech"}}, err: domain.ErrInvalidFieldValue},
+	}
+	for _, tc := range table {
+		t.Run(tc.name, func(t *testing.T) {
+			normalized, err := fields.Normalize(tc.values)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, normalized)
+		})
+	}
+}
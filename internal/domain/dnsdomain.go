@@ -2,27 +2,201 @@ package domain
 
 import (
 	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"net"
+	"strings"
+	"time"
 )
 
+var (
+	ErrInvalidDKIMKey    = errors.New("invalid dkim private key")
+	ErrDomainNotVerified = errors.New("domain failed verification")
+	ErrDomainVerified    = errors.New("domain already verified")
+	ErrDomainExists      = errors.New("domain already exists")
+	ErrInvalidDomainName = errors.New("invalid domain name")
+)
+
+// dkimKeyBits is the size of generated DKIM keys. RSA is used as not every receiver can verify Ed25519 signatures yet.
+const dkimKeyBits = 2048
+
+const (
+	// SPFRecord lets the domain's MX hosts send its mail. Admins relaying through another provider should add its include.
+	SPFRecord = "v=spf1 mx ~all"
+	// DMARCRecord asks receivers to quarantine mail that fails both SPF and DKIM alignment
+	DMARCRecord = "v=DMARC1; p=quarantine; adkim=r; aspf=r"
+)
+
+// VerificationRecordPrefix starts the TXT record proving a domain's owner wants us to handle its mail.
+const VerificationRecordPrefix = "ticket-verification="
+
 type DNSDomain struct {
 	ID   uint64
 	Name string
+	// DKIM is the key outbound mail from the domain is signed with, nil until one is generated
+	DKIM *DKIMKey
+	// VerificationToken is published in a TXT record to verify the domain
+	VerificationToken string
+	// VerifiedAt is when the domain passed verification, nil while it's pending. Only verified domains receive mail
+	VerifiedAt *time.Time
+	// DeletedAt is when the domain was deleted. Deleted domains are kept for history but never returned by the repository
+	DeletedAt *time.Time
+}
+
+// ValidateDomainName checks the name is a fully qualified hostname we could receive mail for, without a trailing dot.
+func ValidateDomainName(name string) error {
+	labels := strings.Split(name, ".")
+	if len(name) > 253 || len(labels) < 2 {
+		return fmt.Errorf("%w: %q", ErrInvalidDomainName, name)
+	}
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return fmt.Errorf("%w: %q", ErrInvalidDomainName, name)
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return fmt.Errorf("%w: %q", ErrInvalidDomainName, name)
+			}
+		}
+	}
+	return nil
+}
+
+// IsVerified checks whether the domain passed verification, so we're authoritative for it.
+func (d *DNSDomain) IsVerified() bool {
+	return d.VerifiedAt != nil
+}
+
+// VerificationRecord returns the TXT record to publish at the domain to verify it.
+func (d *DNSDomain) VerificationRecord() DNSRecord {
+	return DNSRecord{Type: "TXT", Name: d.Name, Value: VerificationRecordPrefix + d.VerificationToken}
+}
+
+// NewVerificationToken generates a random token for a domain's verification record.
+func NewVerificationToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// DKIMKey signs outbound mail for a domain. Receivers find the public key at <Selector>._domainkey.<domain>.
+type DKIMKey struct {
+	Selector string
+	// PrivateKey is a PEM encoded PKCS #8 key
+	PrivateKey string
+	CreatedAt  time.Time
+}
+
+// NewDKIMKey generates a key with a selector unique to its creation time, so a replaced key's record can stay published until mail signed with it has been delivered.
+func NewDKIMKey(now time.Time) (DKIMKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, dkimKeyBits)
+	if err != nil {
+		return DKIMKey{}, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return DKIMKey{}, err
+	}
+
+	return DKIMKey{
+		Selector:   fmt.Sprintf("ticket%d", now.Unix()),
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		CreatedAt:  now,
+	}, nil
 }
 
+// Signer parses the private key.
+func (k DKIMKey) Signer() (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(k.PrivateKey))
+	if block == nil {
+		return nil, ErrInvalidDKIMKey
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDKIMKey, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, ErrInvalidDKIMKey
+	}
+
+	return signer, nil
+}
+
+// Record returns the TXT record publishing the public key.
+func (k DKIMKey) Record() (string, error) {
+	signer, err := k.Signer()
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return "", err
+	}
+
+	keyType := "rsa"
+	if _, ok := signer.Public().(*rsa.PublicKey); !ok {
+		keyType = "ed25519"
+	}
+	return fmt.Sprintf("v=DKIM1; k=%s; p=%s", keyType, base64.StdEncoding.EncodeToString(der)), nil
+}
+
+// DNSRecord is a record an admin must publish for mail from a domain to be trusted.
+type DNSRecord struct {
+	Type  string
+	Name  string
+	Value string
+}
+
+// DNSDomainRepository stores domains. Deleted domains are treated as if they don't exist, every method returning ErrNotFound for them.
 type DNSDomainRepository interface {
 	GetDomains(context.Context) ([]DNSDomain, error)
+	// GetDomain returns ErrNotFound if there is no domain with the ID
+	GetDomain(ctx context.Context, ID uint64) (DNSDomain, error)
+	// GetDomainByName matches the name case-insensitively, returning ErrNotFound if there is no such domain
+	GetDomainByName(ctx context.Context, name string) (DNSDomain, error)
 	CreateDomain(ctx context.Context, domain DNSDomain) (DNSDomain, error)
+	// RenameDomain renames the domain and moves its live aliases to the new name, leaving it pending verification
+	RenameDomain(ctx context.Context, ID uint64, name string) (DNSDomain, error)
+	// DeleteDomain soft deletes the domain along with its live aliases
+	DeleteDomain(ctx context.Context, ID uint64) (DNSDomain, error)
+	SetDKIMKey(ctx context.Context, ID uint64, key DKIMKey) (DNSDomain, error)
+	// SetVerificationToken replaces the token the domain is verified with
+	SetVerificationToken(ctx context.Context, ID uint64, token string) (DNSDomain, error)
+	// SetVerified records when the domain passed verification, returning ErrNotFound if there is no domain with the ID
+	SetVerified(ctx context.Context, ID uint64, verifiedAt time.Time) (DNSDomain, error)
+}
+
+// DNSResolver looks up the records domains are verified with. net.DefaultResolver satisfies it.
+type DNSResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
 }
 
+// DNSDomainService manages the domains we handle mail for, publishing every change on the dnsdomains event bus so the mail server's list of authoritative domains stays fresh.
 type DNSDomainService struct {
 	repo        DNSDomainRepository
 	eventBus    *EventBus[DNSDomain]
-	domainCache *Cache[DNSDomain]
+	domainCache *Cache[Cached[DNSDomain]]
+	// CacheTTL is how long a domain is cached before it's reloaded, CacheTTL unless it's changed
+	CacheTTL time.Duration
+	// Resolver looks up verification records, net.DefaultResolver in production. Domains can't be verified without one
+	Resolver DNSResolver
+	// MXHosts are the hosts a domain's MX records must point to, one of them at least, for it to pass verification. Empty skips the MX check
+	MXHosts []string
 }
 
 func NewDNSDomainService(repo DNSDomainRepository, eventDriver EventBusDriver, cacheDriver CacheDriver) (*DNSDomainService, error) {
-	cache, err := NewCache[DNSDomain]("dnsdomains", cacheDriver)
+	cache, err := NewCache[Cached[DNSDomain]]("dnsdomains", cacheDriver)
 	if err != nil {
 		return nil, fmt.Errorf("error creating cache instance: %w", err)
 	}
@@ -30,7 +204,11 @@ func NewDNSDomainService(repo DNSDomainRepository, eventDriver EventBusDriver, c
 	if err != nil {
 		return nil, fmt.Errorf("error creating event bus instance: %w", err)
 	}
-	return &DNSDomainService{repo: repo, eventBus: evt, domainCache: cache}, nil
+	return &DNSDomainService{repo: repo, eventBus: evt, domainCache: cache, CacheTTL: CacheTTL}, nil
+}
+
+func (s *DNSDomainService) cache(domain DNSDomain) {
+	s.domainCache.Set(fmt.Sprint(domain.ID), Cached[DNSDomain]{Value: domain, LoadedAt: time.Now()})
 }
 
 func (s *DNSDomainService) GetDomains(ctx context.Context) ([]DNSDomain, error) {
@@ -39,17 +217,267 @@ func (s *DNSDomainService) GetDomains(ctx context.Context) ([]DNSDomain, error)
 		return nil, err
 	}
 	for _, domain := range domains {
-		s.domainCache.Set(fmt.Sprint(domain.ID), domain)
+		s.cache(domain)
 	}
 	return domains, nil
 }
 
+// GetDomain returns a domain, reloading it once it's been cached for longer than CacheTTL.
+func (s *DNSDomainService) GetDomain(ctx context.Context, ID uint64) (DNSDomain, error) {
+	if cached, err := s.domainCache.Get(fmt.Sprint(ID)); err == nil && cached.Fresh(s.CacheTTL) {
+		return cached.Value, nil
+	}
+
+	domain, err := s.repo.GetDomain(ctx, ID)
+	if err != nil {
+		return DNSDomain{}, err
+	}
+	s.cache(domain)
+
+	return domain, nil
+}
+
+func (s *DNSDomainService) GetDomainByName(ctx context.Context, name string) (DNSDomain, error) {
+	return s.repo.GetDomainByName(ctx, strings.ToLower(name))
+}
+
+// CreateDomain adds a domain pending verification. We aren't authoritative for it until VerifyDomain passes.
+//
+// ErrDomainExists is returned if there's already a domain with the name, regardless of case.
 func (s *DNSDomainService) CreateDomain(ctx context.Context, name string) (DNSDomain, error) {
-	domain, err := s.repo.CreateDomain(ctx, DNSDomain{Name: name})
+	name = strings.ToLower(name)
+	if err := s.checkNameAvailable(ctx, name); err != nil {
+		return DNSDomain{}, err
+	}
+	token, err := NewVerificationToken()
+	if err != nil {
+		return DNSDomain{}, err
+	}
+	domain, err := s.repo.CreateDomain(ctx, DNSDomain{Name: name, VerificationToken: token})
+	if err != nil {
+		return DNSDomain{}, err
+	}
+
+	return s.publish(domain, CreateEvent)
+}
+
+// RenameDomain renames the domain, moving its aliases along with it. We don't know the new name is theirs,
+// so the domain stops receiving mail until it passes verification again, with the same token.
+func (s *DNSDomainService) RenameDomain(ctx context.Context, ID uint64, name string) (DNSDomain, error) {
+	domain, err := s.GetDomain(ctx, ID)
+	if err != nil {
+		return DNSDomain{}, err
+	}
+	name = strings.ToLower(name)
+	if name == domain.Name {
+		return domain, nil
+	}
+	if err := s.checkNameAvailable(ctx, name); err != nil {
+		return DNSDomain{}, err
+	}
+
+	domain, err = s.repo.RenameDomain(ctx, ID, name)
+	if err != nil {
+		return DNSDomain{}, err
+	}
+
+	return s.publish(domain, UpdateEvent)
+}
+
+// DeleteDomain deletes the domain and deactivates its aliases, so its mail is refused from then on. Its tickets and emails are kept.
+func (s *DNSDomainService) DeleteDomain(ctx context.Context, ID uint64) (DNSDomain, error) {
+	domain, err := s.repo.DeleteDomain(ctx, ID)
+	if err != nil {
+		return DNSDomain{}, err
+	}
+
+	s.domainCache.Forget(fmt.Sprint(domain.ID))
+	if err := s.eventBus.Publish(fmt.Sprint(domain.ID), DeleteEvent, domain); err != nil {
+		return DNSDomain{}, err
+	}
+	return domain, nil
+}
+
+func (s *DNSDomainService) checkNameAvailable(ctx context.Context, name string) error {
+	if err := ValidateDomainName(name); err != nil {
+		return err
+	}
+	_, err := s.repo.GetDomainByName(ctx, name)
+	if err == nil {
+		return fmt.Errorf("%w: %s", ErrDomainExists, name)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// RegenerateVerificationToken replaces the token of a domain pending verification, in case the old one leaked.
+// Verified domains keep theirs, returning ErrDomainVerified, as their ownership has already been proven.
+func (s *DNSDomainService) RegenerateVerificationToken(ctx context.Context, ID uint64) (DNSDomain, error) {
+	domain, err := s.GetDomain(ctx, ID)
+	if err != nil {
+		return DNSDomain{}, err
+	}
+	if domain.IsVerified() {
+		return DNSDomain{}, ErrDomainVerified
+	}
+	token, err := NewVerificationToken()
+	if err != nil {
+		return DNSDomain{}, err
+	}
+
+	domain, err = s.repo.SetVerificationToken(ctx, ID, token)
 	if err != nil {
 		return DNSDomain{}, err
 	}
-	s.domainCache.Set(fmt.Sprint(domain.ID), domain)
 
+	return s.publish(domain, UpdateEvent)
+}
+
+// VerifyDomain looks up the domain's verification record and, if MXHosts is set, its MX records, marking it verified if they're published.
+//
+// An error wrapping ErrDomainNotVerified says which record is missing. Verifying a verified domain checks it again, leaving it verified either way.
+func (s *DNSDomainService) VerifyDomain(ctx context.Context, ID uint64) (DNSDomain, error) {
+	domain, err := s.GetDomain(ctx, ID)
+	if err != nil {
+		return DNSDomain{}, err
+	}
+	if s.Resolver == nil {
+		return DNSDomain{}, fmt.Errorf("%w: no resolver configured", ErrDomainNotVerified)
+	}
+
+	if err := s.checkVerificationRecord(ctx, domain); err != nil {
+		return DNSDomain{}, err
+	}
+	if err := s.checkMX(ctx, domain); err != nil {
+		return DNSDomain{}, err
+	}
+	if domain.IsVerified() {
+		return domain, nil
+	}
+
+	domain, err = s.repo.SetVerified(ctx, ID, time.Now())
+	if err != nil {
+		return DNSDomain{}, err
+	}
+
+	return s.publish(domain, UpdateEvent)
+}
+
+// VerifyPendingDomains tries to verify every domain pending verification, so domains start receiving mail soon after their records are published.
+// Domains whose records aren't published yet are left pending. A domain failing to be verified doesn't stop the others being tried, the errors being joined.
+func (s *DNSDomainService) VerifyPendingDomains(ctx context.Context) error {
+	domains, err := s.repo.GetDomains(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, domain := range domains {
+		if domain.IsVerified() {
+			continue
+		}
+		if _, err := s.VerifyDomain(ctx, domain.ID); err != nil && !errors.Is(err, ErrDomainNotVerified) && !errors.Is(err, ErrNotFound) {
+			errs = append(errs, fmt.Errorf("verifying %s: %w", domain.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RunVerification verifies pending domains every interval until the context is cancelled.
+//
+// Failures are passed to onError and retried at the next interval, so a transient error doesn't stop verification.
+func (s *DNSDomainService) RunVerification(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.VerifyPendingDomains(ctx); err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *DNSDomainService) checkVerificationRecord(ctx context.Context, domain DNSDomain) error {
+	want := domain.VerificationRecord()
+	records, err := s.Resolver.LookupTXT(ctx, want.Name)
+	if err != nil {
+		return fmt.Errorf("%w: looking up TXT records: %w", ErrDomainNotVerified, err)
+	}
+	for _, record := range records {
+		if strings.TrimSpace(record) == want.Value {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: TXT record %q not found at %s", ErrDomainNotVerified, want.Value, want.Name)
+}
+
+func (s *DNSDomainService) checkMX(ctx context.Context, domain DNSDomain) error {
+	if len(s.MXHosts) == 0 {
+		return nil
+	}
+	records, err := s.Resolver.LookupMX(ctx, domain.Name)
+	if err != nil {
+		return fmt.Errorf("%w: looking up MX records: %w", ErrDomainNotVerified, err)
+	}
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Host, ".")
+		for _, mxHost := range s.MXHosts {
+			if strings.EqualFold(host, strings.TrimSuffix(mxHost, ".")) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: no MX record points to %s", ErrDomainNotVerified, strings.Join(s.MXHosts, " or "))
+}
+
+func (s *DNSDomainService) publish(domain DNSDomain, eventType EventType) (DNSDomain, error) {
+	s.cache(domain)
+	if err := s.eventBus.Publish(fmt.Sprint(domain.ID), eventType, domain); err != nil {
+		return DNSDomain{}, err
+	}
 	return domain, nil
 }
+
+// GenerateDKIMKey replaces the domain's DKIM key with a new one. Mail is signed with it as soon as it's stored, so its record should be published promptly.
+func (s *DNSDomainService) GenerateDKIMKey(ctx context.Context, ID uint64) (DNSDomain, error) {
+	key, err := NewDKIMKey(time.Now())
+	if err != nil {
+		return DNSDomain{}, err
+	}
+	domain, err := s.repo.SetDKIMKey(ctx, ID, key)
+	if err != nil {
+		return DNSDomain{}, err
+	}
+
+	return s.publish(domain, UpdateEvent)
+}
+
+// DNSRecords returns the verification, SPF, DMARC and, once a key has been generated, DKIM records to publish for the domain.
+func (s *DNSDomainService) DNSRecords(ctx context.Context, ID uint64) ([]DNSRecord, error) {
+	domain, err := s.GetDomain(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []DNSRecord{
+		domain.VerificationRecord(),
+		{Type: "TXT", Name: domain.Name, Value: SPFRecord},
+		{Type: "TXT", Name: "_dmarc." + domain.Name, Value: DMARCRecord},
+	}
+	if domain.DKIM != nil {
+		value, err := domain.DKIM.Record()
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, DNSRecord{Type: "TXT", Name: domain.DKIM.Selector + "._domainkey." + domain.Name, Value: value})
+	}
+
+	return records, nil
+}
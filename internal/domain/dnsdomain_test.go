@@ -2,16 +2,24 @@ package domain_test
 
 import (
 	"context"
+	"crypto/rsa"
+	"errors"
 	"fmt"
+	"net"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/nil-nil/ticket/internal/domain"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDNSDomain(t *testing.T) {
 	repo := &mockDNSDomainRepository{domains: make(map[uint64]domain.DNSDomain, 512)}
-	svc, err := domain.NewDNSDomainService(repo, &mockEventBusDriver{}, mockCache)
+	eventDrv := &mockEventBusDriver{}
+	svc, err := domain.NewDNSDomainService(repo, eventDrv, mockCache)
 	assert.NoError(t, err, "domain.NewDNSDomainService() should not error")
 
 	t.Run("TestGetDomains", func(t *testing.T) {
@@ -31,21 +39,299 @@ func TestDNSDomain(t *testing.T) {
 		domains, err := svc.GetDomains(context.Background())
 		assert.NoError(t, err, "DNSDomainService.GetDomains() should not error")
 		assert.Equal(t, 2, len(domains), "Expected 2 domains")
-		assert.Equal(t, d1, mockCache.cache["dnsdomains.1"], "Expected domain 1 to be cached")
-		assert.Equal(t, d2, mockCache.cache["dnsdomains.2"], "Expected domain 2 to be cached")
+		assert.Equal(t, d1, cachedDomain(1), "Expected domain 1 to be cached")
+		assert.Equal(t, d2, cachedDomain(2), "Expected domain 2 to be cached")
 		assert.Equal(t, []domain.DNSDomain{d1, d2}, domains, "Expected got domains to match repo")
 	})
 
 	t.Run("TestCreateDomain", func(t *testing.T) {
-		d, err := svc.CreateDomain(context.Background(), "foo.com")
+		d, err := svc.CreateDomain(context.Background(), "Foo.com")
 		assert.NoError(t, err, "DNSDomainService.CreateDOmain() should not error")
-		assert.Equal(t, "foo.com", d.Name, "Created domain name should match")
-		assert.Equal(t, d, mockCache.cache[fmt.Sprintf("dnsdomains.%d", d.ID)], "Expected domain to be cached")
+		assert.Equal(t, "foo.com", d.Name, "Created domain name should be lower case")
+		assert.Len(t, d.VerificationToken, 32, "Expected a verification token")
+		assert.False(t, d.IsVerified(), "New domains shouldn't be verified")
+		assert.Equal(t, d, cachedDomain(d.ID), "Expected domain to be cached")
+		assert.Equal(t, fmt.Sprintf("dnsdomains:%d:create", d.ID), *eventDrv.EventSubject, "Expected the new domain to be published")
+		assert.Equal(t, d, eventDrv.EventData)
+
+		_, err = svc.CreateDomain(context.Background(), "FOO.com")
+		assert.ErrorIs(t, err, domain.ErrDomainExists, "Expected an existing name to be refused regardless of case")
+		_, err = svc.CreateDomain(context.Background(), "not a domain")
+		assert.ErrorIs(t, err, domain.ErrInvalidDomainName, "Expected an invalid name to be refused")
+	})
+
+	t.Run("TestGetDomainReloadsAfterTTL", func(t *testing.T) {
+		d, err := svc.CreateDomain(context.Background(), "ttl.com")
+		require.NoError(t, err)
+		// Another process verifies the domain, so no event reaches this one
+		verified, err := repo.SetVerified(context.Background(), d.ID, time.Now())
+		require.NoError(t, err)
+
+		got, err := svc.GetDomain(context.Background(), d.ID)
+		assert.NoError(t, err)
+		assert.False(t, got.IsVerified(), "Expected the cached domain while it's fresh")
+
+		svc.CacheTTL = 0
+		defer func() { svc.CacheTTL = domain.CacheTTL }()
+		got, err = svc.GetDomain(context.Background(), d.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, verified, got, "Expected the domain to be reloaded once its cache expired")
+	})
+
+	t.Run("TestRenameDomain", func(t *testing.T) {
+		d, err := svc.CreateDomain(context.Background(), "before.com")
+		require.NoError(t, err)
+		verifiedAt := time.Now()
+		d, err = repo.SetVerified(context.Background(), d.ID, verifiedAt)
+		require.NoError(t, err)
+		mockCache.Forget(fmt.Sprintf("dnsdomains.%d", d.ID))
+
+		eventDrv.Reset()
+		unchanged, err := svc.RenameDomain(context.Background(), d.ID, "BEFORE.com")
+		assert.NoError(t, err, "Expected renaming to the same name to succeed")
+		assert.True(t, unchanged.IsVerified(), "Expected the domain to stay verified when its name doesn't change")
+		assert.Nil(t, eventDrv.EventSubject, "Expected nothing to be published when nothing changed")
+
+		renamed, err := svc.RenameDomain(context.Background(), d.ID, "After.com")
+		assert.NoError(t, err, "DNSDomainService.RenameDomain() should not error")
+		assert.Equal(t, "after.com", renamed.Name, "Expected the new name in lower case")
+		assert.False(t, renamed.IsVerified(), "Expected the renamed domain to need verifying again")
+		assert.Equal(t, d.VerificationToken, renamed.VerificationToken, "Expected the token to be kept")
+		assert.Equal(t, renamed, cachedDomain(d.ID), "Expected the renamed domain to be cached")
+		require.NotNil(t, eventDrv.EventSubject, "Expected the renamed domain to be published")
+		assert.Equal(t, fmt.Sprintf("dnsdomains:%d:update", d.ID), *eventDrv.EventSubject)
+
+		_, err = svc.RenameDomain(context.Background(), d.ID, "foo.com")
+		assert.ErrorIs(t, err, domain.ErrDomainExists, "Expected another domain's name to be refused")
+		_, err = svc.RenameDomain(context.Background(), d.ID, "after..com")
+		assert.ErrorIs(t, err, domain.ErrInvalidDomainName, "Expected an invalid name to be refused")
+		_, err = svc.RenameDomain(context.Background(), 1000, "missing.com")
+		assert.ErrorIs(t, err, domain.ErrNotFound, "Expected a missing domain to be not found")
+	})
+
+	t.Run("TestDeleteDomain", func(t *testing.T) {
+		d, err := svc.CreateDomain(context.Background(), "delete.com")
+		require.NoError(t, err)
+		_, err = svc.GetDomain(context.Background(), d.ID)
+		require.NoError(t, err)
+
+		eventDrv.Reset()
+		deleted, err := svc.DeleteDomain(context.Background(), d.ID)
+		assert.NoError(t, err, "DNSDomainService.DeleteDomain() should not error")
+		assert.Equal(t, d.ID, deleted.ID)
+		require.NotNil(t, eventDrv.EventSubject, "Expected the deleted domain to be published")
+		assert.Equal(t, fmt.Sprintf("dnsdomains:%d:delete", d.ID), *eventDrv.EventSubject)
+		assert.NotContains(t, mockCache.cache, fmt.Sprintf("dnsdomains.%d", d.ID), "Expected the deleted domain to leave the cache")
+		_, err = svc.GetDomain(context.Background(), d.ID)
+		assert.ErrorIs(t, err, domain.ErrNotFound, "Expected the deleted domain to be gone")
+
+		_, err = svc.DeleteDomain(context.Background(), d.ID)
+		assert.ErrorIs(t, err, domain.ErrNotFound, "Expected a deleted domain to be not found")
+
+		_, err = svc.CreateDomain(context.Background(), "delete.com")
+		assert.NoError(t, err, "Expected a deleted domain's name to be available again")
 	})
+
+	t.Run("TestRegenerateVerificationToken", func(t *testing.T) {
+		d, err := svc.CreateDomain(context.Background(), "token.com")
+		require.NoError(t, err)
+
+		eventDrv.Reset()
+		regenerated, err := svc.RegenerateVerificationToken(context.Background(), d.ID)
+		assert.NoError(t, err, "DNSDomainService.RegenerateVerificationToken() should not error")
+		assert.Len(t, regenerated.VerificationToken, 32, "Expected a verification token")
+		assert.NotEqual(t, d.VerificationToken, regenerated.VerificationToken, "Expected a new token")
+		assert.Equal(t, regenerated, cachedDomain(d.ID), "Expected the new token to be cached")
+		require.NotNil(t, eventDrv.EventSubject, "Expected the new token to be published")
+		assert.Equal(t, fmt.Sprintf("dnsdomains:%d:update", d.ID), *eventDrv.EventSubject)
+
+		_, err = repo.SetVerified(context.Background(), d.ID, time.Now())
+		require.NoError(t, err)
+		mockCache.Forget(fmt.Sprintf("dnsdomains.%d", d.ID))
+		_, err = svc.RegenerateVerificationToken(context.Background(), d.ID)
+		assert.ErrorIs(t, err, domain.ErrDomainVerified, "Expected a verified domain to keep its token")
+
+		_, err = svc.RegenerateVerificationToken(context.Background(), 1000)
+		assert.ErrorIs(t, err, domain.ErrNotFound, "Expected a missing domain to be not found")
+	})
+
+	t.Run("TestVerifyPendingDomains", func(t *testing.T) {
+		published, err := svc.CreateDomain(context.Background(), "published.com")
+		require.NoError(t, err)
+		pending, err := svc.CreateDomain(context.Background(), "pending.com")
+		require.NoError(t, err)
+		svc.Resolver = &mockDNSResolver{txt: map[string][]string{"published.com": {published.VerificationRecord().Value}}}
+		t.Cleanup(func() { svc.Resolver = nil })
+
+		assert.NoError(t, svc.VerifyPendingDomains(context.Background()), "Expected unpublished records not to be an error")
+
+		published, err = svc.GetDomain(context.Background(), published.ID)
+		assert.NoError(t, err)
+		assert.True(t, published.IsVerified(), "Expected the domain with a published record to be verified")
+		pending, err = svc.GetDomain(context.Background(), pending.ID)
+		assert.NoError(t, err)
+		assert.False(t, pending.IsVerified(), "Expected the domain without a record to stay pending")
+	})
+
+	t.Run("TestVerifyDomain", func(t *testing.T) {
+		d, err := svc.CreateDomain(context.Background(), "verify.com")
+		require.NoError(t, err)
+		resolver := &mockDNSResolver{
+			txt: map[string][]string{"verify.com": {domain.SPFRecord}},
+			mx:  map[string][]*net.MX{"verify.com": {{Host: "mx.other.net.", Pref: 10}}},
+		}
+		svc.MXHosts = []string{"mx.ticket.example"}
+		t.Cleanup(func() { svc.Resolver, svc.MXHosts = nil, nil })
+
+		_, err = svc.VerifyDomain(context.Background(), d.ID)
+		assert.ErrorIs(t, err, domain.ErrDomainNotVerified, "Expected domains not to be verified without a resolver")
+
+		svc.Resolver = resolver
+		_, err = svc.VerifyDomain(context.Background(), d.ID)
+		assert.ErrorIs(t, err, domain.ErrDomainNotVerified, "Expected the missing TXT record to fail verification")
+		assert.ErrorContains(t, err, domain.VerificationRecordPrefix+d.VerificationToken, "Expected the error to name the missing record")
+
+		resolver.txt["verify.com"] = append(resolver.txt["verify.com"], d.VerificationRecord().Value)
+		_, err = svc.VerifyDomain(context.Background(), d.ID)
+		assert.ErrorIs(t, err, domain.ErrDomainNotVerified, "Expected MX records pointing elsewhere to fail verification")
+		assert.ErrorContains(t, err, "mx.ticket.example")
+		unverified, err := svc.GetDomain(context.Background(), d.ID)
+		assert.NoError(t, err)
+		assert.False(t, unverified.IsVerified(), "Expected the domain to stay unverified")
+
+		resolver.mx["verify.com"] = append(resolver.mx["verify.com"], &net.MX{Host: "MX.ticket.example.", Pref: 20})
+		eventDrv.Reset()
+		verified, err := svc.VerifyDomain(context.Background(), d.ID)
+		assert.NoError(t, err, "Expected the domain to pass verification")
+		assert.True(t, verified.IsVerified(), "Expected the domain to be verified")
+		assert.Equal(t, verified, cachedDomain(d.ID), "Expected the verified domain to be cached")
+		require.NotNil(t, eventDrv.EventSubject, "Expected the verified domain to be published")
+		assert.Equal(t, fmt.Sprintf("dnsdomains:%d:update", d.ID), *eventDrv.EventSubject)
+
+		eventDrv.Reset()
+		again, err := svc.VerifyDomain(context.Background(), d.ID)
+		assert.NoError(t, err, "Expected a verified domain to verify again")
+		assert.Equal(t, verified.VerifiedAt, again.VerifiedAt, "Expected the verification time to be kept")
+		assert.Nil(t, eventDrv.EventSubject, "Expected nothing to be published when nothing changed")
+
+		svc.MXHosts = nil
+		resolver.mx = nil
+		other, err := svc.CreateDomain(context.Background(), "nomx.com")
+		require.NoError(t, err)
+		resolver.txt["nomx.com"] = []string{other.VerificationRecord().Value}
+		other, err = svc.VerifyDomain(context.Background(), other.ID)
+		assert.NoError(t, err, "Expected the MX check to be skipped without MXHosts")
+		assert.True(t, other.IsVerified())
+
+		_, err = svc.VerifyDomain(context.Background(), 1000)
+		assert.ErrorIs(t, err, domain.ErrNotFound, "Expected a missing domain to be not found")
+	})
+
+	t.Run("TestGenerateDKIMKey", func(t *testing.T) {
+		d, err := svc.CreateDomain(context.Background(), "dkim.com")
+		require.NoError(t, err)
+
+		records, err := svc.DNSRecords(context.Background(), d.ID)
+		assert.NoError(t, err, "DNSDomainService.DNSRecords() should not error without a key")
+		assert.Equal(t, []domain.DNSRecord{
+			{Type: "TXT", Name: "dkim.com", Value: domain.VerificationRecordPrefix + d.VerificationToken},
+			{Type: "TXT", Name: "dkim.com", Value: domain.SPFRecord},
+			{Type: "TXT", Name: "_dmarc.dkim.com", Value: domain.DMARCRecord},
+		}, records, "Expected only verification, SPF and DMARC records before a key is generated")
+
+		d, err = svc.GenerateDKIMKey(context.Background(), d.ID)
+		assert.NoError(t, err, "DNSDomainService.GenerateDKIMKey() should not error")
+		assert.Equal(t, fmt.Sprintf("dnsdomains:%d:update", d.ID), *eventDrv.EventSubject, "Expected the new key to be published")
+		require.NotNil(t, d.DKIM, "Expected the domain to have a key")
+		assert.Equal(t, d, cachedDomain(d.ID), "Expected the cached domain to have the key")
+		signer, err := d.DKIM.Signer()
+		assert.NoError(t, err, "Expected the private key to parse")
+		assert.IsType(t, &rsa.PrivateKey{}, signer)
+
+		records, err = svc.DNSRecords(context.Background(), d.ID)
+		assert.NoError(t, err)
+		require.Len(t, records, 4)
+		assert.Equal(t, d.DKIM.Selector+"._domainkey.dkim.com", records[3].Name)
+		assert.Regexp(t, `^v=DKIM1; k=rsa; p=[A-Za-z0-9+/]+=*$`, records[3].Value)
+
+		_, err = svc.GenerateDKIMKey(context.Background(), 1000)
+		assert.ErrorIs(t, err, domain.ErrNotFound, "Expected a missing domain to be not found")
+		_, err = svc.DNSRecords(context.Background(), 1000)
+		assert.ErrorIs(t, err, domain.ErrNotFound, "Expected a missing domain to be not found")
+	})
+}
+
+func TestRunVerification(t *testing.T) {
+	repo := &mockDNSDomainRepository{domains: map[uint64]domain.DNSDomain{}, getErr: errors.New("connection reset")}
+	svc, err := domain.NewDNSDomainService(repo, &mockEventBusDriver{}, mockCache)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	stopped := make(chan struct{})
+	go func() {
+		svc.RunVerification(ctx, time.Millisecond, func(err error) {
+			select {
+			case errs <- err:
+			case <-ctx.Done():
+			}
+		})
+		close(stopped)
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case err := <-errs:
+			assert.ErrorContains(t, err, "connection reset")
+		case <-time.After(time.Second):
+			t.Fatal("verification should keep running after an error")
+		}
+	}
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("RunVerification should return once the context is cancelled")
+	}
+}
+
+func TestValidateDomainName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{name: "example.com", valid: true},
+		{name: "mail.Example-1.co.uk", valid: true},
+		{name: "xn--bcher-kva.example", valid: true},
+		{name: "", valid: false},
+		{name: "localhost", valid: false},
+		{name: "example.com.", valid: false},
+		{name: "-example.com", valid: false},
+		{name: "exa mple.com", valid: false},
+		{name: "user@example.com", valid: false},
+		{name: strings.Repeat("a", 64) + ".com", valid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := domain.ValidateDomainName(tt.name)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, domain.ErrInvalidDomainName)
+			}
+		})
+	}
+}
+
+func TestDKIMKeySigner(t *testing.T) {
+	_, err := domain.DKIMKey{PrivateKey: "not a key"}.Signer()
+	assert.ErrorIs(t, err, domain.ErrInvalidDKIMKey)
 }
 
 type mockDNSDomainRepository struct {
 	domains map[uint64]domain.DNSDomain
+	// getErr fails listing the domains
+	getErr error
 }
 
 func (m *mockDNSDomainRepository) CreateDomain(ctx context.Context, d domain.DNSDomain) (domain.DNSDomain, error) {
@@ -55,11 +341,124 @@ func (m *mockDNSDomainRepository) CreateDomain(ctx context.Context, d domain.DNS
 	return d, nil
 }
 
+func (m *mockDNSDomainRepository) GetDomain(ctx context.Context, ID uint64) (domain.DNSDomain, error) {
+	d, ok := m.domains[ID]
+	if !ok {
+		return domain.DNSDomain{}, domain.ErrNotFound
+	}
+
+	return d, nil
+}
+
+func (m *mockDNSDomainRepository) GetDomainByName(ctx context.Context, name string) (domain.DNSDomain, error) {
+	for _, d := range m.domains {
+		if strings.EqualFold(d.Name, name) {
+			return d, nil
+		}
+	}
+
+	return domain.DNSDomain{}, domain.ErrNotFound
+}
+
+func (m *mockDNSDomainRepository) SetDKIMKey(ctx context.Context, ID uint64, key domain.DKIMKey) (domain.DNSDomain, error) {
+	d, ok := m.domains[ID]
+	if !ok {
+		return domain.DNSDomain{}, domain.ErrNotFound
+	}
+	d.DKIM = &key
+	m.domains[ID] = d
+
+	return d, nil
+}
+
+func (m *mockDNSDomainRepository) RenameDomain(ctx context.Context, ID uint64, name string) (domain.DNSDomain, error) {
+	d, ok := m.domains[ID]
+	if !ok {
+		return domain.DNSDomain{}, domain.ErrNotFound
+	}
+	d.Name = name
+	d.VerifiedAt = nil
+	m.domains[ID] = d
+
+	return d, nil
+}
+
+// DeleteDomain forgets the domain, as the repository never returns deleted ones.
+func (m *mockDNSDomainRepository) DeleteDomain(ctx context.Context, ID uint64) (domain.DNSDomain, error) {
+	d, ok := m.domains[ID]
+	if !ok {
+		return domain.DNSDomain{}, domain.ErrNotFound
+	}
+	now := time.Now()
+	d.DeletedAt = &now
+	delete(m.domains, ID)
+
+	return d, nil
+}
+
+func (m *mockDNSDomainRepository) SetVerificationToken(ctx context.Context, ID uint64, token string) (domain.DNSDomain, error) {
+	d, ok := m.domains[ID]
+	if !ok {
+		return domain.DNSDomain{}, domain.ErrNotFound
+	}
+	d.VerificationToken = token
+	m.domains[ID] = d
+
+	return d, nil
+}
+
+func (m *mockDNSDomainRepository) SetVerified(ctx context.Context, ID uint64, verifiedAt time.Time) (domain.DNSDomain, error) {
+	d, ok := m.domains[ID]
+	if !ok {
+		return domain.DNSDomain{}, domain.ErrNotFound
+	}
+	d.VerifiedAt = &verifiedAt
+	m.domains[ID] = d
+
+	return d, nil
+}
+
+// GetDomains returns the domains ordered by ID, like the SQL repository.
 func (m *mockDNSDomainRepository) GetDomains(ctx context.Context) ([]domain.DNSDomain, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
 	domains := make([]domain.DNSDomain, 0, len(m.domains))
 	for _, v := range m.domains {
 		domains = append(domains, v)
 	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].ID < domains[j].ID })
 
 	return domains, nil
 }
+
+// mockDNSResolver answers with fixed records, failing lookups of names it has none for.
+type mockDNSResolver struct {
+	txt map[string][]string
+	mx  map[string][]*net.MX
+}
+
+func (m *mockDNSResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	records, ok := m.txt[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+func (m *mockDNSResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	records, ok := m.mx[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+// cachedDomain returns the domain cached by ID, or nil if it isn't.
+func cachedDomain(ID uint64) any {
+	cached, ok := mockCache.cache[fmt.Sprintf("dnsdomains.%d", ID)].(domain.Cached[domain.DNSDomain])
+	if !ok {
+		return nil
+	}
+	return cached.Value
+}
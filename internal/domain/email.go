@@ -1,45 +1,122 @@
 package domain
 
 import (
+	"bytes"
 	"context"
 	"net/mail"
+	"net/textproto"
 	"strings"
 	"time"
 )
 
 type Email struct {
 	ID         uint64
+	MessageID  string
 	Subject    string
 	Sender     string
 	Recipients []string
 	Date       time.Time
 	Message    mail.Message
+	// Raw is the message exactly as it was received or sent. It's stored instead of re-encoding Message when set
+	Raw      []byte
+	TicketID *uint64
+	// Outbound is set for email sent by us rather than received
+	Outbound bool
+	// Authentication is the result of SPF, DKIM and DMARC checks, nil if inbound email wasn't checked
+	Authentication *EmailAuthentication
+	// Spam is how the spam filters scored inbound email, nil if it wasn't scored
+	Spam *SpamReport
+	// Quarantine is why inbound email is held for review, nil unless it's in quarantine
+	Quarantine *Quarantine
+
+	// TextBody and HTMLBody are the decoded text/plain and text/html parts of the message
+	TextBody    string
+	HTMLBody    string
+	Attachments []Attachment
 }
 
 type EmailCreator interface {
 	CreateEmail(ctx context.Context, email Email) (Email, error)
 }
 
+// MailSender delivers outbound email. The message is a complete RFC 5322 message, sent to the envelope recipients in to.
+type MailSender interface {
+	Send(ctx context.Context, from string, to []string, message []byte) error
+}
+
+// EmailTicketRepository persists and queries the link between emails and the tickets they belong to.
+type EmailTicketRepository interface {
+	// LinkTicket records that an email belongs to a ticket
+	LinkTicket(ctx context.Context, emailID uint64, ticketID uint64) error
+
+	// FindTicketEmails returns every email linked to a ticket, oldest first
+	FindTicketEmails(ctx context.Context, ticketID uint64) ([]Email, error)
+}
+
 func CreateEmail(ctx context.Context, repo EmailCreator, msg mail.Message) (Email, error) {
+	e, err := NewEmail(msg)
+	if err != nil {
+		return Email{}, err
+	}
+	return repo.CreateEmail(ctx, e)
+}
+
+// NewEmail parses a message into an Email ready to be stored.
+func NewEmail(msg mail.Message) (Email, error) {
 	date, err := msg.Header.Date()
 	if err != nil {
 		date = time.Now()
 	}
 
-	subject := msg.Header.Get("Subject")
+	// The body can only be read once, so keep a copy for the repository to store
+	raw, body, err := readBody(msg.Body)
+	if err != nil {
+		return Email{}, err
+	}
+	msg.Body = body
+
+	var decoded mimeBody
+	if raw != nil {
+		decoded, err = decodeMIME(textproto.MIMEHeader(msg.Header), bytes.NewReader(raw))
+		if err != nil {
+			// Keep malformed messages rather than bouncing them, using the undecoded body as the text
+			decoded = mimeBody{text: string(raw)}
+		}
+	}
+
+	messageID := ParseMessageID(msg.Header.Get("Message-ID"))
+	subject := DecodeHeader(msg.Header.Get("Subject"))
 	sender := removeNames(msg.Header.Get("From"))
 	recipients := strings.Split(msg.Header.Get("To"), ",")
 	recipientEmails := make([]string, 0, len(recipients))
 	for _, recipient := range recipients {
 		recipientEmails = append(recipientEmails, removeNames(recipient))
 	}
-	return repo.CreateEmail(ctx, Email{Message: msg, Date: date, Subject: subject, Sender: sender, Recipients: recipientEmails})
+	return Email{
+		Message:     msg,
+		MessageID:   messageID,
+		Date:        date,
+		Subject:     subject,
+		Sender:      sender,
+		Recipients:  recipientEmails,
+		TextBody:    decoded.text,
+		HTMLBody:    decoded.html,
+		Attachments: decoded.attachments,
+	}, nil
 }
 
+// addressParser decodes RFC 2047 encoded display names in any supported charset
+var addressParser = &mail.AddressParser{WordDecoder: wordDecoder}
+
 func removeNames(address string) string {
-	parsedAddress, err := mail.ParseAddress(address)
+	parsedAddress, err := addressParser.Parse(address)
 	if err != nil || parsedAddress == nil {
 		return ""
 	}
 	return parsedAddress.Address
 }
+
+// ParseMessageID normalises a Message-ID style header value by removing whitespace and the enclosing angle brackets.
+func ParseMessageID(value string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(value), "<"), ">")
+}
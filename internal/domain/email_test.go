@@ -29,16 +29,18 @@ func TestCreateEmail(t *testing.T) {
 	t.Run("ValidEmail", func(t *testing.T) {
 		msg := mail.Message{
 			Header: mail.Header{
-				"Date":    {"Mon, 18 Sep 2023 17:58:07 +0000 (UTC)"},
-				"Subject": {"Test Message"},
-				"To":      {"Baz <baz@test.com>, foo@bar.com"},
-				"From":    {"Qux <qux@example.com>"},
+				"Date":       {"Mon, 18 Sep 2023 17:58:07 +0000 (UTC)"},
+				"Message-Id": {"<abc.123@example.com>"},
+				"Subject":    {"Test Message"},
+				"To":         {"Baz <baz@test.com>, foo@bar.com"},
+				"From":       {"Qux <qux@example.com>"},
 			},
 		}
 		email, err := domain.CreateEmail(context.Background(), repo, msg)
 		assert.NoError(t, err, "create valid email shouldn't error")
 		assert.Equal(t, msg, email.Message, "message should be the same")
 		assert.NotEqual(t, 0, email.ID, "ID should not be zero valued")
+		assert.Equal(t, "abc.123@example.com", email.MessageID, "message id should be parsed")
 		assert.Equal(t, "qux@example.com", email.Sender, "sender should be parsed")
 		assert.Equal(t, []string{"baz@test.com", "foo@bar.com"}, email.Recipients, "recipients should be parsed")
 		assert.True(t, email.Date.Equal(time.Date(2023, 9, 18, 17, 58, 07, 0, &time.Location{})), "Date should match header date")
@@ -46,6 +48,24 @@ func TestCreateEmail(t *testing.T) {
 	})
 }
 
+func TestParseMessageID(t *testing.T) {
+	table := []struct {
+		description string
+		value       string
+		expect      string
+	}{
+		{description: "angle brackets", value: "<abc@example.com>", expect: "abc@example.com"},
+		{description: "whitespace", value: "  <abc@example.com> ", expect: "abc@example.com"},
+		{description: "no brackets", value: "abc@example.com", expect: "abc@example.com"},
+		{description: "empty", value: "", expect: ""},
+	}
+	for _, tc := range table {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expect, domain.ParseMessageID(tc.value))
+		})
+	}
+}
+
 type mockCreateEmailRepository struct {
 	emails map[uint64]domain.Email
 }
@@ -13,6 +13,8 @@ const (
 	CreateEvent
 	UpdateEvent
 	DeleteEvent
+	// DeliveryFailedEvent is published on a ticket when mail sent from it can't be delivered
+	DeliveryFailedEvent
 )
 
 func (e EventType) String() string {
@@ -23,6 +25,8 @@ func (e EventType) String() string {
 		return "update"
 	case DeleteEvent:
 		return "delete"
+	case DeliveryFailedEvent:
+		return "deliveryfailed"
 	}
 	return "unknown"
 }
@@ -35,6 +39,8 @@ func ParseEventString(s string) EventType {
 		return UpdateEvent
 	case "delete":
 		return DeleteEvent
+	case "deliveryfailed":
+		return DeliveryFailedEvent
 	}
 	return UnknownEvent
 }
@@ -27,6 +27,11 @@ var eventStringTable = []struct {
 		eventString: "delete",
 		description: "DeleteEventString",
 	},
+	{
+		event:       domain.DeliveryFailedEvent,
+		eventString: "deliveryfailed",
+		description: "DeliveryFailedEventString",
+	},
 	{
 		event:       domain.UnknownEvent,
 		eventString: "unknown",
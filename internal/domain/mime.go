@@ -0,0 +1,175 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// maxMIMEDepth limits how deeply nested multipart messages are decoded
+const maxMIMEDepth = 10
+
+// Attachment is a file sent with an email. Content is only populated when the attachment is fetched on its own.
+type Attachment struct {
+	ID uint64
+	// EmailID is set on email attachments, and CommentID on ticket comment attachments
+	EmailID     uint64
+	CommentID   uint64
+	ContentType string
+	Filename    string
+	Size        int64
+	Content     []byte
+}
+
+// mimeBody holds the decoded parts of a MIME message
+type mimeBody struct {
+	text        string
+	html        string
+	attachments []Attachment
+}
+
+// wordDecoder decodes RFC 2047 encoded words in any charset known to the WHATWG encoding standard
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// DecodeHeader decodes RFC 2047 encoded words such as "=?ISO-8859-1?Q?Caf=E9?=" in a header value.
+//
+// The value is returned unchanged if it can't be decoded.
+func DecodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// decodeMIME walks a MIME entity, collecting the first text/plain and text/html parts as the bodies and everything else as attachments.
+func decodeMIME(header textproto.MIMEHeader, body io.Reader) (mimeBody, error) {
+	var decoded mimeBody
+	err := decoded.decodePart(header, body, 0)
+	return decoded, err
+}
+
+func (m *mimeBody) decodePart(header textproto.MIMEHeader, body io.Reader, depth int) error {
+	if depth > maxMIMEDepth {
+		return fmt.Errorf("mime nesting deeper than %d levels", maxMIMEDepth)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	disposition, dispositionParams, err := mime.ParseMediaType(header.Get("Content-Disposition"))
+	if err != nil {
+		disposition, dispositionParams = "", map[string]string{}
+	}
+
+	body = decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body)
+
+	if strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := m.decodePart(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	filename := dispositionParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	filename = DecodeHeader(filename)
+
+	isBody := disposition != "attachment" && filename == ""
+	switch {
+	case isBody && mediaType == "text/plain" && m.text == "":
+		m.text, err = decodeCharset(params["charset"], body)
+		return err
+	case isBody && mediaType == "text/html" && m.html == "":
+		m.html, err = decodeCharset(params["charset"], body)
+		return err
+	}
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	m.attachments = append(m.attachments, Attachment{
+		ContentType: mediaType,
+		Filename:    filename,
+		Size:        int64(len(content)),
+		Content:     content,
+	})
+
+	return nil
+}
+
+// decodeTransferEncoding wraps the body in a decoder for its Content-Transfer-Encoding. 7bit, 8bit and binary need no decoding.
+func decodeTransferEncoding(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	}
+	return body
+}
+
+// decodeCharset reads the body and converts it from the given charset to UTF-8.
+func decodeCharset(charset string, body io.Reader) (string, error) {
+	reader, err := charsetReader(charset, body)
+	if err != nil {
+		// Unknown charsets are passed through rather than losing the text
+		reader = body
+	}
+
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	return string(decoded), nil
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	charset = strings.ToLower(strings.TrimSpace(charset))
+	if charset == "" || charset == "utf-8" || charset == "us-ascii" {
+		return input, nil
+	}
+
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q: %w", charset, err)
+	}
+
+	return encoding.NewDecoder().Reader(input), nil
+}
+
+// readBody reads a message body so it can be decoded and still stored, returning a fresh reader over the bytes.
+func readBody(body io.Reader) ([]byte, io.Reader, error) {
+	if body == nil {
+		return nil, nil, nil
+	}
+
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return raw, bytes.NewReader(raw), nil
+}
@@ -0,0 +1,123 @@
+package domain_test
+
+import (
+	"context"
+	"io"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeHeader(t *testing.T) {
+	table := []struct {
+		description string
+		value       string
+		expect      string
+	}{
+		{description: "plain", value: "Hello", expect: "Hello"},
+		{description: "utf-8 base64", value: "=?UTF-8?B?SGVsbG8gd8O2cmxk?=", expect: "Hello wörld"},
+		{description: "latin-1 quoted printable", value: "=?ISO-8859-1?Q?Caf=E9?= menu", expect: "Café menu"},
+		{description: "windows-1252", value: "=?windows-1252?Q?=80100?=", expect: "€100"},
+		{description: "unknown charset", value: "=?x-unknown?Q?abc?=", expect: "=?x-unknown?Q?abc?="},
+	}
+	for _, tc := range table {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expect, domain.DecodeHeader(tc.value))
+		})
+	}
+}
+
+func TestCreateEmailMIME(t *testing.T) {
+	repo := &mockCreateEmailRepository{
+		emails: map[uint64]domain.Email{},
+	}
+
+	readMessage := func(t *testing.T, raw string) mail.Message {
+		msg, err := mail.ReadMessage(strings.NewReader(strings.ReplaceAll(raw, "\n", "\r\n")))
+		require.NoError(t, err)
+		return *msg
+	}
+
+	t.Run("SinglePartQuotedPrintableLatin1", func(t *testing.T) {
+		msg := readMessage(t, `Subject: =?ISO-8859-1?Q?R=E9sum=E9?=
+From: =?ISO-8859-1?Q?Andr=E9?= <andre@example.com>
+Content-Type: text/plain; charset=ISO-8859-1
+Content-Transfer-Encoding: quoted-printable
+
+Caf=E9 au lait
+`)
+		email, err := domain.CreateEmail(context.Background(), repo, msg)
+		assert.NoError(t, err)
+		assert.Equal(t, "Résumé", email.Subject, "subject should be decoded")
+		assert.Equal(t, "andre@example.com", email.Sender, "encoded sender names should still parse")
+		assert.Equal(t, "Café au lait\r\n", email.TextBody, "body should be decoded to UTF-8")
+		assert.Empty(t, email.HTMLBody)
+		assert.Empty(t, email.Attachments)
+
+		raw, err := io.ReadAll(email.Message.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "Caf=E9 au lait\r\n", string(raw), "raw body should still be readable for storage")
+	})
+
+	t.Run("MultipartWithAttachments", func(t *testing.T) {
+		msg := readMessage(t, `Subject: Report
+From: bob@example.com
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="outer"
+
+--outer
+Content-Type: multipart/alternative; boundary="inner"
+
+--inner
+Content-Type: text/plain; charset="UTF-8"
+Content-Transfer-Encoding: base64
+
+SGVsbG8gd8O2cmxk
+--inner
+Content-Type: text/html; charset="UTF-8"
+Content-Transfer-Encoding: quoted-printable
+
+<div dir=3D"ltr">Hello</div>
+--inner--
+
+--outer
+Content-Type: application/pdf; name="report.pdf"
+Content-Disposition: attachment; filename="report.pdf"
+Content-Transfer-Encoding: base64
+
+JVBERi0xLjQK
+--outer
+Content-Type: text/plain; name="=?UTF-8?B?bm90w6lzLnR4dA==?="
+Content-Disposition: attachment
+
+notes
+--outer--
+`)
+		email, err := domain.CreateEmail(context.Background(), repo, msg)
+		assert.NoError(t, err)
+		assert.Equal(t, "Hello wörld", email.TextBody, "base64 text part should be decoded")
+		assert.Equal(t, `<div dir="ltr">Hello</div>`, email.HTMLBody, "quoted printable html part should be decoded")
+		require.Len(t, email.Attachments, 2)
+		assert.Equal(t, domain.Attachment{ContentType: "application/pdf", Filename: "report.pdf", Size: 9, Content: []byte("%PDF-1.4\n")}, email.Attachments[0])
+		assert.Equal(t, "notés.txt", email.Attachments[1].Filename, "encoded filenames should be decoded")
+		assert.Equal(t, "text/plain", email.Attachments[1].ContentType)
+		assert.Equal(t, int64(5), email.Attachments[1].Size)
+	})
+
+	t.Run("MalformedMultipart", func(t *testing.T) {
+		msg := readMessage(t, `Subject: Broken
+Content-Type: multipart/mixed; boundary="b"
+
+--b
+Content-Type: text/plain
+
+unterminated`)
+		email, err := domain.CreateEmail(context.Background(), repo, msg)
+		assert.NoError(t, err, "malformed bodies shouldn't stop the email being created")
+		assert.Contains(t, email.TextBody, "unterminated", "the raw body should be kept as the text")
+	})
+}
@@ -0,0 +1,246 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrPermanentFailure is wrapped by MailSender errors that retrying won't fix, such as an SMTP 5xx reply
+	ErrPermanentFailure = errors.New("permanent delivery failure")
+)
+
+// outboundBatchSize is how many due messages are delivered per ProcessDue call
+const outboundBatchSize = 50
+
+type OutboundStatus int
+
+const (
+	OutboundStatusUnknown OutboundStatus = iota
+	OutboundStatusQueued
+	OutboundStatusSent
+	OutboundStatusDeferred
+	OutboundStatusFailed
+)
+
+func (s OutboundStatus) String() string {
+	switch s {
+	case OutboundStatusQueued:
+		return "Queued"
+	case OutboundStatusSent:
+		return "Sent"
+	case OutboundStatusDeferred:
+		return "Deferred"
+	case OutboundStatusFailed:
+		return "Failed"
+	}
+	return "Unset"
+}
+
+// OutboundMessage is a message waiting in, or delivered from, the outbound queue.
+type OutboundMessage struct {
+	ID uint64
+	// EmailID and TicketID link the message to the stored email and the ticket it was sent from, if any
+	EmailID   *uint64
+	TicketID  *uint64
+	MessageID string
+	From      string
+	To        []string
+	Message   []byte
+
+	Status        OutboundStatus
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+type OutboundUpdateParameters struct {
+	Status        OutboundStatus
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+}
+
+type OutboundRepository interface {
+	Enqueue(ctx context.Context, msg OutboundMessage) (OutboundMessage, error)
+	// FindDue returns up to limit queued or deferred messages due an attempt at now, oldest first
+	FindDue(ctx context.Context, now time.Time, limit int) ([]OutboundMessage, error)
+	// FindByMessageID returns the newest queued message with the given Message-ID
+	FindByMessageID(ctx context.Context, messageID string) (OutboundMessage, error)
+	Update(ctx context.Context, ID uint64, Params OutboundUpdateParameters) (OutboundMessage, error)
+}
+
+// RetryPolicy decides when a deferred message is retried, doubling the delay after each attempt.
+type RetryPolicy struct {
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	MaxAttempts int
+}
+
+// DefaultRetryPolicy retries for roughly a day and a half before giving up.
+var DefaultRetryPolicy = RetryPolicy{
+	BaseDelay:   time.Minute,
+	MaxDelay:    4 * time.Hour,
+	MaxAttempts: 15,
+}
+
+// Backoff returns how long to wait after the given number of failed attempts.
+func (p RetryPolicy) Backoff(attempts int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempts && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// DeliveryFailure is published as a DeliveryFailedEvent on the tickets EventBus when a message sent from a ticket can't be delivered.
+type DeliveryFailure struct {
+	TicketID uint64 `eventbus:"id"`
+	Message  OutboundMessage
+	Reason   string
+}
+
+func NewOutboundQueue(repo OutboundRepository, eventDriver EventBusDriver, policy RetryPolicy) (*OutboundQueue, error) {
+	eventBus, err := NewEventBus[DeliveryFailure]("tickets", eventDriver)
+	if err != nil {
+		return nil, err
+	}
+	return &OutboundQueue{
+		repo:     repo,
+		eventBus: eventBus,
+		policy:   policy,
+	}, nil
+}
+
+// OutboundQueue stores outbound mail until it's delivered, so a transient failure doesn't lose it.
+//
+// Only one process should deliver from the queue at a time.
+type OutboundQueue struct {
+	repo     OutboundRepository
+	eventBus *EventBus[DeliveryFailure]
+	policy   RetryPolicy
+}
+
+// Enqueue adds a message to the queue, due for delivery straight away.
+func (q *OutboundQueue) Enqueue(ctx context.Context, msg OutboundMessage) (OutboundMessage, error) {
+	now := time.Now()
+	msg.Status = OutboundStatusQueued
+	msg.Attempts = 0
+	msg.NextAttemptAt = now
+	msg.LastError = ""
+	msg.CreatedAt = now
+	msg.UpdatedAt = now
+	return q.repo.Enqueue(ctx, msg)
+}
+
+// ProcessDue attempts delivery of the messages that are due, deferring or failing those that can't be delivered.
+func (q *OutboundQueue) ProcessDue(ctx context.Context, sender MailSender) error {
+	due, err := q.repo.FindDue(ctx, time.Now(), outboundBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range due {
+		if err := q.deliver(ctx, sender, msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Run processes the queue every interval until the context is cancelled.
+//
+// Failures to process the queue are passed to onError and retried at the next interval, so a transient error doesn't stop delivery.
+func (q *OutboundQueue) Run(ctx context.Context, sender MailSender, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := q.ProcessDue(ctx, sender); err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Find returns the newest message queued with the given Message-ID.
+func (q *OutboundQueue) Find(ctx context.Context, messageID string) (OutboundMessage, error) {
+	return q.repo.FindByMessageID(ctx, messageID)
+}
+
+// Fail marks the message with the given Message-ID as permanently failed, e.g. when it bounces after being accepted.
+func (q *OutboundQueue) Fail(ctx context.Context, messageID string, reason string) (OutboundMessage, error) {
+	msg, err := q.repo.FindByMessageID(ctx, messageID)
+	if err != nil {
+		return OutboundMessage{}, err
+	}
+	if msg.Status == OutboundStatusFailed {
+		return msg, nil
+	}
+
+	return q.fail(ctx, msg, msg.Attempts, reason)
+}
+
+func (q *OutboundQueue) deliver(ctx context.Context, sender MailSender, msg OutboundMessage) error {
+	sendErr := sender.Send(ctx, msg.From, msg.To, msg.Message)
+	attempts := msg.Attempts + 1
+	if sendErr == nil {
+		_, err := q.repo.Update(ctx, msg.ID, OutboundUpdateParameters{
+			Status:        OutboundStatusSent,
+			Attempts:      attempts,
+			NextAttemptAt: msg.NextAttemptAt,
+		})
+		return err
+	}
+
+	if errors.Is(sendErr, ErrPermanentFailure) || attempts >= q.policy.MaxAttempts {
+		_, err := q.fail(ctx, msg, attempts, sendErr.Error())
+		return err
+	}
+
+	_, err := q.repo.Update(ctx, msg.ID, OutboundUpdateParameters{
+		Status:        OutboundStatusDeferred,
+		Attempts:      attempts,
+		NextAttemptAt: time.Now().Add(q.policy.Backoff(attempts)),
+		LastError:     sendErr.Error(),
+	})
+	return err
+}
+
+func (q *OutboundQueue) fail(ctx context.Context, msg OutboundMessage, attempts int, reason string) (OutboundMessage, error) {
+	msg, err := q.repo.Update(ctx, msg.ID, OutboundUpdateParameters{
+		Status:        OutboundStatusFailed,
+		Attempts:      attempts,
+		NextAttemptAt: msg.NextAttemptAt,
+		LastError:     reason,
+	})
+	if err != nil {
+		return OutboundMessage{}, err
+	}
+
+	if msg.TicketID != nil {
+		err = q.eventBus.Publish(fmt.Sprint(*msg.TicketID), DeliveryFailedEvent, DeliveryFailure{
+			TicketID: *msg.TicketID,
+			Message:  msg,
+			Reason:   reason,
+		})
+		if err != nil {
+			return OutboundMessage{}, err
+		}
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,240 @@
+package domain_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := domain.RetryPolicy{BaseDelay: time.Minute, MaxDelay: 10 * time.Minute, MaxAttempts: 5}
+
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: time.Minute},
+		{attempts: 2, expected: 2 * time.Minute},
+		{attempts: 3, expected: 4 * time.Minute},
+		{attempts: 4, expected: 8 * time.Minute},
+		{attempts: 5, expected: 10 * time.Minute},
+		{attempts: 100, expected: 10 * time.Minute},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprint(tc.attempts), func(t *testing.T) {
+			assert.Equal(t, tc.expected, policy.Backoff(tc.attempts))
+		})
+	}
+}
+
+func TestOutboundQueue(t *testing.T) {
+	ctx := context.Background()
+	policy := domain.RetryPolicy{BaseDelay: time.Minute, MaxDelay: time.Hour, MaxAttempts: 3}
+
+	t.Run("Delivered", func(t *testing.T) {
+		repo := &mockOutboundRepository{messages: map[uint64]domain.OutboundMessage{}}
+		queue, err := domain.NewOutboundQueue(repo, &mockEventBusDriver{}, policy)
+		require.NoError(t, err)
+
+		msg, err := queue.Enqueue(ctx, domain.OutboundMessage{From: "support@test.com", To: []string{"bob@example.com"}, Message: []byte("Subject: Hi\r\n\r\nHi\r\n")})
+		assert.NoError(t, err)
+		assert.Equal(t, domain.OutboundStatusQueued, msg.Status)
+
+		sender := &mockMailSender{}
+		assert.NoError(t, queue.ProcessDue(ctx, sender))
+		assert.Len(t, sender.sent, 1, "queued message should be sent")
+		assert.Equal(t, domain.OutboundStatusSent, repo.messages[msg.ID].Status)
+		assert.Equal(t, 1, repo.messages[msg.ID].Attempts)
+
+		assert.NoError(t, queue.ProcessDue(ctx, sender))
+		assert.Len(t, sender.sent, 1, "sent messages shouldn't be sent again")
+	})
+
+	t.Run("TransientFailureDefers", func(t *testing.T) {
+		repo := &mockOutboundRepository{messages: map[uint64]domain.OutboundMessage{}}
+		eventDrv := &mockEventBusDriver{}
+		queue, err := domain.NewOutboundQueue(repo, eventDrv, policy)
+		require.NoError(t, err)
+
+		msg, err := queue.Enqueue(ctx, domain.OutboundMessage{TicketID: ptr.To(uint64(7)), From: "support@test.com", To: []string{"bob@example.com"}})
+		require.NoError(t, err)
+
+		sender := &mockMailSender{err: errors.New("connection refused")}
+		before := time.Now()
+		assert.NoError(t, queue.ProcessDue(ctx, sender))
+		deferred := repo.messages[msg.ID]
+		assert.Equal(t, domain.OutboundStatusDeferred, deferred.Status, "message should be deferred")
+		assert.Equal(t, "connection refused", deferred.LastError)
+		assert.True(t, !deferred.NextAttemptAt.Before(before.Add(time.Minute)), "retry should be backed off")
+
+		assert.NoError(t, queue.ProcessDue(ctx, sender))
+		assert.Len(t, sender.sent, 1, "deferred message shouldn't be retried before it's due")
+
+		for i := 2; i <= policy.MaxAttempts; i++ {
+			repo.makeDue(msg.ID)
+			assert.NoError(t, queue.ProcessDue(ctx, sender))
+		}
+		failed := repo.messages[msg.ID]
+		assert.Equal(t, domain.OutboundStatusFailed, failed.Status, "message should fail after the last attempt")
+		assert.Equal(t, policy.MaxAttempts, failed.Attempts)
+		require.NotNil(t, eventDrv.EventSubject, "failure should be published")
+		assert.Equal(t, "tickets:7:deliveryfailed", *eventDrv.EventSubject)
+		assert.Equal(t, "connection refused", eventDrv.EventData.(domain.DeliveryFailure).Reason)
+	})
+
+	t.Run("PermanentFailure", func(t *testing.T) {
+		repo := &mockOutboundRepository{messages: map[uint64]domain.OutboundMessage{}}
+		eventDrv := &mockEventBusDriver{}
+		queue, err := domain.NewOutboundQueue(repo, eventDrv, policy)
+		require.NoError(t, err)
+
+		msg, err := queue.Enqueue(ctx, domain.OutboundMessage{TicketID: ptr.To(uint64(8)), From: "support@test.com", To: []string{"nobody@example.com"}})
+		require.NoError(t, err)
+
+		sender := &mockMailSender{err: fmt.Errorf("%w: 550 no such user", domain.ErrPermanentFailure)}
+		assert.NoError(t, queue.ProcessDue(ctx, sender))
+		assert.Equal(t, domain.OutboundStatusFailed, repo.messages[msg.ID].Status, "permanent failures shouldn't be retried")
+		assert.Equal(t, "tickets:8:deliveryfailed", *eventDrv.EventSubject)
+	})
+
+	t.Run("Bounce", func(t *testing.T) {
+		repo := &mockOutboundRepository{messages: map[uint64]domain.OutboundMessage{}}
+		eventDrv := &mockEventBusDriver{}
+		queue, err := domain.NewOutboundQueue(repo, eventDrv, policy)
+		require.NoError(t, err)
+
+		msg, err := queue.Enqueue(ctx, domain.OutboundMessage{TicketID: ptr.To(uint64(9)), MessageID: "1@test.com", From: "support@test.com", To: []string{"bob@example.com"}})
+		require.NoError(t, err)
+		require.NoError(t, queue.ProcessDue(ctx, &mockMailSender{}))
+
+		found, err := queue.Find(ctx, "1@test.com")
+		assert.NoError(t, err)
+		assert.Equal(t, msg.ID, found.ID, "the bounced message should be found by its Message-ID")
+
+		failed, err := queue.Fail(ctx, "1@test.com", "5.1.1 user unknown")
+		assert.NoError(t, err)
+		assert.Equal(t, msg.ID, failed.ID)
+		assert.Equal(t, domain.OutboundStatusFailed, failed.Status, "bounced message should be failed")
+		assert.Equal(t, "tickets:9:deliveryfailed", *eventDrv.EventSubject)
+
+		eventDrv.Reset()
+		_, err = queue.Fail(ctx, "1@test.com", "5.1.1 user unknown")
+		assert.NoError(t, err)
+		assert.Nil(t, eventDrv.EventSubject, "a repeated bounce shouldn't be published again")
+
+		_, err = queue.Fail(ctx, "unknown@test.com", "5.1.1 user unknown")
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+	})
+
+	t.Run("RunKeepsGoing", func(t *testing.T) {
+		repo := &mockOutboundRepository{findErr: errors.New("connection reset")}
+		queue, err := domain.NewOutboundQueue(repo, &mockEventBusDriver{}, policy)
+		require.NoError(t, err)
+
+		runCtx, cancel := context.WithCancel(ctx)
+		errs := make(chan error)
+		stopped := make(chan struct{})
+		go func() {
+			queue.Run(runCtx, &mockMailSender{}, time.Millisecond, func(err error) {
+				select {
+				case errs <- err:
+				case <-runCtx.Done():
+				}
+			})
+			close(stopped)
+		}()
+
+		for i := 0; i < 3; i++ {
+			select {
+			case err := <-errs:
+				assert.ErrorContains(t, err, "connection reset")
+			case <-time.After(time.Second):
+				t.Fatal("the queue should keep being processed after an error")
+			}
+		}
+		cancel()
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Fatal("Run should return once the context is cancelled")
+		}
+	})
+}
+
+type mockOutboundRepository struct {
+	messages map[uint64]domain.OutboundMessage
+	// findErr fails finding due messages
+	findErr error
+}
+
+func (m *mockOutboundRepository) Enqueue(ctx context.Context, msg domain.OutboundMessage) (domain.OutboundMessage, error) {
+	msg.ID = nextMapKey(m.messages)
+	m.messages[msg.ID] = msg
+	return msg, nil
+}
+
+func (m *mockOutboundRepository) FindDue(ctx context.Context, now time.Time, limit int) ([]domain.OutboundMessage, error) {
+	if m.findErr != nil {
+		return nil, m.findErr
+	}
+	due := make([]domain.OutboundMessage, 0)
+	for _, msg := range m.messages {
+		if (msg.Status == domain.OutboundStatusQueued || msg.Status == domain.OutboundStatusDeferred) && !msg.NextAttemptAt.After(now) {
+			due = append(due, msg)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (m *mockOutboundRepository) FindByMessageID(ctx context.Context, messageID string) (domain.OutboundMessage, error) {
+	for _, msg := range m.messages {
+		if msg.MessageID == messageID {
+			return msg, nil
+		}
+	}
+	return domain.OutboundMessage{}, domain.ErrNotFound
+}
+
+func (m *mockOutboundRepository) Update(ctx context.Context, ID uint64, Params domain.OutboundUpdateParameters) (domain.OutboundMessage, error) {
+	msg, ok := m.messages[ID]
+	if !ok {
+		return domain.OutboundMessage{}, domain.ErrNotFound
+	}
+	msg.Status = Params.Status
+	msg.Attempts = Params.Attempts
+	msg.NextAttemptAt = Params.NextAttemptAt
+	msg.LastError = Params.LastError
+	msg.UpdatedAt = time.Now()
+	m.messages[ID] = msg
+	return msg, nil
+}
+
+// makeDue brings a deferred message's next attempt forward to now
+func (m *mockOutboundRepository) makeDue(ID uint64) {
+	msg := m.messages[ID]
+	msg.NextAttemptAt = time.Now()
+	m.messages[ID] = msg
+}
+
+type mockMailSender struct {
+	err  error
+	sent []domain.OutboundMessage
+}
+
+func (m *mockMailSender) Send(ctx context.Context, from string, to []string, message []byte) error {
+	m.sent = append(m.sent, domain.OutboundMessage{From: from, To: to, Message: message})
+	return m.err
+}
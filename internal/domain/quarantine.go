@@ -0,0 +1,40 @@
+package domain
+
+import "time"
+
+// QuarantineReason is why inbound mail was held for review rather than opening or updating a ticket.
+type QuarantineReason string
+
+const (
+	// QuarantineReasonSpam holds mail the spam filters scored at or above the quarantine threshold
+	QuarantineReasonSpam QuarantineReason = "spam"
+	// QuarantineReasonAuthentication holds mail failing an SPF, DKIM or DMARC check the policy quarantines
+	QuarantineReasonAuthentication QuarantineReason = "authentication"
+	// QuarantineReasonUnknownSender holds mail to a private alias from a sender we've never dealt with
+	QuarantineReasonUnknownSender QuarantineReason = "unknown_sender"
+)
+
+// Quarantine holds inbound email until an admin releases it into a ticket or deletes it. Unreviewed email expires after a while.
+type Quarantine struct {
+	Reason QuarantineReason
+	// Detail explains the reason, such as the spam score or the failed check
+	Detail string
+	// Recipients are the envelope recipients, which the email is ticketed for when released
+	Recipients    []string
+	QuarantinedAt time.Time
+}
+
+// ExpiresAt returns when the email is deleted if it's still in quarantine, having been kept for retention.
+func (q Quarantine) ExpiresAt(retention time.Duration) time.Time {
+	return q.QuarantinedAt.Add(retention)
+}
+
+// QuarantineFilter narrows down the quarantined email listed.
+type QuarantineFilter struct {
+	// Reason only lists email held for the reason, nil listing all of it
+	Reason *QuarantineReason
+	// Before only lists email with lower IDs, to page through the list newest first
+	Before *uint64
+	// Limit caps how much email is listed, zero listing all of it
+	Limit int
+}
@@ -0,0 +1,260 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	ErrInvalidQuery  = errors.New("invalid query")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+const (
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 500
+)
+
+// TicketSortField is what search results are ordered by, ties being broken by ticket ID.
+type TicketSortField string
+
+const (
+	TicketSortCreated  TicketSortField = "created"
+	TicketSortUpdated  TicketSortField = "updated"
+	TicketSortPriority TicketSortField = "priority"
+)
+
+// TicketSort orders search results, by creation oldest first if left zero.
+type TicketSort struct {
+	Field      TicketSortField
+	Descending bool
+}
+
+// TicketQuery searches tickets by their current state, fields left zero matching any ticket.
+type TicketQuery struct {
+	TicketFilter
+	// Unassigned matches tickets without an owner
+	Unassigned bool
+	// CreatedFrom and UpdatedFrom match tickets created or last changed at or after the time, CreatedBefore and UpdatedBefore before it
+	CreatedFrom   time.Time
+	CreatedBefore time.Time
+	UpdatedFrom   time.Time
+	UpdatedBefore time.Time
+	// Alias matches tickets with inbound email addressed to the alias, regardless of case
+	Alias string
+	// Text matches tickets with every word and quoted phrase somewhere in their description, comments or email, as ParseTextQuery parses it.
+	// Text with no words to search for, such as only stop words, matches no tickets
+	Text string
+	Sort TicketSort
+	// Cursor continues a search from the end of the page it was returned with
+	Cursor string
+	// Limit is the page size, DefaultSearchLimit if left zero
+	Limit int
+}
+
+// TicketPage is a page of search results.
+type TicketPage struct {
+	Tickets []Ticket
+	// NextCursor continues the search on the next page, empty if this page is the last
+	NextCursor string
+	// Matches highlights where the text searched for was found, by ticket ID
+	Matches map[uint64][]TextMatch
+}
+
+// ParseQuery parses the search box's query language into a query, searching on behalf of the user so "owner:me" can be resolved.
+//
+// Terms are written as key:value, values with spaces being quoted like status:"in progress":
+//   - status, priority and type match any of the values given in separate terms
+//   - owner is a user ID, "me" or "none"
+//   - tag matches tickets having every tag given, and queue a queue name or "none"
+//   - alias is an email address and spam is true or false
+//   - created and updated take a date written as 2006-01-02, prefixed with <, <=, > or >=, or a range like 2024-01-01..2024-01-31
+//   - sort is created, updated or priority, prefixed with - to sort in descending order
+//   - custom fields are matched by their key, like product_area:API
+//
+// Anything else, including terms with unknown keys, is searched for as text, quotes and all. Errors wrap ErrInvalidQuery.
+func (s *TicketService) ParseQuery(input string, userID uint64) (TicketQuery, error) {
+	var (
+		query TicketQuery
+		text  []string
+	)
+	for _, term := range splitQuery(input) {
+		key, value, ok := strings.Cut(term, ":")
+		key = strings.ToLower(key)
+		value = strings.Trim(value, `"`)
+		if !ok || value == "" {
+			text = append(text, term)
+			continue
+		}
+		invalid := func(format string, args ...any) error {
+			return fmt.Errorf("%w: %s %s", ErrInvalidQuery, key, fmt.Sprintf(format, args...))
+		}
+
+		switch key {
+		case "status":
+			status, ok := s.Workflow.ParseStatus(value)
+			if !ok {
+				return TicketQuery{}, invalid("%q is not a status", value)
+			}
+			query.Statuses = append(query.Statuses, status)
+		case "priority":
+			priority := ParseTicketPriority(value)
+			if priority == TicketPriorityUnknown {
+				return TicketQuery{}, invalid("%q is not a priority", value)
+			}
+			query.Priorities = append(query.Priorities, priority)
+		case "type":
+			ticketType := ParseTicketType(value)
+			if ticketType == TicketTypeUnknown {
+				return TicketQuery{}, invalid("%q is not a ticket type", value)
+			}
+			query.Types = append(query.Types, ticketType)
+		case "owner":
+			switch strings.ToLower(value) {
+			case "me":
+				query.OwnerID = &userID
+			case "none":
+				query.Unassigned = true
+			default:
+				ID, err := strconv.ParseUint(value, 10, 64)
+				if err != nil {
+					return TicketQuery{}, invalid("must be a user ID, me or none")
+				}
+				query.OwnerID = &ID
+			}
+		case "tag":
+			query.Tags = append(query.Tags, value)
+		case "queue":
+			if strings.EqualFold(value, "none") {
+				value = ""
+			}
+			query.Queue = &value
+		case "alias":
+			query.Alias = value
+		case "spam":
+			spam, err := strconv.ParseBool(value)
+			if err != nil {
+				return TicketQuery{}, invalid("must be true or false")
+			}
+			query.Spam = &spam
+		case "created":
+			from, before, err := parseDateRange(value)
+			if err != nil {
+				return TicketQuery{}, invalid("%s", err)
+			}
+			query.CreatedFrom, query.CreatedBefore = from, before
+		case "updated":
+			from, before, err := parseDateRange(value)
+			if err != nil {
+				return TicketQuery{}, invalid("%s", err)
+			}
+			query.UpdatedFrom, query.UpdatedBefore = from, before
+		case "sort":
+			query.Sort.Descending = strings.HasPrefix(value, "-")
+			query.Sort.Field = TicketSortField(strings.ToLower(strings.TrimPrefix(value, "-")))
+			if !query.Sort.Field.valid() {
+				return TicketQuery{}, invalid("must be created, updated or priority")
+			}
+		default:
+			if _, ok := s.CustomFields.Definition(key); !ok {
+				text = append(text, term)
+				continue
+			}
+			if query.Fields == nil {
+				query.Fields = make(map[string]string)
+			}
+			query.Fields[key] = value
+		}
+	}
+	query.Text = strings.Join(text, " ")
+	return query, nil
+}
+
+func (f TicketSortField) valid() bool {
+	return f == "" || f == TicketSortCreated || f == TicketSortUpdated || f == TicketSortPriority
+}
+
+// splitQuery splits the query into terms on whitespace outside quotes.
+func splitQuery(input string) []string {
+	var (
+		terms  []string
+		term   strings.Builder
+		quoted bool
+	)
+	for _, r := range input {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			term.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if term.Len() > 0 {
+				terms = append(terms, term.String())
+				term.Reset()
+			}
+		default:
+			term.WriteRune(r)
+		}
+	}
+	if term.Len() > 0 {
+		terms = append(terms, term.String())
+	}
+	return terms
+}
+
+// parseDateRange parses a date comparison or range into the time it starts from and the time it ends before, either being zero if unbounded.
+// Dates are whole days in UTC.
+func parseDateRange(value string) (from time.Time, before time.Time, err error) {
+	parse := func(s string) (time.Time, error) {
+		date, err := time.Parse(CustomFieldDateLayout, s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("must be a date written as %s", CustomFieldDateLayout)
+		}
+		return date, nil
+	}
+	nextDay := func(date time.Time) time.Time { return date.AddDate(0, 0, 1) }
+
+	if start, end, ok := strings.Cut(value, ".."); ok {
+		if from, err = parse(start); err != nil {
+			return
+		}
+		if before, err = parse(end); err != nil {
+			return
+		}
+		before = nextDay(before)
+		if !from.Before(before) {
+			err = errors.New("range ends before it starts")
+		}
+		return
+	}
+
+	for _, op := range []string{">=", "<=", ">", "<"} {
+		rest, ok := strings.CutPrefix(value, op)
+		if !ok {
+			continue
+		}
+		var date time.Time
+		if date, err = parse(rest); err != nil {
+			return
+		}
+		switch op {
+		case ">=":
+			from = date
+		case ">":
+			from = nextDay(date)
+		case "<=":
+			before = nextDay(date)
+		case "<":
+			before = date
+		}
+		return
+	}
+
+	if from, err = parse(value); err != nil {
+		return
+	}
+	return from, nextDay(from), nil
+}
@@ -0,0 +1,129 @@
+package domain_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func TestParseQuery(t *testing.T) {
+	svc := domain.NewTicketService(&mockTicketRepo{transitions: map[uint64][]domain.TicketTransition{}}, &mockEventBusDriver{}, &mockCacheDriver{cache: map[string]interface{}{}})
+	svc.CustomFields = testCustomFields(t)
+	workflow, err := domain.NewWorkflow([]domain.WorkflowStatus{{Status: 10, Name: "Waiting on customer"}}, nil)
+	require.NoError(t, err)
+	svc.Workflow = workflow
+
+	day := func(s string) time.Time {
+		date, err := time.Parse(time.DateOnly, s)
+		require.NoError(t, err)
+		return date
+	}
+	var me, other uint64 = 7, 42
+
+	table := []struct {
+		name   string
+		input  string
+		expect domain.TicketQuery
+	}{
+		{name: "Empty", input: "  ", expect: domain.TicketQuery{}},
+		{
+			name:  "SearchBox",
+			input: "status:open owner:me priority:high printer",
+			expect: domain.TicketQuery{
+				TicketFilter: domain.TicketFilter{Statuses: []domain.TicketStatus{domain.TicketStatusOpen}, OwnerID: &me, Priorities: []domain.TicketPriority{domain.TicketPriorityHigh}},
+				Text:         "printer",
+			},
+		},
+		{
+			name:  "RepeatedKeys",
+			input: `Status:"in progress" status:"Waiting on customer" type:incident type:problem tag:vip tag:billing`,
+			expect: domain.TicketQuery{TicketFilter: domain.TicketFilter{
+				Statuses: []domain.TicketStatus{domain.TicketStatusInProgress, 10},
+				Types:    []domain.TicketType{domain.TicketTypeIncident, domain.TicketTypeProblem},
+				Tags:     []string{"vip", "billing"},
+			}},
+		},
+		{name: "OwnerID", input: "owner:42", expect: domain.TicketQuery{TicketFilter: domain.TicketFilter{OwnerID: &other}}},
+		{name: "Unassigned", input: "owner:none", expect: domain.TicketQuery{Unassigned: true}},
+		{name: "NoQueue", input: "queue:none", expect: domain.TicketQuery{TicketFilter: domain.TicketFilter{Queue: ptr.To("")}}},
+		{
+			name:   "AliasAndSpam",
+			input:  "alias:support@example.com queue:Billing spam:false",
+			expect: domain.TicketQuery{TicketFilter: domain.TicketFilter{Queue: ptr.To("Billing"), Spam: ptr.To(false)}, Alias: "support@example.com"},
+		},
+		{name: "CustomField", input: "product_area:API", expect: domain.TicketQuery{TicketFilter: domain.TicketFilter{Fields: map[string]string{"product_area": "API"}}}},
+		{name: "Sort", input: "sort:-updated", expect: domain.TicketQuery{Sort: domain.TicketSort{Field: domain.TicketSortUpdated, Descending: true}}},
+		{name: "CreatedOn", input: "created:2024-03-01", expect: domain.TicketQuery{CreatedFrom: day("2024-03-01"), CreatedBefore: day("2024-03-02")}},
+		{name: "CreatedRange", input: "created:2024-03-01..2024-03-31", expect: domain.TicketQuery{CreatedFrom: day("2024-03-01"), CreatedBefore: day("2024-04-01")}},
+		{name: "UpdatedAfter", input: "updated:>2024-03-01", expect: domain.TicketQuery{UpdatedFrom: day("2024-03-02")}},
+		{name: "UpdatedFrom", input: "updated:>=2024-03-01", expect: domain.TicketQuery{UpdatedFrom: day("2024-03-01")}},
+		{name: "UpdatedBefore", input: "updated:<2024-03-01", expect: domain.TicketQuery{UpdatedBefore: day("2024-03-01")}},
+		{name: "UpdatedUntil", input: "updated:<=2024-03-01", expect: domain.TicketQuery{UpdatedBefore: day("2024-03-02")}},
+		{name: "Text", input: `"out of paper" again url:https://example.com/x printer:`, expect: domain.TicketQuery{Text: `"out of paper" again url:https://example.com/x printer:`}},
+	}
+	for _, tc := range table {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := svc.ParseQuery(tc.input, me)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, query)
+		})
+	}
+
+	for _, input := range []string{
+		"status:resolved",
+		"priority:critical",
+		"type:bug",
+		"owner:someone",
+		"spam:maybe",
+		"created:yesterday",
+		"updated:2024-03-31..2024-03-01",
+		"sort:name",
+	} {
+		t.Run(input, func(t *testing.T) {
+			_, err := svc.ParseQuery(input, me)
+			assert.ErrorIs(t, err, domain.ErrInvalidQuery)
+		})
+	}
+}
+
+func TestSearchTickets(t *testing.T) {
+	searchRepo := mockTicketRepo{transitions: map[uint64][]domain.TicketTransition{
+		1: {{Timestamp: time.Now(), Status: domain.TicketStatusOpen}},
+	}}
+	svc := domain.NewTicketService(&searchRepo, &mockEventBusDriver{}, &mockCacheDriver{cache: map[string]interface{}{}})
+	svc.CustomFields = testCustomFields(t)
+
+	page, err := svc.SearchTickets(context.Background(), domain.TicketQuery{
+		TicketFilter: domain.TicketFilter{Tags: []string{" VIP"}, Fields: map[string]string{"seats": "25.0"}},
+		Alias:        " Support@Example.com",
+	})
+	assert.NoError(t, err)
+	assert.Len(t, page.Tickets, 1)
+	assert.Equal(t, domain.TicketSort{Field: domain.TicketSortCreated}, searchRepo.query.Sort, "searches should be sorted by creation by default")
+	assert.Equal(t, domain.DefaultSearchLimit, searchRepo.query.Limit)
+	assert.Equal(t, []string{"vip"}, searchRepo.query.Tags)
+	assert.Equal(t, map[string]string{"seats": "25"}, searchRepo.query.Fields)
+	assert.Equal(t, "support@example.com", searchRepo.query.Alias)
+
+	table := []struct {
+		name   string
+		query  domain.TicketQuery
+		expect error
+	}{
+		{name: "NegativeLimit", query: domain.TicketQuery{Limit: -1}, expect: domain.ErrInvalidQuery},
+		{name: "LimitTooLarge", query: domain.TicketQuery{Limit: domain.MaxSearchLimit + 1}, expect: domain.ErrInvalidQuery},
+		{name: "UnknownSort", query: domain.TicketQuery{Sort: domain.TicketSort{Field: "name"}}, expect: domain.ErrInvalidQuery},
+		{name: "UnknownField", query: domain.TicketQuery{TicketFilter: domain.TicketFilter{Fields: map[string]string{"colour": "red"}}}, expect: domain.ErrUnknownCustomField},
+	}
+	for _, tc := range table {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := svc.SearchTickets(context.Background(), tc.query)
+			assert.ErrorIs(t, err, tc.expect)
+		})
+	}
+}
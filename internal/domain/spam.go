@@ -0,0 +1,47 @@
+package domain
+
+import "context"
+
+// SpamAction is what was done with inbound mail because of its spam score.
+type SpamAction string
+
+const (
+	// SpamActionNone accepts the message as usual
+	SpamActionNone SpamAction = "none"
+	// SpamActionTag accepts the message and marks its ticket as spam
+	SpamActionTag SpamAction = "tag"
+	// SpamActionQuarantine holds the message in quarantine without opening or updating a ticket
+	SpamActionQuarantine SpamAction = "quarantine"
+	// SpamActionReject refuses the message during the SMTP transaction
+	SpamActionReject SpamAction = "reject"
+)
+
+// SpamRule is a spam filter rule an email matched. Positive scores count towards spam, negative ones against.
+type SpamRule struct {
+	Name  string
+	Score float64
+}
+
+// SpamReport is the outcome of scoring an inbound email.
+type SpamReport struct {
+	// Score is the sum of the rules' scores
+	Score  float64
+	Rules  []SpamRule
+	Action SpamAction
+}
+
+// SpamTokenCount is how many trained spam and ham messages a token was seen in.
+type SpamTokenCount struct {
+	Spam int
+	Ham  int
+}
+
+// SpamTrainingRepository persists what the Bayesian spam classifier has learned.
+type SpamTrainingRepository interface {
+	// SpamTokenCounts returns the counts of the tokens that have been seen, leaving out the rest
+	SpamTokenCounts(ctx context.Context, tokens []string) (map[string]SpamTokenCount, error)
+	// SpamTrainingTotals returns how many messages have been trained as spam and as ham
+	SpamTrainingTotals(ctx context.Context) (spam, ham int, err error)
+	// TrainSpam records an email's tokens as spam or ham. Training an email again with the other class moves its tokens, and with the same class does nothing
+	TrainSpam(ctx context.Context, emailID uint64, tokens []string, spam bool) error
+}
@@ -0,0 +1,319 @@
+package domain
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxTermLength skips tokens too long to be words anyone searches for, such as encoded data
+	maxTermLength = 40
+	// maxTextTokens bounds the work and storage a huge email body can cause
+	maxTextTokens = 10000
+	// snippetContext is roughly how much text is shown before the first match in a snippet, and snippetLength how long snippets are
+	snippetContext = 60
+	snippetLength  = 240
+)
+
+// stopWords are too common to be worth indexing. They still count towards positions, so phrases with them in are matched as written.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "but": true, "by": true,
+	"for": true, "if": true, "in": true, "into": true, "is": true, "it": true, "of": true, "on": true, "or": true,
+	"such": true, "that": true, "the": true, "their": true, "then": true, "there": true, "these": true, "they": true,
+	"this": true, "to": true, "was": true, "will": true, "with": true,
+}
+
+// TextSource is the part of a ticket a piece of indexed text comes from.
+type TextSource string
+
+const (
+	TextSourceDescription  TextSource = "description"
+	TextSourceComment      TextSource = "comment"
+	TextSourceEmailSubject TextSource = "subject"
+	TextSourceEmailBody    TextSource = "email"
+)
+
+// TicketText is a piece of a ticket's text, as the full-text index holds it.
+type TicketText struct {
+	Source TextSource
+	// SourceID is the comment or email the text comes from, zero for the description
+	SourceID uint64
+	Text     string
+}
+
+// TicketTexts returns the text of a ticket and the emails linked to it, in the order it was written.
+func TicketTexts(ticket Ticket, emails []Email) []TicketText {
+	var texts []TicketText
+	add := func(source TextSource, sourceID uint64, text string) {
+		if strings.TrimSpace(text) != "" {
+			texts = append(texts, TicketText{Source: source, SourceID: sourceID, Text: text})
+		}
+	}
+
+	add(TextSourceDescription, 0, ticket.Meta().Description)
+	for _, transition := range ticket.Transitions {
+		if transition.Comment != nil {
+			add(TextSourceComment, transition.Comment.ID, transition.Comment.Body)
+		}
+	}
+	for _, e := range emails {
+		add(TextSourceEmailSubject, e.ID, e.Subject)
+		add(TextSourceEmailBody, e.ID, e.TextBody)
+	}
+	return texts
+}
+
+// TextToken is a term found in text, with where it was found.
+type TextToken struct {
+	// Term is the word lower cased and stemmed
+	Term string
+	// Position counts the words before it, stop words included
+	Position int
+	// Start and End are the byte offsets of the word in the text
+	Start int
+	End   int
+}
+
+// AnalyzeText splits text into terms: runs of letters and digits, lower cased and stemmed, stop words left out.
+func AnalyzeText(text string) []TextToken {
+	var (
+		tokens   []TextToken
+		position int
+		start    = -1
+	)
+	word := func(end int) {
+		w := strings.ToLower(text[start:end])
+		if len(w) <= maxTermLength && !stopWords[w] {
+			tokens = append(tokens, TextToken{Term: stem(w), Position: position, Start: start, End: end})
+		}
+		position++
+		start = -1
+	}
+	for i, r := range text {
+		if len(tokens) >= maxTextTokens {
+			return tokens
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+		} else if start >= 0 {
+			word(i)
+		}
+	}
+	if start >= 0 && len(tokens) < maxTextTokens {
+		word(len(text))
+	}
+	return tokens
+}
+
+// TextPhrase is a word or phrase searched for: terms that must be found in the same text, at the same distance from each other as in the phrase.
+type TextPhrase []TextToken
+
+// ParseTextQuery parses the words and quoted phrases of a text search, as AnalyzeText splits text into terms.
+//
+// A word written with punctuation in, such as "e-mail", is searched for as a phrase. Stop words on their own are left out.
+func ParseTextQuery(text string) []TextPhrase {
+	var phrases []TextPhrase
+	for _, term := range splitQuery(text) {
+		tokens := AnalyzeText(strings.Trim(term, `"`))
+		if len(tokens) > 0 {
+			phrases = append(phrases, tokens)
+		}
+	}
+	return phrases
+}
+
+// TextFragment is part of a snippet of matching text, highlighted if it matched.
+type TextFragment struct {
+	Text        string
+	Highlighted bool
+}
+
+// TextMatch is a snippet of a ticket's text a search matched, with the words matched highlighted.
+type TextMatch struct {
+	Source   TextSource
+	SourceID uint64
+	Snippet  []TextFragment
+}
+
+// HighlightText finds the phrases in the text, returning a snippet of it around the first match, or false if none is found.
+func HighlightText(text TicketText, phrases []TextPhrase) (TextMatch, bool) {
+	tokens := AnalyzeText(text.Text)
+	byPosition := make(map[int]TextToken, len(tokens))
+	for _, token := range tokens {
+		byPosition[token.Position] = token
+	}
+
+	// spans are the byte offsets of each occurrence of a phrase
+	var spans [][2]int
+	for _, phrase := range phrases {
+		for _, first := range tokens {
+			if first.Term != phrase[0].Term {
+				continue
+			}
+			last, ok := first, true
+			for _, t := range phrase[1:] {
+				last, ok = byPosition[first.Position+t.Position-phrase[0].Position]
+				if !ok || last.Term != t.Term {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				spans = append(spans, [2]int{first.Start, last.End})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return TextMatch{}, false
+	}
+	slices.SortFunc(spans, func(a, b [2]int) int { return a[0] - b[0] })
+
+	// The snippet starts and ends on a word boundary, unless that's too far from the match, and never in the middle of a character
+	from := max(0, spans[0][0]-snippetContext)
+	for from > 0 && !utf8.RuneStart(text.Text[from]) {
+		from--
+	}
+	if before, _ := utf8.DecodeLastRuneInString(text.Text[:from]); from > 0 && !unicode.IsSpace(before) {
+		if i := strings.IndexFunc(text.Text[from:spans[0][0]], unicode.IsSpace); i >= 0 {
+			_, size := utf8.DecodeRuneInString(text.Text[from+i:])
+			from += i + size
+		}
+	}
+	to := min(len(text.Text), from+snippetLength)
+	for to < len(text.Text) && !utf8.RuneStart(text.Text[to]) {
+		to--
+	}
+	to = max(to, spans[0][1])
+	if to < len(text.Text) {
+		if i := strings.LastIndexFunc(text.Text[spans[0][1]:to], unicode.IsSpace); i >= 0 {
+			to = spans[0][1] + i
+		}
+	}
+
+	match := TextMatch{Source: text.Source, SourceID: text.SourceID}
+	add := func(s string, highlighted bool) {
+		if s != "" {
+			match.Snippet = append(match.Snippet, TextFragment{Text: s, Highlighted: highlighted})
+		}
+	}
+	if from > 0 {
+		add("…", false)
+	}
+	at := from
+	for _, span := range spans {
+		start, end := max(span[0], at), min(span[1], to)
+		if start >= end {
+			continue
+		}
+		add(text.Text[at:start], false)
+		add(text.Text[start:end], true)
+		at = end
+	}
+	add(text.Text[at:to], false)
+	if to < len(text.Text) {
+		add("…", false)
+	}
+	return match, true
+}
+
+type TicketTextRepository interface {
+	// ReplaceTicketTexts replaces everything indexed for the ticket with the texts
+	ReplaceTicketTexts(ctx context.Context, ticketID uint64, texts []TicketText) error
+}
+
+// NewTicketIndexer returns an indexer of the tickets and email in the repositories.
+func NewTicketIndexer(repo TicketTextRepository, tickets TicketRepository, emails EmailTicketRepository) *TicketIndexer {
+	return &TicketIndexer{repo: repo, tickets: tickets, emails: emails}
+}
+
+// TicketIndexer indexes the text of tickets, their comments and the email linked to them.
+//
+// Tickets are reindexed as a whole from the repositories, so events arriving out of order still leave the latest text indexed.
+type TicketIndexer struct {
+	repo    TicketTextRepository
+	tickets TicketRepository
+	emails  EmailTicketRepository
+	onError func(ticketID uint64, err error)
+}
+
+// Subscribe keeps the index current as tickets change and email is linked to them.
+//
+// Failures to index a ticket on one of its events are passed to onError with the ticket's ID, as there's no caller to return them to.
+// They're only retried with the ticket's next event, and events are only seen by the process publishing them, so Rebuild catches up.
+func (i *TicketIndexer) Subscribe(eventDriver EventBusDriver, onError func(ticketID uint64, err error)) error {
+	ticketEventBus, err := NewEventBus[Ticket]("tickets", eventDriver)
+	if err != nil {
+		return err
+	}
+	emailEventBus, err := NewEventBus[Email]("emails", eventDriver)
+	if err != nil {
+		return err
+	}
+	i.onError = onError
+	ticketEventBus.Subscribe(nil, []EventType{CreateEvent, UpdateEvent}, i.ObserveTicketEvent)
+	emailEventBus.Subscribe(nil, []EventType{CreateEvent, UpdateEvent}, i.ObserveEmailEvent)
+	return nil
+}
+
+func (i *TicketIndexer) ObserveTicketEvent(eventType EventType, data Ticket) {
+	i.observe(data.ID)
+}
+
+// ObserveEmailEvent reindexes the ticket email is linked to, ignoring email that isn't.
+func (i *TicketIndexer) ObserveEmailEvent(eventType EventType, data Email) {
+	if data.TicketID != nil {
+		i.observe(*data.TicketID)
+	}
+}
+
+func (i *TicketIndexer) observe(ticketID uint64) {
+	if err := i.IndexTicket(context.Background(), ticketID); err != nil && i.onError != nil {
+		i.onError(ticketID, err)
+	}
+}
+
+// IndexTicket replaces the ticket's text in the index with what's in the repositories.
+func (i *TicketIndexer) IndexTicket(ctx context.Context, ID uint64) error {
+	ticket, err := i.tickets.Find(ctx, ID)
+	if err != nil {
+		return err
+	}
+	return i.index(ctx, ticket)
+}
+
+func (i *TicketIndexer) index(ctx context.Context, ticket Ticket) error {
+	emails, err := i.emails.FindTicketEmails(ctx, ticket.ID)
+	if err != nil {
+		return err
+	}
+	return i.repo.ReplaceTicketTexts(ctx, ticket.ID, TicketTexts(ticket, emails))
+}
+
+// Rebuild reindexes every ticket, oldest first, returning how many were indexed.
+func (i *TicketIndexer) Rebuild(ctx context.Context) (int, error) {
+	var (
+		indexed int
+		query   = TicketQuery{Sort: TicketSort{Field: TicketSortCreated}, Limit: MaxSearchLimit}
+	)
+	for {
+		page, err := i.tickets.Search(ctx, query)
+		if err != nil {
+			return indexed, err
+		}
+		for _, ticket := range page.Tickets {
+			if err := i.index(ctx, ticket); err != nil {
+				return indexed, err
+			}
+			indexed++
+		}
+		if page.NextCursor == "" {
+			return indexed, nil
+		}
+		query.Cursor = page.NextCursor
+	}
+}
@@ -0,0 +1,210 @@
+package domain_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func TestAnalyzeText(t *testing.T) {
+	assert.Equal(t, []domain.TextToken{
+		{Term: "printer", Position: 1, Start: 4, End: 12},
+		{Term: "were", Position: 2, Start: 13, End: 17},
+		{Term: "print", Position: 3, Start: 18, End: 26},
+		{Term: "e", Position: 4, Start: 28, End: 29},
+		{Term: "mail", Position: 5, Start: 30, End: 34},
+		{Term: "50", Position: 6, Start: 35, End: 37},
+	}, domain.AnalyzeText("The printers were Printing, e-mail 50%!"), "stop words should be left out but counted")
+
+	assert.Empty(t, domain.AnalyzeText(" -- "))
+	assert.Empty(t, domain.AnalyzeText(strings.Repeat("x", 41)), "words too long to be searched for shouldn't be indexed")
+
+	t.Run("Stemming", func(t *testing.T) {
+		for word, expect := range map[string]string{
+			"caresses":        "caress",
+			"ponies":          "poni",
+			"cats":            "cat",
+			"agreed":          "agre",
+			"plastered":       "plaster",
+			"motoring":        "motor",
+			"sing":            "sing",
+			"hopping":         "hop",
+			"filing":          "file",
+			"happy":           "happi",
+			"relational":      "relat",
+			"conditional":     "condit",
+			"generalizations": "gener",
+			"hopeful":         "hope",
+			"goodness":        "good",
+			"adjustment":      "adjust",
+			"adoption":        "adopt",
+			"probate":         "probat",
+			"controlling":     "control",
+			"café":            "café",
+			"ipv6":            "ipv6",
+		} {
+			tokens := domain.AnalyzeText(word)
+			if assert.Len(t, tokens, 1, word) {
+				assert.Equal(t, expect, tokens[0].Term, word)
+			}
+		}
+	})
+}
+
+func TestParseTextQuery(t *testing.T) {
+	assert.Equal(t, []domain.TextPhrase{
+		{{Term: "printer", Start: 0, End: 8}},
+		{{Term: "send", Start: 0, End: 4}, {Term: "new", Position: 2, Start: 7, End: 10}, {Term: "on", Position: 3, Start: 11, End: 14}},
+		{{Term: "e", Start: 0, End: 1}, {Term: "mail", Position: 1, Start: 2, End: 6}},
+	}, domain.ParseTextQuery(`printers "send a new one" the e-mail`))
+
+	assert.Empty(t, domain.ParseTextQuery(`"" the`))
+}
+
+func TestHighlightText(t *testing.T) {
+	text := domain.TicketText{Source: domain.TextSourceComment, SourceID: 3, Text: "The printer on the third floor is on fire again"}
+
+	match, ok := domain.HighlightText(text, domain.ParseTextQuery("fire printers"))
+	assert.True(t, ok)
+	assert.Equal(t, domain.TextMatch{Source: domain.TextSourceComment, SourceID: 3, Snippet: []domain.TextFragment{
+		{Text: "The "},
+		{Text: "printer", Highlighted: true},
+		{Text: " on the third floor is on "},
+		{Text: "fire", Highlighted: true},
+		{Text: " again"},
+	}}, match)
+
+	match, ok = domain.HighlightText(text, domain.ParseTextQuery(`"third floor"`))
+	assert.True(t, ok)
+	assert.Equal(t, []domain.TextFragment{{Text: "The printer on the "}, {Text: "third floor", Highlighted: true}, {Text: " is on fire again"}}, match.Snippet)
+
+	_, ok = domain.HighlightText(text, domain.ParseTextQuery(`"fire printer"`))
+	assert.False(t, ok, "phrases should only match in order")
+
+	t.Run("LongText", func(t *testing.T) {
+		long := domain.TicketText{Source: domain.TextSourceEmailBody, Text: strings.Repeat("lorem ", 30) + "printer jam" + strings.Repeat(" ipsum", 60)}
+		match, ok := domain.HighlightText(long, domain.ParseTextQuery("jam"))
+		assert.True(t, ok)
+		assert.Equal(t, []domain.TextFragment{
+			{Text: "…"},
+			{Text: strings.Repeat("lorem ", 8) + "printer "},
+			{Text: "jam", Highlighted: true},
+			{Text: strings.Repeat(" ipsum", 30)},
+			{Text: "…"},
+		}, match.Snippet, "snippets should be cut to whole words around the first match")
+	})
+
+	t.Run("NonASCII", func(t *testing.T) {
+		text := domain.TicketText{Source: domain.TextSourceEmailBody, Text: strings.Repeat("é", 40) + "\u00a0printer jam,," + strings.Repeat("ü", 200)}
+		match, ok := domain.HighlightText(text, domain.ParseTextQuery("jam"))
+		assert.True(t, ok)
+		for _, fragment := range match.Snippet {
+			assert.True(t, utf8.ValidString(fragment.Text), "snippets shouldn't split characters: %q", fragment.Text)
+		}
+		assert.Equal(t, []domain.TextFragment{
+			{Text: "…"},
+			{Text: "printer "},
+			{Text: "jam", Highlighted: true},
+			{Text: ",," + strings.Repeat("ü", 113)},
+			{Text: "…"},
+		}, match.Snippet)
+	})
+}
+
+func TestTicketTexts(t *testing.T) {
+	opened := time.Now()
+	ticket := domain.Ticket{ID: 1, Transitions: []domain.TicketTransition{
+		{Timestamp: opened, Status: domain.TicketStatusOpen, Description: ptr.To("Printer on fire")},
+		{Timestamp: opened.Add(time.Minute), Comment: &domain.TicketComment{ID: 3, Body: "Have you tried turning it off?"}},
+		{Timestamp: opened.Add(2 * time.Minute), Comment: &domain.TicketComment{ID: 4, Body: " ", Attachments: []domain.Attachment{{ID: 1}}}},
+	}}
+	emails := []domain.Email{{ID: 5, Subject: "Re: printer"}}
+
+	assert.Equal(t, []domain.TicketText{
+		{Source: domain.TextSourceDescription, Text: "Printer on fire"},
+		{Source: domain.TextSourceComment, SourceID: 3, Text: "Have you tried turning it off?"},
+		{Source: domain.TextSourceEmailSubject, SourceID: 5, Text: "Re: printer"},
+	}, domain.TicketTexts(ticket, emails), "blank text shouldn't be indexed")
+}
+
+func TestTicketIndexer(t *testing.T) {
+	ctx := context.Background()
+	tickets := &mockTicketRepo{transitions: map[uint64][]domain.TicketTransition{
+		1: {{Timestamp: time.Now(), Status: domain.TicketStatusOpen, Description: ptr.To("Printer on fire")}},
+	}}
+	emails := &mockEmailTicketRepo{}
+	texts := &mockTicketTextRepo{texts: map[uint64][]domain.TicketText{}}
+	failed := map[uint64]error{}
+	indexer := domain.NewTicketIndexer(texts, tickets, emails)
+	require.NoError(t, indexer.Subscribe(&mockEventBusDriver{}, func(ticketID uint64, err error) { failed[ticketID] = err }))
+
+	indexer.ObserveTicketEvent(domain.UpdateEvent, domain.Ticket{ID: 1})
+	assert.Equal(t, map[uint64][]domain.TicketText{1: {{Source: domain.TextSourceDescription, Text: "Printer on fire"}}}, texts.texts)
+
+	indexer.ObserveEmailEvent(domain.CreateEvent, domain.Email{ID: 9, Subject: "Toner"})
+	assert.Len(t, texts.texts[1], 1, "email not linked to a ticket shouldn't be indexed")
+
+	linked := domain.Email{ID: 9, Subject: "Toner", TicketID: ptr.To(uint64(1))}
+	emails.emails = append(emails.emails, linked)
+	indexer.ObserveEmailEvent(domain.UpdateEvent, linked)
+	assert.Equal(t, []domain.TicketText{
+		{Source: domain.TextSourceDescription, Text: "Printer on fire"},
+		{Source: domain.TextSourceEmailSubject, SourceID: 9, Text: "Toner"},
+	}, texts.texts[1], "email linked to the ticket should be indexed with it")
+
+	assert.ErrorIs(t, indexer.IndexTicket(ctx, 5), domain.ErrNotFound)
+	assert.Empty(t, failed, "indexing should have succeeded so far")
+	indexer.ObserveTicketEvent(domain.UpdateEvent, domain.Ticket{ID: 5})
+	assert.ErrorIs(t, failed[5], domain.ErrNotFound, "failures to index on an event should be reported with the ticket")
+
+	t.Run("Rebuild", func(t *testing.T) {
+		tickets.transitions[2] = []domain.TicketTransition{{Timestamp: time.Now(), Status: domain.TicketStatusOpen, Description: ptr.To("Invoice overdue")}}
+		texts.texts = map[uint64][]domain.TicketText{}
+
+		indexed, err := domain.NewTicketIndexer(texts, tickets, emails).Rebuild(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, indexed, "rebuilding shouldn't need events")
+		assert.Len(t, texts.texts[1], 2)
+		assert.Equal(t, []domain.TicketText{{Source: domain.TextSourceDescription, Text: "Invoice overdue"}}, texts.texts[2])
+	})
+}
+
+type mockTicketTextRepo struct {
+	texts map[uint64][]domain.TicketText
+}
+
+func (m *mockTicketTextRepo) ReplaceTicketTexts(ctx context.Context, ticketID uint64, texts []domain.TicketText) error {
+	m.texts[ticketID] = texts
+	return nil
+}
+
+type mockEmailTicketRepo struct {
+	emails []domain.Email
+}
+
+func (m *mockEmailTicketRepo) LinkTicket(ctx context.Context, emailID uint64, ticketID uint64) error {
+	for i := range m.emails {
+		if m.emails[i].ID == emailID {
+			m.emails[i].TicketID = &ticketID
+			return nil
+		}
+	}
+	return domain.ErrNotFound
+}
+
+func (m *mockEmailTicketRepo) FindTicketEmails(ctx context.Context, ticketID uint64) ([]domain.Email, error) {
+	var emails []domain.Email
+	for _, e := range m.emails {
+		if e.TicketID != nil && *e.TicketID == ticketID {
+			emails = append(emails, e)
+		}
+	}
+	return emails, nil
+}
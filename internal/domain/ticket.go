@@ -2,7 +2,11 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -10,12 +14,51 @@ type TicketRepository interface {
 	Find(ctx context.Context, ID uint64) (Ticket, error)
 	Open(ctx context.Context, Description string) (Ticket, error)
 	Update(ctx context.Context, ID uint64, Params TicketUpdateParameters) (Ticket, error)
+	// FindCommentAttachment returns a comment attachment including its content
+	FindCommentAttachment(ctx context.Context, ID uint64) (Attachment, error)
+	// List returns the tickets matching the filter, oldest first
+	List(ctx context.Context, filter TicketFilter) ([]Ticket, error)
+	// Search returns a page of the tickets matching the query, returning an error wrapping ErrInvalidCursor if the query's cursor can't be continued
+	Search(ctx context.Context, query TicketQuery) (TicketPage, error)
 }
 
 type TicketUpdateParameters struct {
 	Status      TicketStatus
 	OwnerID     *uint64
 	Description *string
+	EmailID     *uint64
+	// Spam marks the ticket as spam, or not
+	Spam *bool
+	// AddTags tags the ticket, ignoring tags it already has
+	AddTags []string
+	// RemoveTags takes tags off the ticket, ignoring tags it doesn't have
+	RemoveTags []string
+	// Priority changes the ticket's priority, unless it's TicketPriorityUnknown
+	Priority TicketPriority
+	// Type changes the ticket's type, unless it's TicketTypeUnknown
+	Type TicketType
+	// SetFields sets custom fields by key, an empty value clearing the field
+	SetFields map[string][]string
+	// Queue files the ticket in a team's queue, an empty string taking it out of any
+	Queue *string
+	// Resolution explains the status change, such as why the ticket was closed
+	Resolution *string
+	// Comment adds a public reply or internal note to the ticket, with its attachments' content
+	Comment *TicketComment
+	// FromStatus refuses the update with ErrStatusChanged unless the ticket is still in this status, if set
+	FromStatus TicketStatus
+}
+
+// NormalizeTags lower cases and trims tags, leaving out empty ones and duplicates.
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
 }
 
 type TicketStatus int
@@ -38,10 +81,102 @@ func (t TicketStatus) String() string {
 		return "Blocked"
 	case TicketStatusClosed:
 		return "Closed"
+	case TicketStatusUnknown:
+		return "Unset"
+	}
+	// Custom statuses are named by the Workflow
+	return fmt.Sprintf("Status %d", int(t))
+}
+
+// TicketPriority is how urgently a ticket should be worked on, TicketPriorityUnknown leaving it unset.
+type TicketPriority int
+
+const (
+	TicketPriorityUnknown TicketPriority = iota
+	TicketPriorityLow
+	TicketPriorityNormal
+	TicketPriorityHigh
+	TicketPriorityUrgent
+)
+
+func (p TicketPriority) String() string {
+	switch p {
+	case TicketPriorityLow:
+		return "Low"
+	case TicketPriorityNormal:
+		return "Normal"
+	case TicketPriorityHigh:
+		return "High"
+	case TicketPriorityUrgent:
+		return "Urgent"
 	}
 	return "Unset"
 }
 
+// ParseTicketPriority parses a priority's name regardless of case, returning TicketPriorityUnknown for anything else.
+func ParseTicketPriority(s string) TicketPriority {
+	for p := TicketPriorityLow; p <= TicketPriorityUrgent; p++ {
+		if strings.EqualFold(s, p.String()) {
+			return p
+		}
+	}
+	return TicketPriorityUnknown
+}
+
+// TicketType is the kind of request a ticket is, TicketTypeUnknown leaving it unset.
+type TicketType int
+
+const (
+	TicketTypeUnknown TicketType = iota
+	// TicketTypeQuestion asks for information
+	TicketTypeQuestion
+	// TicketTypeIncident reports something that's broken
+	TicketTypeIncident
+	// TicketTypeProblem is the cause behind one or more incidents
+	TicketTypeProblem
+	// TicketTypeTask is work to be done
+	TicketTypeTask
+)
+
+func (t TicketType) String() string {
+	switch t {
+	case TicketTypeQuestion:
+		return "Question"
+	case TicketTypeIncident:
+		return "Incident"
+	case TicketTypeProblem:
+		return "Problem"
+	case TicketTypeTask:
+		return "Task"
+	}
+	return "Unset"
+}
+
+// ParseTicketType parses a type's name regardless of case, returning TicketTypeUnknown for anything else.
+func ParseTicketType(s string) TicketType {
+	for t := TicketTypeQuestion; t <= TicketTypeTask; t++ {
+		if strings.EqualFold(s, t.String()) {
+			return t
+		}
+	}
+	return TicketTypeUnknown
+}
+
+// TicketFilter narrows tickets down by their current state, fields left zero matching any ticket.
+type TicketFilter struct {
+	Statuses   []TicketStatus
+	OwnerID    *uint64
+	Priorities []TicketPriority
+	Types      []TicketType
+	// Queue matches tickets filed in the queue, an empty string matching those in none
+	Queue *string
+	Spam  *bool
+	// Tags matches tickets having all of them
+	Tags []string
+	// Fields matches tickets whose custom field by key has the value, or includes it for multiselect fields
+	Fields map[string]string
+}
+
 type Ticket struct {
 	ID          uint64 `eventbus:"id"`
 	Transitions []TicketTransition
@@ -52,12 +187,48 @@ type TicketTransition struct {
 	Status      TicketStatus
 	OwnerID     *uint64
 	Description *string
+	// EmailID is set when the transition was caused by an inbound or outbound email
+	EmailID *uint64
+	// Spam is set when the ticket was marked as spam or not, by the spam filters or an agent
+	Spam *bool
+	// AddTags are the tags added to the ticket, and RemoveTags the ones taken off
+	AddTags    []string
+	RemoveTags []string
+	// Priority is set when the ticket's priority changed
+	Priority TicketPriority
+	// Type is set when the ticket's type changed
+	Type TicketType
+	// SetFields are the custom fields changed, an empty value clearing the field
+	SetFields map[string][]string
+	// Queue is set when the ticket was filed in a queue, or taken out of one with an empty string
+	Queue *string
+	// Resolution explains the status change
+	Resolution *string
+	// Comment is set when a public reply or internal note was added
+	Comment *TicketComment
 }
 
 type TicketMeta struct {
 	Description string
 	Status      TicketStatus
 	OwnerID     *uint64
+	Spam        bool
+	// Tags are the ticket's tags in the order they were added
+	Tags     []string
+	Priority TicketPriority
+	Type     TicketType
+	// Fields are the ticket's custom field values by key, leaving out cleared fields
+	Fields map[string][]string
+	// Queue is the team queue the ticket is filed in, empty for none
+	Queue string
+	// Resolution explains the ticket's latest status change, empty if none was given
+	Resolution string
+	// Comments counts the public replies on the ticket, and Notes the internal notes
+	Comments int
+	Notes    int
+	// LastActivityAt is when the ticket last changed in any way, and LastCommentAt when a reply or note was last added, zero if none was
+	LastActivityAt time.Time
+	LastCommentAt  time.Time
 }
 
 func (t *Ticket) Meta() TicketMeta {
@@ -66,31 +237,101 @@ func (t *Ticket) Meta() TicketMeta {
 		descriptionTimestamp time.Time
 		statusTimestamp      time.Time
 		ownerTimestamp       time.Time
+		spamTimestamp        time.Time
+		priorityTimestamp    time.Time
+		typeTimestamp        time.Time
+		queueTimestamp       time.Time
 	)
+	for _, transition := range t.Timeline() {
+		for _, tag := range transition.AddTags {
+			if !slices.Contains(meta.Tags, tag) {
+				meta.Tags = append(meta.Tags, tag)
+			}
+		}
+		meta.Tags = slices.DeleteFunc(meta.Tags, func(tag string) bool {
+			return slices.Contains(transition.RemoveTags, tag)
+		})
+		for key, value := range transition.SetFields {
+			if meta.Fields == nil {
+				meta.Fields = make(map[string][]string)
+			}
+			if len(value) == 0 {
+				delete(meta.Fields, key)
+				continue
+			}
+			meta.Fields[key] = value
+		}
+	}
+
 	for _, transition := range t.Transitions {
+		if transition.Timestamp.After(meta.LastActivityAt) {
+			meta.LastActivityAt = transition.Timestamp
+		}
+		if transition.Comment != nil {
+			if transition.Comment.IsInternal() {
+				meta.Notes++
+			} else {
+				meta.Comments++
+			}
+			if transition.Timestamp.After(meta.LastCommentAt) {
+				meta.LastCommentAt = transition.Timestamp
+			}
+		}
 		if transition.Description != nil && transition.Timestamp.After(descriptionTimestamp) {
 			meta.Description = *transition.Description
 			descriptionTimestamp = transition.Timestamp
 		}
 		if transition.Status != TicketStatusUnknown && transition.Timestamp.After(statusTimestamp) {
 			meta.Status = transition.Status
+			meta.Resolution = ""
+			if transition.Resolution != nil {
+				meta.Resolution = *transition.Resolution
+			}
 			statusTimestamp = transition.Timestamp
 		}
 		if transition.OwnerID != nil && transition.Timestamp.After(ownerTimestamp) {
 			meta.OwnerID = transition.OwnerID
 			ownerTimestamp = transition.Timestamp
 		}
+		if transition.Spam != nil && transition.Timestamp.After(spamTimestamp) {
+			meta.Spam = *transition.Spam
+			spamTimestamp = transition.Timestamp
+		}
+		if transition.Priority != TicketPriorityUnknown && transition.Timestamp.After(priorityTimestamp) {
+			meta.Priority = transition.Priority
+			priorityTimestamp = transition.Timestamp
+		}
+		if transition.Type != TicketTypeUnknown && transition.Timestamp.After(typeTimestamp) {
+			meta.Type = transition.Type
+			typeTimestamp = transition.Timestamp
+		}
+		if transition.Queue != nil && transition.Timestamp.After(queueTimestamp) {
+			meta.Queue = *transition.Queue
+			queueTimestamp = transition.Timestamp
+		}
 	}
 	return meta
 }
 
+// Timeline returns the ticket's transitions, comments included, oldest first.
+func (t *Ticket) Timeline() []TicketTransition {
+	timeline := slices.Clone(t.Transitions)
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].Timestamp.Before(timeline[j].Timestamp)
+	})
+	return timeline
+}
+
 func NewTicketService(repo TicketRepository, eventDriver EventBusDriver, cacheDriver CacheDriver) *TicketService {
 	cache, _ := NewCache[Ticket]("tickets", cacheDriver)
 	eventBus, _ := NewEventBus[Ticket]("tickets", eventDriver)
+	fields, _ := NewCustomFields(nil)
 	svc := &TicketService{
-		repo:        repo,
-		eventBus:    eventBus,
-		ticketCache: cache,
+		Workflow:     DefaultWorkflow(),
+		CustomFields: fields,
+		repo:         repo,
+		eventBus:     eventBus,
+		ticketCache:  cache,
 	}
 
 	eventBus.Subscribe(nil, []EventType{CreateEvent, UpdateEvent, DeleteEvent}, svc.ObserveTicketEvent)
@@ -99,9 +340,13 @@ func NewTicketService(repo TicketRepository, eventDriver EventBusDriver, cacheDr
 }
 
 type TicketService struct {
-	repo        TicketRepository
-	eventBus    *EventBus[Ticket]
-	ticketCache *Cache[Ticket]
+	// Workflow is enforced on every status change
+	Workflow *Workflow
+	// CustomFields validates the custom field values tickets are given, none being defined by default
+	CustomFields *CustomFields
+	repo         TicketRepository
+	eventBus     *EventBus[Ticket]
+	ticketCache  *Cache[Ticket]
 }
 
 func (s *TicketService) GetTicket(ctx context.Context, ID uint64) (Ticket, error) {
@@ -126,7 +371,103 @@ func (s *TicketService) OpenTicket(ctx context.Context, Description string) (Tic
 	return ticket, nil
 }
 
+// ListTickets returns the tickets matching the filter, oldest first.
+//
+// Tags and custom field values are matched however they're written, an error wrapping ErrUnknownCustomField or ErrInvalidFieldValue being returned for values no ticket can have.
+func (s *TicketService) ListTickets(ctx context.Context, filter TicketFilter) ([]Ticket, error) {
+	filter, err := s.normalizeFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.List(ctx, filter)
+}
+
+// SearchTickets returns a page of the tickets matching the query, matching tags and custom field values like ListTickets.
+//
+// Errors wrap ErrInvalidQuery for sort orders and page sizes that aren't supported, and ErrInvalidCursor for cursors that can't be continued.
+func (s *TicketService) SearchTickets(ctx context.Context, query TicketQuery) (TicketPage, error) {
+	filter, err := s.normalizeFilter(query.TicketFilter)
+	if err != nil {
+		return TicketPage{}, err
+	}
+	query.TicketFilter = filter
+	if !query.Sort.Field.valid() {
+		return TicketPage{}, fmt.Errorf("%w: can't sort by %q", ErrInvalidQuery, query.Sort.Field)
+	}
+	if query.Sort.Field == "" {
+		query.Sort.Field = TicketSortCreated
+	}
+	if query.Limit < 0 || query.Limit > MaxSearchLimit {
+		return TicketPage{}, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, MaxSearchLimit)
+	}
+	if query.Limit == 0 {
+		query.Limit = DefaultSearchLimit
+	}
+	query.Alias = strings.ToLower(strings.TrimSpace(query.Alias))
+	return s.repo.Search(ctx, query)
+}
+
+func (s *TicketService) normalizeFilter(filter TicketFilter) (TicketFilter, error) {
+	filter.Tags = NormalizeTags(filter.Tags)
+	if len(filter.Fields) > 0 {
+		values := make(map[string][]string, len(filter.Fields))
+		for key, value := range filter.Fields {
+			values[key] = []string{value}
+		}
+		normalized, err := s.CustomFields.Normalize(values)
+		if err != nil {
+			return TicketFilter{}, err
+		}
+		filter.Fields = make(map[string]string, len(normalized))
+		for key, value := range normalized {
+			if len(value) == 0 {
+				return TicketFilter{}, fmt.Errorf("%w: %s filter is empty", ErrInvalidFieldValue, key)
+			}
+			filter.Fields[key] = value[0]
+		}
+	}
+	return filter, nil
+}
+
+// maxStatusChecks bounds how often a status change is checked against the workflow when other updates keep changing the status.
+const maxStatusChecks = 3
+
+// UpdateTicket appends a transition to the ticket, returning a WorkflowError if the Workflow doesn't allow its status change,
+// or an error wrapping ErrUnknownCustomField or ErrInvalidFieldValue if CustomFields refuses the values set.
+// A status change is only stored if the ticket is still in the status it was checked from.
 func (s *TicketService) UpdateTicket(ctx context.Context, ID uint64, Params TicketUpdateParameters) (Ticket, error) {
+	if len(Params.SetFields) > 0 {
+		fields, err := s.CustomFields.Normalize(Params.SetFields)
+		if err != nil {
+			return Ticket{}, err
+		}
+		Params.SetFields = fields
+	}
+	if Params.Status == TicketStatusUnknown {
+		return s.update(ctx, ID, Params)
+	}
+
+	// The status is checked again if it changes between checking the workflow and updating the ticket
+	var err error
+	for attempt := 0; attempt < maxStatusChecks; attempt++ {
+		var current, ticket Ticket
+		current, err = s.repo.Find(ctx, ID)
+		if err != nil {
+			return Ticket{}, err
+		}
+		Params.FromStatus = current.Meta().Status
+		if err := s.Workflow.Check(Params.FromStatus, Params); err != nil {
+			return Ticket{}, err
+		}
+		ticket, err = s.update(ctx, ID, Params)
+		if !errors.Is(err, ErrStatusChanged) {
+			return ticket, err
+		}
+	}
+	return Ticket{}, err
+}
+
+func (s *TicketService) update(ctx context.Context, ID uint64, Params TicketUpdateParameters) (Ticket, error) {
 	ticket, err := s.repo.Update(ctx, ID, Params)
 	if err != nil {
 		return Ticket{}, err
@@ -139,6 +480,33 @@ func (s *TicketService) UpdateTicket(ctx context.Context, ID uint64, Params Tick
 	return ticket, nil
 }
 
+// AddComment adds a public reply or internal note to the ticket's timeline, returning an error wrapping ErrInvalidComment if it's invalid.
+func (s *TicketService) AddComment(ctx context.Context, ID uint64, comment TicketComment) (Ticket, error) {
+	if err := comment.Validate(); err != nil {
+		return Ticket{}, err
+	}
+	return s.UpdateTicket(ctx, ID, TicketUpdateParameters{Comment: &comment})
+}
+
+// GetCommentAttachment returns an attachment of one of the ticket's comments including its content, or ErrNotFound if the ticket has no such attachment.
+func (s *TicketService) GetCommentAttachment(ctx context.Context, ticketID uint64, ID uint64) (Attachment, error) {
+	ticket, err := s.GetTicket(ctx, ticketID)
+	if err != nil {
+		return Attachment{}, err
+	}
+	for _, transition := range ticket.Transitions {
+		if transition.Comment == nil {
+			continue
+		}
+		for _, attachment := range transition.Comment.Attachments {
+			if attachment.ID == ID {
+				return s.repo.FindCommentAttachment(ctx, ID)
+			}
+		}
+	}
+	return Attachment{}, ErrNotFound
+}
+
 func (s *TicketService) ObserveTicketEvent(eventType EventType, data Ticket) {
 	ctx := context.Background()
 	ticket, err := s.repo.Find(ctx, data.ID)
@@ -2,6 +2,8 @@ package domain_test
 
 import (
 	"context"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -32,6 +34,29 @@ func TestTicketMeta(t *testing.T) {
 			Description: ptr.To("Test 2"),
 			OwnerID:     ptr.To(uint64(100)),
 		},
+		{
+			Timestamp: time.Now().Add(-3 * 24 * time.Hour),
+			Spam:      ptr.To(true),
+		},
+		{
+			Timestamp: time.Now().Add(-3 * time.Hour),
+			Spam:      ptr.To(false),
+			AddTags:   []string{"urgent", "billing"},
+			Priority:  domain.TicketPriorityLow,
+		},
+		{
+			Timestamp: time.Now().Add(-2 * time.Hour),
+			Queue:     ptr.To(""),
+		},
+		{
+			Timestamp: time.Now().Add(-4 * time.Hour),
+			Priority:  domain.TicketPriorityUrgent,
+			Queue:     ptr.To("sales"),
+		},
+		{
+			Timestamp: time.Now().Add(-5 * 24 * time.Hour),
+			AddTags:   []string{"billing"},
+		},
 	}
 
 	ticket := domain.Ticket{
@@ -45,6 +70,63 @@ func TestTicketMeta(t *testing.T) {
 	assert.NotNil(t, meta.OwnerID, "Missing Owner ID")
 	assert.Equal(t, uint64(99), *meta.OwnerID, "Wrong Owner ID")
 	assert.Equal(t, "Test 2", meta.Description, "Wrong Description")
+	assert.False(t, meta.Spam, "Wrong spam flag")
+	assert.Equal(t, []string{"billing", "urgent"}, meta.Tags, "Tags should be distinct, in the order they were added")
+	assert.Equal(t, domain.TicketPriorityLow, meta.Priority, "Wrong priority")
+	assert.Empty(t, meta.Queue, "Ticket should have been taken out of the queue")
+}
+
+func TestTicketComments(t *testing.T) {
+	now := time.Now()
+	ticket := domain.Ticket{
+		ID: 1,
+		Transitions: []domain.TicketTransition{
+			{Timestamp: now.Add(-3 * time.Hour), Status: domain.TicketStatusOpen, Description: ptr.To("Printer on fire")},
+			{Timestamp: now.Add(-1 * time.Hour), Comment: &domain.TicketComment{ID: 2, AuthorID: 1, Body: "Called the fire brigade", Visibility: domain.CommentVisibilityInternal}},
+			{Timestamp: now.Add(-2 * time.Hour), Comment: &domain.TicketComment{ID: 1, AuthorID: 1, Body: "Have you tried water?", Visibility: domain.CommentVisibilityPublic}},
+			{Timestamp: now.Add(-30 * time.Minute), Status: domain.TicketStatusInProgress},
+		},
+	}
+
+	meta := ticket.Meta()
+	assert.Equal(t, 1, meta.Comments, "Wrong number of public replies")
+	assert.Equal(t, 1, meta.Notes, "Wrong number of internal notes")
+	assert.Equal(t, now.Add(-1*time.Hour), meta.LastCommentAt, "Wrong last comment time")
+	assert.Equal(t, now.Add(-30*time.Minute), meta.LastActivityAt, "Wrong last activity time")
+
+	timeline := ticket.Timeline()
+	if assert.Len(t, timeline, 4) {
+		assert.Equal(t, "Printer on fire", *timeline[0].Description, "timeline should be oldest first")
+		assert.Equal(t, uint64(1), timeline[1].Comment.ID, "timeline should be oldest first")
+		assert.Equal(t, uint64(2), timeline[2].Comment.ID, "timeline should be oldest first")
+	}
+	assert.Equal(t, uint64(2), ticket.Transitions[1].Comment.ID, "Timeline should leave the transitions alone")
+
+	assert.Empty(t, (&domain.Ticket{}).Meta().LastCommentAt, "a ticket without comments has no last comment time")
+}
+
+func TestTicketMetaFields(t *testing.T) {
+	now := time.Now()
+	ticket := domain.Ticket{
+		ID: 1,
+		Transitions: []domain.TicketTransition{
+			{Timestamp: now.Add(-4 * time.Hour), Status: domain.TicketStatusOpen, AddTags: []string{"billing", "vip", "refund"}, Type: domain.TicketTypeQuestion},
+			{Timestamp: now.Add(-1 * time.Hour), AddTags: []string{"billing"}, SetFields: map[string][]string{"seats": {}}},
+			{Timestamp: now.Add(-3 * time.Hour), RemoveTags: []string{"billing", "refund"}, Type: domain.TicketTypeIncident, SetFields: map[string][]string{"seats": {"25"}, "product_area": {"API"}}},
+			{Timestamp: now.Add(-2 * time.Hour), SetFields: map[string][]string{"product_area": {"Billing"}}},
+		},
+	}
+
+	meta := ticket.Meta()
+	assert.Equal(t, []string{"vip", "billing"}, meta.Tags, "removed tags should be added back in the order they were")
+	assert.Equal(t, domain.TicketTypeIncident, meta.Type, "Wrong type")
+	assert.Equal(t, map[string][]string{"product_area": {"Billing"}}, meta.Fields, "cleared fields should be left out")
+	assert.Nil(t, (&domain.Ticket{}).Meta().Fields)
+}
+
+func TestNormalizeTags(t *testing.T) {
+	assert.Equal(t, []string{"billing", "vip"}, domain.NormalizeTags([]string{" Billing", "", "VIP", "billing"}))
+	assert.Empty(t, domain.NormalizeTags(nil))
 }
 
 func TestGetTicket(t *testing.T) {
@@ -97,6 +179,49 @@ func TestUpdateTicket(t *testing.T) {
 	assert.Equal(t, uint64(99), *meta.OwnerID, "ticket should have owner id provided")
 }
 
+func TestUpdateTicketFields(t *testing.T) {
+	fieldsRepo := mockTicketRepo{transitions: map[uint64][]domain.TicketTransition{
+		1: {{Timestamp: time.Now().Add(-1 * time.Hour), Status: domain.TicketStatusOpen}},
+	}}
+	svc := domain.NewTicketService(&fieldsRepo, &mockEventBusDriver{}, &mockCacheDriver{cache: map[string]interface{}{}})
+
+	_, err := svc.UpdateTicket(context.Background(), 1, domain.TicketUpdateParameters{SetFields: map[string][]string{"seats": {"25"}}})
+	assert.ErrorIs(t, err, domain.ErrUnknownCustomField, "no fields should be defined by default")
+
+	svc.CustomFields = testCustomFields(t)
+	_, err = svc.UpdateTicket(context.Background(), 1, domain.TicketUpdateParameters{SetFields: map[string][]string{"seats": {"many"}}})
+	assert.ErrorIs(t, err, domain.ErrInvalidFieldValue)
+	assert.Len(t, fieldsRepo.transitions[1], 1, "invalid values shouldn't be stored")
+
+	ticket, err := svc.UpdateTicket(context.Background(), 1, domain.TicketUpdateParameters{
+		Type:      domain.TicketTypeTask,
+		Priority:  domain.TicketPriorityHigh,
+		SetFields: map[string][]string{"seats": {"25.00"}, "product_area": {"api"}},
+	})
+	assert.NoError(t, err)
+	meta := ticket.Meta()
+	assert.Equal(t, domain.TicketTypeTask, meta.Type)
+	assert.Equal(t, domain.TicketPriorityHigh, meta.Priority)
+	assert.Equal(t, map[string][]string{"seats": {"25"}, "product_area": {"API"}}, meta.Fields, "values should be stored normalized")
+
+	t.Run("ListTickets", func(t *testing.T) {
+		tickets, err := svc.ListTickets(context.Background(), domain.TicketFilter{
+			Types:  []domain.TicketType{domain.TicketTypeTask},
+			Tags:   []string{" VIP"},
+			Fields: map[string]string{"product_area": "API", "seats": "25.0"},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, tickets, 1)
+		assert.Equal(t, []string{"vip"}, fieldsRepo.filter.Tags, "tags should be matched however they're written")
+		assert.Equal(t, map[string]string{"product_area": "API", "seats": "25"}, fieldsRepo.filter.Fields, "values should be matched however they're written")
+
+		_, err = svc.ListTickets(context.Background(), domain.TicketFilter{Fields: map[string]string{"product_area": "Hardware"}})
+		assert.ErrorIs(t, err, domain.ErrInvalidFieldValue)
+		_, err = svc.ListTickets(context.Background(), domain.TicketFilter{Fields: map[string]string{"seats": ""}})
+		assert.ErrorIs(t, err, domain.ErrInvalidFieldValue)
+	})
+}
+
 func TestTicketObserver(t *testing.T) {
 	eventDrv := mockEventBusDriver{}
 	svc := domain.NewTicketService(&repo, &eventDrv, mockCache)
@@ -108,6 +233,61 @@ func TestTicketObserver(t *testing.T) {
 	})
 }
 
+func TestAddComment(t *testing.T) {
+	commentRepo := mockTicketRepo{
+		transitions: map[uint64][]domain.TicketTransition{
+			1: {{Timestamp: time.Now().Add(-1 * time.Hour), Status: domain.TicketStatusOpen}},
+			2: {{Timestamp: time.Now().Add(-1 * time.Hour), Status: domain.TicketStatusOpen}},
+		},
+	}
+	eventDrv := mockEventBusDriver{}
+	svc := domain.NewTicketService(&commentRepo, &eventDrv, &mockCacheDriver{cache: map[string]interface{}{}})
+
+	table := []struct {
+		name    string
+		comment domain.TicketComment
+		err     error
+	}{
+		{name: "NoAuthor", comment: domain.TicketComment{Body: "Hi", Visibility: domain.CommentVisibilityPublic}, err: domain.ErrInvalidComment},
+		{name: "NoVisibility", comment: domain.TicketComment{AuthorID: 1, Body: "Hi"}, err: domain.ErrInvalidComment},
+		{name: "Empty", comment: domain.TicketComment{AuthorID: 1, Body: " ", Visibility: domain.CommentVisibilityPublic}, err: domain.ErrInvalidComment},
+		{name: "AttachmentWithoutFilename", comment: domain.TicketComment{AuthorID: 1, Visibility: domain.CommentVisibilityPublic, Attachments: []domain.Attachment{{ContentType: "text/plain"}}}, err: domain.ErrInvalidComment},
+		{name: "Reply", comment: domain.TicketComment{AuthorID: 1, Body: "Hi", Visibility: domain.CommentVisibilityPublic}},
+		{name: "NoteWithAttachmentOnly", comment: domain.TicketComment{AuthorID: 1, Visibility: domain.CommentVisibilityInternal, Attachments: []domain.Attachment{{ID: 7, Filename: "log.txt", Content: []byte("boom")}}}},
+	}
+
+	for _, tc := range table {
+		t.Run(tc.name, func(t *testing.T) {
+			ticket, err := svc.AddComment(context.Background(), 1, tc.comment)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			last := ticket.Transitions[len(ticket.Transitions)-1]
+			assert.Equal(t, &tc.comment, last.Comment, "the comment should be added by a transition")
+			assert.Equal(t, "tickets:1:update", *eventDrv.EventSubject, "adding a comment should publish an update")
+		})
+	}
+
+	t.Run("GetCommentAttachment", func(t *testing.T) {
+		attachment, err := svc.GetCommentAttachment(context.Background(), 1, 7)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("boom"), attachment.Content)
+
+		_, err = svc.GetCommentAttachment(context.Background(), 2, 7)
+		assert.ErrorIs(t, err, domain.ErrNotFound, "attachments of other tickets should not be found")
+	})
+}
+
+func TestCommentVisibilityStrings(t *testing.T) {
+	assert.Equal(t, "Public", domain.CommentVisibilityPublic.String())
+	assert.Equal(t, "Internal", domain.CommentVisibilityInternal.String())
+	assert.Equal(t, "Unset", domain.CommentVisibilityUnknown.String())
+	assert.Equal(t, domain.CommentVisibilityInternal, domain.ParseCommentVisibility("internal"))
+	assert.Equal(t, domain.CommentVisibilityUnknown, domain.ParseCommentVisibility("secret"))
+}
+
 func TestTicketStatusStrings(t *testing.T) {
 	table := []struct {
 		status      domain.TicketStatus
@@ -121,8 +301,8 @@ func TestTicketStatusStrings(t *testing.T) {
 		},
 		{
 			status:      99,
-			expect:      "Unset",
-			description: "TicketStatusOpenString",
+			expect:      "Status 99",
+			description: "TicketStatusCustomString",
 		},
 		{
 			status:      domain.TicketStatusOpen,
@@ -154,8 +334,62 @@ func TestTicketStatusStrings(t *testing.T) {
 	}
 }
 
+func TestTicketPriorityStrings(t *testing.T) {
+	table := []struct {
+		priority domain.TicketPriority
+		expect   string
+	}{
+		{priority: domain.TicketPriorityUnknown, expect: "Unset"},
+		{priority: 99, expect: "Unset"},
+		{priority: domain.TicketPriorityLow, expect: "Low"},
+		{priority: domain.TicketPriorityNormal, expect: "Normal"},
+		{priority: domain.TicketPriorityHigh, expect: "High"},
+		{priority: domain.TicketPriorityUrgent, expect: "Urgent"},
+	}
+
+	for _, tc := range table {
+		t.Run(tc.expect, func(t *testing.T) {
+			assert.Equal(t, tc.expect, tc.priority.String())
+			if tc.priority >= domain.TicketPriorityLow && tc.priority <= domain.TicketPriorityUrgent {
+				assert.Equal(t, tc.priority, domain.ParseTicketPriority(strings.ToLower(tc.expect)), "names should parse regardless of case")
+			}
+		})
+	}
+	assert.Equal(t, domain.TicketPriorityUnknown, domain.ParseTicketPriority("Unset"))
+	assert.Equal(t, domain.TicketPriorityUnknown, domain.ParseTicketPriority("whenever"))
+}
+
+func TestTicketTypeStrings(t *testing.T) {
+	table := []struct {
+		ticketType domain.TicketType
+		expect     string
+	}{
+		{ticketType: domain.TicketTypeUnknown, expect: "Unset"},
+		{ticketType: domain.TicketTypeQuestion, expect: "Question"},
+		{ticketType: domain.TicketTypeIncident, expect: "Incident"},
+		{ticketType: domain.TicketTypeProblem, expect: "Problem"},
+		{ticketType: domain.TicketTypeTask, expect: "Task"},
+	}
+
+	for _, tc := range table {
+		t.Run(tc.expect, func(t *testing.T) {
+			assert.Equal(t, tc.expect, tc.ticketType.String())
+			if tc.ticketType != domain.TicketTypeUnknown {
+				assert.Equal(t, tc.ticketType, domain.ParseTicketType(strings.ToUpper(tc.expect)), "names should parse regardless of case")
+			}
+		})
+	}
+	assert.Equal(t, domain.TicketTypeUnknown, domain.ParseTicketType("Unset"))
+}
+
 type mockTicketRepo struct {
 	transitions map[uint64][]domain.TicketTransition
+	// filter is the last filter tickets were listed by
+	filter domain.TicketFilter
+	// query is the last query tickets were searched by
+	query domain.TicketQuery
+	// beforeUpdate runs before each update, standing in for another update racing it
+	beforeUpdate func(ID uint64)
 }
 
 func (m *mockTicketRepo) Find(ctx context.Context, ID uint64) (domain.Ticket, error) {
@@ -188,11 +422,28 @@ func (m *mockTicketRepo) Open(ctx context.Context, Description string) (domain.T
 }
 
 func (m *mockTicketRepo) Update(ctx context.Context, ID uint64, Params domain.TicketUpdateParameters) (domain.Ticket, error) {
+	if m.beforeUpdate != nil {
+		m.beforeUpdate(ID)
+	}
+	if Params.FromStatus != domain.TicketStatusUnknown {
+		current := domain.Ticket{Transitions: m.transitions[ID]}
+		if current.Meta().Status != Params.FromStatus {
+			return domain.Ticket{}, domain.ErrStatusChanged
+		}
+	}
 	m.transitions[ID] = append(m.transitions[ID], domain.TicketTransition{
 		Timestamp:   time.Now(),
 		Status:      Params.Status,
 		Description: Params.Description,
 		OwnerID:     Params.OwnerID,
+		EmailID:     Params.EmailID,
+		Resolution:  Params.Resolution,
+		Comment:     Params.Comment,
+		AddTags:     Params.AddTags,
+		RemoveTags:  Params.RemoveTags,
+		Priority:    Params.Priority,
+		Type:        Params.Type,
+		SetFields:   Params.SetFields,
 	})
 
 	return domain.Ticket{
@@ -201,6 +452,48 @@ func (m *mockTicketRepo) Update(ctx context.Context, ID uint64, Params domain.Ti
 	}, nil
 }
 
+func (m *mockTicketRepo) FindCommentAttachment(ctx context.Context, ID uint64) (domain.Attachment, error) {
+	for _, transitions := range m.transitions {
+		for _, transition := range transitions {
+			if transition.Comment == nil {
+				continue
+			}
+			for _, attachment := range transition.Comment.Attachments {
+				if attachment.ID == ID {
+					return attachment, nil
+				}
+			}
+		}
+	}
+	return domain.Attachment{}, domain.ErrNotFound
+}
+
+// List only filters by type, which is enough to tell the filter was passed on.
+func (m *mockTicketRepo) List(ctx context.Context, filter domain.TicketFilter) ([]domain.Ticket, error) {
+	m.filter = filter
+	IDs := make([]uint64, 0, len(m.transitions))
+	for ID := range m.transitions {
+		IDs = append(IDs, ID)
+	}
+	slices.Sort(IDs)
+
+	tickets := []domain.Ticket{}
+	for _, ID := range IDs {
+		ticket := domain.Ticket{ID: ID, Transitions: m.transitions[ID]}
+		if len(filter.Types) == 0 || slices.Contains(filter.Types, ticket.Meta().Type) {
+			tickets = append(tickets, ticket)
+		}
+	}
+	return tickets, nil
+}
+
+// Search only records the query, returning a page of every ticket.
+func (m *mockTicketRepo) Search(ctx context.Context, query domain.TicketQuery) (domain.TicketPage, error) {
+	m.query = query
+	tickets, err := m.List(ctx, domain.TicketFilter{})
+	return domain.TicketPage{Tickets: tickets}, err
+}
+
 var repo = mockTicketRepo{
 	transitions: map[uint64][]domain.TicketTransition{
 		3: {
@@ -19,6 +19,8 @@ type User struct {
 
 	FirstName string
 	LastName  string
+	// Admin users manage mail domains, DKIM keys and the quarantine
+	Admin bool
 }
 
 func NewUserService(repo UserRepository, eventBusDriver EventBusDriver) *UserService {
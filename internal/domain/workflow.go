@@ -0,0 +1,202 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrInvalidWorkflow      = errors.New("invalid workflow")
+	ErrUnknownStatus        = errors.New("unknown ticket status")
+	ErrTransitionNotAllowed = errors.New("status change not allowed")
+	ErrFieldRequired        = errors.New("field required")
+	ErrStatusChanged        = errors.New("ticket status changed")
+)
+
+// TicketField is a field a workflow transition can require the update to set.
+type TicketField string
+
+const (
+	// TicketFieldResolution requires a resolution explaining the status change, such as why the ticket was closed
+	TicketFieldResolution TicketField = "resolution"
+	// TicketFieldOwner requires the ticket to be assigned with the status change
+	TicketFieldOwner TicketField = "owner"
+)
+
+// WorkflowStatus names a status tickets can be in.
+type WorkflowStatus struct {
+	Status TicketStatus
+	Name   string
+}
+
+// WorkflowTransition allows tickets to move to a status, provided the update sets the required fields.
+type WorkflowTransition struct {
+	// From is the statuses the ticket can move from, empty for any
+	From    []TicketStatus
+	To      TicketStatus
+	Require []TicketField
+}
+
+// WorkflowError explains why the workflow refused a status change. It wraps ErrUnknownStatus, ErrTransitionNotAllowed or ErrFieldRequired.
+type WorkflowError struct {
+	From TicketStatus
+	To   TicketStatus
+	// Field is the field the transition requires, for ErrFieldRequired
+	Field TicketField
+	Err   error
+	// fromName and toName are the statuses' names in the workflow
+	fromName string
+	toName   string
+}
+
+func (e *WorkflowError) Error() string {
+	switch {
+	case errors.Is(e.Err, ErrUnknownStatus):
+		return fmt.Sprintf("%s %d", e.Err, e.To)
+	case errors.Is(e.Err, ErrFieldRequired):
+		return fmt.Sprintf("%s is required to move from %s to %s", e.Field, e.fromName, e.toName)
+	}
+	return fmt.Sprintf("%s: %s to %s", e.Err, e.fromName, e.toName)
+}
+
+func (e *WorkflowError) Unwrap() error {
+	return e.Err
+}
+
+// Workflow is the statuses tickets move through and the status changes allowed between them.
+//
+// Open, In Progress, Blocked and Closed are always part of it, new tickets being opened as Open.
+type Workflow struct {
+	statuses    []WorkflowStatus
+	transitions []WorkflowTransition
+}
+
+// DefaultWorkflow has the built-in statuses and allows any change between them.
+func DefaultWorkflow() *Workflow {
+	w, _ := NewWorkflow(nil, nil)
+	return w
+}
+
+// NewWorkflow adds the custom statuses to the built-in ones, and restricts status changes to the transitions.
+// Without transitions any status change is allowed.
+//
+// Custom statuses are stored by number, so they must be numbered above TicketStatusClosed and never renumbered.
+func NewWorkflow(custom []WorkflowStatus, transitions []WorkflowTransition) (*Workflow, error) {
+	w := &Workflow{}
+	for s := TicketStatusOpen; s <= TicketStatusClosed; s++ {
+		w.statuses = append(w.statuses, WorkflowStatus{Status: s, Name: s.String()})
+	}
+
+	for _, status := range custom {
+		status.Name = strings.TrimSpace(status.Name)
+		if status.Status <= TicketStatusClosed {
+			return nil, fmt.Errorf("%w: status %q must be numbered above %d", ErrInvalidWorkflow, status.Name, TicketStatusClosed)
+		}
+		if status.Name == "" {
+			return nil, fmt.Errorf("%w: status %d has no name", ErrInvalidWorkflow, status.Status)
+		}
+		if w.known(status.Status) {
+			return nil, fmt.Errorf("%w: status %d is defined twice", ErrInvalidWorkflow, status.Status)
+		}
+		if _, ok := w.ParseStatus(status.Name); ok {
+			return nil, fmt.Errorf("%w: status name %q is used twice", ErrInvalidWorkflow, status.Name)
+		}
+		w.statuses = append(w.statuses, status)
+	}
+
+	for _, transition := range transitions {
+		if !w.known(transition.To) {
+			return nil, fmt.Errorf("%w: transition to unknown status %d", ErrInvalidWorkflow, transition.To)
+		}
+		for _, from := range transition.From {
+			if !w.known(from) {
+				return nil, fmt.Errorf("%w: transition from unknown status %d", ErrInvalidWorkflow, from)
+			}
+		}
+		for _, field := range transition.Require {
+			if field != TicketFieldResolution && field != TicketFieldOwner {
+				return nil, fmt.Errorf("%w: transition to %s requires unknown field %q", ErrInvalidWorkflow, w.StatusName(transition.To), field)
+			}
+		}
+		w.transitions = append(w.transitions, WorkflowTransition{
+			From:    slices.Clone(transition.From),
+			To:      transition.To,
+			Require: slices.Clone(transition.Require),
+		})
+	}
+
+	return w, nil
+}
+
+// Statuses returns the workflow's statuses, the built-in ones first.
+func (w *Workflow) Statuses() []WorkflowStatus {
+	return slices.Clone(w.statuses)
+}
+
+// Transitions returns the status changes allowed, empty if any is.
+func (w *Workflow) Transitions() []WorkflowTransition {
+	return slices.Clone(w.transitions)
+}
+
+// StatusName returns the name of a status in the workflow.
+func (w *Workflow) StatusName(status TicketStatus) string {
+	for _, s := range w.statuses {
+		if s.Status == status {
+			return s.Name
+		}
+	}
+	return status.String()
+}
+
+// ParseStatus parses a status's name regardless of case.
+func (w *Workflow) ParseStatus(name string) (TicketStatus, bool) {
+	name = strings.TrimSpace(name)
+	for _, s := range w.statuses {
+		if strings.EqualFold(s.Name, name) {
+			return s.Status, true
+		}
+	}
+	return TicketStatusUnknown, false
+}
+
+// Check returns a WorkflowError if the update would change the ticket's status in a way the workflow doesn't allow.
+//
+// Updates leaving the status alone are always allowed. Where several transitions match, the first one applies.
+func (w *Workflow) Check(from TicketStatus, params TicketUpdateParameters) error {
+	to := params.Status
+	if to == TicketStatusUnknown || to == from {
+		return nil
+	}
+	workflowErr := func(err error, field TicketField) error {
+		return &WorkflowError{From: from, To: to, Field: field, Err: err, fromName: w.StatusName(from), toName: w.StatusName(to)}
+	}
+	if !w.known(to) {
+		return workflowErr(ErrUnknownStatus, "")
+	}
+	if len(w.transitions) == 0 {
+		return nil
+	}
+
+	for _, transition := range w.transitions {
+		if transition.To != to || (len(transition.From) > 0 && !slices.Contains(transition.From, from)) {
+			continue
+		}
+		for _, field := range transition.Require {
+			if field == TicketFieldResolution && (params.Resolution == nil || strings.TrimSpace(*params.Resolution) == "") {
+				return workflowErr(ErrFieldRequired, field)
+			}
+			if field == TicketFieldOwner && params.OwnerID == nil {
+				return workflowErr(ErrFieldRequired, field)
+			}
+		}
+		return nil
+	}
+
+	return workflowErr(ErrTransitionNotAllowed, "")
+}
+
+func (w *Workflow) known(status TicketStatus) bool {
+	return slices.ContainsFunc(w.statuses, func(s WorkflowStatus) bool { return s.Status == status })
+}
@@ -0,0 +1,155 @@
+package domain_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+const ticketStatusWaiting domain.TicketStatus = 10
+
+func testWorkflow(t *testing.T) *domain.Workflow {
+	workflow, err := domain.NewWorkflow(
+		[]domain.WorkflowStatus{{Status: ticketStatusWaiting, Name: "Waiting on customer"}},
+		[]domain.WorkflowTransition{
+			{From: []domain.TicketStatus{domain.TicketStatusOpen}, To: domain.TicketStatusInProgress, Require: []domain.TicketField{domain.TicketFieldOwner}},
+			{From: []domain.TicketStatus{domain.TicketStatusInProgress}, To: ticketStatusWaiting},
+			{From: []domain.TicketStatus{ticketStatusWaiting, domain.TicketStatusClosed}, To: domain.TicketStatusOpen},
+			{To: domain.TicketStatusClosed, Require: []domain.TicketField{domain.TicketFieldResolution}},
+		},
+	)
+	require.NoError(t, err)
+	return workflow
+}
+
+func TestNewWorkflow(t *testing.T) {
+	workflow := testWorkflow(t)
+	assert.Equal(t, []domain.WorkflowStatus{
+		{Status: domain.TicketStatusOpen, Name: "Open"},
+		{Status: domain.TicketStatusInProgress, Name: "In Progress"},
+		{Status: domain.TicketStatusBlocked, Name: "Blocked"},
+		{Status: domain.TicketStatusClosed, Name: "Closed"},
+		{Status: ticketStatusWaiting, Name: "Waiting on customer"},
+	}, workflow.Statuses(), "custom statuses should follow the built-in ones")
+	assert.Len(t, workflow.Transitions(), 4)
+
+	status, ok := workflow.ParseStatus(" waiting ON customer")
+	assert.True(t, ok, "statuses should parse regardless of case")
+	assert.Equal(t, ticketStatusWaiting, status)
+	_, ok = workflow.ParseStatus("Unset")
+	assert.False(t, ok)
+	assert.Equal(t, "Waiting on customer", workflow.StatusName(ticketStatusWaiting))
+	assert.Equal(t, "In Progress", workflow.StatusName(domain.TicketStatusInProgress))
+
+	table := []struct {
+		name        string
+		statuses    []domain.WorkflowStatus
+		transitions []domain.WorkflowTransition
+	}{
+		{name: "BuiltinNumber", statuses: []domain.WorkflowStatus{{Status: domain.TicketStatusClosed, Name: "Done"}}},
+		{name: "NoName", statuses: []domain.WorkflowStatus{{Status: 5, Name: " "}}},
+		{name: "DuplicateNumber", statuses: []domain.WorkflowStatus{{Status: 5, Name: "Waiting"}, {Status: 5, Name: "Pending"}}},
+		{name: "DuplicateName", statuses: []domain.WorkflowStatus{{Status: 5, Name: "closed"}}},
+		{name: "UnknownTo", transitions: []domain.WorkflowTransition{{To: 5}}},
+		{name: "UnknownFrom", transitions: []domain.WorkflowTransition{{From: []domain.TicketStatus{domain.TicketStatusUnknown}, To: domain.TicketStatusOpen}}},
+		{name: "UnknownField", transitions: []domain.WorkflowTransition{{To: domain.TicketStatusClosed, Require: []domain.TicketField{"reason"}}}},
+	}
+	for _, tc := range table {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := domain.NewWorkflow(tc.statuses, tc.transitions)
+			assert.ErrorIs(t, err, domain.ErrInvalidWorkflow)
+		})
+	}
+}
+
+func TestWorkflowCheck(t *testing.T) {
+	workflow := testWorkflow(t)
+	table := []struct {
+		name      string
+		from      domain.TicketStatus
+		params    domain.TicketUpdateParameters
+		expectErr error
+		field     domain.TicketField
+	}{
+		{name: "NoStatusChange", from: domain.TicketStatusOpen, params: domain.TicketUpdateParameters{Description: ptr.To("test")}},
+		{name: "SameStatus", from: domain.TicketStatusBlocked, params: domain.TicketUpdateParameters{Status: domain.TicketStatusBlocked}},
+		{name: "Allowed", from: domain.TicketStatusInProgress, params: domain.TicketUpdateParameters{Status: ticketStatusWaiting}},
+		{name: "AllowedWithField", from: domain.TicketStatusOpen, params: domain.TicketUpdateParameters{Status: domain.TicketStatusInProgress, OwnerID: ptr.To(uint64(1))}},
+		{name: "AnyFrom", from: ticketStatusWaiting, params: domain.TicketUpdateParameters{Status: domain.TicketStatusClosed, Resolution: ptr.To("Fixed")}},
+		{name: "NotAllowed", from: domain.TicketStatusClosed, params: domain.TicketUpdateParameters{Status: domain.TicketStatusInProgress}, expectErr: domain.ErrTransitionNotAllowed},
+		{name: "NoTransitionTo", from: domain.TicketStatusOpen, params: domain.TicketUpdateParameters{Status: domain.TicketStatusBlocked}, expectErr: domain.ErrTransitionNotAllowed},
+		{name: "MissingOwner", from: domain.TicketStatusOpen, params: domain.TicketUpdateParameters{Status: domain.TicketStatusInProgress}, expectErr: domain.ErrFieldRequired, field: domain.TicketFieldOwner},
+		{name: "BlankResolution", from: domain.TicketStatusOpen, params: domain.TicketUpdateParameters{Status: domain.TicketStatusClosed, Resolution: ptr.To(" ")}, expectErr: domain.ErrFieldRequired, field: domain.TicketFieldResolution},
+		{name: "UnknownStatus", from: domain.TicketStatusOpen, params: domain.TicketUpdateParameters{Status: 99}, expectErr: domain.ErrUnknownStatus},
+	}
+	for _, tc := range table {
+		t.Run(tc.name, func(t *testing.T) {
+			err := workflow.Check(tc.from, tc.params)
+			if tc.expectErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tc.expectErr)
+			var workflowErr *domain.WorkflowError
+			require.ErrorAs(t, err, &workflowErr, "workflow errors should be typed")
+			assert.Equal(t, tc.from, workflowErr.From)
+			assert.Equal(t, tc.params.Status, workflowErr.To)
+			assert.Equal(t, tc.field, workflowErr.Field)
+		})
+	}
+
+	err := workflow.Check(domain.TicketStatusOpen, domain.TicketUpdateParameters{Status: domain.TicketStatusClosed})
+	assert.EqualError(t, err, "resolution is required to move from Open to Closed")
+	err = workflow.Check(domain.TicketStatusClosed, domain.TicketUpdateParameters{Status: ticketStatusWaiting})
+	assert.EqualError(t, err, "status change not allowed: Closed to Waiting on customer")
+
+	assert.NoError(t, domain.DefaultWorkflow().Check(domain.TicketStatusClosed, domain.TicketUpdateParameters{Status: domain.TicketStatusBlocked}), "the default workflow should allow any status change")
+	assert.ErrorIs(t, domain.DefaultWorkflow().Check(domain.TicketStatusClosed, domain.TicketUpdateParameters{Status: ticketStatusWaiting}), domain.ErrUnknownStatus)
+}
+
+func TestUpdateTicketWorkflow(t *testing.T) {
+	eventDrv := mockEventBusDriver{}
+	svc := domain.NewTicketService(&repo, &eventDrv, mockCache)
+	svc.Workflow = testWorkflow(t)
+	ticket, err := svc.OpenTicket(context.Background(), "workflow")
+	require.NoError(t, err)
+	eventDrv.Reset()
+
+	_, err = svc.UpdateTicket(context.Background(), ticket.ID, domain.TicketUpdateParameters{Status: domain.TicketStatusBlocked})
+	assert.ErrorIs(t, err, domain.ErrTransitionNotAllowed)
+	assert.Nil(t, eventDrv.EventSubject, "refused updates shouldn't be published")
+	assert.Len(t, repo.transitions[ticket.ID], 1, "refused updates shouldn't be stored")
+
+	updated, err := svc.UpdateTicket(context.Background(), ticket.ID, domain.TicketUpdateParameters{Status: domain.TicketStatusClosed, Resolution: ptr.To("Duplicate")})
+	assert.NoError(t, err)
+	meta := updated.Meta()
+	assert.Equal(t, domain.TicketStatusClosed, meta.Status)
+	assert.Equal(t, "Duplicate", meta.Resolution)
+
+	_, err = svc.UpdateTicket(context.Background(), ticket.ID+1000, domain.TicketUpdateParameters{Status: domain.TicketStatusClosed})
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+func TestUpdateTicketWorkflowRace(t *testing.T) {
+	eventDrv := mockEventBusDriver{}
+	svc := domain.NewTicketService(&repo, &eventDrv, mockCache)
+	svc.Workflow = testWorkflow(t)
+	ticket, err := svc.OpenTicket(context.Background(), "workflow race")
+	require.NoError(t, err)
+
+	// Another update closes the ticket after the workflow allowed moving it from Open
+	repo.beforeUpdate = func(ID uint64) {
+		repo.beforeUpdate = nil
+		repo.transitions[ID] = append(repo.transitions[ID], domain.TicketTransition{Timestamp: time.Now(), Status: domain.TicketStatusClosed, Resolution: ptr.To("Fixed")})
+	}
+	defer func() { repo.beforeUpdate = nil }()
+
+	_, err = svc.UpdateTicket(context.Background(), ticket.ID, domain.TicketUpdateParameters{Status: domain.TicketStatusInProgress, OwnerID: ptr.To[uint64](1)})
+	assert.ErrorIs(t, err, domain.ErrTransitionNotAllowed, "the status change should be checked again from the new status")
+	assert.Len(t, repo.transitions[ticket.ID], 2, "the status change shouldn't be stored")
+}
@@ -97,6 +97,20 @@ func input(params inputParams) templ.Component {
 				return err
 			}
 		}
+		if params.Value != "" {
+			_, err = templBuffer.WriteString(" value=\"")
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString(templ.EscapeString(params.Value))
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString("\"")
+			if err != nil {
+				return err
+			}
+		}
 		if params.Required {
 			_, err = templBuffer.WriteString(" required")
 			if err != nil {
@@ -1,9 +1,50 @@
 package components
 
+import "time"
+
 type inputParams struct {
 	ID          string
 	Label       string
 	Placeholder string
 	Required    bool
 	Type        string
+	Value       string
+}
+
+// QuarantinedEmail is inbound email held in quarantine, as admins review it
+type QuarantinedEmail struct {
+	ID         uint64
+	From       string
+	Subject    string
+	Body       string
+	Reason     string
+	Detail     string
+	Recipients []string
+	// QuarantinedAt and ExpiresAt are shown to the admin, ExpiresAt being when the email is deleted unless it's released
+	QuarantinedAt time.Time
+	ExpiresAt     time.Time
+}
+
+// TicketResult is a ticket matching a search, as agents skim it
+type TicketResult struct {
+	ID          uint64
+	Description string
+	Status      string
+	// Priority is empty for tickets without one
+	Priority  string
+	Tags      []string
+	UpdatedAt time.Time
+	// Snippets are where the text searched for was found
+	Snippets []TicketSnippet
+}
+
+type TicketSnippet struct {
+	// Source labels where the text comes from, such as "Comment"
+	Source    string
+	Fragments []SnippetFragment
+}
+
+type SnippetFragment struct {
+	Text        string
+	Highlighted bool
 }
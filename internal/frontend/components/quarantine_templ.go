@@ -0,0 +1,438 @@
+// Code generated by templ@v0.2.334 DO NOT EDIT.
+
+package components
+
+//lint:file-ignore SA4006 This context is only used if a nested component is present.
+
+import "github.com/a-h/templ"
+import "context"
+import "io"
+import "bytes"
+
+import "fmt"
+import "strings"
+
+const quarantineDateFormat = "2 Jan 2006 15:04"
+
+func QuarantineList(emails []QuarantinedEmail, reason string) templ.Component {
+	return templ.ComponentFunc(func(ctx context.Context, w io.Writer) (err error) {
+		templBuffer, templIsBuffer := w.(*bytes.Buffer)
+		if !templIsBuffer {
+			templBuffer = templ.GetBuffer()
+			defer templ.ReleaseBuffer(templBuffer)
+		}
+		ctx = templ.InitializeContext(ctx)
+		var_1 := templ.GetChildren(ctx)
+		if var_1 == nil {
+			var_1 = templ.NopComponent
+		}
+		ctx = templ.ClearChildren(ctx)
+		var_2 := templ.ComponentFunc(func(ctx context.Context, w io.Writer) (err error) {
+			templBuffer, templIsBuffer := w.(*bytes.Buffer)
+			if !templIsBuffer {
+				templBuffer = templ.GetBuffer()
+				defer templ.ReleaseBuffer(templBuffer)
+			}
+			_, err = templBuffer.WriteString("<div class=\"p-10 mx-auto md:max-w-5xl text-slate-900 dark:text-slate-50\"><h1 class=\"font-bold text-4xl mb-5\">")
+			if err != nil {
+				return err
+			}
+			var_3 := `Quarantine`
+			_, err = templBuffer.WriteString(var_3)
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString("</h1><div class=\"mb-5 text-sm\">")
+			if err != nil {
+				return err
+			}
+			err = quarantineFilter("", "All", reason).Render(ctx, templBuffer)
+			if err != nil {
+				return err
+			}
+			err = quarantineFilter("spam", "Spam", reason).Render(ctx, templBuffer)
+			if err != nil {
+				return err
+			}
+			err = quarantineFilter("authentication", "Failed authentication", reason).Render(ctx, templBuffer)
+			if err != nil {
+				return err
+			}
+			err = quarantineFilter("unknown_sender", "Unknown senders", reason).Render(ctx, templBuffer)
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString("</div>")
+			if err != nil {
+				return err
+			}
+			if len(emails) == 0 {
+				_, err = templBuffer.WriteString("<p class=\"text-sm\">")
+				if err != nil {
+					return err
+				}
+				var_4 := `Nothing is held in quarantine.`
+				_, err = templBuffer.WriteString(var_4)
+				if err != nil {
+					return err
+				}
+				_, err = templBuffer.WriteString("</p>")
+				if err != nil {
+					return err
+				}
+			}
+			for _, e := range emails {
+				_, err = templBuffer.WriteString("<a href=\"")
+				if err != nil {
+					return err
+				}
+				var var_5 templ.SafeURL = templ.URL(fmt.Sprintf("/quarantine/%d", e.ID))
+				_, err = templBuffer.WriteString(templ.EscapeString(string(var_5)))
+				if err != nil {
+					return err
+				}
+				_, err = templBuffer.WriteString("\" class=\"block mb-2 p-4 rounded-lg shadow dark:bg-slate-900 bg-slate-100 hover:bg-slate-50 dark:hover:bg-slate-800\"><div class=\"font-semibold\">")
+				if err != nil {
+					return err
+				}
+				var var_6 string = quarantineSubject(e.Subject)
+				_, err = templBuffer.WriteString(templ.EscapeString(var_6))
+				if err != nil {
+					return err
+				}
+				_, err = templBuffer.WriteString("</div><div class=\"text-sm\">")
+				if err != nil {
+					return err
+				}
+				var_7 := `From `
+				_, err = templBuffer.WriteString(var_7)
+				if err != nil {
+					return err
+				}
+				var var_8 string = e.From
+				_, err = templBuffer.WriteString(templ.EscapeString(var_8))
+				if err != nil {
+					return err
+				}
+				_, err = templBuffer.WriteString(" ")
+				if err != nil {
+					return err
+				}
+				var_9 := `to `
+				_, err = templBuffer.WriteString(var_9)
+				if err != nil {
+					return err
+				}
+				var var_10 string = strings.Join(e.Recipients, ", ")
+				_, err = templBuffer.WriteString(templ.EscapeString(var_10))
+				if err != nil {
+					return err
+				}
+				_, err = templBuffer.WriteString("</div><div class=\"text-sm text-slate-500 dark:text-slate-400\">")
+				if err != nil {
+					return err
+				}
+				var var_11 string = e.Detail
+				_, err = templBuffer.WriteString(templ.EscapeString(var_11))
+				if err != nil {
+					return err
+				}
+				var_12 := `, held `
+				_, err = templBuffer.WriteString(var_12)
+				if err != nil {
+					return err
+				}
+				var var_13 string = e.QuarantinedAt.Format(quarantineDateFormat)
+				_, err = templBuffer.WriteString(templ.EscapeString(var_13))
+				if err != nil {
+					return err
+				}
+				var_14 := `, expires `
+				_, err = templBuffer.WriteString(var_14)
+				if err != nil {
+					return err
+				}
+				var var_15 string = e.ExpiresAt.Format(quarantineDateFormat)
+				_, err = templBuffer.WriteString(templ.EscapeString(var_15))
+				if err != nil {
+					return err
+				}
+				_, err = templBuffer.WriteString("</div></a>")
+				if err != nil {
+					return err
+				}
+			}
+			_, err = templBuffer.WriteString("</div>")
+			if err != nil {
+				return err
+			}
+			if !templIsBuffer {
+				_, err = io.Copy(w, templBuffer)
+			}
+			return err
+		})
+		err = page().Render(templ.WithChildren(ctx, var_2), templBuffer)
+		if err != nil {
+			return err
+		}
+		if !templIsBuffer {
+			_, err = templBuffer.WriteTo(w)
+		}
+		return err
+	})
+}
+
+func quarantineFilter(reason string, label string, selected string) templ.Component {
+	return templ.ComponentFunc(func(ctx context.Context, w io.Writer) (err error) {
+		templBuffer, templIsBuffer := w.(*bytes.Buffer)
+		if !templIsBuffer {
+			templBuffer = templ.GetBuffer()
+			defer templ.ReleaseBuffer(templBuffer)
+		}
+		ctx = templ.InitializeContext(ctx)
+		var_16 := templ.GetChildren(ctx)
+		if var_16 == nil {
+			var_16 = templ.NopComponent
+		}
+		ctx = templ.ClearChildren(ctx)
+		if reason == selected {
+			_, err = templBuffer.WriteString("<span class=\"inline-block mr-4 font-semibold\">")
+			if err != nil {
+				return err
+			}
+			var var_17 string = label
+			_, err = templBuffer.WriteString(templ.EscapeString(var_17))
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString("</span>")
+			if err != nil {
+				return err
+			}
+		} else if reason == "" {
+			_, err = templBuffer.WriteString("<a href=\"/quarantine\" class=\"inline-block mr-4 underline\">")
+			if err != nil {
+				return err
+			}
+			var var_18 string = label
+			_, err = templBuffer.WriteString(templ.EscapeString(var_18))
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString("</a>")
+			if err != nil {
+				return err
+			}
+		} else {
+			_, err = templBuffer.WriteString("<a href=\"")
+			if err != nil {
+				return err
+			}
+			var var_19 templ.SafeURL = templ.URL("/quarantine?reason=" + reason)
+			_, err = templBuffer.WriteString(templ.EscapeString(string(var_19)))
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString("\" class=\"inline-block mr-4 underline\">")
+			if err != nil {
+				return err
+			}
+			var var_20 string = label
+			_, err = templBuffer.WriteString(templ.EscapeString(var_20))
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString("</a>")
+			if err != nil {
+				return err
+			}
+		}
+		if !templIsBuffer {
+			_, err = templBuffer.WriteTo(w)
+		}
+		return err
+	})
+}
+
+func QuarantinePreview(e QuarantinedEmail, message string) templ.Component {
+	return templ.ComponentFunc(func(ctx context.Context, w io.Writer) (err error) {
+		templBuffer, templIsBuffer := w.(*bytes.Buffer)
+		if !templIsBuffer {
+			templBuffer = templ.GetBuffer()
+			defer templ.ReleaseBuffer(templBuffer)
+		}
+		ctx = templ.InitializeContext(ctx)
+		var_21 := templ.GetChildren(ctx)
+		if var_21 == nil {
+			var_21 = templ.NopComponent
+		}
+		ctx = templ.ClearChildren(ctx)
+		var_22 := templ.ComponentFunc(func(ctx context.Context, w io.Writer) (err error) {
+			templBuffer, templIsBuffer := w.(*bytes.Buffer)
+			if !templIsBuffer {
+				templBuffer = templ.GetBuffer()
+				defer templ.ReleaseBuffer(templBuffer)
+			}
+			_, err = templBuffer.WriteString("<div class=\"p-10 mx-auto md:max-w-5xl text-slate-900 dark:text-slate-50\"><a href=\"/quarantine\" class=\"text-sm underline\">")
+			if err != nil {
+				return err
+			}
+			var_23 := `Back to the quarantine`
+			_, err = templBuffer.WriteString(var_23)
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString("</a><h1 class=\"font-bold text-4xl my-5\">")
+			if err != nil {
+				return err
+			}
+			var var_24 string = quarantineSubject(e.Subject)
+			_, err = templBuffer.WriteString(templ.EscapeString(var_24))
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString("</h1><div class=\"text-sm\">")
+			if err != nil {
+				return err
+			}
+			var_25 := `From `
+			_, err = templBuffer.WriteString(var_25)
+			if err != nil {
+				return err
+			}
+			var var_26 string = e.From
+			_, err = templBuffer.WriteString(templ.EscapeString(var_26))
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString(" ")
+			if err != nil {
+				return err
+			}
+			var_27 := `to `
+			_, err = templBuffer.WriteString(var_27)
+			if err != nil {
+				return err
+			}
+			var var_28 string = strings.Join(e.Recipients, ", ")
+			_, err = templBuffer.WriteString(templ.EscapeString(var_28))
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString("</div><div class=\"text-sm text-slate-500 dark:text-slate-400\">")
+			if err != nil {
+				return err
+			}
+			var var_29 string = e.Detail
+			_, err = templBuffer.WriteString(templ.EscapeString(var_29))
+			if err != nil {
+				return err
+			}
+			var_30 := `, held `
+			_, err = templBuffer.WriteString(var_30)
+			if err != nil {
+				return err
+			}
+			var var_31 string = e.QuarantinedAt.Format(quarantineDateFormat)
+			_, err = templBuffer.WriteString(templ.EscapeString(var_31))
+			if err != nil {
+				return err
+			}
+			var_32 := `, expires `
+			_, err = templBuffer.WriteString(var_32)
+			if err != nil {
+				return err
+			}
+			var var_33 string = e.ExpiresAt.Format(quarantineDateFormat)
+			_, err = templBuffer.WriteString(templ.EscapeString(var_33))
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString("</div>")
+			if err != nil {
+				return err
+			}
+			if message != "" {
+				_, err = templBuffer.WriteString("<p class=\"mt-4 text-sm font-semibold\">")
+				if err != nil {
+					return err
+				}
+				var var_34 string = message
+				_, err = templBuffer.WriteString(templ.EscapeString(var_34))
+				if err != nil {
+					return err
+				}
+				_, err = templBuffer.WriteString("</p>")
+				if err != nil {
+					return err
+				}
+			}
+			_, err = templBuffer.WriteString("<pre class=\"my-5 p-4 rounded-lg shadow dark:bg-slate-900 bg-slate-100 text-sm whitespace-pre-wrap\">")
+			if err != nil {
+				return err
+			}
+			var var_35 string = e.Body
+			_, err = templBuffer.WriteString(templ.EscapeString(var_35))
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString("</pre><button hx-post=\"")
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString(templ.EscapeString(fmt.Sprintf("/quarantine/%d/release", e.ID)))
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString("\" class=\"mr-2 transition duration-200 bg-slate-700 hover:bg-slate-600 text-white py-2.5 px-5 rounded-lg text-sm shadow-sm font-semibold\">")
+			if err != nil {
+				return err
+			}
+			var_36 := `Release`
+			_, err = templBuffer.WriteString(var_36)
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString("</button><button hx-post=\"")
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString(templ.EscapeString(fmt.Sprintf("/quarantine/%d/delete", e.ID)))
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString("\" hx-confirm=\"Delete this email for good?\" class=\"transition duration-200 bg-slate-700 hover:bg-slate-600 text-white py-2.5 px-5 rounded-lg text-sm shadow-sm font-semibold\">")
+			if err != nil {
+				return err
+			}
+			var_37 := `Delete`
+			_, err = templBuffer.WriteString(var_37)
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString("</button></div>")
+			if err != nil {
+				return err
+			}
+			if !templIsBuffer {
+				_, err = io.Copy(w, templBuffer)
+			}
+			return err
+		})
+		err = page().Render(templ.WithChildren(ctx, var_22), templBuffer)
+		if err != nil {
+			return err
+		}
+		if !templIsBuffer {
+			_, err = templBuffer.WriteTo(w)
+		}
+		return err
+	})
+}
+
+func quarantineSubject(subject string) string {
+	if subject == "" {
+		return "(no subject)"
+	}
+	return subject
+}
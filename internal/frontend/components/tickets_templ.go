@@ -0,0 +1,266 @@
+// Code generated by templ@v0.2.334 DO NOT EDIT.
+
+package components
+
+//lint:file-ignore SA4006 This context is only used if a nested component is present.
+
+import "github.com/a-h/templ"
+import "context"
+import "io"
+import "bytes"
+
+import "fmt"
+import "strings"
+
+const ticketDateFormat = "2 Jan 2006 15:04"
+
+// TicketSearch lists the tickets matching the query with snippets of the text it matched, linking to the next page if there is one.
+
+func TicketSearch(query string, tickets []TicketResult, nextPage string, message string) templ.Component {
+	return templ.ComponentFunc(func(ctx context.Context, w io.Writer) (err error) {
+		templBuffer, templIsBuffer := w.(*bytes.Buffer)
+		if !templIsBuffer {
+			templBuffer = templ.GetBuffer()
+			defer templ.ReleaseBuffer(templBuffer)
+		}
+		ctx = templ.InitializeContext(ctx)
+		var_1 := templ.GetChildren(ctx)
+		if var_1 == nil {
+			var_1 = templ.NopComponent
+		}
+		ctx = templ.ClearChildren(ctx)
+		var_2 := templ.ComponentFunc(func(ctx context.Context, w io.Writer) (err error) {
+			templBuffer, templIsBuffer := w.(*bytes.Buffer)
+			if !templIsBuffer {
+				templBuffer = templ.GetBuffer()
+				defer templ.ReleaseBuffer(templBuffer)
+			}
+			_, err = templBuffer.WriteString("<div class=\"p-10 mx-auto md:max-w-5xl text-slate-900 dark:text-slate-50\"><h1 class=\"font-bold text-4xl mb-5\">")
+			if err != nil {
+				return err
+			}
+			var_3 := `Tickets`
+			_, err = templBuffer.WriteString(var_3)
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString("</h1><form method=\"get\" action=\"/tickets\" class=\"mb-5\">")
+			if err != nil {
+				return err
+			}
+			err = input(inputParams{ID: "q", Type: "search", Placeholder: "status:open owner:me priority:high printer", Value: query}).Render(ctx, templBuffer)
+			if err != nil {
+				return err
+			}
+			_, err = templBuffer.WriteString("</form>")
+			if err != nil {
+				return err
+			}
+			if message != "" {
+				_, err = templBuffer.WriteString("<p class=\"mb-5 text-sm font-semibold\">")
+				if err != nil {
+					return err
+				}
+				var var_4 string = message
+				_, err = templBuffer.WriteString(templ.EscapeString(var_4))
+				if err != nil {
+					return err
+				}
+				_, err = templBuffer.WriteString("</p>")
+				if err != nil {
+					return err
+				}
+			} else if len(tickets) == 0 {
+				_, err = templBuffer.WriteString("<p class=\"text-sm\">")
+				if err != nil {
+					return err
+				}
+				var_5 := `No tickets match the search.`
+				_, err = templBuffer.WriteString(var_5)
+				if err != nil {
+					return err
+				}
+				_, err = templBuffer.WriteString("</p>")
+				if err != nil {
+					return err
+				}
+			}
+			for _, ticket := range tickets {
+				_, err = templBuffer.WriteString("<div class=\"mb-2 p-4 rounded-lg shadow dark:bg-slate-900 bg-slate-100\"><div class=\"font-semibold\">")
+				if err != nil {
+					return err
+				}
+				var_6 := `#`
+				_, err = templBuffer.WriteString(var_6)
+				if err != nil {
+					return err
+				}
+				var var_7 string = fmt.Sprint(ticket.ID)
+				_, err = templBuffer.WriteString(templ.EscapeString(var_7))
+				if err != nil {
+					return err
+				}
+				var var_8 string = ticket.Description
+				_, err = templBuffer.WriteString(templ.EscapeString(var_8))
+				if err != nil {
+					return err
+				}
+				_, err = templBuffer.WriteString("</div><div class=\"text-sm\">")
+				if err != nil {
+					return err
+				}
+				var var_9 string = ticket.Status
+				_, err = templBuffer.WriteString(templ.EscapeString(var_9))
+				if err != nil {
+					return err
+				}
+				if ticket.Priority != "" {
+					var_10 := `, `
+					_, err = templBuffer.WriteString(var_10)
+					if err != nil {
+						return err
+					}
+					var var_11 string = ticket.Priority
+					_, err = templBuffer.WriteString(templ.EscapeString(var_11))
+					if err != nil {
+						return err
+					}
+					_, err = templBuffer.WriteString(" ")
+					if err != nil {
+						return err
+					}
+					var_12 := `priority`
+					_, err = templBuffer.WriteString(var_12)
+					if err != nil {
+						return err
+					}
+				}
+				_, err = templBuffer.WriteString("</div><div class=\"text-sm text-slate-500 dark:text-slate-400\">")
+				if err != nil {
+					return err
+				}
+				if len(ticket.Tags) > 0 {
+					var var_13 string = strings.Join(ticket.Tags, ", ")
+					_, err = templBuffer.WriteString(templ.EscapeString(var_13))
+					if err != nil {
+						return err
+					}
+					var_14 := `,`
+					_, err = templBuffer.WriteString(var_14)
+					if err != nil {
+						return err
+					}
+				}
+				_, err = templBuffer.WriteString(" ")
+				if err != nil {
+					return err
+				}
+				var_15 := `updated `
+				_, err = templBuffer.WriteString(var_15)
+				if err != nil {
+					return err
+				}
+				var var_16 string = ticket.UpdatedAt.Format(ticketDateFormat)
+				_, err = templBuffer.WriteString(templ.EscapeString(var_16))
+				if err != nil {
+					return err
+				}
+				_, err = templBuffer.WriteString("</div>")
+				if err != nil {
+					return err
+				}
+				for _, snippet := range ticket.Snippets {
+					_, err = templBuffer.WriteString("<p class=\"mt-2 text-sm\"><span class=\"font-semibold\">")
+					if err != nil {
+						return err
+					}
+					var var_17 string = snippet.Source
+					_, err = templBuffer.WriteString(templ.EscapeString(var_17))
+					if err != nil {
+						return err
+					}
+					var_18 := `:`
+					_, err = templBuffer.WriteString(var_18)
+					if err != nil {
+						return err
+					}
+					_, err = templBuffer.WriteString("</span>")
+					if err != nil {
+						return err
+					}
+					for _, fragment := range snippet.Fragments {
+						if fragment.Highlighted {
+							_, err = templBuffer.WriteString("<mark class=\"bg-yellow-200 dark:bg-yellow-700 dark:text-slate-50\">")
+							if err != nil {
+								return err
+							}
+							var var_19 string = fragment.Text
+							_, err = templBuffer.WriteString(templ.EscapeString(var_19))
+							if err != nil {
+								return err
+							}
+							_, err = templBuffer.WriteString("</mark>")
+							if err != nil {
+								return err
+							}
+						} else {
+							var var_20 string = fragment.Text
+							_, err = templBuffer.WriteString(templ.EscapeString(var_20))
+							if err != nil {
+								return err
+							}
+						}
+					}
+					_, err = templBuffer.WriteString("</p>")
+					if err != nil {
+						return err
+					}
+				}
+				_, err = templBuffer.WriteString("</div>")
+				if err != nil {
+					return err
+				}
+			}
+			if nextPage != "" {
+				_, err = templBuffer.WriteString("<a href=\"")
+				if err != nil {
+					return err
+				}
+				var var_21 templ.SafeURL = templ.URL(nextPage)
+				_, err = templBuffer.WriteString(templ.EscapeString(string(var_21)))
+				if err != nil {
+					return err
+				}
+				_, err = templBuffer.WriteString("\" class=\"inline-block mt-3 text-sm underline\">")
+				if err != nil {
+					return err
+				}
+				var_22 := `Next page`
+				_, err = templBuffer.WriteString(var_22)
+				if err != nil {
+					return err
+				}
+				_, err = templBuffer.WriteString("</a>")
+				if err != nil {
+					return err
+				}
+			}
+			_, err = templBuffer.WriteString("</div>")
+			if err != nil {
+				return err
+			}
+			if !templIsBuffer {
+				_, err = io.Copy(w, templBuffer)
+			}
+			return err
+		})
+		err = page().Render(templ.WithChildren(ctx, var_2), templBuffer)
+		if err != nil {
+			return err
+		}
+		if !templIsBuffer {
+			_, err = templBuffer.WriteTo(w)
+		}
+		return err
+	})
+}
@@ -1,32 +1,77 @@
 package frontend
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/nil-nil/ticket/internal/domain"
 	"github.com/nil-nil/ticket/internal/frontend/components"
+	"github.com/nil-nil/ticket/internal/services/email"
 )
 
+// QuarantineService reviews inbound email held in quarantine, releasing it into tickets or deleting it
+type QuarantineService interface {
+	List(ctx context.Context, filter domain.QuarantineFilter) ([]domain.Email, error)
+	Get(ctx context.Context, ID uint64) (domain.Email, error)
+	ExpiresAt(q domain.Quarantine) time.Time
+	Release(ctx context.Context, ID uint64) (domain.Email, error)
+	Delete(ctx context.Context, ID uint64) error
+}
+
+// TicketService searches tickets with the search box's query language
+type TicketService interface {
+	ParseQuery(input string, userID uint64) (domain.TicketQuery, error)
+	SearchTickets(ctx context.Context, query domain.TicketQuery) (domain.TicketPage, error)
+}
+
+const ticketPageSize = 25
+
+const quarantinePageSize = 100
+
+// textSourceLabels label the snippets of text ticket searches matched with where the text comes from
+var textSourceLabels = map[domain.TextSource]string{
+	domain.TextSourceDescription:  "Description",
+	domain.TextSourceComment:      "Comment",
+	domain.TextSourceEmailSubject: "Email subject",
+	domain.TextSourceEmailBody:    "Email",
+}
+
 type handler struct {
 	router         *httprouter.Router
 	authSvc        *AuthService
+	tickets        TicketService
+	workflow       *domain.Workflow
+	quarantine     QuarantineService
 	log            *slog.Logger
 	authMiddleware func(http.Handler) http.Handler
 	logMiddleware  func(http.Handler) http.Handler
 }
 
-func NewHandler(authSvc *AuthService, log *slog.Logger) *handler {
+func NewHandler(authSvc *AuthService, tickets TicketService, workflow *domain.Workflow, quarantine QuarantineService, log *slog.Logger) *handler {
 	h := handler{
 		router:        httprouter.New(),
 		authSvc:       authSvc,
+		tickets:       tickets,
+		workflow:      workflow,
+		quarantine:    quarantine,
 		log:           log,
 		logMiddleware: NewLogMiddleware(log, "auth"),
 	}
 
 	// Register routes
 	h.router.GET("/", h.secure)
+	h.router.GET("/tickets", h.ticketSearch)
+	h.router.GET("/quarantine", adminOnly(h.quarantineList))
+	h.router.GET("/quarantine/:id", adminOnly(h.quarantinePreview))
+	h.router.POST("/quarantine/:id/release", adminOnly(h.quarantineRelease))
+	h.router.POST("/quarantine/:id/delete", adminOnly(h.quarantineDelete))
 
 	// Set the auth middleware
 	h.authMiddleware = h.authSvc.AuthMiddleware()
@@ -38,6 +83,22 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.authMiddleware(h.logMiddleware(h.router)).ServeHTTP(w, r)
 }
 
+// adminOnly refuses the route to users who aren't admins.
+func adminOnly(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		u, ok := r.Context().Value(UserContextKey).(domain.User)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !u.Admin {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		next(w, r, p)
+	}
+}
+
 func (h *handler) secure(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	u, ok := r.Context().Value(UserContextKey).(domain.User)
 	if !ok {
@@ -47,3 +108,173 @@ func (h *handler) secure(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 
 	components.Hello(u.FirstName).Render(r.Context(), w)
 }
+
+// ticketSearch searches on behalf of the logged in user, showing why a query can't be searched for in place of results.
+func (h *handler) ticketSearch(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	u, ok := r.Context().Value(UserContextKey).(domain.User)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	input := r.URL.Query().Get("q")
+	query, err := h.tickets.ParseQuery(input, u.ID)
+	if err != nil {
+		components.TicketSearch(input, nil, "", err.Error()).Render(r.Context(), w)
+		return
+	}
+	query.Cursor = r.URL.Query().Get("cursor")
+	query.Limit = ticketPageSize
+
+	page, err := h.tickets.SearchTickets(r.Context(), query)
+	if errors.Is(err, domain.ErrInvalidQuery) || errors.Is(err, domain.ErrInvalidCursor) ||
+		errors.Is(err, domain.ErrUnknownCustomField) || errors.Is(err, domain.ErrInvalidFieldValue) {
+		components.TicketSearch(input, nil, "", err.Error()).Render(r.Context(), w)
+		return
+	}
+	if err != nil {
+		h.log.Error("error searching tickets", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	results := make([]components.TicketResult, 0, len(page.Tickets))
+	for _, ticket := range page.Tickets {
+		meta := ticket.Meta()
+		result := components.TicketResult{
+			ID:          ticket.ID,
+			Description: meta.Description,
+			Status:      h.workflow.StatusName(meta.Status),
+			Tags:        meta.Tags,
+			UpdatedAt:   meta.LastActivityAt,
+		}
+		if meta.Priority != domain.TicketPriorityUnknown {
+			result.Priority = meta.Priority.String()
+		}
+		for _, match := range page.Matches[ticket.ID] {
+			snippet := components.TicketSnippet{Source: textSourceLabels[match.Source]}
+			for _, fragment := range match.Snippet {
+				snippet.Fragments = append(snippet.Fragments, components.SnippetFragment{Text: fragment.Text, Highlighted: fragment.Highlighted})
+			}
+			result.Snippets = append(result.Snippets, snippet)
+		}
+		results = append(results, result)
+	}
+	var nextPage string
+	if page.NextCursor != "" {
+		nextPage = "/tickets?" + url.Values{"q": {input}, "cursor": {page.NextCursor}}.Encode()
+	}
+	components.TicketSearch(input, results, nextPage, "").Render(r.Context(), w)
+}
+
+func (h *handler) quarantineList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	filter := domain.QuarantineFilter{Limit: quarantinePageSize}
+	reason := domain.QuarantineReason(r.URL.Query().Get("reason"))
+	switch reason {
+	case domain.QuarantineReasonSpam, domain.QuarantineReasonAuthentication, domain.QuarantineReasonUnknownSender:
+		filter.Reason = &reason
+	default:
+		reason = ""
+	}
+
+	emails, err := h.quarantine.List(r.Context(), filter)
+	if err != nil {
+		h.log.Error("error listing quarantine", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	list := make([]components.QuarantinedEmail, 0, len(emails))
+	for _, e := range emails {
+		list = append(list, h.quarantinedEmail(e))
+	}
+	components.QuarantineList(list, string(reason)).Render(r.Context(), w)
+}
+
+// quarantineErrors are the messages shown on the preview after a failed release, keyed by the error parameter
+var quarantineErrors = map[string]string{
+	"alias": "None of the email's recipients is an alias any more, so it can't be released.",
+}
+
+func (h *handler) quarantinePreview(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ID, err := strconv.ParseUint(p.ByName("id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	e, err := h.quarantine.Get(r.Context(), ID)
+	if errors.Is(err, domain.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.log.Error("error getting quarantined email", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	components.QuarantinePreview(h.quarantinedEmail(e), quarantineErrors[r.URL.Query().Get("error")]).Render(r.Context(), w)
+}
+
+// quarantineRelease sends htmx back to the quarantine once the email is released, or to its preview explaining why it couldn't be.
+func (h *handler) quarantineRelease(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ID, err := strconv.ParseUint(p.ByName("id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	_, err = h.quarantine.Release(r.Context(), ID)
+	if errors.Is(err, domain.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, email.ErrAliasNotFound) {
+		w.Header().Set("HX-Location", fmt.Sprintf("/quarantine/%d?error=alias", ID))
+		return
+	}
+	if err != nil {
+		h.log.Error("error releasing quarantined email", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("HX-Location", "/quarantine")
+}
+
+func (h *handler) quarantineDelete(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ID, err := strconv.ParseUint(p.ByName("id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = h.quarantine.Delete(r.Context(), ID)
+	if errors.Is(err, domain.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.log.Error("error deleting quarantined email", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("HX-Location", "/quarantine")
+}
+
+// quarantinedEmail expects the email to be in quarantine.
+func (h *handler) quarantinedEmail(e domain.Email) components.QuarantinedEmail {
+	return components.QuarantinedEmail{
+		ID:            e.ID,
+		From:          e.Sender,
+		Subject:       e.Subject,
+		Body:          e.TextBody,
+		Reason:        string(e.Quarantine.Reason),
+		Detail:        e.Quarantine.Detail,
+		Recipients:    e.Quarantine.Recipients,
+		QuarantinedAt: e.Quarantine.QuarantinedAt,
+		ExpiresAt:     h.quarantine.ExpiresAt(*e.Quarantine),
+	}
+}
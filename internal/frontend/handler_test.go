@@ -0,0 +1,203 @@
+package frontend
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/nil-nil/ticket/internal/services/email"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/ptr"
+)
+
+func TestQuarantineHandlers(t *testing.T) {
+	quarantine := &mockQuarantineService{emails: map[uint64]domain.Email{
+		1: {ID: 1, Subject: "Cheap pills", Sender: "spam@example.com", TextBody: "Buy now", Quarantine: &domain.Quarantine{
+			Reason: domain.QuarantineReasonSpam, Detail: "scored 12.0", Recipients: []string{"support@test.com"}, QuarantinedAt: time.Now(),
+		}},
+		2: {ID: 2, Subject: "Hello", Sender: "carol@example.com", Quarantine: &domain.Quarantine{
+			Reason: domain.QuarantineReasonUnknownSender, Detail: "carol@example.com hasn't written in before", Recipients: []string{"old@test.com"}, QuarantinedAt: time.Now(),
+		}},
+	}}
+	h := NewHandler(nil, nil, domain.DefaultWorkflow(), quarantine, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	// Skip the auth middleware, which has its own tests
+	admin := domain.User{ID: 1, Admin: true}
+	serveAs := func(user domain.User, method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, target, nil)
+		h.router.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), UserContextKey, user)))
+		return w
+	}
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		return serveAs(admin, method, target)
+	}
+
+	t.Run("AdminsOnly", func(t *testing.T) {
+		agent := domain.User{ID: 2}
+		assert.Equal(t, http.StatusForbidden, serveAs(agent, http.MethodGet, "/quarantine").Code)
+		assert.Equal(t, http.StatusForbidden, serveAs(agent, http.MethodPost, "/quarantine/1/release").Code)
+		assert.Contains(t, quarantine.emails, uint64(1), "users shouldn't release quarantined email")
+	})
+
+	t.Run("List", func(t *testing.T) {
+		w := serve(http.MethodGet, "/quarantine")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "Cheap pills")
+		assert.Contains(t, w.Body.String(), "carol@example.com hasn&#39;t written in before")
+
+		w = serve(http.MethodGet, "/quarantine?reason=spam")
+		assert.Contains(t, w.Body.String(), "Cheap pills")
+		assert.NotContains(t, w.Body.String(), "carol@example.com", "the list should be filtered by reason")
+	})
+
+	t.Run("Preview", func(t *testing.T) {
+		w := serve(http.MethodGet, "/quarantine/1")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "Buy now", "the preview should show the body")
+
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/quarantine/3").Code)
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/quarantine/nope").Code)
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		w := serve(http.MethodPost, "/quarantine/1/release")
+		assert.Equal(t, "/quarantine", w.Header().Get("HX-Location"), "releasing should go back to the quarantine")
+		assert.NotContains(t, quarantine.emails, uint64(1))
+
+		w = serve(http.MethodPost, "/quarantine/2/release")
+		assert.Equal(t, "/quarantine/2?error=alias", w.Header().Get("HX-Location"), "failing to release should explain why on the preview")
+		w = serve(http.MethodGet, "/quarantine/2?error=alias")
+		assert.Contains(t, w.Body.String(), "can&#39;t be released")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		w := serve(http.MethodPost, "/quarantine/2/delete")
+		assert.Equal(t, "/quarantine", w.Header().Get("HX-Location"))
+		assert.NotContains(t, quarantine.emails, uint64(2))
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, "/quarantine/2/delete").Code)
+	})
+}
+
+func TestTicketSearchHandler(t *testing.T) {
+	tickets := &mockTicketService{ticket: domain.Ticket{ID: 12, Transitions: []domain.TicketTransition{
+		{Timestamp: time.Now(), Status: domain.TicketStatusOpen, Description: ptr.To("Printer on fire"), Priority: domain.TicketPriorityHigh, AddTags: []string{"vip"}},
+	}}}
+	h := NewHandler(nil, tickets, domain.DefaultWorkflow(), nil, slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	user := domain.User{ID: 7, FirstName: "Alice"}
+	// Skip the auth middleware, which has its own tests, logging the user in directly
+	serve := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		h.router.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), UserContextKey, user)))
+		return w
+	}
+
+	w := serve("/tickets?q=owner%3Ame+printer")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Printer on fire")
+	assert.Contains(t, w.Body.String(), "High priority")
+	assert.Contains(t, w.Body.String(), `value="owner:me printer"`, "the search box should keep the query")
+	assert.Contains(t, w.Body.String(), "Comment:</span>")
+	assert.Contains(t, w.Body.String(), `The <mark class="bg-yellow-200 dark:bg-yellow-700 dark:text-slate-50">printer</mark> &lt;b&gt;smokes&lt;/b&gt;`, "matches should be highlighted and the text escaped")
+	assert.Contains(t, w.Body.String(), `href="/tickets?cursor=next&amp;q=owner%3Ame+printer"`, "the next page should continue the query")
+	assert.Equal(t, domain.TicketQuery{TicketFilter: domain.TicketFilter{OwnerID: &user.ID}, Text: "owner:me printer", Limit: ticketPageSize}, tickets.query)
+
+	w = serve("/tickets?q=owner%3Ame+printer&cursor=next")
+	assert.Contains(t, w.Body.String(), "No tickets match")
+	assert.NotContains(t, w.Body.String(), "Next page", "the last page shouldn't link to another")
+
+	w = serve("/tickets?q=status%3Aresolved")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid query: status &#34;resolved&#34; is not a status", "invalid queries should be explained")
+
+	w = serve("/tickets?cursor=garbage")
+	assert.Contains(t, w.Body.String(), "invalid cursor")
+
+	w = httptest.NewRecorder()
+	h.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tickets", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+type mockTicketService struct {
+	ticket domain.Ticket
+	// query is the last query tickets were searched by
+	query domain.TicketQuery
+}
+
+// ParseQuery searches for the input as text among the user's tickets, refusing queries with a status.
+func (m *mockTicketService) ParseQuery(input string, userID uint64) (domain.TicketQuery, error) {
+	if strings.Contains(input, "status:") {
+		return domain.TicketQuery{}, fmt.Errorf("%w: status %q is not a status", domain.ErrInvalidQuery, "resolved")
+	}
+	return domain.TicketQuery{TicketFilter: domain.TicketFilter{OwnerID: &userID}, Text: input}, nil
+}
+
+// SearchTickets records the query, returning the one ticket with a match in a comment and a cursor to an empty next page.
+func (m *mockTicketService) SearchTickets(ctx context.Context, query domain.TicketQuery) (domain.TicketPage, error) {
+	m.query = query
+	switch query.Cursor {
+	case "":
+		return domain.TicketPage{Tickets: []domain.Ticket{m.ticket}, NextCursor: "next", Matches: map[uint64][]domain.TextMatch{m.ticket.ID: {{
+			Source:   domain.TextSourceComment,
+			SourceID: 3,
+			Snippet:  []domain.TextFragment{{Text: "The "}, {Text: "printer", Highlighted: true}, {Text: " <b>smokes</b>"}},
+		}}}}, nil
+	case "next":
+		return domain.TicketPage{}, nil
+	}
+	return domain.TicketPage{}, fmt.Errorf("%w: malformed", domain.ErrInvalidCursor)
+}
+
+type mockQuarantineService struct {
+	emails map[uint64]domain.Email
+}
+
+func (m *mockQuarantineService) List(ctx context.Context, filter domain.QuarantineFilter) ([]domain.Email, error) {
+	emails := make([]domain.Email, 0)
+	for ID := uint64(1); ID <= 2; ID++ {
+		if e, ok := m.emails[ID]; ok && (filter.Reason == nil || e.Quarantine.Reason == *filter.Reason) {
+			emails = append(emails, e)
+		}
+	}
+	return emails, nil
+}
+
+func (m *mockQuarantineService) Get(ctx context.Context, ID uint64) (domain.Email, error) {
+	e, ok := m.emails[ID]
+	if !ok {
+		return domain.Email{}, domain.ErrNotFound
+	}
+	return e, nil
+}
+
+func (m *mockQuarantineService) ExpiresAt(q domain.Quarantine) time.Time {
+	return q.ExpiresAt(email.DefaultQuarantineRetention)
+}
+
+// Release only releases email to the test.com support alias
+func (m *mockQuarantineService) Release(ctx context.Context, ID uint64) (domain.Email, error) {
+	e, err := m.Get(ctx, ID)
+	if err != nil {
+		return domain.Email{}, err
+	}
+	if e.Quarantine.Recipients[0] != "support@test.com" {
+		return domain.Email{}, email.ErrAliasNotFound
+	}
+	delete(m.emails, ID)
+	return e, nil
+}
+
+func (m *mockQuarantineService) Delete(ctx context.Context, ID uint64) error {
+	if _, ok := m.emails[ID]; !ok {
+		return domain.ErrNotFound
+	}
+	delete(m.emails, ID)
+	return nil
+}
@@ -25,7 +25,7 @@ var (
 	embedAssets embed.FS
 )
 
-func NewServer(config config.Config) *http.Server {
+func NewServer(config config.Config, tickets TicketService, workflow *domain.Workflow, quarantine QuarantineService) *http.Server {
 	addr := fmt.Sprintf("%s:%d", config.HTTP.ListenAddress, config.HTTP.Port)
 
 	log := slog.New(slog.NewJSONHandler(os.Stdout, nil))
@@ -65,7 +65,7 @@ func NewServer(config config.Config) *http.Server {
 	router.Handler(http.MethodGet, "/login", logMiddleware(templ.Handler(components.Login())))
 	router.Handler(http.MethodPost, "/login", logMiddleware(authSvc.Login()))
 
-	authRouter := NewHandler(authSvc, log)
+	authRouter := NewHandler(authSvc, tickets, workflow, quarantine, log)
 	router.HandleMethodNotAllowed = false
 	router.NotFound = authRouter
 
@@ -1,61 +1,253 @@
 package gosmtpmail
 
 import (
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/emersion/go-sasl"
 	"github.com/emersion/go-smtp"
 	"github.com/nil-nil/ticket/internal/domain"
 	"github.com/nil-nil/ticket/internal/services/email"
 )
 
+var ErrNoTLSConfig = errors.New("implicit tls requires a tls config")
+
+// Limits used when ServerOptions leaves them unset
+const (
+	DefaultHostname        = "localhost"
+	DefaultTimeout         = 10 * time.Second
+	DefaultMaxMessageBytes = 1024 * 1024
+	DefaultMaxRecipients   = 50
+)
+
 var (
 	ErrMailboxNotFound = &smtp.SMTPError{
 		Code:         550,
 		EnhancedCode: smtp.EnhancedCode{5, 1, 1},
 		Message:      "The email account that you tried to reach does not exist. Please try double-checking the recipient's email address for typos or unnecessary spaces.",
 	}
+	ErrAuthRequired = &smtp.SMTPError{
+		Code:         530,
+		EnhancedCode: smtp.EnhancedCode{5, 7, 0},
+		Message:      "Authentication required",
+	}
+	ErrSenderNotAllowed = &smtp.SMTPError{
+		Code:         553,
+		EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+		Message:      "Sender address rejected: not owned by user",
+	}
+	ErrRelayDenied = &smtp.SMTPError{
+		Code:         554,
+		EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+		Message:      "Relay access denied",
+	}
+	ErrAuthenticationFailed = &smtp.SMTPError{
+		Code:         550,
+		EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+		Message:      "Message rejected: sender authentication failed",
+	}
+	ErrSpamRejected = &smtp.SMTPError{
+		Code:         550,
+		EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+		Message:      "Message rejected as spam",
+	}
+	ErrInvalidAddress = &smtp.SMTPError{
+		Code:         501,
+		EnhancedCode: smtp.EnhancedCode{5, 1, 3},
+		Message:      "Bad address syntax",
+	}
+	ErrMessageRateLimited = &smtp.SMTPError{
+		Code:         451,
+		EnhancedCode: smtp.EnhancedCode{4, 7, 1},
+		Message:      "Too many messages, try again later",
+	}
+	ErrRecipientRateLimited = &smtp.SMTPError{
+		Code:         451,
+		EnhancedCode: smtp.EnhancedCode{4, 7, 1},
+		Message:      "Too many recipients, try again later",
+	}
 )
 
-func NewServer(mailServerRepo email.MailServerRepository, cacheDriver domain.CacheDriver, eventBusDriver domain.EventBusDriver, authFunc email.AuthFunc) *smtp.Server {
-	mailServer := email.NewServer(mailServerRepo, cacheDriver, eventBusDriver, authFunc)
-	be := backend{server: mailServer}
+// ServerOptions configures how a server identifies itself, limits, secures and authenticates its clients.
+type ServerOptions struct {
+	// Hostname is the name we greet clients with and record authentication results under, defaults to DefaultHostname
+	Hostname string
+	// ReadTimeout and WriteTimeout bound each read from and write to a client, defaulting to DefaultTimeout
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// MaxMessageBytes and MaxRecipients limit each message, defaulting to DefaultMaxMessageBytes and DefaultMaxRecipients
+	MaxMessageBytes int64
+	MaxRecipients   int
+
+	// TLSConfig enables STARTTLS, and implicit TLS on listeners from Listen
+	TLSConfig *tls.Config
+	// AllowInsecureAuth allows AUTH before STARTTLS, exposing passwords to anyone on the network
+	AllowInsecureAuth bool
+	// RequireAuth makes every sender authenticate, for a submission server rather than an MX
+	RequireAuth bool
+	// LMTP serves LMTP (RFC 2033) rather than SMTP, for an MTA handing us mail it has already accepted and filtered
+	LMTP bool
+	// Limiter caps connections, messages and recipients per client IP and sender, and may be shared between servers
+	Limiter *Limiter
+	// Resolver enables SPF, DKIM and DMARC checks of inbound mail, with AuthPolicy deciding what to do with failures
+	Resolver   email.Resolver
+	AuthPolicy email.AuthPolicy
+	// SpamFilters and SpamPolicy are handed to the email.Server
+	SpamFilters []email.SpamFilter
+	SpamPolicy  email.SpamPolicy
+}
+
+// NewServer returns an SMTP server that accepts mail for our aliases and relays mail from authenticated users.
+//
+// AUTH PLAIN and LOGIN are offered when authFunc is set, and only over TLS unless opts.AllowInsecureAuth is set.
+func NewServer(mailServerRepo email.MailServerRepository, ticketService email.TicketService, outboundQueue email.OutboundQueue, cacheDriver domain.CacheDriver, eventBusDriver domain.EventBusDriver, authFunc email.AuthFunc, opts ServerOptions) *smtp.Server {
+	mailServer := email.NewServer(mailServerRepo, ticketService, outboundQueue, cacheDriver, eventBusDriver, authFunc)
+	mailServer.RequireAuth = opts.RequireAuth
+	mailServer.Resolver = opts.Resolver
+	mailServer.AuthPolicy = opts.AuthPolicy
+	mailServer.SpamFilters = opts.SpamFilters
+	mailServer.SpamPolicy = opts.SpamPolicy
+	be := backend{server: mailServer, limiter: opts.Limiter}
 	server := smtp.NewServer(&be)
-	server.Addr = ":25"
-	server.Domain = "localhost"
-	server.ReadTimeout = 10 * time.Second
-	server.WriteTimeout = 10 * time.Second
-	server.MaxMessageBytes = 1024 * 1024
-	server.MaxRecipients = 50
-	server.AllowInsecureAuth = true
+	server.Domain = orDefault(opts.Hostname, DefaultHostname)
+	mailServer.Hostname = server.Domain
+	server.ReadTimeout = orDefault(opts.ReadTimeout, DefaultTimeout)
+	server.WriteTimeout = orDefault(opts.WriteTimeout, DefaultTimeout)
+	server.MaxMessageBytes = orDefault(opts.MaxMessageBytes, DefaultMaxMessageBytes)
+	server.MaxRecipients = orDefault(opts.MaxRecipients, DefaultMaxRecipients)
+	server.TLSConfig = opts.TLSConfig
+	server.AllowInsecureAuth = opts.AllowInsecureAuth
+	server.AuthDisabled = authFunc == nil
+	server.LMTP = opts.LMTP
+	server.EnableAuth(sasl.Login, func(conn *smtp.Conn) sasl.Server {
+		return sasl.NewLoginServer(func(username, password string) error {
+			return conn.Session().AuthPlain(username, password)
+		})
+	})
 
 	return server
 }
 
+func orDefault[T comparable](value, fallback T) T {
+	var zero T
+	if value == zero {
+		return fallback
+	}
+	return value
+}
+
+// Listen opens a listener for the server to Serve.
+//
+// Addresses starting with "unix:" are Unix socket paths, e.g. "unix:/run/ticket/lmtp.sock", which is how MTAs usually hand mail to LMTP servers.
+// A socket left behind by a previous run is replaced. The new one may only be written to by our user and socketGroup, a group name
+// or ID that should include the MTA's user. An empty socketGroup leaves the socket in our own group.
+//
+// With implicitTLS, e.g. for submissions on port 465, connections start with a TLS handshake instead of using STARTTLS.
+//
+// Connections from client IPs over the server's limits are refused with a 421 reply before the session starts.
+func Listen(server *smtp.Server, addr string, implicitTLS bool, socketGroup string) (net.Listener, error) {
+	if implicitTLS && server.TLSConfig == nil {
+		return nil, ErrNoTLSConfig
+	}
+	l, err := listen(addr, socketGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	limited := &limitedListener{Listener: l, greeting: server.Domain}
+	if be, ok := server.Backend.(*backend); ok {
+		limited.limiter = be.limiter
+	}
+	if !implicitTLS {
+		return limited, nil
+	}
+	limited.greeting = ""
+	return tls.NewListener(limited, server.TLSConfig), nil
+}
+
+func listen(addr string, socketGroup string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o660); err != nil {
+		l.Close()
+		return nil, err
+	}
+	if socketGroup != "" {
+		gid, err := lookupGroup(socketGroup)
+		if err == nil {
+			err = os.Chown(path, -1, gid)
+		}
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+// lookupGroup returns the ID of a group given by name or ID.
+func lookupGroup(group string) (int, error) {
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		if g, err = user.LookupGroupId(group); err != nil {
+			return 0, fmt.Errorf("unknown socket group %q", group)
+		}
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// Make sure sessions give LMTP clients a status for each recipient
+var _ smtp.LMTPSession = (*session)(nil)
+
 type backend struct {
-	server *email.Server
+	server  *email.Server
+	limiter *Limiter
 }
 
 func (b *backend) NewSession(c *smtp.Conn) (smtp.Session, error) {
-	return &session{server: b.server}, nil
+	return &session{server: b.server, limiter: b.limiter, helo: c.Hostname(), remoteIP: remoteIP(c.Conn().RemoteAddr())}, nil
 }
 
 type session struct {
-	server *email.Server
-	user   *domain.User
-	from   string
-	to     []string
+	server   *email.Server
+	limiter  *Limiter
+	remoteIP net.IP
+	helo     string
+	user     *domain.User
+	from     string
+	to       []string
 }
 
 func (s *session) AuthPlain(username, password string) error {
 	if s.server.AuthFunc == nil {
-		return nil
+		return smtp.ErrAuthUnsupported
 	}
 
 	user, err := s.server.AuthFunc(username, password)
 	if err != nil {
-		return err
+		return smtp.ErrAuthFailed
 	}
 
 	s.user = &user
@@ -63,9 +255,13 @@ func (s *session) AuthPlain(username, password string) error {
 }
 
 func (s *session) Mail(from string, opts *smtp.MailOptions) error {
-	err := s.server.ValidateSenderAddress(from)
+	err := s.server.ValidateSenderAddress(s.user, from)
 	if err != nil {
-		return err
+		return smtpError(err)
+	}
+	if !s.limiter.allowMessage(s.ip(), from) {
+		metrics.Add(metricMessagesLimited, 1)
+		return ErrMessageRateLimited
 	}
 
 	s.from = from
@@ -73,24 +269,78 @@ func (s *session) Mail(from string, opts *smtp.MailOptions) error {
 }
 
 func (s *session) Rcpt(to string, opts *smtp.RcptOptions) error {
-	err := s.server.ValidateRecipientAddress(to)
-	if errors.Is(err, email.ErrAliasNotFound) {
-		return ErrMailboxNotFound
-	}
+	err := s.server.ValidateRecipientAddress(s.user, to)
 	if err != nil {
-		return err
+		return smtpError(err)
+	}
+	if !s.limiter.allowRecipient(s.ip(), s.from) {
+		metrics.Add(metricRecipientsLimited, 1)
+		return ErrRecipientRateLimited
 	}
 
+	metrics.Add(metricRecipients, 1)
 	s.to = append(s.to, to)
 	return nil
 }
 
 func (s *session) Data(r io.Reader) error {
-	return s.server.ReceiveData(r)
+	err := s.server.ReceiveData(email.Envelope{From: s.from, To: s.to, User: s.user, RemoteIP: s.remoteIP, Helo: s.helo}, r)
+	countMessage(err)
+	return smtpError(err)
+}
+
+// LMTPData delivers the message, with a status for each recipient rather than one for the whole message.
+func (s *session) LMTPData(r io.Reader, status smtp.StatusCollector) error {
+	envelope := email.Envelope{From: s.from, To: s.to, User: s.user, RemoteIP: s.remoteIP, Helo: s.helo}
+	err := s.server.DeliverData(envelope, r, func(recipient string, err error) {
+		status.SetStatus(recipient, smtpError(err))
+	})
+	countMessage(err)
+	return smtpError(err)
+}
+
+// ip is the client's address for limiting, empty if it didn't connect over TCP.
+func (s *session) ip() string {
+	if s.remoteIP == nil {
+		return ""
+	}
+	return s.remoteIP.String()
 }
 
-func (s *session) Reset() {}
+func (s *session) Reset() {
+	s.from = ""
+	s.to = nil
+}
 
 func (s *session) Logout() error {
 	return nil
 }
+
+func countMessage(err error) {
+	if err != nil {
+		metrics.Add(metricMessagesRejected, 1)
+		return
+	}
+	metrics.Add(metricMessages, 1)
+}
+
+// smtpError turns errors from the email service into the SMTP replies clients expect.
+func smtpError(err error) error {
+	switch {
+	case errors.Is(err, email.ErrAliasNotFound):
+		return ErrMailboxNotFound
+	case errors.Is(err, email.ErrAuthRequired):
+		return ErrAuthRequired
+	case errors.Is(err, email.ErrSenderNotAllowed):
+		return ErrSenderNotAllowed
+	case errors.Is(err, email.ErrRelayDenied):
+		return ErrRelayDenied
+	case errors.Is(err, email.ErrInvalidEmailAddress):
+		return ErrInvalidAddress
+	case errors.Is(err, email.ErrAuthenticationFailed):
+		return ErrAuthenticationFailed
+	case errors.Is(err, email.ErrSpamRejected):
+		return ErrSpamRejected
+	}
+	return err
+}
@@ -0,0 +1,343 @@
+package gosmtpmail_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/nil-nil/ticket/internal/infrastructure/gosmtpmail"
+	"github.com/nil-nil/ticket/internal/infrastructure/ristrettocache"
+	"github.com/nil-nil/ticket/internal/infrastructure/sqlrepository"
+	"github.com/nil-nil/ticket/internal/infrastructure/ticketeventbus"
+	"github.com/nil-nil/ticket/internal/services/email"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlrepository.Open(ctx, "sqlite", filepath.Join(t.TempDir(), "ticket.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, db.Migrate(ctx))
+
+	cache, err := ristrettocache.NewCache(nil)
+	require.NoError(t, err)
+	bus, err := ticketeventbus.NewBus(":")
+	require.NoError(t, err)
+
+	domains, err := domain.NewDNSDomainService(sqlrepository.NewDNSDomainRepository(db), bus, cache)
+	require.NoError(t, err)
+	testDomain, err := domains.CreateDomain(ctx, "test.com")
+	require.NoError(t, err)
+	domains.Resolver = txtResolver{"test.com": {testDomain.VerificationRecord().Value}}
+	_, err = domains.VerifyDomain(ctx, testDomain.ID)
+	require.NoError(t, err)
+	agent, err := sqlrepository.NewUserRepository(db).Create(ctx, "Alice", "Agent")
+	require.NoError(t, err)
+	aliases := domain.NewAliasService(sqlrepository.NewAliasRepository(db), bus)
+	support, err := aliases.Create(ctx, "support", "test.com")
+	require.NoError(t, err)
+	_, err = aliases.SetOwner(ctx, support.ID, &agent.ID)
+	require.NoError(t, err)
+	_, err = aliases.Create(ctx, "sales", "test.com")
+	require.NoError(t, err)
+
+	outbound := sqlrepository.NewOutboundRepository(db)
+	queue, err := domain.NewOutboundQueue(outbound, bus, domain.DefaultRetryPolicy)
+	require.NoError(t, err)
+	tickets := domain.NewTicketService(sqlrepository.NewTicketRepository(db), bus, cache)
+	authFunc := func(username, password string) (domain.User, error) {
+		if username != "alice" || password != "secret" {
+			return domain.User{}, errors.New("invalid credentials")
+		}
+		return agent, nil
+	}
+
+	serve := func(t *testing.T, opts gosmtpmail.ServerOptions, implicitTLS bool) string {
+		server := gosmtpmail.NewServer(sqlrepository.NewMailServerRepository(db), tickets, queue, cache, bus, authFunc, opts)
+		l, err := gosmtpmail.Listen(server, "127.0.0.1:0", implicitTLS, "")
+		require.NoError(t, err)
+		go server.Serve(l)
+		t.Cleanup(func() { server.Close() })
+		return l.Addr().String()
+	}
+	startServer := func(t *testing.T, opts gosmtpmail.ServerOptions) *smtp.Client {
+		c, err := smtp.Dial(serve(t, opts, false))
+		require.NoError(t, err)
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	leaf := writeCertificate(t, certFile, keyFile, 1)
+	cert, err := gosmtpmail.LoadCertificate(certFile, keyFile)
+	require.NoError(t, err)
+
+	t.Run("RelayDenied", func(t *testing.T) {
+		c := startServer(t, gosmtpmail.ServerOptions{})
+		require.NoError(t, c.Mail("bob@example.com", nil))
+		assertReply(t, 554, c.Rcpt("alan@example.org", nil), "unauthenticated relay should be refused")
+		assert.NoError(t, c.Rcpt("support@test.com", nil), "mail for our aliases should be accepted")
+	})
+
+	t.Run("InsecureAuthRefused", func(t *testing.T) {
+		c := startServer(t, gosmtpmail.ServerOptions{})
+		assert.Error(t, c.Auth(sasl.NewPlainClient("", "alice", "secret")), "AUTH shouldn't be allowed without TLS")
+	})
+
+	t.Run("StartTLS", func(t *testing.T) {
+		c := startServer(t, gosmtpmail.ServerOptions{TLSConfig: cert.TLSConfig()})
+		ok, _ := c.Extension("AUTH")
+		assert.False(t, ok, "AUTH shouldn't be offered before STARTTLS")
+		require.NoError(t, c.StartTLS(clientTLSConfig(leaf)))
+		assert.NoError(t, c.Auth(sasl.NewPlainClient("", "alice", "secret")), "AUTH should be allowed after STARTTLS")
+	})
+
+	t.Run("ImplicitTLS", func(t *testing.T) {
+		c, err := smtp.DialTLS(serve(t, gosmtpmail.ServerOptions{TLSConfig: cert.TLSConfig(), RequireAuth: true}, true), clientTLSConfig(leaf))
+		require.NoError(t, err)
+		t.Cleanup(func() { c.Close() })
+		ok, _ := c.Extension("STARTTLS")
+		assert.False(t, ok, "STARTTLS shouldn't be offered on a TLS connection")
+		assert.NoError(t, c.Auth(sasl.NewLoginClient("alice", "secret")))
+		assert.NoError(t, c.Mail("support@test.com", nil))
+	})
+
+	t.Run("ImplicitTLSWithoutCertificate", func(t *testing.T) {
+		server := gosmtpmail.NewServer(sqlrepository.NewMailServerRepository(db), tickets, queue, cache, bus, authFunc, gosmtpmail.ServerOptions{})
+		_, err := gosmtpmail.Listen(server, "127.0.0.1:0", true, "")
+		assert.ErrorIs(t, err, gosmtpmail.ErrNoTLSConfig)
+	})
+
+	t.Run("Options", func(t *testing.T) {
+		server := gosmtpmail.NewServer(sqlrepository.NewMailServerRepository(db), tickets, queue, cache, bus, authFunc, gosmtpmail.ServerOptions{})
+		assert.Equal(t, gosmtpmail.DefaultHostname, server.Domain)
+		assert.Equal(t, gosmtpmail.DefaultTimeout, server.ReadTimeout)
+		assert.Equal(t, gosmtpmail.DefaultTimeout, server.WriteTimeout)
+		assert.Equal(t, int64(gosmtpmail.DefaultMaxMessageBytes), server.MaxMessageBytes)
+		assert.Equal(t, gosmtpmail.DefaultMaxRecipients, server.MaxRecipients)
+
+		server = gosmtpmail.NewServer(sqlrepository.NewMailServerRepository(db), tickets, queue, cache, bus, authFunc, gosmtpmail.ServerOptions{
+			Hostname:        "mx.test.com",
+			ReadTimeout:     time.Minute,
+			WriteTimeout:    2 * time.Minute,
+			MaxMessageBytes: 25 << 20,
+			MaxRecipients:   100,
+		})
+		assert.Equal(t, "mx.test.com", server.Domain)
+		assert.Equal(t, time.Minute, server.ReadTimeout)
+		assert.Equal(t, 2*time.Minute, server.WriteTimeout)
+		assert.Equal(t, int64(25<<20), server.MaxMessageBytes)
+		assert.Equal(t, 100, server.MaxRecipients)
+	})
+
+	t.Run("Limits", func(t *testing.T) {
+		c := startServer(t, gosmtpmail.ServerOptions{MaxRecipients: 1, MaxMessageBytes: 64})
+		require.NoError(t, c.Mail("bob@example.com", nil))
+		require.NoError(t, c.Rcpt("support@test.com", nil))
+		assertReply(t, 452, c.Rcpt("sales@test.com", nil), "recipients beyond the limit should be refused")
+
+		w, err := c.Data()
+		require.NoError(t, err)
+		_, err = w.Write([]byte("Subject: Hello\r\n\r\n" + strings.Repeat("x", 128) + "\r\n"))
+		require.NoError(t, err)
+		assertReply(t, 552, w.Close(), "messages over the size limit should be refused")
+	})
+
+	t.Run("SpamRejected", func(t *testing.T) {
+		c := startServer(t, gosmtpmail.ServerOptions{
+			SpamFilters: []email.SpamFilter{email.HeuristicsFilter{}},
+			SpamPolicy:  email.SpamPolicy{Reject: 1},
+		})
+		message := "From: bob@example.com\r\nTo: support@test.com\r\nSubject: Hello\r\n\r\nBody\r\n"
+		err := c.SendMail("bob@example.com", []string{"support@test.com"}, strings.NewReader(message))
+		assertReply(t, 550, err, "mail scoring over the reject threshold should be refused")
+	})
+
+	t.Run("LMTP", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "lmtp.sock")
+		// A socket left behind by a previous run shouldn't stop us listening
+		stale, err := net.Listen("unix", socket)
+		require.NoError(t, err)
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		stale.Close()
+
+		server := gosmtpmail.NewServer(sqlrepository.NewMailServerRepository(db), tickets, queue, cache, bus, nil, gosmtpmail.ServerOptions{LMTP: true})
+		_, err = gosmtpmail.Listen(server, "unix:"+socket, false, "no-such-group-here")
+		assert.Error(t, err, "an unknown socket group should be refused")
+		l, err := gosmtpmail.Listen(server, "unix:"+socket, false, fmt.Sprint(os.Getgid()))
+		require.NoError(t, err)
+		info, err := os.Stat(socket)
+		require.NoError(t, err)
+		assert.Equal(t, fs.FileMode(0o660), info.Mode().Perm(), "only our user and the socket group should reach the socket")
+		go server.Serve(l)
+		t.Cleanup(func() { server.Close() })
+
+		conn, err := net.Dial("unix", socket)
+		require.NoError(t, err)
+		c, err := smtp.NewClientLMTP(conn, "localhost")
+		require.NoError(t, err)
+		t.Cleanup(func() { c.Close() })
+
+		require.NoError(t, c.Hello("mta.test.com"))
+		require.NoError(t, c.Mail("bob@example.com", nil))
+		require.NoError(t, c.Rcpt("support@test.com", nil))
+		require.NoError(t, c.Rcpt("sales@test.com", nil))
+		assertReply(t, 554, c.Rcpt("alan@example.org", nil), "LMTP shouldn't relay")
+
+		statuses := map[string]*smtp.SMTPError{}
+		w, err := c.LMTPData(func(rcpt string, status *smtp.SMTPError) { statuses[rcpt] = status })
+		require.NoError(t, err)
+		_, err = w.Write([]byte("Message-ID: <lmtp-1@example.com>\r\nFrom: bob@example.com\r\nTo: support@test.com, sales@test.com\r\nSubject: Hello\r\n\r\nBody\r\n"))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		assert.Equal(t, map[string]*smtp.SMTPError{"support@test.com": nil, "sales@test.com": nil}, statuses, "each recipient should get a status")
+	})
+
+	t.Run("ConnectionLimit", func(t *testing.T) {
+		addr := serve(t, gosmtpmail.ServerOptions{Hostname: "mx.test.com", Limiter: gosmtpmail.NewLimiter(gosmtpmail.Limits{ConnectionsPerIP: 1})}, false)
+		greeting := func() string {
+			conn, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer conn.Close()
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			require.NoError(t, err)
+			return line
+		}
+		limited := metric(t, "connections_limited")
+
+		first, err := smtp.Dial(addr)
+		require.NoError(t, err, "the first connection should be allowed")
+		assert.Equal(t, "421 4.7.0 mx.test.com Too many connections, try again later\r\n", greeting(), "a second concurrent connection should be refused")
+		assert.Equal(t, limited+1, metric(t, "connections_limited"), "the refusal should be counted")
+
+		require.NoError(t, first.Quit())
+		assert.Eventually(t, func() bool { return strings.HasPrefix(greeting(), "220 ") }, time.Second, 10*time.Millisecond, "closing the first connection should free its slot")
+	})
+
+	t.Run("RateLimits", func(t *testing.T) {
+		limiter := gosmtpmail.NewLimiter(gosmtpmail.Limits{
+			IPMessages:       gosmtpmail.RateLimit{Count: 2, Per: time.Hour},
+			SenderRecipients: gosmtpmail.RateLimit{Count: 1, Per: time.Hour},
+		})
+		c := startServer(t, gosmtpmail.ServerOptions{Limiter: limiter})
+		messagesLimited, recipientsLimited := metric(t, "messages_limited"), metric(t, "recipients_limited")
+
+		require.NoError(t, c.Mail("bob@example.com", nil))
+		require.NoError(t, c.Rcpt("support@test.com", nil))
+		assertReply(t, 451, c.Rcpt("sales@test.com", nil), "the sender should be limited to one recipient")
+		require.NoError(t, c.Reset())
+
+		require.NoError(t, c.Mail("carol@example.com", nil))
+		assert.NoError(t, c.Rcpt("sales@test.com", nil), "other senders should have their own limit")
+		require.NoError(t, c.Reset())
+		assertReply(t, 451, c.Mail("dave@example.com", nil), "the client IP should be limited to two messages")
+
+		assert.Equal(t, messagesLimited+1, metric(t, "messages_limited"))
+		assert.Equal(t, recipientsLimited+1, metric(t, "recipients_limited"))
+	})
+
+	t.Run("SpoofedSenderRejected", func(t *testing.T) {
+		resolver := txtResolver{"example.com": {"v=spf1 -all"}, "_dmarc.example.com": {"v=DMARC1; p=reject"}}
+		c := startServer(t, gosmtpmail.ServerOptions{Resolver: resolver, AuthPolicy: email.DefaultAuthPolicy})
+		err := c.SendMail("bob@example.com", []string{"support@test.com"}, strings.NewReader("From: bob@example.com\r\nTo: support@test.com\r\nSubject: Hello\r\n\r\nBody\r\n"))
+		assertReply(t, 550, err, "mail failing DMARC with p=reject should be refused")
+	})
+
+	t.Run("AuthRequired", func(t *testing.T) {
+		c := startServer(t, gosmtpmail.ServerOptions{RequireAuth: true})
+		assertReply(t, 530, c.Mail("bob@example.com", nil), "submission should require authentication")
+	})
+
+	t.Run("AuthFailed", func(t *testing.T) {
+		c := startServer(t, gosmtpmail.ServerOptions{AllowInsecureAuth: true})
+		assertReply(t, 535, c.Auth(sasl.NewPlainClient("", "alice", "wrong")), "wrong password should be refused")
+	})
+
+	t.Run("SenderNotOwned", func(t *testing.T) {
+		c := startServer(t, gosmtpmail.ServerOptions{AllowInsecureAuth: true})
+		require.NoError(t, c.Auth(sasl.NewPlainClient("", "alice", "secret")))
+		assertReply(t, 553, c.Mail("sales@test.com", nil), "users should only send as aliases they own")
+	})
+
+	t.Run("AuthenticatedRelay", func(t *testing.T) {
+		c := startServer(t, gosmtpmail.ServerOptions{AllowInsecureAuth: true, RequireAuth: true})
+		require.NoError(t, c.Auth(sasl.NewLoginClient("alice", "secret")), "AUTH LOGIN should be supported")
+
+		message := "Message-ID: <relay-1@test.com>\r\nFrom: support@test.com\r\nTo: alan@example.org\r\nSubject: Hello\r\n\r\nBody\r\n"
+		require.NoError(t, c.SendMail("support@test.com", []string{"alan@example.org"}, strings.NewReader(message)))
+
+		queued, err := outbound.FindByMessageID(ctx, "relay-1@test.com")
+		assert.NoError(t, err)
+		assert.Equal(t, "support@test.com", queued.From)
+		assert.Equal(t, []string{"alan@example.org"}, queued.To, "relayed mail should be queued")
+		assert.Equal(t, message, string(queued.Message))
+	})
+
+	t.Run("ForgedFromHeader", func(t *testing.T) {
+		c := startServer(t, gosmtpmail.ServerOptions{AllowInsecureAuth: true})
+		require.NoError(t, c.Auth(sasl.NewPlainClient("", "alice", "secret")))
+
+		message := "Message-ID: <relay-2@test.com>\r\nFrom: sales@test.com\r\nTo: alan@example.org\r\nSubject: Hello\r\n\r\nBody\r\n"
+		err := c.SendMail("support@test.com", []string{"alan@example.org"}, strings.NewReader(message))
+		assertReply(t, 553, err, "the From header should be checked as well as the envelope")
+		_, err = outbound.FindByMessageID(ctx, "relay-2@test.com")
+		assert.ErrorIs(t, err, domain.ErrNotFound, "rejected mail shouldn't be queued")
+	})
+}
+
+// txtResolver answers TXT queries from a map, every other lookup finds nothing.
+type txtResolver map[string][]string
+
+func (r txtResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if records, ok := r[name]; ok {
+		return records, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (r txtResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (r txtResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (r txtResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+}
+
+func assertReply(t *testing.T, code int, err error, msg string) {
+	t.Helper()
+	var smtpErr *smtp.SMTPError
+	if assert.True(t, errors.As(err, &smtpErr), msg) {
+		assert.Equal(t, code, smtpErr.Code, msg)
+	}
+}
+
+// metric reads one of the server's expvar counters.
+func metric(t *testing.T, name string) int64 {
+	t.Helper()
+	metrics, ok := expvar.Get("smtp").(*expvar.Map)
+	require.True(t, ok, "metrics should be published as smtp")
+	counter, ok := metrics.Get(name).(*expvar.Int)
+	if !ok {
+		return 0
+	}
+	return counter.Value()
+}
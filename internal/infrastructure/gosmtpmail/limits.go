@@ -0,0 +1,241 @@
+package gosmtpmail
+
+import (
+	"expvar"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// metrics counts sessions, messages and recipients, and how many were refused by limits, published with expvar as "smtp".
+var metrics = expvar.NewMap("smtp")
+
+const (
+	metricConnections        = "connections"
+	metricConnectionsLimited = "connections_limited"
+	metricMessages           = "messages"
+	metricMessagesRejected   = "messages_rejected"
+	metricMessagesLimited    = "messages_limited"
+	metricRecipients         = "recipients"
+	metricRecipientsLimited  = "recipients_limited"
+)
+
+const (
+	// refusalTimeout bounds how long a refused client may take to read why
+	refusalTimeout = time.Second
+	// maxRefusals bounds how many refused connections are told why at once. Past that they're closed silently
+	maxRefusals = 64
+)
+
+// refusals holds a slot for each refused connection being told why
+var refusals = make(chan struct{}, maxRefusals)
+
+// RateLimit allows Count events every Per, all of which may happen at once. It's unlimited unless both are set.
+type RateLimit struct {
+	Count int
+	Per   time.Duration
+}
+
+// Limits caps what each client IP and envelope sender may do. Zero values are unlimited.
+type Limits struct {
+	// ConnectionsPerIP is how many sessions a client IP may have open at once
+	ConnectionsPerIP int
+	// IPConnections, IPMessages and IPRecipients limit how often a client IP may connect, start a message and add a recipient
+	IPConnections RateLimit
+	IPMessages    RateLimit
+	IPRecipients  RateLimit
+	// SenderMessages and SenderRecipients do the same for an envelope sender, whichever client sends as it. Bounces aren't limited by sender
+	SenderMessages   RateLimit
+	SenderRecipients RateLimit
+}
+
+// NewLimiter returns a Limiter enforcing limits across every server it's given to.
+func NewLimiter(limits Limits) *Limiter {
+	return &Limiter{
+		limits:           limits,
+		open:             map[string]int{},
+		ipConnections:    newKeyedLimiter(limits.IPConnections),
+		ipMessages:       newKeyedLimiter(limits.IPMessages),
+		ipRecipients:     newKeyedLimiter(limits.IPRecipients),
+		senderMessages:   newKeyedLimiter(limits.SenderMessages),
+		senderRecipients: newKeyedLimiter(limits.SenderRecipients),
+	}
+}
+
+// Limiter tracks each client IP's open sessions and the rate of each IP and sender. A nil Limiter allows everything.
+type Limiter struct {
+	limits Limits
+
+	mu   sync.Mutex
+	open map[string]int
+
+	ipConnections    *keyedLimiter
+	ipMessages       *keyedLimiter
+	ipRecipients     *keyedLimiter
+	senderMessages   *keyedLimiter
+	senderRecipients *keyedLimiter
+}
+
+// acquireConnection reserves one of the IP's sessions, returning a func to release it when the connection closes.
+func (l *Limiter) acquireConnection(ip string) (release func(), ok bool) {
+	if l == nil {
+		return func() {}, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limits.ConnectionsPerIP > 0 && l.open[ip] >= l.limits.ConnectionsPerIP {
+		return nil, false
+	}
+	if !l.ipConnections.allow(ip) {
+		return nil, false
+	}
+
+	l.open[ip]++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.open[ip]--; l.open[ip] <= 0 {
+			delete(l.open, ip)
+		}
+	}, true
+}
+
+func (l *Limiter) allowMessage(ip, sender string) bool {
+	if l == nil {
+		return true
+	}
+	return l.ipMessages.allow(ip) && l.senderMessages.allow(strings.ToLower(sender))
+}
+
+func (l *Limiter) allowRecipient(ip, sender string) bool {
+	if l == nil {
+		return true
+	}
+	return l.ipRecipients.allow(ip) && l.senderRecipients.allow(strings.ToLower(sender))
+}
+
+// keyedLimiter is a token bucket for each key, forgetting buckets that have been idle long enough to refill.
+type keyedLimiter struct {
+	limit RateLimit
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newKeyedLimiter returns nil, allowing everything, if the limit isn't set.
+func newKeyedLimiter(limit RateLimit) *keyedLimiter {
+	if limit.Count <= 0 || limit.Per <= 0 {
+		return nil
+	}
+	return &keyedLimiter{limit: limit, buckets: map[string]*bucket{}, lastSweep: time.Now()}
+}
+
+// allow takes a token from the key's bucket. Empty keys, e.g. Unix socket clients or the null sender, aren't limited.
+func (k *keyedLimiter) allow(key string) bool {
+	if k == nil || key == "" {
+		return true
+	}
+
+	now := time.Now()
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if now.Sub(k.lastSweep) > k.limit.Per {
+		for key, b := range k.buckets {
+			if now.Sub(b.lastSeen) > k.limit.Per {
+				delete(k.buckets, key)
+			}
+		}
+		k.lastSweep = now
+	}
+
+	b, ok := k.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Every(k.limit.Per/time.Duration(k.limit.Count)), k.limit.Count)}
+		k.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	return b.limiter.AllowN(now, 1)
+}
+
+// limitedListener refuses connections from IPs over their connection limits before the session starts.
+type limitedListener struct {
+	net.Listener
+	limiter *Limiter
+	// greeting is the server's name for the 421 reply, or empty to close refused connections silently when they expect a TLS handshake
+	greeting string
+}
+
+func (l *limitedListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		ip := ""
+		if addr := remoteIP(conn.RemoteAddr()); addr != nil {
+			ip = addr.String()
+		}
+		release, ok := l.limiter.acquireConnection(ip)
+		if ok {
+			metrics.Add(metricConnections, 1)
+			return &limitedConn{Conn: conn, release: release}, nil
+		}
+
+		metrics.Add(metricConnectionsLimited, 1)
+		l.refuse(conn)
+	}
+}
+
+// refuse closes the connection, first replying 421 in the background so slow clients don't hold up accepting others.
+func (l *limitedListener) refuse(conn net.Conn) {
+	if l.greeting == "" {
+		conn.Close()
+		return
+	}
+	select {
+	case refusals <- struct{}{}:
+	default:
+		conn.Close()
+		return
+	}
+	go func() {
+		defer func() { <-refusals }()
+		defer conn.Close()
+		conn.SetWriteDeadline(time.Now().Add(refusalTimeout))
+		fmt.Fprintf(conn, "421 4.7.0 %s Too many connections, try again later\r\n", l.greeting)
+	}()
+}
+
+// limitedConn releases its IP's connection when it's closed.
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
+
+// remoteIP returns the client's IP, or nil if it didn't connect over TCP.
+func remoteIP(addr net.Addr) net.IP {
+	if addr, ok := addr.(*net.TCPAddr); ok {
+		return addr.IP
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package gosmtpmail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"github.com/nil-nil/ticket/internal/domain"
+)
+
+var (
+	ErrUnknownTLSMode     = errors.New("unknown tls mode")
+	ErrStartTLSNotOffered = errors.New("server doesn't support STARTTLS")
+)
+
+// Make sure we conform to domain.MailSender
+var _ domain.MailSender = (*Sender)(nil)
+
+// TLSMode is how a Sender secures its connection to the submission server.
+type TLSMode string
+
+const (
+	// TLSModeStartTLS upgrades a plain connection with STARTTLS, failing if the server doesn't offer it
+	TLSModeStartTLS TLSMode = "starttls"
+	// TLSModeImplicit connects over TLS, usually to port 465
+	TLSModeImplicit TLSMode = "implicit"
+	// TLSModeNone sends in the clear, only suitable for a relay on the local machine or network
+	TLSModeNone TLSMode = "none"
+)
+
+// SenderOptions configures the submission server a Sender relays through.
+type SenderOptions struct {
+	// Address of the submission server, e.g. "smtp.example.com:587"
+	Address string
+	// Hostname is the name we introduce ourselves with in EHLO, defaults to "localhost"
+	Hostname string
+	// Username and Password authenticate with PLAIN auth if Username is set
+	Username string
+	Password string
+	// TLS defaults to TLSModeStartTLS
+	TLS       TLSMode
+	TLSConfig *tls.Config
+}
+
+// NewSender returns a domain.MailSender that submits mail to an SMTP server.
+func NewSender(opts SenderOptions) (*Sender, error) {
+	switch opts.TLS {
+	case "":
+		opts.TLS = TLSModeStartTLS
+	case TLSModeStartTLS, TLSModeImplicit, TLSModeNone:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTLSMode, opts.TLS)
+	}
+	if opts.Hostname == "" {
+		opts.Hostname = "localhost"
+	}
+
+	return &Sender{opts: opts}, nil
+}
+
+type Sender struct {
+	opts SenderOptions
+}
+
+// Send delivers a message over a new connection to the submission server.
+//
+// Errors wrap domain.ErrPermanentFailure if the server rejected the message outright.
+func (s *Sender) Send(ctx context.Context, from string, to []string, message []byte) error {
+	c, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Hello(s.opts.Hostname); err != nil {
+		return err
+	}
+
+	if s.opts.TLS == TLSModeStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return ErrStartTLSNotOffered
+		}
+		if err := c.StartTLS(s.tlsConfig()); err != nil {
+			return err
+		}
+	}
+
+	if s.opts.Username != "" {
+		if err := c.Auth(sasl.NewPlainClient("", s.opts.Username, s.opts.Password)); err != nil {
+			return err
+		}
+	}
+
+	return permanentError(c.SendMail(from, to, bytes.NewReader(message)))
+}
+
+// permanentError marks SMTP 5xx replies as domain.ErrPermanentFailure, as retrying them won't help.
+func permanentError(err error) error {
+	var smtpErr *smtp.SMTPError
+	if errors.As(err, &smtpErr) && smtpErr.Code >= 500 {
+		return fmt.Errorf("%w: %w", domain.ErrPermanentFailure, err)
+	}
+	return err
+}
+
+func (s *Sender) dial(ctx context.Context) (*smtp.Client, error) {
+	host, _, err := net.SplitHostPort(s.opts.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	if s.opts.TLS == TLSModeImplicit {
+		dialer := &tls.Dialer{Config: s.tlsConfig()}
+		conn, err = dialer.DialContext(ctx, "tcp", s.opts.Address)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", s.opts.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (s *Sender) tlsConfig() *tls.Config {
+	if s.opts.TLSConfig != nil {
+		return s.opts.TLSConfig
+	}
+
+	host, _, _ := net.SplitHostPort(s.opts.Address)
+	return &tls.Config{ServerName: host}
+}
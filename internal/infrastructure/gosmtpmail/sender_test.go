@@ -0,0 +1,154 @@
+package gosmtpmail_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/emersion/go-smtp"
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/nil-nil/ticket/internal/infrastructure/gosmtpmail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSender(t *testing.T) {
+	be := &fakeBackend{}
+	addr := startFakeServer(t, be)
+
+	t.Run("Send", func(t *testing.T) {
+		sender, err := gosmtpmail.NewSender(gosmtpmail.SenderOptions{Address: addr, Username: "user", Password: "pass", TLS: gosmtpmail.TLSModeNone})
+		require.NoError(t, err)
+
+		message := "Subject: Hello\r\n\r\nBody\r\n"
+		err = sender.Send(context.Background(), "support@test.com", []string{"bob@example.com", "alice@example.com"}, []byte(message))
+		assert.NoError(t, err)
+
+		require.Len(t, be.messages, 1)
+		assert.Equal(t, "support@test.com", be.messages[0].from)
+		assert.Equal(t, []string{"bob@example.com", "alice@example.com"}, be.messages[0].to)
+		assert.Equal(t, message, be.messages[0].data)
+		assert.Equal(t, "user", be.messages[0].username, "sender should authenticate")
+	})
+
+	t.Run("RejectedRecipient", func(t *testing.T) {
+		sender, err := gosmtpmail.NewSender(gosmtpmail.SenderOptions{Address: addr, TLS: gosmtpmail.TLSModeNone})
+		require.NoError(t, err)
+
+		err = sender.Send(context.Background(), "support@test.com", []string{"nobody@example.com"}, []byte("Subject: Hello\r\n\r\nBody\r\n"))
+		assert.ErrorIs(t, err, domain.ErrPermanentFailure, "5xx replies should be permanent failures")
+	})
+
+	t.Run("DeferredRecipient", func(t *testing.T) {
+		sender, err := gosmtpmail.NewSender(gosmtpmail.SenderOptions{Address: addr, TLS: gosmtpmail.TLSModeNone})
+		require.NoError(t, err)
+
+		err = sender.Send(context.Background(), "support@test.com", []string{"greylisted@example.com"}, []byte("Subject: Hello\r\n\r\nBody\r\n"))
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, domain.ErrPermanentFailure, "4xx replies should be retried")
+	})
+
+	t.Run("RejectedAuth", func(t *testing.T) {
+		sender, err := gosmtpmail.NewSender(gosmtpmail.SenderOptions{Address: addr, Username: "user", Password: "wrong", TLS: gosmtpmail.TLSModeNone})
+		require.NoError(t, err)
+
+		err = sender.Send(context.Background(), "support@test.com", []string{"bob@example.com"}, []byte("Subject: Hello\r\n\r\nBody\r\n"))
+		assert.Error(t, err)
+	})
+
+	t.Run("StartTLSRequired", func(t *testing.T) {
+		sender, err := gosmtpmail.NewSender(gosmtpmail.SenderOptions{Address: addr})
+		require.NoError(t, err)
+
+		err = sender.Send(context.Background(), "support@test.com", []string{"bob@example.com"}, []byte("Subject: Hello\r\n\r\nBody\r\n"))
+		assert.ErrorIs(t, err, gosmtpmail.ErrStartTLSNotOffered, "mail shouldn't be sent in the clear by default")
+	})
+
+	t.Run("UnknownTLSMode", func(t *testing.T) {
+		_, err := gosmtpmail.NewSender(gosmtpmail.SenderOptions{Address: addr, TLS: "sometimes"})
+		assert.ErrorIs(t, err, gosmtpmail.ErrUnknownTLSMode)
+	})
+}
+
+// startFakeServer runs an SMTP server on a random local port that records the messages it receives.
+func startFakeServer(t *testing.T, be smtp.Backend) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := smtp.NewServer(be)
+	server.Domain = "localhost"
+	server.AllowInsecureAuth = true
+	go server.Serve(l)
+	t.Cleanup(func() { server.Close() })
+
+	return l.Addr().String()
+}
+
+type receivedMessage struct {
+	username string
+	from     string
+	to       []string
+	data     string
+}
+
+type fakeBackend struct {
+	mu       sync.Mutex
+	messages []receivedMessage
+}
+
+func (b *fakeBackend) NewSession(c *smtp.Conn) (smtp.Session, error) {
+	return &fakeSession{backend: b}, nil
+}
+
+type fakeSession struct {
+	backend *fakeBackend
+	message receivedMessage
+}
+
+func (s *fakeSession) AuthPlain(username, password string) error {
+	if username != "user" || password != "pass" {
+		return errors.New("invalid credentials")
+	}
+	s.message.username = username
+	return nil
+}
+
+func (s *fakeSession) Mail(from string, opts *smtp.MailOptions) error {
+	s.message.from = from
+	return nil
+}
+
+func (s *fakeSession) Rcpt(to string, opts *smtp.RcptOptions) error {
+	switch to {
+	case "nobody@example.com":
+		return &smtp.SMTPError{Code: 550, EnhancedCode: smtp.EnhancedCode{5, 1, 1}, Message: "No such user"}
+	case "greylisted@example.com":
+		return &smtp.SMTPError{Code: 451, EnhancedCode: smtp.EnhancedCode{4, 7, 1}, Message: "Try again later"}
+	}
+	s.message.to = append(s.message.to, to)
+	return nil
+}
+
+func (s *fakeSession) Data(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.message.data = string(data)
+
+	s.backend.mu.Lock()
+	defer s.backend.mu.Unlock()
+	s.backend.messages = append(s.backend.messages, s.message)
+	return nil
+}
+
+func (s *fakeSession) Reset() {
+	s.message = receivedMessage{username: s.message.username}
+}
+
+func (s *fakeSession) Logout() error {
+	return nil
+}
@@ -0,0 +1,111 @@
+package gosmtpmail
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Certificate is a TLS certificate and key loaded from disk, which can be reloaded without restarting the server.
+type Certificate struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+
+	mu       sync.Mutex
+	modTimes [2]time.Time
+}
+
+// LoadCertificate reads a PEM encoded certificate chain and key.
+func LoadCertificate(certFile, keyFile string) (*Certificate, error) {
+	c := &Certificate{certFile: certFile, keyFile: keyFile}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Reload reads the certificate and key again. The current certificate is kept if they can't be loaded.
+func (c *Certificate) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	modTimes, err := c.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.cert.Store(&cert)
+	c.modTimes = modTimes
+	return nil
+}
+
+// Watch reloads the certificate whenever its files change, checking every interval until ctx is done.
+//
+// Failed reloads are passed to onError and retried at the next check, renewals often replace the two files one at a time.
+func (c *Certificate) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !c.changed() {
+			continue
+		}
+		if err := c.Reload(); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// GetCertificate returns the current certificate, for use as tls.Config.GetCertificate.
+func (c *Certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+// TLSConfig returns a server configuration that always uses the current certificate.
+func (c *Certificate) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.GetCertificate,
+	}
+}
+
+// changed reports whether either file has been modified since it was last loaded.
+func (c *Certificate) changed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	modTimes, err := c.stat()
+	if err != nil {
+		// Let Reload report why the files can't be read
+		return true
+	}
+	return modTimes != c.modTimes
+}
+
+func (c *Certificate) stat() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, name := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+
+	return modTimes, nil
+}
@@ -0,0 +1,103 @@
+package gosmtpmail_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nil-nil/ticket/internal/infrastructure/gosmtpmail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile, 1)
+
+	cert, err := gosmtpmail.LoadCertificate(certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), serial(t, cert), "certificate should be loaded")
+
+	t.Run("MissingFiles", func(t *testing.T) {
+		_, err := gosmtpmail.LoadCertificate(filepath.Join(dir, "missing.pem"), keyFile)
+		assert.Error(t, err)
+	})
+
+	t.Run("InvalidReloadKeepsCertificate", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(certFile, []byte("not a certificate"), 0o600))
+		assert.Error(t, cert.Reload())
+		assert.Equal(t, int64(1), serial(t, cert), "the previous certificate should still be served")
+	})
+
+	t.Run("Watch", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go cert.Watch(ctx, 10*time.Millisecond, nil)
+
+		writeCertificate(t, certFile, keyFile, 2)
+		// Make sure the change is seen on filesystems with coarse modification times
+		later := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(certFile, later, later))
+
+		assert.Eventually(t, func() bool { return serial(t, cert) == 2 }, time.Second, 10*time.Millisecond, "renewed certificate should be loaded")
+	})
+}
+
+// writeCertificate writes a self-signed certificate for localhost.
+func writeCertificate(t *testing.T, certFile, keyFile string, serialNumber int64) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serialNumber),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+// clientTLSConfig trusts a certificate written by writeCertificate.
+func clientTLSConfig(cert *x509.Certificate) *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{RootCAs: pool, ServerName: "localhost"}
+}
+
+func serial(t *testing.T, cert *gosmtpmail.Certificate) int64 {
+	t.Helper()
+	c, err := cert.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(c.Certificate[0])
+	require.NoError(t, err)
+	return leaf.SerialNumber.Int64()
+}
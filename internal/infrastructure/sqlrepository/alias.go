@@ -0,0 +1,155 @@
+package sqlrepository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/nil-nil/ticket/internal/domain"
+)
+
+// Make sure we conform to domain.AliasRepository
+var _ domain.AliasRepository = (*AliasRepository)(nil)
+
+const aliasColumns = "id, local_part, domain, deleted_at, owner_id, queue, default_owner_id, priority, tags, private"
+
+func NewAliasRepository(db *DB) *AliasRepository {
+	return &AliasRepository{db: db}
+}
+
+type AliasRepository struct {
+	db *DB
+}
+
+// Find returns the alias matching every parameter given, ignoring the case of the user and domain.
+//
+// Deleted aliases are only returned if no live alias matches, so an address that was deleted and recreated resolves to the live one.
+func (r *AliasRepository) Find(ctx context.Context, params domain.FindAliasParameters) (domain.Alias, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+	if params.ID != nil {
+		conditions = append(conditions, "id = ?")
+		args = append(args, *params.ID)
+	}
+	if params.User != nil {
+		conditions = append(conditions, "LOWER(local_part) = ?")
+		args = append(args, strings.ToLower(*params.User))
+	}
+	if params.Domain != nil {
+		conditions = append(conditions, "LOWER(domain) = ?")
+		args = append(args, strings.ToLower(*params.Domain))
+	}
+	if len(conditions) == 0 {
+		return domain.Alias{}, domain.ErrNotFound
+	}
+
+	query := "SELECT " + aliasColumns + " FROM aliases WHERE " + strings.Join(conditions, " AND ") +
+		" ORDER BY CASE WHEN deleted_at IS NULL THEN 0 ELSE 1 END, id DESC LIMIT 1"
+
+	return scanAlias(r.db.db.QueryRowContext(ctx, r.db.dialect.rebind(query), args...))
+}
+
+func (r *AliasRepository) Create(ctx context.Context, user string, mailDomain string) (domain.Alias, error) {
+	return scanAlias(r.db.db.QueryRowContext(ctx,
+		r.db.dialect.rebind("INSERT INTO aliases (local_part, domain) VALUES (?, ?) RETURNING "+aliasColumns),
+		user, mailDomain,
+	))
+}
+
+// Delete soft deletes an alias by setting DeletedAt. Deleting an already deleted alias leaves it unchanged.
+func (r *AliasRepository) Delete(ctx context.Context, ID uint64) (domain.Alias, error) {
+	var alias domain.Alias
+	err := r.db.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, r.db.dialect.rebind("UPDATE aliases SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL"), time.Now().UTC(), ID)
+		if err != nil {
+			return err
+		}
+
+		alias, err = scanAlias(tx.QueryRowContext(ctx, r.db.dialect.rebind("SELECT "+aliasColumns+" FROM aliases WHERE id = ?"), ID))
+		return err
+	})
+	if err != nil {
+		return domain.Alias{}, err
+	}
+
+	return alias, nil
+}
+
+func (r *AliasRepository) SetOwner(ctx context.Context, ID uint64, OwnerID *uint64) (domain.Alias, error) {
+	return scanAlias(r.db.db.QueryRowContext(ctx,
+		r.db.dialect.rebind("UPDATE aliases SET owner_id = ? WHERE id = ? RETURNING "+aliasColumns),
+		OwnerID, ID,
+	))
+}
+
+// SetRouting replaces where tickets opened by mail to the alias land.
+func (r *AliasRepository) SetRouting(ctx context.Context, ID uint64, routing domain.AliasRouting) (domain.Alias, error) {
+	tags, err := encodeTags(routing.Tags)
+	if err != nil {
+		return domain.Alias{}, err
+	}
+
+	return scanAlias(r.db.db.QueryRowContext(ctx,
+		r.db.dialect.rebind("UPDATE aliases SET queue = ?, default_owner_id = ?, priority = ?, tags = ?, private = ? WHERE id = ? RETURNING "+aliasColumns),
+		routing.Queue, routing.DefaultOwnerID, routing.Priority, tags, routing.Private, ID,
+	))
+}
+
+// getAliases returns the live aliases, optionally limited to a single domain regardless of case.
+func (r *AliasRepository) getAliases(ctx context.Context, mailDomain *string) ([]domain.Alias, error) {
+	query := "SELECT " + aliasColumns + " FROM aliases WHERE deleted_at IS NULL"
+	var args []any
+	if mailDomain != nil {
+		query += " AND LOWER(domain) = ?"
+		args = append(args, strings.ToLower(*mailDomain))
+	}
+	query += " ORDER BY id"
+
+	rows, err := r.db.db.QueryContext(ctx, r.db.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := make([]domain.Alias, 0)
+	for rows.Next() {
+		alias, err := scanAlias(rows)
+		if err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, alias)
+	}
+
+	return aliases, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAlias(row scanner) (domain.Alias, error) {
+	var (
+		alias          domain.Alias
+		deletedAt      sql.NullTime
+		ownerID        sql.NullInt64
+		defaultOwnerID sql.NullInt64
+		tags           string
+	)
+	err := row.Scan(&alias.ID, &alias.User, &alias.Domain, &deletedAt, &ownerID, &alias.Routing.Queue, &defaultOwnerID, &alias.Routing.Priority, &tags, &alias.Routing.Private)
+	if err != nil {
+		return domain.Alias{}, notFound(err)
+	}
+	alias.Routing.DefaultOwnerID = nullableID(defaultOwnerID)
+	if alias.Routing.Tags, err = decodeTags(tags); err != nil {
+		return domain.Alias{}, err
+	}
+	if deletedAt.Valid {
+		alias.DeletedAt = &deletedAt.Time
+	}
+	alias.OwnerID = nullableID(ownerID)
+
+	return alias, nil
+}
@@ -0,0 +1,183 @@
+package sqlrepository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/nil-nil/ticket/internal/domain"
+)
+
+// Make sure we conform to domain.DNSDomainRepository
+var _ domain.DNSDomainRepository = (*DNSDomainRepository)(nil)
+
+const dnsDomainColumns = "id, name, dkim_selector, dkim_private_key, dkim_created_at, verification_token, verified_at, deleted_at"
+
+func NewDNSDomainRepository(db *DB) *DNSDomainRepository {
+	return &DNSDomainRepository{db: db}
+}
+
+type DNSDomainRepository struct {
+	db *DB
+}
+
+func (r *DNSDomainRepository) GetDomains(ctx context.Context) ([]domain.DNSDomain, error) {
+	rows, err := r.db.db.QueryContext(ctx, "SELECT "+dnsDomainColumns+" FROM dns_domains WHERE deleted_at IS NULL ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	domains := make([]domain.DNSDomain, 0)
+	for rows.Next() {
+		d, err := scanDNSDomain(rows)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, d)
+	}
+
+	return domains, rows.Err()
+}
+
+func (r *DNSDomainRepository) GetDomain(ctx context.Context, ID uint64) (domain.DNSDomain, error) {
+	row := r.db.db.QueryRowContext(ctx, r.db.dialect.rebind("SELECT "+dnsDomainColumns+" FROM dns_domains WHERE id = ? AND deleted_at IS NULL"), ID)
+	d, err := scanDNSDomain(row)
+	if err != nil {
+		return domain.DNSDomain{}, notFound(err)
+	}
+
+	return d, nil
+}
+
+func (r *DNSDomainRepository) GetDomainByName(ctx context.Context, name string) (domain.DNSDomain, error) {
+	row := r.db.db.QueryRowContext(ctx, r.db.dialect.rebind("SELECT "+dnsDomainColumns+" FROM dns_domains WHERE LOWER(name) = LOWER(?) AND deleted_at IS NULL"), name)
+	d, err := scanDNSDomain(row)
+	if err != nil {
+		return domain.DNSDomain{}, notFound(err)
+	}
+
+	return d, nil
+}
+
+func (r *DNSDomainRepository) CreateDomain(ctx context.Context, d domain.DNSDomain) (domain.DNSDomain, error) {
+	return scanDNSDomain(r.db.db.QueryRowContext(ctx,
+		r.db.dialect.rebind("INSERT INTO dns_domains (name, verification_token) VALUES (?, ?) RETURNING "+dnsDomainColumns),
+		d.Name, d.VerificationToken,
+	))
+}
+
+// RenameDomain renames the domain and moves its live aliases to the new name in a single transaction, clearing VerifiedAt.
+func (r *DNSDomainRepository) RenameDomain(ctx context.Context, ID uint64, name string) (domain.DNSDomain, error) {
+	var d domain.DNSDomain
+	err := r.db.inTx(ctx, func(tx *sql.Tx) error {
+		old, err := scanDNSDomain(tx.QueryRowContext(ctx, r.db.dialect.rebind("SELECT "+dnsDomainColumns+" FROM dns_domains WHERE id = ? AND deleted_at IS NULL"), ID))
+		if err != nil {
+			return notFound(err)
+		}
+
+		d, err = scanDNSDomain(tx.QueryRowContext(ctx,
+			r.db.dialect.rebind("UPDATE dns_domains SET name = ?, verified_at = NULL WHERE id = ? RETURNING "+dnsDomainColumns),
+			name, ID,
+		))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, r.db.dialect.rebind("UPDATE aliases SET domain = ? WHERE LOWER(domain) = LOWER(?) AND deleted_at IS NULL"), name, old.Name)
+		return err
+	})
+	if err != nil {
+		return domain.DNSDomain{}, err
+	}
+
+	return d, nil
+}
+
+// DeleteDomain soft deletes the domain and its live aliases in a single transaction.
+func (r *DNSDomainRepository) DeleteDomain(ctx context.Context, ID uint64) (domain.DNSDomain, error) {
+	var d domain.DNSDomain
+	err := r.db.inTx(ctx, func(tx *sql.Tx) error {
+		now := time.Now().UTC()
+		var err error
+		d, err = scanDNSDomain(tx.QueryRowContext(ctx,
+			r.db.dialect.rebind("UPDATE dns_domains SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL RETURNING "+dnsDomainColumns),
+			now, ID,
+		))
+		if err != nil {
+			return notFound(err)
+		}
+
+		_, err = tx.ExecContext(ctx, r.db.dialect.rebind("UPDATE aliases SET deleted_at = ? WHERE LOWER(domain) = LOWER(?) AND deleted_at IS NULL"), now, d.Name)
+		return err
+	})
+	if err != nil {
+		return domain.DNSDomain{}, err
+	}
+
+	return d, nil
+}
+
+func (r *DNSDomainRepository) SetDKIMKey(ctx context.Context, ID uint64, key domain.DKIMKey) (domain.DNSDomain, error) {
+	row := r.db.db.QueryRowContext(ctx,
+		r.db.dialect.rebind("UPDATE dns_domains SET dkim_selector = ?, dkim_private_key = ?, dkim_created_at = ? WHERE id = ? AND deleted_at IS NULL RETURNING "+dnsDomainColumns),
+		key.Selector, key.PrivateKey, key.CreatedAt.UTC(), ID,
+	)
+	d, err := scanDNSDomain(row)
+	if err != nil {
+		return domain.DNSDomain{}, notFound(err)
+	}
+
+	return d, nil
+}
+
+func (r *DNSDomainRepository) SetVerificationToken(ctx context.Context, ID uint64, token string) (domain.DNSDomain, error) {
+	row := r.db.db.QueryRowContext(ctx,
+		r.db.dialect.rebind("UPDATE dns_domains SET verification_token = ? WHERE id = ? AND deleted_at IS NULL RETURNING "+dnsDomainColumns),
+		token, ID,
+	)
+	d, err := scanDNSDomain(row)
+	if err != nil {
+		return domain.DNSDomain{}, notFound(err)
+	}
+
+	return d, nil
+}
+
+func (r *DNSDomainRepository) SetVerified(ctx context.Context, ID uint64, verifiedAt time.Time) (domain.DNSDomain, error) {
+	row := r.db.db.QueryRowContext(ctx,
+		r.db.dialect.rebind("UPDATE dns_domains SET verified_at = ? WHERE id = ? AND deleted_at IS NULL RETURNING "+dnsDomainColumns),
+		verifiedAt.UTC(), ID,
+	)
+	d, err := scanDNSDomain(row)
+	if err != nil {
+		return domain.DNSDomain{}, notFound(err)
+	}
+
+	return d, nil
+}
+
+func scanDNSDomain(row scanner) (domain.DNSDomain, error) {
+	var (
+		d          domain.DNSDomain
+		selector   sql.NullString
+		privateKey sql.NullString
+		createdAt  sql.NullTime
+		verifiedAt sql.NullTime
+		deletedAt  sql.NullTime
+	)
+	if err := row.Scan(&d.ID, &d.Name, &selector, &privateKey, &createdAt, &d.VerificationToken, &verifiedAt, &deletedAt); err != nil {
+		return domain.DNSDomain{}, err
+	}
+	if verifiedAt.Valid {
+		d.VerifiedAt = &verifiedAt.Time
+	}
+	if deletedAt.Valid {
+		d.DeletedAt = &deletedAt.Time
+	}
+	if selector.Valid {
+		d.DKIM = &domain.DKIMKey{Selector: selector.String, PrivateKey: privateKey.String, CreatedAt: createdAt.Time}
+	}
+
+	return d, nil
+}
@@ -0,0 +1,444 @@
+package sqlrepository
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/mail"
+	"sort"
+
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/nil-nil/ticket/internal/services/email"
+)
+
+// Make sure we conform to domain.EmailCreator, domain.EmailTicketRepository and email.MailServerRepository
+var (
+	_ domain.EmailCreator          = (*EmailRepository)(nil)
+	_ domain.EmailTicketRepository = (*EmailRepository)(nil)
+	_ email.MailServerRepository   = (*MailServerRepository)(nil)
+)
+
+const emailColumns = "id, message_id, subject, sender, date, raw, ticket_id, text_body, html_body, outbound, " + authenticationColumns + ", " + spamColumns
+
+const authenticationColumns = "spf_result, spf_domain, dkim_result, dkim_domain, dmarc_result, dmarc_domain, dmarc_policy, auth_flagged"
+
+const spamColumns = "spam_score, spam_rules, spam_action"
+
+// quarantineColumns are selected by joining quarantined_emails, so are NULL for email that isn't in quarantine
+const quarantineColumns = "reason, detail, recipients, quarantined_at"
+
+// emailsJoin is the tables emailColumns and quarantineColumns are selected from
+const emailsJoin = "emails LEFT JOIN quarantined_emails ON quarantined_emails.email_id = emails.id"
+
+func NewEmailRepository(db *DB) *EmailRepository {
+	return &EmailRepository{db: db}
+}
+
+type EmailRepository struct {
+	db *DB
+}
+
+// CreateEmail stores the email along with the raw message, encoding Message if Raw isn't set.
+//
+// The message body can only be read once, so the returned email's Message has a fresh Body reader over the stored bytes.
+func (r *EmailRepository) CreateEmail(ctx context.Context, e domain.Email) (domain.Email, error) {
+	raw, bodyOffset := e.Raw, 0
+	if raw == nil {
+		var err error
+		raw, bodyOffset, err = encodeMessage(e.Message)
+		if err != nil {
+			return domain.Email{}, fmt.Errorf("error encoding message: %w", err)
+		}
+	}
+	spam, err := spamArgs(e.Spam)
+	if err != nil {
+		return domain.Email{}, err
+	}
+
+	err = r.db.inTx(ctx, func(tx *sql.Tx) error {
+		args := append([]any{e.MessageID, e.Subject, e.Sender, e.Date, raw, e.TicketID, e.TextBody, e.HTMLBody, e.Outbound}, authenticationArgs(e.Authentication)...)
+		args = append(args, spam...)
+		err := tx.QueryRowContext(ctx,
+			r.db.dialect.rebind("INSERT INTO emails (message_id, subject, sender, date, raw, ticket_id, text_body, html_body, outbound, "+authenticationColumns+", "+spamColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id"),
+			args...,
+		).Scan(&e.ID)
+		if err != nil {
+			return err
+		}
+
+		for i, recipient := range e.Recipients {
+			_, err := tx.ExecContext(ctx, r.db.dialect.rebind("INSERT INTO email_recipients (email_id, position, address) VALUES (?, ?, ?)"), e.ID, i, recipient)
+			if err != nil {
+				return err
+			}
+		}
+
+		for i := range e.Attachments {
+			attachment := &e.Attachments[i]
+			attachment.EmailID = e.ID
+			attachment.Size = int64(len(attachment.Content))
+			err := tx.QueryRowContext(ctx,
+				r.db.dialect.rebind("INSERT INTO email_attachments (email_id, content_type, filename, size, content) VALUES (?, ?, ?, ?, ?) RETURNING id"),
+				attachment.EmailID, attachment.ContentType, attachment.Filename, attachment.Size, attachment.Content,
+			).Scan(&attachment.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		if e.Quarantine != nil {
+			if err := r.insertQuarantine(ctx, tx, e.ID, *e.Quarantine); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return domain.Email{}, err
+	}
+
+	if e.Raw != nil {
+		msg, err := mail.ReadMessage(bytes.NewReader(raw))
+		if err != nil {
+			return domain.Email{}, fmt.Errorf("error decoding message: %w", err)
+		}
+		e.Message = *msg
+	} else {
+		e.Message = mail.Message{Header: e.Message.Header, Body: bytes.NewReader(raw[bodyOffset:])}
+		e.Raw = raw
+	}
+	return e, nil
+}
+
+// FindEmail returns a stored email with its message re-parsed from the raw bytes.
+func (r *EmailRepository) FindEmail(ctx context.Context, ID uint64) (domain.Email, error) {
+	emails, err := r.findEmails(ctx, "id = ?", ID)
+	if err != nil {
+		return domain.Email{}, err
+	}
+	if len(emails) == 0 {
+		return domain.Email{}, domain.ErrNotFound
+	}
+
+	return emails[0], nil
+}
+
+func (r *EmailRepository) LinkTicket(ctx context.Context, emailID uint64, ticketID uint64) error {
+	result, err := r.db.db.ExecContext(ctx, r.db.dialect.rebind("UPDATE emails SET ticket_id = ? WHERE id = ?"), ticketID, emailID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *EmailRepository) FindTicketEmails(ctx context.Context, ticketID uint64) ([]domain.Email, error) {
+	return r.findEmails(ctx, "ticket_id = ?", ticketID)
+}
+
+// FindTicketIDByMessageID looks a message ID up in the thread index.
+func (r *EmailRepository) FindTicketIDByMessageID(ctx context.Context, messageID string) (uint64, error) {
+	var ticketID uint64
+	err := r.db.db.QueryRowContext(ctx, r.db.dialect.rebind("SELECT ticket_id FROM message_ids WHERE message_id = ?"), messageID).Scan(&ticketID)
+	if err != nil {
+		return 0, notFound(err)
+	}
+
+	return ticketID, nil
+}
+
+// IndexMessageID adds a message ID to the thread index. A message ID already in the index keeps its original ticket.
+func (r *EmailRepository) IndexMessageID(ctx context.Context, messageID string, ticketID uint64) error {
+	_, err := r.db.db.ExecContext(ctx,
+		r.db.dialect.rebind("INSERT INTO message_ids (message_id, ticket_id) VALUES (?, ?) ON CONFLICT (message_id) DO NOTHING"),
+		messageID, ticketID,
+	)
+	return err
+}
+
+// findEmails returns the emails matching the where clause, oldest first.
+func (r *EmailRepository) findEmails(ctx context.Context, where string, args ...any) ([]domain.Email, error) {
+	return r.queryEmails(ctx, "SELECT "+emailColumns+", "+quarantineColumns+" FROM "+emailsJoin+" WHERE "+where+" ORDER BY id", args...)
+}
+
+// queryEmails returns the emails a query selecting emailColumns and quarantineColumns finds, in the query's order.
+func (r *EmailRepository) queryEmails(ctx context.Context, query string, args ...any) ([]domain.Email, error) {
+	rows, err := r.db.db.QueryContext(ctx, r.db.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := make([]domain.Email, 0)
+	for rows.Next() {
+		var (
+			e          domain.Email
+			raw        []byte
+			ticketID   sql.NullInt64
+			auth       authenticationRow
+			spam       spamRow
+			quarantine quarantineRow
+		)
+		dest := append([]any{&e.ID, &e.MessageID, &e.Subject, &e.Sender, &e.Date, &raw, &ticketID, &e.TextBody, &e.HTMLBody, &e.Outbound}, auth.dest()...)
+		dest = append(dest, spam.dest()...)
+		if err := rows.Scan(append(dest, quarantine.dest()...)...); err != nil {
+			return nil, err
+		}
+		e.TicketID = nullableID(ticketID)
+		e.Authentication = auth.authentication()
+		if e.Spam, err = spam.report(); err != nil {
+			return nil, err
+		}
+		if e.Quarantine, err = quarantine.quarantine(); err != nil {
+			return nil, err
+		}
+
+		msg, err := mail.ReadMessage(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("error decoding stored message: %w", err)
+		}
+		e.Message, e.Raw = *msg, raw
+
+		emails = append(emails, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range emails {
+		emails[i].Recipients, err = r.findRecipients(ctx, emails[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		emails[i].Attachments, err = r.findAttachments(ctx, emails[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return emails, nil
+}
+
+func (r *EmailRepository) findRecipients(ctx context.Context, emailID uint64) ([]string, error) {
+	rows, err := r.db.db.QueryContext(ctx, r.db.dialect.rebind("SELECT address FROM email_recipients WHERE email_id = ? ORDER BY position"), emailID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := make([]string, 0)
+	for rows.Next() {
+		var recipient string
+		if err := rows.Scan(&recipient); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, rows.Err()
+}
+
+// findAttachments returns an email's attachments without their content, which can be large.
+func (r *EmailRepository) findAttachments(ctx context.Context, emailID uint64) ([]domain.Attachment, error) {
+	rows, err := r.db.db.QueryContext(ctx, r.db.dialect.rebind("SELECT id, email_id, content_type, filename, size FROM email_attachments WHERE email_id = ? ORDER BY id"), emailID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := make([]domain.Attachment, 0)
+	for rows.Next() {
+		var a domain.Attachment
+		if err := rows.Scan(&a.ID, &a.EmailID, &a.ContentType, &a.Filename, &a.Size); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+
+	return attachments, rows.Err()
+}
+
+// FindAttachment returns a single attachment including its content.
+func (r *EmailRepository) FindAttachment(ctx context.Context, ID uint64) (domain.Attachment, error) {
+	var a domain.Attachment
+	err := r.db.db.QueryRowContext(ctx, r.db.dialect.rebind("SELECT id, email_id, content_type, filename, size, content FROM email_attachments WHERE id = ?"), ID).
+		Scan(&a.ID, &a.EmailID, &a.ContentType, &a.Filename, &a.Size, &a.Content)
+	if err != nil {
+		return domain.Attachment{}, notFound(err)
+	}
+
+	return a, nil
+}
+
+func NewMailServerRepository(db *DB) *MailServerRepository {
+	return &MailServerRepository{
+		EmailRepository: NewEmailRepository(db),
+		aliases:         NewAliasRepository(db),
+		domains:         NewDNSDomainRepository(db),
+	}
+}
+
+// MailServerRepository provides everything the mail server needs from storage.
+type MailServerRepository struct {
+	*EmailRepository
+	aliases *AliasRepository
+	domains *DNSDomainRepository
+}
+
+func (r *MailServerRepository) GetAliases(ctx context.Context, mailDomain *string) ([]domain.Alias, error) {
+	return r.aliases.getAliases(ctx, mailDomain)
+}
+
+// GetAuthoritativeDomains returns the names of the verified domains, as only they receive mail.
+func (r *MailServerRepository) GetAuthoritativeDomains(ctx context.Context) ([]string, error) {
+	domains, err := r.domains.GetDomains(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(domains))
+	for _, d := range domains {
+		if d.IsVerified() {
+			names = append(names, d.Name)
+		}
+	}
+
+	return names, nil
+}
+
+// encodeMessage serialises a message to RFC 5322 form, returning the bytes and the offset the body starts at.
+//
+// Headers are written in sorted order as mail.Header doesn't keep the original order, so it's only for email without Raw.
+func encodeMessage(msg mail.Message) (raw []byte, bodyOffset int, err error) {
+	var buf bytes.Buffer
+
+	keys := make([]string, 0, len(msg.Header))
+	for k := range msg.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range msg.Header[k] {
+			fmt.Fprintf(&buf, "%s: %s\r\n", k, v)
+		}
+	}
+	buf.WriteString("\r\n")
+	bodyOffset = buf.Len()
+
+	if msg.Body != nil {
+		if _, err := io.Copy(&buf, msg.Body); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return buf.Bytes(), bodyOffset, nil
+}
+
+// authenticationArgs are the values of authenticationColumns, with NULL results for email that wasn't checked.
+func authenticationArgs(auth *domain.EmailAuthentication) []any {
+	if auth == nil {
+		return []any{nil, "", nil, "", nil, "", "", false}
+	}
+	return []any{
+		string(auth.SPF.Result), auth.SPF.Domain,
+		string(auth.DKIM.Result), auth.DKIM.Domain,
+		string(auth.DMARC.Result), auth.DMARC.Domain,
+		auth.DMARCPolicy, auth.Flagged,
+	}
+}
+
+// authenticationRow scans authenticationColumns.
+type authenticationRow struct {
+	spf, dkim, dmarc                   sql.NullString
+	spfDomain, dkimDomain, dmarcDomain string
+	dmarcPolicy                        string
+	flagged                            bool
+}
+
+func (a *authenticationRow) dest() []any {
+	return []any{&a.spf, &a.spfDomain, &a.dkim, &a.dkimDomain, &a.dmarc, &a.dmarcDomain, &a.dmarcPolicy, &a.flagged}
+}
+
+func (a *authenticationRow) authentication() *domain.EmailAuthentication {
+	if !a.spf.Valid {
+		return nil
+	}
+	return &domain.EmailAuthentication{
+		SPF:         domain.AuthCheck{Result: domain.AuthResult(a.spf.String), Domain: a.spfDomain},
+		DKIM:        domain.AuthCheck{Result: domain.AuthResult(a.dkim.String), Domain: a.dkimDomain},
+		DMARC:       domain.AuthCheck{Result: domain.AuthResult(a.dmarc.String), Domain: a.dmarcDomain},
+		DMARCPolicy: a.dmarcPolicy,
+		Flagged:     a.flagged,
+	}
+}
+
+// spamArgs are the values of spamColumns, with a NULL score for email that wasn't scored.
+func spamArgs(report *domain.SpamReport) ([]any, error) {
+	if report == nil {
+		return []any{nil, "", ""}, nil
+	}
+	rules, err := json.Marshal(report.Rules)
+	if err != nil {
+		// Only scores that aren't numbers, such as NaN, fail to encode
+		return nil, fmt.Errorf("error encoding spam rules: %w", err)
+	}
+	return []any{report.Score, string(rules), string(report.Action)}, nil
+}
+
+// spamRow scans spamColumns.
+type spamRow struct {
+	score  sql.NullFloat64
+	rules  string
+	action string
+}
+
+func (s *spamRow) dest() []any {
+	return []any{&s.score, &s.rules, &s.action}
+}
+
+func (s *spamRow) report() (*domain.SpamReport, error) {
+	if !s.score.Valid {
+		return nil, nil
+	}
+	report := domain.SpamReport{Score: s.score.Float64, Action: domain.SpamAction(s.action)}
+	if err := json.Unmarshal([]byte(s.rules), &report.Rules); err != nil {
+		return nil, fmt.Errorf("error decoding spam rules: %w", err)
+	}
+	return &report, nil
+}
+
+// quarantineRow scans quarantineColumns.
+type quarantineRow struct {
+	reason        sql.NullString
+	detail        sql.NullString
+	recipients    sql.NullString
+	quarantinedAt sql.NullTime
+}
+
+func (q *quarantineRow) dest() []any {
+	return []any{&q.reason, &q.detail, &q.recipients, &q.quarantinedAt}
+}
+
+func (q *quarantineRow) quarantine() (*domain.Quarantine, error) {
+	if !q.reason.Valid {
+		return nil, nil
+	}
+	recipients, err := decodeTags(q.recipients.String)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Quarantine{
+		Reason:        domain.QuarantineReason(q.reason.String),
+		Detail:        q.detail.String,
+		Recipients:    recipients,
+		QuarantinedAt: q.quarantinedAt.Time,
+	}, nil
+}
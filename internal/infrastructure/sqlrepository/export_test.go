@@ -0,0 +1,9 @@
+package sqlrepository
+
+import "context"
+
+// Exec runs a raw statement, letting the tests poke at the schema directly.
+func (d *DB) Exec(ctx context.Context, query string, args ...any) error {
+	_, err := d.db.ExecContext(ctx, query, args...)
+	return err
+}
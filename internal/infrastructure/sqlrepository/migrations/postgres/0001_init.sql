@@ -0,0 +1,64 @@
+CREATE TABLE users (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    deleted_at TIMESTAMPTZ NULL,
+    first_name TEXT NOT NULL,
+    last_name TEXT NOT NULL
+);
+
+CREATE TABLE dns_domains (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE aliases (
+    id BIGSERIAL PRIMARY KEY,
+    local_part TEXT NOT NULL,
+    domain TEXT NOT NULL,
+    deleted_at TIMESTAMPTZ NULL
+);
+
+-- Only one live alias may exist per address, deleted ones are kept for history
+CREATE UNIQUE INDEX aliases_address_live ON aliases (local_part, domain) WHERE deleted_at IS NULL;
+
+CREATE TABLE tickets (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE ticket_transitions (
+    id BIGSERIAL PRIMARY KEY,
+    ticket_id BIGINT NOT NULL REFERENCES tickets (id),
+    timestamp TIMESTAMPTZ NOT NULL,
+    status INTEGER NOT NULL,
+    owner_id BIGINT NULL,
+    description TEXT NULL
+);
+
+CREATE INDEX ticket_transitions_ticket_id ON ticket_transitions (ticket_id);
+
+-- Transitions are the ticket history, so they may only ever be appended
+CREATE FUNCTION ticket_transitions_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'ticket_transitions is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ticket_transitions_no_update BEFORE UPDATE OR DELETE ON ticket_transitions
+    FOR EACH ROW EXECUTE FUNCTION ticket_transitions_append_only();
+
+CREATE TABLE emails (
+    id BIGSERIAL PRIMARY KEY,
+    subject TEXT NOT NULL,
+    sender TEXT NOT NULL,
+    date TIMESTAMPTZ NOT NULL,
+    raw BYTEA NOT NULL
+);
+
+CREATE TABLE email_recipients (
+    email_id BIGINT NOT NULL REFERENCES emails (id),
+    position INTEGER NOT NULL,
+    address TEXT NOT NULL,
+    PRIMARY KEY (email_id, position)
+);
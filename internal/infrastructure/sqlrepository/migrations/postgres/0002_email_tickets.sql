@@ -0,0 +1,7 @@
+ALTER TABLE emails ADD COLUMN message_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE emails ADD COLUMN ticket_id BIGINT NULL REFERENCES tickets (id);
+
+CREATE INDEX emails_message_id ON emails (message_id);
+CREATE INDEX emails_ticket_id ON emails (ticket_id);
+
+ALTER TABLE ticket_transitions ADD COLUMN email_id BIGINT NULL REFERENCES emails (id);
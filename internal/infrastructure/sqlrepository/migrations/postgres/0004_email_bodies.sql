@@ -0,0 +1,13 @@
+ALTER TABLE emails ADD COLUMN text_body TEXT NOT NULL DEFAULT '';
+ALTER TABLE emails ADD COLUMN html_body TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE email_attachments (
+    id BIGSERIAL PRIMARY KEY,
+    email_id BIGINT NOT NULL REFERENCES emails (id),
+    content_type TEXT NOT NULL,
+    filename TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    content BYTEA NOT NULL
+);
+
+CREATE INDEX email_attachments_email_id ON email_attachments (email_id);
@@ -0,0 +1 @@
+ALTER TABLE emails ADD COLUMN outbound BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,25 @@
+CREATE TABLE outbound_messages (
+    id BIGSERIAL PRIMARY KEY,
+    email_id BIGINT NULL REFERENCES emails (id),
+    ticket_id BIGINT NULL REFERENCES tickets (id),
+    message_id TEXT NOT NULL,
+    sender TEXT NOT NULL,
+    message BYTEA NOT NULL,
+    status INTEGER NOT NULL,
+    attempts INTEGER NOT NULL,
+    -- Unix milliseconds, so it compares the same way in every dialect
+    next_attempt_at BIGINT NOT NULL,
+    last_error TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX outbound_messages_due ON outbound_messages (status, next_attempt_at);
+CREATE INDEX outbound_messages_message_id ON outbound_messages (message_id);
+
+CREATE TABLE outbound_recipients (
+    outbound_message_id BIGINT NOT NULL REFERENCES outbound_messages (id),
+    position INTEGER NOT NULL,
+    address TEXT NOT NULL,
+    PRIMARY KEY (outbound_message_id, position)
+);
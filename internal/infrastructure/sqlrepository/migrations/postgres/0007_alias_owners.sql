@@ -0,0 +1,2 @@
+-- The user allowed to send mail as the alias
+ALTER TABLE aliases ADD COLUMN owner_id BIGINT NULL REFERENCES users (id);
@@ -0,0 +1,19 @@
+-- How the spam filters scored inbound email, NULL if it wasn't scored
+ALTER TABLE emails ADD COLUMN spam_score DOUBLE PRECISION NULL;
+ALTER TABLE emails ADD COLUMN spam_rules TEXT NOT NULL DEFAULT '';
+ALTER TABLE emails ADD COLUMN spam_action TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE ticket_transitions ADD COLUMN spam BOOLEAN NULL;
+
+-- Bayesian classifier training: how many trained messages of each class every token was seen in
+CREATE TABLE spam_tokens (
+    token TEXT PRIMARY KEY,
+    spam_count BIGINT NOT NULL DEFAULT 0,
+    ham_count BIGINT NOT NULL DEFAULT 0
+);
+
+-- The class each email was trained as, so retraining it moves its tokens rather than counting them twice
+CREATE TABLE spam_training (
+    email_id BIGINT PRIMARY KEY REFERENCES emails (id),
+    spam BOOLEAN NOT NULL
+);
@@ -0,0 +1,6 @@
+-- Addresses are case-insensitive, so live aliases must be unique regardless of case
+DROP INDEX aliases_address_live;
+CREATE UNIQUE INDEX aliases_address_live ON aliases (LOWER(local_part), LOWER(domain)) WHERE deleted_at IS NULL;
+
+-- Tags added to the ticket by the transition, as a JSON array
+ALTER TABLE ticket_transitions ADD COLUMN add_tags TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+-- Deleted domains are kept for history, along with their aliases
+ALTER TABLE dns_domains ADD COLUMN deleted_at TIMESTAMPTZ NULL;
+
+-- Only live domains must be unique, regardless of case, so a deleted domain can be added again
+ALTER TABLE dns_domains DROP CONSTRAINT dns_domains_name_key;
+CREATE UNIQUE INDEX dns_domains_name_live ON dns_domains (LOWER(name)) WHERE deleted_at IS NULL;
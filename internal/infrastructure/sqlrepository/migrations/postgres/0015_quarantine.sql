@@ -0,0 +1,19 @@
+-- Private aliases only let known senders open tickets, quarantining mail from anyone else
+ALTER TABLE aliases ADD COLUMN private BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Inbound email held for review rather than opening or updating a ticket
+CREATE TABLE quarantined_emails (
+    email_id BIGINT PRIMARY KEY REFERENCES emails (id),
+    reason TEXT NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    -- Envelope recipients, as a JSON array
+    recipients TEXT NOT NULL DEFAULT '',
+    quarantined_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX quarantined_emails_quarantined_at ON quarantined_emails (quarantined_at);
+
+-- Email the spam filters quarantined before there was a quarantine to review
+INSERT INTO quarantined_emails (email_id, reason, detail, quarantined_at)
+    SELECT id, 'spam', 'scored ' || ROUND(spam_score::numeric, 1), CURRENT_TIMESTAMP FROM emails
+    WHERE spam_action = 'quarantine' AND ticket_id IS NULL;
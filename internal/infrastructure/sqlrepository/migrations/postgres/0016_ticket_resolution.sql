@@ -0,0 +1,2 @@
+-- Status changes can explain themselves, such as why a ticket was closed
+ALTER TABLE ticket_transitions ADD COLUMN resolution TEXT NULL;
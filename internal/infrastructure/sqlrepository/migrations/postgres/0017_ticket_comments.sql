@@ -0,0 +1,23 @@
+-- Public replies and internal notes on the ticket timeline, each added by a transition
+CREATE TABLE ticket_comments (
+    id BIGSERIAL PRIMARY KEY,
+    ticket_id BIGINT NOT NULL REFERENCES tickets (id),
+    author_id BIGINT NOT NULL REFERENCES users (id),
+    body TEXT NOT NULL,
+    visibility INTEGER NOT NULL
+);
+
+CREATE INDEX ticket_comments_ticket_id ON ticket_comments (ticket_id);
+
+CREATE TABLE comment_attachments (
+    id BIGSERIAL PRIMARY KEY,
+    comment_id BIGINT NOT NULL REFERENCES ticket_comments (id),
+    content_type TEXT NOT NULL,
+    filename TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    content BYTEA NOT NULL
+);
+
+CREATE INDEX comment_attachments_comment_id ON comment_attachments (comment_id);
+
+ALTER TABLE ticket_transitions ADD COLUMN comment_id BIGINT NULL REFERENCES ticket_comments (id);
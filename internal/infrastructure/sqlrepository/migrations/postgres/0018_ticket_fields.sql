@@ -0,0 +1,5 @@
+-- Ticket types, tags taken off and custom fields, changed by transitions like everything else
+ALTER TABLE ticket_transitions ADD COLUMN remove_tags TEXT NOT NULL DEFAULT '';
+ALTER TABLE ticket_transitions ADD COLUMN ticket_type INTEGER NOT NULL DEFAULT 0;
+-- Custom field values set, as a JSON object of value lists by field key
+ALTER TABLE ticket_transitions ADD COLUMN set_fields TEXT NOT NULL DEFAULT '';
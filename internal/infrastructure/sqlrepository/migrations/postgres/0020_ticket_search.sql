@@ -0,0 +1,14 @@
+-- Ticket states gain what searches filter and sort on
+ALTER TABLE ticket_states ADD COLUMN updated_at TIMESTAMPTZ NULL;
+ALTER TABLE ticket_states ADD COLUMN description TEXT NOT NULL DEFAULT '';
+
+-- When the ticket last changed in any way, and its latest description
+UPDATE ticket_states SET
+    updated_at = (SELECT timestamp FROM ticket_transitions WHERE ticket_id = ticket_states.ticket_id ORDER BY id DESC LIMIT 1),
+    description = COALESCE((SELECT description FROM ticket_transitions WHERE ticket_id = ticket_states.ticket_id AND description IS NOT NULL ORDER BY id DESC LIMIT 1), '');
+
+ALTER TABLE ticket_states ALTER COLUMN updated_at SET NOT NULL;
+
+CREATE INDEX ticket_states_updated_at ON ticket_states (updated_at);
+CREATE INDEX ticket_states_priority ON ticket_states (priority);
+CREATE INDEX tickets_created_at ON tickets (created_at);
@@ -0,0 +1,65 @@
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    deleted_at DATETIME NULL,
+    first_name TEXT NOT NULL,
+    last_name TEXT NOT NULL
+);
+
+CREATE TABLE dns_domains (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE aliases (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    local_part TEXT NOT NULL,
+    domain TEXT NOT NULL,
+    deleted_at DATETIME NULL
+);
+
+-- Only one live alias may exist per address, deleted ones are kept for history
+CREATE UNIQUE INDEX aliases_address_live ON aliases (local_part, domain) WHERE deleted_at IS NULL;
+
+CREATE TABLE tickets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME NOT NULL
+);
+
+CREATE TABLE ticket_transitions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    ticket_id INTEGER NOT NULL REFERENCES tickets (id),
+    timestamp DATETIME NOT NULL,
+    status INTEGER NOT NULL,
+    owner_id INTEGER NULL,
+    description TEXT NULL
+);
+
+CREATE INDEX ticket_transitions_ticket_id ON ticket_transitions (ticket_id);
+
+-- Transitions are the ticket history, so they may only ever be appended
+CREATE TRIGGER ticket_transitions_no_update BEFORE UPDATE ON ticket_transitions
+BEGIN
+    SELECT RAISE(ABORT, 'ticket_transitions is append-only');
+END;
+
+CREATE TRIGGER ticket_transitions_no_delete BEFORE DELETE ON ticket_transitions
+BEGIN
+    SELECT RAISE(ABORT, 'ticket_transitions is append-only');
+END;
+
+CREATE TABLE emails (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    subject TEXT NOT NULL,
+    sender TEXT NOT NULL,
+    date DATETIME NOT NULL,
+    raw BLOB NOT NULL
+);
+
+CREATE TABLE email_recipients (
+    email_id INTEGER NOT NULL REFERENCES emails (id),
+    position INTEGER NOT NULL,
+    address TEXT NOT NULL,
+    PRIMARY KEY (email_id, position)
+);
@@ -0,0 +1,10 @@
+-- Thread index so replies can be matched to tickets by any message ID in the thread, inbound or outbound
+CREATE TABLE message_ids (
+    message_id TEXT PRIMARY KEY,
+    ticket_id INTEGER NOT NULL REFERENCES tickets (id)
+);
+
+INSERT INTO message_ids (message_id, ticket_id)
+    SELECT message_id, MIN(ticket_id) FROM emails
+    WHERE ticket_id IS NOT NULL AND message_id <> ''
+    GROUP BY message_id;
@@ -0,0 +1,25 @@
+CREATE TABLE outbound_messages (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email_id INTEGER NULL REFERENCES emails (id),
+    ticket_id INTEGER NULL REFERENCES tickets (id),
+    message_id TEXT NOT NULL,
+    sender TEXT NOT NULL,
+    message BLOB NOT NULL,
+    status INTEGER NOT NULL,
+    attempts INTEGER NOT NULL,
+    -- Unix milliseconds, so it compares the same way in every dialect
+    next_attempt_at INTEGER NOT NULL,
+    last_error TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE INDEX outbound_messages_due ON outbound_messages (status, next_attempt_at);
+CREATE INDEX outbound_messages_message_id ON outbound_messages (message_id);
+
+CREATE TABLE outbound_recipients (
+    outbound_message_id INTEGER NOT NULL REFERENCES outbound_messages (id),
+    position INTEGER NOT NULL,
+    address TEXT NOT NULL,
+    PRIMARY KEY (outbound_message_id, position)
+);
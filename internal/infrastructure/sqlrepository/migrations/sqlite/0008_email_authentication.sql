@@ -0,0 +1,9 @@
+-- SPF, DKIM and DMARC results of inbound email, NULL if it wasn't checked
+ALTER TABLE emails ADD COLUMN spf_result TEXT NULL;
+ALTER TABLE emails ADD COLUMN spf_domain TEXT NOT NULL DEFAULT '';
+ALTER TABLE emails ADD COLUMN dkim_result TEXT NULL;
+ALTER TABLE emails ADD COLUMN dkim_domain TEXT NOT NULL DEFAULT '';
+ALTER TABLE emails ADD COLUMN dmarc_result TEXT NULL;
+ALTER TABLE emails ADD COLUMN dmarc_domain TEXT NOT NULL DEFAULT '';
+ALTER TABLE emails ADD COLUMN dmarc_policy TEXT NOT NULL DEFAULT '';
+ALTER TABLE emails ADD COLUMN auth_flagged BOOLEAN NOT NULL DEFAULT FALSE;
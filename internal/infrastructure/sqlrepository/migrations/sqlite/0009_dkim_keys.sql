@@ -0,0 +1,4 @@
+-- The key outbound mail from a domain is signed with, NULL until one is generated
+ALTER TABLE dns_domains ADD COLUMN dkim_selector TEXT NULL;
+ALTER TABLE dns_domains ADD COLUMN dkim_private_key TEXT NULL;
+ALTER TABLE dns_domains ADD COLUMN dkim_created_at DATETIME NULL;
@@ -0,0 +1,9 @@
+-- Where tickets opened by mail to the alias land
+ALTER TABLE aliases ADD COLUMN queue TEXT NOT NULL DEFAULT '';
+ALTER TABLE aliases ADD COLUMN default_owner_id INTEGER NULL REFERENCES users (id);
+ALTER TABLE aliases ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+-- Tags added to the tickets, as a JSON array
+ALTER TABLE aliases ADD COLUMN tags TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE ticket_transitions ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE ticket_transitions ADD COLUMN queue TEXT NULL;
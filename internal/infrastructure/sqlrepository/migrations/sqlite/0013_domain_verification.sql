@@ -0,0 +1,6 @@
+-- Domains are verified with a TXT record before we handle their mail
+ALTER TABLE dns_domains ADD COLUMN verification_token TEXT NOT NULL DEFAULT '';
+ALTER TABLE dns_domains ADD COLUMN verified_at DATETIME NULL;
+
+-- Domains added before verification existed already receive mail
+UPDATE dns_domains SET verified_at = CURRENT_TIMESTAMP;
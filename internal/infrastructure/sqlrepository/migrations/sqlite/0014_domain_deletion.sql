@@ -0,0 +1,19 @@
+-- Deleted domains are kept for history, along with their aliases.
+-- SQLite can't drop the UNIQUE constraint on name, so the table is rebuilt without it
+CREATE TABLE dns_domains_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    dkim_selector TEXT NULL,
+    dkim_private_key TEXT NULL,
+    dkim_created_at DATETIME NULL,
+    verification_token TEXT NOT NULL DEFAULT '',
+    verified_at DATETIME NULL,
+    deleted_at DATETIME NULL
+);
+INSERT INTO dns_domains_new (id, name, dkim_selector, dkim_private_key, dkim_created_at, verification_token, verified_at)
+    SELECT id, name, dkim_selector, dkim_private_key, dkim_created_at, verification_token, verified_at FROM dns_domains;
+DROP TABLE dns_domains;
+ALTER TABLE dns_domains_new RENAME TO dns_domains;
+
+-- Only live domains must be unique, regardless of case, so a deleted domain can be added again
+CREATE UNIQUE INDEX dns_domains_name_live ON dns_domains (LOWER(name)) WHERE deleted_at IS NULL;
@@ -0,0 +1,32 @@
+-- The current state of every ticket for filtering, rebuilt from its transitions whenever one is appended.
+-- Tickets opened before this migration are backfilled once it's applied.
+CREATE TABLE ticket_states (
+    ticket_id INTEGER PRIMARY KEY REFERENCES tickets (id),
+    status INTEGER NOT NULL,
+    owner_id INTEGER NULL,
+    priority INTEGER NOT NULL,
+    ticket_type INTEGER NOT NULL,
+    queue TEXT NOT NULL,
+    spam BOOLEAN NOT NULL
+);
+
+CREATE INDEX ticket_states_status ON ticket_states (status);
+CREATE INDEX ticket_states_owner_id ON ticket_states (owner_id);
+
+CREATE TABLE ticket_state_tags (
+    ticket_id INTEGER NOT NULL REFERENCES tickets (id),
+    tag TEXT NOT NULL,
+    PRIMARY KEY (ticket_id, tag)
+);
+
+CREATE INDEX ticket_state_tags_tag ON ticket_state_tags (tag);
+
+-- One row per value, so multiselect fields match any of theirs
+CREATE TABLE ticket_state_fields (
+    ticket_id INTEGER NOT NULL REFERENCES tickets (id),
+    field_key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY (ticket_id, field_key, value)
+);
+
+CREATE INDEX ticket_state_fields_value ON ticket_state_fields (field_key, value);
@@ -0,0 +1,22 @@
+-- The full-text index: the text of tickets, their comments and email, and the position of every term in it
+CREATE TABLE ticket_texts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    ticket_id INTEGER NOT NULL REFERENCES tickets (id),
+    source TEXT NOT NULL,
+    -- The comment or email the text comes from, 0 for the description
+    source_id INTEGER NOT NULL,
+    body TEXT NOT NULL
+);
+
+CREATE INDEX ticket_texts_ticket_id ON ticket_texts (ticket_id);
+
+CREATE TABLE ticket_text_terms (
+    text_id INTEGER NOT NULL REFERENCES ticket_texts (id),
+    position INTEGER NOT NULL,
+    ticket_id INTEGER NOT NULL REFERENCES tickets (id),
+    term TEXT NOT NULL,
+    PRIMARY KEY (text_id, position)
+);
+
+CREATE INDEX ticket_text_terms_term ON ticket_text_terms (term, ticket_id);
+CREATE INDEX ticket_text_terms_ticket_id ON ticket_text_terms (ticket_id);
@@ -0,0 +1,2 @@
+-- Timestamps compared in queries used to be written in the server's time zone, which SQLite compares as text.
+-- They're rewritten in UTC once this is applied. Transitions are append-only and never compared, so they're left as written.
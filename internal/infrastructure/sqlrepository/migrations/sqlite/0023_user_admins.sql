@@ -0,0 +1,2 @@
+-- Admins manage mail domains, DKIM keys and the quarantine
+ALTER TABLE users ADD COLUMN admin BOOLEAN NOT NULL DEFAULT FALSE;
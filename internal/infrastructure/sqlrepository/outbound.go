@@ -0,0 +1,153 @@
+package sqlrepository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/nil-nil/ticket/internal/domain"
+)
+
+// Make sure we conform to domain.OutboundRepository
+var _ domain.OutboundRepository = (*OutboundRepository)(nil)
+
+const outboundColumns = "id, email_id, ticket_id, message_id, sender, message, status, attempts, next_attempt_at, last_error, created_at, updated_at"
+
+func NewOutboundRepository(db *DB) *OutboundRepository {
+	return &OutboundRepository{db: db}
+}
+
+type OutboundRepository struct {
+	db *DB
+}
+
+func (r *OutboundRepository) Enqueue(ctx context.Context, msg domain.OutboundMessage) (domain.OutboundMessage, error) {
+	err := r.db.inTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx,
+			r.db.dialect.rebind("INSERT INTO outbound_messages (email_id, ticket_id, message_id, sender, message, status, attempts, next_attempt_at, last_error, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id"),
+			msg.EmailID, msg.TicketID, msg.MessageID, msg.From, msg.Message, msg.Status, msg.Attempts, msg.NextAttemptAt.UnixMilli(), msg.LastError, msg.CreatedAt.UTC(), msg.UpdatedAt.UTC(),
+		).Scan(&msg.ID)
+		if err != nil {
+			return err
+		}
+
+		for i, recipient := range msg.To {
+			_, err := tx.ExecContext(ctx, r.db.dialect.rebind("INSERT INTO outbound_recipients (outbound_message_id, position, address) VALUES (?, ?, ?)"), msg.ID, i, recipient)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return domain.OutboundMessage{}, err
+	}
+
+	return r.find(ctx, msg.ID)
+}
+
+func (r *OutboundRepository) FindDue(ctx context.Context, now time.Time, limit int) ([]domain.OutboundMessage, error) {
+	return r.findMessages(ctx,
+		"status IN (?, ?) AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?",
+		domain.OutboundStatusQueued, domain.OutboundStatusDeferred, now.UnixMilli(), limit,
+	)
+}
+
+func (r *OutboundRepository) FindByMessageID(ctx context.Context, messageID string) (domain.OutboundMessage, error) {
+	messages, err := r.findMessages(ctx, "message_id = ? ORDER BY id DESC LIMIT 1", messageID)
+	if err != nil {
+		return domain.OutboundMessage{}, err
+	}
+	if len(messages) == 0 {
+		return domain.OutboundMessage{}, domain.ErrNotFound
+	}
+
+	return messages[0], nil
+}
+
+func (r *OutboundRepository) Update(ctx context.Context, ID uint64, Params domain.OutboundUpdateParameters) (domain.OutboundMessage, error) {
+	result, err := r.db.db.ExecContext(ctx,
+		r.db.dialect.rebind("UPDATE outbound_messages SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ?, updated_at = ? WHERE id = ?"),
+		Params.Status, Params.Attempts, Params.NextAttemptAt.UnixMilli(), Params.LastError, time.Now().UTC(), ID,
+	)
+	if err != nil {
+		return domain.OutboundMessage{}, err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return domain.OutboundMessage{}, domain.ErrNotFound
+	}
+
+	return r.find(ctx, ID)
+}
+
+func (r *OutboundRepository) find(ctx context.Context, ID uint64) (domain.OutboundMessage, error) {
+	messages, err := r.findMessages(ctx, "id = ?", ID)
+	if err != nil {
+		return domain.OutboundMessage{}, err
+	}
+	if len(messages) == 0 {
+		return domain.OutboundMessage{}, domain.ErrNotFound
+	}
+
+	return messages[0], nil
+}
+
+// findMessages returns the messages matching the where clause, which may also order and limit them.
+func (r *OutboundRepository) findMessages(ctx context.Context, where string, args ...any) ([]domain.OutboundMessage, error) {
+	rows, err := r.db.db.QueryContext(ctx, r.db.dialect.rebind("SELECT "+outboundColumns+" FROM outbound_messages WHERE "+where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]domain.OutboundMessage, 0)
+	for rows.Next() {
+		var (
+			msg           domain.OutboundMessage
+			emailID       sql.NullInt64
+			ticketID      sql.NullInt64
+			nextAttemptAt int64
+		)
+		err := rows.Scan(&msg.ID, &emailID, &ticketID, &msg.MessageID, &msg.From, &msg.Message, &msg.Status, &msg.Attempts, &nextAttemptAt, &msg.LastError, &msg.CreatedAt, &msg.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		msg.EmailID = nullableID(emailID)
+		msg.TicketID = nullableID(ticketID)
+		msg.NextAttemptAt = time.UnixMilli(nextAttemptAt)
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range messages {
+		messages[i].To, err = r.findRecipients(ctx, messages[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return messages, nil
+}
+
+func (r *OutboundRepository) findRecipients(ctx context.Context, ID uint64) ([]string, error) {
+	rows, err := r.db.db.QueryContext(ctx, r.db.dialect.rebind("SELECT address FROM outbound_recipients WHERE outbound_message_id = ? ORDER BY position"), ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := make([]string, 0)
+	for rows.Next() {
+		var recipient string
+		if err := rows.Scan(&recipient); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, rows.Err()
+}
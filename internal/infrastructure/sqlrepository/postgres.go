@@ -0,0 +1,43 @@
+package sqlrepository
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+var (
+	//go:embed migrations/postgres/*.sql
+	postgresMigrations embed.FS
+)
+
+// OpenPostgres connects to the PostgreSQL database at dsn.
+//
+// The dsn can be a URL or a keyword/value connection string. Call Migrate before using the repositories.
+func OpenPostgres(ctx context.Context, dsn string) (*DB, error) {
+	migrations, err := fs.Sub(postgresMigrations, "migrations/postgres")
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &DB{
+		db: db,
+		dialect: dialect{
+			name:       "postgres",
+			migrations: migrations,
+			rebind:     rebindDollar,
+		},
+	}, nil
+}
@@ -0,0 +1,163 @@
+package sqlrepository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/nil-nil/ticket/internal/services/email"
+)
+
+// Make sure we conform to email.QuarantineRepository
+var _ email.QuarantineRepository = (*MailServerRepository)(nil)
+
+// FindQuarantined returns the email in quarantine matching the filter, newest first.
+func (r *EmailRepository) FindQuarantined(ctx context.Context, filter domain.QuarantineFilter) ([]domain.Email, error) {
+	conditions := []string{"quarantined_emails.email_id IS NOT NULL"}
+	var args []any
+	if filter.Reason != nil {
+		conditions = append(conditions, "reason = ?")
+		args = append(args, string(*filter.Reason))
+	}
+	if filter.Before != nil {
+		conditions = append(conditions, "id < ?")
+		args = append(args, *filter.Before)
+	}
+
+	query := "SELECT " + emailColumns + ", " + quarantineColumns + " FROM " + emailsJoin + " WHERE " + strings.Join(conditions, " AND ") + " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	return r.queryEmails(ctx, query, args...)
+}
+
+// ReleaseQuarantined takes the email out of quarantine, returning domain.ErrNotFound if it isn't in quarantine.
+func (r *EmailRepository) ReleaseQuarantined(ctx context.Context, ID uint64) error {
+	result, err := r.db.db.ExecContext(ctx, r.db.dialect.rebind("DELETE FROM quarantined_emails WHERE email_id = ?"), ID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+// RestoreQuarantined puts released email back in quarantine as it was.
+func (r *EmailRepository) RestoreQuarantined(ctx context.Context, ID uint64, quarantine domain.Quarantine) error {
+	return r.insertQuarantine(ctx, r.db.db, ID, quarantine)
+}
+
+func (r *EmailRepository) insertQuarantine(ctx context.Context, q querier, ID uint64, quarantine domain.Quarantine) error {
+	recipients, err := encodeTags(quarantine.Recipients)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx,
+		r.db.dialect.rebind("INSERT INTO quarantined_emails (email_id, reason, detail, recipients, quarantined_at) VALUES (?, ?, ?, ?, ?)"),
+		ID, string(quarantine.Reason), quarantine.Detail, recipients, quarantine.QuarantinedAt.UTC(),
+	)
+	return err
+}
+
+// DeleteQuarantined deletes the email along with its recipients and attachments, returning domain.ErrNotFound if it isn't in quarantine.
+func (r *EmailRepository) DeleteQuarantined(ctx context.Context, ID uint64) error {
+	return r.db.inTx(ctx, func(tx *sql.Tx) error {
+		return r.deleteQuarantined(ctx, tx, ID)
+	})
+}
+
+// ExpireQuarantine deletes the email quarantined before the time, returning how much was deleted.
+func (r *EmailRepository) ExpireQuarantine(ctx context.Context, before time.Time) (int, error) {
+	var expired int
+	err := r.db.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, r.db.dialect.rebind("SELECT email_id FROM quarantined_emails WHERE quarantined_at < ? ORDER BY email_id"), before.UTC())
+		if err != nil {
+			return err
+		}
+		var ids []uint64
+		for rows.Next() {
+			var ID uint64
+			if err := rows.Scan(&ID); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, ID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, ID := range ids {
+			if err := r.deleteQuarantined(ctx, tx, ID); err != nil {
+				return err
+			}
+		}
+		expired = len(ids)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return expired, nil
+}
+
+func (r *EmailRepository) deleteQuarantined(ctx context.Context, tx *sql.Tx, ID uint64) error {
+	result, err := tx.ExecContext(ctx, r.db.dialect.rebind("DELETE FROM quarantined_emails WHERE email_id = ?"), ID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return domain.ErrNotFound
+	}
+
+	return r.deleteEmail(ctx, tx, ID)
+}
+
+// DeleteEmail deletes an email nothing refers to yet, along with its recipients and attachments.
+func (r *EmailRepository) DeleteEmail(ctx context.Context, ID uint64) error {
+	return r.db.inTx(ctx, func(tx *sql.Tx) error {
+		return r.deleteEmail(ctx, tx, ID)
+	})
+}
+
+func (r *EmailRepository) deleteEmail(ctx context.Context, tx *sql.Tx, ID uint64) error {
+	for _, query := range []string{
+		"DELETE FROM email_attachments WHERE email_id = ?",
+		"DELETE FROM email_recipients WHERE email_id = ?",
+		"DELETE FROM emails WHERE id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, r.db.dialect.rebind(query), ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// IsKnownSender checks whether we've ticketed mail from the address or sent mail to it, regardless of case.
+func (r *EmailRepository) IsKnownSender(ctx context.Context, address string) (bool, error) {
+	address = strings.ToLower(address)
+	var known int
+	err := r.db.db.QueryRowContext(ctx, r.db.dialect.rebind(
+		"SELECT 1 FROM emails WHERE outbound = FALSE AND ticket_id IS NOT NULL AND LOWER(sender) = ?"+
+			" UNION ALL SELECT 1 FROM email_recipients JOIN emails ON emails.id = email_recipients.email_id WHERE emails.outbound = TRUE AND LOWER(email_recipients.address) = ?"+
+			" LIMIT 1",
+	), address, address).Scan(&known)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,251 @@
+package sqlrepository_test
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/nil-nil/ticket/internal/infrastructure/ristrettocache"
+	"github.com/nil-nil/ticket/internal/infrastructure/sqlrepository"
+	"github.com/nil-nil/ticket/internal/infrastructure/ticketeventbus"
+	"github.com/nil-nil/ticket/internal/services/email"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestServices runs the domain services on top of the repositories to check they honour the same contract as the mocks.
+func TestServices(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			cache, err := ristrettocache.NewCache(nil)
+			require.NoError(t, err)
+			bus, err := ticketeventbus.NewBus(":")
+			require.NoError(t, err)
+			indexer := sqlrepository.NewTicketIndexer(db)
+			require.NoError(t, indexer.Subscribe(bus, nil))
+			search := func(text string) []uint64 {
+				page, err := sqlrepository.NewTicketRepository(db).Search(ctx, domain.TicketQuery{Text: text, Sort: domain.TicketSort{Field: domain.TicketSortCreated}, Limit: domain.MaxSearchLimit})
+				require.NoError(t, err)
+				IDs := make([]uint64, 0, len(page.Tickets))
+				for _, ticket := range page.Tickets {
+					IDs = append(IDs, ticket.ID)
+				}
+				return IDs
+			}
+
+			t.Run("tickets", func(t *testing.T) {
+				svc := domain.NewTicketService(sqlrepository.NewTicketRepository(db), bus, cache)
+
+				ticket, err := svc.OpenTicket(ctx, "test")
+				assert.NoError(t, err)
+				ticket, err = svc.UpdateTicket(ctx, ticket.ID, domain.TicketUpdateParameters{Status: domain.TicketStatusClosed})
+				assert.NoError(t, err)
+
+				assert.Equal(t, domain.TicketStatusClosed, ticket.Meta().Status)
+
+				author, err := sqlrepository.NewUserRepository(db).Create(ctx, "Carol", "Agent")
+				require.NoError(t, err)
+				_, err = svc.AddComment(ctx, ticket.ID, domain.TicketComment{AuthorID: author.ID, Body: "Replaced the toner", Visibility: domain.CommentVisibilityInternal})
+				require.NoError(t, err)
+				assert.Eventually(t, func() bool {
+					return slices.Equal([]uint64{ticket.ID}, search("toner"))
+				}, time.Second, 10*time.Millisecond, "comments should be indexed as they're added")
+
+				got, err := svc.GetTicket(ctx, ticket.ID)
+				assert.NoError(t, err)
+				assert.Equal(t, ticket.ID, got.ID)
+
+				_, err = svc.GetTicket(ctx, ticket.ID+1000)
+				assert.ErrorIs(t, err, domain.ErrNotFound)
+			})
+
+			t.Run("users", func(t *testing.T) {
+				svc := domain.NewUserService(sqlrepository.NewUserRepository(db), bus)
+
+				u, err := svc.CreateUser(ctx, "Bob", "Test")
+				assert.NoError(t, err)
+				got, err := svc.GetUser(ctx, u.ID)
+				assert.NoError(t, err)
+				assert.Equal(t, u, got)
+			})
+
+			t.Run("mail", func(t *testing.T) {
+				domains, err := domain.NewDNSDomainService(sqlrepository.NewDNSDomainRepository(db), bus, cache)
+				require.NoError(t, err)
+				testDomain, err := domains.CreateDomain(ctx, "test.com")
+				require.NoError(t, err)
+				unverified, err := sqlrepository.NewMailServerRepository(db).GetAuthoritativeDomains(ctx)
+				require.NoError(t, err)
+				assert.NotContains(t, unverified, "test.com", "unverified domains shouldn't receive mail")
+				domains.Resolver = staticResolver{txt: []string{testDomain.VerificationRecord().Value}}
+				_, err = domains.VerifyDomain(ctx, testDomain.ID)
+				require.NoError(t, err)
+
+				aliases := domain.NewAliasService(sqlrepository.NewAliasRepository(db), bus)
+				alias, err := aliases.Create(ctx, "test", "test.com")
+				require.NoError(t, err)
+				agent, err := sqlrepository.NewUserRepository(db).Create(ctx, "Alice", "Agent")
+				require.NoError(t, err)
+				_, err = aliases.SetOwner(ctx, alias.ID, &agent.ID)
+				require.NoError(t, err)
+				deleted, err := aliases.Create(ctx, "bob", "test.com")
+				require.NoError(t, err)
+				_, err = aliases.Delete(ctx, deleted.ID)
+				require.NoError(t, err)
+
+				repo := sqlrepository.NewMailServerRepository(db)
+				tickets := domain.NewTicketService(sqlrepository.NewTicketRepository(db), bus, cache)
+				outboundQueue, err := domain.NewOutboundQueue(sqlrepository.NewOutboundRepository(db), bus, domain.DefaultRetryPolicy)
+				require.NoError(t, err)
+				server := email.NewServer(repo, tickets, outboundQueue, cache, bus, nil)
+				assert.NoError(t, server.ValidateRecipientAddress(nil, "test@test.com"))
+				assert.ErrorIs(t, server.ValidateRecipientAddress(nil, "bob@test.com"), email.ErrAliasNotFound)
+				assert.ErrorIs(t, server.ValidateRecipientAddress(nil, "fail@test.com"), email.ErrAliasNotFound)
+				assert.ErrorIs(t, server.ValidateRecipientAddress(nil, "alan@example.com"), email.ErrRelayDenied)
+				assert.NoError(t, server.ValidateRecipientAddress(&agent, "alan@example.com"))
+				assert.NoError(t, server.ValidateSenderAddress(&agent, "test@test.com"))
+				assert.ErrorIs(t, server.ValidateSenderAddress(&domain.User{ID: agent.ID + 1}, "test@test.com"), email.ErrSenderNotAllowed)
+
+				envelope := email.Envelope{From: "bob@example.com", To: []string{"test@test.com"}}
+				err = server.ReceiveData(envelope, strings.NewReader("Message-ID: <1@example.com>\r\nSubject: Hello\r\nFrom: Bob <bob@example.com>\r\nTo: test@test.com\r\n\r\nBody\r\n"))
+				assert.NoError(t, err)
+				stored, err := repo.FindEmail(ctx, 1)
+				assert.NoError(t, err)
+				assert.Equal(t, "Hello", stored.Subject)
+				assert.Equal(t, []string{"test@test.com"}, stored.Recipients)
+				assert.NotNil(t, stored.TicketID, "email should open a ticket")
+
+				err = server.ReceiveData(envelope, strings.NewReader("Message-ID: <2@example.com>\r\nIn-Reply-To: <1@example.com>\r\nSubject: Re: Hello\r\n\r\nReply\r\n"))
+				assert.NoError(t, err)
+				ticketEmails, err := repo.FindTicketEmails(ctx, *stored.TicketID)
+				assert.NoError(t, err)
+				assert.Len(t, ticketEmails, 2, "reply should be linked to the same ticket")
+				// Read from the repository as the service cache is refreshed asynchronously
+				ticket, err := sqlrepository.NewTicketRepository(db).Find(ctx, *stored.TicketID)
+				assert.NoError(t, err)
+				assert.Equal(t, &ticketEmails[1].ID, ticket.Transitions[len(ticket.Transitions)-1].EmailID, "reply should be recorded on the ticket")
+
+				replies, err := email.NewReplyService(repo, tickets, outboundQueue, cache, bus)
+				require.NoError(t, err)
+				sent, err := replies.Reply(ctx, *stored.TicketID, "On it")
+				assert.NoError(t, err)
+				sender := &recordingSender{}
+				assert.NoError(t, outboundQueue.ProcessDue(ctx, sender))
+				assert.Equal(t, []string{"bob@example.com"}, sender.to, "queued reply should be delivered to the customer")
+				outbound, err := repo.FindEmail(ctx, sent.ID)
+				assert.NoError(t, err)
+				assert.True(t, outbound.Outbound, "reply should be stored as outbound")
+				assert.Equal(t, "test@test.com", outbound.Sender, "reply should be sent from the alias")
+				assert.Equal(t, stored.TicketID, outbound.TicketID, "reply should be linked to the ticket")
+
+				err = server.ReceiveData(envelope, strings.NewReader("Message-ID: <3@example.com>\r\nIn-Reply-To: <"+sent.MessageID+">\r\nSubject: Re: Hello\r\n\r\nThanks\r\n"))
+				assert.NoError(t, err)
+				ticketEmails, err = repo.FindTicketEmails(ctx, *stored.TicketID)
+				assert.NoError(t, err)
+				assert.Len(t, ticketEmails, 4, "answer to the reply should be linked to the same ticket")
+
+				failures := make(chan domain.DeliveryFailure, 1)
+				deliveryEvents, err := domain.NewEventBus[domain.DeliveryFailure]("tickets", bus)
+				require.NoError(t, err)
+				require.NoError(t, deliveryEvents.Subscribe(nil, []domain.EventType{domain.DeliveryFailedEvent}, func(eventType domain.EventType, data domain.DeliveryFailure) {
+					failures <- data
+				}))
+				bounce := "Content-Type: multipart/report; report-type=delivery-status; boundary=B\r\n\r\n--B\r\nContent-Type: message/delivery-status\r\n\r\nReporting-MTA: dns; mx.example.com\r\n\r\nFinal-Recipient: rfc822; bob@example.com\r\nAction: failed\r\nStatus: 5.1.1\r\n\r\n--B\r\nContent-Type: text/rfc822-headers\r\n\r\nMessage-ID: <" + sent.MessageID + ">\r\n\r\n--B--\r\n"
+				assert.NoError(t, server.ReceiveData(email.Envelope{To: []string{"test@test.com"}}, strings.NewReader(bounce)))
+				failed, err := sqlrepository.NewOutboundRepository(db).FindByMessageID(ctx, sent.MessageID)
+				assert.NoError(t, err)
+				assert.Equal(t, domain.OutboundStatusFailed, failed.Status, "bounce should fail the delivered reply")
+				select {
+				case failure := <-failures:
+					assert.Equal(t, *stored.TicketID, failure.TicketID, "failure should be published on the ticket")
+				case <-time.After(time.Second):
+					t.Error("delivery failure wasn't published")
+				}
+
+				submission := email.Envelope{From: "test@test.com", To: []string{"alan@example.com"}, User: &agent}
+				err = server.ReceiveData(submission, strings.NewReader("Message-ID: <4@test.com>\r\nFrom: test@test.com\r\nTo: alan@example.com\r\nSubject: Hi\r\n\r\nHello\r\n"))
+				assert.NoError(t, err)
+				relayed, err := sqlrepository.NewOutboundRepository(db).FindByMessageID(ctx, "4@test.com")
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"alan@example.com"}, relayed.To, "authenticated mail should be queued for relay")
+				assert.NoError(t, outboundQueue.ProcessDue(ctx, sender))
+				assert.Equal(t, []string{"alan@example.com"}, sender.to, "relayed mail should be delivered")
+
+				sales, err := aliases.Create(ctx, "sales", "test.com")
+				require.NoError(t, err)
+				_, err = aliases.SetRouting(ctx, sales.ID, domain.AliasRouting{Queue: "sales", DefaultOwnerID: &agent.ID, Priority: domain.TicketPriorityHigh, Tags: []string{"lead"}})
+				require.NoError(t, err)
+				// A service sharing the server's cache sees the aliases the server has cached
+				mailService, err := email.NewMailServerService(repo, cache, bus)
+				require.NoError(t, err)
+				assert.Eventually(t, func() bool {
+					cached, err := mailService.GetAlias(ctx, "sales", "test.com")
+					return err == nil && cached.ID == sales.ID && cached.Routing.Queue == "sales"
+				}, time.Second, 10*time.Millisecond, "routing changes should refresh the alias cache")
+
+				err = server.ReceiveData(email.Envelope{From: "bob@example.com", To: []string{"sales+eu@test.com"}}, strings.NewReader("Message-ID: <5@example.com>\r\nSubject: Quote\r\n\r\nHow much?\r\n"))
+				assert.NoError(t, err)
+				quote, err := sqlrepository.NewMailServerRepository(db).FindTicketIDByMessageID(ctx, "5@example.com")
+				require.NoError(t, err)
+				ticket, err = sqlrepository.NewTicketRepository(db).Find(ctx, quote)
+				require.NoError(t, err)
+				meta := ticket.Meta()
+				assert.Equal(t, "sales", meta.Queue, "the ticket should be filed in the alias's queue")
+				assert.Equal(t, &agent.ID, meta.OwnerID, "the ticket should be assigned to the alias's default owner")
+				assert.Equal(t, domain.TicketPriorityHigh, meta.Priority)
+				assert.Equal(t, []string{"lead", "eu"}, meta.Tags, "the alias's tags and the subaddress should tag the ticket")
+				assert.Eventually(t, func() bool {
+					return slices.Equal([]uint64{quote}, search(`"how much"`))
+				}, time.Second, 10*time.Millisecond, "email should be indexed as it's linked to its ticket")
+
+				_, err = domains.DeleteDomain(ctx, testDomain.ID)
+				require.NoError(t, err)
+				assert.Eventually(t, func() bool {
+					return server.ValidateRecipientAddress(nil, "test@test.com") != nil
+				}, time.Second, 10*time.Millisecond, "a deleted domain's mail should be refused")
+				deactivated, err := aliases.Find(ctx, domain.FindAliasParameters{ID: &alias.ID})
+				require.NoError(t, err)
+				assert.NotNil(t, deactivated.DeletedAt, "a deleted domain's aliases should be deactivated")
+			})
+
+			t.Run("reindex", func(t *testing.T) {
+				all, err := sqlrepository.NewTicketRepository(db).Search(ctx, domain.TicketQuery{Sort: domain.TicketSort{Field: domain.TicketSortCreated}, Limit: domain.MaxSearchLimit})
+				require.NoError(t, err)
+				indexed, err := indexer.Rebuild(ctx)
+				assert.NoError(t, err)
+				assert.Equal(t, len(all.Tickets), indexed, "every ticket should be reindexed")
+				assert.NotEmpty(t, search("toner"))
+			})
+
+		})
+	}
+}
+
+// staticResolver answers every lookup with the same records.
+type staticResolver struct {
+	txt []string
+	mx  []*net.MX
+}
+
+func (r staticResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return r.txt, nil
+}
+
+func (r staticResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	return r.mx, nil
+}
+
+type recordingSender struct {
+	from string
+	to   []string
+}
+
+func (s *recordingSender) Send(ctx context.Context, from string, to []string, message []byte) error {
+	s.from, s.to = from, to
+	return nil
+}
@@ -0,0 +1,137 @@
+package sqlrepository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/nil-nil/ticket/internal/domain"
+)
+
+// Make sure we conform to domain.SpamTrainingRepository
+var _ domain.SpamTrainingRepository = (*SpamRepository)(nil)
+
+// spamTokenBatch bounds the number of parameters in each token query, which SQLite limits
+const spamTokenBatch = 500
+
+func NewSpamRepository(db *DB) *SpamRepository {
+	return &SpamRepository{db: db}
+}
+
+type SpamRepository struct {
+	db *DB
+}
+
+func (r *SpamRepository) SpamTokenCounts(ctx context.Context, tokens []string) (map[string]domain.SpamTokenCount, error) {
+	counts := make(map[string]domain.SpamTokenCount, len(tokens))
+	for start := 0; start < len(tokens); start += spamTokenBatch {
+		batch := tokens[start:min(start+spamTokenBatch, len(tokens))]
+		args := make([]any, 0, len(batch))
+		for _, token := range batch {
+			args = append(args, token)
+		}
+
+		rows, err := r.db.db.QueryContext(ctx,
+			r.db.dialect.rebind("SELECT token, spam_count, ham_count FROM spam_tokens WHERE token IN ("+placeholders(len(batch))+")"),
+			args...,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var (
+				token string
+				count domain.SpamTokenCount
+			)
+			if err := rows.Scan(&token, &count.Spam, &count.Ham); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			counts[token] = count
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return counts, nil
+}
+
+func (r *SpamRepository) SpamTrainingTotals(ctx context.Context) (spam, ham int, err error) {
+	rows, err := r.db.db.QueryContext(ctx, "SELECT spam, COUNT(*) FROM spam_training GROUP BY spam")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			isSpam bool
+			count  int
+		)
+		if err := rows.Scan(&isSpam, &count); err != nil {
+			return 0, 0, err
+		}
+		if isSpam {
+			spam = count
+		} else {
+			ham = count
+		}
+	}
+
+	return spam, ham, rows.Err()
+}
+
+// TrainSpam records the email's class and adds its tokens to that class's counts, taking them from the other class if it was trained as that before.
+func (r *SpamRepository) TrainSpam(ctx context.Context, emailID uint64, tokens []string, spam bool) error {
+	return r.db.inTx(ctx, func(tx *sql.Tx) error {
+		var trained bool
+		err := tx.QueryRowContext(ctx, r.db.dialect.rebind("SELECT spam FROM spam_training WHERE email_id = ?"), emailID).Scan(&trained)
+		retrain := err == nil
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if retrain && trained == spam {
+			return nil
+		}
+
+		if retrain {
+			_, err = tx.ExecContext(ctx, r.db.dialect.rebind("UPDATE spam_training SET spam = ? WHERE email_id = ?"), spam, emailID)
+		} else {
+			_, err = tx.ExecContext(ctx, r.db.dialect.rebind("INSERT INTO spam_training (email_id, spam) VALUES (?, ?)"), emailID, spam)
+		}
+		if err != nil {
+			return err
+		}
+
+		add, remove := "spam_count", "ham_count"
+		if !spam {
+			add, remove = remove, add
+		}
+		for _, token := range tokens {
+			_, err := tx.ExecContext(ctx,
+				r.db.dialect.rebind("INSERT INTO spam_tokens (token, "+add+") VALUES (?, 1) ON CONFLICT (token) DO UPDATE SET "+add+" = spam_tokens."+add+" + 1"),
+				token,
+			)
+			if err != nil {
+				return err
+			}
+			if retrain {
+				_, err := tx.ExecContext(ctx, r.db.dialect.rebind("UPDATE spam_tokens SET "+remove+" = "+remove+" - 1 WHERE token = ? AND "+remove+" > 0"), token)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// placeholders returns n comma separated parameters for an IN list.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,88 @@
+package sqlrepository
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+var (
+	//go:embed migrations/sqlite/*.sql
+	sqliteMigrations embed.FS
+)
+
+// OpenSQLite opens, or creates, the SQLite database at path. Use ":memory:" for a throwaway in-memory database.
+//
+// SQLite only allows a single writer, so the connection pool is limited to one connection.
+// Call Migrate before using the repositories.
+func OpenSQLite(ctx context.Context, path string) (*DB, error) {
+	migrations, err := fs.Sub(sqliteMigrations, "migrations/sqlite")
+	if err != nil {
+		return nil, err
+	}
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	db, err := sql.Open("sqlite", path+separator+"_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &DB{
+		db: db,
+		dialect: dialect{
+			name:       "sqlite",
+			migrations: migrations,
+			rebind:     func(query string) string { return query },
+		},
+	}, nil
+}
+
+// backfillUTCTimestamps rewrites the timestamps queries compare in UTC, as they used to be written in local time.
+func backfillUTCTimestamps(ctx context.Context, d *DB, tx *sql.Tx) error {
+	for _, c := range []struct{ table, key, column string }{
+		{"tickets", "id", "created_at"},
+		{"ticket_states", "ticket_id", "updated_at"},
+		{"quarantined_emails", "email_id", "quarantined_at"},
+	} {
+		rows, err := tx.QueryContext(ctx, "SELECT "+c.key+", "+c.column+" FROM "+c.table)
+		if err != nil {
+			return err
+		}
+		timestamps := map[uint64]time.Time{}
+		for rows.Next() {
+			var (
+				key       uint64
+				timestamp time.Time
+			)
+			if err := rows.Scan(&key, &timestamp); err != nil {
+				rows.Close()
+				return err
+			}
+			timestamps[key] = timestamp
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for key, timestamp := range timestamps {
+			if _, err := tx.ExecContext(ctx, "UPDATE "+c.table+" SET "+c.column+" = ? WHERE "+c.key+" = ?", timestamp.UTC(), key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package sqlrepository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/nil-nil/ticket/internal/domain"
+)
+
+var (
+	ErrUnknownDriver = errors.New("unknown database driver")
+)
+
+// dialect holds everything that differs between the supported SQL databases.
+//
+// Queries in this package are written with "?" placeholders and rebound for the dialect before use.
+type dialect struct {
+	name       string
+	migrations fs.FS
+	rebind     func(query string) string
+}
+
+// Open connects to a database using the named driver, either "postgres" or "sqlite".
+//
+// For postgres the dsn is a connection string, for sqlite it is the path to the database file.
+func Open(ctx context.Context, driver string, dsn string) (*DB, error) {
+	switch driver {
+	case "postgres":
+		return OpenPostgres(ctx, dsn)
+	case "sqlite":
+		return OpenSQLite(ctx, dsn)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownDriver, driver)
+}
+
+// DB is a database connection shared by all the repositories in this package.
+type DB struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// Close closes the underlying database connection.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// backfills fill in data a migration can't compute in SQL, by migration version.
+//
+// They query the tables as they are when their migration is applied rather than going through the repositories, so later migrations don't break them.
+var backfills = map[string]func(ctx context.Context, d *DB, tx *sql.Tx) error{
+	"0019_ticket_states":  backfillTicketStates,
+	"0021_ticket_texts":   backfillTicketTexts,
+	"0022_utc_timestamps": backfillUTCTimestamps,
+}
+
+// Migrate applies every migration that hasn't been applied yet, in filename order.
+//
+// Each migration runs in its own transaction, along with its backfill if it has one, and is recorded in the schema_migrations table.
+func (d *DB) Migrate(ctx context.Context) error {
+	_, err := d.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version TEXT PRIMARY KEY)")
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %w", err)
+	}
+
+	files, err := fs.Glob(d.dialect.migrations, "*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		version := strings.TrimSuffix(file, ".sql")
+		var applied int
+		err := d.db.QueryRowContext(ctx, d.dialect.rebind("SELECT COUNT(*) FROM schema_migrations WHERE version = ?"), version).Scan(&applied)
+		if err != nil {
+			return err
+		}
+		if applied > 0 {
+			continue
+		}
+
+		migration, err := fs.ReadFile(d.dialect.migrations, file)
+		if err != nil {
+			return err
+		}
+
+		err = d.inTx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, string(migration)); err != nil {
+				return err
+			}
+			if backfill, ok := backfills[version]; ok {
+				if err := backfill(ctx, d, tx); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, d.dialect.rebind("INSERT INTO schema_migrations (version) VALUES (?)"), version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("error applying migration %s: %w", version, err)
+		}
+	}
+
+	return nil
+}
+
+// inTx runs f in a transaction, committing if it returns nil and rolling back otherwise.
+func (d *DB) inTx(ctx context.Context, f func(tx *sql.Tx) error) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := f(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx so reads can be shared inside and outside transactions.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// notFound translates sql.ErrNoRows into domain.ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrNotFound
+	}
+	return err
+}
+
+// nullableID converts a nullable ID column into an optional ID.
+func nullableID(id sql.NullInt64) *uint64 {
+	if !id.Valid {
+		return nil
+	}
+	v := uint64(id.Int64)
+	return &v
+}
+
+// rebindDollar replaces "?" placeholders with "$1", "$2", etc.
+func rebindDollar(query string) string {
+	var (
+		b strings.Builder
+		n int
+	)
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
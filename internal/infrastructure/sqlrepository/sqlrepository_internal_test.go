@@ -0,0 +1,25 @@
+package sqlrepository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRebindDollar(t *testing.T) {
+	table := []struct {
+		description string
+		query       string
+		expect      string
+	}{
+		{description: "no placeholders", query: "SELECT id FROM tickets", expect: "SELECT id FROM tickets"},
+		{description: "single placeholder", query: "SELECT id FROM tickets WHERE id = ?", expect: "SELECT id FROM tickets WHERE id = $1"},
+		{description: "many placeholders", query: "INSERT INTO t (a, b, c) VALUES (?, ?, ?)", expect: "INSERT INTO t (a, b, c) VALUES ($1, $2, $3)"},
+	}
+
+	for _, tc := range table {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expect, rebindDollar(tc.query))
+		})
+	}
+}
@@ -0,0 +1,1245 @@
+package sqlrepository_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/nil-nil/ticket/internal/infrastructure/sqlrepository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+// testDatabases returns a freshly migrated database for every driver available to the tests.
+//
+// SQLite always runs in memory. PostgreSQL is only tested when TICKET_TEST_POSTGRES_DSN is set,
+// and each test gets its own schema which is dropped afterwards.
+func testDatabases(t testing.TB) map[string]*sqlrepository.DB {
+	t.Helper()
+	databases := map[string]*sqlrepository.DB{
+		"sqlite": testSQLite(t),
+	}
+
+	if dsn := os.Getenv("TICKET_TEST_POSTGRES_DSN"); dsn != "" {
+		databases["postgres"] = testPostgres(t, dsn)
+	}
+
+	return databases
+}
+
+func testSQLite(t testing.TB) *sqlrepository.DB {
+	t.Helper()
+	ctx := context.Background()
+
+	db, err := sqlrepository.OpenSQLite(ctx, ":memory:")
+	require.NoError(t, err, "opening sqlite shouldn't error")
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, db.Migrate(ctx), "migrating shouldn't error")
+
+	return db
+}
+
+func testPostgres(t testing.TB, dsn string) *sqlrepository.DB {
+	t.Helper()
+	ctx := context.Background()
+
+	admin, err := sqlrepository.OpenPostgres(ctx, dsn)
+	require.NoError(t, err, "connecting to postgres shouldn't error")
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	require.NoError(t, admin.Exec(ctx, "CREATE SCHEMA "+schema))
+	t.Cleanup(func() {
+		admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+		admin.Close()
+	})
+
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		if strings.Contains(dsn, "?") {
+			dsn += "&search_path=" + schema
+		} else {
+			dsn += "?search_path=" + schema
+		}
+	} else {
+		dsn += " search_path=" + schema
+	}
+
+	db, err := sqlrepository.OpenPostgres(ctx, dsn)
+	require.NoError(t, err, "connecting to postgres shouldn't error")
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, db.Migrate(ctx), "migrating shouldn't error")
+
+	return db
+}
+
+func TestOpen(t *testing.T) {
+	t.Run("sqlite", func(t *testing.T) {
+		db, err := sqlrepository.Open(context.Background(), "sqlite", filepath.Join(t.TempDir(), "ticket.db"))
+		assert.NoError(t, err, "opening sqlite by name shouldn't error")
+		assert.NoError(t, db.Migrate(context.Background()), "migrating a new file shouldn't error")
+		assert.NoError(t, db.Close())
+	})
+
+	t.Run("unknown driver", func(t *testing.T) {
+		db, err := sqlrepository.Open(context.Background(), "oracle", "")
+		assert.ErrorIs(t, err, sqlrepository.ErrUnknownDriver, "unknown drivers should return a meaningful error")
+		assert.Nil(t, db)
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, db.Migrate(context.Background()), "migrating twice should be a no-op")
+		})
+	}
+}
+
+func TestTicketRepository(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := sqlrepository.NewTicketRepository(db)
+
+			opened, err := repo.Open(ctx, "test")
+			assert.NoError(t, err, "opening a ticket shouldn't error")
+			assert.NotZero(t, opened.ID, "ticket should have an ID")
+			assert.Len(t, opened.Transitions, 1, "new ticket should have a single transition")
+			meta := opened.Meta()
+			assert.Equal(t, domain.TicketStatusOpen, meta.Status, "ticket status should be open")
+			assert.Equal(t, "test", meta.Description, "ticket should have description provided")
+			assert.Nil(t, meta.OwnerID, "ticket owner id should be nil")
+
+			updated, err := repo.Update(ctx, opened.ID, domain.TicketUpdateParameters{
+				Status:  domain.TicketStatusBlocked,
+				OwnerID: ptr.To(uint64(99)),
+			})
+			assert.NoError(t, err, "updating a ticket shouldn't error")
+			assert.Len(t, updated.Transitions, 2, "update should append a transition")
+			meta = updated.Meta()
+			assert.Equal(t, domain.TicketStatusBlocked, meta.Status, "ticket status should have status provided")
+			assert.Equal(t, "test", meta.Description, "description should be unchanged")
+			assert.Equal(t, ptr.To(uint64(99)), meta.OwnerID, "ticket should have owner id provided")
+			assert.False(t, meta.Spam, "ticket shouldn't be spam")
+
+			updated, err = repo.Update(ctx, opened.ID, domain.TicketUpdateParameters{Spam: ptr.To(true)})
+			assert.NoError(t, err, "marking a ticket as spam shouldn't error")
+			assert.Equal(t, ptr.To(true), updated.Transitions[2].Spam, "spam flag should be stored on the transition")
+			assert.True(t, updated.Meta().Spam, "ticket should be spam")
+			assert.Equal(t, domain.TicketStatusBlocked, updated.Meta().Status, "status should be unchanged")
+
+			updated, err = repo.Update(ctx, opened.ID, domain.TicketUpdateParameters{AddTags: []string{"Billing", "billing", " vip "}})
+			assert.NoError(t, err, "tagging a ticket shouldn't error")
+			assert.Equal(t, []string{"billing", "vip"}, updated.Transitions[3].AddTags, "tags should be normalized on the transition")
+			assert.Nil(t, updated.Transitions[2].AddTags, "transitions without tags shouldn't have any")
+			assert.Equal(t, []string{"billing", "vip"}, updated.Meta().Tags)
+
+			updated, err = repo.Update(ctx, opened.ID, domain.TicketUpdateParameters{Priority: domain.TicketPriorityUrgent, Queue: ptr.To("sales")})
+			assert.NoError(t, err, "routing a ticket shouldn't error")
+			assert.Equal(t, domain.TicketPriorityUrgent, updated.Meta().Priority)
+			assert.Equal(t, "sales", updated.Meta().Queue)
+			assert.Nil(t, updated.Transitions[3].Queue, "transitions without a queue shouldn't have one")
+
+			_, err = repo.Update(ctx, opened.ID, domain.TicketUpdateParameters{Status: domain.TicketStatusClosed, FromStatus: domain.TicketStatusOpen})
+			assert.ErrorIs(t, err, domain.ErrStatusChanged, "a status change from a status the ticket has left should be refused")
+			updated, err = repo.Update(ctx, opened.ID, domain.TicketUpdateParameters{Status: domain.TicketStatusClosed, Resolution: ptr.To("Fixed"), FromStatus: domain.TicketStatusBlocked})
+			assert.NoError(t, err, "resolving a ticket shouldn't error")
+			assert.Equal(t, "Fixed", updated.Meta().Resolution)
+			assert.Nil(t, updated.Transitions[4].Resolution, "transitions without a resolution shouldn't have one")
+
+			updated, err = repo.Update(ctx, opened.ID, domain.TicketUpdateParameters{
+				Type:       domain.TicketTypeIncident,
+				RemoveTags: []string{"VIP"},
+				SetFields:  map[string][]string{"platforms": {"iOS", "Android"}, "seats": {}},
+			})
+			assert.NoError(t, err, "triaging a ticket shouldn't error")
+			assert.Equal(t, []string{"vip"}, updated.Transitions[6].RemoveTags, "tags should be normalized on the transition")
+			assert.Equal(t, map[string][]string{"platforms": {"iOS", "Android"}, "seats": {}}, updated.Transitions[6].SetFields)
+			assert.Nil(t, updated.Transitions[5].SetFields, "transitions without fields shouldn't have any")
+			meta = updated.Meta()
+			assert.Equal(t, domain.TicketTypeIncident, meta.Type)
+			assert.Equal(t, []string{"billing"}, meta.Tags)
+			assert.Equal(t, map[string][]string{"platforms": {"iOS", "Android"}}, meta.Fields)
+
+			found, err := repo.Find(ctx, opened.ID)
+			assert.NoError(t, err, "finding a ticket shouldn't error")
+			assert.Equal(t, updated, found, "found ticket should match the updated ticket")
+
+			_, err = repo.Find(ctx, opened.ID+1000)
+			assert.ErrorIs(t, err, domain.ErrNotFound, "missing ticket should be not found")
+
+			_, err = repo.Update(ctx, opened.ID+1000, domain.TicketUpdateParameters{Status: domain.TicketStatusClosed})
+			assert.ErrorIs(t, err, domain.ErrNotFound, "updating a missing ticket should be not found")
+
+			err = db.Exec(ctx, "UPDATE ticket_transitions SET status = 0")
+			assert.Error(t, err, "transitions should be append-only")
+			err = db.Exec(ctx, "DELETE FROM ticket_transitions")
+			assert.Error(t, err, "transitions should be append-only")
+		})
+	}
+}
+
+func TestListTickets(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := sqlrepository.NewTicketRepository(db)
+
+			open := func(description string, params domain.TicketUpdateParameters) uint64 {
+				opened, err := repo.Open(ctx, description)
+				require.NoError(t, err)
+				_, err = repo.Update(ctx, opened.ID, params)
+				require.NoError(t, err)
+				return opened.ID
+			}
+			billing := open("Invoice wrong", domain.TicketUpdateParameters{
+				Priority:  domain.TicketPriorityHigh,
+				Type:      domain.TicketTypeQuestion,
+				AddTags:   []string{"billing", "vip"},
+				Queue:     ptr.To("finance"),
+				SetFields: map[string][]string{"product_area": {"Billing"}},
+			})
+			outage := open("API down", domain.TicketUpdateParameters{
+				Status:    domain.TicketStatusInProgress,
+				OwnerID:   ptr.To(uint64(99)),
+				Priority:  domain.TicketPriorityUrgent,
+				Type:      domain.TicketTypeIncident,
+				AddTags:   []string{"vip"},
+				SetFields: map[string][]string{"product_area": {"API"}, "platforms": {"iOS", "Android"}},
+			})
+			spam := open("Cheap watches", domain.TicketUpdateParameters{Spam: ptr.To(true)})
+
+			table := []struct {
+				name   string
+				filter domain.TicketFilter
+				expect []uint64
+			}{
+				{name: "All", expect: []uint64{billing, outage, spam}},
+				{name: "Status", filter: domain.TicketFilter{Statuses: []domain.TicketStatus{domain.TicketStatusOpen}}, expect: []uint64{billing, spam}},
+				{name: "Owner", filter: domain.TicketFilter{OwnerID: ptr.To(uint64(99))}, expect: []uint64{outage}},
+				{name: "Priorities", filter: domain.TicketFilter{Priorities: []domain.TicketPriority{domain.TicketPriorityHigh, domain.TicketPriorityUrgent}}, expect: []uint64{billing, outage}},
+				{name: "Type", filter: domain.TicketFilter{Types: []domain.TicketType{domain.TicketTypeIncident}}, expect: []uint64{outage}},
+				{name: "Queue", filter: domain.TicketFilter{Queue: ptr.To("finance")}, expect: []uint64{billing}},
+				{name: "NoQueue", filter: domain.TicketFilter{Queue: ptr.To("")}, expect: []uint64{outage, spam}},
+				{name: "Spam", filter: domain.TicketFilter{Spam: ptr.To(false)}, expect: []uint64{billing, outage}},
+				{name: "AllTags", filter: domain.TicketFilter{Tags: []string{"vip", "billing"}}, expect: []uint64{billing}},
+				{name: "Field", filter: domain.TicketFilter{Fields: map[string]string{"product_area": "API"}}, expect: []uint64{outage}},
+				{name: "MultiSelectField", filter: domain.TicketFilter{Fields: map[string]string{"platforms": "Android"}}, expect: []uint64{outage}},
+				{name: "Combined", filter: domain.TicketFilter{Tags: []string{"vip"}, Fields: map[string]string{"product_area": "Billing"}}, expect: []uint64{billing}},
+				{name: "NoMatch", filter: domain.TicketFilter{Types: []domain.TicketType{domain.TicketTypeTask}}, expect: []uint64{}},
+			}
+			for _, tc := range table {
+				t.Run(tc.name, func(t *testing.T) {
+					tickets, err := repo.List(ctx, tc.filter)
+					assert.NoError(t, err)
+					IDs := make([]uint64, 0, len(tickets))
+					for _, ticket := range tickets {
+						IDs = append(IDs, ticket.ID)
+					}
+					assert.Equal(t, tc.expect, IDs)
+				})
+			}
+
+			t.Run("StateFollowsUpdates", func(t *testing.T) {
+				_, err := repo.Update(ctx, billing, domain.TicketUpdateParameters{RemoveTags: []string{"vip"}, SetFields: map[string][]string{"product_area": {}}})
+				require.NoError(t, err)
+				tickets, err := repo.List(ctx, domain.TicketFilter{Tags: []string{"vip"}})
+				assert.NoError(t, err)
+				assert.Len(t, tickets, 1, "tags taken off should no longer match")
+				tickets, err = repo.List(ctx, domain.TicketFilter{Fields: map[string]string{"product_area": "Billing"}})
+				assert.NoError(t, err)
+				assert.Empty(t, tickets, "cleared fields should no longer match")
+			})
+
+			t.Run("Backfill", func(t *testing.T) {
+				// Forget the states and the migration storing them, as if the tickets were opened before it
+				for _, table := range []string{"ticket_state_fields", "ticket_state_tags", "ticket_states"} {
+					require.NoError(t, db.Exec(ctx, "DROP TABLE "+table))
+				}
+				require.NoError(t, db.Exec(ctx, "DROP INDEX tickets_created_at"))
+				require.NoError(t, db.Exec(ctx, "DELETE FROM schema_migrations WHERE version IN ('0019_ticket_states', '0020_ticket_search')"))
+				require.NoError(t, db.Migrate(ctx), "migrating shouldn't error")
+
+				tickets, err := repo.List(ctx, domain.TicketFilter{Types: []domain.TicketType{domain.TicketTypeIncident}, Tags: []string{"vip"}})
+				assert.NoError(t, err)
+				if assert.Len(t, tickets, 1, "states should be backfilled") {
+					assert.Equal(t, outage, tickets[0].ID)
+				}
+
+				page, err := repo.Search(ctx, domain.TicketQuery{Sort: domain.TicketSort{Field: domain.TicketSortUpdated, Descending: true}, Limit: domain.DefaultSearchLimit})
+				require.NoError(t, err)
+				IDs := make([]uint64, 0, len(page.Tickets))
+				for _, ticket := range page.Tickets {
+					IDs = append(IDs, ticket.ID)
+				}
+				assert.Equal(t, []uint64{billing, spam, outage}, IDs, "when tickets were updated should be backfilled")
+			})
+		})
+	}
+}
+
+func TestSearchTickets(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := sqlrepository.NewTicketRepository(db)
+			author, err := sqlrepository.NewUserRepository(db).Create(ctx, "Alice", "Agent")
+			require.NoError(t, err)
+
+			printer, err := repo.Open(ctx, "Printer on fire")
+			require.NoError(t, err)
+			_, err = repo.Update(ctx, printer.ID, domain.TicketUpdateParameters{Priority: domain.TicketPriorityUrgent, OwnerID: ptr.To(author.ID)})
+			require.NoError(t, err)
+			afterPrinter := time.Now()
+
+			invoice, err := repo.Open(ctx, "Invoice wrong")
+			require.NoError(t, err)
+			_, err = repo.Update(ctx, invoice.ID, domain.TicketUpdateParameters{
+				Priority: domain.TicketPriorityLow,
+				Comment:  &domain.TicketComment{AuthorID: author.ID, Body: "Refunded 50% of it", Visibility: domain.CommentVisibilityInternal},
+			})
+			require.NoError(t, err)
+
+			mailed, err := repo.Open(ctx, "Hello")
+			require.NoError(t, err)
+			emails := sqlrepository.NewEmailRepository(db)
+			e, err := emails.CreateEmail(ctx, domain.Email{
+				MessageID:  "search@example.com",
+				Subject:    "Broken printer cartridge",
+				Sender:     "customer@example.net",
+				Recipients: []string{"support@example.com"},
+				Date:       time.Now(),
+				TextBody:   "Please send a new one",
+				Message:    mail.Message{Header: mail.Header{}, Body: strings.NewReader("")},
+			})
+			require.NoError(t, err)
+			require.NoError(t, emails.LinkTicket(ctx, e.ID, mailed.ID))
+
+			// The printer ticket changes last
+			_, err = repo.Update(ctx, printer.ID, domain.TicketUpdateParameters{AddTags: []string{"vip"}})
+			require.NoError(t, err)
+
+			// Text is indexed as TicketIndexer would, the repositories not publishing events
+			texts := sqlrepository.NewTicketTextRepository(db)
+			for _, ID := range []uint64{printer.ID, invoice.ID, mailed.ID} {
+				ticket, err := repo.Find(ctx, ID)
+				require.NoError(t, err)
+				ticketEmails, err := emails.FindTicketEmails(ctx, ID)
+				require.NoError(t, err)
+				require.NoError(t, texts.ReplaceTicketTexts(ctx, ID, domain.TicketTexts(ticket, ticketEmails)))
+			}
+
+			search := func(query domain.TicketQuery) []uint64 {
+				t.Helper()
+				if query.Sort.Field == "" {
+					query.Sort.Field = domain.TicketSortCreated
+				}
+				if query.Limit == 0 {
+					query.Limit = domain.DefaultSearchLimit
+				}
+				page, err := repo.Search(ctx, query)
+				require.NoError(t, err)
+				assert.Empty(t, page.NextCursor, "everything should fit on a page")
+				IDs := []uint64{}
+				for _, ticket := range page.Tickets {
+					IDs = append(IDs, ticket.ID)
+				}
+				return IDs
+			}
+
+			table := []struct {
+				name   string
+				query  domain.TicketQuery
+				expect []uint64
+			}{
+				{name: "All", expect: []uint64{printer.ID, invoice.ID, mailed.ID}},
+				{name: "Filter", query: domain.TicketQuery{TicketFilter: domain.TicketFilter{Tags: []string{"vip"}}}, expect: []uint64{printer.ID}},
+				{name: "Unassigned", query: domain.TicketQuery{Unassigned: true}, expect: []uint64{invoice.ID, mailed.ID}},
+				{name: "CreatedBefore", query: domain.TicketQuery{CreatedBefore: afterPrinter}, expect: []uint64{printer.ID}},
+				{name: "CreatedFrom", query: domain.TicketQuery{CreatedFrom: afterPrinter}, expect: []uint64{invoice.ID, mailed.ID}},
+				{name: "UpdatedFrom", query: domain.TicketQuery{UpdatedFrom: afterPrinter}, expect: []uint64{printer.ID, invoice.ID, mailed.ID}},
+				{name: "UpdatedBefore", query: domain.TicketQuery{UpdatedBefore: afterPrinter}, expect: []uint64{}},
+				{name: "Alias", query: domain.TicketQuery{Alias: "support@example.com"}, expect: []uint64{mailed.ID}},
+				{name: "OtherAlias", query: domain.TicketQuery{Alias: "sales@example.com"}, expect: []uint64{}},
+				{name: "TextInDescriptionAndEmail", query: domain.TicketQuery{Text: "PRINTER"}, expect: []uint64{printer.ID, mailed.ID}},
+				{name: "EveryWord", query: domain.TicketQuery{Text: "printer fire"}, expect: []uint64{printer.ID}},
+				{name: "TextInEmailBody", query: domain.TicketQuery{Text: "new one"}, expect: []uint64{mailed.ID}},
+				{name: "TextInComment", query: domain.TicketQuery{Text: "50%"}, expect: []uint64{invoice.ID}},
+				{name: "Stemmed", query: domain.TicketQuery{Text: "refunds"}, expect: []uint64{invoice.ID}},
+				{name: "WholeWords", query: domain.TicketQuery{Text: "print"}, expect: []uint64{}},
+				{name: "OnlyStopWords", query: domain.TicketQuery{Text: "the"}, expect: []uint64{}},
+				{name: "NoWords", query: domain.TicketQuery{Text: `"" --`}, expect: []uint64{}},
+				{name: "Phrase", query: domain.TicketQuery{Text: `"broken printer"`}, expect: []uint64{mailed.ID}},
+				{name: "PhraseWithStopWords", query: domain.TicketQuery{Text: `"send a new one"`}, expect: []uint64{mailed.ID}},
+				{name: "PhraseInOrder", query: domain.TicketQuery{Text: `"printer broken"`}, expect: []uint64{}},
+				{name: "PhraseInOneText", query: domain.TicketQuery{Text: `"cartridge please"`}, expect: []uint64{}},
+				{name: "PhraseFromRarestTerm", query: domain.TicketQuery{Text: `"printer cartridge"`}, expect: []uint64{mailed.ID}},
+				{name: "PhraseWithUnindexedTerm", query: domain.TicketQuery{Text: `"printer toner"`}, expect: []uint64{}},
+				{name: "SortedByUpdate", query: domain.TicketQuery{Sort: domain.TicketSort{Field: domain.TicketSortUpdated, Descending: true}}, expect: []uint64{printer.ID, mailed.ID, invoice.ID}},
+				{name: "SortedByPriority", query: domain.TicketQuery{Sort: domain.TicketSort{Field: domain.TicketSortPriority}}, expect: []uint64{mailed.ID, invoice.ID, printer.ID}},
+			}
+			for _, tc := range table {
+				t.Run(tc.name, func(t *testing.T) {
+					assert.Equal(t, tc.expect, search(tc.query))
+				})
+			}
+
+			t.Run("Matches", func(t *testing.T) {
+				page, err := repo.Search(ctx, domain.TicketQuery{Text: "printer", Sort: domain.TicketSort{Field: domain.TicketSortCreated}, Limit: 10})
+				require.NoError(t, err)
+				assert.Equal(t, map[uint64][]domain.TextMatch{
+					printer.ID: {{Source: domain.TextSourceDescription, Snippet: []domain.TextFragment{{Text: "Printer", Highlighted: true}, {Text: " on fire"}}}},
+					mailed.ID:  {{Source: domain.TextSourceEmailSubject, SourceID: e.ID, Snippet: []domain.TextFragment{{Text: "Broken "}, {Text: "printer", Highlighted: true}, {Text: " cartridge"}}}},
+				}, page.Matches)
+
+				page, err = repo.Search(ctx, domain.TicketQuery{Sort: domain.TicketSort{Field: domain.TicketSortCreated}, Limit: 10})
+				require.NoError(t, err)
+				assert.Empty(t, page.Matches, "searches without text have nothing to highlight")
+			})
+
+			t.Run("Pages", func(t *testing.T) {
+				for _, sort := range []domain.TicketSort{
+					{Field: domain.TicketSortCreated, Descending: true},
+					{Field: domain.TicketSortUpdated},
+					{Field: domain.TicketSortPriority, Descending: true},
+				} {
+					query := domain.TicketQuery{Sort: sort, Limit: 2}
+					all := search(domain.TicketQuery{Sort: sort})
+					var paged []uint64
+					for pages := 0; pages < 3; pages++ {
+						page, err := repo.Search(ctx, query)
+						require.NoError(t, err)
+						for _, ticket := range page.Tickets {
+							paged = append(paged, ticket.ID)
+						}
+						if page.NextCursor == "" {
+							break
+						}
+						query.Cursor = page.NextCursor
+					}
+					assert.Equal(t, all, paged, "pages sorted by %s should hold every ticket once, in order", sort.Field)
+				}
+			})
+
+			t.Run("InvalidCursor", func(t *testing.T) {
+				page, err := repo.Search(ctx, domain.TicketQuery{Sort: domain.TicketSort{Field: domain.TicketSortCreated}, Limit: 1})
+				require.NoError(t, err)
+				require.NotEmpty(t, page.NextCursor)
+
+				_, err = repo.Search(ctx, domain.TicketQuery{Sort: domain.TicketSort{Field: domain.TicketSortUpdated}, Limit: 1, Cursor: page.NextCursor})
+				assert.ErrorIs(t, err, domain.ErrInvalidCursor, "cursors shouldn't be continued sorted another way")
+				_, err = repo.Search(ctx, domain.TicketQuery{Sort: domain.TicketSort{Field: domain.TicketSortCreated}, Limit: 1, Cursor: "garbage!"})
+				assert.ErrorIs(t, err, domain.ErrInvalidCursor)
+			})
+
+			t.Run("Backfill", func(t *testing.T) {
+				// Forget the index and the migration storing it, as if the tickets were opened before it
+				for _, table := range []string{"ticket_text_terms", "ticket_texts"} {
+					require.NoError(t, db.Exec(ctx, "DROP TABLE "+table))
+				}
+				require.NoError(t, db.Exec(ctx, "DELETE FROM schema_migrations WHERE version = '0021_ticket_texts'"))
+				require.NoError(t, db.Migrate(ctx), "migrating shouldn't error")
+
+				assert.Equal(t, []uint64{invoice.ID}, search(domain.TicketQuery{Text: "refund"}), "comments should be backfilled")
+				assert.Equal(t, []uint64{mailed.ID}, search(domain.TicketQuery{Text: "cartridge"}), "email should be backfilled")
+			})
+		})
+	}
+}
+
+// BenchmarkSearchTicketsText checks words and phrases are still found quickly once the index holds a lot of text.
+// Every ticket contains the common words, so phrases of them join every occurrence of their first word.
+func BenchmarkSearchTicketsText(b *testing.B) {
+	const (
+		tickets    = 5000
+		textLength = 100
+	)
+	vocabulary := make([]string, 1000)
+	for i := range vocabulary {
+		vocabulary[i] = fmt.Sprintf("word%d", i)
+	}
+
+	for name, db := range testDatabases(b) {
+		b.Run(name, func(b *testing.B) {
+			ctx := context.Background()
+			repo := sqlrepository.NewTicketRepository(db)
+			texts := sqlrepository.NewTicketTextRepository(db)
+			random := rand.New(rand.NewSource(1))
+			for n := 0; n < tickets; n++ {
+				ticket, err := repo.Open(ctx, "Benchmark")
+				require.NoError(b, err)
+				words := make([]string, textLength)
+				for i := range words {
+					// Zipf-like, so a few words are in nearly every ticket
+					words[i] = vocabulary[int(float64(len(vocabulary))*math.Pow(random.Float64(), 4))]
+				}
+				if n%100 == 0 {
+					copy(words[textLength/2:], []string{"out", "of", "paper"})
+				}
+				require.NoError(b, texts.ReplaceTicketTexts(ctx, ticket.ID, []domain.TicketText{{Source: domain.TextSourceDescription, Text: strings.Join(words, " ")}}))
+			}
+
+			for _, query := range []string{"paper", `"out of paper"`, "word0 word1", `"word0 word1 word2"`, `"word0 word999"`} {
+				b.Run(query, func(b *testing.B) {
+					for i := 0; i < b.N; i++ {
+						_, err := repo.Search(ctx, domain.TicketQuery{Text: query, Sort: domain.TicketSort{Field: domain.TicketSortCreated}, Limit: 50})
+						require.NoError(b, err)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestSearchTicketsOutsideUTC(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("EST", -5*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := sqlrepository.NewTicketRepository(db)
+			first, err := repo.Open(ctx, "Printer on fire")
+			require.NoError(t, err)
+			_, err = repo.Open(ctx, "Invoice overdue")
+			require.NoError(t, err)
+			opened := first.Transitions[0].Timestamp
+
+			count := func(query domain.TicketQuery) int {
+				t.Helper()
+				query.Sort, query.Limit = domain.TicketSort{Field: domain.TicketSortCreated}, domain.DefaultSearchLimit
+				page, err := repo.Search(ctx, query)
+				require.NoError(t, err)
+				return len(page.Tickets)
+			}
+			assert.Equal(t, 2, count(domain.TicketQuery{CreatedFrom: opened.Add(-time.Second)}), "tickets created after the bound should match whatever the time zone")
+			assert.Equal(t, 0, count(domain.TicketQuery{CreatedBefore: opened.Add(-time.Second)}))
+			assert.Equal(t, 2, count(domain.TicketQuery{UpdatedFrom: opened.Add(-time.Second)}))
+
+			page, err := repo.Search(ctx, domain.TicketQuery{Sort: domain.TicketSort{Field: domain.TicketSortCreated}, Limit: 1})
+			require.NoError(t, err)
+			page, err = repo.Search(ctx, domain.TicketQuery{Sort: domain.TicketSort{Field: domain.TicketSortCreated}, Limit: 1, Cursor: page.NextCursor})
+			require.NoError(t, err)
+			assert.Len(t, page.Tickets, 1, "the cursor should continue onto the second ticket")
+
+			t.Run("Backfill", func(t *testing.T) {
+				// Store the creation time as it used to be written, in local time
+				require.NoError(t, db.Exec(ctx, "UPDATE tickets SET created_at = '"+opened.Local().Format("2006-01-02 15:04:05.999999999 -0700 MST")+"' WHERE id = "+fmt.Sprint(first.ID)))
+				require.NoError(t, db.Exec(ctx, "DELETE FROM schema_migrations WHERE version = '0022_utc_timestamps'"))
+				require.NoError(t, db.Migrate(ctx), "migrating shouldn't error")
+				assert.Equal(t, 2, count(domain.TicketQuery{CreatedFrom: opened.Add(-time.Second)}), "timestamps written in local time should be rewritten in UTC")
+			})
+		})
+	}
+}
+
+func TestTicketComments(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := sqlrepository.NewTicketRepository(db)
+			author, err := sqlrepository.NewUserRepository(db).Create(ctx, "Alice", "Agent")
+			require.NoError(t, err)
+
+			opened, err := repo.Open(ctx, "Printer on fire")
+			require.NoError(t, err)
+
+			updated, err := repo.Update(ctx, opened.ID, domain.TicketUpdateParameters{Comment: &domain.TicketComment{
+				AuthorID:   author.ID,
+				Body:       "Have you tried water?",
+				Visibility: domain.CommentVisibilityPublic,
+			}})
+			require.NoError(t, err, "adding a reply shouldn't error")
+			updated, err = repo.Update(ctx, opened.ID, domain.TicketUpdateParameters{Comment: &domain.TicketComment{
+				AuthorID:    author.ID,
+				Body:        "Fire brigade report attached",
+				Visibility:  domain.CommentVisibilityInternal,
+				Attachments: []domain.Attachment{{ContentType: "text/plain", Filename: "report.txt", Content: []byte("all clear")}},
+			}})
+			require.NoError(t, err, "adding a note shouldn't error")
+			require.Len(t, updated.Transitions, 3, "each comment should be added by a transition")
+
+			assert.Nil(t, updated.Transitions[0].Comment, "transitions without a comment shouldn't have one")
+			reply := updated.Transitions[1].Comment
+			if assert.NotNil(t, reply) {
+				assert.NotZero(t, reply.ID)
+				assert.Equal(t, author.ID, reply.AuthorID)
+				assert.Equal(t, "Have you tried water?", reply.Body)
+				assert.Equal(t, domain.CommentVisibilityPublic, reply.Visibility)
+				assert.Empty(t, reply.Attachments)
+			}
+			note := updated.Transitions[2].Comment
+			require.NotNil(t, note)
+			assert.True(t, note.IsInternal())
+			require.Len(t, note.Attachments, 1)
+			listed := note.Attachments[0]
+			assert.Equal(t, note.ID, listed.CommentID)
+			assert.Equal(t, "report.txt", listed.Filename)
+			assert.Equal(t, int64(9), listed.Size)
+			assert.Nil(t, listed.Content, "listed attachments shouldn't include their content")
+
+			meta := updated.Meta()
+			assert.Equal(t, 1, meta.Comments)
+			assert.Equal(t, 1, meta.Notes)
+
+			attachment, err := repo.FindCommentAttachment(ctx, listed.ID)
+			assert.NoError(t, err, "finding an attachment shouldn't error")
+			assert.Equal(t, []byte("all clear"), attachment.Content)
+			assert.Equal(t, "text/plain", attachment.ContentType)
+
+			_, err = repo.FindCommentAttachment(ctx, listed.ID+1000)
+			assert.ErrorIs(t, err, domain.ErrNotFound, "missing attachment should be not found")
+
+			found, err := repo.Find(ctx, opened.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, updated, found, "found ticket should match the updated ticket")
+		})
+	}
+}
+
+func TestUserRepository(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := sqlrepository.NewUserRepository(db)
+
+			created, err := repo.Create(ctx, "Bob", "Test")
+			assert.NoError(t, err, "creating a user shouldn't error")
+			assert.NotZero(t, created.ID, "user should have an ID")
+			assert.Equal(t, "Bob", created.FirstName)
+			assert.Equal(t, "Test", created.LastName)
+			assert.False(t, created.CreatedAt.IsZero(), "CreatedAt should be set")
+			assert.Nil(t, created.DeletedAt, "new user shouldn't be deleted")
+
+			found, err := repo.Find(ctx, created.ID)
+			assert.NoError(t, err, "finding a user shouldn't error")
+			assert.Equal(t, created, found)
+			assert.False(t, found.Admin, "users shouldn't be admins by default")
+			require.NoError(t, db.Exec(ctx, fmt.Sprintf("UPDATE users SET admin = TRUE WHERE id = %d", created.ID)))
+			found, err = repo.Find(ctx, created.ID)
+			assert.NoError(t, err)
+			assert.True(t, found.Admin, "admins should be found as admins")
+
+			_, err = repo.Find(ctx, created.ID+1000)
+			assert.ErrorIs(t, err, domain.ErrNotFound, "missing user should be not found")
+		})
+	}
+}
+
+func TestAliasRepository(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := sqlrepository.NewAliasRepository(db)
+
+			created, err := repo.Create(ctx, "support", "example.com")
+			assert.NoError(t, err, "creating an alias shouldn't error")
+			assert.NotZero(t, created.ID, "alias should have an ID")
+			assert.Equal(t, domain.Alias{ID: created.ID, User: "support", Domain: "example.com"}, created)
+
+			found, err := repo.Find(ctx, domain.FindAliasParameters{User: ptr.To("support"), Domain: ptr.To("example.com")})
+			assert.NoError(t, err, "finding an alias shouldn't error")
+			assert.Equal(t, created, found)
+
+			_, err = repo.Find(ctx, domain.FindAliasParameters{User: ptr.To("nobody"), Domain: ptr.To("example.com")})
+			assert.ErrorIs(t, err, domain.ErrNotFound, "missing alias should be not found")
+
+			_, err = repo.Find(ctx, domain.FindAliasParameters{})
+			assert.ErrorIs(t, err, domain.ErrNotFound, "empty parameters should be not found")
+
+			owner, err := sqlrepository.NewUserRepository(db).Create(ctx, "Alice", "Agent")
+			require.NoError(t, err)
+			owned, err := repo.SetOwner(ctx, created.ID, &owner.ID)
+			assert.NoError(t, err, "setting an alias owner shouldn't error")
+			assert.True(t, owned.IsOwnedBy(owner.ID), "alias should be owned by the user")
+			found, err = repo.Find(ctx, domain.FindAliasParameters{ID: &created.ID})
+			assert.NoError(t, err)
+			assert.Equal(t, owned, found, "owner should be persisted")
+
+			routing := domain.AliasRouting{Queue: "support", DefaultOwnerID: &owner.ID, Priority: domain.TicketPriorityHigh, Tags: []string{"vip"}, Private: true}
+			routed, err := repo.SetRouting(ctx, created.ID, routing)
+			assert.NoError(t, err, "setting alias routing shouldn't error")
+			assert.Equal(t, routing, routed.Routing)
+			found, err = repo.Find(ctx, domain.FindAliasParameters{ID: &created.ID})
+			assert.NoError(t, err)
+			assert.Equal(t, routed, found, "routing should be persisted")
+			routed, err = repo.SetRouting(ctx, created.ID, domain.AliasRouting{})
+			assert.NoError(t, err, "clearing alias routing shouldn't error")
+			assert.Equal(t, domain.AliasRouting{}, routed.Routing)
+			_, err = repo.SetRouting(ctx, created.ID+1000, routing)
+			assert.ErrorIs(t, err, domain.ErrNotFound, "routing a missing alias should be not found")
+
+			created, err = repo.SetOwner(ctx, created.ID, nil)
+			assert.NoError(t, err, "clearing an alias owner shouldn't error")
+			assert.Nil(t, created.OwnerID, "alias shouldn't have an owner")
+
+			_, err = repo.SetOwner(ctx, created.ID+1000, &owner.ID)
+			assert.ErrorIs(t, err, domain.ErrNotFound, "setting the owner of a missing alias should be not found")
+
+			deleted, err := repo.Delete(ctx, created.ID)
+			assert.NoError(t, err, "deleting an alias shouldn't error")
+			assert.NotNil(t, deleted.DeletedAt, "DeletedAt should be set now")
+
+			found, err = repo.Find(ctx, domain.FindAliasParameters{ID: &created.ID})
+			assert.NoError(t, err, "deleted aliases should still be found")
+			assert.NotNil(t, found.DeletedAt, "found alias should be deleted")
+
+			recreated, err := repo.Create(ctx, "support", "example.com")
+			assert.NoError(t, err, "recreating a deleted alias shouldn't error")
+			found, err = repo.Find(ctx, domain.FindAliasParameters{User: ptr.To("support"), Domain: ptr.To("example.com")})
+			assert.NoError(t, err)
+			assert.Equal(t, recreated, found, "the live alias should be preferred over the deleted one")
+
+			_, err = repo.Create(ctx, "support", "example.com")
+			assert.Error(t, err, "duplicate live aliases shouldn't be allowed")
+			_, err = repo.Create(ctx, "Support", "Example.com")
+			assert.Error(t, err, "live aliases differing only in case shouldn't be allowed")
+
+			found, err = repo.Find(ctx, domain.FindAliasParameters{User: ptr.To("SUPPORT"), Domain: ptr.To("EXAMPLE.COM")})
+			assert.NoError(t, err, "aliases should be found regardless of case")
+			assert.Equal(t, recreated.ID, found.ID)
+
+			_, err = repo.Delete(ctx, recreated.ID+1000)
+			assert.ErrorIs(t, err, domain.ErrNotFound, "deleting a missing alias should be not found")
+		})
+	}
+}
+
+func TestDNSDomainRepository(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := sqlrepository.NewDNSDomainRepository(db)
+
+			domains, err := repo.GetDomains(ctx)
+			assert.NoError(t, err)
+			assert.Empty(t, domains, "there should be no domains yet")
+
+			d1, err := repo.CreateDomain(ctx, domain.DNSDomain{Name: "example.com", VerificationToken: "token"})
+			assert.NoError(t, err, "creating a domain shouldn't error")
+			assert.NotZero(t, d1.ID)
+			assert.Equal(t, "token", d1.VerificationToken)
+			assert.False(t, d1.IsVerified(), "new domains shouldn't be verified")
+			d2, err := repo.CreateDomain(ctx, domain.DNSDomain{Name: "test.com"})
+			assert.NoError(t, err, "creating a domain shouldn't error")
+
+			_, err = repo.CreateDomain(ctx, domain.DNSDomain{Name: "test.com"})
+			assert.Error(t, err, "duplicate domains shouldn't be allowed")
+
+			domains, err = repo.GetDomains(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, []domain.DNSDomain{d1, d2}, domains)
+
+			got, err := repo.GetDomain(ctx, d2.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, d2, got)
+			got, err = repo.GetDomainByName(ctx, "Example.COM")
+			assert.NoError(t, err)
+			assert.Equal(t, d1, got, "names should match case-insensitively")
+			_, err = repo.GetDomain(ctx, d2.ID+1000)
+			assert.ErrorIs(t, err, domain.ErrNotFound)
+			_, err = repo.GetDomainByName(ctx, "missing.com")
+			assert.ErrorIs(t, err, domain.ErrNotFound)
+
+			key := domain.DKIMKey{Selector: "ticket1", PrivateKey: "key", CreatedAt: time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)}
+			withKey, err := repo.SetDKIMKey(ctx, d1.ID, key)
+			assert.NoError(t, err, "setting a dkim key shouldn't error")
+			require.NotNil(t, withKey.DKIM)
+			assert.Equal(t, key.Selector, withKey.DKIM.Selector)
+			assert.Equal(t, key.PrivateKey, withKey.DKIM.PrivateKey)
+			assert.True(t, key.CreatedAt.Equal(withKey.DKIM.CreatedAt))
+			got, err = repo.GetDomain(ctx, d1.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, withKey.DKIM.Selector, got.DKIM.Selector, "the key should be stored")
+			_, err = repo.SetDKIMKey(ctx, d2.ID+1000, key)
+			assert.ErrorIs(t, err, domain.ErrNotFound)
+
+			verifiedAt := time.Date(2023, 7, 2, 12, 0, 0, 0, time.UTC)
+			verified, err := repo.SetVerified(ctx, d2.ID, verifiedAt)
+			assert.NoError(t, err, "verifying a domain shouldn't error")
+			require.True(t, verified.IsVerified())
+			assert.True(t, verifiedAt.Equal(*verified.VerifiedAt))
+			got, err = repo.GetDomain(ctx, d2.ID)
+			assert.NoError(t, err)
+			assert.True(t, got.IsVerified(), "verification should be stored")
+			_, err = repo.SetVerified(ctx, d2.ID+1000, verifiedAt)
+			assert.ErrorIs(t, err, domain.ErrNotFound)
+
+			withToken, err := repo.SetVerificationToken(ctx, d1.ID, "newtoken")
+			assert.NoError(t, err, "setting a verification token shouldn't error")
+			assert.Equal(t, "newtoken", withToken.VerificationToken)
+			_, err = repo.SetVerificationToken(ctx, d2.ID+1000, "newtoken")
+			assert.ErrorIs(t, err, domain.ErrNotFound)
+		})
+	}
+}
+
+func TestDNSDomainRepositoryRenameAndDelete(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := sqlrepository.NewDNSDomainRepository(db)
+			aliases := sqlrepository.NewAliasRepository(db)
+
+			d, err := repo.CreateDomain(ctx, domain.DNSDomain{Name: "before.com", VerificationToken: "token"})
+			require.NoError(t, err)
+			_, err = repo.SetVerified(ctx, d.ID, time.Now())
+			require.NoError(t, err)
+			other, err := repo.CreateDomain(ctx, domain.DNSDomain{Name: "other.com"})
+			require.NoError(t, err)
+
+			support, err := aliases.Create(ctx, "support", "before.com")
+			require.NoError(t, err)
+			old, err := aliases.Create(ctx, "old", "before.com")
+			require.NoError(t, err)
+			_, err = aliases.Delete(ctx, old.ID)
+			require.NoError(t, err)
+			otherAlias, err := aliases.Create(ctx, "support", "other.com")
+			require.NoError(t, err)
+
+			renamed, err := repo.RenameDomain(ctx, d.ID, "after.com")
+			assert.NoError(t, err, "renaming a domain shouldn't error")
+			assert.Equal(t, "after.com", renamed.Name)
+			assert.False(t, renamed.IsVerified(), "a renamed domain should need verifying again")
+			assert.Equal(t, "token", renamed.VerificationToken, "the token should be kept")
+			moved, err := aliases.Find(ctx, domain.FindAliasParameters{ID: &support.ID})
+			assert.NoError(t, err)
+			assert.Equal(t, "after.com", moved.Domain, "live aliases should move with the domain")
+			kept, err := aliases.Find(ctx, domain.FindAliasParameters{ID: &old.ID})
+			assert.NoError(t, err)
+			assert.Equal(t, "before.com", kept.Domain, "deleted aliases should keep their history")
+			_, err = repo.RenameDomain(ctx, d.ID, "Other.com")
+			assert.Error(t, err, "renaming to another domain's name shouldn't be allowed")
+			_, err = repo.RenameDomain(ctx, d.ID+1000, "missing.com")
+			assert.ErrorIs(t, err, domain.ErrNotFound)
+
+			deleted, err := repo.DeleteDomain(ctx, d.ID)
+			assert.NoError(t, err, "deleting a domain shouldn't error")
+			require.NotNil(t, deleted.DeletedAt)
+			deactivated, err := aliases.Find(ctx, domain.FindAliasParameters{ID: &support.ID})
+			assert.NoError(t, err)
+			assert.NotNil(t, deactivated.DeletedAt, "the domain's aliases should be deactivated")
+			untouched, err := aliases.Find(ctx, domain.FindAliasParameters{ID: &otherAlias.ID})
+			assert.NoError(t, err)
+			assert.Nil(t, untouched.DeletedAt, "other domains' aliases should be untouched")
+
+			_, err = repo.GetDomain(ctx, d.ID)
+			assert.ErrorIs(t, err, domain.ErrNotFound, "deleted domains shouldn't be returned")
+			_, err = repo.GetDomainByName(ctx, "after.com")
+			assert.ErrorIs(t, err, domain.ErrNotFound, "deleted domains shouldn't be returned")
+			domains, err := repo.GetDomains(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, []domain.DNSDomain{other}, domains, "deleted domains shouldn't be listed")
+			_, err = repo.DeleteDomain(ctx, d.ID)
+			assert.ErrorIs(t, err, domain.ErrNotFound, "deleting a deleted domain should be not found")
+			_, err = repo.SetVerified(ctx, d.ID, time.Now())
+			assert.ErrorIs(t, err, domain.ErrNotFound, "deleted domains shouldn't be verified")
+
+			again, err := repo.CreateDomain(ctx, domain.DNSDomain{Name: "after.com"})
+			assert.NoError(t, err, "a deleted domain's name should be available again")
+			assert.NotEqual(t, d.ID, again.ID)
+			_, err = repo.CreateDomain(ctx, domain.DNSDomain{Name: "AFTER.com"})
+			assert.Error(t, err, "live domains should be unique regardless of case")
+		})
+	}
+}
+
+func TestMailServerRepository(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := sqlrepository.NewMailServerRepository(db)
+			aliases := sqlrepository.NewAliasRepository(db)
+			domains := sqlrepository.NewDNSDomainRepository(db)
+
+			verified, err := domains.CreateDomain(ctx, domain.DNSDomain{Name: "example.com"})
+			require.NoError(t, err)
+			_, err = domains.SetVerified(ctx, verified.ID, time.Now())
+			require.NoError(t, err)
+			_, err = domains.CreateDomain(ctx, domain.DNSDomain{Name: "unverified.com"})
+			require.NoError(t, err)
+			support, err := aliases.Create(ctx, "support", "example.com")
+			require.NoError(t, err)
+			sales, err := aliases.Create(ctx, "sales", "test.com")
+			require.NoError(t, err)
+			old, err := aliases.Create(ctx, "old", "example.com")
+			require.NoError(t, err)
+			_, err = aliases.Delete(ctx, old.ID)
+			require.NoError(t, err)
+
+			authoritative, err := repo.GetAuthoritativeDomains(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"example.com"}, authoritative, "only verified domains should be authoritative")
+
+			got, err := repo.GetAliases(ctx, ptr.To("example.com"))
+			assert.NoError(t, err)
+			assert.Equal(t, []domain.Alias{support}, got, "only live aliases for the domain should be returned")
+
+			got, err = repo.GetAliases(ctx, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, []domain.Alias{support, sales}, got, "all live aliases should be returned")
+
+			body := "Body test data\r\n"
+			msg := mail.Message{
+				Header: mail.Header{
+					"Subject": {"Test Message"},
+					"From":    {"Qux <qux@example.com>"},
+				},
+				Body: strings.NewReader(body),
+			}
+			date := time.Date(2023, 9, 18, 17, 58, 7, 0, time.UTC)
+			created, err := repo.CreateEmail(ctx, domain.Email{
+				MessageID:  "1@example.com",
+				Subject:    "Test Message",
+				Sender:     "qux@example.com",
+				Recipients: []string{"support@example.com", "foo@bar.com"},
+				Date:       date,
+				Message:    msg,
+				TextBody:   "Body test data",
+				HTMLBody:   "<p>Body test data</p>",
+				Attachments: []domain.Attachment{
+					{ContentType: "application/pdf", Filename: "report.pdf", Content: []byte("%PDF-1.4")},
+				},
+				Authentication: &domain.EmailAuthentication{
+					SPF:         domain.AuthCheck{Result: domain.AuthResultPass, Domain: "example.com"},
+					DKIM:        domain.AuthCheck{Result: domain.AuthResultNone},
+					DMARC:       domain.AuthCheck{Result: domain.AuthResultFail, Domain: "example.com"},
+					DMARCPolicy: "quarantine",
+					Flagged:     true,
+				},
+				Spam: &domain.SpamReport{
+					Score:  6.5,
+					Rules:  []domain.SpamRule{{Name: "MISSING_DATE", Score: 1.5}, {Name: "BAYES", Score: 5}},
+					Action: domain.SpamActionTag,
+				},
+			})
+			assert.NoError(t, err, "creating an email shouldn't error")
+			assert.NotZero(t, created.ID)
+			createdBody, err := io.ReadAll(created.Message.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, body, string(createdBody), "returned message body should still be readable")
+
+			found, err := repo.FindEmail(ctx, created.ID)
+			assert.NoError(t, err, "finding an email shouldn't error")
+			assert.Equal(t, "1@example.com", found.MessageID)
+			assert.Equal(t, "Test Message", found.Subject)
+			assert.Equal(t, "qux@example.com", found.Sender)
+			assert.Equal(t, []string{"support@example.com", "foo@bar.com"}, found.Recipients)
+			assert.True(t, date.Equal(found.Date), "date should match")
+			assert.Equal(t, "Qux <qux@example.com>", found.Message.Header.Get("From"))
+			foundBody, err := io.ReadAll(found.Message.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, body, string(foundBody), "stored message body should match")
+			assert.Equal(t, "Body test data", found.TextBody)
+			assert.Equal(t, "<p>Body test data</p>", found.HTMLBody)
+			require.Len(t, found.Attachments, 1)
+			assert.Equal(t, domain.Attachment{ID: created.Attachments[0].ID, EmailID: created.ID, ContentType: "application/pdf", Filename: "report.pdf", Size: 8}, found.Attachments[0], "attachments should be listed without content")
+
+			assert.Equal(t, created.Authentication, found.Authentication, "authentication results should be stored")
+			assert.Equal(t, created.Spam, found.Spam, "spam report should be stored")
+
+			attachment, err := repo.FindAttachment(ctx, created.Attachments[0].ID)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("%PDF-1.4"), attachment.Content, "attachment content should be stored")
+			_, err = repo.FindAttachment(ctx, created.Attachments[0].ID+1000)
+			assert.ErrorIs(t, err, domain.ErrNotFound, "missing attachment should be not found")
+
+			// Signatures and trace headers depend on the original order and folding
+			raw := []byte("Received: from mx.example.com\r\n\tby test.com; Mon, 18 Sep 2023 17:58:07 +0000\r\nSubject: Signed\r\nDKIM-Signature: v=1; d=example.com;\r\n h=Subject:From\r\nFrom: qux@example.com\r\n\r\nSigned body\r\n")
+			parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+			require.NoError(t, err)
+			signed, err := repo.CreateEmail(ctx, domain.Email{MessageID: "signed@example.com", Date: date, Message: *parsed, Raw: raw})
+			require.NoError(t, err)
+			signedBody, err := io.ReadAll(signed.Message.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, "Signed body\r\n", string(signedBody), "returned message body should still be readable")
+			found, err = repo.FindEmail(ctx, signed.ID)
+			require.NoError(t, err)
+			assert.Equal(t, raw, found.Raw, "the raw message should be stored verbatim")
+
+			_, err = repo.FindEmail(ctx, created.ID+1000)
+			assert.ErrorIs(t, err, domain.ErrNotFound, "missing email should be not found")
+
+			ticket, err := sqlrepository.NewTicketRepository(db).Open(ctx, "test")
+			require.NoError(t, err)
+			assert.ErrorIs(t, repo.LinkTicket(ctx, created.ID+1000, ticket.ID), domain.ErrNotFound, "linking a missing email should be not found")
+			assert.NoError(t, repo.LinkTicket(ctx, created.ID, ticket.ID), "linking an email shouldn't error")
+
+			unchecked, err := repo.CreateEmail(ctx, domain.Email{MessageID: "2@example.com", Date: date, Message: mail.Message{Header: mail.Header{}, Body: strings.NewReader("")}})
+			require.NoError(t, err)
+			found, err = repo.FindEmail(ctx, unchecked.ID)
+			assert.NoError(t, err)
+			assert.Nil(t, found.Authentication, "unchecked email shouldn't have authentication results")
+			assert.Nil(t, found.Spam, "unscored email shouldn't have a spam report")
+
+			_, err = repo.CreateEmail(ctx, domain.Email{
+				MessageID: "3@example.com", Date: date, Message: mail.Message{Header: mail.Header{}, Body: strings.NewReader("")},
+				Spam: &domain.SpamReport{Score: math.NaN(), Rules: []domain.SpamRule{{Name: "BROKEN", Score: math.Inf(1)}}},
+			})
+			assert.Error(t, err, "spam rules that can't be encoded should error rather than panic")
+
+			_, err = repo.FindTicketIDByMessageID(ctx, "1@example.com")
+			assert.ErrorIs(t, err, domain.ErrNotFound, "unindexed message ids shouldn't resolve to a ticket")
+			assert.NoError(t, repo.IndexMessageID(ctx, "1@example.com", ticket.ID), "indexing a message id shouldn't error")
+			other, err := sqlrepository.NewTicketRepository(db).Open(ctx, "other")
+			require.NoError(t, err)
+			assert.NoError(t, repo.IndexMessageID(ctx, "1@example.com", other.ID), "re-indexing a message id shouldn't error")
+
+			ticketID, err := repo.FindTicketIDByMessageID(ctx, "1@example.com")
+			assert.NoError(t, err)
+			assert.Equal(t, ticket.ID, ticketID, "message id should keep resolving to the first ticket")
+
+			ticketEmails, err := repo.FindTicketEmails(ctx, ticket.ID)
+			assert.NoError(t, err)
+			assert.Len(t, ticketEmails, 1)
+			assert.Equal(t, created.ID, ticketEmails[0].ID)
+			assert.Equal(t, &ticket.ID, ticketEmails[0].TicketID)
+		})
+	}
+}
+
+func TestSpamRepository(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := sqlrepository.NewSpamRepository(db)
+			emails := sqlrepository.NewEmailRepository(db)
+			newEmail := func(messageID string) uint64 {
+				e, err := emails.CreateEmail(ctx, domain.Email{MessageID: messageID, Date: time.Now(), Message: mail.Message{Header: mail.Header{}, Body: strings.NewReader("")}})
+				require.NoError(t, err)
+				return e.ID
+			}
+			first, second := newEmail("1@example.com"), newEmail("2@example.com")
+
+			spam, ham, err := repo.SpamTrainingTotals(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, spam)
+			assert.Equal(t, 0, ham)
+
+			assert.NoError(t, repo.TrainSpam(ctx, first, []string{"viagra", "hello"}, true), "training spam shouldn't error")
+			assert.NoError(t, repo.TrainSpam(ctx, first, []string{"viagra", "hello"}, true), "training the same class again shouldn't error")
+			assert.NoError(t, repo.TrainSpam(ctx, second, []string{"hello", "invoice"}, false), "training ham shouldn't error")
+
+			counts, err := repo.SpamTokenCounts(ctx, []string{"viagra", "hello", "invoice", "unseen"})
+			assert.NoError(t, err)
+			assert.Equal(t, map[string]domain.SpamTokenCount{
+				"viagra":  {Spam: 1},
+				"hello":   {Spam: 1, Ham: 1},
+				"invoice": {Ham: 1},
+			}, counts, "training the same class twice shouldn't count twice, and unseen tokens should be left out")
+			spam, ham, err = repo.SpamTrainingTotals(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, spam)
+			assert.Equal(t, 1, ham)
+
+			assert.NoError(t, repo.TrainSpam(ctx, first, []string{"viagra", "hello"}, false), "retraining as ham shouldn't error")
+			counts, err = repo.SpamTokenCounts(ctx, []string{"viagra", "hello"})
+			assert.NoError(t, err)
+			assert.Equal(t, map[string]domain.SpamTokenCount{
+				"viagra": {Ham: 1},
+				"hello":  {Ham: 2},
+			}, counts, "retraining should move the tokens to the other class")
+			spam, ham, err = repo.SpamTrainingTotals(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, spam)
+			assert.Equal(t, 2, ham)
+
+			many := make([]string, 1200)
+			for i := range many {
+				many[i] = fmt.Sprintf("token%d", i)
+			}
+			assert.NoError(t, repo.TrainSpam(ctx, newEmail("3@example.com"), many, true))
+			counts, err = repo.SpamTokenCounts(ctx, many)
+			assert.NoError(t, err)
+			assert.Len(t, counts, len(many), "tokens should be looked up in batches")
+		})
+	}
+}
+
+func TestQuarantineRepository(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := sqlrepository.NewEmailRepository(db)
+			held := time.Date(2023, 9, 18, 17, 58, 7, 0, time.UTC)
+			newEmail := func(e domain.Email) domain.Email {
+				e.Date = held
+				e.Message = mail.Message{Header: mail.Header{}, Body: strings.NewReader("")}
+				e.Attachments = []domain.Attachment{{ContentType: "text/plain", Filename: "note.txt", Content: []byte("hi")}}
+				created, err := repo.CreateEmail(ctx, e)
+				require.NoError(t, err)
+				return created
+			}
+			quarantine := func(reason domain.QuarantineReason, at time.Time) *domain.Quarantine {
+				return &domain.Quarantine{Reason: reason, Detail: "detail", Recipients: []string{"support@example.com"}, QuarantinedAt: at}
+			}
+
+			spam := newEmail(domain.Email{MessageID: "1@example.com", Sender: "spam@example.com", Recipients: []string{"support@example.com"}, Quarantine: quarantine(domain.QuarantineReasonSpam, held)})
+			auth := newEmail(domain.Email{MessageID: "2@example.com", Sender: "bob@example.com", Quarantine: quarantine(domain.QuarantineReasonAuthentication, held.Add(time.Hour))})
+			stranger := newEmail(domain.Email{MessageID: "3@example.com", Sender: "carol@example.com", Quarantine: quarantine(domain.QuarantineReasonUnknownSender, held.Add(2*time.Hour))})
+			ham := newEmail(domain.Email{MessageID: "4@example.com", Sender: "Dave@Example.com"})
+
+			found, err := repo.FindEmail(ctx, spam.ID)
+			require.NoError(t, err)
+			require.NotNil(t, found.Quarantine, "the quarantine should be stored")
+			assert.Equal(t, domain.QuarantineReasonSpam, found.Quarantine.Reason)
+			assert.Equal(t, "detail", found.Quarantine.Detail)
+			assert.Equal(t, []string{"support@example.com"}, found.Quarantine.Recipients)
+			assert.True(t, held.Equal(found.Quarantine.QuarantinedAt), "quarantine time should match")
+			found, err = repo.FindEmail(ctx, ham.ID)
+			require.NoError(t, err)
+			assert.Nil(t, found.Quarantine, "ticketed email shouldn't be quarantined")
+
+			listed, err := repo.FindQuarantined(ctx, domain.QuarantineFilter{})
+			assert.NoError(t, err)
+			assert.Equal(t, []uint64{stranger.ID, auth.ID, spam.ID}, emailIDs(listed), "quarantined email should be listed newest first")
+			reason := domain.QuarantineReasonAuthentication
+			listed, err = repo.FindQuarantined(ctx, domain.QuarantineFilter{Reason: &reason})
+			assert.NoError(t, err)
+			assert.Equal(t, []uint64{auth.ID}, emailIDs(listed))
+			listed, err = repo.FindQuarantined(ctx, domain.QuarantineFilter{Before: &stranger.ID, Limit: 1})
+			assert.NoError(t, err)
+			assert.Equal(t, []uint64{auth.ID}, emailIDs(listed), "pages should continue before the ID")
+
+			assert.NoError(t, repo.ReleaseQuarantined(ctx, auth.ID), "releasing quarantined email shouldn't error")
+			found, err = repo.FindEmail(ctx, auth.ID)
+			require.NoError(t, err)
+			assert.Nil(t, found.Quarantine, "released email should leave quarantine")
+			assert.ErrorIs(t, repo.ReleaseQuarantined(ctx, auth.ID), domain.ErrNotFound, "email should only be released once")
+			assert.NoError(t, repo.RestoreQuarantined(ctx, auth.ID, *auth.Quarantine), "restoring released email shouldn't error")
+			found, err = repo.FindEmail(ctx, auth.ID)
+			require.NoError(t, err)
+			require.NotNil(t, found.Quarantine, "restored email should be back in quarantine")
+			assert.Equal(t, domain.QuarantineReasonAuthentication, found.Quarantine.Reason)
+			assert.True(t, auth.Quarantine.QuarantinedAt.Equal(found.Quarantine.QuarantinedAt), "restored email should keep its quarantine time")
+			assert.NoError(t, repo.ReleaseQuarantined(ctx, auth.ID), "restored email should be released again")
+
+			assert.ErrorIs(t, repo.DeleteQuarantined(ctx, ham.ID), domain.ErrNotFound, "email that isn't quarantined shouldn't be deleted")
+			assert.NoError(t, repo.DeleteQuarantined(ctx, stranger.ID), "deleting quarantined email shouldn't error")
+			_, err = repo.FindEmail(ctx, stranger.ID)
+			assert.ErrorIs(t, err, domain.ErrNotFound, "deleted email should be gone")
+			_, err = repo.FindAttachment(ctx, stranger.Attachments[0].ID)
+			assert.ErrorIs(t, err, domain.ErrNotFound, "deleted email's attachments should be gone")
+			unsent := newEmail(domain.Email{MessageID: "5@example.com", Sender: "support@example.com", Recipients: []string{"bob@example.com"}, Outbound: true})
+			assert.NoError(t, repo.DeleteEmail(ctx, unsent.ID), "deleting email shouldn't error")
+			_, err = repo.FindEmail(ctx, unsent.ID)
+			assert.ErrorIs(t, err, domain.ErrNotFound, "deleted email should be gone")
+
+			expired, err := repo.ExpireQuarantine(ctx, held.Add(time.Minute))
+			assert.NoError(t, err)
+			assert.Equal(t, 1, expired)
+			_, err = repo.FindEmail(ctx, spam.ID)
+			assert.ErrorIs(t, err, domain.ErrNotFound, "expired email should be gone")
+			listed, err = repo.FindQuarantined(ctx, domain.QuarantineFilter{})
+			assert.NoError(t, err)
+			assert.Empty(t, listed)
+
+			known, err := repo.IsKnownSender(ctx, "dave@example.com")
+			assert.NoError(t, err)
+			assert.False(t, known, "senders whose mail wasn't ticketed shouldn't be known")
+			ticket, err := sqlrepository.NewTicketRepository(db).Open(ctx, "test")
+			require.NoError(t, err)
+			require.NoError(t, repo.LinkTicket(ctx, ham.ID, ticket.ID))
+			known, err = repo.IsKnownSender(ctx, "dave@example.com")
+			assert.NoError(t, err)
+			assert.True(t, known, "senders with ticketed mail should be known, regardless of case")
+
+			newEmail(domain.Email{MessageID: "5@example.com", Outbound: true, Recipients: []string{"Erin@example.com"}})
+			known, err = repo.IsKnownSender(ctx, "erin@example.com")
+			assert.NoError(t, err)
+			assert.True(t, known, "addresses we've sent mail to should be known")
+			known, err = repo.IsKnownSender(ctx, "carol@example.com")
+			assert.NoError(t, err)
+			assert.False(t, known)
+		})
+	}
+}
+
+func emailIDs(emails []domain.Email) []uint64 {
+	IDs := make([]uint64, 0, len(emails))
+	for _, e := range emails {
+		IDs = append(IDs, e.ID)
+	}
+	return IDs
+}
+
+func TestOutboundRepository(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := sqlrepository.NewOutboundRepository(db)
+			ticket, err := sqlrepository.NewTicketRepository(db).Open(ctx, "test")
+			require.NoError(t, err)
+
+			now := time.Now()
+			queued, err := repo.Enqueue(ctx, domain.OutboundMessage{
+				TicketID:      &ticket.ID,
+				MessageID:     "1@test.com",
+				From:          "support@test.com",
+				To:            []string{"bob@example.com", "alice@example.com"},
+				Message:       []byte("Subject: Hi\r\n\r\nHi\r\n"),
+				Status:        domain.OutboundStatusQueued,
+				NextAttemptAt: now,
+				CreatedAt:     now,
+				UpdatedAt:     now,
+			})
+			assert.NoError(t, err, "enqueueing shouldn't error")
+			assert.NotZero(t, queued.ID)
+			assert.Equal(t, []string{"bob@example.com", "alice@example.com"}, queued.To)
+			assert.Equal(t, &ticket.ID, queued.TicketID)
+			assert.Nil(t, queued.EmailID)
+			assert.Equal(t, []byte("Subject: Hi\r\n\r\nHi\r\n"), queued.Message)
+
+			later, err := repo.Enqueue(ctx, domain.OutboundMessage{
+				MessageID:     "2@test.com",
+				From:          "support@test.com",
+				To:            []string{"carol@example.com"},
+				Message:       []byte("Subject: Later\r\n\r\nLater\r\n"),
+				Status:        domain.OutboundStatusDeferred,
+				NextAttemptAt: now.Add(time.Hour),
+				CreatedAt:     now,
+				UpdatedAt:     now,
+			})
+			require.NoError(t, err)
+
+			due, err := repo.FindDue(ctx, now, 10)
+			assert.NoError(t, err)
+			require.Len(t, due, 1, "only messages due by now should be found")
+			assert.Equal(t, queued.ID, due[0].ID)
+
+			due, err = repo.FindDue(ctx, now.Add(2*time.Hour), 10)
+			assert.NoError(t, err)
+			assert.Len(t, due, 2, "deferred messages should be found once due")
+			due, err = repo.FindDue(ctx, now.Add(2*time.Hour), 1)
+			assert.NoError(t, err)
+			assert.Len(t, due, 1, "due messages should be limited")
+
+			sent, err := repo.Update(ctx, queued.ID, domain.OutboundUpdateParameters{Status: domain.OutboundStatusSent, Attempts: 1, NextAttemptAt: now})
+			assert.NoError(t, err)
+			assert.Equal(t, domain.OutboundStatusSent, sent.Status)
+			assert.Equal(t, 1, sent.Attempts)
+			due, err = repo.FindDue(ctx, now.Add(2*time.Hour), 10)
+			assert.NoError(t, err)
+			require.Len(t, due, 1, "sent messages shouldn't be due")
+			assert.Equal(t, later.ID, due[0].ID)
+
+			found, err := repo.FindByMessageID(ctx, "1@test.com")
+			assert.NoError(t, err)
+			assert.Equal(t, queued.ID, found.ID)
+			_, err = repo.FindByMessageID(ctx, "unknown@test.com")
+			assert.ErrorIs(t, err, domain.ErrNotFound)
+			_, err = repo.Update(ctx, later.ID+1000, domain.OutboundUpdateParameters{Status: domain.OutboundStatusFailed})
+			assert.ErrorIs(t, err, domain.ErrNotFound)
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package sqlrepository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/nil-nil/ticket/internal/domain"
+)
+
+// Make sure we conform to domain.TicketTextRepository
+var _ domain.TicketTextRepository = (*TicketTextRepository)(nil)
+
+const (
+	// textTermBatch bounds the number of rows in each term insert, as SQLite limits the number of parameters
+	textTermBatch = 200
+	// maxTicketMatches is how many snippets of each ticket's matching text searches return
+	maxTicketMatches = 3
+	// maxTermCount bounds the occurrences of each term counted to find a phrase's rarest term
+	maxTermCount = 1000
+)
+
+func NewTicketTextRepository(db *DB) *TicketTextRepository {
+	return &TicketTextRepository{db: db}
+}
+
+// NewTicketIndexer returns an indexer of the database's tickets and email, into its full-text index.
+func NewTicketIndexer(db *DB) *domain.TicketIndexer {
+	return domain.NewTicketIndexer(NewTicketTextRepository(db), NewTicketRepository(db), NewEmailRepository(db))
+}
+
+// TicketTextRepository stores the full-text index TicketRepository.Search finds text with.
+type TicketTextRepository struct {
+	db *DB
+}
+
+func (r *TicketTextRepository) ReplaceTicketTexts(ctx context.Context, ticketID uint64, texts []domain.TicketText) error {
+	return r.db.inTx(ctx, func(tx *sql.Tx) error {
+		return replaceTicketTexts(ctx, r.db, tx, ticketID, texts)
+	})
+}
+
+func replaceTicketTexts(ctx context.Context, d *DB, tx *sql.Tx, ticketID uint64, texts []domain.TicketText) error {
+	if _, err := tx.ExecContext(ctx, d.dialect.rebind("DELETE FROM ticket_text_terms WHERE ticket_id = ?"), ticketID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, d.dialect.rebind("DELETE FROM ticket_texts WHERE ticket_id = ?"), ticketID); err != nil {
+		return err
+	}
+
+	for _, text := range texts {
+		var textID uint64
+		err := tx.QueryRowContext(ctx,
+			d.dialect.rebind("INSERT INTO ticket_texts (ticket_id, source, source_id, body) VALUES (?, ?, ?, ?) RETURNING id"),
+			ticketID, text.Source, text.SourceID, text.Text,
+		).Scan(&textID)
+		if err != nil {
+			return err
+		}
+
+		tokens := domain.AnalyzeText(text.Text)
+		for start := 0; start < len(tokens); start += textTermBatch {
+			batch := tokens[start:min(start+textTermBatch, len(tokens))]
+			values := make([]string, 0, len(batch))
+			args := make([]any, 0, 4*len(batch))
+			for _, token := range batch {
+				values = append(values, "(?, ?, ?, ?)")
+				args = append(args, textID, token.Position, ticketID, token.Term)
+			}
+			_, err := tx.ExecContext(ctx,
+				d.dialect.rebind("INSERT INTO ticket_text_terms (text_id, position, ticket_id, term) VALUES "+strings.Join(values, ", ")),
+				args...,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// textConditions returns the where clause conditions matching tickets, as ticket_states aliased as s, with each phrase in one of their texts.
+//
+// A phrase's terms are joined on their positions, so they must be found in the same text as far apart as they are in the phrase.
+// The join starts from the phrase's rarest term, as every occurrence of the term it starts from is joined.
+func (r *TicketRepository) textConditions(ctx context.Context, phrases []domain.TextPhrase) ([]string, []any, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+	for _, phrase := range phrases {
+		first, err := r.rarestTerm(ctx, phrase)
+		if err != nil {
+			return nil, nil, err
+		}
+		var joins, where []string
+		var joinArgs, whereArgs []any
+		for i, token := range phrase {
+			alias := fmt.Sprintf("x%d", (i-first+len(phrase))%len(phrase))
+			where = append(where, alias+".term = ?")
+			whereArgs = append(whereArgs, token.Term)
+			if i != first {
+				joins = append(joins, fmt.Sprintf("JOIN ticket_text_terms %[1]s ON %[1]s.text_id = x0.text_id AND %[1]s.position = x0.position + ?", alias))
+				joinArgs = append(joinArgs, token.Position-phrase[first].Position)
+			}
+		}
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM ticket_text_terms x0 "+strings.Join(joins, " ")+
+			" WHERE x0.ticket_id = s.ticket_id AND "+strings.Join(where, " AND ")+")")
+		args = append(append(args, joinArgs...), whereArgs...)
+	}
+	return conditions, args, nil
+}
+
+// rarestTerm returns the index of the phrase's least indexed term. Terms are counted up to maxTermCount, past which they're all as common.
+func (r *TicketRepository) rarestTerm(ctx context.Context, phrase domain.TextPhrase) (int, error) {
+	if len(phrase) == 1 {
+		return 0, nil
+	}
+	counts := make([]string, 0, len(phrase))
+	args := make([]any, 0, len(phrase)+1)
+	for i, token := range phrase {
+		counts = append(counts, fmt.Sprintf("SELECT %[1]d AS i, COUNT(*) AS n FROM (SELECT 1 FROM ticket_text_terms WHERE term = ? LIMIT %[2]d) c%[1]d", i, maxTermCount))
+		args = append(args, token.Term)
+	}
+	rows, err := r.db.db.QueryContext(ctx, r.db.dialect.rebind(strings.Join(counts, " UNION ALL ")), args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	rarest, fewest := 0, maxTermCount+1
+	for rows.Next() {
+		var i, n int
+		if err := rows.Scan(&i, &n); err != nil {
+			return 0, err
+		}
+		if n < fewest || n == fewest && i < rarest {
+			rarest, fewest = i, n
+		}
+	}
+	return rarest, rows.Err()
+}
+
+// findTextMatches highlights where the phrases were found in each ticket's texts, in the order the texts were written.
+func (r *TicketRepository) findTextMatches(ctx context.Context, ticketIDs []uint64, phrases []domain.TextPhrase) (map[uint64][]domain.TextMatch, error) {
+	var terms []any
+	for _, phrase := range phrases {
+		for _, token := range phrase {
+			terms = append(terms, token.Term)
+		}
+	}
+	args := make([]any, 0, len(ticketIDs)+len(terms))
+	for _, ID := range ticketIDs {
+		args = append(args, ID)
+	}
+	args = append(args, terms...)
+
+	rows, err := r.db.db.QueryContext(ctx, r.db.dialect.rebind(
+		"SELECT t.ticket_id, t.source, t.source_id, t.body FROM ticket_texts t WHERE t.ticket_id IN ("+placeholders(len(ticketIDs))+")"+
+			" AND EXISTS (SELECT 1 FROM ticket_text_terms x WHERE x.text_id = t.id AND x.term IN ("+placeholders(len(terms))+")) ORDER BY t.id",
+	), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := make(map[uint64][]domain.TextMatch)
+	for rows.Next() {
+		var (
+			ticketID uint64
+			text     domain.TicketText
+		)
+		if err := rows.Scan(&ticketID, &text.Source, &text.SourceID, &text.Text); err != nil {
+			return nil, err
+		}
+		if len(matches[ticketID]) >= maxTicketMatches {
+			continue
+		}
+		if match, ok := domain.HighlightText(text, phrases); ok {
+			matches[ticketID] = append(matches[ticketID], match)
+		}
+	}
+	return matches, rows.Err()
+}
+
+// backfillTicketTexts indexes the text of the tickets created before the full-text index, as of 0021_ticket_texts.
+func backfillTicketTexts(ctx context.Context, d *DB, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `SELECT t.ticket_id, t.timestamp, t.description, c.id, c.body
+		FROM ticket_transitions t LEFT JOIN ticket_comments c ON c.id = t.comment_id
+		ORDER BY t.ticket_id, t.id`)
+	if err != nil {
+		return err
+	}
+	var tickets []domain.Ticket
+	for rows.Next() {
+		var (
+			ticketID    uint64
+			transition  domain.TicketTransition
+			description sql.NullString
+			commentID   sql.NullInt64
+			body        sql.NullString
+		)
+		if err := rows.Scan(&ticketID, &transition.Timestamp, &description, &commentID, &body); err != nil {
+			rows.Close()
+			return err
+		}
+		if description.Valid {
+			transition.Description = &description.String
+		}
+		if commentID.Valid {
+			transition.Comment = &domain.TicketComment{ID: uint64(commentID.Int64), Body: body.String}
+		}
+
+		if len(tickets) == 0 || tickets[len(tickets)-1].ID != ticketID {
+			tickets = append(tickets, domain.Ticket{ID: ticketID})
+		}
+		tickets[len(tickets)-1].Transitions = append(tickets[len(tickets)-1].Transitions, transition)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, ticket := range tickets {
+		emails, err := findTicketEmailTexts(ctx, d, tx, ticket.ID)
+		if err != nil {
+			return err
+		}
+		if err := replaceTicketTexts(ctx, d, tx, ticket.ID, domain.TicketTexts(ticket, emails)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findTicketEmailTexts returns the emails linked to a ticket with only what's indexed of them, as the backfill can't use EmailRepository outside its transaction.
+func findTicketEmailTexts(ctx context.Context, d *DB, tx *sql.Tx, ticketID uint64) ([]domain.Email, error) {
+	rows, err := tx.QueryContext(ctx, d.dialect.rebind("SELECT id, subject, text_body FROM emails WHERE ticket_id = ? ORDER BY id"), ticketID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []domain.Email
+	for rows.Next() {
+		var e domain.Email
+		if err := rows.Scan(&e.ID, &e.Subject, &e.TextBody); err != nil {
+			return nil, err
+		}
+		emails = append(emails, e)
+	}
+	return emails, rows.Err()
+}
@@ -0,0 +1,698 @@
+package sqlrepository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nil-nil/ticket/internal/domain"
+)
+
+// Make sure we conform to domain.TicketRepository
+var _ domain.TicketRepository = (*TicketRepository)(nil)
+
+func NewTicketRepository(db *DB) *TicketRepository {
+	return &TicketRepository{db: db}
+}
+
+type TicketRepository struct {
+	db *DB
+}
+
+func (r *TicketRepository) Find(ctx context.Context, ID uint64) (domain.Ticket, error) {
+	return r.find(ctx, r.db.db, ID)
+}
+
+func (r *TicketRepository) Open(ctx context.Context, Description string) (domain.Ticket, error) {
+	var ticket domain.Ticket
+	err := r.db.inTx(ctx, func(tx *sql.Tx) error {
+		now := time.Now().UTC()
+
+		var ID uint64
+		err := tx.QueryRowContext(ctx, r.db.dialect.rebind("INSERT INTO tickets (created_at) VALUES (?) RETURNING id"), now).Scan(&ID)
+		if err != nil {
+			return err
+		}
+
+		err = r.appendTransition(ctx, tx, ID, domain.TicketTransition{
+			Timestamp:   now,
+			Status:      domain.TicketStatusOpen,
+			Description: &Description,
+		})
+		if err != nil {
+			return err
+		}
+
+		ticket, err = r.find(ctx, tx, ID)
+		if err != nil {
+			return err
+		}
+		return r.saveState(ctx, tx, ticket)
+	})
+	if err != nil {
+		return domain.Ticket{}, err
+	}
+
+	return ticket, nil
+}
+
+func (r *TicketRepository) Update(ctx context.Context, ID uint64, Params domain.TicketUpdateParameters) (domain.Ticket, error) {
+	var ticket domain.Ticket
+	err := r.db.inTx(ctx, func(tx *sql.Tx) error {
+		var exists uint64
+		err := tx.QueryRowContext(ctx, r.db.dialect.rebind("SELECT id FROM tickets WHERE id = ?"), ID).Scan(&exists)
+		if err != nil {
+			return notFound(err)
+		}
+
+		if Params.FromStatus != domain.TicketStatusUnknown {
+			// Writing the state locks it, so the status can't change again before the transition is appended
+			result, err := tx.ExecContext(ctx, r.db.dialect.rebind("UPDATE ticket_states SET status = status WHERE ticket_id = ? AND status = ?"), ID, Params.FromStatus)
+			if err != nil {
+				return err
+			}
+			if n, err := result.RowsAffected(); err != nil {
+				return err
+			} else if n == 0 {
+				return domain.ErrStatusChanged
+			}
+		}
+
+		var comment *domain.TicketComment
+		if Params.Comment != nil {
+			comment, err = r.insertComment(ctx, tx, ID, *Params.Comment)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = r.appendTransition(ctx, tx, ID, domain.TicketTransition{
+			Timestamp:   time.Now().UTC(),
+			Status:      Params.Status,
+			OwnerID:     Params.OwnerID,
+			Description: Params.Description,
+			EmailID:     Params.EmailID,
+			Spam:        Params.Spam,
+			AddTags:     domain.NormalizeTags(Params.AddTags),
+			RemoveTags:  domain.NormalizeTags(Params.RemoveTags),
+			Priority:    Params.Priority,
+			Type:        Params.Type,
+			Queue:       Params.Queue,
+			Resolution:  Params.Resolution,
+			SetFields:   Params.SetFields,
+			Comment:     comment,
+		})
+		if err != nil {
+			return err
+		}
+
+		ticket, err = r.find(ctx, tx, ID)
+		if err != nil {
+			return err
+		}
+		return r.saveState(ctx, tx, ticket)
+	})
+	if err != nil {
+		return domain.Ticket{}, err
+	}
+
+	return ticket, nil
+}
+
+// insertComment stores a comment and its attachments, returning it with their IDs set.
+func (r *TicketRepository) insertComment(ctx context.Context, tx *sql.Tx, ticketID uint64, comment domain.TicketComment) (*domain.TicketComment, error) {
+	err := tx.QueryRowContext(ctx,
+		r.db.dialect.rebind("INSERT INTO ticket_comments (ticket_id, author_id, body, visibility) VALUES (?, ?, ?, ?) RETURNING id"),
+		ticketID, comment.AuthorID, comment.Body, comment.Visibility,
+	).Scan(&comment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	comment.Attachments = slices.Clone(comment.Attachments)
+	for i := range comment.Attachments {
+		attachment := &comment.Attachments[i]
+		attachment.CommentID = comment.ID
+		attachment.Size = int64(len(attachment.Content))
+		err := tx.QueryRowContext(ctx,
+			r.db.dialect.rebind("INSERT INTO comment_attachments (comment_id, content_type, filename, size, content) VALUES (?, ?, ?, ?, ?) RETURNING id"),
+			attachment.CommentID, attachment.ContentType, attachment.Filename, attachment.Size, attachment.Content,
+		).Scan(&attachment.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &comment, nil
+}
+
+// FindCommentAttachment returns a single comment attachment including its content.
+func (r *TicketRepository) FindCommentAttachment(ctx context.Context, ID uint64) (domain.Attachment, error) {
+	var a domain.Attachment
+	err := r.db.db.QueryRowContext(ctx, r.db.dialect.rebind("SELECT id, comment_id, content_type, filename, size, content FROM comment_attachments WHERE id = ?"), ID).
+		Scan(&a.ID, &a.CommentID, &a.ContentType, &a.Filename, &a.Size, &a.Content)
+	if err != nil {
+		return domain.Attachment{}, notFound(err)
+	}
+	return a, nil
+}
+
+func (r *TicketRepository) appendTransition(ctx context.Context, q querier, ticketID uint64, transition domain.TicketTransition) error {
+	tags, err := encodeTags(transition.AddTags)
+	if err != nil {
+		return err
+	}
+	removeTags, err := encodeTags(transition.RemoveTags)
+	if err != nil {
+		return err
+	}
+	fields, err := encodeFields(transition.SetFields)
+	if err != nil {
+		return err
+	}
+	var commentID *uint64
+	if transition.Comment != nil {
+		commentID = &transition.Comment.ID
+	}
+
+	_, err = q.ExecContext(ctx,
+		r.db.dialect.rebind("INSERT INTO ticket_transitions (ticket_id, timestamp, status, owner_id, description, email_id, spam, add_tags, priority, queue, resolution, comment_id, remove_tags, ticket_type, set_fields) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		ticketID, transition.Timestamp.UTC(), transition.Status, transition.OwnerID, transition.Description, transition.EmailID, transition.Spam, tags, transition.Priority, transition.Queue, transition.Resolution, commentID, removeTags, transition.Type, fields,
+	)
+	return err
+}
+
+// encodeTags stores tags as a JSON array, or an empty string for none.
+func encodeTags(tags []string) (string, error) {
+	if len(tags) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(tags)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+func decodeTags(encoded string) ([]string, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	var tags []string
+	if err := json.Unmarshal([]byte(encoded), &tags); err != nil {
+		return nil, fmt.Errorf("error decoding tags: %w", err)
+	}
+	return tags, nil
+}
+
+// encodeFields stores custom field values as a JSON object, or an empty string for none.
+func encodeFields(fields map[string][]string) (string, error) {
+	if len(fields) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+func decodeFields(encoded string) (map[string][]string, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	var fields map[string][]string
+	if err := json.Unmarshal([]byte(encoded), &fields); err != nil {
+		return nil, fmt.Errorf("error decoding custom fields: %w", err)
+	}
+	return fields, nil
+}
+
+func (r *TicketRepository) find(ctx context.Context, q querier, ID uint64) (domain.Ticket, error) {
+	var exists uint64
+	err := q.QueryRowContext(ctx, r.db.dialect.rebind("SELECT id FROM tickets WHERE id = ?"), ID).Scan(&exists)
+	if err != nil {
+		return domain.Ticket{}, notFound(err)
+	}
+
+	rows, err := q.QueryContext(ctx, r.db.dialect.rebind(`SELECT t.timestamp, t.status, t.owner_id, t.description, t.email_id, t.spam, t.add_tags, t.priority, t.queue, t.resolution, t.remove_tags, t.ticket_type, t.set_fields, c.id, c.author_id, c.body, c.visibility
+		FROM ticket_transitions t LEFT JOIN ticket_comments c ON c.id = t.comment_id
+		WHERE t.ticket_id = ? ORDER BY t.id`), ID)
+	if err != nil {
+		return domain.Ticket{}, err
+	}
+	defer rows.Close()
+
+	ticket := domain.Ticket{ID: ID}
+	for rows.Next() {
+		var (
+			transition  domain.TicketTransition
+			ownerID     sql.NullInt64
+			description sql.NullString
+			emailID     sql.NullInt64
+			spam        sql.NullBool
+			tags        string
+			queue       sql.NullString
+			resolution  sql.NullString
+			removeTags  string
+			fields      string
+			commentID   sql.NullInt64
+			authorID    sql.NullInt64
+			body        sql.NullString
+			visibility  sql.NullInt64
+		)
+		err := rows.Scan(&transition.Timestamp, &transition.Status, &ownerID, &description, &emailID, &spam, &tags, &transition.Priority, &queue, &resolution, &removeTags, &transition.Type, &fields, &commentID, &authorID, &body, &visibility)
+		if err != nil {
+			return domain.Ticket{}, err
+		}
+		transition.OwnerID = nullableID(ownerID)
+		if description.Valid {
+			transition.Description = &description.String
+		}
+		transition.EmailID = nullableID(emailID)
+		if spam.Valid {
+			transition.Spam = &spam.Bool
+		}
+		if transition.AddTags, err = decodeTags(tags); err != nil {
+			return domain.Ticket{}, err
+		}
+		if transition.RemoveTags, err = decodeTags(removeTags); err != nil {
+			return domain.Ticket{}, err
+		}
+		if transition.SetFields, err = decodeFields(fields); err != nil {
+			return domain.Ticket{}, err
+		}
+		if queue.Valid {
+			transition.Queue = &queue.String
+		}
+		if resolution.Valid {
+			transition.Resolution = &resolution.String
+		}
+		if commentID.Valid {
+			transition.Comment = &domain.TicketComment{
+				ID:          uint64(commentID.Int64),
+				AuthorID:    uint64(authorID.Int64),
+				Body:        body.String,
+				Visibility:  domain.CommentVisibility(visibility.Int64),
+				Attachments: make([]domain.Attachment, 0),
+			}
+		}
+		ticket.Transitions = append(ticket.Transitions, transition)
+	}
+	if err := rows.Err(); err != nil {
+		return domain.Ticket{}, err
+	}
+
+	return ticket, r.findCommentAttachments(ctx, q, &ticket)
+}
+
+// findCommentAttachments adds the attachments of the ticket's comments without their content, which can be large.
+func (r *TicketRepository) findCommentAttachments(ctx context.Context, q querier, ticket *domain.Ticket) error {
+	comments := make(map[uint64]*domain.TicketComment)
+	for _, transition := range ticket.Transitions {
+		if transition.Comment != nil {
+			comments[transition.Comment.ID] = transition.Comment
+		}
+	}
+	if len(comments) == 0 {
+		return nil
+	}
+
+	rows, err := q.QueryContext(ctx, r.db.dialect.rebind(`SELECT a.id, a.comment_id, a.content_type, a.filename, a.size
+		FROM comment_attachments a JOIN ticket_comments c ON c.id = a.comment_id
+		WHERE c.ticket_id = ? ORDER BY a.id`), ticket.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a domain.Attachment
+		if err := rows.Scan(&a.ID, &a.CommentID, &a.ContentType, &a.Filename, &a.Size); err != nil {
+			return err
+		}
+		if comment, ok := comments[a.CommentID]; ok {
+			comment.Attachments = append(comment.Attachments, a)
+		}
+	}
+	return rows.Err()
+}
+
+func (r *TicketRepository) List(ctx context.Context, filter domain.TicketFilter) ([]domain.Ticket, error) {
+	conditions, args := filterConditions(filter)
+	rows, err := r.db.db.QueryContext(ctx, r.db.dialect.rebind("SELECT s.ticket_id FROM ticket_states s WHERE "+strings.Join(conditions, " AND ")+" ORDER BY s.ticket_id"), args...)
+	if err != nil {
+		return nil, err
+	}
+	var IDs []uint64
+	for rows.Next() {
+		var ID uint64
+		if err := rows.Scan(&ID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		IDs = append(IDs, ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return r.findAll(ctx, IDs)
+}
+
+// ticketCursor is where a page of search results ended, for the next page to continue from.
+// The sort order is kept so the cursor can't be continued with another.
+type ticketCursor struct {
+	Sort       domain.TicketSortField `json:"s"`
+	Descending bool                   `json:"d"`
+	// Time is the last ticket's creation or update time, or Priority its priority, depending on the sort order
+	Time     time.Time `json:"t,omitempty"`
+	Priority int       `json:"p,omitempty"`
+	ID       uint64    `json:"id"`
+}
+
+func (c ticketCursor) encode() (string, error) {
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+func decodeTicketCursor(s string) (ticketCursor, error) {
+	var c ticketCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, domain.ErrInvalidCursor
+	}
+	if err := json.Unmarshal(decoded, &c); err != nil {
+		return c, domain.ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Search returns a page of the tickets matching the query, which must have its sort field and limit set.
+// Text is found with the full-text index TicketTextRepository stores, and highlighted in the page's Matches.
+func (r *TicketRepository) Search(ctx context.Context, query domain.TicketQuery) (domain.TicketPage, error) {
+	conditions, args := filterConditions(query.TicketFilter)
+	if query.Unassigned {
+		conditions = append(conditions, "s.owner_id IS NULL")
+	}
+	for _, bound := range []struct {
+		condition string
+		time      time.Time
+	}{
+		{"t.created_at >= ?", query.CreatedFrom},
+		{"t.created_at < ?", query.CreatedBefore},
+		{"s.updated_at >= ?", query.UpdatedFrom},
+		{"s.updated_at < ?", query.UpdatedBefore},
+	} {
+		if !bound.time.IsZero() {
+			conditions = append(conditions, bound.condition)
+			args = append(args, bound.time.UTC())
+		}
+	}
+	if query.Alias != "" {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM emails e JOIN email_recipients er ON er.email_id = e.id
+			WHERE e.ticket_id = s.ticket_id AND e.outbound = ? AND LOWER(er.address) = ?)`)
+		args = append(args, false, strings.ToLower(query.Alias))
+	}
+	phrases := domain.ParseTextQuery(query.Text)
+	if len(phrases) == 0 && strings.TrimSpace(query.Text) != "" {
+		// Text with no words to search for, such as only stop words, can't match any ticket
+		conditions = append(conditions, "1 = 0")
+	}
+	phraseConditions, phraseArgs, err := r.textConditions(ctx, phrases)
+	if err != nil {
+		return domain.TicketPage{}, err
+	}
+	conditions, args = append(conditions, phraseConditions...), append(args, phraseArgs...)
+
+	var sortColumn string
+	switch query.Sort.Field {
+	case domain.TicketSortCreated:
+		sortColumn = "t.created_at"
+	case domain.TicketSortUpdated:
+		sortColumn = "s.updated_at"
+	case domain.TicketSortPriority:
+		sortColumn = "s.priority"
+	default:
+		return domain.TicketPage{}, fmt.Errorf("%w: can't sort by %q", domain.ErrInvalidQuery, query.Sort.Field)
+	}
+	direction, after := "ASC", ">"
+	if query.Sort.Descending {
+		direction, after = "DESC", "<"
+	}
+
+	if query.Cursor != "" {
+		cursor, err := decodeTicketCursor(query.Cursor)
+		if err != nil {
+			return domain.TicketPage{}, err
+		}
+		if cursor.Sort != query.Sort.Field || cursor.Descending != query.Sort.Descending {
+			return domain.TicketPage{}, fmt.Errorf("%w: it was returned by a search sorted another way", domain.ErrInvalidCursor)
+		}
+		var value any = cursor.Time.UTC()
+		if query.Sort.Field == domain.TicketSortPriority {
+			value = cursor.Priority
+		}
+		conditions = append(conditions, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND s.ticket_id %[2]s ?))", sortColumn, after))
+		args = append(args, value, value, cursor.ID)
+	}
+
+	// One more ticket than the page holds is fetched to tell whether there's a next page
+	args = append(args, query.Limit+1)
+	rows, err := r.db.db.QueryContext(ctx, r.db.dialect.rebind(
+		"SELECT s.ticket_id, t.created_at, s.updated_at, s.priority FROM ticket_states s JOIN tickets t ON t.id = s.ticket_id WHERE "+
+			strings.Join(conditions, " AND ")+
+			fmt.Sprintf(" ORDER BY %[1]s %[2]s, s.ticket_id %[2]s LIMIT ?", sortColumn, direction),
+	), args...)
+	if err != nil {
+		return domain.TicketPage{}, err
+	}
+	var cursors []ticketCursor
+	for rows.Next() {
+		var (
+			c         = ticketCursor{Sort: query.Sort.Field, Descending: query.Sort.Descending}
+			createdAt time.Time
+			updatedAt time.Time
+		)
+		if err := rows.Scan(&c.ID, &createdAt, &updatedAt, &c.Priority); err != nil {
+			rows.Close()
+			return domain.TicketPage{}, err
+		}
+		switch query.Sort.Field {
+		case domain.TicketSortCreated:
+			c.Time, c.Priority = createdAt, 0
+		case domain.TicketSortUpdated:
+			c.Time, c.Priority = updatedAt, 0
+		}
+		cursors = append(cursors, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return domain.TicketPage{}, err
+	}
+
+	var page domain.TicketPage
+	if len(cursors) > query.Limit {
+		cursors = cursors[:query.Limit]
+		if page.NextCursor, err = cursors[len(cursors)-1].encode(); err != nil {
+			return domain.TicketPage{}, err
+		}
+	}
+	IDs := make([]uint64, 0, len(cursors))
+	for _, c := range cursors {
+		IDs = append(IDs, c.ID)
+	}
+	page.Tickets, err = r.findAll(ctx, IDs)
+	if err != nil {
+		return domain.TicketPage{}, err
+	}
+	if len(phrases) > 0 && len(IDs) > 0 {
+		if page.Matches, err = r.findTextMatches(ctx, IDs, phrases); err != nil {
+			return domain.TicketPage{}, err
+		}
+	}
+	return page, nil
+}
+
+// filterConditions returns the where clause conditions matching the filter against ticket_states aliased as s.
+func filterConditions(filter domain.TicketFilter) ([]string, []any) {
+	conditions := []string{"1 = 1"}
+	var args []any
+	if len(filter.Statuses) > 0 {
+		conditions = append(conditions, "s.status IN ("+placeholders(len(filter.Statuses))+")")
+		for _, status := range filter.Statuses {
+			args = append(args, status)
+		}
+	}
+	if filter.OwnerID != nil {
+		conditions = append(conditions, "s.owner_id = ?")
+		args = append(args, *filter.OwnerID)
+	}
+	if len(filter.Priorities) > 0 {
+		conditions = append(conditions, "s.priority IN ("+placeholders(len(filter.Priorities))+")")
+		for _, priority := range filter.Priorities {
+			args = append(args, priority)
+		}
+	}
+	if len(filter.Types) > 0 {
+		conditions = append(conditions, "s.ticket_type IN ("+placeholders(len(filter.Types))+")")
+		for _, ticketType := range filter.Types {
+			args = append(args, ticketType)
+		}
+	}
+	if filter.Queue != nil {
+		conditions = append(conditions, "s.queue = ?")
+		args = append(args, *filter.Queue)
+	}
+	if filter.Spam != nil {
+		conditions = append(conditions, "s.spam = ?")
+		args = append(args, *filter.Spam)
+	}
+	for _, tag := range filter.Tags {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM ticket_state_tags st WHERE st.ticket_id = s.ticket_id AND st.tag = ?)")
+		args = append(args, tag)
+	}
+	for key, value := range filter.Fields {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM ticket_state_fields sf WHERE sf.ticket_id = s.ticket_id AND sf.field_key = ? AND sf.value = ?)")
+		args = append(args, key, value)
+	}
+	return conditions, args
+}
+
+// findAll finds the tickets in the order of their IDs.
+// Callers read the IDs first as SQLite can't run other queries on its single connection while rows are open.
+func (r *TicketRepository) findAll(ctx context.Context, IDs []uint64) ([]domain.Ticket, error) {
+	tickets := make([]domain.Ticket, 0, len(IDs))
+	for _, ID := range IDs {
+		ticket, err := r.find(ctx, r.db.db, ID)
+		if err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, ticket)
+	}
+	return tickets, nil
+}
+
+// saveState replaces the state stored for the ticket with its current one, so it can be filtered on.
+func (r *TicketRepository) saveState(ctx context.Context, q querier, ticket domain.Ticket) error {
+	for _, table := range []string{"ticket_states", "ticket_state_tags", "ticket_state_fields"} {
+		if _, err := q.ExecContext(ctx, r.db.dialect.rebind("DELETE FROM "+table+" WHERE ticket_id = ?"), ticket.ID); err != nil {
+			return err
+		}
+	}
+
+	meta := ticket.Meta()
+	_, err := q.ExecContext(ctx,
+		r.db.dialect.rebind("INSERT INTO ticket_states (ticket_id, status, owner_id, priority, ticket_type, queue, spam, updated_at, description) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		ticket.ID, meta.Status, meta.OwnerID, meta.Priority, meta.Type, meta.Queue, meta.Spam, meta.LastActivityAt.UTC(), meta.Description,
+	)
+	if err != nil {
+		return err
+	}
+	for _, tag := range meta.Tags {
+		if _, err := q.ExecContext(ctx, r.db.dialect.rebind("INSERT INTO ticket_state_tags (ticket_id, tag) VALUES (?, ?)"), ticket.ID, tag); err != nil {
+			return err
+		}
+	}
+	for key, values := range meta.Fields {
+		for _, value := range values {
+			_, err := q.ExecContext(ctx, r.db.dialect.rebind("INSERT INTO ticket_state_fields (ticket_id, field_key, value) VALUES (?, ?, ?)"), ticket.ID, key, value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// backfillTicketStates stores the state of the tickets opened before states were stored, as of 0019_ticket_states.
+func backfillTicketStates(ctx context.Context, d *DB, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `SELECT ticket_id, timestamp, status, owner_id, description, spam, add_tags, priority, queue, remove_tags, ticket_type, set_fields
+		FROM ticket_transitions ORDER BY ticket_id, id`)
+	if err != nil {
+		return err
+	}
+	var tickets []domain.Ticket
+	for rows.Next() {
+		var (
+			ticketID    uint64
+			transition  domain.TicketTransition
+			ownerID     sql.NullInt64
+			description sql.NullString
+			spam        sql.NullBool
+			tags        string
+			queue       sql.NullString
+			removeTags  string
+			fields      string
+		)
+		err := rows.Scan(&ticketID, &transition.Timestamp, &transition.Status, &ownerID, &description, &spam, &tags, &transition.Priority, &queue, &removeTags, &transition.Type, &fields)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		transition.OwnerID = nullableID(ownerID)
+		if description.Valid {
+			transition.Description = &description.String
+		}
+		if spam.Valid {
+			transition.Spam = &spam.Bool
+		}
+		if queue.Valid {
+			transition.Queue = &queue.String
+		}
+		transition.AddTags, err = decodeTags(tags)
+		if err == nil {
+			transition.RemoveTags, err = decodeTags(removeTags)
+		}
+		if err == nil {
+			transition.SetFields, err = decodeFields(fields)
+		}
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		if len(tickets) == 0 || tickets[len(tickets)-1].ID != ticketID {
+			tickets = append(tickets, domain.Ticket{ID: ticketID})
+		}
+		tickets[len(tickets)-1].Transitions = append(tickets[len(tickets)-1].Transitions, transition)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, ticket := range tickets {
+		meta := ticket.Meta()
+		_, err := tx.ExecContext(ctx,
+			d.dialect.rebind("INSERT INTO ticket_states (ticket_id, status, owner_id, priority, ticket_type, queue, spam) VALUES (?, ?, ?, ?, ?, ?, ?)"),
+			ticket.ID, meta.Status, meta.OwnerID, meta.Priority, meta.Type, meta.Queue, meta.Spam,
+		)
+		if err != nil {
+			return err
+		}
+		for _, tag := range meta.Tags {
+			if _, err := tx.ExecContext(ctx, d.dialect.rebind("INSERT INTO ticket_state_tags (ticket_id, tag) VALUES (?, ?)"), ticket.ID, tag); err != nil {
+				return err
+			}
+		}
+		for key, values := range meta.Fields {
+			for _, value := range values {
+				_, err := tx.ExecContext(ctx, d.dialect.rebind("INSERT INTO ticket_state_fields (ticket_id, field_key, value) VALUES (?, ?, ?)"), ticket.ID, key, value)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
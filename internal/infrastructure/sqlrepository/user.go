@@ -0,0 +1,54 @@
+package sqlrepository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/nil-nil/ticket/internal/domain"
+)
+
+// Make sure we conform to domain.UserRepository
+var _ domain.UserRepository = (*UserRepository)(nil)
+
+func NewUserRepository(db *DB) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+type UserRepository struct {
+	db *DB
+}
+
+func (r *UserRepository) Find(ctx context.Context, ID uint64) (domain.User, error) {
+	var (
+		user      domain.User
+		deletedAt sql.NullTime
+	)
+	err := r.db.db.QueryRowContext(ctx,
+		r.db.dialect.rebind("SELECT id, created_at, updated_at, deleted_at, first_name, last_name, admin FROM users WHERE id = ?"),
+		ID,
+	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt, &deletedAt, &user.FirstName, &user.LastName, &user.Admin)
+	if err != nil {
+		return domain.User{}, notFound(err)
+	}
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
+
+	return user, nil
+}
+
+func (r *UserRepository) Create(ctx context.Context, FirstName string, LastName string) (domain.User, error) {
+	now := time.Now().UTC()
+
+	var ID uint64
+	err := r.db.db.QueryRowContext(ctx,
+		r.db.dialect.rebind("INSERT INTO users (created_at, updated_at, first_name, last_name) VALUES (?, ?, ?, ?) RETURNING id"),
+		now, now, FirstName, LastName,
+	).Scan(&ID)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	return r.Find(ctx, ID)
+}
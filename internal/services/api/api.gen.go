@@ -7,13 +7,336 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/deepmap/oapi-codegen/pkg/runtime"
 	openapi_types "github.com/deepmap/oapi-codegen/pkg/types"
 	"github.com/labstack/echo/v4"
 )
 
+// Defines values for CommentVisibility.
+const (
+	Internal CommentVisibility = "internal"
+	Public   CommentVisibility = "public"
+)
+
+// Defines values for CustomFieldType.
+const (
+	Date        CustomFieldType = "date"
+	Multiselect CustomFieldType = "multiselect"
+	Number      CustomFieldType = "number"
+	Select      CustomFieldType = "select"
+	Text        CustomFieldType = "text"
+)
+
+// Defines values for DNSDomainStatus.
+const (
+	Pending  DNSDomainStatus = "pending"
+	Verified DNSDomainStatus = "verified"
+)
+
+// Defines values for QuarantineReason.
+const (
+	Authentication QuarantineReason = "authentication"
+	Spam           QuarantineReason = "spam"
+	UnknownSender  QuarantineReason = "unknown_sender"
+)
+
+// Defines values for TextMatchSource.
+const (
+	TextMatchSourceComment     TextMatchSource = "comment"
+	TextMatchSourceDescription TextMatchSource = "description"
+	TextMatchSourceEmail       TextMatchSource = "email"
+	TextMatchSourceSubject     TextMatchSource = "subject"
+)
+
+// Defines values for TicketField.
+const (
+	Owner      TicketField = "owner"
+	Resolution TicketField = "resolution"
+)
+
+// Defines values for TicketPriority.
+const (
+	High   TicketPriority = "high"
+	Low    TicketPriority = "low"
+	Normal TicketPriority = "normal"
+	Urgent TicketPriority = "urgent"
+)
+
+// Defines values for TicketType.
+const (
+	Incident TicketType = "incident"
+	Problem  TicketType = "problem"
+	Question TicketType = "question"
+	Task     TicketType = "task"
+)
+
+// Defines values for WorkflowErrorCode.
+const (
+	FieldRequired        WorkflowErrorCode = "field_required"
+	TransitionNotAllowed WorkflowErrorCode = "transition_not_allowed"
+	UnknownStatus        WorkflowErrorCode = "unknown_status"
+)
+
+// Alias defines model for Alias.
+type Alias struct {
+	// Address The alias's address, with the user "*" for a domain's catch-all
+	Address string `json:"address"`
+
+	// Id ID
+	Id      uint64       `json:"id"`
+	Routing AliasRouting `json:"routing"`
+}
+
+// AliasRouting defines model for AliasRouting.
+type AliasRouting struct {
+	// DefaultOwnerId User tickets are assigned to
+	DefaultOwnerId *uint64 `json:"defaultOwnerId"`
+
+	// Priority How urgently a ticket should be worked on
+	Priority *TicketPriority `json:"priority,omitempty"`
+
+	// Private Whether mail from senders we've never dealt with is quarantined rather than opening tickets
+	Private *bool `json:"private,omitempty"`
+
+	// Queue Team queue tickets are filed in
+	Queue *string `json:"queue,omitempty"`
+
+	// Tags Tags added to tickets
+	Tags *[]string `json:"tags,omitempty"`
+}
+
+// Attachment defines model for Attachment.
+type Attachment struct {
+	ContentType string `json:"contentType"`
+	Filename    string `json:"filename"`
+
+	// Id ID
+	Id uint64 `json:"id"`
+
+	// Size Size of the content in bytes
+	Size int64 `json:"size"`
+}
+
+// CommentVisibility Whether the customer can see the comment, or only agents
+type CommentVisibility string
+
+// CustomField defines model for CustomField.
+type CustomField struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+
+	// Options The values select and multiselect fields can take
+	Options []string        `json:"options"`
+	Type    CustomFieldType `json:"type"`
+}
+
+// CustomFieldType defines model for CustomField.Type.
+type CustomFieldType string
+
+// DNSDomain defines model for DNSDomain.
+type DNSDomain struct {
+	// DkimSelector Selector of the key outbound mail is signed with, absent until one is generated
+	DkimSelector *string `json:"dkimSelector"`
+
+	// Id ID
+	Id   uint64 `json:"id"`
+	Name string `json:"name"`
+
+	// Status Only verified domains receive mail
+	Status DNSDomainStatus `json:"status"`
+
+	// VerifiedAt When the domain passed verification, absent while it's pending
+	VerifiedAt *time.Time `json:"verifiedAt"`
+}
+
+// DNSDomainStatus Only verified domains receive mail
+type DNSDomainStatus string
+
+// DNSDomainName defines model for DNSDomainName.
+type DNSDomainName struct {
+	// Name Domain name, such as example.com
+	Name string `json:"name"`
+}
+
+// DNSRecord defines model for DNSRecord.
+type DNSRecord struct {
+	// Name Fully qualified record name
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	// Value Record data. Long values must be split into strings of at most 255 characters if the DNS provider doesn't do so itself.
+	Value string `json:"value"`
+}
+
+// Email defines model for Email.
+type Email struct {
+	// Body Plain text body
+	Body string    `json:"body"`
+	Date time.Time `json:"date"`
+	From string    `json:"from"`
+
+	// Id ID
+	Id        uint64 `json:"id"`
+	MessageId string `json:"messageId"`
+
+	// Outbound Whether the email was sent by us rather than received
+	Outbound bool   `json:"outbound"`
+	Subject  string `json:"subject"`
+
+	// TicketId ID of the ticket the email belongs to
+	TicketId *uint64  `json:"ticketId"`
+	To       []string `json:"to"`
+}
+
+// NewAttachment defines model for NewAttachment.
+type NewAttachment struct {
+	// Content Base64 encoded content
+	Content []byte `json:"content"`
+
+	// ContentType Defaults to application/octet-stream
+	ContentType *string `json:"contentType,omitempty"`
+	Filename    string  `json:"filename"`
+}
+
+// QuarantineReason Why the email was held
+type QuarantineReason string
+
+// QuarantinedEmail defines model for QuarantinedEmail.
+type QuarantinedEmail struct {
+	// Detail Explains the reason, such as the spam score or the failed check
+	Detail string `json:"detail"`
+	Email  Email  `json:"email"`
+
+	// ExpiresAt When the email is deleted unless it's released first
+	ExpiresAt     time.Time `json:"expiresAt"`
+	QuarantinedAt time.Time `json:"quarantinedAt"`
+
+	// Reason Why the email was held
+	Reason QuarantineReason `json:"reason"`
+
+	// Recipients Envelope recipients the email is ticketed for when released
+	Recipients []string `json:"recipients"`
+}
+
+// TextFragment defines model for TextFragment.
+type TextFragment struct {
+	Highlighted bool   `json:"highlighted"`
+	Text        string `json:"text"`
+}
+
+// TextMatch A snippet of a ticket's text a search matched
+type TextMatch struct {
+	// Snippet The snippet in pieces, the words matched being highlighted
+	Snippet []TextFragment `json:"snippet"`
+
+	// Source Where the text comes from, an email's subject or body, a comment or the ticket's description
+	Source TextMatchSource `json:"source"`
+
+	// SourceId The comment or email the text comes from, 0 for the description
+	SourceId uint64 `json:"sourceId"`
+}
+
+// TextMatchSource Where the text comes from, an email's subject or body, a comment or the ticket's description
+type TextMatchSource string
+
+// Ticket defines model for Ticket.
+type Ticket struct {
+	// CommentCount Number of public replies
+	CommentCount int    `json:"commentCount"`
+	Description  string `json:"description"`
+
+	// Fields Custom field values by key
+	Fields map[string][]string `json:"fields"`
+
+	// Id ID
+	Id uint64 `json:"id"`
+
+	// LastActivityAt When the ticket last changed in any way
+	LastActivityAt time.Time `json:"lastActivityAt"`
+
+	// LastCommentAt When a reply or note was last added
+	LastCommentAt *time.Time `json:"lastCommentAt"`
+
+	// NoteCount Number of internal notes
+	NoteCount int     `json:"noteCount"`
+	OwnerId   *uint64 `json:"ownerId"`
+
+	// Priority How urgently a ticket should be worked on
+	Priority *TicketPriority `json:"priority,omitempty"`
+
+	// Resolution Explains the latest status change
+	Resolution *string `json:"resolution"`
+
+	// Status Name of the ticket's status in the workflow
+	Status string   `json:"status"`
+	Tags   []string `json:"tags"`
+
+	// Type The kind of request a ticket is
+	Type *TicketType `json:"type,omitempty"`
+}
+
+// TicketComment defines model for TicketComment.
+type TicketComment struct {
+	Attachments []Attachment `json:"attachments"`
+
+	// AuthorId User who wrote the comment
+	AuthorId uint64 `json:"authorId"`
+	Body     string `json:"body"`
+
+	// Id ID
+	Id uint64 `json:"id"`
+
+	// Visibility Whether the customer can see the comment, or only agents
+	Visibility CommentVisibility `json:"visibility"`
+}
+
+// TicketField defines model for TicketField.
+type TicketField string
+
+// TicketPriority How urgently a ticket should be worked on
+type TicketPriority string
+
+// TicketType The kind of request a ticket is
+type TicketType string
+
+// TimelineEntry A change to a ticket, with only the fields it changed set
+type TimelineEntry struct {
+	Comment     *TicketComment `json:"comment,omitempty"`
+	Description *string        `json:"description,omitempty"`
+
+	// EmailId Email the change came with
+	EmailId *uint64 `json:"emailId,omitempty"`
+
+	// Fields Custom field values set, an empty list clearing the field
+	Fields  *map[string][]string `json:"fields,omitempty"`
+	OwnerId *uint64              `json:"ownerId,omitempty"`
+
+	// Priority How urgently a ticket should be worked on
+	Priority *TicketPriority `json:"priority,omitempty"`
+
+	// Queue Queue the ticket was filed in, empty when it was taken out of one
+	Queue *string `json:"queue,omitempty"`
+
+	// RemovedTags Tags taken off the ticket
+	RemovedTags *[]string `json:"removedTags,omitempty"`
+	Resolution  *string   `json:"resolution,omitempty"`
+	Spam        *bool     `json:"spam,omitempty"`
+
+	// Status Name of the status the ticket moved to
+	Status *string `json:"status,omitempty"`
+
+	// Tags Tags added to the ticket
+	Tags      *[]string `json:"tags,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// Type The kind of request a ticket is
+	Type *TicketType `json:"type,omitempty"`
+}
+
 // User defines model for User.
 type User struct {
 	CreatedAt openapi_types.Date  `json:"createdAt"`
@@ -30,113 +353,2378 @@ type User struct {
 	UpdatedAt openapi_types.Date `json:"updatedAt"`
 }
 
-// ServerInterface represents all server handlers.
-type ServerInterface interface {
+// ValidationError defines model for ValidationError.
+type ValidationError struct {
+	Message string `json:"message"`
+}
 
-	// (GET /v1/auth/user)
-	GetUser(ctx echo.Context) error
+// Workflow defines model for Workflow.
+type Workflow struct {
+	Statuses []WorkflowStatus `json:"statuses"`
+
+	// Transitions The status changes allowed, any being allowed if there are none
+	Transitions []WorkflowTransition `json:"transitions"`
 }
 
-// ServerInterfaceWrapper converts echo contexts to parameters.
-type ServerInterfaceWrapper struct {
-	Handler ServerInterface
+// WorkflowError defines model for WorkflowError.
+type WorkflowError struct {
+	Code    WorkflowErrorCode `json:"code"`
+	Field   *TicketField      `json:"field,omitempty"`
+	Message string            `json:"message"`
 }
 
-// GetUser converts echo context to params.
-func (w *ServerInterfaceWrapper) GetUser(ctx echo.Context) error {
-	var err error
+// WorkflowErrorCode defines model for WorkflowError.Code.
+type WorkflowErrorCode string
 
-	// Invoke the callback with all the unmarshalled arguments
-	err = w.Handler.GetUser(ctx)
-	return err
+// WorkflowStatus defines model for WorkflowStatus.
+type WorkflowStatus struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
 }
 
-// This is a simple interface which specifies echo.Route addition functions which
-// are present on both echo.Echo and echo.Group, since we want to allow using
-// either of them for path registration
-type EchoRouter interface {
-	CONNECT(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
-	DELETE(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
-	GET(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
-	HEAD(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
-	OPTIONS(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
-	PATCH(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
-	POST(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
-	PUT(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
-	TRACE(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+// WorkflowTransition defines model for WorkflowTransition.
+type WorkflowTransition struct {
+	// From Names of the statuses the ticket can move from, any if it's empty
+	From []string `json:"from"`
+
+	// Require Fields the status change must set
+	Require []TicketField `json:"require"`
+	To      string        `json:"to"`
 }
 
-// RegisterHandlers adds each server route to the EchoRouter.
-func RegisterHandlers(router EchoRouter, si ServerInterface) {
-	RegisterHandlersWithBaseURL(router, si, "")
+// AttachmentId defines model for AttachmentId.
+type AttachmentId = uint64
+
+// DomainId defines model for DomainId.
+type DomainId = uint64
+
+// EmailId defines model for EmailId.
+type EmailId = uint64
+
+// TicketId defines model for TicketId.
+type TicketId = uint64
+
+// GetQuarantineParams defines parameters for GetQuarantine.
+type GetQuarantineParams struct {
+	Reason *QuarantineReason `form:"reason,omitempty" json:"reason,omitempty"`
+
+	// Before Only list email with lower IDs, to fetch the next page
+	Before *uint64 `form:"before,omitempty" json:"before,omitempty"`
+	Limit  *int    `form:"limit,omitempty" json:"limit,omitempty"`
 }
 
-// Registers handlers, and prepends BaseURL to the paths, so that the paths
-// can be served under a prefix.
-func RegisterHandlersWithBaseURL(router EchoRouter, si ServerInterface, baseURL string) {
+// ListTicketsParams defines parameters for ListTickets.
+type ListTicketsParams struct {
+	// Status Status names, matching tickets in any of them
+	Status  *[]string `form:"status,omitempty" json:"status,omitempty"`
+	OwnerId *uint64   `form:"ownerId,omitempty" json:"ownerId,omitempty"`
 
-	wrapper := ServerInterfaceWrapper{
-		Handler: si,
-	}
+	// Priority Matches tickets with any of the priorities
+	Priority *[]TicketPriority `form:"priority,omitempty" json:"priority,omitempty"`
 
-	router.GET(baseURL+"/v1/auth/user", wrapper.GetUser)
+	// Type Matches tickets of any of the types
+	Type *[]TicketType `form:"type,omitempty" json:"type,omitempty"`
+
+	// Queue Matches tickets filed in the queue, an empty value matching those in none
+	Queue *string `form:"queue,omitempty" json:"queue,omitempty"`
+	Spam  *bool   `form:"spam,omitempty" json:"spam,omitempty"`
+
+	// Tag Matches tickets with all of the tags
+	Tag *[]string `form:"tag,omitempty" json:"tag,omitempty"`
 
+	// Field Custom field values written as key:value, matching tickets with all of them. Multiselect fields match if they include the value
+	Field *[]string `form:"field,omitempty" json:"field,omitempty"`
 }
 
-type GetUserRequestObject struct {
+// SearchTicketsParams defines parameters for SearchTickets.
+type SearchTicketsParams struct {
+	// Q The query, like status:open owner:me priority:high printer. Empty matches every ticket
+	Q *string `form:"q,omitempty" json:"q,omitempty"`
+
+	// Cursor The nextCursor of the previous page, given with the same query
+	Cursor *string `form:"cursor,omitempty" json:"cursor,omitempty"`
+
+	// Limit Page size
+	Limit *int `form:"limit,omitempty" json:"limit,omitempty"`
 }
 
-type GetUserResponseObject interface {
-	VisitGetUserResponse(w http.ResponseWriter) error
+// UpdateTicketJSONBody defines parameters for UpdateTicket.
+type UpdateTicketJSONBody struct {
+	AddTags *[]string `json:"addTags,omitempty"`
+
+	// Fields Custom field values to set by key, an empty list clearing the field
+	Fields *map[string][]string `json:"fields,omitempty"`
+
+	// Priority How urgently a ticket should be worked on
+	Priority   *TicketPriority `json:"priority,omitempty"`
+	RemoveTags *[]string       `json:"removeTags,omitempty"`
+
+	// Type The kind of request a ticket is
+	Type *TicketType `json:"type,omitempty"`
 }
 
-type GetUser200JSONResponse struct {
-	User User `json:"user"`
+// AddTicketCommentJSONBody defines parameters for AddTicketComment.
+type AddTicketCommentJSONBody struct {
+	Attachments *[]NewAttachment `json:"attachments,omitempty"`
+
+	// Body Plain text body, which can be left out if there are attachments
+	Body *string `json:"body,omitempty"`
+
+	// Visibility Whether the customer can see the comment, or only agents
+	Visibility CommentVisibility `json:"visibility"`
 }
 
-func (response GetUser200JSONResponse) VisitGetUserResponse(w http.ResponseWriter) error {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(200)
+// ReplyToTicketJSONBody defines parameters for ReplyToTicket.
+type ReplyToTicketJSONBody struct {
+	// Body Plain text body of the reply
+	Body string `json:"body"`
+}
 
-	return json.NewEncoder(w).Encode(response)
+// MarkTicketSpamJSONBody defines parameters for MarkTicketSpam.
+type MarkTicketSpamJSONBody struct {
+	Spam bool `json:"spam"`
 }
 
-// StrictServerInterface represents all server handlers.
-type StrictServerInterface interface {
+// SetTicketStatusJSONBody defines parameters for SetTicketStatus.
+type SetTicketStatusJSONBody struct {
+	// OwnerId User the ticket is assigned to with the status change
+	OwnerId *uint64 `json:"ownerId,omitempty"`
 
-	// (GET /v1/auth/user)
-	GetUser(ctx context.Context, request GetUserRequestObject) (GetUserResponseObject, error)
+	// Resolution Explains the status change, such as why the ticket was closed
+	Resolution *string `json:"resolution,omitempty"`
+
+	// Status Name of the status to move to, regardless of case
+	Status string `json:"status"`
 }
 
-type StrictHandlerFunc = runtime.StrictEchoHandlerFunc
-type StrictMiddlewareFunc = runtime.StrictEchoMiddlewareFunc
+// SetAliasRoutingJSONRequestBody defines body for SetAliasRouting for application/json ContentType.
+type SetAliasRoutingJSONRequestBody = AliasRouting
 
-func NewStrictHandler(ssi StrictServerInterface, middlewares []StrictMiddlewareFunc) ServerInterface {
-	return &strictHandler{ssi: ssi, middlewares: middlewares}
+// CreateDomainJSONRequestBody defines body for CreateDomain for application/json ContentType.
+type CreateDomainJSONRequestBody = DNSDomainName
+
+// RenameDomainJSONRequestBody defines body for RenameDomain for application/json ContentType.
+type RenameDomainJSONRequestBody = DNSDomainName
+
+// UpdateTicketJSONRequestBody defines body for UpdateTicket for application/json ContentType.
+type UpdateTicketJSONRequestBody UpdateTicketJSONBody
+
+// AddTicketCommentJSONRequestBody defines body for AddTicketComment for application/json ContentType.
+type AddTicketCommentJSONRequestBody AddTicketCommentJSONBody
+
+// ReplyToTicketJSONRequestBody defines body for ReplyToTicket for application/json ContentType.
+type ReplyToTicketJSONRequestBody ReplyToTicketJSONBody
+
+// MarkTicketSpamJSONRequestBody defines body for MarkTicketSpam for application/json ContentType.
+type MarkTicketSpamJSONRequestBody MarkTicketSpamJSONBody
+
+// SetTicketStatusJSONRequestBody defines body for SetTicketStatus for application/json ContentType.
+type SetTicketStatusJSONRequestBody SetTicketStatusJSONBody
+
+// ServerInterface represents all server handlers.
+type ServerInterface interface {
+
+	// (PUT /v1/aliases/{aliasId}/routing)
+	SetAliasRouting(ctx echo.Context, aliasId uint64) error
+
+	// (GET /v1/auth/user)
+	GetUser(ctx echo.Context) error
+
+	// (GET /v1/domains)
+	GetDomains(ctx echo.Context) error
+
+	// (POST /v1/domains)
+	CreateDomain(ctx echo.Context) error
+
+	// (DELETE /v1/domains/{domainId})
+	DeleteDomain(ctx echo.Context, domainId DomainId) error
+
+	// (GET /v1/domains/{domainId})
+	GetDomain(ctx echo.Context, domainId DomainId) error
+
+	// (PATCH /v1/domains/{domainId})
+	RenameDomain(ctx echo.Context, domainId DomainId) error
+
+	// (POST /v1/domains/{domainId}/dkim)
+	GenerateDKIMKey(ctx echo.Context, domainId DomainId) error
+
+	// (GET /v1/domains/{domainId}/records)
+	GetDNSRecords(ctx echo.Context, domainId DomainId) error
+
+	// (POST /v1/domains/{domainId}/verification-token)
+	RegenerateVerificationToken(ctx echo.Context, domainId DomainId) error
+
+	// (POST /v1/domains/{domainId}/verify)
+	VerifyDomain(ctx echo.Context, domainId DomainId) error
+
+	// (GET /v1/fields)
+	GetCustomFields(ctx echo.Context) error
+
+	// (GET /v1/quarantine)
+	GetQuarantine(ctx echo.Context, params GetQuarantineParams) error
+
+	// (DELETE /v1/quarantine/{emailId})
+	DeleteQuarantinedEmail(ctx echo.Context, emailId EmailId) error
+
+	// (GET /v1/quarantine/{emailId})
+	GetQuarantinedEmail(ctx echo.Context, emailId EmailId) error
+
+	// (POST /v1/quarantine/{emailId}/release)
+	ReleaseQuarantinedEmail(ctx echo.Context, emailId EmailId) error
+
+	// (GET /v1/tickets)
+	ListTickets(ctx echo.Context, params ListTicketsParams) error
+
+	// (GET /v1/tickets/search)
+	SearchTickets(ctx echo.Context, params SearchTicketsParams) error
+
+	// (GET /v1/tickets/{ticketId})
+	GetTicket(ctx echo.Context, ticketId TicketId) error
+
+	// (PATCH /v1/tickets/{ticketId})
+	UpdateTicket(ctx echo.Context, ticketId TicketId) error
+
+	// (GET /v1/tickets/{ticketId}/attachments/{attachmentId})
+	GetTicketAttachment(ctx echo.Context, ticketId TicketId, attachmentId AttachmentId) error
+
+	// (POST /v1/tickets/{ticketId}/comments)
+	AddTicketComment(ctx echo.Context, ticketId TicketId) error
+
+	// (POST /v1/tickets/{ticketId}/replies)
+	ReplyToTicket(ctx echo.Context, ticketId uint64) error
+
+	// (PUT /v1/tickets/{ticketId}/spam)
+	MarkTicketSpam(ctx echo.Context, ticketId uint64) error
+
+	// (PUT /v1/tickets/{ticketId}/status)
+	SetTicketStatus(ctx echo.Context, ticketId uint64) error
+
+	// (GET /v1/tickets/{ticketId}/timeline)
+	GetTicketTimeline(ctx echo.Context, ticketId TicketId) error
+
+	// (GET /v1/workflow)
+	GetWorkflow(ctx echo.Context) error
 }
 
-type strictHandler struct {
-	ssi         StrictServerInterface
-	middlewares []StrictMiddlewareFunc
+// ServerInterfaceWrapper converts echo contexts to parameters.
+type ServerInterfaceWrapper struct {
+	Handler ServerInterface
 }
 
-// GetUser operation middleware
-func (sh *strictHandler) GetUser(ctx echo.Context) error {
-	var request GetUserRequestObject
+// SetAliasRouting converts echo context to params.
+func (w *ServerInterfaceWrapper) SetAliasRouting(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "aliasId" -------------
+	var aliasId uint64
 
-	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
-		return sh.ssi.GetUser(ctx.Request().Context(), request.(GetUserRequestObject))
-	}
-	for _, middleware := range sh.middlewares {
-		handler = middleware(handler, "GetUser")
+	err = runtime.BindStyledParameterWithLocation("simple", false, "aliasId", runtime.ParamLocationPath, ctx.Param("aliasId"), &aliasId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter aliasId: %s", err))
 	}
 
-	response, err := handler(ctx, request)
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.SetAliasRouting(ctx, aliasId)
+	return err
+}
 
-	if err != nil {
-		return err
-	} else if validResponse, ok := response.(GetUserResponseObject); ok {
-		return validResponse.VisitGetUserResponse(ctx.Response())
+// GetUser converts echo context to params.
+func (w *ServerInterfaceWrapper) GetUser(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetUser(ctx)
+	return err
+}
+
+// GetDomains converts echo context to params.
+func (w *ServerInterfaceWrapper) GetDomains(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetDomains(ctx)
+	return err
+}
+
+// CreateDomain converts echo context to params.
+func (w *ServerInterfaceWrapper) CreateDomain(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.CreateDomain(ctx)
+	return err
+}
+
+// DeleteDomain converts echo context to params.
+func (w *ServerInterfaceWrapper) DeleteDomain(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "domainId" -------------
+	var domainId DomainId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "domainId", runtime.ParamLocationPath, ctx.Param("domainId"), &domainId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter domainId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.DeleteDomain(ctx, domainId)
+	return err
+}
+
+// GetDomain converts echo context to params.
+func (w *ServerInterfaceWrapper) GetDomain(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "domainId" -------------
+	var domainId DomainId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "domainId", runtime.ParamLocationPath, ctx.Param("domainId"), &domainId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter domainId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetDomain(ctx, domainId)
+	return err
+}
+
+// RenameDomain converts echo context to params.
+func (w *ServerInterfaceWrapper) RenameDomain(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "domainId" -------------
+	var domainId DomainId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "domainId", runtime.ParamLocationPath, ctx.Param("domainId"), &domainId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter domainId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.RenameDomain(ctx, domainId)
+	return err
+}
+
+// GenerateDKIMKey converts echo context to params.
+func (w *ServerInterfaceWrapper) GenerateDKIMKey(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "domainId" -------------
+	var domainId DomainId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "domainId", runtime.ParamLocationPath, ctx.Param("domainId"), &domainId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter domainId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GenerateDKIMKey(ctx, domainId)
+	return err
+}
+
+// GetDNSRecords converts echo context to params.
+func (w *ServerInterfaceWrapper) GetDNSRecords(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "domainId" -------------
+	var domainId DomainId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "domainId", runtime.ParamLocationPath, ctx.Param("domainId"), &domainId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter domainId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetDNSRecords(ctx, domainId)
+	return err
+}
+
+// RegenerateVerificationToken converts echo context to params.
+func (w *ServerInterfaceWrapper) RegenerateVerificationToken(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "domainId" -------------
+	var domainId DomainId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "domainId", runtime.ParamLocationPath, ctx.Param("domainId"), &domainId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter domainId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.RegenerateVerificationToken(ctx, domainId)
+	return err
+}
+
+// VerifyDomain converts echo context to params.
+func (w *ServerInterfaceWrapper) VerifyDomain(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "domainId" -------------
+	var domainId DomainId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "domainId", runtime.ParamLocationPath, ctx.Param("domainId"), &domainId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter domainId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.VerifyDomain(ctx, domainId)
+	return err
+}
+
+// GetCustomFields converts echo context to params.
+func (w *ServerInterfaceWrapper) GetCustomFields(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetCustomFields(ctx)
+	return err
+}
+
+// GetQuarantine converts echo context to params.
+func (w *ServerInterfaceWrapper) GetQuarantine(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetQuarantineParams
+	// ------------- Optional query parameter "reason" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "reason", ctx.QueryParams(), &params.Reason)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter reason: %s", err))
+	}
+
+	// ------------- Optional query parameter "before" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "before", ctx.QueryParams(), &params.Before)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter before: %s", err))
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", ctx.QueryParams(), &params.Limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter limit: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetQuarantine(ctx, params)
+	return err
+}
+
+// DeleteQuarantinedEmail converts echo context to params.
+func (w *ServerInterfaceWrapper) DeleteQuarantinedEmail(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "emailId" -------------
+	var emailId EmailId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "emailId", runtime.ParamLocationPath, ctx.Param("emailId"), &emailId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter emailId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.DeleteQuarantinedEmail(ctx, emailId)
+	return err
+}
+
+// GetQuarantinedEmail converts echo context to params.
+func (w *ServerInterfaceWrapper) GetQuarantinedEmail(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "emailId" -------------
+	var emailId EmailId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "emailId", runtime.ParamLocationPath, ctx.Param("emailId"), &emailId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter emailId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetQuarantinedEmail(ctx, emailId)
+	return err
+}
+
+// ReleaseQuarantinedEmail converts echo context to params.
+func (w *ServerInterfaceWrapper) ReleaseQuarantinedEmail(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "emailId" -------------
+	var emailId EmailId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "emailId", runtime.ParamLocationPath, ctx.Param("emailId"), &emailId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter emailId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.ReleaseQuarantinedEmail(ctx, emailId)
+	return err
+}
+
+// ListTickets converts echo context to params.
+func (w *ServerInterfaceWrapper) ListTickets(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params ListTicketsParams
+	// ------------- Optional query parameter "status" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "status", ctx.QueryParams(), &params.Status)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter status: %s", err))
+	}
+
+	// ------------- Optional query parameter "ownerId" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "ownerId", ctx.QueryParams(), &params.OwnerId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter ownerId: %s", err))
+	}
+
+	// ------------- Optional query parameter "priority" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "priority", ctx.QueryParams(), &params.Priority)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter priority: %s", err))
+	}
+
+	// ------------- Optional query parameter "type" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "type", ctx.QueryParams(), &params.Type)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter type: %s", err))
+	}
+
+	// ------------- Optional query parameter "queue" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "queue", ctx.QueryParams(), &params.Queue)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter queue: %s", err))
+	}
+
+	// ------------- Optional query parameter "spam" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "spam", ctx.QueryParams(), &params.Spam)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter spam: %s", err))
+	}
+
+	// ------------- Optional query parameter "tag" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "tag", ctx.QueryParams(), &params.Tag)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter tag: %s", err))
+	}
+
+	// ------------- Optional query parameter "field" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "field", ctx.QueryParams(), &params.Field)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter field: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.ListTickets(ctx, params)
+	return err
+}
+
+// SearchTickets converts echo context to params.
+func (w *ServerInterfaceWrapper) SearchTickets(ctx echo.Context) error {
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params SearchTicketsParams
+	// ------------- Optional query parameter "q" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "q", ctx.QueryParams(), &params.Q)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter q: %s", err))
+	}
+
+	// ------------- Optional query parameter "cursor" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "cursor", ctx.QueryParams(), &params.Cursor)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter cursor: %s", err))
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", ctx.QueryParams(), &params.Limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter limit: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.SearchTickets(ctx, params)
+	return err
+}
+
+// GetTicket converts echo context to params.
+func (w *ServerInterfaceWrapper) GetTicket(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "ticketId" -------------
+	var ticketId TicketId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "ticketId", runtime.ParamLocationPath, ctx.Param("ticketId"), &ticketId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter ticketId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetTicket(ctx, ticketId)
+	return err
+}
+
+// UpdateTicket converts echo context to params.
+func (w *ServerInterfaceWrapper) UpdateTicket(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "ticketId" -------------
+	var ticketId TicketId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "ticketId", runtime.ParamLocationPath, ctx.Param("ticketId"), &ticketId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter ticketId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.UpdateTicket(ctx, ticketId)
+	return err
+}
+
+// GetTicketAttachment converts echo context to params.
+func (w *ServerInterfaceWrapper) GetTicketAttachment(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "ticketId" -------------
+	var ticketId TicketId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "ticketId", runtime.ParamLocationPath, ctx.Param("ticketId"), &ticketId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter ticketId: %s", err))
+	}
+
+	// ------------- Path parameter "attachmentId" -------------
+	var attachmentId AttachmentId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "attachmentId", runtime.ParamLocationPath, ctx.Param("attachmentId"), &attachmentId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter attachmentId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetTicketAttachment(ctx, ticketId, attachmentId)
+	return err
+}
+
+// AddTicketComment converts echo context to params.
+func (w *ServerInterfaceWrapper) AddTicketComment(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "ticketId" -------------
+	var ticketId TicketId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "ticketId", runtime.ParamLocationPath, ctx.Param("ticketId"), &ticketId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter ticketId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.AddTicketComment(ctx, ticketId)
+	return err
+}
+
+// ReplyToTicket converts echo context to params.
+func (w *ServerInterfaceWrapper) ReplyToTicket(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "ticketId" -------------
+	var ticketId uint64
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "ticketId", runtime.ParamLocationPath, ctx.Param("ticketId"), &ticketId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter ticketId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.ReplyToTicket(ctx, ticketId)
+	return err
+}
+
+// MarkTicketSpam converts echo context to params.
+func (w *ServerInterfaceWrapper) MarkTicketSpam(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "ticketId" -------------
+	var ticketId uint64
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "ticketId", runtime.ParamLocationPath, ctx.Param("ticketId"), &ticketId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter ticketId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.MarkTicketSpam(ctx, ticketId)
+	return err
+}
+
+// SetTicketStatus converts echo context to params.
+func (w *ServerInterfaceWrapper) SetTicketStatus(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "ticketId" -------------
+	var ticketId uint64
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "ticketId", runtime.ParamLocationPath, ctx.Param("ticketId"), &ticketId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter ticketId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.SetTicketStatus(ctx, ticketId)
+	return err
+}
+
+// GetTicketTimeline converts echo context to params.
+func (w *ServerInterfaceWrapper) GetTicketTimeline(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "ticketId" -------------
+	var ticketId TicketId
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "ticketId", runtime.ParamLocationPath, ctx.Param("ticketId"), &ticketId)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter ticketId: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetTicketTimeline(ctx, ticketId)
+	return err
+}
+
+// GetWorkflow converts echo context to params.
+func (w *ServerInterfaceWrapper) GetWorkflow(ctx echo.Context) error {
+	var err error
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetWorkflow(ctx)
+	return err
+}
+
+// This is a simple interface which specifies echo.Route addition functions which
+// are present on both echo.Echo and echo.Group, since we want to allow using
+// either of them for path registration
+type EchoRouter interface {
+	CONNECT(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+	DELETE(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+	GET(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+	HEAD(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+	OPTIONS(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+	PATCH(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+	POST(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+	PUT(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+	TRACE(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+}
+
+// RegisterHandlers adds each server route to the EchoRouter.
+func RegisterHandlers(router EchoRouter, si ServerInterface) {
+	RegisterHandlersWithBaseURL(router, si, "")
+}
+
+// Registers handlers, and prepends BaseURL to the paths, so that the paths
+// can be served under a prefix.
+func RegisterHandlersWithBaseURL(router EchoRouter, si ServerInterface, baseURL string) {
+
+	wrapper := ServerInterfaceWrapper{
+		Handler: si,
+	}
+
+	router.PUT(baseURL+"/v1/aliases/:aliasId/routing", wrapper.SetAliasRouting)
+	router.GET(baseURL+"/v1/auth/user", wrapper.GetUser)
+	router.GET(baseURL+"/v1/domains", wrapper.GetDomains)
+	router.POST(baseURL+"/v1/domains", wrapper.CreateDomain)
+	router.DELETE(baseURL+"/v1/domains/:domainId", wrapper.DeleteDomain)
+	router.GET(baseURL+"/v1/domains/:domainId", wrapper.GetDomain)
+	router.PATCH(baseURL+"/v1/domains/:domainId", wrapper.RenameDomain)
+	router.POST(baseURL+"/v1/domains/:domainId/dkim", wrapper.GenerateDKIMKey)
+	router.GET(baseURL+"/v1/domains/:domainId/records", wrapper.GetDNSRecords)
+	router.POST(baseURL+"/v1/domains/:domainId/verification-token", wrapper.RegenerateVerificationToken)
+	router.POST(baseURL+"/v1/domains/:domainId/verify", wrapper.VerifyDomain)
+	router.GET(baseURL+"/v1/fields", wrapper.GetCustomFields)
+	router.GET(baseURL+"/v1/quarantine", wrapper.GetQuarantine)
+	router.DELETE(baseURL+"/v1/quarantine/:emailId", wrapper.DeleteQuarantinedEmail)
+	router.GET(baseURL+"/v1/quarantine/:emailId", wrapper.GetQuarantinedEmail)
+	router.POST(baseURL+"/v1/quarantine/:emailId/release", wrapper.ReleaseQuarantinedEmail)
+	router.GET(baseURL+"/v1/tickets", wrapper.ListTickets)
+	router.GET(baseURL+"/v1/tickets/search", wrapper.SearchTickets)
+	router.GET(baseURL+"/v1/tickets/:ticketId", wrapper.GetTicket)
+	router.PATCH(baseURL+"/v1/tickets/:ticketId", wrapper.UpdateTicket)
+	router.GET(baseURL+"/v1/tickets/:ticketId/attachments/:attachmentId", wrapper.GetTicketAttachment)
+	router.POST(baseURL+"/v1/tickets/:ticketId/comments", wrapper.AddTicketComment)
+	router.POST(baseURL+"/v1/tickets/:ticketId/replies", wrapper.ReplyToTicket)
+	router.PUT(baseURL+"/v1/tickets/:ticketId/spam", wrapper.MarkTicketSpam)
+	router.PUT(baseURL+"/v1/tickets/:ticketId/status", wrapper.SetTicketStatus)
+	router.GET(baseURL+"/v1/tickets/:ticketId/timeline", wrapper.GetTicketTimeline)
+	router.GET(baseURL+"/v1/workflow", wrapper.GetWorkflow)
+
+}
+
+type SetAliasRoutingRequestObject struct {
+	AliasId uint64 `json:"aliasId"`
+	Body    *SetAliasRoutingJSONRequestBody
+}
+
+type SetAliasRoutingResponseObject interface {
+	VisitSetAliasRoutingResponse(w http.ResponseWriter) error
+}
+
+type SetAliasRouting200JSONResponse Alias
+
+func (response SetAliasRouting200JSONResponse) VisitSetAliasRoutingResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type SetAliasRouting404Response struct {
+}
+
+func (response SetAliasRouting404Response) VisitSetAliasRoutingResponse(w http.ResponseWriter) error {
+	w.WriteHeader(404)
+	return nil
+}
+
+type GetUserRequestObject struct {
+}
+
+type GetUserResponseObject interface {
+	VisitGetUserResponse(w http.ResponseWriter) error
+}
+
+type GetUser200JSONResponse struct {
+	User User `json:"user"`
+}
+
+func (response GetUser200JSONResponse) VisitGetUserResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetDomainsRequestObject struct {
+}
+
+type GetDomainsResponseObject interface {
+	VisitGetDomainsResponse(w http.ResponseWriter) error
+}
+
+type GetDomains200JSONResponse struct {
+	Domains []DNSDomain `json:"domains"`
+}
+
+func (response GetDomains200JSONResponse) VisitGetDomainsResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type CreateDomainRequestObject struct {
+	Body *CreateDomainJSONRequestBody
+}
+
+type CreateDomainResponseObject interface {
+	VisitCreateDomainResponse(w http.ResponseWriter) error
+}
+
+type CreateDomain201JSONResponse DNSDomain
+
+func (response CreateDomain201JSONResponse) VisitCreateDomainResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(201)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type CreateDomain409Response struct {
+}
+
+func (response CreateDomain409Response) VisitCreateDomainResponse(w http.ResponseWriter) error {
+	w.WriteHeader(409)
+	return nil
+}
+
+type CreateDomain422Response struct {
+}
+
+func (response CreateDomain422Response) VisitCreateDomainResponse(w http.ResponseWriter) error {
+	w.WriteHeader(422)
+	return nil
+}
+
+type DeleteDomainRequestObject struct {
+	DomainId DomainId `json:"domainId"`
+}
+
+type DeleteDomainResponseObject interface {
+	VisitDeleteDomainResponse(w http.ResponseWriter) error
+}
+
+type DeleteDomain204Response struct {
+}
+
+func (response DeleteDomain204Response) VisitDeleteDomainResponse(w http.ResponseWriter) error {
+	w.WriteHeader(204)
+	return nil
+}
+
+type DeleteDomain404Response struct {
+}
+
+func (response DeleteDomain404Response) VisitDeleteDomainResponse(w http.ResponseWriter) error {
+	w.WriteHeader(404)
+	return nil
+}
+
+type GetDomainRequestObject struct {
+	DomainId DomainId `json:"domainId"`
+}
+
+type GetDomainResponseObject interface {
+	VisitGetDomainResponse(w http.ResponseWriter) error
+}
+
+type GetDomain200JSONResponse DNSDomain
+
+func (response GetDomain200JSONResponse) VisitGetDomainResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetDomain404Response struct {
+}
+
+func (response GetDomain404Response) VisitGetDomainResponse(w http.ResponseWriter) error {
+	w.WriteHeader(404)
+	return nil
+}
+
+type RenameDomainRequestObject struct {
+	DomainId DomainId `json:"domainId"`
+	Body     *RenameDomainJSONRequestBody
+}
+
+type RenameDomainResponseObject interface {
+	VisitRenameDomainResponse(w http.ResponseWriter) error
+}
+
+type RenameDomain200JSONResponse DNSDomain
+
+func (response RenameDomain200JSONResponse) VisitRenameDomainResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type RenameDomain404Response struct {
+}
+
+func (response RenameDomain404Response) VisitRenameDomainResponse(w http.ResponseWriter) error {
+	w.WriteHeader(404)
+	return nil
+}
+
+type RenameDomain409Response struct {
+}
+
+func (response RenameDomain409Response) VisitRenameDomainResponse(w http.ResponseWriter) error {
+	w.WriteHeader(409)
+	return nil
+}
+
+type RenameDomain422Response struct {
+}
+
+func (response RenameDomain422Response) VisitRenameDomainResponse(w http.ResponseWriter) error {
+	w.WriteHeader(422)
+	return nil
+}
+
+type GenerateDKIMKeyRequestObject struct {
+	DomainId DomainId `json:"domainId"`
+}
+
+type GenerateDKIMKeyResponseObject interface {
+	VisitGenerateDKIMKeyResponse(w http.ResponseWriter) error
+}
+
+type GenerateDKIMKey201JSONResponse DNSDomain
+
+func (response GenerateDKIMKey201JSONResponse) VisitGenerateDKIMKeyResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(201)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GenerateDKIMKey404Response struct {
+}
+
+func (response GenerateDKIMKey404Response) VisitGenerateDKIMKeyResponse(w http.ResponseWriter) error {
+	w.WriteHeader(404)
+	return nil
+}
+
+type GetDNSRecordsRequestObject struct {
+	DomainId DomainId `json:"domainId"`
+}
+
+type GetDNSRecordsResponseObject interface {
+	VisitGetDNSRecordsResponse(w http.ResponseWriter) error
+}
+
+type GetDNSRecords200JSONResponse struct {
+	Records []DNSRecord `json:"records"`
+}
+
+func (response GetDNSRecords200JSONResponse) VisitGetDNSRecordsResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetDNSRecords404Response struct {
+}
+
+func (response GetDNSRecords404Response) VisitGetDNSRecordsResponse(w http.ResponseWriter) error {
+	w.WriteHeader(404)
+	return nil
+}
+
+type RegenerateVerificationTokenRequestObject struct {
+	DomainId DomainId `json:"domainId"`
+}
+
+type RegenerateVerificationTokenResponseObject interface {
+	VisitRegenerateVerificationTokenResponse(w http.ResponseWriter) error
+}
+
+type RegenerateVerificationToken201JSONResponse DNSDomain
+
+func (response RegenerateVerificationToken201JSONResponse) VisitRegenerateVerificationTokenResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(201)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type RegenerateVerificationToken404Response struct {
+}
+
+func (response RegenerateVerificationToken404Response) VisitRegenerateVerificationTokenResponse(w http.ResponseWriter) error {
+	w.WriteHeader(404)
+	return nil
+}
+
+type RegenerateVerificationToken409Response struct {
+}
+
+func (response RegenerateVerificationToken409Response) VisitRegenerateVerificationTokenResponse(w http.ResponseWriter) error {
+	w.WriteHeader(409)
+	return nil
+}
+
+type VerifyDomainRequestObject struct {
+	DomainId DomainId `json:"domainId"`
+}
+
+type VerifyDomainResponseObject interface {
+	VisitVerifyDomainResponse(w http.ResponseWriter) error
+}
+
+type VerifyDomain200JSONResponse DNSDomain
+
+func (response VerifyDomain200JSONResponse) VisitVerifyDomainResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type VerifyDomain404Response struct {
+}
+
+func (response VerifyDomain404Response) VisitVerifyDomainResponse(w http.ResponseWriter) error {
+	w.WriteHeader(404)
+	return nil
+}
+
+type VerifyDomain422JSONResponse struct {
+	// Message Which record is missing
+	Message string `json:"message"`
+}
+
+func (response VerifyDomain422JSONResponse) VisitVerifyDomainResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(422)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetCustomFieldsRequestObject struct {
+}
+
+type GetCustomFieldsResponseObject interface {
+	VisitGetCustomFieldsResponse(w http.ResponseWriter) error
+}
+
+type GetCustomFields200JSONResponse struct {
+	Fields []CustomField `json:"fields"`
+}
+
+func (response GetCustomFields200JSONResponse) VisitGetCustomFieldsResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetQuarantineRequestObject struct {
+	Params GetQuarantineParams
+}
+
+type GetQuarantineResponseObject interface {
+	VisitGetQuarantineResponse(w http.ResponseWriter) error
+}
+
+type GetQuarantine200JSONResponse struct {
+	Emails []QuarantinedEmail `json:"emails"`
+}
+
+func (response GetQuarantine200JSONResponse) VisitGetQuarantineResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type DeleteQuarantinedEmailRequestObject struct {
+	EmailId EmailId `json:"emailId"`
+}
+
+type DeleteQuarantinedEmailResponseObject interface {
+	VisitDeleteQuarantinedEmailResponse(w http.ResponseWriter) error
+}
+
+type DeleteQuarantinedEmail204Response struct {
+}
+
+func (response DeleteQuarantinedEmail204Response) VisitDeleteQuarantinedEmailResponse(w http.ResponseWriter) error {
+	w.WriteHeader(204)
+	return nil
+}
+
+type DeleteQuarantinedEmail404Response struct {
+}
+
+func (response DeleteQuarantinedEmail404Response) VisitDeleteQuarantinedEmailResponse(w http.ResponseWriter) error {
+	w.WriteHeader(404)
+	return nil
+}
+
+type GetQuarantinedEmailRequestObject struct {
+	EmailId EmailId `json:"emailId"`
+}
+
+type GetQuarantinedEmailResponseObject interface {
+	VisitGetQuarantinedEmailResponse(w http.ResponseWriter) error
+}
+
+type GetQuarantinedEmail200JSONResponse QuarantinedEmail
+
+func (response GetQuarantinedEmail200JSONResponse) VisitGetQuarantinedEmailResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetQuarantinedEmail404Response struct {
+}
+
+func (response GetQuarantinedEmail404Response) VisitGetQuarantinedEmailResponse(w http.ResponseWriter) error {
+	w.WriteHeader(404)
+	return nil
+}
+
+type ReleaseQuarantinedEmailRequestObject struct {
+	EmailId EmailId `json:"emailId"`
+}
+
+type ReleaseQuarantinedEmailResponseObject interface {
+	VisitReleaseQuarantinedEmailResponse(w http.ResponseWriter) error
+}
+
+type ReleaseQuarantinedEmail200JSONResponse Email
+
+func (response ReleaseQuarantinedEmail200JSONResponse) VisitReleaseQuarantinedEmailResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type ReleaseQuarantinedEmail404Response struct {
+}
+
+func (response ReleaseQuarantinedEmail404Response) VisitReleaseQuarantinedEmailResponse(w http.ResponseWriter) error {
+	w.WriteHeader(404)
+	return nil
+}
+
+type ReleaseQuarantinedEmail409Response struct {
+}
+
+func (response ReleaseQuarantinedEmail409Response) VisitReleaseQuarantinedEmailResponse(w http.ResponseWriter) error {
+	w.WriteHeader(409)
+	return nil
+}
+
+type ListTicketsRequestObject struct {
+	Params ListTicketsParams
+}
+
+type ListTicketsResponseObject interface {
+	VisitListTicketsResponse(w http.ResponseWriter) error
+}
+
+type ListTickets200JSONResponse struct {
+	Tickets []Ticket `json:"tickets"`
+}
+
+func (response ListTickets200JSONResponse) VisitListTicketsResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type ListTickets422JSONResponse ValidationError
+
+func (response ListTickets422JSONResponse) VisitListTicketsResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(422)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type SearchTicketsRequestObject struct {
+	Params SearchTicketsParams
+}
+
+type SearchTicketsResponseObject interface {
+	VisitSearchTicketsResponse(w http.ResponseWriter) error
+}
+
+type SearchTickets200JSONResponse struct {
+	// Matches Where the text searched for was found, by ticket ID, absent if no text was searched for or no ticket matched
+	Matches *map[string][]TextMatch `json:"matches,omitempty"`
+
+	// NextCursor Continues the search on the next page, absent on the last page
+	NextCursor *string  `json:"nextCursor,omitempty"`
+	Tickets    []Ticket `json:"tickets"`
+}
+
+func (response SearchTickets200JSONResponse) VisitSearchTicketsResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type SearchTickets422JSONResponse ValidationError
+
+func (response SearchTickets422JSONResponse) VisitSearchTicketsResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(422)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetTicketRequestObject struct {
+	TicketId TicketId `json:"ticketId"`
+}
+
+type GetTicketResponseObject interface {
+	VisitGetTicketResponse(w http.ResponseWriter) error
+}
+
+type GetTicket200JSONResponse Ticket
+
+func (response GetTicket200JSONResponse) VisitGetTicketResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetTicket404Response struct {
+}
+
+func (response GetTicket404Response) VisitGetTicketResponse(w http.ResponseWriter) error {
+	w.WriteHeader(404)
+	return nil
+}
+
+type UpdateTicketRequestObject struct {
+	TicketId TicketId `json:"ticketId"`
+	Body     *UpdateTicketJSONRequestBody
+}
+
+type UpdateTicketResponseObject interface {
+	VisitUpdateTicketResponse(w http.ResponseWriter) error
+}
+
+type UpdateTicket200JSONResponse Ticket
+
+func (response UpdateTicket200JSONResponse) VisitUpdateTicketResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type UpdateTicket404Response struct {
+}
+
+func (response UpdateTicket404Response) VisitUpdateTicketResponse(w http.ResponseWriter) error {
+	w.WriteHeader(404)
+	return nil
+}
+
+type UpdateTicket422JSONResponse ValidationError
+
+func (response UpdateTicket422JSONResponse) VisitUpdateTicketResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(422)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetTicketAttachmentRequestObject struct {
+	TicketId     TicketId     `json:"ticketId"`
+	AttachmentId AttachmentId `json:"attachmentId"`
+}
+
+type GetTicketAttachmentResponseObject interface {
+	VisitGetTicketAttachmentResponse(w http.ResponseWriter) error
+}
+
+type GetTicketAttachment200ResponseHeaders struct {
+	ContentDisposition string
+}
+
+type GetTicketAttachment200AsteriskResponse struct {
+	Body          io.Reader
+	Headers       GetTicketAttachment200ResponseHeaders
+	ContentType   string
+	ContentLength int64
+}
+
+func (response GetTicketAttachment200AsteriskResponse) VisitGetTicketAttachmentResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Disposition", fmt.Sprint(response.Headers.ContentDisposition))
+	w.Header().Set("Content-Type", response.ContentType)
+	if response.ContentLength != 0 {
+		w.Header().Set("Content-Length", fmt.Sprint(response.ContentLength))
+	}
+	w.WriteHeader(200)
+
+	if closer, ok := response.Body.(io.ReadCloser); ok {
+		defer closer.Close()
+	}
+	_, err := io.Copy(w, response.Body)
+	return err
+}
+
+type GetTicketAttachment404Response struct {
+}
+
+func (response GetTicketAttachment404Response) VisitGetTicketAttachmentResponse(w http.ResponseWriter) error {
+	w.WriteHeader(404)
+	return nil
+}
+
+type AddTicketCommentRequestObject struct {
+	TicketId TicketId `json:"ticketId"`
+	Body     *AddTicketCommentJSONRequestBody
+}
+
+type AddTicketCommentResponseObject interface {
+	VisitAddTicketCommentResponse(w http.ResponseWriter) error
+}
+
+type AddTicketComment201JSONResponse TicketComment
+
+func (response AddTicketComment201JSONResponse) VisitAddTicketCommentResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(201)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type AddTicketComment404Response struct {
+}
+
+func (response AddTicketComment404Response) VisitAddTicketCommentResponse(w http.ResponseWriter) error {
+	w.WriteHeader(404)
+	return nil
+}
+
+type AddTicketComment422JSONResponse ValidationError
+
+func (response AddTicketComment422JSONResponse) VisitAddTicketCommentResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(422)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type ReplyToTicketRequestObject struct {
+	TicketId uint64 `json:"ticketId"`
+	Body     *ReplyToTicketJSONRequestBody
+}
+
+type ReplyToTicketResponseObject interface {
+	VisitReplyToTicketResponse(w http.ResponseWriter) error
+}
+
+type ReplyToTicket201JSONResponse Email
+
+func (response ReplyToTicket201JSONResponse) VisitReplyToTicketResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(201)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type ReplyToTicket404Response struct {
+}
+
+func (response ReplyToTicket404Response) VisitReplyToTicketResponse(w http.ResponseWriter) error {
+	w.WriteHeader(404)
+	return nil
+}
+
+type ReplyToTicket409Response struct {
+}
+
+func (response ReplyToTicket409Response) VisitReplyToTicketResponse(w http.ResponseWriter) error {
+	w.WriteHeader(409)
+	return nil
+}
+
+type MarkTicketSpamRequestObject struct {
+	TicketId uint64 `json:"ticketId"`
+	Body     *MarkTicketSpamJSONRequestBody
+}
+
+type MarkTicketSpamResponseObject interface {
+	VisitMarkTicketSpamResponse(w http.ResponseWriter) error
+}
+
+type MarkTicketSpam204Response struct {
+}
+
+func (response MarkTicketSpam204Response) VisitMarkTicketSpamResponse(w http.ResponseWriter) error {
+	w.WriteHeader(204)
+	return nil
+}
+
+type MarkTicketSpam404Response struct {
+}
+
+func (response MarkTicketSpam404Response) VisitMarkTicketSpamResponse(w http.ResponseWriter) error {
+	w.WriteHeader(404)
+	return nil
+}
+
+type SetTicketStatusRequestObject struct {
+	TicketId uint64 `json:"ticketId"`
+	Body     *SetTicketStatusJSONRequestBody
+}
+
+type SetTicketStatusResponseObject interface {
+	VisitSetTicketStatusResponse(w http.ResponseWriter) error
+}
+
+type SetTicketStatus200JSONResponse Ticket
+
+func (response SetTicketStatus200JSONResponse) VisitSetTicketStatusResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type SetTicketStatus404Response struct {
+}
+
+func (response SetTicketStatus404Response) VisitSetTicketStatusResponse(w http.ResponseWriter) error {
+	w.WriteHeader(404)
+	return nil
+}
+
+type SetTicketStatus422JSONResponse WorkflowError
+
+func (response SetTicketStatus422JSONResponse) VisitSetTicketStatusResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(422)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetTicketTimelineRequestObject struct {
+	TicketId TicketId `json:"ticketId"`
+}
+
+type GetTicketTimelineResponseObject interface {
+	VisitGetTicketTimelineResponse(w http.ResponseWriter) error
+}
+
+type GetTicketTimeline200JSONResponse struct {
+	Entries []TimelineEntry `json:"entries"`
+}
+
+func (response GetTicketTimeline200JSONResponse) VisitGetTicketTimelineResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+type GetTicketTimeline404Response struct {
+}
+
+func (response GetTicketTimeline404Response) VisitGetTicketTimelineResponse(w http.ResponseWriter) error {
+	w.WriteHeader(404)
+	return nil
+}
+
+type GetWorkflowRequestObject struct {
+}
+
+type GetWorkflowResponseObject interface {
+	VisitGetWorkflowResponse(w http.ResponseWriter) error
+}
+
+type GetWorkflow200JSONResponse Workflow
+
+func (response GetWorkflow200JSONResponse) VisitGetWorkflowResponse(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+
+	return json.NewEncoder(w).Encode(response)
+}
+
+// StrictServerInterface represents all server handlers.
+type StrictServerInterface interface {
+
+	// (PUT /v1/aliases/{aliasId}/routing)
+	SetAliasRouting(ctx context.Context, request SetAliasRoutingRequestObject) (SetAliasRoutingResponseObject, error)
+
+	// (GET /v1/auth/user)
+	GetUser(ctx context.Context, request GetUserRequestObject) (GetUserResponseObject, error)
+
+	// (GET /v1/domains)
+	GetDomains(ctx context.Context, request GetDomainsRequestObject) (GetDomainsResponseObject, error)
+
+	// (POST /v1/domains)
+	CreateDomain(ctx context.Context, request CreateDomainRequestObject) (CreateDomainResponseObject, error)
+
+	// (DELETE /v1/domains/{domainId})
+	DeleteDomain(ctx context.Context, request DeleteDomainRequestObject) (DeleteDomainResponseObject, error)
+
+	// (GET /v1/domains/{domainId})
+	GetDomain(ctx context.Context, request GetDomainRequestObject) (GetDomainResponseObject, error)
+
+	// (PATCH /v1/domains/{domainId})
+	RenameDomain(ctx context.Context, request RenameDomainRequestObject) (RenameDomainResponseObject, error)
+
+	// (POST /v1/domains/{domainId}/dkim)
+	GenerateDKIMKey(ctx context.Context, request GenerateDKIMKeyRequestObject) (GenerateDKIMKeyResponseObject, error)
+
+	// (GET /v1/domains/{domainId}/records)
+	GetDNSRecords(ctx context.Context, request GetDNSRecordsRequestObject) (GetDNSRecordsResponseObject, error)
+
+	// (POST /v1/domains/{domainId}/verification-token)
+	RegenerateVerificationToken(ctx context.Context, request RegenerateVerificationTokenRequestObject) (RegenerateVerificationTokenResponseObject, error)
+
+	// (POST /v1/domains/{domainId}/verify)
+	VerifyDomain(ctx context.Context, request VerifyDomainRequestObject) (VerifyDomainResponseObject, error)
+
+	// (GET /v1/fields)
+	GetCustomFields(ctx context.Context, request GetCustomFieldsRequestObject) (GetCustomFieldsResponseObject, error)
+
+	// (GET /v1/quarantine)
+	GetQuarantine(ctx context.Context, request GetQuarantineRequestObject) (GetQuarantineResponseObject, error)
+
+	// (DELETE /v1/quarantine/{emailId})
+	DeleteQuarantinedEmail(ctx context.Context, request DeleteQuarantinedEmailRequestObject) (DeleteQuarantinedEmailResponseObject, error)
+
+	// (GET /v1/quarantine/{emailId})
+	GetQuarantinedEmail(ctx context.Context, request GetQuarantinedEmailRequestObject) (GetQuarantinedEmailResponseObject, error)
+
+	// (POST /v1/quarantine/{emailId}/release)
+	ReleaseQuarantinedEmail(ctx context.Context, request ReleaseQuarantinedEmailRequestObject) (ReleaseQuarantinedEmailResponseObject, error)
+
+	// (GET /v1/tickets)
+	ListTickets(ctx context.Context, request ListTicketsRequestObject) (ListTicketsResponseObject, error)
+
+	// (GET /v1/tickets/search)
+	SearchTickets(ctx context.Context, request SearchTicketsRequestObject) (SearchTicketsResponseObject, error)
+
+	// (GET /v1/tickets/{ticketId})
+	GetTicket(ctx context.Context, request GetTicketRequestObject) (GetTicketResponseObject, error)
+
+	// (PATCH /v1/tickets/{ticketId})
+	UpdateTicket(ctx context.Context, request UpdateTicketRequestObject) (UpdateTicketResponseObject, error)
+
+	// (GET /v1/tickets/{ticketId}/attachments/{attachmentId})
+	GetTicketAttachment(ctx context.Context, request GetTicketAttachmentRequestObject) (GetTicketAttachmentResponseObject, error)
+
+	// (POST /v1/tickets/{ticketId}/comments)
+	AddTicketComment(ctx context.Context, request AddTicketCommentRequestObject) (AddTicketCommentResponseObject, error)
+
+	// (POST /v1/tickets/{ticketId}/replies)
+	ReplyToTicket(ctx context.Context, request ReplyToTicketRequestObject) (ReplyToTicketResponseObject, error)
+
+	// (PUT /v1/tickets/{ticketId}/spam)
+	MarkTicketSpam(ctx context.Context, request MarkTicketSpamRequestObject) (MarkTicketSpamResponseObject, error)
+
+	// (PUT /v1/tickets/{ticketId}/status)
+	SetTicketStatus(ctx context.Context, request SetTicketStatusRequestObject) (SetTicketStatusResponseObject, error)
+
+	// (GET /v1/tickets/{ticketId}/timeline)
+	GetTicketTimeline(ctx context.Context, request GetTicketTimelineRequestObject) (GetTicketTimelineResponseObject, error)
+
+	// (GET /v1/workflow)
+	GetWorkflow(ctx context.Context, request GetWorkflowRequestObject) (GetWorkflowResponseObject, error)
+}
+
+type StrictHandlerFunc = runtime.StrictEchoHandlerFunc
+type StrictMiddlewareFunc = runtime.StrictEchoMiddlewareFunc
+
+func NewStrictHandler(ssi StrictServerInterface, middlewares []StrictMiddlewareFunc) ServerInterface {
+	return &strictHandler{ssi: ssi, middlewares: middlewares}
+}
+
+type strictHandler struct {
+	ssi         StrictServerInterface
+	middlewares []StrictMiddlewareFunc
+}
+
+// SetAliasRouting operation middleware
+func (sh *strictHandler) SetAliasRouting(ctx echo.Context, aliasId uint64) error {
+	var request SetAliasRoutingRequestObject
+
+	request.AliasId = aliasId
+
+	var body SetAliasRoutingJSONRequestBody
+	if err := ctx.Bind(&body); err != nil {
+		return err
+	}
+	request.Body = &body
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.SetAliasRouting(ctx.Request().Context(), request.(SetAliasRoutingRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "SetAliasRouting")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(SetAliasRoutingResponseObject); ok {
+		return validResponse.VisitSetAliasRoutingResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// GetUser operation middleware
+func (sh *strictHandler) GetUser(ctx echo.Context) error {
+	var request GetUserRequestObject
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.GetUser(ctx.Request().Context(), request.(GetUserRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "GetUser")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(GetUserResponseObject); ok {
+		return validResponse.VisitGetUserResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// GetDomains operation middleware
+func (sh *strictHandler) GetDomains(ctx echo.Context) error {
+	var request GetDomainsRequestObject
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.GetDomains(ctx.Request().Context(), request.(GetDomainsRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "GetDomains")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(GetDomainsResponseObject); ok {
+		return validResponse.VisitGetDomainsResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// CreateDomain operation middleware
+func (sh *strictHandler) CreateDomain(ctx echo.Context) error {
+	var request CreateDomainRequestObject
+
+	var body CreateDomainJSONRequestBody
+	if err := ctx.Bind(&body); err != nil {
+		return err
+	}
+	request.Body = &body
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.CreateDomain(ctx.Request().Context(), request.(CreateDomainRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "CreateDomain")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(CreateDomainResponseObject); ok {
+		return validResponse.VisitCreateDomainResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// DeleteDomain operation middleware
+func (sh *strictHandler) DeleteDomain(ctx echo.Context, domainId DomainId) error {
+	var request DeleteDomainRequestObject
+
+	request.DomainId = domainId
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.DeleteDomain(ctx.Request().Context(), request.(DeleteDomainRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "DeleteDomain")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(DeleteDomainResponseObject); ok {
+		return validResponse.VisitDeleteDomainResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// GetDomain operation middleware
+func (sh *strictHandler) GetDomain(ctx echo.Context, domainId DomainId) error {
+	var request GetDomainRequestObject
+
+	request.DomainId = domainId
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.GetDomain(ctx.Request().Context(), request.(GetDomainRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "GetDomain")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(GetDomainResponseObject); ok {
+		return validResponse.VisitGetDomainResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// RenameDomain operation middleware
+func (sh *strictHandler) RenameDomain(ctx echo.Context, domainId DomainId) error {
+	var request RenameDomainRequestObject
+
+	request.DomainId = domainId
+
+	var body RenameDomainJSONRequestBody
+	if err := ctx.Bind(&body); err != nil {
+		return err
+	}
+	request.Body = &body
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.RenameDomain(ctx.Request().Context(), request.(RenameDomainRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "RenameDomain")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(RenameDomainResponseObject); ok {
+		return validResponse.VisitRenameDomainResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// GenerateDKIMKey operation middleware
+func (sh *strictHandler) GenerateDKIMKey(ctx echo.Context, domainId DomainId) error {
+	var request GenerateDKIMKeyRequestObject
+
+	request.DomainId = domainId
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.GenerateDKIMKey(ctx.Request().Context(), request.(GenerateDKIMKeyRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "GenerateDKIMKey")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(GenerateDKIMKeyResponseObject); ok {
+		return validResponse.VisitGenerateDKIMKeyResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// GetDNSRecords operation middleware
+func (sh *strictHandler) GetDNSRecords(ctx echo.Context, domainId DomainId) error {
+	var request GetDNSRecordsRequestObject
+
+	request.DomainId = domainId
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.GetDNSRecords(ctx.Request().Context(), request.(GetDNSRecordsRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "GetDNSRecords")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(GetDNSRecordsResponseObject); ok {
+		return validResponse.VisitGetDNSRecordsResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// RegenerateVerificationToken operation middleware
+func (sh *strictHandler) RegenerateVerificationToken(ctx echo.Context, domainId DomainId) error {
+	var request RegenerateVerificationTokenRequestObject
+
+	request.DomainId = domainId
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.RegenerateVerificationToken(ctx.Request().Context(), request.(RegenerateVerificationTokenRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "RegenerateVerificationToken")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(RegenerateVerificationTokenResponseObject); ok {
+		return validResponse.VisitRegenerateVerificationTokenResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// VerifyDomain operation middleware
+func (sh *strictHandler) VerifyDomain(ctx echo.Context, domainId DomainId) error {
+	var request VerifyDomainRequestObject
+
+	request.DomainId = domainId
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.VerifyDomain(ctx.Request().Context(), request.(VerifyDomainRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "VerifyDomain")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(VerifyDomainResponseObject); ok {
+		return validResponse.VisitVerifyDomainResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// GetCustomFields operation middleware
+func (sh *strictHandler) GetCustomFields(ctx echo.Context) error {
+	var request GetCustomFieldsRequestObject
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.GetCustomFields(ctx.Request().Context(), request.(GetCustomFieldsRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "GetCustomFields")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(GetCustomFieldsResponseObject); ok {
+		return validResponse.VisitGetCustomFieldsResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// GetQuarantine operation middleware
+func (sh *strictHandler) GetQuarantine(ctx echo.Context, params GetQuarantineParams) error {
+	var request GetQuarantineRequestObject
+
+	request.Params = params
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.GetQuarantine(ctx.Request().Context(), request.(GetQuarantineRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "GetQuarantine")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(GetQuarantineResponseObject); ok {
+		return validResponse.VisitGetQuarantineResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// DeleteQuarantinedEmail operation middleware
+func (sh *strictHandler) DeleteQuarantinedEmail(ctx echo.Context, emailId EmailId) error {
+	var request DeleteQuarantinedEmailRequestObject
+
+	request.EmailId = emailId
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.DeleteQuarantinedEmail(ctx.Request().Context(), request.(DeleteQuarantinedEmailRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "DeleteQuarantinedEmail")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(DeleteQuarantinedEmailResponseObject); ok {
+		return validResponse.VisitDeleteQuarantinedEmailResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// GetQuarantinedEmail operation middleware
+func (sh *strictHandler) GetQuarantinedEmail(ctx echo.Context, emailId EmailId) error {
+	var request GetQuarantinedEmailRequestObject
+
+	request.EmailId = emailId
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.GetQuarantinedEmail(ctx.Request().Context(), request.(GetQuarantinedEmailRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "GetQuarantinedEmail")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(GetQuarantinedEmailResponseObject); ok {
+		return validResponse.VisitGetQuarantinedEmailResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// ReleaseQuarantinedEmail operation middleware
+func (sh *strictHandler) ReleaseQuarantinedEmail(ctx echo.Context, emailId EmailId) error {
+	var request ReleaseQuarantinedEmailRequestObject
+
+	request.EmailId = emailId
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.ReleaseQuarantinedEmail(ctx.Request().Context(), request.(ReleaseQuarantinedEmailRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "ReleaseQuarantinedEmail")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(ReleaseQuarantinedEmailResponseObject); ok {
+		return validResponse.VisitReleaseQuarantinedEmailResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// ListTickets operation middleware
+func (sh *strictHandler) ListTickets(ctx echo.Context, params ListTicketsParams) error {
+	var request ListTicketsRequestObject
+
+	request.Params = params
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.ListTickets(ctx.Request().Context(), request.(ListTicketsRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "ListTickets")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(ListTicketsResponseObject); ok {
+		return validResponse.VisitListTicketsResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// SearchTickets operation middleware
+func (sh *strictHandler) SearchTickets(ctx echo.Context, params SearchTicketsParams) error {
+	var request SearchTicketsRequestObject
+
+	request.Params = params
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.SearchTickets(ctx.Request().Context(), request.(SearchTicketsRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "SearchTickets")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(SearchTicketsResponseObject); ok {
+		return validResponse.VisitSearchTicketsResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// GetTicket operation middleware
+func (sh *strictHandler) GetTicket(ctx echo.Context, ticketId TicketId) error {
+	var request GetTicketRequestObject
+
+	request.TicketId = ticketId
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.GetTicket(ctx.Request().Context(), request.(GetTicketRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "GetTicket")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(GetTicketResponseObject); ok {
+		return validResponse.VisitGetTicketResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// UpdateTicket operation middleware
+func (sh *strictHandler) UpdateTicket(ctx echo.Context, ticketId TicketId) error {
+	var request UpdateTicketRequestObject
+
+	request.TicketId = ticketId
+
+	var body UpdateTicketJSONRequestBody
+	if err := ctx.Bind(&body); err != nil {
+		return err
+	}
+	request.Body = &body
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.UpdateTicket(ctx.Request().Context(), request.(UpdateTicketRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "UpdateTicket")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(UpdateTicketResponseObject); ok {
+		return validResponse.VisitUpdateTicketResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// GetTicketAttachment operation middleware
+func (sh *strictHandler) GetTicketAttachment(ctx echo.Context, ticketId TicketId, attachmentId AttachmentId) error {
+	var request GetTicketAttachmentRequestObject
+
+	request.TicketId = ticketId
+	request.AttachmentId = attachmentId
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.GetTicketAttachment(ctx.Request().Context(), request.(GetTicketAttachmentRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "GetTicketAttachment")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(GetTicketAttachmentResponseObject); ok {
+		return validResponse.VisitGetTicketAttachmentResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// AddTicketComment operation middleware
+func (sh *strictHandler) AddTicketComment(ctx echo.Context, ticketId TicketId) error {
+	var request AddTicketCommentRequestObject
+
+	request.TicketId = ticketId
+
+	var body AddTicketCommentJSONRequestBody
+	if err := ctx.Bind(&body); err != nil {
+		return err
+	}
+	request.Body = &body
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.AddTicketComment(ctx.Request().Context(), request.(AddTicketCommentRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "AddTicketComment")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(AddTicketCommentResponseObject); ok {
+		return validResponse.VisitAddTicketCommentResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// ReplyToTicket operation middleware
+func (sh *strictHandler) ReplyToTicket(ctx echo.Context, ticketId uint64) error {
+	var request ReplyToTicketRequestObject
+
+	request.TicketId = ticketId
+
+	var body ReplyToTicketJSONRequestBody
+	if err := ctx.Bind(&body); err != nil {
+		return err
+	}
+	request.Body = &body
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.ReplyToTicket(ctx.Request().Context(), request.(ReplyToTicketRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "ReplyToTicket")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(ReplyToTicketResponseObject); ok {
+		return validResponse.VisitReplyToTicketResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// MarkTicketSpam operation middleware
+func (sh *strictHandler) MarkTicketSpam(ctx echo.Context, ticketId uint64) error {
+	var request MarkTicketSpamRequestObject
+
+	request.TicketId = ticketId
+
+	var body MarkTicketSpamJSONRequestBody
+	if err := ctx.Bind(&body); err != nil {
+		return err
+	}
+	request.Body = &body
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.MarkTicketSpam(ctx.Request().Context(), request.(MarkTicketSpamRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "MarkTicketSpam")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(MarkTicketSpamResponseObject); ok {
+		return validResponse.VisitMarkTicketSpamResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// SetTicketStatus operation middleware
+func (sh *strictHandler) SetTicketStatus(ctx echo.Context, ticketId uint64) error {
+	var request SetTicketStatusRequestObject
+
+	request.TicketId = ticketId
+
+	var body SetTicketStatusJSONRequestBody
+	if err := ctx.Bind(&body); err != nil {
+		return err
+	}
+	request.Body = &body
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.SetTicketStatus(ctx.Request().Context(), request.(SetTicketStatusRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "SetTicketStatus")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(SetTicketStatusResponseObject); ok {
+		return validResponse.VisitSetTicketStatusResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// GetTicketTimeline operation middleware
+func (sh *strictHandler) GetTicketTimeline(ctx echo.Context, ticketId TicketId) error {
+	var request GetTicketTimelineRequestObject
+
+	request.TicketId = ticketId
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.GetTicketTimeline(ctx.Request().Context(), request.(GetTicketTimelineRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "GetTicketTimeline")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(GetTicketTimelineResponseObject); ok {
+		return validResponse.VisitGetTicketTimelineResponse(ctx.Response())
+	} else if response != nil {
+		return fmt.Errorf("Unexpected response type: %T", response)
+	}
+	return nil
+}
+
+// GetWorkflow operation middleware
+func (sh *strictHandler) GetWorkflow(ctx echo.Context) error {
+	var request GetWorkflowRequestObject
+
+	handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+		return sh.ssi.GetWorkflow(ctx.Request().Context(), request.(GetWorkflowRequestObject))
+	}
+	for _, middleware := range sh.middlewares {
+		handler = middleware(handler, "GetWorkflow")
+	}
+
+	response, err := handler(ctx, request)
+
+	if err != nil {
+		return err
+	} else if validResponse, ok := response.(GetWorkflowResponseObject); ok {
+		return validResponse.VisitGetWorkflowResponse(ctx.Response())
 	} else if response != nil {
 		return fmt.Errorf("Unexpected response type: %T", response)
 	}
@@ -1,14 +1,76 @@
 package api
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"mime"
+	"strings"
+	"time"
 
 	"github.com/deepmap/oapi-codegen/pkg/types"
 	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/nil-nil/ticket/internal/services/email"
 )
 
 type Api struct {
+	tickets    TicketService
+	workflow   *domain.Workflow
+	fields     *domain.CustomFields
+	replies    ReplyService
+	domains    DNSDomainService
+	spam       SpamService
+	aliases    AliasService
+	quarantine QuarantineService
+}
+
+// TicketService changes tickets, returning a domain.WorkflowError for status changes the workflow doesn't allow
+type TicketService interface {
+	GetTicket(ctx context.Context, ID uint64) (domain.Ticket, error)
+	ListTickets(ctx context.Context, filter domain.TicketFilter) ([]domain.Ticket, error)
+	ParseQuery(input string, userID uint64) (domain.TicketQuery, error)
+	SearchTickets(ctx context.Context, query domain.TicketQuery) (domain.TicketPage, error)
+	UpdateTicket(ctx context.Context, ID uint64, Params domain.TicketUpdateParameters) (domain.Ticket, error)
+	AddComment(ctx context.Context, ID uint64, comment domain.TicketComment) (domain.Ticket, error)
+	GetCommentAttachment(ctx context.Context, ticketID uint64, ID uint64) (domain.Attachment, error)
+}
+
+// ReplyService sends email replies to the customer on a ticket
+type ReplyService interface {
+	Reply(ctx context.Context, ticketID uint64, body string) (domain.Email, error)
+}
+
+// SpamService marks tickets as spam, training the spam classifier
+type SpamService interface {
+	MarkSpam(ctx context.Context, ticketID uint64, spam bool) (domain.Ticket, error)
+}
+
+// AliasService manages the addresses we receive mail for
+type AliasService interface {
+	SetRouting(ctx context.Context, ID uint64, routing domain.AliasRouting) (domain.Alias, error)
+}
+
+// QuarantineService reviews inbound email held in quarantine, releasing it into tickets or deleting it
+type QuarantineService interface {
+	List(ctx context.Context, filter domain.QuarantineFilter) ([]domain.Email, error)
+	Get(ctx context.Context, ID uint64) (domain.Email, error)
+	ExpiresAt(q domain.Quarantine) time.Time
+	Release(ctx context.Context, ID uint64) (domain.Email, error)
+	Delete(ctx context.Context, ID uint64) error
+}
+
+// DNSDomainService manages the domains we handle mail for, their verification and their DKIM keys
+type DNSDomainService interface {
+	GetDomains(ctx context.Context) ([]domain.DNSDomain, error)
+	GetDomain(ctx context.Context, ID uint64) (domain.DNSDomain, error)
+	CreateDomain(ctx context.Context, name string) (domain.DNSDomain, error)
+	RenameDomain(ctx context.Context, ID uint64, name string) (domain.DNSDomain, error)
+	DeleteDomain(ctx context.Context, ID uint64) (domain.DNSDomain, error)
+	VerifyDomain(ctx context.Context, ID uint64) (domain.DNSDomain, error)
+	RegenerateVerificationToken(ctx context.Context, ID uint64) (domain.DNSDomain, error)
+	GenerateDKIMKey(ctx context.Context, ID uint64) (domain.DNSDomain, error)
+	DNSRecords(ctx context.Context, ID uint64) ([]domain.DNSRecord, error)
 }
 
 type UserRespository interface {
@@ -29,8 +91,17 @@ type AuthProvider interface {
 // Make sure we conform to StrictServerInterface
 var _ StrictServerInterface = (*Api)(nil)
 
-func NewApi() *Api {
-	api := Api{}
+func NewApi(tickets TicketService, workflow *domain.Workflow, fields *domain.CustomFields, replies ReplyService, domains DNSDomainService, spam SpamService, aliases AliasService, quarantine QuarantineService) *Api {
+	api := Api{
+		tickets:    tickets,
+		workflow:   workflow,
+		fields:     fields,
+		replies:    replies,
+		domains:    domains,
+		spam:       spam,
+		aliases:    aliases,
+		quarantine: quarantine,
+	}
 	return &api
 }
 
@@ -53,3 +124,703 @@ func (*Api) GetUser(ctx context.Context, req GetUserRequestObject) (GetUserRespo
 
 	return GetUser200JSONResponse{u}, nil
 }
+
+func (a *Api) GetWorkflow(ctx context.Context, req GetWorkflowRequestObject) (GetWorkflowResponseObject, error) {
+	res := GetWorkflow200JSONResponse{Statuses: []WorkflowStatus{}, Transitions: []WorkflowTransition{}}
+	for _, s := range a.workflow.Statuses() {
+		res.Statuses = append(res.Statuses, WorkflowStatus{Id: int(s.Status), Name: s.Name})
+	}
+	for _, t := range a.workflow.Transitions() {
+		transition := WorkflowTransition{From: []string{}, To: a.workflow.StatusName(t.To), Require: []TicketField{}}
+		for _, from := range t.From {
+			transition.From = append(transition.From, a.workflow.StatusName(from))
+		}
+		for _, field := range t.Require {
+			transition.Require = append(transition.Require, TicketField(field))
+		}
+		res.Transitions = append(res.Transitions, transition)
+	}
+	return res, nil
+}
+
+func (a *Api) GetCustomFields(ctx context.Context, req GetCustomFieldsRequestObject) (GetCustomFieldsResponseObject, error) {
+	res := GetCustomFields200JSONResponse{Fields: []CustomField{}}
+	for _, d := range a.fields.Definitions() {
+		field := CustomField{Key: d.Key, Name: d.Name, Type: CustomFieldType(d.Type), Options: d.Options}
+		if field.Options == nil {
+			field.Options = []string{}
+		}
+		res.Fields = append(res.Fields, field)
+	}
+	return res, nil
+}
+
+func (a *Api) ListTickets(ctx context.Context, req ListTicketsRequestObject) (ListTicketsResponseObject, error) {
+	filter := domain.TicketFilter{
+		OwnerID: req.Params.OwnerId,
+		Queue:   req.Params.Queue,
+		Spam:    req.Params.Spam,
+	}
+	if req.Params.Status != nil {
+		for _, name := range *req.Params.Status {
+			status, ok := a.workflow.ParseStatus(name)
+			if !ok {
+				return ListTickets422JSONResponse{Message: fmt.Sprintf("%s %q", domain.ErrUnknownStatus, name)}, nil
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+	if req.Params.Priority != nil {
+		for _, priority := range *req.Params.Priority {
+			filter.Priorities = append(filter.Priorities, domain.ParseTicketPriority(string(priority)))
+		}
+	}
+	if req.Params.Type != nil {
+		for _, ticketType := range *req.Params.Type {
+			filter.Types = append(filter.Types, domain.ParseTicketType(string(ticketType)))
+		}
+	}
+	if req.Params.Tag != nil {
+		filter.Tags = *req.Params.Tag
+	}
+	if req.Params.Field != nil {
+		filter.Fields = make(map[string]string, len(*req.Params.Field))
+		for _, field := range *req.Params.Field {
+			key, value, ok := strings.Cut(field, ":")
+			if !ok {
+				return ListTickets422JSONResponse{Message: fmt.Sprintf("field filter %q must be written as key:value", field)}, nil
+			}
+			filter.Fields[strings.TrimSpace(key)] = value
+		}
+	}
+
+	tickets, err := a.tickets.ListTickets(ctx, filter)
+	if errors.Is(err, domain.ErrUnknownCustomField) || errors.Is(err, domain.ErrInvalidFieldValue) {
+		return ListTickets422JSONResponse{Message: err.Error()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := ListTickets200JSONResponse{Tickets: []Ticket{}}
+	for _, ticket := range tickets {
+		res.Tickets = append(res.Tickets, a.apiTicket(ticket))
+	}
+	return res, nil
+}
+
+func (a *Api) SearchTickets(ctx context.Context, req SearchTicketsRequestObject) (SearchTicketsResponseObject, error) {
+	user, ok := ctx.Value(userMiddlewareValue).(domain.User)
+	if !ok {
+		return nil, fmt.Errorf("not found")
+	}
+
+	var input string
+	if req.Params.Q != nil {
+		input = *req.Params.Q
+	}
+	query, err := a.tickets.ParseQuery(input, user.ID)
+	if err != nil {
+		return SearchTickets422JSONResponse{Message: err.Error()}, nil
+	}
+	if req.Params.Cursor != nil {
+		query.Cursor = *req.Params.Cursor
+	}
+	if req.Params.Limit != nil {
+		query.Limit = *req.Params.Limit
+	}
+
+	page, err := a.tickets.SearchTickets(ctx, query)
+	if errors.Is(err, domain.ErrInvalidQuery) || errors.Is(err, domain.ErrInvalidCursor) ||
+		errors.Is(err, domain.ErrUnknownCustomField) || errors.Is(err, domain.ErrInvalidFieldValue) {
+		return SearchTickets422JSONResponse{Message: err.Error()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := SearchTickets200JSONResponse{Tickets: []Ticket{}}
+	for _, ticket := range page.Tickets {
+		res.Tickets = append(res.Tickets, a.apiTicket(ticket))
+	}
+	if page.NextCursor != "" {
+		res.NextCursor = &page.NextCursor
+	}
+	if len(page.Matches) > 0 {
+		matches := make(map[string][]TextMatch, len(page.Matches))
+		for ID, ticketMatches := range page.Matches {
+			for _, match := range ticketMatches {
+				snippet := make([]TextFragment, 0, len(match.Snippet))
+				for _, fragment := range match.Snippet {
+					snippet = append(snippet, TextFragment{Text: fragment.Text, Highlighted: fragment.Highlighted})
+				}
+				matches[fmt.Sprint(ID)] = append(matches[fmt.Sprint(ID)], TextMatch{Source: TextMatchSource(match.Source), SourceId: match.SourceID, Snippet: snippet})
+			}
+		}
+		res.Matches = &matches
+	}
+	return res, nil
+}
+
+func (a *Api) UpdateTicket(ctx context.Context, req UpdateTicketRequestObject) (UpdateTicketResponseObject, error) {
+	params := domain.TicketUpdateParameters{}
+	if req.Body.Priority != nil {
+		params.Priority = domain.ParseTicketPriority(string(*req.Body.Priority))
+	}
+	if req.Body.Type != nil {
+		params.Type = domain.ParseTicketType(string(*req.Body.Type))
+	}
+	if req.Body.AddTags != nil {
+		params.AddTags = *req.Body.AddTags
+	}
+	if req.Body.RemoveTags != nil {
+		params.RemoveTags = *req.Body.RemoveTags
+	}
+	if req.Body.Fields != nil {
+		params.SetFields = *req.Body.Fields
+	}
+
+	ticket, err := a.tickets.UpdateTicket(ctx, req.TicketId, params)
+	if errors.Is(err, domain.ErrNotFound) {
+		return UpdateTicket404Response{}, nil
+	}
+	if errors.Is(err, domain.ErrUnknownCustomField) || errors.Is(err, domain.ErrInvalidFieldValue) {
+		return UpdateTicket422JSONResponse{Message: err.Error()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return UpdateTicket200JSONResponse(a.apiTicket(ticket)), nil
+}
+
+func (a *Api) GetTicket(ctx context.Context, req GetTicketRequestObject) (GetTicketResponseObject, error) {
+	ticket, err := a.tickets.GetTicket(ctx, req.TicketId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return GetTicket404Response{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return GetTicket200JSONResponse(a.apiTicket(ticket)), nil
+}
+
+func (a *Api) GetTicketTimeline(ctx context.Context, req GetTicketTimelineRequestObject) (GetTicketTimelineResponseObject, error) {
+	ticket, err := a.tickets.GetTicket(ctx, req.TicketId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return GetTicketTimeline404Response{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := GetTicketTimeline200JSONResponse{Entries: []TimelineEntry{}}
+	for _, transition := range ticket.Timeline() {
+		res.Entries = append(res.Entries, a.apiTimelineEntry(transition))
+	}
+	return res, nil
+}
+
+func (a *Api) AddTicketComment(ctx context.Context, req AddTicketCommentRequestObject) (AddTicketCommentResponseObject, error) {
+	author, ok := ctx.Value(userMiddlewareValue).(domain.User)
+	if !ok {
+		return nil, fmt.Errorf("not found")
+	}
+
+	comment := domain.TicketComment{
+		AuthorID:   author.ID,
+		Visibility: domain.ParseCommentVisibility(string(req.Body.Visibility)),
+	}
+	if req.Body.Body != nil {
+		comment.Body = *req.Body.Body
+	}
+	if req.Body.Attachments != nil {
+		for _, upload := range *req.Body.Attachments {
+			attachment := domain.Attachment{Filename: upload.Filename, ContentType: "application/octet-stream", Content: upload.Content}
+			if upload.ContentType != nil && *upload.ContentType != "" {
+				attachment.ContentType = *upload.ContentType
+			}
+			comment.Attachments = append(comment.Attachments, attachment)
+		}
+	}
+
+	ticket, err := a.tickets.AddComment(ctx, req.TicketId, comment)
+	if errors.Is(err, domain.ErrNotFound) {
+		return AddTicketComment404Response{}, nil
+	}
+	if errors.Is(err, domain.ErrInvalidComment) {
+		return AddTicketComment422JSONResponse{Message: err.Error()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The comment was added by the ticket's latest transition
+	for i := len(ticket.Transitions) - 1; i >= 0; i-- {
+		if added := ticket.Transitions[i].Comment; added != nil {
+			return AddTicketComment201JSONResponse(apiTicketComment(*added)), nil
+		}
+	}
+	return nil, fmt.Errorf("comment missing from ticket %d", ticket.ID)
+}
+
+func (a *Api) GetTicketAttachment(ctx context.Context, req GetTicketAttachmentRequestObject) (GetTicketAttachmentResponseObject, error) {
+	attachment, err := a.tickets.GetCommentAttachment(ctx, req.TicketId, req.AttachmentId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return GetTicketAttachment404Response{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return GetTicketAttachment200AsteriskResponse{
+		Body:          bytes.NewReader(attachment.Content),
+		Headers:       GetTicketAttachment200ResponseHeaders{ContentDisposition: mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+		ContentType:   attachment.ContentType,
+		ContentLength: int64(len(attachment.Content)),
+	}, nil
+}
+
+func (a *Api) SetTicketStatus(ctx context.Context, req SetTicketStatusRequestObject) (SetTicketStatusResponseObject, error) {
+	status, ok := a.workflow.ParseStatus(req.Body.Status)
+	if !ok {
+		return SetTicketStatus422JSONResponse{Code: UnknownStatus, Message: fmt.Sprintf("%s %q", domain.ErrUnknownStatus, req.Body.Status)}, nil
+	}
+
+	ticket, err := a.tickets.UpdateTicket(ctx, req.TicketId, domain.TicketUpdateParameters{
+		Status:     status,
+		Resolution: req.Body.Resolution,
+		OwnerID:    req.Body.OwnerId,
+	})
+	if errors.Is(err, domain.ErrNotFound) {
+		return SetTicketStatus404Response{}, nil
+	}
+	var workflowErr *domain.WorkflowError
+	if errors.As(err, &workflowErr) {
+		return SetTicketStatus422JSONResponse(apiWorkflowError(workflowErr)), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return SetTicketStatus200JSONResponse(a.apiTicket(ticket)), nil
+}
+
+func (a *Api) ReplyToTicket(ctx context.Context, req ReplyToTicketRequestObject) (ReplyToTicketResponseObject, error) {
+	e, err := a.replies.Reply(ctx, req.TicketId, req.Body.Body)
+	if errors.Is(err, domain.ErrNotFound) {
+		return ReplyToTicket404Response{}, nil
+	}
+	if errors.Is(err, email.ErrNoReplyAddress) || errors.Is(err, email.ErrAliasNotFound) {
+		return ReplyToTicket409Response{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ReplyToTicket201JSONResponse(apiEmail(e)), nil
+}
+
+func (a *Api) MarkTicketSpam(ctx context.Context, req MarkTicketSpamRequestObject) (MarkTicketSpamResponseObject, error) {
+	_, err := a.spam.MarkSpam(ctx, req.TicketId, req.Body.Spam)
+	if errors.Is(err, domain.ErrNotFound) {
+		return MarkTicketSpam404Response{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return MarkTicketSpam204Response{}, nil
+}
+
+func (a *Api) SetAliasRouting(ctx context.Context, req SetAliasRoutingRequestObject) (SetAliasRoutingResponseObject, error) {
+	routing := domain.AliasRouting{DefaultOwnerID: req.Body.DefaultOwnerId}
+	if req.Body.Queue != nil {
+		routing.Queue = *req.Body.Queue
+	}
+	if req.Body.Priority != nil {
+		routing.Priority = domain.ParseTicketPriority(string(*req.Body.Priority))
+	}
+	if req.Body.Tags != nil {
+		routing.Tags = *req.Body.Tags
+	}
+	if req.Body.Private != nil {
+		routing.Private = *req.Body.Private
+	}
+
+	alias, err := a.aliases.SetRouting(ctx, req.AliasId, routing)
+	if errors.Is(err, domain.ErrNotFound) {
+		return SetAliasRouting404Response{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return SetAliasRouting200JSONResponse(apiAlias(alias)), nil
+}
+
+const (
+	defaultQuarantineLimit = 50
+	maxQuarantineLimit     = 500
+)
+
+func (a *Api) GetQuarantine(ctx context.Context, req GetQuarantineRequestObject) (GetQuarantineResponseObject, error) {
+	filter := domain.QuarantineFilter{Before: req.Params.Before, Limit: defaultQuarantineLimit}
+	if req.Params.Reason != nil {
+		reason := domain.QuarantineReason(*req.Params.Reason)
+		filter.Reason = &reason
+	}
+	if req.Params.Limit != nil {
+		filter.Limit = min(max(*req.Params.Limit, 1), maxQuarantineLimit)
+	}
+
+	emails, err := a.quarantine.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	res := GetQuarantine200JSONResponse{Emails: make([]QuarantinedEmail, 0, len(emails))}
+	for _, e := range emails {
+		res.Emails = append(res.Emails, a.apiQuarantinedEmail(e))
+	}
+	return res, nil
+}
+
+func (a *Api) GetQuarantinedEmail(ctx context.Context, req GetQuarantinedEmailRequestObject) (GetQuarantinedEmailResponseObject, error) {
+	e, err := a.quarantine.Get(ctx, req.EmailId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return GetQuarantinedEmail404Response{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return GetQuarantinedEmail200JSONResponse(a.apiQuarantinedEmail(e)), nil
+}
+
+func (a *Api) ReleaseQuarantinedEmail(ctx context.Context, req ReleaseQuarantinedEmailRequestObject) (ReleaseQuarantinedEmailResponseObject, error) {
+	e, err := a.quarantine.Release(ctx, req.EmailId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return ReleaseQuarantinedEmail404Response{}, nil
+	}
+	if errors.Is(err, email.ErrAliasNotFound) {
+		return ReleaseQuarantinedEmail409Response{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ReleaseQuarantinedEmail200JSONResponse(apiEmail(e)), nil
+}
+
+func (a *Api) DeleteQuarantinedEmail(ctx context.Context, req DeleteQuarantinedEmailRequestObject) (DeleteQuarantinedEmailResponseObject, error) {
+	err := a.quarantine.Delete(ctx, req.EmailId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return DeleteQuarantinedEmail404Response{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return DeleteQuarantinedEmail204Response{}, nil
+}
+
+func (a *Api) GetDomains(ctx context.Context, req GetDomainsRequestObject) (GetDomainsResponseObject, error) {
+	domains, err := a.domains.GetDomains(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := GetDomains200JSONResponse{Domains: make([]DNSDomain, 0, len(domains))}
+	for _, d := range domains {
+		res.Domains = append(res.Domains, apiDNSDomain(d))
+	}
+	return res, nil
+}
+
+func (a *Api) CreateDomain(ctx context.Context, req CreateDomainRequestObject) (CreateDomainResponseObject, error) {
+	d, err := a.domains.CreateDomain(ctx, req.Body.Name)
+	if errors.Is(err, domain.ErrDomainExists) {
+		return CreateDomain409Response{}, nil
+	}
+	if errors.Is(err, domain.ErrInvalidDomainName) {
+		return CreateDomain422Response{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return CreateDomain201JSONResponse(apiDNSDomain(d)), nil
+}
+
+func (a *Api) GetDomain(ctx context.Context, req GetDomainRequestObject) (GetDomainResponseObject, error) {
+	d, err := a.domains.GetDomain(ctx, req.DomainId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return GetDomain404Response{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return GetDomain200JSONResponse(apiDNSDomain(d)), nil
+}
+
+func (a *Api) RenameDomain(ctx context.Context, req RenameDomainRequestObject) (RenameDomainResponseObject, error) {
+	d, err := a.domains.RenameDomain(ctx, req.DomainId, req.Body.Name)
+	if errors.Is(err, domain.ErrNotFound) {
+		return RenameDomain404Response{}, nil
+	}
+	if errors.Is(err, domain.ErrDomainExists) {
+		return RenameDomain409Response{}, nil
+	}
+	if errors.Is(err, domain.ErrInvalidDomainName) {
+		return RenameDomain422Response{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return RenameDomain200JSONResponse(apiDNSDomain(d)), nil
+}
+
+func (a *Api) DeleteDomain(ctx context.Context, req DeleteDomainRequestObject) (DeleteDomainResponseObject, error) {
+	_, err := a.domains.DeleteDomain(ctx, req.DomainId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return DeleteDomain404Response{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return DeleteDomain204Response{}, nil
+}
+
+func (a *Api) VerifyDomain(ctx context.Context, req VerifyDomainRequestObject) (VerifyDomainResponseObject, error) {
+	d, err := a.domains.VerifyDomain(ctx, req.DomainId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return VerifyDomain404Response{}, nil
+	}
+	if errors.Is(err, domain.ErrDomainNotVerified) {
+		return VerifyDomain422JSONResponse{Message: err.Error()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return VerifyDomain200JSONResponse(apiDNSDomain(d)), nil
+}
+
+func (a *Api) RegenerateVerificationToken(ctx context.Context, req RegenerateVerificationTokenRequestObject) (RegenerateVerificationTokenResponseObject, error) {
+	d, err := a.domains.RegenerateVerificationToken(ctx, req.DomainId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return RegenerateVerificationToken404Response{}, nil
+	}
+	if errors.Is(err, domain.ErrDomainVerified) {
+		return RegenerateVerificationToken409Response{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return RegenerateVerificationToken201JSONResponse(apiDNSDomain(d)), nil
+}
+
+func (a *Api) GenerateDKIMKey(ctx context.Context, req GenerateDKIMKeyRequestObject) (GenerateDKIMKeyResponseObject, error) {
+	d, err := a.domains.GenerateDKIMKey(ctx, req.DomainId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return GenerateDKIMKey404Response{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return GenerateDKIMKey201JSONResponse(apiDNSDomain(d)), nil
+}
+
+func (a *Api) GetDNSRecords(ctx context.Context, req GetDNSRecordsRequestObject) (GetDNSRecordsResponseObject, error) {
+	records, err := a.domains.DNSRecords(ctx, req.DomainId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return GetDNSRecords404Response{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := GetDNSRecords200JSONResponse{Records: make([]DNSRecord, 0, len(records))}
+	for _, r := range records {
+		res.Records = append(res.Records, DNSRecord{Type: r.Type, Name: r.Name, Value: r.Value})
+	}
+	return res, nil
+}
+
+func (a *Api) apiTicket(ticket domain.Ticket) Ticket {
+	meta := ticket.Meta()
+	res := Ticket{
+		Id:             ticket.ID,
+		Description:    meta.Description,
+		Status:         a.workflow.StatusName(meta.Status),
+		OwnerId:        meta.OwnerID,
+		Tags:           meta.Tags,
+		Fields:         meta.Fields,
+		CommentCount:   meta.Comments,
+		NoteCount:      meta.Notes,
+		LastActivityAt: meta.LastActivityAt,
+	}
+	if meta.Resolution != "" {
+		res.Resolution = &meta.Resolution
+	}
+	if !meta.LastCommentAt.IsZero() {
+		res.LastCommentAt = &meta.LastCommentAt
+	}
+	if meta.Priority != domain.TicketPriorityUnknown {
+		priority := TicketPriority(strings.ToLower(meta.Priority.String()))
+		res.Priority = &priority
+	}
+	if meta.Type != domain.TicketTypeUnknown {
+		ticketType := TicketType(strings.ToLower(meta.Type.String()))
+		res.Type = &ticketType
+	}
+	if res.Tags == nil {
+		res.Tags = []string{}
+	}
+	if res.Fields == nil {
+		res.Fields = map[string][]string{}
+	}
+	return res
+}
+
+// apiTimelineEntry sets only the fields the transition changed.
+func (a *Api) apiTimelineEntry(transition domain.TicketTransition) TimelineEntry {
+	res := TimelineEntry{
+		Timestamp:   transition.Timestamp,
+		OwnerId:     transition.OwnerID,
+		Description: transition.Description,
+		EmailId:     transition.EmailID,
+		Spam:        transition.Spam,
+		Queue:       transition.Queue,
+		Resolution:  transition.Resolution,
+	}
+	if transition.Status != domain.TicketStatusUnknown {
+		status := a.workflow.StatusName(transition.Status)
+		res.Status = &status
+	}
+	if len(transition.AddTags) > 0 {
+		res.Tags = &transition.AddTags
+	}
+	if len(transition.RemoveTags) > 0 {
+		res.RemovedTags = &transition.RemoveTags
+	}
+	if transition.Priority != domain.TicketPriorityUnknown {
+		priority := TicketPriority(strings.ToLower(transition.Priority.String()))
+		res.Priority = &priority
+	}
+	if transition.Type != domain.TicketTypeUnknown {
+		ticketType := TicketType(strings.ToLower(transition.Type.String()))
+		res.Type = &ticketType
+	}
+	if len(transition.SetFields) > 0 {
+		res.Fields = &transition.SetFields
+	}
+	if transition.Comment != nil {
+		comment := apiTicketComment(*transition.Comment)
+		res.Comment = &comment
+	}
+	return res
+}
+
+func apiTicketComment(c domain.TicketComment) TicketComment {
+	res := TicketComment{
+		Id:          c.ID,
+		AuthorId:    c.AuthorID,
+		Body:        c.Body,
+		Visibility:  CommentVisibility(strings.ToLower(c.Visibility.String())),
+		Attachments: []Attachment{},
+	}
+	for _, a := range c.Attachments {
+		res.Attachments = append(res.Attachments, Attachment{Id: a.ID, Filename: a.Filename, ContentType: a.ContentType, Size: a.Size})
+	}
+	return res
+}
+
+func apiWorkflowError(err *domain.WorkflowError) WorkflowError {
+	res := WorkflowError{Code: TransitionNotAllowed, Message: err.Error()}
+	switch {
+	case errors.Is(err, domain.ErrUnknownStatus):
+		res.Code = UnknownStatus
+	case errors.Is(err, domain.ErrFieldRequired):
+		res.Code = FieldRequired
+		field := TicketField(err.Field)
+		res.Field = &field
+	}
+	return res
+}
+
+func apiAlias(alias domain.Alias) Alias {
+	res := Alias{
+		Id:      alias.ID,
+		Address: alias.GetEmail(),
+		Routing: AliasRouting{DefaultOwnerId: alias.Routing.DefaultOwnerID},
+	}
+	if alias.Routing.Queue != "" {
+		res.Routing.Queue = &alias.Routing.Queue
+	}
+	if alias.Routing.Priority != domain.TicketPriorityUnknown {
+		priority := TicketPriority(strings.ToLower(alias.Routing.Priority.String()))
+		res.Routing.Priority = &priority
+	}
+	if len(alias.Routing.Tags) > 0 {
+		res.Routing.Tags = &alias.Routing.Tags
+	}
+	if alias.Routing.Private {
+		res.Routing.Private = &alias.Routing.Private
+	}
+	return res
+}
+
+// apiDNSDomain leaves out the private key, which never leaves the server.
+func apiDNSDomain(d domain.DNSDomain) DNSDomain {
+	res := DNSDomain{
+		Id:         d.ID,
+		Name:       d.Name,
+		Status:     Pending,
+		VerifiedAt: d.VerifiedAt,
+	}
+	if d.IsVerified() {
+		res.Status = Verified
+	}
+	if d.DKIM != nil {
+		res.DkimSelector = &d.DKIM.Selector
+	}
+	return res
+}
+
+// apiQuarantinedEmail expects the email to be in quarantine.
+func (a *Api) apiQuarantinedEmail(e domain.Email) QuarantinedEmail {
+	res := QuarantinedEmail{
+		Email:         apiEmail(e),
+		Reason:        QuarantineReason(e.Quarantine.Reason),
+		Detail:        e.Quarantine.Detail,
+		Recipients:    e.Quarantine.Recipients,
+		QuarantinedAt: e.Quarantine.QuarantinedAt,
+		ExpiresAt:     a.quarantine.ExpiresAt(*e.Quarantine),
+	}
+	if res.Recipients == nil {
+		res.Recipients = []string{}
+	}
+	return res
+}
+
+func apiEmail(e domain.Email) Email {
+	return Email{
+		Id:        e.ID,
+		TicketId:  e.TicketID,
+		MessageId: e.MessageID,
+		Subject:   e.Subject,
+		From:      e.Sender,
+		To:        e.Recipients,
+		Date:      e.Date,
+		Outbound:  e.Outbound,
+		Body:      e.TextBody,
+	}
+}
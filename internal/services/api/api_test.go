@@ -0,0 +1,452 @@
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/nil-nil/ticket/internal/services/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func TestSetTicketStatus(t *testing.T) {
+	workflow, err := domain.NewWorkflow(
+		[]domain.WorkflowStatus{{Status: 10, Name: "Waiting on customer"}},
+		[]domain.WorkflowTransition{
+			{From: []domain.TicketStatus{domain.TicketStatusOpen}, To: 10},
+			{To: domain.TicketStatusClosed, Require: []domain.TicketField{domain.TicketFieldResolution}},
+		},
+	)
+	require.NoError(t, err)
+	tickets := &mockTicketService{ticket: domain.Ticket{ID: 1, Transitions: []domain.TicketTransition{{Timestamp: time.Now(), Status: domain.TicketStatusOpen, Description: ptr.To("Printer on fire")}}}, workflow: workflow}
+	a := api.NewApi(tickets, workflow, nil, nil, nil, nil, nil, nil)
+	setStatus := func(ID uint64, body api.SetTicketStatusJSONRequestBody) api.SetTicketStatusResponseObject {
+		res, err := a.SetTicketStatus(context.Background(), api.SetTicketStatusRequestObject{TicketId: ID, Body: &body})
+		require.NoError(t, err)
+		return res
+	}
+
+	t.Run("UnknownStatus", func(t *testing.T) {
+		res := setStatus(1, api.SetTicketStatusJSONRequestBody{Status: "pending"})
+		assert.Equal(t, api.SetTicketStatus422JSONResponse{Code: api.UnknownStatus, Message: `unknown ticket status "pending"`}, res)
+	})
+
+	t.Run("NotAllowed", func(t *testing.T) {
+		res := setStatus(1, api.SetTicketStatusJSONRequestBody{Status: "blocked"})
+		assert.Equal(t, api.SetTicketStatus422JSONResponse{Code: api.TransitionNotAllowed, Message: "status change not allowed: Open to Blocked"}, res)
+	})
+
+	t.Run("FieldRequired", func(t *testing.T) {
+		res := setStatus(1, api.SetTicketStatusJSONRequestBody{Status: "closed"})
+		field := api.Resolution
+		assert.Equal(t, api.SetTicketStatus422JSONResponse{Code: api.FieldRequired, Message: "resolution is required to move from Open to Closed", Field: &field}, res)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		assert.Equal(t, api.SetTicketStatus404Response{}, setStatus(2, api.SetTicketStatusJSONRequestBody{Status: "closed"}))
+	})
+
+	t.Run("Allowed", func(t *testing.T) {
+		res := setStatus(1, api.SetTicketStatusJSONRequestBody{Status: "waiting ON customer"})
+		assert.Equal(t, api.SetTicketStatus200JSONResponse{Id: 1, Description: "Printer on fire", Status: "Waiting on customer", Tags: []string{}, Fields: map[string][]string{}, LastActivityAt: tickets.ticket.Meta().LastActivityAt}, res)
+
+		res = setStatus(1, api.SetTicketStatusJSONRequestBody{Status: "Closed", Resolution: ptr.To("Fixed")})
+		assert.Equal(t, api.SetTicketStatus200JSONResponse{Id: 1, Description: "Printer on fire", Status: "Closed", Resolution: ptr.To("Fixed"), Tags: []string{}, Fields: map[string][]string{}, LastActivityAt: tickets.ticket.Meta().LastActivityAt}, res)
+	})
+}
+
+func TestGetWorkflow(t *testing.T) {
+	workflow, err := domain.NewWorkflow(
+		[]domain.WorkflowStatus{{Status: 10, Name: "Waiting on customer"}},
+		[]domain.WorkflowTransition{{To: domain.TicketStatusClosed, Require: []domain.TicketField{domain.TicketFieldResolution}}, {From: []domain.TicketStatus{10}, To: domain.TicketStatusOpen}},
+	)
+	require.NoError(t, err)
+	a := api.NewApi(nil, workflow, nil, nil, nil, nil, nil, nil)
+
+	res, err := a.GetWorkflow(context.Background(), api.GetWorkflowRequestObject{})
+	assert.NoError(t, err)
+	assert.Equal(t, api.GetWorkflow200JSONResponse{
+		Statuses: []api.WorkflowStatus{{Id: 1, Name: "Open"}, {Id: 2, Name: "In Progress"}, {Id: 3, Name: "Blocked"}, {Id: 4, Name: "Closed"}, {Id: 10, Name: "Waiting on customer"}},
+		Transitions: []api.WorkflowTransition{
+			{From: []string{}, To: "Closed", Require: []api.TicketField{api.Resolution}},
+			{From: []string{"Waiting on customer"}, To: "Open", Require: []api.TicketField{}},
+		},
+	}, res)
+}
+
+func TestTicketComments(t *testing.T) {
+	opened := time.Now().Add(-1 * time.Hour)
+	tickets := &mockTicketService{ticket: domain.Ticket{ID: 1, Transitions: []domain.TicketTransition{{Timestamp: opened, Status: domain.TicketStatusOpen, Description: ptr.To("Printer on fire")}}}, workflow: domain.DefaultWorkflow()}
+	a := api.NewApi(tickets, domain.DefaultWorkflow(), nil, nil, nil, nil, nil, nil)
+	author := domain.User{ID: 7, FirstName: "Alice"}
+
+	// Comments are written by the logged in user, so they're added through the auth middleware
+	addComment := func(ID uint64, body api.AddTicketCommentJSONRequestBody) api.AddTicketCommentResponseObject {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+			return a.AddTicketComment(ctx.Request().Context(), api.AddTicketCommentRequestObject{TicketId: ID, Body: &body})
+		}
+		res, err := api.AuthMiddleware(userAuthProvider{user: author})(handler, "addTicketComment")(echo.New().NewContext(req, httptest.NewRecorder()), nil)
+		require.NoError(t, err)
+		return res.(api.AddTicketCommentResponseObject)
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		res := addComment(1, api.AddTicketCommentJSONRequestBody{Visibility: api.Public, Body: ptr.To(" ")})
+		assert.Equal(t, api.AddTicketComment422JSONResponse{Message: "invalid comment: comment is empty"}, res)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		assert.Equal(t, api.AddTicketComment404Response{}, addComment(2, api.AddTicketCommentJSONRequestBody{Visibility: api.Public, Body: ptr.To("Hi")}))
+	})
+
+	t.Run("Reply", func(t *testing.T) {
+		res := addComment(1, api.AddTicketCommentJSONRequestBody{Visibility: api.Public, Body: ptr.To("Have you tried water?")})
+		assert.Equal(t, api.AddTicketComment201JSONResponse{Id: 1, AuthorId: 7, Body: "Have you tried water?", Visibility: api.Public, Attachments: []api.Attachment{}}, res)
+	})
+
+	t.Run("NoteWithAttachment", func(t *testing.T) {
+		res := addComment(1, api.AddTicketCommentJSONRequestBody{
+			Visibility:  api.Internal,
+			Body:        ptr.To("Fire brigade report attached"),
+			Attachments: &[]api.NewAttachment{{Filename: "report.txt", Content: []byte("all clear")}},
+		})
+		assert.Equal(t, api.AddTicketComment201JSONResponse{
+			Id:          2,
+			AuthorId:    7,
+			Body:        "Fire brigade report attached",
+			Visibility:  api.Internal,
+			Attachments: []api.Attachment{{Id: 1, Filename: "report.txt", ContentType: "application/octet-stream", Size: 9}},
+		}, res)
+	})
+
+	t.Run("GetTicket", func(t *testing.T) {
+		res, err := a.GetTicket(context.Background(), api.GetTicketRequestObject{TicketId: 1})
+		require.NoError(t, err)
+		ticket, ok := res.(api.GetTicket200JSONResponse)
+		require.True(t, ok)
+		assert.Equal(t, 1, ticket.CommentCount)
+		assert.Equal(t, 1, ticket.NoteCount)
+		assert.Equal(t, tickets.ticket.Transitions[2].Timestamp, ticket.LastActivityAt)
+		assert.Equal(t, &tickets.ticket.Transitions[2].Timestamp, ticket.LastCommentAt)
+
+		res, err = a.GetTicket(context.Background(), api.GetTicketRequestObject{TicketId: 2})
+		assert.NoError(t, err)
+		assert.Equal(t, api.GetTicket404Response{}, res)
+	})
+
+	t.Run("GetTicketTimeline", func(t *testing.T) {
+		res, err := a.GetTicketTimeline(context.Background(), api.GetTicketTimelineRequestObject{TicketId: 1})
+		require.NoError(t, err)
+		timeline, ok := res.(api.GetTicketTimeline200JSONResponse)
+		require.True(t, ok)
+		require.Len(t, timeline.Entries, 3)
+		assert.Equal(t, api.TimelineEntry{Timestamp: opened, Status: ptr.To("Open"), Description: ptr.To("Printer on fire")}, timeline.Entries[0])
+		assert.Equal(t, "Have you tried water?", timeline.Entries[1].Comment.Body)
+		assert.Nil(t, timeline.Entries[1].Status, "entries should only set what changed")
+		assert.Equal(t, api.Internal, timeline.Entries[2].Comment.Visibility)
+	})
+
+	t.Run("GetTicketAttachment", func(t *testing.T) {
+		res, err := a.GetTicketAttachment(context.Background(), api.GetTicketAttachmentRequestObject{TicketId: 1, AttachmentId: 1})
+		require.NoError(t, err)
+		rec := httptest.NewRecorder()
+		require.NoError(t, res.VisitGetTicketAttachmentResponse(rec))
+		assert.Equal(t, "all clear", rec.Body.String())
+		assert.Equal(t, "application/octet-stream", rec.Header().Get("Content-Type"))
+		assert.Equal(t, "attachment; filename=report.txt", rec.Header().Get("Content-Disposition"))
+
+		res, err = a.GetTicketAttachment(context.Background(), api.GetTicketAttachmentRequestObject{TicketId: 1, AttachmentId: 2})
+		assert.NoError(t, err)
+		assert.Equal(t, api.GetTicketAttachment404Response{}, res)
+	})
+}
+
+func TestTriageTickets(t *testing.T) {
+	fields, err := domain.NewCustomFields([]domain.CustomFieldDefinition{
+		{Key: "product_area", Name: "Product area", Type: domain.CustomFieldSelect, Options: []string{"Billing", "API"}},
+		{Key: "seats", Name: "Seats", Type: domain.CustomFieldNumber},
+	})
+	require.NoError(t, err)
+	tickets := &mockTicketService{ticket: domain.Ticket{ID: 1, Transitions: []domain.TicketTransition{{Timestamp: time.Now(), Status: domain.TicketStatusOpen, Description: ptr.To("Printer on fire")}}}, workflow: domain.DefaultWorkflow(), fields: fields}
+	a := api.NewApi(tickets, domain.DefaultWorkflow(), fields, nil, nil, nil, nil, nil)
+
+	t.Run("GetCustomFields", func(t *testing.T) {
+		res, err := a.GetCustomFields(context.Background(), api.GetCustomFieldsRequestObject{})
+		assert.NoError(t, err)
+		assert.Equal(t, api.GetCustomFields200JSONResponse{Fields: []api.CustomField{
+			{Key: "product_area", Name: "Product area", Type: api.Select, Options: []string{"Billing", "API"}},
+			{Key: "seats", Name: "Seats", Type: api.Number, Options: []string{}},
+		}}, res)
+	})
+
+	t.Run("UpdateTicket", func(t *testing.T) {
+		update := func(body api.UpdateTicketJSONRequestBody) api.UpdateTicketResponseObject {
+			res, err := a.UpdateTicket(context.Background(), api.UpdateTicketRequestObject{TicketId: 1, Body: &body})
+			require.NoError(t, err)
+			return res
+		}
+
+		res := update(api.UpdateTicketJSONRequestBody{Fields: &map[string][]string{"seats": {"lots"}}})
+		assert.Equal(t, api.UpdateTicket422JSONResponse{Message: "invalid field value: seats must be a number"}, res)
+
+		update(api.UpdateTicketJSONRequestBody{
+			Priority: ptr.To(api.Urgent),
+			Type:     ptr.To(api.Incident),
+			AddTags:  &[]string{"vip", "outage"},
+			Fields:   &map[string][]string{"product_area": {"api"}},
+		})
+		res = update(api.UpdateTicketJSONRequestBody{RemoveTags: &[]string{"outage"}})
+		ticket, ok := res.(api.UpdateTicket200JSONResponse)
+		require.True(t, ok)
+		assert.Equal(t, ptr.To(api.Urgent), ticket.Priority)
+		assert.Equal(t, ptr.To(api.Incident), ticket.Type)
+		assert.Equal(t, []string{"vip"}, ticket.Tags)
+		assert.Equal(t, map[string][]string{"product_area": {"API"}}, ticket.Fields)
+
+		res, err = a.UpdateTicket(context.Background(), api.UpdateTicketRequestObject{TicketId: 2, Body: &api.UpdateTicketJSONRequestBody{}})
+		assert.NoError(t, err)
+		assert.Equal(t, api.UpdateTicket404Response{}, res)
+	})
+
+	t.Run("ListTickets", func(t *testing.T) {
+		res, err := a.ListTickets(context.Background(), api.ListTicketsRequestObject{Params: api.ListTicketsParams{
+			Status:   &[]string{"open", "In Progress"},
+			Priority: &[]api.TicketPriority{api.High, api.Urgent},
+			Type:     &[]api.TicketType{api.Incident},
+			Tag:      &[]string{"vip"},
+			Field:    &[]string{"product_area:API", "seats: 10"},
+			Queue:    ptr.To(""),
+		}})
+		assert.NoError(t, err)
+		list, ok := res.(api.ListTickets200JSONResponse)
+		require.True(t, ok)
+		if assert.Len(t, list.Tickets, 1) {
+			assert.Equal(t, uint64(1), list.Tickets[0].Id)
+		}
+		assert.Equal(t, domain.TicketFilter{
+			Statuses:   []domain.TicketStatus{domain.TicketStatusOpen, domain.TicketStatusInProgress},
+			Priorities: []domain.TicketPriority{domain.TicketPriorityHigh, domain.TicketPriorityUrgent},
+			Types:      []domain.TicketType{domain.TicketTypeIncident},
+			Queue:      ptr.To(""),
+			Tags:       []string{"vip"},
+			Fields:     map[string]string{"product_area": "API", "seats": " 10"},
+		}, tickets.filter)
+
+		res, err = a.ListTickets(context.Background(), api.ListTicketsRequestObject{Params: api.ListTicketsParams{Type: &[]api.TicketType{api.Task}}})
+		assert.NoError(t, err)
+		assert.Equal(t, api.ListTickets200JSONResponse{Tickets: []api.Ticket{}}, res)
+
+		table := []struct {
+			name   string
+			params api.ListTicketsParams
+			expect string
+		}{
+			{name: "UnknownStatus", params: api.ListTicketsParams{Status: &[]string{"pending"}}, expect: `unknown ticket status "pending"`},
+			{name: "MalformedField", params: api.ListTicketsParams{Field: &[]string{"product_area"}}, expect: `field filter "product_area" must be written as key:value`},
+			{name: "UnknownField", params: api.ListTicketsParams{Field: &[]string{"colour:red"}}, expect: `unknown custom field: "colour"`},
+		}
+		for _, tc := range table {
+			t.Run(tc.name, func(t *testing.T) {
+				res, err := a.ListTickets(context.Background(), api.ListTicketsRequestObject{Params: tc.params})
+				assert.NoError(t, err)
+				assert.Equal(t, api.ListTickets422JSONResponse{Message: tc.expect}, res)
+			})
+		}
+	})
+}
+
+func TestSearchTickets(t *testing.T) {
+	tickets := &mockTicketService{ticket: domain.Ticket{ID: 1, Transitions: []domain.TicketTransition{{Timestamp: time.Now(), Status: domain.TicketStatusOpen, Description: ptr.To("Printer on fire")}}}, workflow: domain.DefaultWorkflow()}
+	a := api.NewApi(tickets, domain.DefaultWorkflow(), nil, nil, nil, nil, nil, nil)
+	user := domain.User{ID: 7, FirstName: "Alice"}
+
+	// Queries like owner:me are resolved for the logged in user, so searches go through the auth middleware
+	search := func(params api.SearchTicketsParams) api.SearchTicketsResponseObject {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		handler := func(ctx echo.Context, request interface{}) (interface{}, error) {
+			return a.SearchTickets(ctx.Request().Context(), api.SearchTicketsRequestObject{Params: params})
+		}
+		res, err := api.AuthMiddleware(userAuthProvider{user: user})(handler, "searchTickets")(echo.New().NewContext(req, httptest.NewRecorder()), nil)
+		require.NoError(t, err)
+		return res.(api.SearchTicketsResponseObject)
+	}
+
+	res := search(api.SearchTicketsParams{Q: ptr.To("printer"), Limit: ptr.To(1)})
+	page, ok := res.(api.SearchTickets200JSONResponse)
+	require.True(t, ok)
+	if assert.Len(t, page.Tickets, 1) {
+		assert.Equal(t, uint64(1), page.Tickets[0].Id)
+	}
+	assert.Equal(t, ptr.To("next"), page.NextCursor)
+	assert.Equal(t, &map[string][]api.TextMatch{"1": {{
+		Source:   api.TextMatchSourceDescription,
+		SourceId: 0,
+		Snippet:  []api.TextFragment{{Text: "Printer on fire", Highlighted: true}},
+	}}}, page.Matches, "matches should be keyed by ticket ID")
+	assert.Equal(t, domain.TicketQuery{TicketFilter: domain.TicketFilter{OwnerID: &user.ID}, Text: "printer", Limit: 1}, tickets.query)
+
+	res = search(api.SearchTicketsParams{Q: ptr.To("printer"), Cursor: page.NextCursor})
+	assert.Equal(t, api.SearchTickets200JSONResponse{Tickets: []api.Ticket{}}, res, "the last page should have no cursor")
+	assert.Equal(t, "next", tickets.query.Cursor)
+
+	table := []struct {
+		name   string
+		params api.SearchTicketsParams
+		expect string
+	}{
+		{name: "InvalidQuery", params: api.SearchTicketsParams{Q: ptr.To("status:resolved")}, expect: `invalid query: status "resolved" is not a status`},
+		{name: "InvalidCursor", params: api.SearchTicketsParams{Cursor: ptr.To("garbage")}, expect: "invalid cursor: malformed"},
+	}
+	for _, tc := range table {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, api.SearchTickets422JSONResponse{Message: tc.expect}, search(tc.params))
+		})
+	}
+}
+
+type userAuthProvider struct {
+	mockAuthProvider
+	user domain.User
+}
+
+func (p userAuthProvider) GetUser(_ context.Context, _ string) (domain.User, error) {
+	return p.user, nil
+}
+
+type mockTicketService struct {
+	ticket   domain.Ticket
+	workflow *domain.Workflow
+	fields   *domain.CustomFields
+	// filter is the last filter tickets were listed by
+	filter domain.TicketFilter
+	// query is the last query tickets were searched by
+	query domain.TicketQuery
+}
+
+func (m *mockTicketService) UpdateTicket(ctx context.Context, ID uint64, Params domain.TicketUpdateParameters) (domain.Ticket, error) {
+	if ID != m.ticket.ID {
+		return domain.Ticket{}, domain.ErrNotFound
+	}
+	if err := m.workflow.Check(m.ticket.Meta().Status, Params); err != nil {
+		return domain.Ticket{}, err
+	}
+	if m.fields != nil && len(Params.SetFields) > 0 {
+		fields, err := m.fields.Normalize(Params.SetFields)
+		if err != nil {
+			return domain.Ticket{}, err
+		}
+		Params.SetFields = fields
+	}
+	// Transitions are a step apart so the latest wins
+	timestamp := m.ticket.Transitions[len(m.ticket.Transitions)-1].Timestamp.Add(1)
+	m.ticket.Transitions = append(m.ticket.Transitions, domain.TicketTransition{
+		Timestamp:  timestamp,
+		Status:     Params.Status,
+		Resolution: Params.Resolution,
+		OwnerID:    Params.OwnerID,
+		Comment:    Params.Comment,
+		Priority:   Params.Priority,
+		Type:       Params.Type,
+		AddTags:    Params.AddTags,
+		RemoveTags: Params.RemoveTags,
+		SetFields:  Params.SetFields,
+	})
+	return m.ticket, nil
+}
+
+// ListTickets records the filter, returning the one ticket if it has a type the filter matches.
+func (m *mockTicketService) ListTickets(ctx context.Context, filter domain.TicketFilter) ([]domain.Ticket, error) {
+	m.filter = filter
+	if _, ok := filter.Fields["colour"]; ok {
+		return nil, fmt.Errorf("%w: %q", domain.ErrUnknownCustomField, "colour")
+	}
+	if len(filter.Types) > 0 && !slices.Contains(filter.Types, m.ticket.Meta().Type) {
+		return []domain.Ticket{}, nil
+	}
+	return []domain.Ticket{m.ticket}, nil
+}
+
+// ParseQuery searches for the input as text on behalf of the user, refusing queries with a status.
+func (m *mockTicketService) ParseQuery(input string, userID uint64) (domain.TicketQuery, error) {
+	if strings.Contains(input, "status:") {
+		return domain.TicketQuery{}, fmt.Errorf("%w: status %q is not a status", domain.ErrInvalidQuery, "resolved")
+	}
+	return domain.TicketQuery{TicketFilter: domain.TicketFilter{OwnerID: &userID}, Text: input}, nil
+}
+
+// SearchTickets records the query, returning the one ticket with a cursor to an empty next page.
+func (m *mockTicketService) SearchTickets(ctx context.Context, query domain.TicketQuery) (domain.TicketPage, error) {
+	m.query = query
+	switch query.Cursor {
+	case "":
+		page := domain.TicketPage{Tickets: []domain.Ticket{m.ticket}, NextCursor: "next"}
+		if query.Text != "" {
+			page.Matches = map[uint64][]domain.TextMatch{m.ticket.ID: {{
+				Source:  domain.TextSourceDescription,
+				Snippet: []domain.TextFragment{{Text: m.ticket.Meta().Description, Highlighted: true}},
+			}}}
+		}
+		return page, nil
+	case "next":
+		return domain.TicketPage{}, nil
+	}
+	return domain.TicketPage{}, fmt.Errorf("%w: malformed", domain.ErrInvalidCursor)
+}
+
+func (m *mockTicketService) GetTicket(ctx context.Context, ID uint64) (domain.Ticket, error) {
+	if ID != m.ticket.ID {
+		return domain.Ticket{}, domain.ErrNotFound
+	}
+	return m.ticket, nil
+}
+
+// AddComment numbers comments and attachments in the order they're added, keeping the attachments' content.
+func (m *mockTicketService) AddComment(ctx context.Context, ID uint64, comment domain.TicketComment) (domain.Ticket, error) {
+	if err := comment.Validate(); err != nil {
+		return domain.Ticket{}, err
+	}
+	var comments, attachments uint64
+	for _, transition := range m.ticket.Transitions {
+		if transition.Comment != nil {
+			comments++
+			attachments += uint64(len(transition.Comment.Attachments))
+		}
+	}
+	comment.ID = comments + 1
+	for i := range comment.Attachments {
+		comment.Attachments[i].ID = attachments + uint64(i) + 1
+		comment.Attachments[i].CommentID = comment.ID
+		comment.Attachments[i].Size = int64(len(comment.Attachments[i].Content))
+	}
+	return m.UpdateTicket(ctx, ID, domain.TicketUpdateParameters{Comment: &comment})
+}
+
+func (m *mockTicketService) GetCommentAttachment(ctx context.Context, ticketID uint64, ID uint64) (domain.Attachment, error) {
+	ticket, err := m.GetTicket(ctx, ticketID)
+	if err != nil {
+		return domain.Attachment{}, err
+	}
+	for _, transition := range ticket.Transitions {
+		if transition.Comment == nil {
+			continue
+		}
+		for _, attachment := range transition.Comment.Attachments {
+			if attachment.ID == ID {
+				return attachment, nil
+			}
+		}
+	}
+	return domain.Attachment{}, domain.ErrNotFound
+}
@@ -15,6 +15,25 @@ var userMiddlewareValue = userMiddlewareValueType{}
 
 var tokenRegex = regexp.MustCompile("Bearer (.*)")
 
+// adminOperations are the operations only admins may call, as they manage mail for everyone
+var adminOperations = map[string]bool{
+	"GetQuarantine":               true,
+	"GetQuarantinedEmail":         true,
+	"DeleteQuarantinedEmail":      true,
+	"ReleaseQuarantinedEmail":     true,
+	"GetDomains":                  true,
+	"CreateDomain":                true,
+	"GetDomain":                   true,
+	"RenameDomain":                true,
+	"DeleteDomain":                true,
+	"VerifyDomain":                true,
+	"RegenerateVerificationToken": true,
+	"GenerateDKIMKey":             true,
+	"GetDNSRecords":               true,
+}
+
+// AuthMiddleware sets the user the request's bearer token belongs to on the context, refusing admin operations to other users.
+
 func AuthMiddleware(authProvider AuthProvider) runtime.StrictEchoMiddlewareFunc {
 	return func(f runtime.StrictEchoHandlerFunc, operationID string) runtime.StrictEchoHandlerFunc {
 		return func(echoCtx echo.Context, request interface{}) (response interface{}, err error) {
@@ -32,6 +51,9 @@ func AuthMiddleware(authProvider AuthProvider) runtime.StrictEchoMiddlewareFunc
 			if err != nil {
 				return echoCtx.NoContent(http.StatusUnauthorized), nil
 			}
+			if adminOperations[operationID] && !user.Admin {
+				return echoCtx.NoContent(http.StatusForbidden), nil
+			}
 
 			ctxWithUser := context.WithValue(echoCtx.Request().Context(), userMiddlewareValue, user)
 
@@ -17,7 +17,9 @@ func mockHandlerFunc(ctx echo.Context, request interface{}) (response interface{
 	return ctx.JSON(http.StatusOK, nil), nil
 }
 
-type mockAuthProvider struct{}
+type mockAuthProvider struct {
+	user domain.User
+}
 
 func (p mockAuthProvider) NewToken(_ domain.User) (token string, err error) {
 	return "", nil
@@ -28,7 +30,7 @@ func (p mockAuthProvider) ValidateToken(_ string) (err error) {
 }
 
 func (p mockAuthProvider) GetUser(_ context.Context, _ string) (user domain.User, err error) {
-	return domain.User{}, nil
+	return p.user, nil
 }
 
 var table = []struct {
@@ -63,3 +65,20 @@ func TestAuthMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthMiddlewareAdminOperations(t *testing.T) {
+	e := echo.New()
+	serve := func(user domain.User, operationID string) int {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("Authorization", "Bearer 8723082470245709425")
+		res := httptest.NewRecorder()
+		_, err := api.AuthMiddleware(mockAuthProvider{user: user})(mockHandlerFunc, operationID)(e.NewContext(req, res), nil)
+		assert.NoError(t, err)
+		return res.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve(domain.User{ID: 1}, "GetQuarantine"), "users shouldn't review the quarantine")
+	assert.Equal(t, http.StatusForbidden, serve(domain.User{ID: 1}, "GenerateDKIMKey"), "users shouldn't manage domains")
+	assert.Equal(t, http.StatusOK, serve(domain.User{ID: 1, Admin: true}, "GetQuarantine"), "admins should review the quarantine")
+	assert.Equal(t, http.StatusOK, serve(domain.User{ID: 1}, "GetTicket"), "users should work on tickets")
+}
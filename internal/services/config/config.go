@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/nil-nil/ticket/internal/domain"
 	"gopkg.in/yaml.v3"
 )
 
@@ -22,6 +25,198 @@ type Config struct {
 			PrivateKey    string `yaml:"privateKey"`
 		} `yaml:"jwt"`
 	} `yaml:"auth"`
+	Database struct {
+		Driver string `yaml:"driver"`
+		DSN    string `yaml:"dsn"`
+	} `yaml:"database"`
+	// Outbound is the SMTP submission server replies are sent through
+	Outbound struct {
+		Address  string `yaml:"address"`
+		Hostname string `yaml:"hostname"`
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+		TLS      string `yaml:"tls"`
+	} `yaml:"outbound"`
+	// Domains configures how the domains we handle mail for are verified
+	Domains struct {
+		// MXHosts are the hosts a domain's MX records must point to, one of them at least, for it to pass verification. Empty skips the MX check
+		MXHosts []string `yaml:"mxHosts"`
+	} `yaml:"domains"`
+	// Workflow configures the statuses tickets move through, and which status changes are allowed
+	Workflow struct {
+		// Statuses are added to Open, In Progress, Blocked and Closed. They're stored by ID, which must be above 4 and never reused
+		Statuses []WorkflowStatus `yaml:"statuses"`
+		// Transitions are the status changes allowed, by status name. Without any, every status change is allowed
+		Transitions []WorkflowTransition `yaml:"transitions"`
+	} `yaml:"workflow"`
+	// CustomFields are the fields added to tickets, in the order they're shown
+	CustomFields []CustomField `yaml:"customFields"`
+	// Quarantine configures the inbound mail held for admins to review
+	Quarantine struct {
+		// Retention is how long unreviewed mail is kept before it's deleted, zero keeps the default of 30 days
+		Retention time.Duration `yaml:"retention"`
+	} `yaml:"quarantine"`
+	// SMTP is the server inbound mail and submissions are received by
+	SMTP struct {
+		// Hostname is the name the server greets clients with and records authentication results under
+		Hostname string `yaml:"hostname"`
+		// Listen is the addresses of each listener. An omitted list uses the standard port, an empty one disables the listener
+		Listen struct {
+			// MX receives mail from other servers, on :25 by default
+			MX []string `yaml:"mx"`
+			// Submission receives mail from agents with STARTTLS, on :587 by default
+			Submission []string `yaml:"submission"`
+			// SubmissionTLS receives mail from agents with implicit TLS, on :465 by default
+			SubmissionTLS []string `yaml:"submissionTLS"`
+			// LMTP receives mail handed over by another MTA, on TCP addresses or "unix:" socket paths. It's disabled by default
+			LMTP []string `yaml:"lmtp"`
+			// SocketGroup is the group, by name or ID, allowed to connect to "unix:" sockets along with our user. Empty keeps our own group
+			SocketGroup string `yaml:"socketGroup"`
+		} `yaml:"listen"`
+		// Limits on each message, zero uses the server's defaults
+		Limits struct {
+			MaxMessageBytes int64 `yaml:"maxMessageBytes"`
+			MaxRecipients   int   `yaml:"maxRecipients"`
+		} `yaml:"limits"`
+		// Timeouts bound each read from and write to a client, and how long shutdown waits for sessions to finish. Zero uses the defaults
+		Timeouts struct {
+			Read     time.Duration `yaml:"read"`
+			Write    time.Duration `yaml:"write"`
+			Shutdown time.Duration `yaml:"shutdown"`
+		} `yaml:"timeouts"`
+		// RateLimits cap what each client IP and envelope sender may do on the MX and submission listeners. Omitted limits are unlimited
+		RateLimits struct {
+			// ConnectionsPerIP is how many sessions a client IP may have open at once
+			ConnectionsPerIP int       `yaml:"connectionsPerIP"`
+			IPConnections    RateLimit `yaml:"ipConnections"`
+			IPMessages       RateLimit `yaml:"ipMessages"`
+			IPRecipients     RateLimit `yaml:"ipRecipients"`
+			SenderMessages   RateLimit `yaml:"senderMessages"`
+			SenderRecipients RateLimit `yaml:"senderRecipients"`
+		} `yaml:"rateLimits"`
+		// MetricsAddress serves the server's counters as JSON at /debug/vars, disabled when empty
+		MetricsAddress string `yaml:"metricsAddress"`
+
+		TLS struct {
+			// CertFile and KeyFile are PEM files enabling STARTTLS, and the submission ports
+			CertFile string `yaml:"certFile"`
+			KeyFile  string `yaml:"keyFile"`
+			// ReloadInterval is how often the files are checked for a renewed certificate, zero disables reloading
+			ReloadInterval time.Duration `yaml:"reloadInterval"`
+			// AllowInsecureAuth allows AUTH without TLS, by default it must be negotiated first
+			AllowInsecureAuth bool `yaml:"allowInsecureAuth"`
+		} `yaml:"tls"`
+		// AuthPolicy is what to do with inbound mail failing SPF, DKIM or DMARC: none, flag, quarantine, reject, or dmarc to follow the sender's DMARC policy
+		AuthPolicy struct {
+			SPF   string `yaml:"spf"`
+			DKIM  string `yaml:"dkim"`
+			DMARC string `yaml:"dmarc"`
+		} `yaml:"authPolicy"`
+		// Spam configures the filters scoring mail received on the MX listeners
+		Spam struct {
+			Disabled bool `yaml:"disabled"`
+			// Tag, Quarantine and Reject are the scores from which mail is tagged, quarantined or refused. Omitted ones keep their defaults, zero disables the action
+			Tag        *float64 `yaml:"tag"`
+			Quarantine *float64 `yaml:"quarantine"`
+			Reject     *float64 `yaml:"reject"`
+			// DNSBL is the blocklists client IPs are looked up in
+			DNSBL []DNSBLZone `yaml:"dnsbl"`
+			// Bayes tunes the classifier trained by agents marking tickets as spam, zero keeps the defaults
+			Bayes struct {
+				Weight      float64 `yaml:"weight"`
+				MinTraining int     `yaml:"minTraining"`
+			} `yaml:"bayes"`
+		} `yaml:"spam"`
+	} `yaml:"smtp"`
+}
+
+// DNSBLZone is a DNS blocklist and the score of clients listed in it
+type DNSBLZone struct {
+	Zone  string  `yaml:"zone"`
+	Score float64 `yaml:"score"`
+}
+
+// WorkflowStatus is a custom ticket status
+type WorkflowStatus struct {
+	ID   int    `yaml:"id"`
+	Name string `yaml:"name"`
+}
+
+// WorkflowTransition allows tickets to move to a status from the From statuses, or from any if it's empty, provided the fields in Require are set
+type WorkflowTransition struct {
+	From    []string `yaml:"from"`
+	To      string   `yaml:"to"`
+	Require []string `yaml:"require"`
+}
+
+// TicketWorkflow builds the configured workflow, resolving its transitions' status names.
+func (c Config) TicketWorkflow() (*domain.Workflow, error) {
+	statuses := make([]domain.WorkflowStatus, 0, len(c.Workflow.Statuses))
+	for _, status := range c.Workflow.Statuses {
+		statuses = append(statuses, domain.WorkflowStatus{Status: domain.TicketStatus(status.ID), Name: status.Name})
+	}
+	named, err := domain.NewWorkflow(statuses, nil)
+	if err != nil {
+		return nil, err
+	}
+	parse := func(name string) (domain.TicketStatus, error) {
+		status, ok := named.ParseStatus(name)
+		if !ok {
+			return domain.TicketStatusUnknown, fmt.Errorf("%w: unknown status %q", domain.ErrInvalidWorkflow, name)
+		}
+		return status, nil
+	}
+
+	transitions := make([]domain.WorkflowTransition, 0, len(c.Workflow.Transitions))
+	for _, t := range c.Workflow.Transitions {
+		transition := domain.WorkflowTransition{}
+		if transition.To, err = parse(t.To); err != nil {
+			return nil, err
+		}
+		for _, name := range t.From {
+			from, err := parse(name)
+			if err != nil {
+				return nil, err
+			}
+			transition.From = append(transition.From, from)
+		}
+		for _, field := range t.Require {
+			transition.Require = append(transition.Require, domain.TicketField(field))
+		}
+		transitions = append(transitions, transition)
+	}
+
+	return domain.NewWorkflow(statuses, transitions)
+}
+
+// CustomField is a ticket field. Its Key is stored with tickets, so it must never be reused for another field
+type CustomField struct {
+	Key  string `yaml:"key"`
+	Name string `yaml:"name"`
+	// Type is one of text, number, date, select or multiselect
+	Type string `yaml:"type"`
+	// Options are the values select and multiselect fields can take
+	Options []string `yaml:"options"`
+}
+
+// TicketCustomFields builds the configured custom fields.
+func (c Config) TicketCustomFields() (*domain.CustomFields, error) {
+	definitions := make([]domain.CustomFieldDefinition, 0, len(c.CustomFields))
+	for _, f := range c.CustomFields {
+		definitions = append(definitions, domain.CustomFieldDefinition{
+			Key:     f.Key,
+			Name:    f.Name,
+			Type:    domain.CustomFieldType(strings.ToLower(f.Type)),
+			Options: f.Options,
+		})
+	}
+	return domain.NewCustomFields(definitions)
+}
+
+// RateLimit allows Count events every Per
+type RateLimit struct {
+	Count int           `yaml:"count"`
+	Per   time.Duration `yaml:"per"`
 }
 
 func GetConfig(r io.Reader) (Config, error) {
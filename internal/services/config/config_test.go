@@ -3,7 +3,9 @@ package config_test
 import (
 	"bytes"
 	"testing"
+	"time"
 
+	"github.com/nil-nil/ticket/internal/domain"
 	"github.com/nil-nil/ticket/internal/services/config"
 	"github.com/stretchr/testify/assert"
 )
@@ -37,7 +39,54 @@ func TestYamlConfig(t *testing.T) {
 				PrivateKey:    "testPrivateKey\n67890\n",
 			},
 		},
+		Database: struct {
+			Driver string `yaml:"driver"`
+			DSN    string `yaml:"dsn"`
+		}{
+			Driver: "sqlite",
+			DSN:    "ticket.db",
+		},
+	}
+	structConfig.Outbound.Address = "smtp.example.com:587"
+	structConfig.Outbound.Hostname = "ticket.example.com"
+	structConfig.Outbound.Username = "ticket"
+	structConfig.Outbound.Password = "secret"
+	structConfig.Outbound.TLS = "starttls"
+	structConfig.SMTP.Hostname = "mx.example.com"
+	structConfig.Domains.MXHosts = []string{"mx.example.com"}
+	structConfig.Quarantine.Retention = 14 * 24 * time.Hour
+	structConfig.Workflow.Statuses = []config.WorkflowStatus{{ID: 10, Name: "Waiting on customer"}}
+	structConfig.Workflow.Transitions = []config.WorkflowTransition{
+		{From: []string{"open", "waiting on customer"}, To: "in progress", Require: []string{"owner"}},
+		{To: "closed", Require: []string{"resolution"}},
 	}
+	structConfig.CustomFields = []config.CustomField{
+		{Key: "product_area", Name: "Product area", Type: "select", Options: []string{"Billing", "API"}},
+		{Key: "renewal", Name: "Renewal date", Type: "date"},
+	}
+	structConfig.SMTP.Listen.MX = []string{":25", "[::1]:2525"}
+	structConfig.SMTP.Listen.SubmissionTLS = []string{}
+	structConfig.SMTP.Listen.LMTP = []string{"unix:/run/ticket/lmtp.sock"}
+	structConfig.SMTP.Limits.MaxMessageBytes = 26214400
+	structConfig.SMTP.Limits.MaxRecipients = 100
+	structConfig.SMTP.Timeouts.Read = time.Minute
+	structConfig.SMTP.Timeouts.Write = time.Minute
+	structConfig.SMTP.Timeouts.Shutdown = 30 * time.Second
+	structConfig.SMTP.RateLimits.ConnectionsPerIP = 10
+	structConfig.SMTP.RateLimits.IPMessages = config.RateLimit{Count: 60, Per: time.Hour}
+	structConfig.SMTP.RateLimits.SenderRecipients = config.RateLimit{Count: 500, Per: 24 * time.Hour}
+	structConfig.SMTP.MetricsAddress = "127.0.0.1:9025"
+	structConfig.SMTP.TLS.CertFile = "/etc/ticket/cert.pem"
+	structConfig.SMTP.TLS.KeyFile = "/etc/ticket/key.pem"
+	structConfig.SMTP.TLS.ReloadInterval = time.Hour
+	structConfig.SMTP.AuthPolicy.SPF = "reject"
+	structConfig.SMTP.AuthPolicy.DKIM = "quarantine"
+	structConfig.SMTP.AuthPolicy.DMARC = "dmarc"
+	reject, quarantine := 15.0, 0.0
+	structConfig.SMTP.Spam.Reject = &reject
+	structConfig.SMTP.Spam.Quarantine = &quarantine
+	structConfig.SMTP.Spam.DNSBL = []config.DNSBLZone{{Zone: "zen.spamhaus.org", Score: 5}}
+	structConfig.SMTP.Spam.Bayes.MinTraining = 50
 
 	yamlConfig := `
 httpServer:
@@ -53,6 +102,79 @@ auth:
     privateKey: |
       testPrivateKey
       67890
+database:
+  driver: sqlite
+  dsn: ticket.db
+outbound:
+  address: smtp.example.com:587
+  hostname: ticket.example.com
+  username: ticket
+  password: secret
+  tls: starttls
+domains:
+  mxHosts:
+    - mx.example.com
+quarantine:
+  retention: 336h
+workflow:
+  statuses:
+    - id: 10
+      name: Waiting on customer
+  transitions:
+    - from: [open, waiting on customer]
+      to: in progress
+      require: [owner]
+    - to: closed
+      require: [resolution]
+customFields:
+  - key: product_area
+    name: Product area
+    type: select
+    options: [Billing, API]
+  - key: renewal
+    name: Renewal date
+    type: date
+smtp:
+  hostname: mx.example.com
+  listen:
+    mx:
+      - ":25"
+      - "[::1]:2525"
+    submissionTLS: []
+    lmtp:
+      - unix:/run/ticket/lmtp.sock
+  limits:
+    maxMessageBytes: 26214400
+    maxRecipients: 100
+  timeouts:
+    read: 1m
+    write: 1m
+    shutdown: 30s
+  rateLimits:
+    connectionsPerIP: 10
+    ipMessages:
+      count: 60
+      per: 1h
+    senderRecipients:
+      count: 500
+      per: 24h
+  metricsAddress: 127.0.0.1:9025
+  tls:
+    certFile: /etc/ticket/cert.pem
+    keyFile: /etc/ticket/key.pem
+    reloadInterval: 1h
+  authPolicy:
+    spf: reject
+    dkim: quarantine
+    dmarc: dmarc
+  spam:
+    quarantine: 0
+    reject: 15
+    dnsbl:
+      - zone: zen.spamhaus.org
+        score: 5
+    bayes:
+      minTraining: 50
 `
 
 	b := bytes.NewBufferString(yamlConfig)
@@ -62,3 +184,52 @@ auth:
 	assert.NoError(t, err)
 	assert.Equal(t, structConfig, config)
 }
+
+func TestTicketWorkflow(t *testing.T) {
+	var c config.Config
+	workflow, err := c.TicketWorkflow()
+	assert.NoError(t, err)
+	assert.Empty(t, workflow.Transitions(), "every status change should be allowed by default")
+
+	c.Workflow.Statuses = []config.WorkflowStatus{{ID: 10, Name: "Waiting on customer"}}
+	c.Workflow.Transitions = []config.WorkflowTransition{
+		{From: []string{"open", "Waiting on customer"}, To: "In Progress", Require: []string{"owner"}},
+		{To: "closed", Require: []string{"resolution"}},
+	}
+	workflow, err = c.TicketWorkflow()
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.WorkflowTransition{
+		{From: []domain.TicketStatus{domain.TicketStatusOpen, 10}, To: domain.TicketStatusInProgress, Require: []domain.TicketField{domain.TicketFieldOwner}},
+		{To: domain.TicketStatusClosed, Require: []domain.TicketField{domain.TicketFieldResolution}},
+	}, workflow.Transitions(), "status names should be resolved")
+
+	c.Workflow.Transitions = []config.WorkflowTransition{{From: []string{"pending"}, To: "closed"}}
+	_, err = c.TicketWorkflow()
+	assert.ErrorIs(t, err, domain.ErrInvalidWorkflow, "unknown status names should be refused")
+
+	c.Workflow.Transitions = []config.WorkflowTransition{{To: "closed", Require: []string{"reason"}}}
+	_, err = c.TicketWorkflow()
+	assert.ErrorIs(t, err, domain.ErrInvalidWorkflow, "unknown fields should be refused")
+}
+
+func TestTicketCustomFields(t *testing.T) {
+	var c config.Config
+	fields, err := c.TicketCustomFields()
+	assert.NoError(t, err)
+	assert.Empty(t, fields.Definitions(), "no fields should be defined by default")
+
+	c.CustomFields = []config.CustomField{
+		{Key: "product_area", Name: "Product area", Type: "Select", Options: []string{"Billing", "API"}},
+		{Key: "seats", Name: "Seats", Type: "number"},
+	}
+	fields, err = c.TicketCustomFields()
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.CustomFieldDefinition{
+		{Key: "product_area", Name: "Product area", Type: domain.CustomFieldSelect, Options: []string{"Billing", "API"}},
+		{Key: "seats", Name: "Seats", Type: domain.CustomFieldNumber},
+	}, fields.Definitions(), "types should be read regardless of case")
+
+	c.CustomFields = []config.CustomField{{Key: "colour", Type: "colour"}}
+	_, err = c.TicketCustomFields()
+	assert.ErrorIs(t, err, domain.ErrInvalidCustomField, "unknown types should be refused")
+}
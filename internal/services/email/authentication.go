@@ -0,0 +1,312 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"strings"
+
+	"blitiri.com.ar/go/spf"
+	"github.com/emersion/go-msgauth/authres"
+	"github.com/emersion/go-msgauth/dkim"
+	"github.com/emersion/go-msgauth/dmarc"
+	"github.com/nil-nil/ticket/internal/domain"
+	"golang.org/x/net/publicsuffix"
+)
+
+var ErrUnknownAuthAction = errors.New("unknown authentication policy action")
+
+// maxDKIMSignatures bounds the work a message with many signatures can cause
+const maxDKIMSignatures = 5
+
+// Resolver looks up the DNS records used to authenticate inbound mail. net.DefaultResolver is one.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// AuthAction is what to do with inbound mail failing an authentication check.
+type AuthAction string
+
+const (
+	// AuthActionNone only records the failure, and is the default
+	AuthActionNone AuthAction = "none"
+	// AuthActionFlag accepts the message but marks it as suspicious
+	AuthActionFlag AuthAction = "flag"
+	// AuthActionQuarantine holds the message in quarantine for an admin to review
+	AuthActionQuarantine AuthAction = "quarantine"
+	// AuthActionReject refuses the message
+	AuthActionReject AuthAction = "reject"
+	// AuthActionDMARC does what the From domain's DMARC policy asks, quarantining for quarantine and refusing for reject
+	AuthActionDMARC AuthAction = "dmarc"
+)
+
+// AuthPolicy is what to do with inbound mail failing each check. AuthActionDMARC only applies to DMARC.
+type AuthPolicy struct {
+	SPF   AuthAction
+	DKIM  AuthAction
+	DMARC AuthAction
+}
+
+// Validate checks each action is one of the known ones.
+func (p AuthPolicy) Validate() error {
+	for _, action := range []AuthAction{p.SPF, p.DKIM} {
+		switch action {
+		case "", AuthActionNone, AuthActionFlag, AuthActionQuarantine, AuthActionReject:
+		default:
+			return fmt.Errorf("%w: %q", ErrUnknownAuthAction, action)
+		}
+	}
+	switch p.DMARC {
+	case "", AuthActionNone, AuthActionFlag, AuthActionQuarantine, AuthActionReject, AuthActionDMARC:
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownAuthAction, p.DMARC)
+	}
+	return nil
+}
+
+// DefaultAuthPolicy flags mail failing SPF or DKIM, and follows the sender's DMARC policy.
+var DefaultAuthPolicy = AuthPolicy{SPF: AuthActionFlag, DKIM: AuthActionFlag, DMARC: AuthActionDMARC}
+
+// authenticate checks SPF, DKIM and DMARC for an inbound message, recording the results in an Authentication-Results header.
+//
+// held names the failed check if the policy quarantines the message, and is empty otherwise.
+// An error wrapping ErrAuthenticationFailed is returned if the policy refuses the message.
+func (s *Server) authenticate(ctx context.Context, envelope Envelope, header mail.Header, raw []byte) (auth domain.EmailAuthentication, held string, err error) {
+	spfCheck := s.checkSPF(ctx, envelope)
+	signatures := s.checkDKIM(ctx, raw)
+	from := fromDomain(header)
+	dmarcCheck, policy := s.checkDMARC(ctx, from, spfCheck, signatures)
+
+	auth = domain.EmailAuthentication{
+		SPF:         spfCheck,
+		DKIM:        bestSignature(signatures, from),
+		DMARC:       dmarcCheck,
+		DMARCPolicy: policy,
+	}
+	setAuthenticationResults(header, s.Hostname, envelope, auth, signatures)
+
+	held, err = s.AuthPolicy.apply(&auth)
+	return auth, held, err
+}
+
+// apply flags the authentication results, quarantines or refuses the message, depending on which checks failed.
+//
+// held names the first failed check that quarantines the message, and refusing takes precedence over it.
+func (p AuthPolicy) apply(auth *domain.EmailAuthentication) (held string, err error) {
+	dmarcAction := p.DMARC
+	if dmarcAction == AuthActionDMARC {
+		switch auth.DMARCPolicy {
+		case string(dmarc.PolicyReject):
+			dmarcAction = AuthActionReject
+		case string(dmarc.PolicyQuarantine):
+			dmarcAction = AuthActionQuarantine
+		default:
+			dmarcAction = AuthActionNone
+		}
+	}
+
+	checks := []struct {
+		name   string
+		action AuthAction
+		failed bool
+	}{
+		{name: "spf", action: p.SPF, failed: auth.SPF.Result == domain.AuthResultFail},
+		{name: "dkim", action: p.DKIM, failed: auth.DKIM.Result == domain.AuthResultFail || auth.DKIM.Result == domain.AuthResultPermError},
+		{name: "dmarc", action: dmarcAction, failed: auth.DMARC.Result == domain.AuthResultFail},
+	}
+	for _, check := range checks {
+		if !check.failed {
+			continue
+		}
+		switch check.action {
+		case AuthActionReject:
+			return "", fmt.Errorf("%w: %s failed", ErrAuthenticationFailed, check.name)
+		case AuthActionQuarantine:
+			auth.Flagged = true
+			if held == "" {
+				held = check.name + " failed"
+			}
+		case AuthActionFlag:
+			auth.Flagged = true
+		}
+	}
+
+	return held, nil
+}
+
+// checkSPF checks the client may send mail for the envelope sender's domain, or the HELO name for bounces.
+func (s *Server) checkSPF(ctx context.Context, envelope Envelope) domain.AuthCheck {
+	spfDomain := envelope.Helo
+	if _, mailDomain, err := getUserAndDomainParts(envelope.From); err == nil {
+		spfDomain = mailDomain
+	}
+
+	result, _ := spf.CheckHostWithSender(envelope.RemoteIP, envelope.Helo, envelope.From, spf.WithResolver(s.Resolver), spf.WithContext(ctx))
+	return domain.AuthCheck{Result: domain.AuthResult(result), Domain: strings.ToLower(spfDomain)}
+}
+
+// checkDKIM verifies each of the message's signatures.
+func (s *Server) checkDKIM(ctx context.Context, raw []byte) []domain.AuthCheck {
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(raw), &dkim.VerifyOptions{
+		LookupTXT:        func(name string) ([]string, error) { return s.Resolver.LookupTXT(ctx, name) },
+		MaxVerifications: maxDKIMSignatures,
+	})
+	if err != nil && !errors.Is(err, dkim.ErrTooManySignatures) {
+		return []domain.AuthCheck{{Result: domain.AuthResultPermError}}
+	}
+
+	signatures := make([]domain.AuthCheck, 0, len(verifications))
+	for _, verification := range verifications {
+		check := domain.AuthCheck{Result: domain.AuthResultPass, Domain: strings.ToLower(verification.Domain)}
+		switch {
+		case verification.Err == nil:
+		case dkim.IsTempFail(verification.Err):
+			check.Result = domain.AuthResultTempError
+		case dkim.IsPermFail(verification.Err):
+			check.Result = domain.AuthResultPermError
+		default:
+			check.Result = domain.AuthResultFail
+		}
+		signatures = append(signatures, check)
+	}
+
+	return signatures
+}
+
+// bestSignature summarises the DKIM signatures, preferring a pass for the From domain, then any pass, then the first failure.
+func bestSignature(signatures []domain.AuthCheck, from string) domain.AuthCheck {
+	if len(signatures) == 0 {
+		return domain.AuthCheck{Result: domain.AuthResultNone}
+	}
+
+	best := signatures[0]
+	for _, signature := range signatures {
+		if signature.Result != domain.AuthResultPass {
+			continue
+		}
+		if signature.Domain == from {
+			return signature
+		}
+		if best.Result != domain.AuthResultPass {
+			best = signature
+		}
+	}
+
+	return best
+}
+
+// checkDMARC checks SPF or one of the DKIM signatures passed for a domain aligned with the From domain, returning the result and the domain's policy.
+func (s *Server) checkDMARC(ctx context.Context, from string, spfCheck domain.AuthCheck, signatures []domain.AuthCheck) (domain.AuthCheck, string) {
+	if from == "" {
+		// The From header doesn't name exactly one author, so there is no domain to check
+		return domain.AuthCheck{Result: domain.AuthResultPermError}, ""
+	}
+
+	record, policy, err := s.lookupDMARC(ctx, from)
+	switch {
+	case errors.Is(err, dmarc.ErrNoPolicy):
+		return domain.AuthCheck{Result: domain.AuthResultNone, Domain: from}, ""
+	case dmarc.IsTempFail(err):
+		return domain.AuthCheck{Result: domain.AuthResultTempError, Domain: from}, ""
+	case err != nil:
+		return domain.AuthCheck{Result: domain.AuthResultPermError, Domain: from}, ""
+	}
+
+	result := domain.AuthResultFail
+	if spfCheck.Result == domain.AuthResultPass && aligned(spfCheck.Domain, from, record.SPFAlignment) {
+		result = domain.AuthResultPass
+	}
+	for _, signature := range signatures {
+		if signature.Result == domain.AuthResultPass && aligned(signature.Domain, from, record.DKIMAlignment) {
+			result = domain.AuthResultPass
+		}
+	}
+
+	return domain.AuthCheck{Result: result, Domain: from}, string(policy)
+}
+
+// lookupDMARC finds the DMARC record for a domain, falling back to its organizational domain's record and subdomain policy.
+func (s *Server) lookupDMARC(ctx context.Context, from string) (*dmarc.Record, dmarc.Policy, error) {
+	options := &dmarc.LookupOptions{
+		LookupTXT: func(name string) ([]string, error) { return s.Resolver.LookupTXT(ctx, name) },
+	}
+
+	record, err := dmarc.LookupWithOptions(from, options)
+	if err == nil {
+		return record, record.Policy, nil
+	}
+	org := organizationalDomain(from)
+	if !errors.Is(err, dmarc.ErrNoPolicy) || org == from {
+		return nil, "", err
+	}
+
+	record, err = dmarc.LookupWithOptions(org, options)
+	if err != nil {
+		return nil, "", err
+	}
+	if record.SubdomainPolicy != "" {
+		return record, record.SubdomainPolicy, nil
+	}
+	return record, record.Policy, nil
+}
+
+// aligned checks an authenticated domain matches the From domain, exactly for strict alignment or by organizational domain for relaxed.
+func aligned(authenticated, from string, mode dmarc.AlignmentMode) bool {
+	if authenticated == from {
+		return true
+	}
+	return mode != dmarc.AlignmentStrict && organizationalDomain(authenticated) == organizationalDomain(from)
+}
+
+// organizationalDomain is the registered domain, e.g. example.co.uk for mail.example.co.uk.
+func organizationalDomain(name string) string {
+	org, err := publicsuffix.EffectiveTLDPlusOne(name)
+	if err != nil {
+		return name
+	}
+	return org
+}
+
+// fromDomain returns the domain of the message's author, or "" if the From header doesn't name exactly one.
+func fromDomain(header mail.Header) string {
+	addresses, err := header.AddressList("From")
+	if err != nil || len(addresses) != 1 {
+		return ""
+	}
+	_, fromDomain, err := getUserAndDomainParts(addresses[0].Address)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(fromDomain)
+}
+
+// setAuthenticationResults adds our Authentication-Results header to the message.
+//
+// Existing headers claiming to be from us are removed, as they can only have been forged by the sender (RFC 8601 section 5).
+func setAuthenticationResults(header mail.Header, hostname string, envelope Envelope, auth domain.EmailAuthentication, signatures []domain.AuthCheck) {
+	results := []authres.Result{
+		&authres.SPFResult{Value: authres.ResultValue(auth.SPF.Result), From: envelope.From, Helo: envelope.Helo},
+	}
+	if len(signatures) == 0 {
+		results = append(results, &authres.DKIMResult{Value: authres.ResultNone})
+	}
+	for _, signature := range signatures {
+		results = append(results, &authres.DKIMResult{Value: authres.ResultValue(signature.Result), Domain: signature.Domain})
+	}
+	results = append(results, &authres.DMARCResult{Value: authres.ResultValue(auth.DMARC.Result), From: auth.DMARC.Domain})
+
+	kept := []string{authres.Format(hostname, results)}
+	for _, value := range header["Authentication-Results"] {
+		if identifier, _, err := authres.Parse(value); err == nil && strings.EqualFold(identifier, hostname) {
+			continue
+		}
+		kept = append(kept, value)
+	}
+	header["Authentication-Results"] = kept
+}
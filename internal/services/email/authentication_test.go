@@ -0,0 +1,332 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-msgauth/dkim"
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	resolver := &mockResolver{txt: map[string][]string{
+		"example.com":                   {"v=spf1 ip4:192.0.2.1 -all"},
+		"mail.example.com":              {"v=spf1 ip4:192.0.2.2 -all"},
+		"sel._domainkey.example.com":    {"v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(publicKey)},
+		"_dmarc.example.com":            {"v=DMARC1; p=reject"},
+		"quarantine.test":               {"v=spf1 -all"},
+		"_dmarc.quarantine.test":        {"v=DMARC1; p=quarantine"},
+		"mail.strict.test":              {"v=spf1 ip4:192.0.2.3 -all"},
+		"_dmarc.strict.test":            {"v=DMARC1; p=none; aspf=s"},
+		"sub.parent.test":               {"v=spf1 -all"},
+		"_dmarc.parent.test":            {"v=DMARC1; p=none; sp=reject"},
+		"_dmarc.broken.test":            {"v=DMARC1; p=sometimes"},
+		"temporary.test":                nil,
+		"_dmarc.temporary.test":         nil,
+		"sel._domainkey.temporary.test": nil,
+	}}
+
+	sign := func(message string) string {
+		var signed bytes.Buffer
+		require.NoError(t, dkim.Sign(&signed, strings.NewReader(message), &dkim.SignOptions{Domain: "example.com", Selector: "sel", Signer: privateKey}))
+		return signed.String()
+	}
+	message := func(from string) string {
+		return "From: " + from + "\r\nTo: support@test.com\r\nSubject: Hello\r\nMessage-ID: <1@example.com>\r\n\r\nHelp\r\n"
+	}
+
+	tests := []struct {
+		name      string
+		policy    AuthPolicy
+		ip        string
+		mailFrom  string
+		message   string
+		expected  domain.EmailAuthentication
+		expectErr error
+		// expectHeld is the failed check the email is quarantined for, empty if it isn't
+		expectHeld string
+	}{
+		{
+			name:     "AllPass",
+			policy:   DefaultAuthPolicy,
+			ip:       "192.0.2.1",
+			mailFrom: "bob@example.com",
+			message:  sign(message("bob@example.com")),
+			expected: domain.EmailAuthentication{
+				SPF:         domain.AuthCheck{Result: domain.AuthResultPass, Domain: "example.com"},
+				DKIM:        domain.AuthCheck{Result: domain.AuthResultPass, Domain: "example.com"},
+				DMARC:       domain.AuthCheck{Result: domain.AuthResultPass, Domain: "example.com"},
+				DMARCPolicy: "reject",
+			},
+		},
+		{
+			name:      "SpoofedFromRejected",
+			policy:    DefaultAuthPolicy,
+			ip:        "198.51.100.7",
+			mailFrom:  "bob@example.com",
+			message:   message("bob@example.com"),
+			expectErr: ErrAuthenticationFailed,
+		},
+		{
+			name:     "SpoofedFromRecordedWithoutPolicy",
+			ip:       "198.51.100.7",
+			mailFrom: "bob@example.com",
+			message:  message("bob@example.com"),
+			expected: domain.EmailAuthentication{
+				SPF:         domain.AuthCheck{Result: domain.AuthResultFail, Domain: "example.com"},
+				DKIM:        domain.AuthCheck{Result: domain.AuthResultNone},
+				DMARC:       domain.AuthCheck{Result: domain.AuthResultFail, Domain: "example.com"},
+				DMARCPolicy: "reject",
+			},
+		},
+		{
+			name:     "QuarantinePolicyHeld",
+			policy:   AuthPolicy{DMARC: AuthActionDMARC},
+			ip:       "198.51.100.7",
+			mailFrom: "bob@quarantine.test",
+			message:  message("bob@quarantine.test"),
+			expected: domain.EmailAuthentication{
+				SPF:         domain.AuthCheck{Result: domain.AuthResultFail, Domain: "quarantine.test"},
+				DKIM:        domain.AuthCheck{Result: domain.AuthResultNone},
+				DMARC:       domain.AuthCheck{Result: domain.AuthResultFail, Domain: "quarantine.test"},
+				DMARCPolicy: "quarantine",
+				Flagged:     true,
+			},
+			expectHeld: "dmarc failed",
+		},
+		{
+			name:     "QuarantineActionHeld",
+			policy:   AuthPolicy{SPF: AuthActionQuarantine, DMARC: AuthActionFlag},
+			ip:       "198.51.100.7",
+			mailFrom: "bob@example.com",
+			message:  message("bob@example.com"),
+			expected: domain.EmailAuthentication{
+				SPF:         domain.AuthCheck{Result: domain.AuthResultFail, Domain: "example.com"},
+				DKIM:        domain.AuthCheck{Result: domain.AuthResultNone},
+				DMARC:       domain.AuthCheck{Result: domain.AuthResultFail, Domain: "example.com"},
+				DMARCPolicy: "reject",
+				Flagged:     true,
+			},
+			expectHeld: "spf failed",
+		},
+		{
+			name:      "RejectOverridesQuarantine",
+			policy:    AuthPolicy{SPF: AuthActionQuarantine, DMARC: AuthActionReject},
+			ip:        "198.51.100.7",
+			mailFrom:  "bob@example.com",
+			message:   message("bob@example.com"),
+			expectErr: ErrAuthenticationFailed,
+		},
+		{
+			name:     "TamperedSignatureFlagged",
+			policy:   DefaultAuthPolicy,
+			ip:       "192.0.2.1",
+			mailFrom: "bob@example.com",
+			message:  strings.Replace(sign(message("bob@example.com")), "Help", "Send money", 1),
+			expected: domain.EmailAuthentication{
+				SPF:         domain.AuthCheck{Result: domain.AuthResultPass, Domain: "example.com"},
+				DKIM:        domain.AuthCheck{Result: domain.AuthResultFail, Domain: "example.com"},
+				DMARC:       domain.AuthCheck{Result: domain.AuthResultPass, Domain: "example.com"},
+				DMARCPolicy: "reject",
+				Flagged:     true,
+			},
+		},
+		{
+			name:     "DKIMAlignsWithoutSPF",
+			policy:   DefaultAuthPolicy,
+			ip:       "198.51.100.7",
+			mailFrom: "bounces@forwarder.test",
+			message:  sign(message("bob@example.com")),
+			expected: domain.EmailAuthentication{
+				SPF:         domain.AuthCheck{Result: domain.AuthResultNone, Domain: "forwarder.test"},
+				DKIM:        domain.AuthCheck{Result: domain.AuthResultPass, Domain: "example.com"},
+				DMARC:       domain.AuthCheck{Result: domain.AuthResultPass, Domain: "example.com"},
+				DMARCPolicy: "reject",
+			},
+		},
+		{
+			name:     "RelaxedAlignment",
+			policy:   DefaultAuthPolicy,
+			ip:       "192.0.2.2",
+			mailFrom: "bounces@mail.example.com",
+			message:  message("bob@example.com"),
+			expected: domain.EmailAuthentication{
+				SPF:         domain.AuthCheck{Result: domain.AuthResultPass, Domain: "mail.example.com"},
+				DKIM:        domain.AuthCheck{Result: domain.AuthResultNone},
+				DMARC:       domain.AuthCheck{Result: domain.AuthResultPass, Domain: "example.com"},
+				DMARCPolicy: "reject",
+			},
+		},
+		{
+			name:     "StrictAlignment",
+			policy:   DefaultAuthPolicy,
+			ip:       "192.0.2.3",
+			mailFrom: "bounces@mail.strict.test",
+			message:  message("bob@strict.test"),
+			expected: domain.EmailAuthentication{
+				SPF:         domain.AuthCheck{Result: domain.AuthResultPass, Domain: "mail.strict.test"},
+				DKIM:        domain.AuthCheck{Result: domain.AuthResultNone},
+				DMARC:       domain.AuthCheck{Result: domain.AuthResultFail, Domain: "strict.test"},
+				DMARCPolicy: "none",
+			},
+		},
+		{
+			name:      "SubdomainPolicy",
+			policy:    DefaultAuthPolicy,
+			ip:        "198.51.100.7",
+			mailFrom:  "bob@sub.parent.test",
+			message:   message("bob@sub.parent.test"),
+			expectErr: ErrAuthenticationFailed,
+		},
+		{
+			name:     "NoRecords",
+			policy:   DefaultAuthPolicy,
+			ip:       "198.51.100.7",
+			mailFrom: "bob@other.test",
+			message:  message("bob@other.test"),
+			expected: domain.EmailAuthentication{
+				SPF:   domain.AuthCheck{Result: domain.AuthResultNone, Domain: "other.test"},
+				DKIM:  domain.AuthCheck{Result: domain.AuthResultNone},
+				DMARC: domain.AuthCheck{Result: domain.AuthResultNone, Domain: "other.test"},
+			},
+		},
+		{
+			name:     "InvalidDMARCRecord",
+			policy:   DefaultAuthPolicy,
+			ip:       "198.51.100.7",
+			mailFrom: "bob@broken.test",
+			message:  message("bob@broken.test"),
+			expected: domain.EmailAuthentication{
+				SPF:   domain.AuthCheck{Result: domain.AuthResultNone, Domain: "broken.test"},
+				DKIM:  domain.AuthCheck{Result: domain.AuthResultNone},
+				DMARC: domain.AuthCheck{Result: domain.AuthResultPermError, Domain: "broken.test"},
+			},
+		},
+		{
+			name:     "TemporaryFailure",
+			policy:   DefaultAuthPolicy,
+			ip:       "198.51.100.7",
+			mailFrom: "bob@temporary.test",
+			message:  message("bob@temporary.test"),
+			expected: domain.EmailAuthentication{
+				SPF:   domain.AuthCheck{Result: domain.AuthResultTempError, Domain: "temporary.test"},
+				DKIM:  domain.AuthCheck{Result: domain.AuthResultNone},
+				DMARC: domain.AuthCheck{Result: domain.AuthResultTempError, Domain: "temporary.test"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &mockMailServerRepository{
+				authoritativeDomains: []string{"test.com"},
+				aliases:              []domain.Alias{{User: "support", Domain: "test.com", ID: 1}},
+				emails:               map[uint64]domain.Email{},
+			}
+			server := NewServer(repo, &mockTicketService{tickets: map[uint64]domain.Ticket{}}, nil, &mockCacheDriver{cache: map[string]interface{}{}}, &mockEventBusDriver{}, nil)
+			server.Hostname = "mx.test.com"
+			server.Resolver = resolver
+			server.AuthPolicy = tc.policy
+
+			envelope := Envelope{From: tc.mailFrom, To: []string{"support@test.com"}, RemoteIP: net.ParseIP(tc.ip), Helo: "client.test"}
+			err := server.ReceiveData(envelope, strings.NewReader(tc.message))
+			if tc.expectErr != nil {
+				assert.ErrorIs(t, err, tc.expectErr)
+				assert.Empty(t, repo.emails, "rejected mail shouldn't be stored")
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, repo.emails, 1)
+			assert.Equal(t, &tc.expected, repo.emails[1].Authentication)
+			if tc.expectHeld == "" {
+				assert.Nil(t, repo.emails[1].Quarantine, "mail passing the policy shouldn't be quarantined")
+				return
+			}
+			require.NotNil(t, repo.emails[1].Quarantine, "mail failing a quarantine check should be quarantined")
+			assert.Equal(t, domain.QuarantineReasonAuthentication, repo.emails[1].Quarantine.Reason)
+			assert.Equal(t, tc.expectHeld, repo.emails[1].Quarantine.Detail)
+			assert.Equal(t, []string{"support@test.com"}, repo.emails[1].Quarantine.Recipients)
+			assert.Nil(t, repo.emails[1].TicketID, "quarantined mail shouldn't be ticketed")
+		})
+	}
+}
+
+func TestAuthenticationResultsHeader(t *testing.T) {
+	repo := &mockMailServerRepository{
+		authoritativeDomains: []string{"test.com"},
+		aliases:              []domain.Alias{{User: "support", Domain: "test.com", ID: 1}},
+		emails:               map[uint64]domain.Email{},
+	}
+	server := NewServer(repo, &mockTicketService{tickets: map[uint64]domain.Ticket{}}, nil, &mockCacheDriver{cache: map[string]interface{}{}}, &mockEventBusDriver{}, nil)
+	server.Hostname = "mx.test.com"
+	server.Resolver = &mockResolver{txt: map[string][]string{"example.com": {"v=spf1 ip4:192.0.2.1 -all"}}}
+
+	message := "Authentication-Results: mx.test.com; spf=pass smtp.mailfrom=bob@example.com\r\n" +
+		"Authentication-Results: mx.example.com; dkim=pass header.d=example.com\r\n" +
+		"From: bob@example.com\r\nTo: support@test.com\r\nSubject: Hello\r\n\r\nHelp\r\n"
+	envelope := Envelope{From: "bob@example.com", To: []string{"support@test.com"}, RemoteIP: net.ParseIP("198.51.100.7"), Helo: "client.test"}
+	require.NoError(t, server.ReceiveData(envelope, strings.NewReader(message)))
+
+	results := repo.emails[1].Message.Header["Authentication-Results"]
+	require.Len(t, results, 2, "forged results claiming to be from us should be removed")
+	assert.Equal(t, "mx.test.com; spf=fail smtp.helo=client.test smtp.mailfrom=bob@example.com; dkim=none ; dmarc=none header.from=example.com", strings.Join(strings.Fields(results[0]), " "))
+	assert.Equal(t, "mx.example.com; dkim=pass header.d=example.com", results[1], "results from other hosts should be kept")
+
+	t.Run("Unchecked", func(t *testing.T) {
+		err := server.ReceiveData(Envelope{From: "bob@example.com", To: []string{"support@test.com"}}, strings.NewReader(message))
+		assert.NoError(t, err)
+		assert.Nil(t, repo.emails[2].Authentication, "mail without a client address can't be checked")
+	})
+}
+
+func TestAuthPolicyValidate(t *testing.T) {
+	assert.NoError(t, DefaultAuthPolicy.Validate())
+	assert.NoError(t, AuthPolicy{}.Validate())
+	assert.NoError(t, AuthPolicy{SPF: AuthActionQuarantine, DKIM: AuthActionQuarantine, DMARC: AuthActionQuarantine}.Validate())
+	assert.ErrorIs(t, AuthPolicy{SPF: "sometimes"}.Validate(), ErrUnknownAuthAction)
+	assert.ErrorIs(t, AuthPolicy{DKIM: AuthActionDMARC}.Validate(), ErrUnknownAuthAction, "only dmarc can follow the dmarc policy")
+}
+
+// mockResolver answers DNS queries from maps of TXT and address records. A nil TXT entry is a temporary failure.
+type mockResolver struct {
+	txt map[string][]string
+	ip  map[string][]net.IPAddr
+}
+
+func (m *mockResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	records, ok := m.txt[strings.TrimSuffix(name, ".")]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	if records == nil {
+		return nil, &net.DNSError{Err: "server misbehaving", Name: name, IsTemporary: true}
+	}
+	return records, nil
+}
+
+func (m *mockResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (m *mockResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	addrs, ok := m.ip[strings.TrimSuffix(host, ".")]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+func (m *mockResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+}
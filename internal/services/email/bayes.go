@@ -0,0 +1,183 @@
+package email
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/nil-nil/ticket/internal/domain"
+)
+
+const (
+	// DefaultBayesWeight scores certain spam 10 and certain ham -10
+	DefaultBayesWeight = 10.0
+	// DefaultBayesMinTraining is how many spam and how many ham messages must be trained before the classifier is used
+	DefaultBayesMinTraining = 20
+)
+
+const (
+	// bayesInterestingTokens is how many of the tokens furthest from neutral are combined (Graham's "A Plan for Spam")
+	bayesInterestingTokens = 15
+	// bayesMinDeviation skips tokens too close to neutral to say anything
+	bayesMinDeviation = 0.1
+	// bayesStrength is how much weight the neutral prior has against what was seen of rare tokens (Robinson's s)
+	bayesStrength = 1.0
+	// maxBayesTokens bounds the work and storage a huge message can cause
+	maxBayesTokens = 1000
+	minTokenLength = 3
+	maxTokenLength = 30
+)
+
+var (
+	htmlTagPattern = regexp.MustCompile(`(?s)<[^>]*>`)
+	urlHostPattern = regexp.MustCompile(`(?i)https?://([a-z0-9.-]+)`)
+)
+
+// NewBayesFilter returns a classifier trained with the repository, with the default weight and minimum training.
+func NewBayesFilter(repo domain.SpamTrainingRepository) *BayesFilter {
+	return &BayesFilter{repo: repo, Weight: DefaultBayesWeight, MinTraining: DefaultBayesMinTraining}
+}
+
+// BayesFilter is a Bayesian classifier learning from the tickets agents mark as spam or not.
+//
+// Messages are scored between -Weight for certain ham and Weight for certain spam, combining the most telling tokens with Robinson's chi-square method.
+type BayesFilter struct {
+	repo domain.SpamTrainingRepository
+	// Weight is the score of a message that is certainly spam
+	Weight float64
+	// MinTraining is how many messages of each class must be trained before messages are scored
+	MinTraining int
+}
+
+func (f *BayesFilter) Check(ctx context.Context, envelope Envelope, e domain.Email) ([]domain.SpamRule, error) {
+	spamTotal, hamTotal, err := f.repo.SpamTrainingTotals(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if spamTotal < max(f.MinTraining, 1) || hamTotal < max(f.MinTraining, 1) {
+		return nil, nil
+	}
+
+	counts, err := f.repo.SpamTokenCounts(ctx, spamTokens(e))
+	if err != nil {
+		return nil, err
+	}
+	probability, ok := spamProbability(counts, spamTotal, hamTotal)
+	if !ok {
+		return nil, nil
+	}
+
+	score := math.Round(f.Weight*(2*probability-1)*100) / 100
+	return []domain.SpamRule{{Name: "BAYES", Score: score}}, nil
+}
+
+// Train records the email as spam or ham.
+func (f *BayesFilter) Train(ctx context.Context, e domain.Email, spam bool) error {
+	return f.repo.TrainSpam(ctx, e.ID, spamTokens(e), spam)
+}
+
+// spamProbability combines the token probabilities into the probability the message is spam, or false if no token says anything.
+func spamProbability(counts map[string]domain.SpamTokenCount, spamTotal, hamTotal int) (float64, bool) {
+	probabilities := make([]float64, 0, len(counts))
+	for _, count := range counts {
+		spamRatio := float64(count.Spam) / float64(spamTotal)
+		hamRatio := float64(count.Ham) / float64(hamTotal)
+		if spamRatio+hamRatio == 0 {
+			continue
+		}
+		seen := float64(count.Spam + count.Ham)
+		p := (bayesStrength*0.5 + seen*spamRatio/(spamRatio+hamRatio)) / (bayesStrength + seen)
+		if math.Abs(p-0.5) >= bayesMinDeviation {
+			probabilities = append(probabilities, p)
+		}
+	}
+	if len(probabilities) == 0 {
+		return 0, false
+	}
+
+	sort.Slice(probabilities, func(i, j int) bool {
+		return math.Abs(probabilities[i]-0.5) > math.Abs(probabilities[j]-0.5)
+	})
+	if len(probabilities) > bayesInterestingTokens {
+		probabilities = probabilities[:bayesInterestingTokens]
+	}
+
+	var spamLog, hamLog float64
+	for _, p := range probabilities {
+		spamLog += math.Log(1 - p)
+		hamLog += math.Log(p)
+	}
+	spamminess := 1 - chi2Q(-2*spamLog, 2*len(probabilities))
+	hamminess := 1 - chi2Q(-2*hamLog, 2*len(probabilities))
+
+	return (1 + spamminess - hamminess) / 2, true
+}
+
+// chi2Q is the probability of a chi-square value at least x2 with an even number of degrees of freedom.
+func chi2Q(x2 float64, df int) float64 {
+	m := x2 / 2
+	term := math.Exp(-m)
+	sum := term
+	for i := 1; i < df/2; i++ {
+		term *= m / float64(i)
+		sum += term
+	}
+	return math.Min(sum, 1)
+}
+
+// spamTokens returns the distinct tokens the classifier learns from: words of the subject and body, the sender's domain and the hosts of links.
+//
+// Only fields kept with the stored email are used, so training later sees the same tokens as scoring did.
+func spamTokens(e domain.Email) []string {
+	seen := map[string]bool{}
+	add := func(token string) {
+		if len(seen) < maxBayesTokens {
+			seen[token] = true
+		}
+	}
+
+	for _, word := range words(e.Subject) {
+		add("subject:" + word)
+	}
+	if _, senderDomain, err := getUserAndDomainParts(e.Sender); err == nil {
+		add("from:" + strings.ToLower(senderDomain))
+	}
+	for _, match := range urlHostPattern.FindAllStringSubmatch(e.TextBody+" "+e.HTMLBody, -1) {
+		add("url:" + strings.ToLower(strings.TrimSuffix(match[1], ".")))
+	}
+	body := e.TextBody
+	if strings.TrimSpace(body) == "" {
+		body = htmlTagPattern.ReplaceAllString(e.HTMLBody, " ")
+	}
+	for _, word := range words(body) {
+		add(word)
+	}
+
+	tokens := make([]string, 0, len(seen))
+	for token := range seen {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	return tokens
+}
+
+// words splits text into lower case words, leaving out numbers and words too short or long to tell anything by.
+func words(text string) []string {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '$' && r != '\'' && r != '-'
+	})
+
+	words := make([]string, 0, len(fields))
+	for _, field := range fields {
+		field = strings.Trim(strings.ToLower(field), "'-")
+		length := len([]rune(field))
+		if length < minTokenLength || length > maxTokenLength || strings.IndexFunc(field, unicode.IsLetter) == -1 {
+			continue
+		}
+		words = append(words, field)
+	}
+	return words
+}
@@ -0,0 +1,122 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpamTokens(t *testing.T) {
+	tokens := spamTokens(domain.Email{
+		Subject:  "Cheap Pills",
+		Sender:   "bob@Example.com",
+		HTMLBody: `<p>Buy <b>now</b> at <a href="https://Pills.example.net/buy">our shop</a>, only $99 or 2023</p>`,
+	})
+	assert.Equal(t, []string{
+		"buy", "from:example.com", "now", "only", "our", "shop", "subject:cheap", "subject:pills", "url:pills.example.net",
+	}, tokens, "tokens should be lower case and distinct, with html stripped and numbers left out")
+
+	assert.Contains(t, spamTokens(domain.Email{TextBody: "plain text", HTMLBody: "<p>markup</p>"}), "plain", "the text body should be preferred")
+	assert.NotContains(t, spamTokens(domain.Email{TextBody: "plain text", HTMLBody: "<p>markup</p>"}), "markup")
+}
+
+func TestBayesFilter(t *testing.T) {
+	ctx := context.Background()
+	training := &mockSpamTrainingRepository{}
+	filter := NewBayesFilter(training)
+	spam := func(ID uint64) domain.Email {
+		return domain.Email{ID: ID, Subject: "Cheap pills", Sender: "offers@spam.net", TextBody: fmt.Sprintf("Buy viagra now, limited offer %d", ID)}
+	}
+	ham := func(ID uint64) domain.Email {
+		return domain.Email{ID: ID, Subject: "Printer on fire", Sender: "bob@example.com", TextBody: fmt.Sprintf("The office printer is broken again, ticket %d", ID)}
+	}
+
+	for ID := uint64(1); ID < DefaultBayesMinTraining; ID++ {
+		require.NoError(t, filter.Train(ctx, spam(ID), true))
+		require.NoError(t, filter.Train(ctx, ham(100+ID), false))
+	}
+	rules, err := filter.Check(ctx, Envelope{}, spam(1000))
+	assert.NoError(t, err)
+	assert.Empty(t, rules, "messages shouldn't be scored until enough of each class is trained")
+
+	require.NoError(t, filter.Train(ctx, spam(DefaultBayesMinTraining), true))
+	require.NoError(t, filter.Train(ctx, ham(100+DefaultBayesMinTraining), false))
+
+	rules, err = filter.Check(ctx, Envelope{}, spam(1000))
+	assert.NoError(t, err)
+	if assert.Len(t, rules, 1) {
+		assert.Equal(t, "BAYES", rules[0].Name)
+		assert.Greater(t, rules[0].Score, 0.9*DefaultBayesWeight, "spam should score close to the weight")
+	}
+
+	rules, err = filter.Check(ctx, Envelope{}, ham(1000))
+	assert.NoError(t, err)
+	if assert.Len(t, rules, 1) {
+		assert.Less(t, rules[0].Score, -0.9*DefaultBayesWeight, "ham should score close to minus the weight")
+	}
+
+	rules, err = filter.Check(ctx, Envelope{}, domain.Email{Subject: "Something", TextBody: "entirely different"})
+	assert.NoError(t, err)
+	assert.Empty(t, rules, "messages with no known tokens shouldn't be scored")
+}
+
+// mockSpamTrainingRepository keeps training in memory, like the SQL repository.
+type mockSpamTrainingRepository struct {
+	trained map[uint64]bool
+	tokens  map[string]domain.SpamTokenCount
+}
+
+func (m *mockSpamTrainingRepository) SpamTokenCounts(ctx context.Context, tokens []string) (map[string]domain.SpamTokenCount, error) {
+	counts := map[string]domain.SpamTokenCount{}
+	for _, token := range tokens {
+		if count, ok := m.tokens[token]; ok {
+			counts[token] = count
+		}
+	}
+	return counts, nil
+}
+
+func (m *mockSpamTrainingRepository) SpamTrainingTotals(ctx context.Context) (spam, ham int, err error) {
+	for _, isSpam := range m.trained {
+		if isSpam {
+			spam++
+		} else {
+			ham++
+		}
+	}
+	return spam, ham, nil
+}
+
+func (m *mockSpamTrainingRepository) TrainSpam(ctx context.Context, emailID uint64, tokens []string, spam bool) error {
+	if m.trained == nil {
+		m.trained = map[uint64]bool{}
+		m.tokens = map[string]domain.SpamTokenCount{}
+	}
+	trained, retrain := m.trained[emailID]
+	if retrain && trained == spam {
+		return nil
+	}
+	m.trained[emailID] = spam
+
+	for _, token := range tokens {
+		count := m.tokens[token]
+		switch {
+		case spam:
+			count.Spam++
+			if retrain {
+				count.Ham--
+			}
+		default:
+			count.Ham++
+			if retrain {
+				count.Spam--
+			}
+		}
+		m.tokens[token] = count
+	}
+	return nil
+}
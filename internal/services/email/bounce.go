@@ -0,0 +1,157 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strings"
+
+	"github.com/nil-nil/ticket/internal/domain"
+)
+
+// deliveryReport is the part of a delivery status notification (RFC 3464) needed to handle a bounce.
+type deliveryReport struct {
+	// originalMessageID is the Message-ID of the message the report is about
+	originalMessageID string
+	recipients        []recipientStatus
+}
+
+type recipientStatus struct {
+	recipient  string
+	action     string
+	status     string
+	diagnostic string
+}
+
+// failed returns the recipients the message couldn't be delivered to.
+func (r deliveryReport) failed() []recipientStatus {
+	failed := make([]recipientStatus, 0)
+	for _, recipient := range r.recipients {
+		if recipient.action == "failed" {
+			failed = append(failed, recipient)
+		}
+	}
+	return failed
+}
+
+// handleBounce fails the queued message a delivery report says couldn't be delivered.
+//
+// Anyone can send a report, so it's only trusted if it has the null sender bounces are sent with, it was sent to the address the message
+// was sent from, and the recipients it failed for are ones the message was sent to.
+// Reports of delayed or successful delivery, and reports about messages we didn't queue, are ignored.
+func (s *Server) handleBounce(ctx context.Context, envelope Envelope, report deliveryReport) error {
+	if s.outboundQueue == nil || envelope.From != "" || report.originalMessageID == "" {
+		return nil
+	}
+
+	msg, err := s.outboundQueue.Find(ctx, report.originalMessageID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(envelope.To, func(to string) bool { return strings.EqualFold(to, msg.From) }) {
+		return nil
+	}
+
+	reasons := make([]string, 0)
+	for _, recipient := range report.failed() {
+		if !slices.ContainsFunc(msg.To, func(to string) bool { return strings.EqualFold(to, recipient.recipient) }) {
+			continue
+		}
+		reason := strings.TrimSpace(recipient.recipient + ": " + recipient.status + " " + recipient.diagnostic)
+		reasons = append(reasons, reason)
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	_, err = s.outboundQueue.Fail(ctx, report.originalMessageID, strings.Join(reasons, "; "))
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// parseDeliveryReport reads a delivery status notification, reporting false if the email isn't one.
+//
+// The Message-ID of the original message is taken from the returned message or headers, falling back to In-Reply-To and References.
+func parseDeliveryReport(e domain.Email) (deliveryReport, bool) {
+	mediaType, params, err := mime.ParseMediaType(e.Message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" || !strings.EqualFold(params["report-type"], "delivery-status") {
+		return deliveryReport{}, false
+	}
+
+	var report deliveryReport
+	for _, attachment := range e.Attachments {
+		switch attachment.ContentType {
+		case "message/delivery-status", "message/global-delivery-status":
+			report.recipients = append(report.recipients, parseDeliveryStatus(attachment.Content)...)
+		case "message/rfc822", "message/global", "text/rfc822-headers", "message/global-headers":
+			if report.originalMessageID == "" {
+				report.originalMessageID = returnedMessageID(attachment.Content)
+			}
+		}
+	}
+
+	if report.originalMessageID == "" {
+		if ids := threadMessageIDs(e.Message.Header); len(ids) > 0 {
+			report.originalMessageID = ids[0]
+		}
+	}
+
+	return report, true
+}
+
+// parseDeliveryStatus parses the per-recipient fields of a message/delivery-status part.
+//
+// The part is a block of per-message fields followed by a block for each recipient, separated by blank lines.
+func parseDeliveryStatus(content []byte) []recipientStatus {
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(content)))
+	recipients := make([]recipientStatus, 0)
+	for {
+		fields, err := reader.ReadMIMEHeader()
+		if fields.Get("Final-Recipient") != "" || fields.Get("Original-Recipient") != "" {
+			recipient := fields.Get("Final-Recipient")
+			if recipient == "" {
+				recipient = fields.Get("Original-Recipient")
+			}
+			recipients = append(recipients, recipientStatus{
+				recipient:  typedValue(recipient),
+				action:     strings.ToLower(strings.TrimSpace(fields.Get("Action"))),
+				status:     strings.TrimSpace(fields.Get("Status")),
+				diagnostic: typedValue(fields.Get("Diagnostic-Code")),
+			})
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	return recipients
+}
+
+// typedValue strips the type from a field such as "rfc822; bob@example.com".
+func typedValue(value string) string {
+	if _, v, ok := strings.Cut(value, ";"); ok {
+		return strings.TrimSpace(v)
+	}
+	return strings.TrimSpace(value)
+}
+
+// returnedMessageID reads the Message-ID of a message or headers returned in a bounce.
+func returnedMessageID(content []byte) string {
+	// Returned headers have no body, so make sure the header block is terminated
+	msg, err := mail.ReadMessage(io.MultiReader(bytes.NewReader(content), strings.NewReader("\r\n\r\n")))
+	if err != nil {
+		return ""
+	}
+	return domain.ParseMessageID(msg.Header.Get("Message-ID"))
+}
@@ -0,0 +1,136 @@
+package email
+
+import (
+	"context"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bounce is a delivery status notification in the form Postfix sends them
+const bounce = "From: MAILER-DAEMON@mx.example.com (Mail Delivery System)\r\n" +
+	"To: support@test.com\r\n" +
+	"Subject: Undelivered Mail Returned to Sender\r\n" +
+	"Message-ID: <bounce-1@mx.example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/report; report-type=delivery-status; boundary=\"BOUNDARY\"\r\n" +
+	"\r\n" +
+	"--BOUNDARY\r\n" +
+	"Content-Description: Notification\r\n" +
+	"Content-Type: text/plain; charset=us-ascii\r\n" +
+	"\r\n" +
+	"I'm sorry to have to inform you that your message could not be delivered.\r\n" +
+	"\r\n" +
+	"--BOUNDARY\r\n" +
+	"Content-Description: Delivery report\r\n" +
+	"Content-Type: message/delivery-status\r\n" +
+	"\r\n" +
+	"Reporting-MTA: dns; mx.example.com\r\n" +
+	"Arrival-Date: Mon, 18 Sep 2023 17:58:07 +0000 (UTC)\r\n" +
+	"\r\n" +
+	"Final-Recipient: rfc822; nobody@example.com\r\n" +
+	"Original-Recipient: rfc822;nobody@example.com\r\n" +
+	"Action: failed\r\n" +
+	"Status: 5.1.1\r\n" +
+	"Diagnostic-Code: smtp; 550 5.1.1 <nobody@example.com>: Recipient address rejected\r\n" +
+	"\r\n" +
+	"Final-Recipient: rfc822; slow@example.com\r\n" +
+	"Action: delayed\r\n" +
+	"Status: 4.4.1\r\n" +
+	"\r\n" +
+	"--BOUNDARY\r\n" +
+	"Content-Description: Undelivered Message Headers\r\n" +
+	"Content-Type: text/rfc822-headers\r\n" +
+	"\r\n" +
+	"From: support@test.com\r\n" +
+	"To: nobody@example.com\r\n" +
+	"Subject: Re: Printer on fire [#1]\r\n" +
+	"Message-ID: <ticket-1.abc@test.com>\r\n" +
+	"\r\n" +
+	"--BOUNDARY--\r\n"
+
+func TestParseDeliveryReport(t *testing.T) {
+	repo := &mockMailServerRepository{emails: map[uint64]domain.Email{}}
+	svc, err := NewMailServerService(repo, &mockCacheDriver{cache: map[string]interface{}{}}, &mockEventBusDriver{})
+	require.NoError(t, err)
+
+	t.Run("DeliveryStatusNotification", func(t *testing.T) {
+		e := receive(t, svc, bounce)
+		report, ok := parseDeliveryReport(e)
+		assert.True(t, ok, "bounce should be recognised")
+		assert.Equal(t, "ticket-1.abc@test.com", report.originalMessageID, "original message id should come from the returned headers")
+		assert.Equal(t, []recipientStatus{
+			{recipient: "nobody@example.com", action: "failed", status: "5.1.1", diagnostic: "550 5.1.1 <nobody@example.com>: Recipient address rejected"},
+			{recipient: "slow@example.com", action: "delayed", status: "4.4.1"},
+		}, report.recipients)
+		assert.Len(t, report.failed(), 1)
+	})
+
+	t.Run("NoReturnedHeaders", func(t *testing.T) {
+		e := receive(t, svc, "In-Reply-To: <ticket-1.abc@test.com>\r\nContent-Type: multipart/report; report-type=delivery-status; boundary=B\r\n\r\n--B\r\nContent-Type: message/delivery-status\r\n\r\nReporting-MTA: dns; mx.example.com\r\n\r\nFinal-Recipient: rfc822; nobody@example.com\r\nAction: failed\r\nStatus: 5.0.0\r\n--B--\r\n")
+		report, ok := parseDeliveryReport(e)
+		assert.True(t, ok)
+		assert.Equal(t, "ticket-1.abc@test.com", report.originalMessageID, "original message id should fall back to In-Reply-To")
+	})
+
+	t.Run("NotAReport", func(t *testing.T) {
+		e := receive(t, svc, "Subject: Hello\r\nContent-Type: multipart/mixed; boundary=B\r\n\r\n--B\r\nContent-Type: text/plain\r\n\r\nHi\r\n--B--\r\n")
+		_, ok := parseDeliveryReport(e)
+		assert.False(t, ok, "ordinary mail shouldn't be treated as a bounce")
+	})
+}
+
+func TestBounce(t *testing.T) {
+	repo := &mockMailServerRepository{
+		authoritativeDomains: []string{"test.com"},
+		aliases:              []domain.Alias{{User: "support", Domain: "test.com", ID: 1}},
+		emails:               map[uint64]domain.Email{},
+	}
+	tickets := &mockTicketService{tickets: map[uint64]domain.Ticket{}}
+	queue := &mockOutboundQueue{queued: []domain.OutboundMessage{{ID: 1, MessageID: "ticket-1.abc@test.com", From: "support@test.com", To: []string{"nobody@example.com"}, Status: domain.OutboundStatusSent}}}
+	server := NewServer(repo, tickets, queue, &mockCacheDriver{cache: map[string]interface{}{}}, &mockEventBusDriver{}, nil)
+	envelope := Envelope{From: "", To: []string{"support@test.com"}}
+
+	t.Run("Forged", func(t *testing.T) {
+		for name, forged := range map[string]struct {
+			envelope Envelope
+			raw      string
+		}{
+			"Sender":     {Envelope{From: "mallory@example.com", To: []string{"support@test.com"}}, bounce},
+			"ReturnPath": {Envelope{To: []string{"sales@test.com"}}, bounce},
+			"Recipient":  {envelope, strings.ReplaceAll(bounce, "nobody@example.com", "someone@example.com")},
+		} {
+			err := server.ReceiveData(forged.envelope, strings.NewReader(forged.raw))
+			assert.NoError(t, err, name)
+			assert.Empty(t, queue.failed, "%s: reports that don't match the message sent shouldn't fail it", name)
+		}
+	})
+
+	t.Run("FailsQueuedMessage", func(t *testing.T) {
+		err := server.ReceiveData(envelope, strings.NewReader(bounce))
+		assert.NoError(t, err)
+		assert.Equal(t, "nobody@example.com: 5.1.1 550 5.1.1 <nobody@example.com>: Recipient address rejected", queue.failed["ticket-1.abc@test.com"], "bounced message should be failed")
+		assert.Empty(t, tickets.tickets, "bounces shouldn't open tickets")
+	})
+
+	t.Run("UnknownMessage", func(t *testing.T) {
+		err := server.ReceiveData(envelope, strings.NewReader(strings.ReplaceAll(bounce, "ticket-1.abc@test.com", "other@test.com")))
+		assert.NoError(t, err, "bounces for messages we didn't send should be ignored")
+		assert.Empty(t, tickets.tickets, "bounces shouldn't open tickets")
+	})
+}
+
+func receive(t *testing.T, svc *MailServerService, raw string) domain.Email {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	require.NoError(t, err)
+	e, err := domain.NewEmail(*msg)
+	require.NoError(t, err)
+	e, err = svc.CreateEmail(context.Background(), e)
+	require.NoError(t, err)
+	return e
+}
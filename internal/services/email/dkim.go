@@ -0,0 +1,82 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/mail"
+
+	"github.com/emersion/go-msgauth/dkim"
+	"github.com/nil-nil/ticket/internal/domain"
+)
+
+// Make sure we conform to domain.MailSender
+var _ domain.MailSender = (*DKIMSender)(nil)
+
+// dkimHeaderKeys are the headers covered by outbound signatures. Listing one the message lacks stops it being added in transit.
+var dkimHeaderKeys = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-ID", "In-Reply-To", "References",
+	"MIME-Version", "Content-Type", "Content-Transfer-Encoding",
+}
+
+// DKIMDomainFinder finds the domain whose key signs mail from it. domain.DNSDomainService is one.
+type DKIMDomainFinder interface {
+	GetDomainByName(ctx context.Context, name string) (domain.DNSDomain, error)
+}
+
+// NewDKIMSender returns a domain.MailSender signing each message with its From domain's DKIM key before passing it on.
+func NewDKIMSender(domains DKIMDomainFinder, sender domain.MailSender) *DKIMSender {
+	return &DKIMSender{domains: domains, sender: sender}
+}
+
+// DKIMSender signs outbound mail. Messages from domains without a key are sent unsigned.
+type DKIMSender struct {
+	domains DKIMDomainFinder
+	sender  domain.MailSender
+}
+
+// Send signs the message, then delivers it. Messages are signed at delivery so a retry after a key is replaced uses the new key.
+func (s *DKIMSender) Send(ctx context.Context, from string, to []string, message []byte) error {
+	signed, err := s.sign(ctx, message)
+	if err != nil {
+		return err
+	}
+
+	return s.sender.Send(ctx, from, to, signed)
+}
+
+func (s *DKIMSender) sign(ctx context.Context, message []byte) ([]byte, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(message))
+	if err != nil {
+		return nil, err
+	}
+	from := fromDomain(msg.Header)
+	if from == "" {
+		return message, nil
+	}
+
+	d, err := s.domains.GetDomainByName(ctx, from)
+	if errors.Is(err, domain.ErrNotFound) || (err == nil && d.DKIM == nil) {
+		return message, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := d.DKIM.Signer()
+	if err != nil {
+		return nil, err
+	}
+	var signed bytes.Buffer
+	err = dkim.Sign(&signed, bytes.NewReader(message), &dkim.SignOptions{
+		Domain:     from,
+		Selector:   d.DKIM.Selector,
+		Signer:     signer,
+		HeaderKeys: dkimHeaderKeys,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return signed.Bytes(), nil
+}
@@ -0,0 +1,94 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDKIMSender(t *testing.T) {
+	key, err := domain.NewDKIMKey(time.Now())
+	require.NoError(t, err)
+	record, err := key.Record()
+	require.NoError(t, err)
+
+	domains := mockDKIMDomains{
+		"example.com": {ID: 1, Name: "example.com", DKIM: &key},
+		"nokey.test":  {ID: 2, Name: "nokey.test"},
+	}
+	server := &Server{Resolver: &mockResolver{txt: map[string][]string{
+		key.Selector + "._domainkey.example.com": {record},
+	}}}
+	message := func(from string) []byte {
+		return []byte("From: " + from + "\r\nTo: alice@test.com\r\nSubject: Re: Help\r\nMessage-ID: <1@example.com>\r\n\r\nDone\r\n")
+	}
+
+	tests := []struct {
+		name       string
+		from       string
+		signatures []domain.AuthCheck
+		expectErr  bool
+	}{
+		{
+			name:       "Signed",
+			from:       "Support <Support@Example.com>",
+			signatures: []domain.AuthCheck{{Result: domain.AuthResultPass, Domain: "example.com"}},
+		},
+		{
+			name:       "NoKey",
+			from:       "support@nokey.test",
+			signatures: []domain.AuthCheck{},
+		},
+		{
+			name:       "UnknownDomain",
+			from:       "support@unknown.test",
+			signatures: []domain.AuthCheck{},
+		},
+		{
+			name:      "LookupError",
+			from:      "support@broken.test",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &mockMailSender{}
+			err := NewDKIMSender(domains, sender).Send(context.Background(), "support@example.com", []string{"alice@test.com"}, message(tt.from))
+			if tt.expectErr {
+				assert.Error(t, err)
+				assert.Nil(t, sender.sent, "unsigned mail shouldn't be sent when the key can't be found")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.signatures, server.checkDKIM(context.Background(), sender.sent), "the sent message should verify with the published record")
+		})
+	}
+}
+
+type mockDKIMDomains map[string]domain.DNSDomain
+
+func (m mockDKIMDomains) GetDomainByName(ctx context.Context, name string) (domain.DNSDomain, error) {
+	if name == "broken.test" {
+		return domain.DNSDomain{}, errors.New("database unavailable")
+	}
+	d, ok := m[name]
+	if !ok {
+		return domain.DNSDomain{}, domain.ErrNotFound
+	}
+	return d, nil
+}
+
+type mockMailSender struct {
+	sent []byte
+}
+
+func (m *mockMailSender) Send(ctx context.Context, from string, to []string, message []byte) error {
+	m.sent = message
+	return nil
+}
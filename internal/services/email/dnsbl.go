@@ -0,0 +1,91 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/nil-nil/ticket/internal/domain"
+)
+
+// DNSBLZone is a DNS blocklist such as zen.spamhaus.org, and the score of clients listed in it.
+type DNSBLZone struct {
+	Zone  string
+	Score float64
+}
+
+// NewDNSBLFilter returns a filter looking the client's IP up in each zone with the resolver, net.DefaultResolver in production.
+func NewDNSBLFilter(resolver Resolver, zones []DNSBLZone) *DNSBLFilter {
+	return &DNSBLFilter{resolver: resolver, zones: zones}
+}
+
+// DNSBLFilter scores mail from clients listed in DNS blocklists.
+//
+// Lookups that fail are treated as not listed, so an unreachable blocklist doesn't hold up mail.
+type DNSBLFilter struct {
+	resolver Resolver
+	zones    []DNSBLZone
+}
+
+func (f *DNSBLFilter) Check(ctx context.Context, envelope Envelope, e domain.Email) ([]domain.SpamRule, error) {
+	ip := envelope.RemoteIP
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() {
+		return nil, nil
+	}
+	name := reverseIP(ip)
+
+	listed := make([]bool, len(f.zones))
+	var wg sync.WaitGroup
+	for i, zone := range f.zones {
+		wg.Add(1)
+		go func(i int, zone DNSBLZone) {
+			defer wg.Done()
+			addrs, err := f.resolver.LookupIPAddr(ctx, name+"."+strings.TrimSuffix(zone.Zone, "."))
+			if err != nil {
+				return
+			}
+			for _, addr := range addrs {
+				if listingAddress(addr.IP) {
+					listed[i] = true
+					return
+				}
+			}
+		}(i, zone)
+	}
+	wg.Wait()
+
+	var rules []domain.SpamRule
+	for i, zone := range f.zones {
+		if listed[i] {
+			rules = append(rules, domain.SpamRule{Name: "DNSBL_" + zone.Zone, Score: zone.Score})
+		}
+	}
+	return rules, nil
+}
+
+// reverseIP returns the IP as a DNSBL query name: reversed octets for IPv4, and reversed nibbles for IPv6 (RFC 5782).
+func reverseIP(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+
+	ip16 := ip.To16()
+	nibbles := make([]string, 0, 2*len(ip16))
+	for i := len(ip16) - 1; i >= 0; i-- {
+		nibbles = append(nibbles, fmt.Sprintf("%x", ip16[i]&0x0f), fmt.Sprintf("%x", ip16[i]>>4))
+	}
+	return strings.Join(nibbles, ".")
+}
+
+// listingAddress reports whether a blocklist answer means the IP is listed.
+//
+// Listings are in 127.0.0.0/8, while some lists answer with 127.255.255.0/24 to report errors such as queries through public resolvers.
+func listingAddress(ip net.IP) bool {
+	ip4 := ip.To4()
+	if ip4 == nil || ip4[0] != 127 {
+		return false
+	}
+	return !(ip4[1] == 255 && ip4[2] == 255)
+}
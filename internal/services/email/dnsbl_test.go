@@ -0,0 +1,47 @@
+package email
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReverseIP(t *testing.T) {
+	assert.Equal(t, "2.0.0.192", reverseIP(net.ParseIP("192.0.0.2")))
+	assert.Equal(t, "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2", reverseIP(net.ParseIP("2001:db8::1")))
+}
+
+func TestDNSBLFilter(t *testing.T) {
+	resolver := &mockResolver{ip: map[string][]net.IPAddr{
+		"2.0.0.192.listed.example":   {{IP: net.ParseIP("127.0.0.2")}},
+		"2.0.0.192.error.example":    {{IP: net.ParseIP("127.255.255.254")}},
+		"2.0.0.192.wildcard.example": {{IP: net.ParseIP("192.0.2.1")}},
+	}}
+	filter := NewDNSBLFilter(resolver, []DNSBLZone{
+		{Zone: "listed.example", Score: 5},
+		{Zone: "error.example", Score: 5},
+		{Zone: "wildcard.example", Score: 5},
+		{Zone: "unlisted.example", Score: 5},
+	})
+
+	table := []struct {
+		description string
+		ip          net.IP
+		expectRules []domain.SpamRule
+	}{
+		{description: "listed client", ip: net.ParseIP("192.0.0.2"), expectRules: []domain.SpamRule{{Name: "DNSBL_listed.example", Score: 5}}},
+		{description: "unlisted client", ip: net.ParseIP("192.0.0.3")},
+		{description: "private client", ip: net.ParseIP("10.0.0.1")},
+		{description: "no client IP"},
+	}
+	for _, tc := range table {
+		t.Run(tc.description, func(t *testing.T) {
+			rules, err := filter.Check(context.Background(), Envelope{RemoteIP: tc.ip}, domain.Email{})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectRules, rules)
+		})
+	}
+}
@@ -1,9 +1,11 @@
 package email
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"io"
+	"net"
 	"net/mail"
 	"strings"
 
@@ -11,65 +13,255 @@ import (
 )
 
 var (
-	ErrBlockedSender       = errors.New("sender is blocked")
-	ErrInvalidEmailAddress = errors.New("invalid email address")
-	ErrAliasNotFound       = errors.New("alias is not found")
+	ErrBlockedSender        = errors.New("sender is blocked")
+	ErrInvalidEmailAddress  = errors.New("invalid email address")
+	ErrAliasNotFound        = errors.New("alias is not found")
+	ErrNotAuthoritative     = errors.New("domain is not handled by this server")
+	ErrAuthRequired         = errors.New("authentication is required")
+	ErrRelayDenied          = errors.New("relaying to domains not handled by this server requires authentication")
+	ErrSenderNotAllowed     = errors.New("sender address is not owned by the authenticated user")
+	ErrAuthenticationFailed = errors.New("message failed sender authentication")
 )
 
 type AuthFunc func(username, password string) (domain.User, error)
 
-func NewServer(mailServerRepo MailServerRepository, cacheDriver domain.CacheDriver, eventBusDriver domain.EventBusDriver, authFunc AuthFunc) *Server {
+// TicketService is the part of domain.TicketService used to turn inbound email into tickets.
+type TicketService interface {
+	GetTicket(ctx context.Context, ID uint64) (domain.Ticket, error)
+	OpenTicket(ctx context.Context, Description string) (domain.Ticket, error)
+	UpdateTicket(ctx context.Context, ID uint64, Params domain.TicketUpdateParameters) (domain.Ticket, error)
+}
+
+// OutboundQueue is the part of domain.OutboundQueue used to send mail and record bounces.
+type OutboundQueue interface {
+	Enqueue(ctx context.Context, msg domain.OutboundMessage) (domain.OutboundMessage, error)
+	Find(ctx context.Context, messageID string) (domain.OutboundMessage, error)
+	Fail(ctx context.Context, messageID string, reason string) (domain.OutboundMessage, error)
+}
+
+// Envelope is the SMTP envelope a message was delivered with.
+type Envelope struct {
+	From string
+	To   []string
+	// User is who the session authenticated as, nil if it didn't
+	User *domain.User
+	// RemoteIP and Helo identify the client for SPF checks
+	RemoteIP net.IP
+	Helo     string
+}
+
+func NewServer(mailServerRepo MailServerRepository, ticketService TicketService, outboundQueue OutboundQueue, cacheDriver domain.CacheDriver, eventBusDriver domain.EventBusDriver, authFunc AuthFunc) *Server {
 	svc, _ := NewMailServerService(mailServerRepo, cacheDriver, eventBusDriver)
 	return &Server{
-		AuthFunc:    authFunc,
-		mailService: svc,
+		Hostname:      "localhost",
+		AuthFunc:      authFunc,
+		mailService:   svc,
+		ticketService: ticketService,
+		outboundQueue: outboundQueue,
 	}
 }
 
 type Server struct {
-	AuthFunc    AuthFunc
-	mailService *MailServerService
+	// Hostname identifies us in the Authentication-Results headers we add
+	Hostname string
+	AuthFunc AuthFunc
+	// RequireAuth is set for submission, where every sender must authenticate rather than only those relaying mail
+	RequireAuth bool
+	// Resolver enables SPF, DKIM and DMARC checks of inbound mail, with AuthPolicy deciding what to do with failures
+	Resolver   Resolver
+	AuthPolicy AuthPolicy
+	// SpamFilters score inbound mail from unauthenticated senders, with SpamPolicy deciding what to do with spam
+	SpamFilters   []SpamFilter
+	SpamPolicy    SpamPolicy
+	mailService   *MailServerService
+	ticketService TicketService
+	outboundQueue OutboundQueue
 }
 
-func (s *Server) ValidateSenderAddress(address string) error {
+// ValidateSenderAddress checks the user may send mail from the address.
+//
+// Unauthenticated senders are accepted unless RequireAuth is set, as they can only deliver to our aliases.
+// Authenticated users may only send as aliases they own, including their subaddresses, and never through a catch-all alias.
+func (s *Server) ValidateSenderAddress(user *domain.User, address string) error {
+	if user == nil {
+		if s.RequireAuth {
+			return ErrAuthRequired
+		}
+		return nil
+	}
+
+	match, err := s.mailService.findAlias(context.Background(), address)
+	if errors.Is(err, ErrNotAuthoritative) || errors.Is(err, ErrAliasNotFound) || errors.Is(err, ErrInvalidEmailAddress) {
+		return ErrSenderNotAllowed
+	}
+	if err != nil {
+		return err
+	}
+	if match.Alias.IsCatchAll() || !match.Alias.IsOwnedBy(user.ID) {
+		return ErrSenderNotAllowed
+	}
+
 	return nil
 }
 
-func (s *Server) ValidateRecipientAddress(address string) error {
-	user, mailDomain, err := getUserAndDomainParts(address)
+// ValidateRecipientAddress checks mail for the address may be accepted.
+//
+// Addresses in our domains must resolve to a live alias, directly, by their subaddress or through a catch-all,
+// and addresses elsewhere are only relayed for authenticated users.
+func (s *Server) ValidateRecipientAddress(user *domain.User, address string) error {
+	_, err := s.mailService.findAlias(context.Background(), address)
+	if errors.Is(err, ErrNotAuthoritative) {
+		if user == nil {
+			return ErrRelayDenied
+		}
+		return nil
+	}
+
+	return err
+}
+
+// ReceiveData stores an inbound message and, if it was delivered to one of our aliases, opens or updates its ticket.
+//
+// Delivery status notifications are treated as bounces of the message they report on rather than opening tickets.
+// Mail from authenticated users is queued for delivery to recipients outside our domains, other mail is checked with SPF, DKIM and DMARC if a Resolver is set.
+// Mail from unauthenticated senders then goes through the spam filters, and is refused, quarantined or tagged as spam depending on its score.
+// Quarantined mail, including mail failing the AuthPolicy's quarantine checks and mail to private aliases from unknown senders,
+// is stored without a ticket until it's released.
+func (s *Server) ReceiveData(envelope Envelope, reader io.Reader) error {
+	raw, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
 	if err != nil {
-		return ErrInvalidEmailAddress
+		return err
+	}
+	if msg == nil {
+		return errors.New("invalid message")
 	}
 
-	if authoritative := s.mailService.IsAuthoritative(mailDomain); !authoritative {
-		return nil
+	ctx := context.Background()
+	if envelope.User != nil {
+		local, err := s.relay(ctx, envelope, msg.Header, raw)
+		if err != nil {
+			return err
+		}
+		if len(local) == 0 {
+			return nil
+		}
+		envelope.To = local
 	}
 
-	alias, err := s.mailService.GetAlias(context.Background(), user, mailDomain)
-	if errors.Is(err, domain.ErrNotFound) {
-		return ErrAliasNotFound
-	} else if err != nil {
+	// Mail from our own users was authenticated by the session
+	var (
+		authentication *domain.EmailAuthentication
+		authHeld       string
+	)
+	if envelope.User == nil && envelope.RemoteIP != nil && s.Resolver != nil {
+		auth, held, err := s.authenticate(ctx, envelope, msg.Header, raw)
+		if err != nil {
+			return err
+		}
+		authentication, authHeld = &auth, held
+	}
+
+	e, err := domain.NewEmail(*msg)
+	if err != nil {
 		return err
 	}
-	if alias.DeletedAt != nil {
-		return ErrAliasNotFound
+	e.Raw, e.Authentication = raw, authentication
+	if envelope.User == nil {
+		e.Spam, err = s.checkSpam(ctx, envelope, e)
+		if err != nil {
+			return err
+		}
+		e.Quarantine, err = s.checkQuarantine(ctx, envelope, e, authHeld)
+		if err != nil {
+			return err
+		}
 	}
 
-	return nil
+	e, err = s.mailService.CreateEmail(ctx, e)
+	if err != nil {
+		return err
+	}
+	if e.Quarantine != nil {
+		return nil
+	}
+
+	if report, ok := parseDeliveryReport(e); ok {
+		return s.handleBounce(ctx, envelope, report)
+	}
+
+	return s.ticketEmail(ctx, envelope, e)
 }
 
-func (s *Server) ReceiveData(reader io.Reader) error {
-	msg, err := mail.ReadMessage(reader)
-	if err != nil {
+// DeliverData receives a message like ReceiveData, reporting a status for each recipient as LMTP requires.
+//
+// Recipients are checked again as their alias may have been removed since they were accepted, and status is called with the reason for each that fails.
+// The message is stored once for the rest, so they share the returned error.
+func (s *Server) DeliverData(envelope Envelope, reader io.Reader, status func(recipient string, err error)) error {
+	valid := make([]string, 0, len(envelope.To))
+	for _, recipient := range envelope.To {
+		if err := s.ValidateRecipientAddress(envelope.User, recipient); err != nil {
+			status(recipient, err)
+			continue
+		}
+		valid = append(valid, recipient)
+	}
+	if len(valid) == 0 {
+		_, err := io.Copy(io.Discard, reader)
 		return err
 	}
-	if msg == nil {
-		return errors.New("invalid message")
+
+	envelope.To = valid
+	return s.ReceiveData(envelope, reader)
+}
+
+// relay queues a message submitted by an authenticated user for its recipients outside our domains, returning the rest.
+//
+// The From header must only name aliases the user owns, like the envelope sender.
+func (s *Server) relay(ctx context.Context, envelope Envelope, header mail.Header, raw []byte) (local []string, err error) {
+	from, err := header.AddressList("From")
+	if err != nil {
+		return nil, ErrSenderNotAllowed
+	}
+	for _, address := range from {
+		if err := s.ValidateSenderAddress(envelope.User, address.Address); err != nil {
+			return nil, err
+		}
 	}
 
-	_, err = s.mailService.CreateEmail(context.Background(), *msg)
+	remote := make([]string, 0, len(envelope.To))
+	for _, recipient := range envelope.To {
+		_, mailDomain, err := getUserAndDomainParts(recipient)
+		if err != nil {
+			return nil, err
+		}
+		if s.mailService.IsAuthoritative(mailDomain) {
+			local = append(local, recipient)
+		} else {
+			remote = append(remote, recipient)
+		}
+	}
+	if len(remote) == 0 {
+		return local, nil
+	}
+	if s.outboundQueue == nil {
+		return nil, ErrRelayDenied
+	}
 
-	return err
+	_, err = s.outboundQueue.Enqueue(ctx, domain.OutboundMessage{
+		MessageID: domain.ParseMessageID(header.Get("Message-ID")),
+		From:      envelope.From,
+		To:        remote,
+		Message:   raw,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return local, nil
 }
 
 func getUserAndDomainParts(address string) (user, domain string, err error) {
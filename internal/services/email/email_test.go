@@ -7,47 +7,98 @@ import (
 
 	"github.com/nil-nil/ticket/internal/domain"
 	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/ptr"
 )
 
 func TestValidateSenderAddress(t *testing.T) {
+	now := time.Now()
 	repo := &mockMailServerRepository{
-		authoritativeDomains: []string{"example.com"},
+		authoritativeDomains: []string{"test.com"},
+		aliases: []domain.Alias{
+			{User: "support", Domain: "test.com", ID: 1, OwnerID: ptr.To(uint64(1))},
+			{User: "sales", Domain: "test.com", ID: 2, OwnerID: ptr.To(uint64(2))},
+			{User: "old", Domain: "test.com", ID: 3, OwnerID: ptr.To(uint64(1)), DeletedAt: &now},
+			{User: "shared", Domain: "test.com", ID: 4},
+			{User: domain.CatchAllUser, Domain: "test.com", ID: 5, OwnerID: ptr.To(uint64(1))},
+		},
 	}
+	owner := &domain.User{ID: 1}
 
-	server := NewServer(repo, mockCache, &mockEventBusDriver{}, func(username, password string) (domain.User, error) { return domain.User{}, nil })
+	table := []struct {
+		description string
+		requireAuth bool
+		user        *domain.User
+		email       string
+		expectErr   error
+	}{
+		{description: "unauthenticated sender", email: "alan@example.com", expectErr: nil},
+		{description: "unauthenticated null sender", email: "", expectErr: nil},
+		{description: "unauthenticated sender when auth is required", requireAuth: true, email: "alan@example.com", expectErr: ErrAuthRequired},
+		{description: "owned alias", user: owner, email: "support@test.com", expectErr: nil},
+		{description: "owned alias when auth is required", requireAuth: true, user: owner, email: "support@test.com", expectErr: nil},
+		{description: "owned alias in another case", user: owner, email: "Support@Test.com", expectErr: nil},
+		{description: "owned alias subaddress", user: owner, email: "support+billing@test.com", expectErr: nil},
+		{description: "catch-all alias", user: owner, email: "anyone@test.com", expectErr: ErrSenderNotAllowed},
+		{description: "alias owned by someone else", user: owner, email: "sales@test.com", expectErr: ErrSenderNotAllowed},
+		{description: "alias without an owner", user: owner, email: "shared@test.com", expectErr: ErrSenderNotAllowed},
+		{description: "deleted alias", user: owner, email: "old@test.com", expectErr: ErrSenderNotAllowed},
+		{description: "missing alias", user: owner, email: "nobody@test.com", expectErr: ErrSenderNotAllowed},
+		{description: "non-authoritative address", user: owner, email: "alan@example.com", expectErr: ErrSenderNotAllowed},
+		{description: "null sender", user: owner, email: "", expectErr: ErrSenderNotAllowed},
+	}
 
-	t.Run("test valid sender", func(t *testing.T) {
-		err := server.ValidateSenderAddress("alan@example.com")
-		assert.NoError(t, err)
-	})
+	for _, tc := range table {
+		t.Run(tc.description, func(t *testing.T) {
+			server := NewServer(repo, nil, nil, &mockCacheDriver{cache: map[string]interface{}{}}, &mockEventBusDriver{}, nil)
+			server.RequireAuth = tc.requireAuth
+			err := server.ValidateSenderAddress(tc.user, tc.email)
+			if tc.expectErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tc.expectErr)
+			}
+		})
+	}
 }
 
 func TestValidateRecipientAddress(t *testing.T) {
 	now := time.Now()
 	repo := &mockMailServerRepository{
-		authoritativeDomains: []string{"test.com"},
+		authoritativeDomains: []string{"test.com", "catchall.com"},
 		aliases: []domain.Alias{
 			{User: "test", Domain: "test.com", ID: 1},
 			{User: "bob", Domain: "test.com", ID: 2, DeletedAt: &now},
+			{User: domain.CatchAllUser, Domain: "catchall.com", ID: 3},
+			{User: "support", Domain: "catchall.com", ID: 4},
 		},
 	}
 
-	server := NewServer(repo, mockCache, &mockEventBusDriver{}, func(username, password string) (domain.User, error) { return domain.User{}, nil })
+	server := NewServer(repo, nil, nil, mockCache, &mockEventBusDriver{}, func(username, password string) (domain.User, error) { return domain.User{}, nil })
 
 	table := []struct {
 		description string
+		user        *domain.User
 		email       string
 		expectErr   error
 	}{
-		{description: "valid non-authoritative recipient", email: "alan@example.com", expectErr: nil},
+		{description: "unauthenticated non-authoritative recipient", email: "alan@example.com", expectErr: ErrRelayDenied},
+		{description: "authenticated non-authoritative recipient", user: &domain.User{ID: 1}, email: "alan@example.com", expectErr: nil},
 		{description: "valid authoritative recipient", email: "test@test.com", expectErr: nil},
 		{description: "invalid authoritative recipient", email: "fail@test.com", expectErr: ErrAliasNotFound},
+		{description: "invalid authoritative recipient for authenticated user", user: &domain.User{ID: 1}, email: "fail@test.com", expectErr: ErrAliasNotFound},
 		{description: "valid but deleted authoritative recipient", email: "bob@test.com", expectErr: ErrAliasNotFound},
+		{description: "recipient in another case", email: "TEST@Test.COM", expectErr: nil},
+		{description: "subaddressed recipient", email: "test+billing@test.com", expectErr: nil},
+		{description: "subaddress of a missing alias", email: "fail+billing@test.com", expectErr: ErrAliasNotFound},
+		{description: "subaddress of a deleted alias", email: "bob+billing@test.com", expectErr: ErrAliasNotFound},
+		{description: "empty local part before the subaddress", email: "+billing@test.com", expectErr: ErrAliasNotFound},
+		{description: "catch-all recipient", email: "anyone@catchall.com", expectErr: nil},
+		{description: "catch-all subaddressed recipient", email: "anyone+billing@catchall.com", expectErr: nil},
 	}
 
 	for _, tc := range table {
 		t.Run(tc.description, func(t *testing.T) {
-			err := server.ValidateRecipientAddress(tc.email)
+			err := server.ValidateRecipientAddress(tc.user, tc.email)
 			if tc.expectErr == nil {
 				assert.NoError(t, err)
 			} else {
@@ -86,9 +137,9 @@ Content-Transfer-Encoding: quoted-printable
 			emails: map[uint64]domain.Email{},
 		}
 
-		server := NewServer(repo, mockCache, &mockEventBusDriver{}, func(username, password string) (domain.User, error) { return domain.User{}, nil })
+		server := NewServer(repo, nil, nil, mockCache, &mockEventBusDriver{}, func(username, password string) (domain.User, error) { return domain.User{}, nil })
 
-		err := server.ReceiveData(strings.NewReader(message))
+		err := server.ReceiveData(Envelope{From: "bob@example.com", To: []string{"test@test.com"}}, strings.NewReader(message))
 		assert.NoError(t, err, "Valid Email shouldn't error")
 
 		email, ok := repo.emails[1]
@@ -104,10 +155,103 @@ Content-Transfer-Encoding: quoted-printable
 			emails: map[uint64]domain.Email{},
 		}
 
-		server := NewServer(repo, mockCache, &mockEventBusDriver{}, func(username, password string) (domain.User, error) { return domain.User{}, nil })
+		server := NewServer(repo, nil, nil, mockCache, &mockEventBusDriver{}, func(username, password string) (domain.User, error) { return domain.User{}, nil })
 
-		err := server.ReceiveData(strings.NewReader(message))
+		err := server.ReceiveData(Envelope{From: "bob@example.com", To: []string{"test@test.com"}}, strings.NewReader(message))
 		assert.Error(t, err, "Invalid Email should error")
 		assert.Equal(t, 0, len(repo.emails), "No email should be created on error")
 	})
 }
+
+func TestRelay(t *testing.T) {
+	repo := &mockMailServerRepository{
+		authoritativeDomains: []string{"test.com"},
+		aliases:              []domain.Alias{{User: "support", Domain: "test.com", ID: 1, OwnerID: ptr.To(uint64(1))}},
+		emails:               map[uint64]domain.Email{},
+	}
+	tickets := &mockTicketService{tickets: map[uint64]domain.Ticket{}}
+	owner := &domain.User{ID: 1}
+	message := "Message-ID: <1@test.com>\r\nFrom: support@test.com\r\nTo: alan@example.com, support@test.com\r\nSubject: Hello\r\n\r\nBody\r\n"
+
+	t.Run("SplitsRecipients", func(t *testing.T) {
+		queue := &mockOutboundQueue{}
+		server := NewServer(repo, tickets, queue, &mockCacheDriver{cache: map[string]interface{}{}}, &mockEventBusDriver{}, nil)
+		envelope := Envelope{From: "support@test.com", To: []string{"alan@example.com", "support@test.com"}, User: owner}
+		err := server.ReceiveData(envelope, strings.NewReader(message))
+		assert.NoError(t, err)
+		if assert.Len(t, queue.queued, 1, "mail should be queued for relay") {
+			assert.Equal(t, []string{"alan@example.com"}, queue.queued[0].To, "only remote recipients should be relayed")
+			assert.Equal(t, "1@test.com", queue.queued[0].MessageID)
+			assert.Equal(t, message, string(queue.queued[0].Message), "message should be relayed unchanged")
+		}
+		assert.Len(t, repo.emails, 1, "local recipients should still receive the mail")
+	})
+
+	t.Run("ForgedFromHeader", func(t *testing.T) {
+		queue := &mockOutboundQueue{}
+		server := NewServer(repo, tickets, queue, &mockCacheDriver{cache: map[string]interface{}{}}, &mockEventBusDriver{}, nil)
+		envelope := Envelope{From: "support@test.com", To: []string{"alan@example.com"}, User: owner}
+		err := server.ReceiveData(envelope, strings.NewReader(strings.Replace(message, "From: support@test.com", "From: ceo@test.com", 1)))
+		assert.ErrorIs(t, err, ErrSenderNotAllowed)
+		assert.Empty(t, queue.queued, "forged mail shouldn't be relayed")
+	})
+
+	t.Run("NoQueue", func(t *testing.T) {
+		server := NewServer(repo, tickets, nil, &mockCacheDriver{cache: map[string]interface{}{}}, &mockEventBusDriver{}, nil)
+		envelope := Envelope{From: "support@test.com", To: []string{"alan@example.com"}, User: owner}
+		err := server.ReceiveData(envelope, strings.NewReader(message))
+		assert.ErrorIs(t, err, ErrRelayDenied, "mail can't be relayed without a queue")
+	})
+}
+
+func TestDeliverData(t *testing.T) {
+	message := "Message-ID: <1@example.com>\r\nFrom: bob@example.com\r\nTo: support@test.com\r\nSubject: Hello\r\n\r\nBody\r\n"
+
+	tests := []struct {
+		name          string
+		to            []string
+		expected      map[string]error
+		expectCreated bool
+	}{
+		{
+			name:          "AllDelivered",
+			to:            []string{"support@test.com", "sales@test.com"},
+			expected:      map[string]error{},
+			expectCreated: true,
+		},
+		{
+			name:          "RemovedAlias",
+			to:            []string{"support@test.com", "gone@test.com", "alan@example.com"},
+			expected:      map[string]error{"gone@test.com": ErrAliasNotFound, "alan@example.com": ErrRelayDenied},
+			expectCreated: true,
+		},
+		{
+			name:     "NoRecipientsLeft",
+			to:       []string{"gone@test.com"},
+			expected: map[string]error{"gone@test.com": ErrAliasNotFound},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockMailServerRepository{
+				authoritativeDomains: []string{"test.com"},
+				aliases:              []domain.Alias{{User: "support", Domain: "test.com", ID: 1}, {User: "sales", Domain: "test.com", ID: 2}},
+				emails:               map[uint64]domain.Email{},
+			}
+			server := NewServer(repo, nil, nil, &mockCacheDriver{cache: map[string]interface{}{}}, &mockEventBusDriver{}, nil)
+
+			statuses := map[string]error{}
+			err := server.DeliverData(Envelope{From: "bob@example.com", To: tt.to}, strings.NewReader(message), func(recipient string, err error) {
+				statuses[recipient] = err
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, statuses, "only failed recipients should be given their own status")
+			if tt.expectCreated {
+				assert.Len(t, repo.emails, 1, "the message should be stored once for every recipient")
+			} else {
+				assert.Empty(t, repo.emails, "nothing should be stored without a recipient")
+			}
+		})
+	}
+}
@@ -2,14 +2,21 @@ package email
 
 import (
 	"context"
-	"net/mail"
+	"errors"
+	"fmt"
 	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/nil-nil/ticket/internal/domain"
 )
 
+// subaddressSeparator separates the local part of an address from its subaddress (RFC 5233)
+const subaddressSeparator = "+"
+
 func NewMailServerService(repo MailServerRepository, cacheDriver domain.CacheDriver, eventBusDriver domain.EventBusDriver) (*MailServerService, error) {
-	aliasCache, err := domain.NewCache[[]domain.Alias]("mailaliases", cacheDriver)
+	aliasCache, err := domain.NewCache[domain.Cached[[]domain.Alias]]("mailaliases", cacheDriver)
 	if err != nil {
 		return nil, err
 	}
@@ -17,64 +24,275 @@ func NewMailServerService(repo MailServerRepository, cacheDriver domain.CacheDri
 	if err != nil {
 		return nil, err
 	}
+	domainEventBus, err := domain.NewEventBus[domain.DNSDomain]("dnsdomains", eventBusDriver)
+	if err != nil {
+		return nil, err
+	}
+	emailEventBus, err := domain.NewEventBus[domain.Email]("emails", eventBusDriver)
+	if err != nil {
+		return nil, err
+	}
 	svc := &MailServerService{
-		repo:          repo,
-		aliasCache:    aliasCache,
-		aliasEventBus: aliasEventBus,
+		repo:           repo,
+		cacheTTL:       domain.CacheTTL,
+		aliasCache:     aliasCache,
+		aliasEventBus:  aliasEventBus,
+		domainEventBus: domainEventBus,
+		emailEventBus:  emailEventBus,
 	}
 	aliasEventBus.Subscribe(nil, []domain.EventType{domain.CreateEvent, domain.UpdateEvent, domain.DeleteEvent}, svc.ObserveAliasEvents)
+	domainEventBus.Subscribe(nil, []domain.EventType{domain.CreateEvent, domain.UpdateEvent, domain.DeleteEvent}, svc.ObserveDomainEvents)
 	return svc, nil
 }
 
 type MailServerService struct {
-	repo          MailServerRepository
-	domainCache   *[]string
-	aliasCache    *domain.Cache[[]domain.Alias]
-	aliasEventBus *domain.EventBus[domain.Alias]
+	repo     MailServerRepository
+	cacheTTL time.Duration
+	// domainCache is the authoritative domains, nil until they're first needed. It's replaced as a whole, so readers never see a partial list
+	domainCache    atomic.Pointer[domain.Cached[[]string]]
+	aliasCache     *domain.Cache[domain.Cached[[]domain.Alias]]
+	aliasEventBus  *domain.EventBus[domain.Alias]
+	domainEventBus *domain.EventBus[domain.DNSDomain]
+	emailEventBus  *domain.EventBus[domain.Email]
 }
 
 func (s *MailServerService) ObserveAliasEvents(eventType domain.EventType, data domain.Alias) {
-	aliases, err := s.repo.GetAliases(context.Background(), &data.Domain)
+	s.loadAliases(context.Background(), strings.ToLower(data.Domain))
+}
+
+// ObserveDomainEvents reloads the authoritative domains when a domain is added, verified, renamed or removed,
+// along with the domain's aliases, which move with a renamed domain and are deactivated with a deleted one.
+func (s *MailServerService) ObserveDomainEvents(eventType domain.EventType, data domain.DNSDomain) {
+	s.loadDomains(context.Background())
+	s.loadAliases(context.Background(), strings.ToLower(data.Name))
+}
+
+// loadDomains replaces the cached authoritative domains with the repository's, keeping the old ones if that fails.
+func (s *MailServerService) loadDomains(ctx context.Context) (*domain.Cached[[]string], error) {
+	domains, err := s.repo.GetAuthoritativeDomains(ctx)
 	if err != nil {
-		return
+		return nil, err
 	}
-	s.aliasCache.Set(data.Domain, aliases)
+	cached := &domain.Cached[[]string]{Value: domains, LoadedAt: time.Now()}
+	s.domainCache.Store(cached)
+	return cached, nil
 }
 
-func (s *MailServerService) IsAuthoritative(domain string) bool {
-	if s.domainCache == nil {
-		domains, err := s.repo.GetAuthoritativeDomains(context.Background())
-		if err != nil {
+// loadAliases replaces the domain's cached aliases with the repository's.
+func (s *MailServerService) loadAliases(ctx context.Context, mailDomain string) ([]domain.Alias, error) {
+	aliases, err := s.repo.GetAliases(ctx, &mailDomain)
+	if err != nil {
+		return nil, err
+	}
+	s.aliasCache.Set(mailDomain, domain.Cached[[]domain.Alias]{Value: aliases, LoadedAt: time.Now()})
+	return aliases, nil
+}
+
+// IsAuthoritative checks whether we handle mail for the domain, regardless of case.
+//
+// The domains are reloaded once they've been cached for longer than domain.CacheTTL, the old ones still being used if that fails.
+func (s *MailServerService) IsAuthoritative(mailDomain string) bool {
+	domains := s.domainCache.Load()
+	if domains == nil || !domains.Fresh(s.cacheTTL) {
+		if loaded, err := s.loadDomains(context.Background()); err == nil {
+			domains = loaded
+		} else if domains == nil {
 			return false
 		}
-		s.domainCache = &domains
 	}
-	return slices.Contains[[]string](*s.domainCache, domain)
+	return slices.ContainsFunc(domains.Value, func(d string) bool {
+		return strings.EqualFold(d, mailDomain)
+	})
 }
 
+// GetAlias returns the alias for a user, regardless of case, falling back to the domain's catch-all alias.
 func (s *MailServerService) GetAlias(ctx context.Context, user string, mailDomain string) (domain.Alias, error) {
-	aliasList, err := s.aliasCache.Get(mailDomain)
+	alias, catchAll, err := s.lookupAlias(ctx, user, mailDomain)
+	if err != nil {
+		return domain.Alias{}, err
+	}
+	if alias != nil {
+		return *alias, nil
+	}
+	if catchAll != nil {
+		return *catchAll, nil
+	}
+	return domain.Alias{}, ErrAliasNotFound
+}
+
+// lookupAlias returns the alias matching the user regardless of case, and the domain's catch-all alias, either of which may be nil.
+//
+// Like the domains, aliases cached for longer than domain.CacheTTL are reloaded, the old ones still being used if that fails.
+func (s *MailServerService) lookupAlias(ctx context.Context, user string, mailDomain string) (alias, catchAll *domain.Alias, err error) {
+	mailDomain = strings.ToLower(mailDomain)
+	cached, err := s.aliasCache.Get(mailDomain)
+	aliasList := cached.Value
+	if err != nil || !cached.Fresh(s.cacheTTL) {
+		loaded, loadErr := s.loadAliases(ctx, mailDomain)
+		if loadErr == nil {
+			aliasList = loaded
+		} else if err != nil {
+			return nil, nil, loadErr
+		}
+	}
+	for i := range aliasList {
+		if !strings.EqualFold(aliasList[i].Domain, mailDomain) || aliasList[i].DeletedAt != nil {
+			continue
+		}
+		switch {
+		case aliasList[i].IsCatchAll():
+			catchAll = &aliasList[i]
+		case strings.EqualFold(aliasList[i].User, user):
+			alias = &aliasList[i]
+		}
+	}
+	return alias, catchAll, nil
+}
+
+// aliasMatch is the alias an address resolved to.
+type aliasMatch struct {
+	Alias domain.Alias
+	// Address is the address as the alias answers to it: lower case, keeping the subaddress
+	Address string
+	// Tag is the subaddress, "billing" in support+billing@example.com
+	Tag string
+}
+
+// findAlias resolves an address to a live alias.
+//
+// Local parts match regardless of case. An address with no alias of its own is tried without its subaddress,
+// so support+billing@example.com goes to the support alias tagged "billing", and then falls back to the domain's catch-all alias.
+// ErrNotAuthoritative is returned if we don't handle mail for the address's domain.
+func (s *MailServerService) findAlias(ctx context.Context, address string) (aliasMatch, error) {
+	user, mailDomain, err := getUserAndDomainParts(address)
+	if err != nil {
+		return aliasMatch{}, ErrInvalidEmailAddress
+	}
+	user, mailDomain = strings.ToLower(user), strings.ToLower(mailDomain)
+
+	if authoritative := s.IsAuthoritative(mailDomain); !authoritative {
+		return aliasMatch{}, ErrNotAuthoritative
+	}
+
+	alias, catchAll, err := s.lookupAlias(ctx, user, mailDomain)
 	if err != nil {
-		aliasList, err = s.repo.GetAliases(ctx, &mailDomain)
+		return aliasMatch{}, err
+	}
+	match := aliasMatch{Address: user + "@" + mailDomain}
+	if base, tag, ok := strings.Cut(user, subaddressSeparator); ok && alias == nil && base != "" {
+		alias, _, err = s.lookupAlias(ctx, base, mailDomain)
 		if err != nil {
-			return domain.Alias{}, err
+			return aliasMatch{}, err
 		}
-		s.aliasCache.Set(mailDomain, aliasList)
+		match.Tag = tag
+	}
+	switch {
+	case alias != nil:
+		match.Alias = *alias
+	case catchAll != nil:
+		match.Alias = *catchAll
+	default:
+		return aliasMatch{}, ErrAliasNotFound
+	}
+
+	return match, nil
+}
+
+// CreateEmail stores an email along with the results of authenticating and scoring it, publishing a create event.
+func (s *MailServerService) CreateEmail(ctx context.Context, e domain.Email) (domain.Email, error) {
+	e, err := s.repo.CreateEmail(ctx, e)
+	if err != nil {
+		return domain.Email{}, err
+	}
+	if err := s.emailEventBus.Publish(fmt.Sprint(e.ID), domain.CreateEvent, e); err != nil {
+		return domain.Email{}, err
 	}
-	for _, alias := range aliasList {
-		if alias.Domain == mailDomain && alias.User == user {
-			return alias, nil
+	return e, nil
+}
+
+// createEmailThen stores an email and calls then before publishing a create event, deleting the email again if then fails.
+func (s *MailServerService) createEmailThen(ctx context.Context, e domain.Email, then func(domain.Email) error) (domain.Email, error) {
+	e, err := s.repo.CreateEmail(ctx, e)
+	if err != nil {
+		return domain.Email{}, err
+	}
+	if err := then(e); err != nil {
+		if deleteErr := s.repo.DeleteEmail(ctx, e.ID); deleteErr != nil {
+			return domain.Email{}, fmt.Errorf("%w, and deleting email %d failed: %w", err, e.ID, deleteErr)
 		}
+		return domain.Email{}, err
 	}
-	return domain.Alias{}, ErrAliasNotFound
+	if err := s.emailEventBus.Publish(fmt.Sprint(e.ID), domain.CreateEvent, e); err != nil {
+		return domain.Email{}, err
+	}
+	return e, nil
+}
+
+// FindReplyTicket returns the ID of the ticket an email is a reply to.
+//
+// The message IDs in In-Reply-To and References are looked up first, newest first, falling back to a ticket token such as "[#123]" in the subject.
+// domain.ErrNotFound is returned if the email doesn't look like a reply to a ticket.
+func (s *MailServerService) FindReplyTicket(ctx context.Context, e domain.Email) (uint64, error) {
+	for _, messageID := range threadMessageIDs(e.Message.Header) {
+		ticketID, err := s.repo.FindTicketIDByMessageID(ctx, messageID)
+		if err == nil {
+			return ticketID, nil
+		}
+		if !errors.Is(err, domain.ErrNotFound) {
+			return 0, err
+		}
+	}
+
+	if ticketID, ok := ParseSubjectToken(e.Subject); ok {
+		return ticketID, nil
+	}
+
+	return 0, domain.ErrNotFound
+}
+
+// LinkTicket records that an email belongs to a ticket, publishing an update event with the email's TicketID set.
+func (s *MailServerService) LinkTicket(ctx context.Context, e domain.Email, ticketID uint64) error {
+	if err := s.repo.LinkTicket(ctx, e.ID, ticketID); err != nil {
+		return err
+	}
+	e.TicketID = &ticketID
+	return s.emailEventBus.Publish(fmt.Sprint(e.ID), domain.UpdateEvent, e)
+}
+
+// FindTicketIDByMessageID returns the ticket a message ID was indexed for, domain.ErrNotFound if it wasn't.
+func (s *MailServerService) FindTicketIDByMessageID(ctx context.Context, messageID string) (uint64, error) {
+	if messageID == "" {
+		return 0, domain.ErrNotFound
+	}
+	return s.repo.FindTicketIDByMessageID(ctx, messageID)
+}
+
+// IndexMessageID records that a message ID belongs to a ticket, so replies to it can be threaded.
+func (s *MailServerService) IndexMessageID(ctx context.Context, messageID string, ticketID uint64) error {
+	if messageID == "" {
+		return nil
+	}
+	return s.repo.IndexMessageID(ctx, messageID, ticketID)
+}
+
+// IsKnownSender checks whether we've dealt with the address before, having ticketed mail from it or sent mail to it.
+func (s *MailServerService) IsKnownSender(ctx context.Context, address string) (bool, error) {
+	return s.repo.IsKnownSender(ctx, address)
 }
 
-func (s *MailServerService) CreateEmail(ctx context.Context, msg mail.Message) (domain.Email, error) {
-	return domain.CreateEmail(ctx, s.repo, msg)
+func (s *MailServerService) FindTicketEmails(ctx context.Context, ticketID uint64) ([]domain.Email, error) {
+	return s.repo.FindTicketEmails(ctx, ticketID)
 }
 
 type MailServerRepository interface {
 	GetAliases(ctx context.Context, domain *string) ([]domain.Alias, error)
 	GetAuthoritativeDomains(ctx context.Context) ([]string, error)
+	FindTicketIDByMessageID(ctx context.Context, messageID string) (uint64, error)
+	// IndexMessageID keeps the original ticket of a message ID already in the index
+	IndexMessageID(ctx context.Context, messageID string, ticketID uint64) error
+	IsKnownSender(ctx context.Context, address string) (bool, error)
+	// DeleteEmail deletes an email nothing refers to yet, along with its recipients and attachments
+	DeleteEmail(ctx context.Context, ID uint64) error
 	domain.EmailCreator
+	domain.EmailTicketRepository
 }
@@ -2,10 +2,16 @@ package email
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/nil-nil/ticket/internal/domain"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestIsAuthoritative(t *testing.T) {
@@ -18,13 +24,44 @@ func TestIsAuthoritative(t *testing.T) {
 	t.Run("AuthoritativeDomain", func(t *testing.T) {
 		result := svc.IsAuthoritative("example.com")
 		assert.True(t, result, "existing domain should be authoritative")
-		assert.Equal(t, repo.authoritativeDomains, *svc.domainCache, "should be cached now")
+		assert.Equal(t, repo.authoritativeDomains, svc.domainCache.Load().Value, "should be cached now")
 	})
 
 	t.Run("NonAuthoritativeDomain", func(t *testing.T) {
 		result := svc.IsAuthoritative("test.com")
 		assert.False(t, result, "non existing domain should not be authoritative")
 	})
+
+	t.Run("RefreshedOnDomainEvents", func(t *testing.T) {
+		repo.authoritativeDomains = []string{"example.com", "test.com"}
+		assert.False(t, svc.IsAuthoritative("test.com"), "the cached domains should be used until a domain changes")
+		svc.ObserveDomainEvents(domain.UpdateEvent, domain.DNSDomain{ID: 2, Name: "test.com"})
+		assert.True(t, svc.IsAuthoritative("test.com"), "a verified domain should be authoritative once its event is seen")
+	})
+
+	t.Run("ReloadedAfterTTL", func(t *testing.T) {
+		repo.authoritativeDomains = []string{"example.com"}
+		assert.True(t, svc.IsAuthoritative("test.com"), "the cached domains should be used until they expire")
+		svc.cacheTTL = 0
+		defer func() { svc.cacheTTL = domain.CacheTTL }()
+		assert.False(t, svc.IsAuthoritative("test.com"), "a domain deleted by another process should stop being authoritative once the cache expires")
+	})
+
+	t.Run("ConcurrentRefresh", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				svc.ObserveDomainEvents(domain.UpdateEvent, domain.DNSDomain{ID: 2, Name: "test.com"})
+			}()
+			go func() {
+				defer wg.Done()
+				assert.True(t, svc.IsAuthoritative("example.com"))
+			}()
+		}
+		wg.Wait()
+	})
 }
 
 func TestGetAlias(t *testing.T) {
@@ -38,7 +75,35 @@ func TestGetAlias(t *testing.T) {
 		alias, err := svc.GetAlias(context.Background(), "test", "example.com")
 		assert.NoError(t, err)
 		assert.Equal(t, domain.Alias{Domain: "example.com", User: "test", ID: 1}, alias)
-		assert.Equal(t, repo.aliases, mockCache.cache["mailaliases.example.com"], "should be cached now")
+		assert.Equal(t, repo.aliases, mockCache.cache["mailaliases.example.com"].(domain.Cached[[]domain.Alias]).Value, "should be cached now")
+	})
+
+	t.Run("CaseInsensitive", func(t *testing.T) {
+		alias, err := svc.GetAlias(context.Background(), "Test", "Example.COM")
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), alias.ID)
+	})
+
+	t.Run("RefreshedOnDomainEvents", func(t *testing.T) {
+		repo.aliases = append(repo.aliases, domain.Alias{Domain: "deleted.com", User: "test", ID: 2})
+		_, err := svc.GetAlias(context.Background(), "test", "deleted.com")
+		require.NoError(t, err)
+
+		repo.aliases = repo.aliases[:1]
+		svc.ObserveDomainEvents(domain.DeleteEvent, domain.DNSDomain{ID: 2, Name: "deleted.com"})
+		_, err = svc.GetAlias(context.Background(), "test", "deleted.com")
+		assert.ErrorIs(t, err, ErrAliasNotFound, "a deleted domain's aliases should leave the cache")
+	})
+
+	t.Run("ReloadedAfterTTL", func(t *testing.T) {
+		repo.aliases = append(repo.aliases, domain.Alias{Domain: "example.com", User: "sales", ID: 3})
+		_, err := svc.GetAlias(context.Background(), "sales", "example.com")
+		assert.ErrorIs(t, err, ErrAliasNotFound, "the cached aliases should be used until they expire")
+		svc.cacheTTL = 0
+		defer func() { svc.cacheTTL = domain.CacheTTL }()
+		alias, err := svc.GetAlias(context.Background(), "sales", "example.com")
+		assert.NoError(t, err, "an alias created by another process should be found once the cache expires")
+		assert.Equal(t, uint64(3), alias.ID)
 	})
 
 	t.Run("NotExistingAlias", func(t *testing.T) {
@@ -48,6 +113,58 @@ func TestGetAlias(t *testing.T) {
 	})
 }
 
+func TestFindAlias(t *testing.T) {
+	now := time.Now()
+	repo := &mockMailServerRepository{
+		authoritativeDomains: []string{"example.com", "Catchall.com"},
+		aliases: []domain.Alias{
+			{Domain: "example.com", User: "support", ID: 1},
+			{Domain: "example.com", User: "support+vip", ID: 2},
+			{Domain: "example.com", User: "old", ID: 3, DeletedAt: &now},
+			{Domain: "catchall.com", User: domain.CatchAllUser, ID: 4},
+			{Domain: "catchall.com", User: "sales", ID: 5},
+		},
+	}
+	svc, err := NewMailServerService(repo, &mockCacheDriver{cache: map[string]interface{}{}}, &mockEventBusDriver{})
+	require.NoError(t, err)
+
+	table := []struct {
+		description string
+		address     string
+		expectID    uint64
+		expectAddr  string
+		expectTag   string
+		expectErr   error
+	}{
+		{description: "exact", address: "support@example.com", expectID: 1, expectAddr: "support@example.com"},
+		{description: "mixed case", address: "SUPPORT@Example.com", expectID: 1, expectAddr: "support@example.com"},
+		{description: "subaddress", address: "support+Billing@example.com", expectID: 1, expectAddr: "support+billing@example.com", expectTag: "billing"},
+		{description: "alias with a plus wins over the subaddress", address: "support+vip@example.com", expectID: 2, expectAddr: "support+vip@example.com"},
+		{description: "deleted alias", address: "old@example.com", expectErr: ErrAliasNotFound},
+		{description: "missing alias", address: "nobody@example.com", expectErr: ErrAliasNotFound},
+		{description: "alias wins over the catch-all", address: "sales@catchall.com", expectID: 5, expectAddr: "sales@catchall.com"},
+		{description: "catch-all", address: "Anyone@catchall.com", expectID: 4, expectAddr: "anyone@catchall.com"},
+		{description: "subaddress wins over the catch-all", address: "sales+eu@catchall.com", expectID: 5, expectAddr: "sales+eu@catchall.com", expectTag: "eu"},
+		{description: "catch-all subaddress", address: "anyone+eu@catchall.com", expectID: 4, expectAddr: "anyone+eu@catchall.com", expectTag: "eu"},
+		{description: "not authoritative", address: "support@test.com", expectErr: ErrNotAuthoritative},
+		{description: "invalid", address: "support", expectErr: ErrInvalidEmailAddress},
+	}
+
+	for _, tc := range table {
+		t.Run(tc.description, func(t *testing.T) {
+			match, err := svc.findAlias(context.Background(), tc.address)
+			if tc.expectErr != nil {
+				assert.ErrorIs(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectID, match.Alias.ID)
+			assert.Equal(t, tc.expectAddr, match.Address)
+			assert.Equal(t, tc.expectTag, match.Tag)
+		})
+	}
+}
+
 func TestObserver(t *testing.T) {
 	repo := &mockMailServerRepository{
 		aliases: []domain.Alias{{Domain: "test.com", User: "test", ID: 1}},
@@ -56,13 +173,83 @@ func TestObserver(t *testing.T) {
 	assert.NoError(t, err, "NewMailServerService shoudln't error")
 
 	svc.ObserveAliasEvents(domain.CreateEvent, domain.Alias{ID: 2, User: "test2", Domain: "test.com"})
-	assert.Equal(t, []domain.Alias{{Domain: "test.com", User: "test", ID: 1}}, mockCache.cache["mailaliases.test.com"], "cache should be refreshed")
+	assert.Equal(t, []domain.Alias{{Domain: "test.com", User: "test", ID: 1}}, mockCache.cache["mailaliases.test.com"].(domain.Cached[[]domain.Alias]).Value, "cache should be refreshed")
+}
+
+func TestEmailEvents(t *testing.T) {
+	repo := &mockMailServerRepository{emails: map[uint64]domain.Email{}}
+	events := &mockEventBusDriver{}
+	svc, err := NewMailServerService(repo, mockCache, events)
+	require.NoError(t, err, "NewMailServerService shoudln't error")
+
+	e, err := svc.CreateEmail(context.Background(), domain.Email{Subject: "Printer on fire"})
+	require.NoError(t, err)
+	require.NotNil(t, events.EventSubject)
+	assert.Equal(t, fmt.Sprintf("emails:%d:%s", e.ID, domain.CreateEvent), *events.EventSubject)
+	assert.Equal(t, e, events.EventData)
+
+	require.NoError(t, svc.LinkTicket(context.Background(), e, 7))
+	assert.Equal(t, fmt.Sprintf("emails:%d:%s", e.ID, domain.UpdateEvent), *events.EventSubject)
+	linked, ok := events.EventData.(domain.Email)
+	require.True(t, ok)
+	assert.Equal(t, uint64(7), *linked.TicketID, "the event should carry the ticket the email was linked to")
 }
 
 type mockMailServerRepository struct {
 	authoritativeDomains []string
 	aliases              []domain.Alias
 	emails               map[uint64]domain.Email
+	messageIDs           map[string]uint64
+	knownSenders         []string
+	// expireErr fails expiring quarantined email
+	expireErr error
+}
+
+func (m *mockMailServerRepository) IsKnownSender(ctx context.Context, address string) (bool, error) {
+	return slices.ContainsFunc(m.knownSenders, func(known string) bool { return strings.EqualFold(known, address) }), nil
+}
+
+func (m *mockMailServerRepository) FindTicketIDByMessageID(ctx context.Context, messageID string) (uint64, error) {
+	ticketID, ok := m.messageIDs[messageID]
+	if !ok {
+		return 0, domain.ErrNotFound
+	}
+	return ticketID, nil
+}
+
+func (m *mockMailServerRepository) IndexMessageID(ctx context.Context, messageID string, ticketID uint64) error {
+	if m.messageIDs == nil {
+		m.messageIDs = map[string]uint64{}
+	}
+	if _, ok := m.messageIDs[messageID]; !ok {
+		m.messageIDs[messageID] = ticketID
+	}
+	return nil
+}
+
+func (m *mockMailServerRepository) DeleteEmail(ctx context.Context, ID uint64) error {
+	delete(m.emails, ID)
+	return nil
+}
+
+func (m *mockMailServerRepository) LinkTicket(ctx context.Context, emailID uint64, ticketID uint64) error {
+	email, ok := m.emails[emailID]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	email.TicketID = &ticketID
+	m.emails[emailID] = email
+	return nil
+}
+
+func (m *mockMailServerRepository) FindTicketEmails(ctx context.Context, ticketID uint64) ([]domain.Email, error) {
+	emails := make([]domain.Email, 0)
+	for ID := uint64(1); ID <= uint64(len(m.emails)); ID++ {
+		if email, ok := m.emails[ID]; ok && email.TicketID != nil && *email.TicketID == ticketID {
+			emails = append(emails, email)
+		}
+	}
+	return emails, nil
 }
 
 func (m *mockMailServerRepository) GetAuthoritativeDomains(ctx context.Context) ([]string, error) {
@@ -0,0 +1,197 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nil-nil/ticket/internal/domain"
+)
+
+// DefaultQuarantineRetention is how long email stays in quarantine before it expires, unless configured otherwise.
+const DefaultQuarantineRetention = 30 * 24 * time.Hour
+
+// checkQuarantine decides whether to hold inbound mail for review, returning nil if it's ticketed as usual.
+//
+// Mail is held if the spam filters quarantine it, if authHeld names a failed check the AuthPolicy quarantines,
+// or if it would open a ticket on a private alias although we've never dealt with its sender.
+func (s *Server) checkQuarantine(ctx context.Context, envelope Envelope, e domain.Email, authHeld string) (*domain.Quarantine, error) {
+	quarantine := func(reason domain.QuarantineReason, detail string) *domain.Quarantine {
+		return &domain.Quarantine{Reason: reason, Detail: detail, Recipients: envelope.To, QuarantinedAt: time.Now()}
+	}
+
+	if e.Spam != nil && e.Spam.Action == domain.SpamActionQuarantine {
+		return quarantine(domain.QuarantineReasonSpam, fmt.Sprintf("scored %.1f", e.Spam.Score)), nil
+	}
+	if authHeld != "" {
+		return quarantine(domain.QuarantineReasonAuthentication, authHeld), nil
+	}
+
+	sender, unknown, err := s.unknownSender(ctx, envelope, e)
+	if err != nil {
+		return nil, err
+	}
+	if unknown {
+		return quarantine(domain.QuarantineReasonUnknownSender, fmt.Sprintf("%s hasn't written in before", sender)), nil
+	}
+
+	return nil, nil
+}
+
+// unknownSender checks whether the email would open a ticket on a private alias although we've never dealt with its sender.
+//
+// Only the first recipient alias counts, as it's the one whose routing a new ticket takes. Replies to existing tickets and delivery reports don't open tickets, so are never held.
+func (s *Server) unknownSender(ctx context.Context, envelope Envelope, e domain.Email) (sender string, unknown bool, err error) {
+	if s.ticketService == nil {
+		return "", false, nil
+	}
+	matches := s.aliasMatches(ctx, envelope.To)
+	if len(matches) == 0 || !matches[0].Alias.Routing.Private {
+		return "", false, nil
+	}
+	if _, ok := parseDeliveryReport(e); ok {
+		return "", false, nil
+	}
+	if _, err := s.replyTicket(ctx, e); err == nil {
+		return "", false, nil
+	} else if !errors.Is(err, domain.ErrNotFound) {
+		return "", false, err
+	}
+
+	sender = e.Sender
+	if sender == "" {
+		sender = envelope.From
+	}
+	if sender == "" {
+		return "<>", true, nil
+	}
+	known, err := s.mailService.IsKnownSender(ctx, sender)
+	if err != nil {
+		return "", false, err
+	}
+
+	return sender, !known, nil
+}
+
+// QuarantineRepository stores quarantined email, along with everything the mail server needs to ticket released email.
+type QuarantineRepository interface {
+	MailServerRepository
+	FindEmail(ctx context.Context, ID uint64) (domain.Email, error)
+	// FindQuarantined returns the email in quarantine matching the filter, newest first
+	FindQuarantined(ctx context.Context, filter domain.QuarantineFilter) ([]domain.Email, error)
+	// ReleaseQuarantined takes the email out of quarantine, returning domain.ErrNotFound if it isn't in quarantine
+	ReleaseQuarantined(ctx context.Context, ID uint64) error
+	// RestoreQuarantined puts released email back in quarantine as it was
+	RestoreQuarantined(ctx context.Context, ID uint64, quarantine domain.Quarantine) error
+	// DeleteQuarantined deletes the email, returning domain.ErrNotFound if it isn't in quarantine
+	DeleteQuarantined(ctx context.Context, ID uint64) error
+	// ExpireQuarantine deletes the email quarantined before the time, returning how much was deleted
+	ExpireQuarantine(ctx context.Context, before time.Time) (int, error)
+}
+
+func NewQuarantineService(repo QuarantineRepository, ticketService TicketService, cacheDriver domain.CacheDriver, eventBusDriver domain.EventBusDriver) (*QuarantineService, error) {
+	svc, err := NewMailServerService(repo, cacheDriver, eventBusDriver)
+	if err != nil {
+		return nil, err
+	}
+	return &QuarantineService{
+		Retention: DefaultQuarantineRetention,
+		repo:      repo,
+		server:    &Server{mailService: svc, ticketService: ticketService},
+	}, nil
+}
+
+// QuarantineService lets admins review quarantined email, releasing it into tickets or deleting it.
+type QuarantineService struct {
+	// Retention is how long email stays in quarantine before it expires
+	Retention time.Duration
+	repo      QuarantineRepository
+	server    *Server
+}
+
+// List returns the email in quarantine matching the filter, newest first.
+func (s *QuarantineService) List(ctx context.Context, filter domain.QuarantineFilter) ([]domain.Email, error) {
+	return s.repo.FindQuarantined(ctx, filter)
+}
+
+// Get returns an email in quarantine, or domain.ErrNotFound if it isn't in quarantine.
+func (s *QuarantineService) Get(ctx context.Context, ID uint64) (domain.Email, error) {
+	e, err := s.repo.FindEmail(ctx, ID)
+	if err != nil {
+		return domain.Email{}, err
+	}
+	if e.Quarantine == nil {
+		return domain.Email{}, domain.ErrNotFound
+	}
+	return e, nil
+}
+
+// ExpiresAt returns when the quarantined email expires.
+func (s *QuarantineService) ExpiresAt(q domain.Quarantine) time.Time {
+	return q.ExpiresAt(s.Retention)
+}
+
+// Release takes the email out of quarantine and tickets it for the recipients it was delivered to, as if it had never been held.
+//
+// ErrAliasNotFound is returned, leaving the email in quarantine, if none of its recipients is one of our aliases any more.
+// Email that fails to be ticketed is put back in quarantine, so it can be released again.
+func (s *QuarantineService) Release(ctx context.Context, ID uint64) (domain.Email, error) {
+	e, err := s.Get(ctx, ID)
+	if err != nil {
+		return domain.Email{}, err
+	}
+	envelope := Envelope{To: e.Quarantine.Recipients}
+	if len(envelope.To) == 0 {
+		// Email quarantined before its envelope was kept falls back on its headers
+		envelope.To = e.Recipients
+	}
+	if len(s.server.aliasMatches(ctx, envelope.To)) == 0 {
+		return domain.Email{}, ErrAliasNotFound
+	}
+
+	// Releasing first means an email released twice at once is only ticketed once
+	if err := s.repo.ReleaseQuarantined(ctx, ID); err != nil {
+		return domain.Email{}, err
+	}
+	quarantine := *e.Quarantine
+	e.Quarantine = nil
+	if err := s.server.ticketEmail(ctx, envelope, e); err != nil {
+		if restoreErr := s.repo.RestoreQuarantined(ctx, ID, quarantine); restoreErr != nil {
+			return domain.Email{}, errors.Join(err, fmt.Errorf("putting email back in quarantine: %w", restoreErr))
+		}
+		return domain.Email{}, err
+	}
+
+	return s.repo.FindEmail(ctx, ID)
+}
+
+// Delete deletes an email in quarantine.
+func (s *QuarantineService) Delete(ctx context.Context, ID uint64) error {
+	return s.repo.DeleteQuarantined(ctx, ID)
+}
+
+// Expire deletes the email that has been in quarantine longer than Retention, returning how much was deleted.
+func (s *QuarantineService) Expire(ctx context.Context) (int, error) {
+	return s.repo.ExpireQuarantine(ctx, time.Now().Add(-s.Retention))
+}
+
+// RunExpiry expires quarantined email every interval until the context is cancelled.
+//
+// Failures are passed to onError and retried at the next interval, so a transient error doesn't stop the retention being enforced.
+func (s *QuarantineService) RunExpiry(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Expire(ctx); err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrivateAlias(t *testing.T) {
+	repo := &mockMailServerRepository{
+		authoritativeDomains: []string{"test.com"},
+		aliases: []domain.Alias{
+			{User: "board", Domain: "test.com", ID: 1, Routing: domain.AliasRouting{Private: true}},
+			{User: "support", Domain: "test.com", ID: 2},
+		},
+		emails:       map[uint64]domain.Email{},
+		knownSenders: []string{"Alice@example.com"},
+	}
+	tickets := &mockTicketService{tickets: map[uint64]domain.Ticket{}}
+	server := NewServer(repo, tickets, nil, &mockCacheDriver{cache: map[string]interface{}{}}, &mockEventBusDriver{}, nil)
+	message := func(messageID, from, extra string) *strings.Reader {
+		return strings.NewReader("Message-ID: <" + messageID + ">\r\nFrom: " + from + "\r\n" + extra + "Subject: Hello\r\n\r\nHi\r\n")
+	}
+
+	t.Run("UnknownSenderHeld", func(t *testing.T) {
+		require.NoError(t, server.ReceiveData(Envelope{From: "bob@example.com", To: []string{"board@test.com"}}, message("1@example.com", "bob@example.com", "")))
+		e := repo.emails[1]
+		require.NotNil(t, e.Quarantine, "mail from an unknown sender to a private alias should be held")
+		assert.Equal(t, domain.QuarantineReasonUnknownSender, e.Quarantine.Reason)
+		assert.Equal(t, "bob@example.com hasn't written in before", e.Quarantine.Detail)
+		assert.Nil(t, e.TicketID)
+		assert.Empty(t, tickets.tickets, "held mail shouldn't open a ticket")
+	})
+
+	t.Run("KnownSenderPasses", func(t *testing.T) {
+		require.NoError(t, server.ReceiveData(Envelope{From: "alice@example.com", To: []string{"board@test.com"}}, message("2@example.com", "alice@example.com", "")))
+		e := repo.emails[2]
+		assert.Nil(t, e.Quarantine, "known senders should be ticketed, regardless of case")
+		assert.NotNil(t, e.TicketID)
+	})
+
+	t.Run("ReplyPasses", func(t *testing.T) {
+		require.NoError(t, server.ReceiveData(Envelope{From: "carol@example.com", To: []string{"board@test.com"}}, message("3@example.com", "carol@example.com", "In-Reply-To: <2@example.com>\r\n")))
+		e := repo.emails[3]
+		assert.Nil(t, e.Quarantine, "replies to existing tickets shouldn't be held")
+		assert.Equal(t, uint64(1), *e.TicketID)
+	})
+
+	t.Run("PublicAliasFirst", func(t *testing.T) {
+		require.NoError(t, server.ReceiveData(Envelope{From: "dave@example.com", To: []string{"support@test.com", "board@test.com"}}, message("4@example.com", "dave@example.com", "")))
+		assert.Nil(t, repo.emails[4].Quarantine, "only the alias routing the ticket should count")
+	})
+}
+
+func TestQuarantineService(t *testing.T) {
+	held := time.Now().Add(-time.Hour)
+	repo := &mockMailServerRepository{
+		authoritativeDomains: []string{"test.com"},
+		aliases:              []domain.Alias{{User: "support", Domain: "test.com", ID: 1}},
+		emails: map[uint64]domain.Email{
+			1: {ID: 1, Subject: "Cheap pills", Sender: "spam@example.com", Quarantine: &domain.Quarantine{
+				Reason: domain.QuarantineReasonSpam, Detail: "scored 12.0", Recipients: []string{"support@test.com"}, QuarantinedAt: held.Add(-60 * 24 * time.Hour),
+			}},
+			2: {ID: 2, Subject: "Printer on fire", Sender: "bob@example.com", Quarantine: &domain.Quarantine{
+				Reason: domain.QuarantineReasonAuthentication, Detail: "spf failed", Recipients: []string{"support@test.com"}, QuarantinedAt: held,
+			}},
+			3: {ID: 3, Subject: "Hello", Sender: "carol@example.com", Recipients: []string{"sales@test.com"}, Quarantine: &domain.Quarantine{
+				Reason: domain.QuarantineReasonUnknownSender, Detail: "carol@example.com hasn't written in before", QuarantinedAt: held,
+			}},
+			4: {ID: 4, Subject: "Ticketed", Sender: "dave@example.com"},
+		},
+	}
+	tickets := &mockTicketService{tickets: map[uint64]domain.Ticket{}}
+	svc, err := NewQuarantineService(repo, tickets, &mockCacheDriver{cache: map[string]interface{}{}}, &mockEventBusDriver{})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	t.Run("List", func(t *testing.T) {
+		emails, err := svc.List(ctx, domain.QuarantineFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, []uint64{3, 2, 1}, emailIDs(emails), "quarantined email should be listed newest first")
+
+		reason := domain.QuarantineReasonSpam
+		emails, err = svc.List(ctx, domain.QuarantineFilter{Reason: &reason})
+		require.NoError(t, err)
+		assert.Equal(t, []uint64{1}, emailIDs(emails))
+
+		before := uint64(3)
+		emails, err = svc.List(ctx, domain.QuarantineFilter{Before: &before, Limit: 1})
+		require.NoError(t, err)
+		assert.Equal(t, []uint64{2}, emailIDs(emails))
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		e, err := svc.Get(ctx, 2)
+		require.NoError(t, err)
+		assert.Equal(t, "Printer on fire", e.Subject)
+		assert.Equal(t, held.Add(DefaultQuarantineRetention), svc.ExpiresAt(*e.Quarantine))
+
+		_, err = svc.Get(ctx, 4)
+		assert.ErrorIs(t, err, domain.ErrNotFound, "email that isn't quarantined shouldn't be found")
+	})
+
+	t.Run("ReleaseFailsToTicket", func(t *testing.T) {
+		quarantine := *repo.emails[2].Quarantine
+		tickets.openErr = errors.New("connection reset")
+		t.Cleanup(func() { tickets.openErr = nil })
+
+		_, err := svc.Release(ctx, 2)
+		assert.ErrorContains(t, err, "connection reset")
+		assert.Equal(t, &quarantine, repo.emails[2].Quarantine, "email that fails to be ticketed should be put back in quarantine")
+		assert.Empty(t, tickets.tickets)
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		e, err := svc.Release(ctx, 2)
+		require.NoError(t, err)
+		assert.Nil(t, e.Quarantine, "released email should leave quarantine")
+		require.NotNil(t, e.TicketID, "released email should be ticketed")
+		ticket := tickets.tickets[*e.TicketID]
+		assert.Equal(t, "Printer on fire", ticket.Meta().Description)
+
+		_, err = svc.Release(ctx, 2)
+		assert.ErrorIs(t, err, domain.ErrNotFound, "email can only be released once")
+	})
+
+	t.Run("ReleaseWithoutAlias", func(t *testing.T) {
+		_, err := svc.Release(ctx, 3)
+		assert.ErrorIs(t, err, ErrAliasNotFound)
+		assert.NotNil(t, repo.emails[3].Quarantine, "email should stay in quarantine")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, svc.Delete(ctx, 3))
+		assert.NotContains(t, repo.emails, uint64(3))
+		assert.ErrorIs(t, svc.Delete(ctx, 4), domain.ErrNotFound, "email that isn't quarantined shouldn't be deleted")
+	})
+
+	t.Run("Expire", func(t *testing.T) {
+		expired, err := svc.Expire(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, expired)
+		assert.NotContains(t, repo.emails, uint64(1), "email held longer than the retention should expire")
+	})
+}
+
+func TestRunExpiry(t *testing.T) {
+	repo := &mockMailServerRepository{emails: map[uint64]domain.Email{}, expireErr: errors.New("connection reset")}
+	svc, err := NewQuarantineService(repo, &mockTicketService{tickets: map[uint64]domain.Ticket{}}, &mockCacheDriver{cache: map[string]interface{}{}}, &mockEventBusDriver{})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	stopped := make(chan struct{})
+	go func() {
+		svc.RunExpiry(ctx, time.Millisecond, func(err error) {
+			select {
+			case errs <- err:
+			case <-ctx.Done():
+			}
+		})
+		close(stopped)
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case err := <-errs:
+			assert.ErrorContains(t, err, "connection reset")
+		case <-time.After(time.Second):
+			t.Fatal("expiry should keep running after an error")
+		}
+	}
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("RunExpiry should return once the context is cancelled")
+	}
+}
+
+func emailIDs(emails []domain.Email) []uint64 {
+	IDs := make([]uint64, 0, len(emails))
+	for _, e := range emails {
+		IDs = append(IDs, e.ID)
+	}
+	return IDs
+}
+
+func (m *mockMailServerRepository) FindEmail(ctx context.Context, ID uint64) (domain.Email, error) {
+	email, ok := m.emails[ID]
+	if !ok {
+		return domain.Email{}, domain.ErrNotFound
+	}
+	return email, nil
+}
+
+func (m *mockMailServerRepository) FindQuarantined(ctx context.Context, filter domain.QuarantineFilter) ([]domain.Email, error) {
+	emails := make([]domain.Email, 0)
+	for _, email := range m.emails {
+		if email.Quarantine == nil ||
+			(filter.Reason != nil && email.Quarantine.Reason != *filter.Reason) ||
+			(filter.Before != nil && email.ID >= *filter.Before) {
+			continue
+		}
+		emails = append(emails, email)
+	}
+	sort.Slice(emails, func(i, j int) bool { return emails[i].ID > emails[j].ID })
+	if filter.Limit > 0 && len(emails) > filter.Limit {
+		emails = emails[:filter.Limit]
+	}
+	return emails, nil
+}
+
+func (m *mockMailServerRepository) ReleaseQuarantined(ctx context.Context, ID uint64) error {
+	email, ok := m.emails[ID]
+	if !ok || email.Quarantine == nil {
+		return domain.ErrNotFound
+	}
+	email.Quarantine = nil
+	m.emails[ID] = email
+	return nil
+}
+
+func (m *mockMailServerRepository) RestoreQuarantined(ctx context.Context, ID uint64, quarantine domain.Quarantine) error {
+	email, ok := m.emails[ID]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	email.Quarantine = &quarantine
+	m.emails[ID] = email
+	return nil
+}
+
+func (m *mockMailServerRepository) DeleteQuarantined(ctx context.Context, ID uint64) error {
+	email, ok := m.emails[ID]
+	if !ok || email.Quarantine == nil {
+		return domain.ErrNotFound
+	}
+	delete(m.emails, ID)
+	return nil
+}
+
+func (m *mockMailServerRepository) ExpireQuarantine(ctx context.Context, before time.Time) (int, error) {
+	if m.expireErr != nil {
+		return 0, m.expireErr
+	}
+	var expired int
+	for ID, email := range m.emails {
+		if email.Quarantine != nil && email.Quarantine.QuarantinedAt.Before(before) {
+			delete(m.emails, ID)
+			expired++
+		}
+	}
+	return expired, nil
+}
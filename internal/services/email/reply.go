@@ -0,0 +1,280 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/nil-nil/ticket/internal/domain"
+)
+
+var (
+	ErrNoReplyAddress = errors.New("ticket has no inbound email to reply to")
+)
+
+func NewReplyService(mailServerRepo MailServerRepository, ticketService TicketService, outboundQueue OutboundQueue, cacheDriver domain.CacheDriver, eventBusDriver domain.EventBusDriver) (*ReplyService, error) {
+	svc, err := NewMailServerService(mailServerRepo, cacheDriver, eventBusDriver)
+	if err != nil {
+		return nil, err
+	}
+	ticketEventBus, err := domain.NewEventBus[domain.Ticket]("tickets", eventBusDriver)
+	if err != nil {
+		return nil, err
+	}
+	replies := &ReplyService{
+		mailService:   svc,
+		ticketService: ticketService,
+		outboundQueue: outboundQueue,
+	}
+	ticketEventBus.Subscribe(nil, []domain.EventType{domain.UpdateEvent}, replies.ObserveTicketEvent)
+	return replies, nil
+}
+
+// ReplyService sends email to customers from their tickets.
+type ReplyService struct {
+	mailService   *MailServerService
+	ticketService TicketService
+	outboundQueue OutboundQueue
+	// OnNotifyError is passed failures to notify a requester their ticket was closed, if set
+	OnNotifyError func(ticketID uint64, err error)
+}
+
+// Reply emails the customer who last wrote in to a ticket, from the alias they wrote to.
+//
+// The reply is threaded onto their last message and carries the ticket's subject token, so their answer finds its way back to the ticket.
+// It goes to the message's Reply-To address if it has one. The reply is stored as an outbound email, recorded on the ticket and queued for delivery.
+func (s *ReplyService) Reply(ctx context.Context, ticketID uint64, body string) (domain.Email, error) {
+	if _, err := s.ticketService.GetTicket(ctx, ticketID); err != nil {
+		return domain.Email{}, err
+	}
+	return s.send(ctx, ticketID, body, false)
+}
+
+// ObserveTicketEvent notifies the requester when their ticket is closed, unless it's spam or wasn't opened by email.
+func (s *ReplyService) ObserveTicketEvent(eventType domain.EventType, ticket domain.Ticket) {
+	if len(ticket.Transitions) == 0 {
+		return
+	}
+	meta := ticket.Meta()
+	if ticket.Transitions[len(ticket.Transitions)-1].Status != domain.TicketStatusClosed || meta.Spam {
+		return
+	}
+
+	body := "Your request has been closed."
+	if resolution := strings.TrimSpace(meta.Resolution); resolution != "" {
+		body += "\n\n" + resolution
+	}
+	_, err := s.send(context.Background(), ticket.ID, body, true)
+	if err != nil && !errors.Is(err, ErrNoReplyAddress) && s.OnNotifyError != nil {
+		s.OnNotifyError(ticket.ID, err)
+	}
+}
+
+// send emails the ticket's requester, marking the message as automatic for notifications so auto-responders don't answer it.
+func (s *ReplyService) send(ctx context.Context, ticketID uint64, body string, notification bool) (domain.Email, error) {
+	emails, err := s.mailService.FindTicketEmails(ctx, ticketID)
+	if err != nil {
+		return domain.Email{}, err
+	}
+	parent, from, err := s.replyAddresses(ctx, emails)
+	if err != nil {
+		return domain.Email{}, err
+	}
+	to := replyRecipient(parent)
+
+	messageID, err := newMessageID(ticketID, from)
+	if err != nil {
+		return domain.Email{}, err
+	}
+	subject := replySubject(parent.Subject, ticketID)
+	raw, err := buildMessage(outboundMessage{
+		from:          from,
+		to:            to,
+		subject:       subject,
+		date:          time.Now(),
+		messageID:     messageID,
+		inReplyTo:     parent.MessageID,
+		references:    replyReferences(parent),
+		autoSubmitted: notification,
+		body:          body,
+	})
+	if err != nil {
+		return domain.Email{}, err
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return domain.Email{}, err
+	}
+	date, _ := msg.Header.Date()
+	e := domain.Email{
+		MessageID:  messageID,
+		Subject:    subject,
+		Sender:     from,
+		Recipients: []string{to},
+		Date:       date,
+		Message:    *msg,
+		Raw:        raw,
+		TicketID:   &ticketID,
+		Outbound:   true,
+		TextBody:   body,
+	}
+	e, err = s.mailService.createEmailThen(ctx, e, func(e domain.Email) error {
+		_, err := s.outboundQueue.Enqueue(ctx, domain.OutboundMessage{
+			EmailID:   &e.ID,
+			TicketID:  &ticketID,
+			MessageID: messageID,
+			From:      from,
+			To:        []string{to},
+			Message:   raw,
+		})
+		if err != nil {
+			return fmt.Errorf("error queueing reply: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return domain.Email{}, err
+	}
+
+	if err := s.mailService.IndexMessageID(ctx, messageID, ticketID); err != nil {
+		return domain.Email{}, err
+	}
+	if _, err := s.ticketService.UpdateTicket(ctx, ticketID, domain.TicketUpdateParameters{EmailID: &e.ID}); err != nil {
+		return domain.Email{}, err
+	}
+
+	return e, nil
+}
+
+// replyRecipient returns the address a reply to the email goes to, its first Reply-To address if it has one that parses.
+func replyRecipient(e domain.Email) string {
+	if replyTo := e.Message.Header.Get("Reply-To"); replyTo != "" {
+		if addresses, err := mail.ParseAddressList(replyTo); err == nil && len(addresses) > 0 {
+			return addresses[0].Address
+		}
+	}
+	return e.Sender
+}
+
+// replyAddresses finds the latest inbound email to reply to and the alias address to send the reply from.
+//
+// The alias is taken from the recipients of the ticket's inbound emails, newest first, replying from the address as it was written to,
+// so subaddresses and addresses caught by a catch-all alias are kept.
+func (s *ReplyService) replyAddresses(ctx context.Context, emails []domain.Email) (parent domain.Email, from string, err error) {
+	found := false
+	for i := len(emails) - 1; i >= 0; i-- {
+		e := emails[i]
+		if e.Outbound || e.Sender == "" {
+			continue
+		}
+		if !found {
+			parent, found = e, true
+		}
+		for _, recipient := range e.Recipients {
+			if match, err := s.mailService.findAlias(ctx, recipient); err == nil {
+				return parent, match.Address, nil
+			}
+		}
+	}
+	if !found {
+		return domain.Email{}, "", ErrNoReplyAddress
+	}
+
+	return domain.Email{}, "", ErrAliasNotFound
+}
+
+// replySubject prefixes a subject with "Re: " and adds the ticket's subject token if it's missing.
+func replySubject(subject string, ticketID uint64) string {
+	subject = strings.TrimSpace(subject)
+	if id, ok := ParseSubjectToken(subject); !ok || id != ticketID {
+		subject = strings.TrimSpace(subject + " " + SubjectToken(ticketID))
+	}
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+	return subject
+}
+
+// newMessageID generates a unique message ID in the domain of the address the message is sent from.
+func newMessageID(ticketID uint64, from string) (string, error) {
+	_, mailDomain, err := getUserAndDomainParts(from)
+	if err != nil {
+		return "", err
+	}
+
+	random := make([]byte, 12)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("ticket-%d.%s@%s", ticketID, hex.EncodeToString(random), mailDomain), nil
+}
+
+type outboundMessage struct {
+	from       string
+	to         string
+	subject    string
+	date       time.Time
+	messageID  string
+	inReplyTo  string
+	references []string
+	// autoSubmitted marks the message as sent automatically (RFC 3834)
+	autoSubmitted bool
+	body          string
+}
+
+// buildMessage renders a plain text message, quoted-printable encoding the body so any line length and charset is safe to send.
+func buildMessage(m outboundMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+		}
+	}
+
+	references := make([]string, 0, len(m.references))
+	for _, id := range m.references {
+		if id != "" {
+			references = append(references, "<"+id+">")
+		}
+	}
+	inReplyTo := ""
+	if m.inReplyTo != "" {
+		inReplyTo = "<" + m.inReplyTo + ">"
+	}
+
+	header("From", m.from)
+	header("To", m.to)
+	header("Subject", mime.QEncoding.Encode("utf-8", m.subject))
+	header("Date", m.date.Format(time.RFC1123Z))
+	header("Message-ID", "<"+m.messageID+">")
+	header("In-Reply-To", inReplyTo)
+	header("References", strings.Join(references, " "))
+	if m.autoSubmitted {
+		header("Auto-Submitted", "auto-generated")
+	}
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	w := quotedprintable.NewWriter(&buf)
+	if _, err := w.Write([]byte(m.body)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\r\n")
+
+	return buf.Bytes(), nil
+}
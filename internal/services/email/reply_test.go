@@ -0,0 +1,229 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReply(t *testing.T) {
+	repo := &mockMailServerRepository{
+		authoritativeDomains: []string{"test.com"},
+		aliases:              []domain.Alias{{User: "support", Domain: "test.com", ID: 1}},
+		emails:               map[uint64]domain.Email{},
+	}
+	tickets := &mockTicketService{tickets: map[uint64]domain.Ticket{}}
+	cache := &mockCacheDriver{cache: map[string]interface{}{}}
+	queue := &mockOutboundQueue{}
+	server := NewServer(repo, tickets, queue, cache, &mockEventBusDriver{}, nil)
+	replies, err := NewReplyService(repo, tickets, queue, cache, &mockEventBusDriver{})
+	require.NoError(t, err)
+
+	envelope := Envelope{From: "bob@example.com", To: []string{"support@test.com"}}
+	err = server.ReceiveData(envelope, strings.NewReader("Message-ID: <1@example.com>\r\nFrom: Bob <bob@example.com>\r\nTo: support@test.com\r\nSubject: Printer on fire\r\n\r\nHelp\r\n"))
+	require.NoError(t, err)
+
+	t.Run("SendsReply", func(t *testing.T) {
+		e, err := replies.Reply(context.Background(), 1, "Have you tried turning it off and on again? Ça marche.")
+		assert.NoError(t, err)
+		require.Len(t, queue.queued, 1, "reply should be queued")
+		queued := queue.queued[0]
+		assert.Equal(t, "support@test.com", queued.From, "reply should be sent from the alias")
+		assert.Equal(t, []string{"bob@example.com"}, queued.To, "reply should be sent to the customer")
+		assert.Equal(t, e.ID, *queued.EmailID, "queued message should reference the stored email")
+		assert.Equal(t, uint64(1), *queued.TicketID, "queued message should reference the ticket")
+		assert.Equal(t, e.MessageID, queued.MessageID)
+
+		msg, err := mail.ReadMessage(strings.NewReader(string(queued.Message)))
+		require.NoError(t, err)
+		assert.Equal(t, "Re: Printer on fire [#1]", msg.Header.Get("Subject"))
+		assert.Equal(t, "<1@example.com>", msg.Header.Get("In-Reply-To"))
+		assert.Equal(t, "<1@example.com>", msg.Header.Get("References"))
+		assert.Equal(t, "<"+e.MessageID+">", msg.Header.Get("Message-Id"))
+		assert.True(t, strings.HasSuffix(e.MessageID, "@test.com"), "message id should be in the alias's domain")
+
+		assert.True(t, e.Outbound, "reply should be stored as outbound")
+		assert.Equal(t, uint64(1), *repo.emails[e.ID].TicketID, "reply should be linked to the ticket")
+		assert.Equal(t, uint64(1), repo.messageIDs[e.MessageID], "reply message id should be indexed")
+		transitions := tickets.tickets[1].Transitions
+		assert.Equal(t, e.ID, *transitions[len(transitions)-1].EmailID, "reply should be recorded on the ticket")
+	})
+
+	t.Run("CustomerAnswerThreads", func(t *testing.T) {
+		outbound := repo.emails[2]
+		err := server.ReceiveData(envelope, strings.NewReader("Message-ID: <3@example.com>\r\nIn-Reply-To: <"+outbound.MessageID+">\r\nFrom: bob@example.com\r\nTo: support@test.com\r\nSubject: Re: Printer on fire [#1]\r\n\r\nThat worked\r\n"))
+		assert.NoError(t, err)
+		assert.Len(t, tickets.tickets, 1, "answer should be threaded onto the ticket")
+
+		_, err = replies.Reply(context.Background(), 1, "Great")
+		assert.NoError(t, err)
+		msg, err := mail.ReadMessage(strings.NewReader(string(queue.queued[1].Message)))
+		require.NoError(t, err)
+		assert.Equal(t, "<3@example.com>", msg.Header.Get("In-Reply-To"), "reply should answer the latest inbound message")
+		assert.Equal(t, "<"+outbound.MessageID+"> <3@example.com>", msg.Header.Get("References"))
+	})
+
+	t.Run("MissingTicket", func(t *testing.T) {
+		_, err := replies.Reply(context.Background(), 99, "Hello")
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+	})
+
+	t.Run("NoInboundEmail", func(t *testing.T) {
+		ticket, _ := tickets.OpenTicket(context.Background(), "Opened by an agent")
+		_, err := replies.Reply(context.Background(), ticket.ID, "Hello")
+		assert.ErrorIs(t, err, ErrNoReplyAddress)
+	})
+
+	t.Run("RepliesFromSubaddress", func(t *testing.T) {
+		err := server.ReceiveData(Envelope{From: "bob@example.com", To: []string{"Support+Billing@test.com"}}, strings.NewReader("Message-ID: <10@example.com>\r\nFrom: bob@example.com\r\nTo: Support+Billing@test.com\r\nSubject: Invoice\r\n\r\nWrong amount\r\n"))
+		require.NoError(t, err)
+		ticketID := *repo.emails[uint64(len(repo.emails))].TicketID
+
+		_, err = replies.Reply(context.Background(), ticketID, "Sorting it out")
+		assert.NoError(t, err)
+		assert.Equal(t, "support+billing@test.com", queue.queued[len(queue.queued)-1].From, "reply should keep the subaddress written to")
+	})
+
+	t.Run("RepliesToReplyTo", func(t *testing.T) {
+		err := server.ReceiveData(envelope, strings.NewReader("Message-ID: <20@example.com>\r\nFrom: bob@example.com\r\nReply-To: Helpdesk <helpdesk@example.com>\r\nTo: support@test.com\r\nSubject: Scanner\r\n\r\nJammed\r\n"))
+		require.NoError(t, err)
+		ticketID := *repo.emails[uint64(len(repo.emails))].TicketID
+
+		e, err := replies.Reply(context.Background(), ticketID, "On it")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"helpdesk@example.com"}, queue.queued[len(queue.queued)-1].To, "reply should go to the Reply-To address")
+		assert.Equal(t, []string{"helpdesk@example.com"}, e.Recipients)
+	})
+
+	t.Run("QueueFailure", func(t *testing.T) {
+		emails := len(repo.emails)
+		transitions := len(tickets.tickets[1].Transitions)
+		queue.enqueueErr = errors.New("queue unavailable")
+		defer func() { queue.enqueueErr = nil }()
+
+		_, err := replies.Reply(context.Background(), 1, "Lost")
+		assert.ErrorIs(t, err, queue.enqueueErr)
+		assert.Len(t, repo.emails, emails, "reply that couldn't be queued shouldn't be stored")
+		assert.Len(t, tickets.tickets[1].Transitions, transitions, "reply that couldn't be queued shouldn't be recorded on the ticket")
+	})
+
+	t.Run("NotifiesClosed", func(t *testing.T) {
+		queued := len(queue.queued)
+		resolution := "Replaced the fuser"
+		ticket, err := tickets.UpdateTicket(context.Background(), 1, domain.TicketUpdateParameters{Status: domain.TicketStatusClosed, Resolution: &resolution})
+		require.NoError(t, err)
+
+		replies.ObserveTicketEvent(domain.UpdateEvent, ticket)
+		require.Len(t, queue.queued, queued+1, "requester should be notified")
+		msg, err := mail.ReadMessage(strings.NewReader(string(queue.queued[queued].Message)))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"bob@example.com"}, queue.queued[queued].To)
+		assert.Equal(t, "auto-generated", msg.Header.Get("Auto-Submitted"))
+		body, _ := io.ReadAll(msg.Body)
+		assert.Contains(t, string(body), "closed")
+		assert.Contains(t, string(body), resolution)
+
+		ticket = tickets.tickets[1]
+		replies.ObserveTicketEvent(domain.UpdateEvent, ticket)
+		assert.Len(t, queue.queued, queued+1, "recording the notification shouldn't send another")
+	})
+
+	t.Run("NoNotificationForSpam", func(t *testing.T) {
+		queued := len(queue.queued)
+		spam := true
+		_, err := tickets.UpdateTicket(context.Background(), 1, domain.TicketUpdateParameters{Spam: &spam})
+		require.NoError(t, err)
+		ticket, err := tickets.UpdateTicket(context.Background(), 1, domain.TicketUpdateParameters{Status: domain.TicketStatusClosed})
+		require.NoError(t, err)
+
+		replies.ObserveTicketEvent(domain.UpdateEvent, ticket)
+		assert.Len(t, queue.queued, queued, "spam shouldn't be answered")
+	})
+
+	t.Run("NotifyErrors", func(t *testing.T) {
+		var failed []uint64
+		replies.OnNotifyError = func(ticketID uint64, err error) { failed = append(failed, ticketID) }
+		defer func() { replies.OnNotifyError = nil }()
+
+		agentTicket, _ := tickets.OpenTicket(context.Background(), "Opened by an agent")
+		agentTicket, err := tickets.UpdateTicket(context.Background(), agentTicket.ID, domain.TicketUpdateParameters{Status: domain.TicketStatusClosed})
+		require.NoError(t, err)
+		replies.ObserveTicketEvent(domain.UpdateEvent, agentTicket)
+		assert.Empty(t, failed, "tickets without a requester email shouldn't be reported")
+
+		queue.enqueueErr = errors.New("queue unavailable")
+		defer func() { queue.enqueueErr = nil }()
+		ticketID := repo.messageIDs["20@example.com"]
+		ticket, err := tickets.UpdateTicket(context.Background(), ticketID, domain.TicketUpdateParameters{Status: domain.TicketStatusClosed})
+		require.NoError(t, err)
+		replies.ObserveTicketEvent(domain.UpdateEvent, ticket)
+		assert.Equal(t, []uint64{ticketID}, failed)
+	})
+}
+
+func TestReplySubject(t *testing.T) {
+	tests := []struct {
+		name     string
+		subject  string
+		expected string
+	}{
+		{name: "Plain", subject: "Printer on fire", expected: "Re: Printer on fire [#1]"},
+		{name: "AlreadyReply", subject: "RE: Printer on fire", expected: "RE: Printer on fire [#1]"},
+		{name: "HasToken", subject: "Re: [#1] Printer on fire", expected: "Re: [#1] Printer on fire"},
+		{name: "OtherTicketToken", subject: "[#2] Printer on fire", expected: "Re: [#2] Printer on fire [#1]"},
+		{name: "Empty", subject: "", expected: "Re: [#1]"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, replySubject(tc.subject, 1))
+		})
+	}
+}
+
+type mockOutboundQueue struct {
+	queued []domain.OutboundMessage
+	failed map[string]string
+	// enqueueErr fails queueing messages
+	enqueueErr error
+}
+
+func (m *mockOutboundQueue) Enqueue(ctx context.Context, msg domain.OutboundMessage) (domain.OutboundMessage, error) {
+	if m.enqueueErr != nil {
+		return domain.OutboundMessage{}, m.enqueueErr
+	}
+	msg.ID = uint64(len(m.queued) + 1)
+	msg.Status = domain.OutboundStatusQueued
+	m.queued = append(m.queued, msg)
+	return msg, nil
+}
+
+func (m *mockOutboundQueue) Find(ctx context.Context, messageID string) (domain.OutboundMessage, error) {
+	for _, msg := range m.queued {
+		if msg.MessageID == messageID {
+			return msg, nil
+		}
+	}
+	return domain.OutboundMessage{}, domain.ErrNotFound
+}
+
+func (m *mockOutboundQueue) Fail(ctx context.Context, messageID string, reason string) (domain.OutboundMessage, error) {
+	for _, msg := range m.queued {
+		if msg.MessageID == messageID {
+			if m.failed == nil {
+				m.failed = map[string]string{}
+			}
+			m.failed[messageID] = reason
+			msg.Status = domain.OutboundStatusFailed
+			return msg, nil
+		}
+	}
+	return domain.OutboundMessage{}, domain.ErrNotFound
+}
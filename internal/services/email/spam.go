@@ -0,0 +1,254 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+
+	"github.com/nil-nil/ticket/internal/domain"
+)
+
+var (
+	ErrSpamRejected          = errors.New("message rejected as spam")
+	ErrInvalidSpamThresholds = errors.New("spam thresholds must increase from tag to quarantine to reject")
+)
+
+// SpamFilter scores inbound mail before it's stored, returning the rules it matched.
+type SpamFilter interface {
+	Check(ctx context.Context, envelope Envelope, e domain.Email) ([]domain.SpamRule, error)
+}
+
+// SpamPolicy is the score from which mail is tagged, quarantined or refused. Zero disables an action.
+type SpamPolicy struct {
+	Tag        float64
+	Quarantine float64
+	Reject     float64
+}
+
+// DefaultSpamPolicy tags and quarantines spam but never refuses it, so nothing is lost to a badly trained classifier.
+var DefaultSpamPolicy = SpamPolicy{Tag: 5, Quarantine: 10}
+
+// Validate checks the enabled thresholds are positive and increase from Tag to Quarantine to Reject.
+func (p SpamPolicy) Validate() error {
+	last := 0.0
+	for _, threshold := range []float64{p.Tag, p.Quarantine, p.Reject} {
+		if threshold == 0 {
+			continue
+		}
+		if threshold <= last {
+			return fmt.Errorf("%w: %v", ErrInvalidSpamThresholds, p)
+		}
+		last = threshold
+	}
+	return nil
+}
+
+// action returns the most severe action whose threshold the score reaches.
+func (p SpamPolicy) action(score float64) domain.SpamAction {
+	switch {
+	case p.Reject != 0 && score >= p.Reject:
+		return domain.SpamActionReject
+	case p.Quarantine != 0 && score >= p.Quarantine:
+		return domain.SpamActionQuarantine
+	case p.Tag != 0 && score >= p.Tag:
+		return domain.SpamActionTag
+	}
+	return domain.SpamActionNone
+}
+
+// checkSpam runs the message through every spam filter, returning nil if there are none.
+//
+// An error wrapping ErrSpamRejected is returned if the policy refuses the message.
+func (s *Server) checkSpam(ctx context.Context, envelope Envelope, e domain.Email) (*domain.SpamReport, error) {
+	if len(s.SpamFilters) == 0 {
+		return nil, nil
+	}
+
+	report := domain.SpamReport{Rules: make([]domain.SpamRule, 0)}
+	for _, filter := range s.SpamFilters {
+		rules, err := filter.Check(ctx, envelope, e)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range rules {
+			report.Score += rule.Score
+			report.Rules = append(report.Rules, rule)
+		}
+	}
+	report.Action = s.SpamPolicy.action(report.Score)
+
+	if report.Action == domain.SpamActionReject {
+		return nil, fmt.Errorf("%w: scored %.1f", ErrSpamRejected, report.Score)
+	}
+	return &report, nil
+}
+
+// spamTagged reports whether the filters accepted the email but marked it as spam.
+func spamTagged(e domain.Email) bool {
+	return e.Spam != nil && e.Spam.Action == domain.SpamActionTag
+}
+
+// Scores of the header heuristics
+const (
+	scoreMissingDate      = 1.0
+	scoreMissingMessageID = 1.0
+	scoreMissingTo        = 0.5
+	scoreEmptySubject     = 0.5
+	scoreSubjectAllCaps   = 1.5
+	scoreHTMLOnly         = 1.0
+	scoreFromNameMismatch = 2.0
+	scoreReplyToMismatch  = 1.0
+	scoreSPFFail          = 2.0
+	scoreDKIMFail         = 2.0
+	scoreDMARCFail        = 3.0
+	scoreDMARCPass        = -1.0
+)
+
+// minAllCapsLetters is how many letters a subject needs before being all caps counts against it
+const minAllCapsLetters = 10
+
+// HeuristicsFilter scores mail on header and structure traits common in spam, and on its SPF, DKIM and DMARC results.
+type HeuristicsFilter struct{}
+
+func (HeuristicsFilter) Check(ctx context.Context, envelope Envelope, e domain.Email) ([]domain.SpamRule, error) {
+	header := e.Message.Header
+	var rules []domain.SpamRule
+	match := func(name string, score float64) {
+		rules = append(rules, domain.SpamRule{Name: name, Score: score})
+	}
+
+	if header.Get("Date") == "" {
+		match("MISSING_DATE", scoreMissingDate)
+	}
+	if header.Get("Message-ID") == "" {
+		match("MISSING_MESSAGE_ID", scoreMissingMessageID)
+	}
+	if header.Get("To") == "" && header.Get("Cc") == "" {
+		match("MISSING_TO", scoreMissingTo)
+	}
+	if subject := strings.TrimSpace(e.Subject); subject == "" {
+		match("EMPTY_SUBJECT", scoreEmptySubject)
+	} else if allCaps(subject) {
+		match("SUBJECT_ALL_CAPS", scoreSubjectAllCaps)
+	}
+	if e.HTMLBody != "" && strings.TrimSpace(e.TextBody) == "" {
+		match("HTML_ONLY", scoreHTMLOnly)
+	}
+	if fromNameMismatch(header) {
+		match("FROM_NAME_MISMATCH", scoreFromNameMismatch)
+	}
+	if replyToMismatch(header) {
+		match("REPLY_TO_MISMATCH", scoreReplyToMismatch)
+	}
+
+	if auth := e.Authentication; auth != nil {
+		if auth.SPF.Result == domain.AuthResultFail {
+			match("SPF_FAIL", scoreSPFFail)
+		}
+		if auth.DKIM.Result == domain.AuthResultFail || auth.DKIM.Result == domain.AuthResultPermError {
+			match("DKIM_FAIL", scoreDKIMFail)
+		}
+		switch auth.DMARC.Result {
+		case domain.AuthResultFail:
+			match("DMARC_FAIL", scoreDMARCFail)
+		case domain.AuthResultPass:
+			match("DMARC_PASS", scoreDMARCPass)
+		}
+	}
+
+	return rules, nil
+}
+
+// allCaps reports whether a subject with enough letters to tell has no lower case ones.
+func allCaps(subject string) bool {
+	letters := 0
+	for _, r := range subject {
+		if unicode.IsLower(r) {
+			return false
+		}
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	return letters >= minAllCapsLetters
+}
+
+// fromNameMismatch reports whether the From display name is itself an address other than the real one, e.g. "support@bank.com" <x@spam.net>.
+func fromNameMismatch(header mail.Header) bool {
+	from, err := mail.ParseAddress(header.Get("From"))
+	if err != nil || !strings.Contains(from.Name, "@") {
+		return false
+	}
+	named, err := mail.ParseAddress(from.Name)
+	if err != nil {
+		return false
+	}
+	return !strings.EqualFold(named.Address, from.Address)
+}
+
+// replyToMismatch reports whether replies are directed to a different domain than the author's.
+func replyToMismatch(header mail.Header) bool {
+	if header.Get("Reply-To") == "" {
+		return false
+	}
+	replyTo, err := header.AddressList("Reply-To")
+	if err != nil || len(replyTo) == 0 {
+		return false
+	}
+	from := fromDomain(header)
+	if from == "" {
+		return false
+	}
+	for _, address := range replyTo {
+		if _, replyDomain, err := getUserAndDomainParts(address.Address); err != nil || organizationalDomain(strings.ToLower(replyDomain)) != organizationalDomain(from) {
+			return true
+		}
+	}
+	return false
+}
+
+func NewSpamService(mailServerRepo MailServerRepository, ticketService TicketService, classifier *BayesFilter, cacheDriver domain.CacheDriver, eventBusDriver domain.EventBusDriver) (*SpamService, error) {
+	svc, err := NewMailServerService(mailServerRepo, cacheDriver, eventBusDriver)
+	if err != nil {
+		return nil, err
+	}
+	return &SpamService{
+		mailService:   svc,
+		ticketService: ticketService,
+		classifier:    classifier,
+	}, nil
+}
+
+// SpamService lets agents mark tickets as spam, training the classifier on them.
+type SpamService struct {
+	mailService   *MailServerService
+	ticketService TicketService
+	classifier    *BayesFilter
+}
+
+// MarkSpam marks a ticket as spam or not, training the classifier with the ticket's inbound email.
+//
+// Marking a ticket again with the other class corrects the training rather than adding to it.
+func (s *SpamService) MarkSpam(ctx context.Context, ticketID uint64, spam bool) (domain.Ticket, error) {
+	if _, err := s.ticketService.GetTicket(ctx, ticketID); err != nil {
+		return domain.Ticket{}, err
+	}
+
+	emails, err := s.mailService.FindTicketEmails(ctx, ticketID)
+	if err != nil {
+		return domain.Ticket{}, err
+	}
+	for _, e := range emails {
+		if e.Outbound {
+			continue
+		}
+		if err := s.classifier.Train(ctx, e, spam); err != nil {
+			return domain.Ticket{}, err
+		}
+	}
+
+	return s.ticketService.UpdateTicket(ctx, ticketID, domain.TicketUpdateParameters{Spam: &spam})
+}
@@ -0,0 +1,240 @@
+package email
+
+import (
+	"context"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpamPolicy(t *testing.T) {
+	policy := SpamPolicy{Tag: 5, Quarantine: 10, Reject: 20}
+	table := []struct {
+		score  float64
+		action domain.SpamAction
+	}{
+		{score: -3, action: domain.SpamActionNone},
+		{score: 4.9, action: domain.SpamActionNone},
+		{score: 5, action: domain.SpamActionTag},
+		{score: 12, action: domain.SpamActionQuarantine},
+		{score: 20, action: domain.SpamActionReject},
+	}
+	for _, tc := range table {
+		assert.Equal(t, tc.action, policy.action(tc.score), "score %v", tc.score)
+	}
+	assert.Equal(t, domain.SpamActionTag, SpamPolicy{Tag: 5}.action(100), "disabled actions should be skipped")
+
+	assert.NoError(t, policy.Validate())
+	assert.NoError(t, DefaultSpamPolicy.Validate())
+	assert.NoError(t, SpamPolicy{}.Validate(), "every action may be disabled")
+	assert.ErrorIs(t, SpamPolicy{Tag: 10, Quarantine: 5}.Validate(), ErrInvalidSpamThresholds)
+	assert.ErrorIs(t, SpamPolicy{Tag: -1}.Validate(), ErrInvalidSpamThresholds)
+}
+
+func TestHeuristicsFilter(t *testing.T) {
+	const headers = "Date: Mon, 18 Sep 2023 17:58:07 +0000\r\nMessage-ID: <1@example.com>\r\nTo: support@test.com\r\n"
+
+	table := []struct {
+		description    string
+		message        string
+		authentication *domain.EmailAuthentication
+		expectRules    []string
+	}{
+		{
+			description: "ordinary message",
+			message:     headers + "From: Bob <bob@example.com>\r\nSubject: Printer on fire\r\n\r\nHelp\r\n",
+		},
+		{
+			description: "missing headers",
+			message:     "From: bob@example.com\r\n\r\nHelp\r\n",
+			expectRules: []string{"MISSING_DATE", "MISSING_MESSAGE_ID", "MISSING_TO", "EMPTY_SUBJECT"},
+		},
+		{
+			description: "all caps subject",
+			message:     headers + "From: bob@example.com\r\nSubject: FREE MONEY NOW!!!\r\n\r\nHelp\r\n",
+			expectRules: []string{"SUBJECT_ALL_CAPS"},
+		},
+		{
+			description: "short all caps subject",
+			message:     headers + "From: bob@example.com\r\nSubject: URGENT\r\n\r\nHelp\r\n",
+		},
+		{
+			description: "html only",
+			message:     headers + "From: bob@example.com\r\nSubject: Offer\r\nContent-Type: text/html\r\n\r\n<p>Buy</p>\r\n",
+			expectRules: []string{"HTML_ONLY"},
+		},
+		{
+			description: "display name is another address",
+			message:     headers + "From: \"support@bank.com\" <bob@example.com>\r\nSubject: Your account\r\n\r\nHelp\r\n",
+			expectRules: []string{"FROM_NAME_MISMATCH"},
+		},
+		{
+			description: "display name is the same address",
+			message:     headers + "From: \"bob@example.com\" <bob@example.com>\r\nSubject: Hello\r\n\r\nHelp\r\n",
+		},
+		{
+			description: "reply-to another domain",
+			message:     headers + "From: bob@example.com\r\nReply-To: collect@spam.net\r\nSubject: Hello\r\n\r\nHelp\r\n",
+			expectRules: []string{"REPLY_TO_MISMATCH"},
+		},
+		{
+			description: "reply-to a subdomain",
+			message:     headers + "From: bob@example.com\r\nReply-To: help@support.example.com\r\nSubject: Hello\r\n\r\nHelp\r\n",
+		},
+		{
+			description: "failed authentication",
+			message:     headers + "From: bob@example.com\r\nSubject: Hello\r\n\r\nHelp\r\n",
+			authentication: &domain.EmailAuthentication{
+				SPF:   domain.AuthCheck{Result: domain.AuthResultFail},
+				DKIM:  domain.AuthCheck{Result: domain.AuthResultPermError},
+				DMARC: domain.AuthCheck{Result: domain.AuthResultFail},
+			},
+			expectRules: []string{"SPF_FAIL", "DKIM_FAIL", "DMARC_FAIL"},
+		},
+		{
+			description: "dmarc pass",
+			message:     headers + "From: bob@example.com\r\nSubject: Hello\r\n\r\nHelp\r\n",
+			authentication: &domain.EmailAuthentication{
+				SPF:   domain.AuthCheck{Result: domain.AuthResultPass},
+				DMARC: domain.AuthCheck{Result: domain.AuthResultPass},
+			},
+			expectRules: []string{"DMARC_PASS"},
+		},
+	}
+
+	for _, tc := range table {
+		t.Run(tc.description, func(t *testing.T) {
+			msg, err := mail.ReadMessage(strings.NewReader(tc.message))
+			require.NoError(t, err)
+			e, err := domain.NewEmail(*msg)
+			require.NoError(t, err)
+			e.Authentication = tc.authentication
+
+			rules, err := HeuristicsFilter{}.Check(context.Background(), Envelope{}, e)
+			assert.NoError(t, err)
+			names := make([]string, 0, len(rules))
+			for _, rule := range rules {
+				names = append(names, rule.Name)
+			}
+			assert.ElementsMatch(t, tc.expectRules, names)
+		})
+	}
+}
+
+func TestReceiveSpam(t *testing.T) {
+	repo := &mockMailServerRepository{
+		authoritativeDomains: []string{"test.com"},
+		aliases:              []domain.Alias{{User: "support", Domain: "test.com", ID: 1}},
+		emails:               map[uint64]domain.Email{},
+	}
+	tickets := &mockTicketService{tickets: map[uint64]domain.Ticket{}}
+	server := NewServer(repo, tickets, nil, &mockCacheDriver{cache: map[string]interface{}{}}, &mockEventBusDriver{}, nil)
+	server.SpamFilters = []SpamFilter{HeuristicsFilter{}, scoreFilter{}}
+	server.SpamPolicy = SpamPolicy{Tag: 5, Quarantine: 10, Reject: 20}
+	envelope := Envelope{From: "bob@example.com", To: []string{"support@test.com"}}
+	markedSpam := func(ID uint64) bool {
+		ticket := tickets.tickets[ID]
+		return ticket.Meta().Spam
+	}
+	message := func(messageID, score, extra string) *strings.Reader {
+		return strings.NewReader("Date: Mon, 18 Sep 2023 17:58:07 +0000\r\nMessage-ID: <" + messageID + ">\r\nTo: support@test.com\r\nFrom: bob@example.com\r\nX-Score: " + score + "\r\n" + extra + "Subject: Hello\r\n\r\nHi\r\n")
+	}
+
+	t.Run("Ham", func(t *testing.T) {
+		require.NoError(t, server.ReceiveData(envelope, message("1@example.com", "1", "")))
+		require.Contains(t, repo.emails, uint64(1))
+		e := repo.emails[1]
+		require.NotNil(t, e.Spam, "the spam report should be stored")
+		assert.Equal(t, domain.SpamActionNone, e.Spam.Action)
+		assert.Equal(t, []domain.SpamRule{{Name: "SCORE", Score: 1}}, e.Spam.Rules)
+		assert.False(t, markedSpam(1), "ham shouldn't be marked as spam")
+	})
+
+	t.Run("Tag", func(t *testing.T) {
+		require.NoError(t, server.ReceiveData(envelope, message("2@example.com", "6", "")))
+		e := repo.emails[2]
+		assert.Equal(t, domain.SpamActionTag, e.Spam.Action)
+		require.NotNil(t, e.TicketID, "tagged mail should still open a ticket")
+		assert.True(t, markedSpam(*e.TicketID), "the ticket should be marked as spam")
+	})
+
+	t.Run("TagReply", func(t *testing.T) {
+		require.NoError(t, server.ReceiveData(envelope, message("3@example.com", "6", "In-Reply-To: <1@example.com>\r\n")))
+		assert.Equal(t, uint64(1), *repo.emails[3].TicketID, "tagged replies should be threaded")
+		assert.True(t, markedSpam(1), "the ticket replied to should be marked as spam")
+	})
+
+	t.Run("Quarantine", func(t *testing.T) {
+		before := len(tickets.tickets)
+		require.NoError(t, server.ReceiveData(envelope, message("4@example.com", "12", "")))
+		e := repo.emails[4]
+		assert.Equal(t, domain.SpamActionQuarantine, e.Spam.Action, "quarantined mail should be stored")
+		assert.Nil(t, e.TicketID, "quarantined mail shouldn't be linked to a ticket")
+		assert.Len(t, tickets.tickets, before, "quarantined mail shouldn't open a ticket")
+		require.NotNil(t, e.Quarantine, "the email should be held in quarantine")
+		assert.Equal(t, domain.QuarantineReasonSpam, e.Quarantine.Reason)
+		assert.Equal(t, "scored 12.0", e.Quarantine.Detail)
+		assert.Equal(t, []string{"support@test.com"}, e.Quarantine.Recipients)
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		before := len(repo.emails)
+		err := server.ReceiveData(envelope, message("5@example.com", "25", ""))
+		assert.ErrorIs(t, err, ErrSpamRejected)
+		assert.Len(t, repo.emails, before, "rejected mail shouldn't be stored")
+	})
+
+	t.Run("HeuristicsAddUp", func(t *testing.T) {
+		raw := "From: bob@example.com\r\nX-Score: 3\r\n\r\nHi\r\n"
+		require.NoError(t, server.ReceiveData(envelope, strings.NewReader(raw)))
+		e := repo.emails[uint64(len(repo.emails))]
+		assert.Equal(t, 6.0, e.Spam.Score, "every filter's rules should count towards the score")
+		assert.Equal(t, domain.SpamActionTag, e.Spam.Action)
+	})
+}
+
+func TestMarkSpam(t *testing.T) {
+	ticketID := uint64(1)
+	repo := &mockMailServerRepository{
+		emails: map[uint64]domain.Email{
+			1: {ID: 1, TicketID: &ticketID, Subject: "Cheap pills", TextBody: "Buy cheap pills now"},
+			2: {ID: 2, TicketID: &ticketID, Subject: "Re: Cheap pills", TextBody: "No thanks", Outbound: true},
+		},
+	}
+	tickets := &mockTicketService{tickets: map[uint64]domain.Ticket{}}
+	_, err := tickets.OpenTicket(context.Background(), "Cheap pills")
+	require.NoError(t, err)
+	training := &mockSpamTrainingRepository{}
+	svc, err := NewSpamService(repo, tickets, NewBayesFilter(training), &mockCacheDriver{cache: map[string]interface{}{}}, &mockEventBusDriver{})
+	require.NoError(t, err)
+
+	ticket, err := svc.MarkSpam(context.Background(), ticketID, true)
+	assert.NoError(t, err)
+	assert.True(t, ticket.Meta().Spam, "the ticket should be marked as spam")
+	assert.Equal(t, map[uint64]bool{1: true}, training.trained, "only inbound email should be trained")
+	assert.Equal(t, 1, training.tokens["pills"].Spam)
+
+	ticket, err = svc.MarkSpam(context.Background(), ticketID, false)
+	assert.NoError(t, err)
+	assert.False(t, ticket.Meta().Spam, "the ticket should no longer be spam")
+	assert.Equal(t, domain.SpamTokenCount{Ham: 1}, training.tokens["pills"], "retraining should correct the counts")
+
+	_, err = svc.MarkSpam(context.Background(), 99, true)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+// scoreFilter scores messages with their X-Score header.
+type scoreFilter struct{}
+
+func (scoreFilter) Check(ctx context.Context, envelope Envelope, e domain.Email) ([]domain.SpamRule, error) {
+	score, err := strconv.ParseFloat(e.Message.Header.Get("X-Score"), 64)
+	if err != nil {
+		return nil, err
+	}
+	return []domain.SpamRule{{Name: "SCORE", Score: score}}, nil
+}
@@ -0,0 +1,102 @@
+package email
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nil-nil/ticket/internal/domain"
+)
+
+var subjectTokenRegex = regexp.MustCompile(`\[#(\d+)\]`)
+
+// SubjectToken returns the token identifying a ticket in an email subject, e.g. "[#123]".
+func SubjectToken(ticketID uint64) string {
+	return fmt.Sprintf("[#%d]", ticketID)
+}
+
+// ParseSubjectToken finds a ticket token such as "[#123]" in an email subject and returns the ticket ID.
+func ParseSubjectToken(subject string) (ticketID uint64, ok bool) {
+	submatch := subjectTokenRegex.FindStringSubmatch(subject)
+	if len(submatch) != 2 {
+		return 0, false
+	}
+
+	ticketID, err := strconv.ParseUint(submatch[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return ticketID, true
+}
+
+// threadMessageIDs returns the message IDs a message refers to, most relevant first.
+//
+// In-Reply-To comes first, followed by References newest first, as References lists the thread oldest first.
+func threadMessageIDs(header mail.Header) []string {
+	ids := parseMessageIDList(header.Get("In-Reply-To"))
+	references := parseMessageIDList(header.Get("References"))
+	slices.Reverse(references)
+
+	seen := make(map[string]struct{}, len(ids)+len(references))
+	unique := make([]string, 0, len(ids)+len(references))
+	for _, id := range append(ids, references...) {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		unique = append(unique, id)
+	}
+
+	return unique
+}
+
+// replyReferences returns the References for a reply to parent, oldest first.
+//
+// As in RFC 5322 this is the parent's References, or its In-Reply-To if it has no References, followed by the parent's own message ID.
+func replyReferences(parent domain.Email) []string {
+	references := parseMessageIDList(parent.Message.Header.Get("References"))
+	if len(references) == 0 {
+		references = parseMessageIDList(parent.Message.Header.Get("In-Reply-To"))
+		if len(references) > 1 {
+			references = nil
+		}
+	}
+	if parent.MessageID != "" {
+		references = append(references, parent.MessageID)
+	}
+	return references
+}
+
+// parseMessageIDList parses a list of message IDs like "<a@example.com> <b@example.com>".
+//
+// Some clients leave off the angle brackets, in which case the IDs are split on whitespace.
+func parseMessageIDList(value string) []string {
+	ids := make([]string, 0)
+	if !strings.Contains(value, "<") {
+		for _, field := range strings.Fields(value) {
+			ids = append(ids, domain.ParseMessageID(field))
+		}
+		return ids
+	}
+
+	for {
+		start := strings.Index(value, "<")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(value[start:], ">")
+		if end < 0 {
+			break
+		}
+		if id := domain.ParseMessageID(value[start : start+end+1]); id != "" {
+			ids = append(ids, id)
+		}
+		value = value[start+end+1:]
+	}
+
+	return ids
+}
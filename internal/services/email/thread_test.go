@@ -0,0 +1,60 @@
+package email
+
+import (
+	"net/mail"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubjectToken(t *testing.T) {
+	assert.Equal(t, "[#123]", SubjectToken(123))
+
+	table := []struct {
+		description string
+		subject     string
+		expectID    uint64
+		expectOk    bool
+	}{
+		{description: "token", subject: "Re: [#123] Printer on fire", expectID: 123, expectOk: true},
+		{description: "round trip", subject: SubjectToken(42), expectID: 42, expectOk: true},
+		{description: "no token", subject: "Printer on fire", expectID: 0, expectOk: false},
+		{description: "not a number", subject: "[#abc] Printer on fire", expectID: 0, expectOk: false},
+		{description: "overflow", subject: "[#99999999999999999999999]", expectID: 0, expectOk: false},
+	}
+	for _, tc := range table {
+		t.Run(tc.description, func(t *testing.T) {
+			ID, ok := ParseSubjectToken(tc.subject)
+			assert.Equal(t, tc.expectID, ID)
+			assert.Equal(t, tc.expectOk, ok)
+		})
+	}
+}
+
+func TestThreadMessageIDs(t *testing.T) {
+	table := []struct {
+		description string
+		header      mail.Header
+		expect      []string
+	}{
+		{description: "no headers", header: mail.Header{}, expect: []string{}},
+		{description: "in reply to", header: mail.Header{"In-Reply-To": {"<a@example.com>"}}, expect: []string{"a@example.com"}},
+		{
+			description: "references newest first",
+			header:      mail.Header{"References": {"<a@example.com>\r\n <b@example.com> <c@example.com>"}},
+			expect:      []string{"c@example.com", "b@example.com", "a@example.com"},
+		},
+		{
+			description: "in reply to before references without duplicates",
+			header:      mail.Header{"In-Reply-To": {"<c@example.com>"}, "References": {"<a@example.com> <b@example.com> <c@example.com>"}},
+			expect:      []string{"c@example.com", "b@example.com", "a@example.com"},
+		},
+		{description: "missing brackets", header: mail.Header{"References": {"a@example.com b@example.com"}}, expect: []string{"b@example.com", "a@example.com"}},
+		{description: "unterminated", header: mail.Header{"In-Reply-To": {"<a@example.com> <b@exa"}}, expect: []string{"a@example.com"}},
+	}
+	for _, tc := range table {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expect, threadMessageIDs(tc.header))
+		})
+	}
+}
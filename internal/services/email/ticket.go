@@ -0,0 +1,159 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/nil-nil/ticket/internal/domain"
+)
+
+// maxDescriptionLength caps descriptions taken from a message body, as bodies can be arbitrarily long.
+const maxDescriptionLength = 200
+
+// ticketEmail links an email to a ticket if any of its envelope recipients is one of our aliases.
+//
+// Replies to a ticket append a transition to that ticket, reopening it if it was closed and the workflow allows.
+// Anything else opens a new ticket, routed as set up on the first recipient alias. Either way the ticket is tagged
+// with the recipients' subaddresses, and marked as spam if the spam filters tagged the email.
+//
+// The message ID is indexed as soon as the ticket is opened or updated, so a message redelivered after a failure
+// picks up where it left off rather than opening another ticket.
+func (s *Server) ticketEmail(ctx context.Context, envelope Envelope, e domain.Email) error {
+	if s.ticketService == nil {
+		return nil
+	}
+	matches := s.aliasMatches(ctx, envelope.To)
+	if len(matches) == 0 {
+		return nil
+	}
+	var tags []string
+	for _, match := range matches {
+		if match.Tag != "" {
+			tags = append(tags, match.Tag)
+		}
+	}
+
+	ticketID, err := s.mailService.FindTicketIDByMessageID(ctx, e.MessageID)
+	if err == nil {
+		return s.resumeTicketEmail(ctx, e, ticketID, matches[0], tags)
+	} else if !errors.Is(err, domain.ErrNotFound) {
+		return err
+	}
+
+	ticket, err := s.replyTicket(ctx, e)
+	if errors.Is(err, domain.ErrNotFound) {
+		ticket, err = s.ticketService.OpenTicket(ctx, ticketDescription(e))
+		if err != nil {
+			return err
+		}
+		if err := s.mailService.IndexMessageID(ctx, e.MessageID, ticket.ID); err != nil {
+			return err
+		}
+		if err := s.routeTicket(ctx, e, ticket.ID, matches[0], tags); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else {
+		params := domain.TicketUpdateParameters{EmailID: &e.ID, AddTags: domain.NormalizeTags(tags)}
+		if ticket.Meta().Status == domain.TicketStatusClosed {
+			params.Status = domain.TicketStatusOpen
+		}
+		if spamTagged(e) {
+			spam := true
+			params.Spam = &spam
+		}
+		_, err := s.ticketService.UpdateTicket(ctx, ticket.ID, params)
+		var workflowErr *domain.WorkflowError
+		if errors.As(err, &workflowErr) {
+			// The reply is still threaded if the workflow doesn't let it reopen the ticket
+			params.Status = domain.TicketStatusUnknown
+			_, err = s.ticketService.UpdateTicket(ctx, ticket.ID, params)
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.mailService.IndexMessageID(ctx, e.MessageID, ticket.ID); err != nil {
+			return err
+		}
+	}
+
+	return s.mailService.LinkTicket(ctx, e, ticket.ID)
+}
+
+// routeTicket records the email that opened a ticket, routing it as set up on the alias it was sent to.
+func (s *Server) routeTicket(ctx context.Context, e domain.Email, ticketID uint64, match aliasMatch, tags []string) error {
+	params := match.Alias.Routing.TicketParameters()
+	params.EmailID = &e.ID
+	params.AddTags = domain.NormalizeTags(append(slices.Clone(params.AddTags), tags...))
+	if spamTagged(e) {
+		spam := true
+		params.Spam = &spam
+	}
+	_, err := s.ticketService.UpdateTicket(ctx, ticketID, params)
+	return err
+}
+
+// resumeTicketEmail finishes ticketing a redelivered message whose ID was already indexed for the ticket.
+//
+// A ticket without a transition recording an email was opened by the message but never routed.
+func (s *Server) resumeTicketEmail(ctx context.Context, e domain.Email, ticketID uint64, match aliasMatch, tags []string) error {
+	ticket, err := s.ticketService.GetTicket(ctx, ticketID)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(ticket.Transitions, func(transition domain.TicketTransition) bool { return transition.EmailID != nil }) {
+		if err := s.routeTicket(ctx, e, ticket.ID, match, tags); err != nil {
+			return err
+		}
+	}
+
+	return s.mailService.LinkTicket(ctx, e, ticket.ID)
+}
+
+// replyTicket returns the existing ticket an email is a reply to.
+//
+// domain.ErrNotFound is returned if the email isn't a reply, or the ticket it refers to doesn't exist.
+func (s *Server) replyTicket(ctx context.Context, e domain.Email) (domain.Ticket, error) {
+	ticketID, err := s.mailService.FindReplyTicket(ctx, e)
+	if err != nil {
+		return domain.Ticket{}, err
+	}
+
+	return s.ticketService.GetTicket(ctx, ticketID)
+}
+
+// aliasMatches returns the live aliases on our domains the addresses resolve to, in the order of the addresses.
+func (s *Server) aliasMatches(ctx context.Context, addresses []string) []aliasMatch {
+	var matches []aliasMatch
+	for _, address := range addresses {
+		if match, err := s.mailService.findAlias(ctx, address); err == nil {
+			matches = append(matches, match)
+		}
+	}
+	return matches
+}
+
+// ticketDescription uses the subject as the ticket description, falling back to the first line of the text body.
+func ticketDescription(e domain.Email) string {
+	if subject := strings.TrimSpace(e.Subject); subject != "" {
+		return subject
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(e.TextBody))
+	for scanner.Scan() {
+		line := []rune(strings.TrimSpace(scanner.Text()))
+		if len(line) == 0 {
+			continue
+		}
+		if len(line) > maxDescriptionLength {
+			line = line[:maxDescriptionLength]
+		}
+		return string(line)
+	}
+
+	return "(no subject)"
+}
@@ -0,0 +1,235 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nil-nil/ticket/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTicketEmail(t *testing.T) {
+	repo := &mockMailServerRepository{
+		authoritativeDomains: []string{"test.com"},
+		aliases:              []domain.Alias{{User: "support", Domain: "test.com", ID: 1}},
+		emails:               map[uint64]domain.Email{},
+	}
+	tickets := &mockTicketService{tickets: map[uint64]domain.Ticket{}}
+	server := NewServer(repo, tickets, nil, &mockCacheDriver{cache: map[string]interface{}{}}, &mockEventBusDriver{}, nil)
+	envelope := Envelope{From: "bob@example.com", To: []string{"support@test.com"}}
+
+	t.Run("NewMessageOpensTicket", func(t *testing.T) {
+		err := server.ReceiveData(envelope, strings.NewReader("Message-ID: <1@example.com>\r\nSubject: Printer on fire\r\n\r\nHelp\r\n"))
+		assert.NoError(t, err)
+		assert.Len(t, tickets.tickets, 1, "a ticket should be opened")
+		ticket := tickets.tickets[1]
+		assert.Equal(t, "Printer on fire", ticket.Meta().Description, "description should come from the subject")
+		require.Len(t, ticket.Transitions, 2)
+		assert.Equal(t, uint64(1), *ticket.Transitions[1].EmailID, "the email opening the ticket should be recorded")
+		assert.Equal(t, uint64(1), *repo.emails[1].TicketID, "email should be linked to the ticket")
+	})
+
+	t.Run("ReplyAppendsTransition", func(t *testing.T) {
+		err := server.ReceiveData(envelope, strings.NewReader("Message-ID: <2@example.com>\r\nIn-Reply-To: <1@example.com>\r\nSubject: Re: Printer on fire\r\n\r\nStill burning\r\n"))
+		assert.NoError(t, err)
+		assert.Len(t, tickets.tickets, 1, "no new ticket should be opened for a reply")
+		transitions := tickets.tickets[1].Transitions
+		assert.Len(t, transitions, 3, "a transition should be appended")
+		assert.Equal(t, uint64(2), *transitions[2].EmailID, "transition should reference the reply")
+		assert.Equal(t, domain.TicketStatusUnknown, transitions[2].Status, "status of an open ticket shouldn't change")
+		assert.Equal(t, uint64(1), *repo.emails[2].TicketID, "reply should be linked to the ticket")
+	})
+
+	t.Run("ReplyReopensClosedTicket", func(t *testing.T) {
+		tickets.UpdateTicket(context.Background(), 1, domain.TicketUpdateParameters{Status: domain.TicketStatusClosed})
+		err := server.ReceiveData(envelope, strings.NewReader("Message-ID: <3@example.com>\r\nIn-Reply-To: <2@example.com>\r\nSubject: Re: Printer on fire\r\n\r\nIt's back\r\n"))
+		assert.NoError(t, err)
+		ticket := tickets.tickets[1]
+		assert.Equal(t, domain.TicketStatusOpen, ticket.Meta().Status, "closed ticket should be reopened")
+	})
+
+	t.Run("ReferencesThreadReply", func(t *testing.T) {
+		err := server.ReceiveData(envelope, strings.NewReader("Message-ID: <4@example.com>\r\nReferences: <1@example.com> <unknown@example.com>\r\nSubject: Printer\r\n\r\nStill broken\r\n"))
+		assert.NoError(t, err)
+		assert.Len(t, tickets.tickets, 1, "no new ticket should be opened for a reply found through References")
+		assert.Equal(t, uint64(1), *repo.emails[4].TicketID, "reply should be linked to the ticket")
+	})
+
+	t.Run("SubjectTokenReply", func(t *testing.T) {
+		err := server.ReceiveData(envelope, strings.NewReader("Message-ID: <5@example.com>\r\nSubject: Re: [#1] Printer on fire\r\n\r\nAny news?\r\n"))
+		assert.NoError(t, err)
+		assert.Len(t, tickets.tickets, 1, "no new ticket should be opened for a reply found through the subject token")
+		assert.Equal(t, uint64(1), *repo.emails[5].TicketID, "reply should be linked to the ticket")
+		assert.Equal(t, uint64(1), repo.messageIDs["5@example.com"], "reply message id should be indexed")
+	})
+
+	t.Run("SubjectTokenForMissingTicket", func(t *testing.T) {
+		err := server.ReceiveData(envelope, strings.NewReader("Message-ID: <6@example.com>\r\nSubject: [#99] Something else\r\n\r\nHi\r\n"))
+		assert.NoError(t, err)
+		assert.Len(t, tickets.tickets, 2, "a new ticket should be opened if the token doesn't match a ticket")
+		assert.Equal(t, uint64(2), *repo.emails[6].TicketID, "email should be linked to the new ticket")
+	})
+
+	t.Run("NotToAnAlias", func(t *testing.T) {
+		err := server.ReceiveData(Envelope{From: "bob@example.com", To: []string{"someone@example.com"}}, strings.NewReader("Subject: Relay\r\n\r\nHi\r\n"))
+		assert.NoError(t, err)
+		assert.Len(t, tickets.tickets, 2, "no ticket should be opened for mail not sent to an alias")
+		assert.Nil(t, repo.emails[7].TicketID, "email shouldn't be linked to a ticket")
+	})
+
+	t.Run("SubaddressTagsTicket", func(t *testing.T) {
+		err := server.ReceiveData(Envelope{From: "bob@example.com", To: []string{"Support+Billing@test.com"}}, strings.NewReader("Message-ID: <8@example.com>\r\nSubject: Invoice\r\n\r\nWrong amount\r\n"))
+		assert.NoError(t, err)
+		assert.Len(t, tickets.tickets, 3, "a ticket should be opened for a subaddress of an alias")
+		ticket := tickets.tickets[3]
+		assert.Equal(t, []string{"billing"}, ticket.Meta().Tags, "the subaddress should tag the ticket")
+
+		err = server.ReceiveData(Envelope{From: "bob@example.com", To: []string{"support+urgent@test.com"}}, strings.NewReader("Message-ID: <9@example.com>\r\nIn-Reply-To: <8@example.com>\r\nSubject: Re: Invoice\r\n\r\nStill wrong\r\n"))
+		assert.NoError(t, err)
+		ticket = tickets.tickets[3]
+		assert.Equal(t, []string{"billing", "urgent"}, ticket.Meta().Tags, "replies should add their subaddress")
+	})
+
+	t.Run("AliasRouting", func(t *testing.T) {
+		owner := uint64(7)
+		repo.aliases = append(repo.aliases, domain.Alias{User: "sales", Domain: "test.com", ID: 2, Routing: domain.AliasRouting{
+			Queue: "sales", DefaultOwnerID: &owner, Priority: domain.TicketPriorityHigh, Tags: []string{"lead"},
+		}})
+		server.mailService.ObserveAliasEvents(domain.UpdateEvent, repo.aliases[1])
+
+		err := server.ReceiveData(Envelope{From: "bob@example.com", To: []string{"sales+eu@test.com", "support@test.com"}}, strings.NewReader("Message-ID: <10@example.com>\r\nSubject: Quote\r\n\r\nHow much?\r\n"))
+		assert.NoError(t, err)
+		assert.Len(t, tickets.tickets, 4, "a ticket should be opened")
+		ticket := tickets.tickets[4]
+		meta := ticket.Meta()
+		assert.Equal(t, "sales", meta.Queue, "the ticket should be routed by the first alias")
+		assert.Equal(t, &owner, meta.OwnerID)
+		assert.Equal(t, domain.TicketPriorityHigh, meta.Priority)
+		assert.Equal(t, []string{"lead", "eu"}, meta.Tags, "the alias's tags and the subaddress should tag the ticket")
+
+		err = server.ReceiveData(Envelope{From: "bob@example.com", To: []string{"sales@test.com"}}, strings.NewReader("Message-ID: <11@example.com>\r\nIn-Reply-To: <8@example.com>\r\nSubject: Re: Invoice\r\n\r\nAlso a quote\r\n"))
+		assert.NoError(t, err)
+		ticket = tickets.tickets[3]
+		assert.Empty(t, ticket.Meta().Queue, "replies shouldn't route existing tickets")
+	})
+
+	t.Run("WorkflowRefusesReopen", func(t *testing.T) {
+		workflow, err := domain.NewWorkflow(nil, []domain.WorkflowTransition{
+			{From: []domain.TicketStatus{domain.TicketStatusBlocked}, To: domain.TicketStatusOpen},
+			{To: domain.TicketStatusClosed},
+		})
+		require.NoError(t, err)
+		tickets.workflow = workflow
+		defer func() { tickets.workflow = nil }()
+		_, err = tickets.UpdateTicket(context.Background(), 1, domain.TicketUpdateParameters{Status: domain.TicketStatusClosed})
+		require.NoError(t, err)
+
+		err = server.ReceiveData(envelope, strings.NewReader("Message-ID: <12@example.com>\r\nIn-Reply-To: <1@example.com>\r\nSubject: Re: Printer on fire\r\n\r\nThanks\r\n"))
+		assert.NoError(t, err)
+		ticket := tickets.tickets[1]
+		assert.Equal(t, domain.TicketStatusClosed, ticket.Meta().Status, "the ticket should stay closed")
+		e := repo.emails[uint64(len(repo.emails))]
+		assert.Equal(t, uint64(1), *e.TicketID, "the reply should still be threaded")
+	})
+
+	t.Run("RedeliveryResumes", func(t *testing.T) {
+		message := "Message-ID: <13@example.com>\r\nSubject: Scanner jammed\r\n\r\nHelp\r\n"
+		tickets.updateErr = errors.New("connection reset")
+		err := server.ReceiveData(envelope, strings.NewReader(message))
+		tickets.updateErr = nil
+		require.Error(t, err, "a failure routing the ticket should fail delivery")
+		opened := uint64(len(tickets.tickets))
+
+		require.NoError(t, server.ReceiveData(envelope, strings.NewReader(message)))
+		assert.Len(t, tickets.tickets, int(opened), "redelivery shouldn't open another ticket")
+		redelivered := uint64(len(repo.emails))
+		assert.Equal(t, opened, *repo.emails[redelivered].TicketID, "the redelivered email should be linked to the ticket")
+		transitions := tickets.tickets[opened].Transitions
+		require.Len(t, transitions, 2, "the ticket should be routed once")
+		assert.Equal(t, redelivered, *transitions[1].EmailID)
+
+		require.NoError(t, server.ReceiveData(envelope, strings.NewReader(message)))
+		assert.Len(t, tickets.tickets[opened].Transitions, 2, "a message already ticketed shouldn't update the ticket again")
+	})
+}
+
+func TestTicketDescription(t *testing.T) {
+	table := []struct {
+		description string
+		email       domain.Email
+		expect      string
+	}{
+		{description: "subject", email: domain.Email{Subject: " Hello "}, expect: "Hello"},
+		{description: "body first line", email: domain.Email{TextBody: "\r\n  First line\r\nSecond line"}, expect: "First line"},
+		{description: "long body line", email: domain.Email{TextBody: strings.Repeat("é", 300)}, expect: strings.Repeat("é", maxDescriptionLength)},
+		{description: "nothing", email: domain.Email{}, expect: "(no subject)"},
+	}
+	for _, tc := range table {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expect, ticketDescription(tc.email))
+		})
+	}
+}
+
+type mockTicketService struct {
+	tickets map[uint64]domain.Ticket
+	// workflow is enforced on status changes if set
+	workflow *domain.Workflow
+	// openErr fails opening tickets
+	openErr error
+	// updateErr fails updating tickets
+	updateErr error
+}
+
+func (m *mockTicketService) GetTicket(ctx context.Context, ID uint64) (domain.Ticket, error) {
+	ticket, ok := m.tickets[ID]
+	if !ok {
+		return domain.Ticket{}, domain.ErrNotFound
+	}
+	return ticket, nil
+}
+
+func (m *mockTicketService) OpenTicket(ctx context.Context, Description string) (domain.Ticket, error) {
+	if m.openErr != nil {
+		return domain.Ticket{}, m.openErr
+	}
+	ID := uint64(len(m.tickets) + 1)
+	m.tickets[ID] = domain.Ticket{
+		ID:          ID,
+		Transitions: []domain.TicketTransition{{Timestamp: time.Now(), Status: domain.TicketStatusOpen, Description: &Description}},
+	}
+	return m.tickets[ID], nil
+}
+
+func (m *mockTicketService) UpdateTicket(ctx context.Context, ID uint64, Params domain.TicketUpdateParameters) (domain.Ticket, error) {
+	ticket, ok := m.tickets[ID]
+	if !ok {
+		return domain.Ticket{}, domain.ErrNotFound
+	}
+	if m.updateErr != nil {
+		return domain.Ticket{}, m.updateErr
+	}
+	if m.workflow != nil {
+		if err := m.workflow.Check(ticket.Meta().Status, Params); err != nil {
+			return domain.Ticket{}, err
+		}
+	}
+	ticket.Transitions = append(ticket.Transitions, domain.TicketTransition{
+		Timestamp:   time.Now(),
+		Status:      Params.Status,
+		OwnerID:     Params.OwnerID,
+		Description: Params.Description,
+		EmailID:     Params.EmailID,
+		Spam:        Params.Spam,
+		AddTags:     Params.AddTags,
+		Priority:    Params.Priority,
+		Queue:       Params.Queue,
+		Resolution:  Params.Resolution,
+	})
+	m.tickets[ID] = ticket
+	return ticket, nil
+}